@@ -0,0 +1,131 @@
+#!/usr/bin/env python3
+"""Directory hashing benchmarks.
+
+Compares: komparu.hash_dir (sequential vs parallel), hashlib serial walk.
+Scenarios: 5000 files × 16KB, 1000 files × 256KB.
+
+Usage:
+    python bench_hash_dir.py           # all benchmarks
+    python bench_hash_dir.py --fast    # quick run
+"""
+
+from __future__ import annotations
+
+import argparse
+import hashlib
+import json
+import os
+import shutil
+from pathlib import Path
+
+from bench_dir import compute_stats, format_time, print_results_table, time_func
+from conftest import (
+    RESULTS_DIR,
+    cleanup_tmpfs,
+    create_test_dirs,
+    ensure_tmpfs,
+    warm_page_cache,
+)
+
+KB = 1024
+
+REPEATS = 10
+REPEATS_FAST = 3
+
+
+# ── Benchmark callables ──────────────────────────────────────────────
+
+def bench_komparu_sequential(directory: str) -> None:
+    import komparu
+    komparu.hash_dir(directory, max_workers=1)
+
+
+def bench_komparu_parallel(directory: str) -> None:
+    import komparu
+    komparu.hash_dir(directory)
+
+
+def bench_hashlib_serial(directory: str) -> None:
+    """Serial os.walk + hashlib.sha256 — the common pure-Python approach."""
+    for root, _dirs, files in os.walk(directory):
+        for name in files:
+            with open(os.path.join(root, name), "rb") as f:
+                hashlib.file_digest(f, "sha256")
+
+
+# ── Scenarios ────────────────────────────────────────────────────────
+
+HASH_SCENARIOS = [
+    {"name": "hash_5000x16KB", "num_files": 5000, "file_size": 16 * KB},
+    {"name": "hash_1000x256KB", "num_files": 1000, "file_size": 256 * KB},
+]
+
+
+def run_benchmarks(fast: bool = False) -> dict:
+    tmpfs = ensure_tmpfs()
+    repeats = REPEATS_FAST if fast else REPEATS
+
+    all_results = {}
+
+    for scenario in HASH_SCENARIOS:
+        bench_name = scenario["name"]
+        print(f"\n{'='*60}")
+        print(f"  {bench_name}")
+        print(f"{'='*60}")
+
+        data_dir = tmpfs / bench_name
+        dir_a, _ = create_test_dirs(
+            data_dir,
+            num_files=scenario["num_files"],
+            file_size=scenario["file_size"],
+        )
+        warm_page_cache(dir_a)
+
+        d = str(dir_a)
+        results = {}
+
+        for name, func in [
+            ("komparu_parallel", bench_komparu_parallel),
+            ("komparu_sequential", bench_komparu_sequential),
+            ("hashlib", bench_hashlib_serial),
+        ]:
+            print(f"  {name}...", end=" ", flush=True)
+            times = time_func(func, (d,), repeats=repeats)
+            stats = compute_stats(times)
+            results[name] = stats
+            print(f"{format_time(stats['median'])} (median)", flush=True)
+
+        all_results[bench_name] = results
+        shutil.rmtree(data_dir, ignore_errors=True)
+
+    return all_results
+
+
+def main():
+    parser = argparse.ArgumentParser(description="Directory hashing benchmarks")
+    parser.add_argument("--fast", action="store_true", help="Quick run")
+    args = parser.parse_args()
+
+    try:
+        results = run_benchmarks(fast=args.fast)
+        table = print_results_table(results)
+
+        clean = {}
+        for bench_name, tools in results.items():
+            clean[bench_name] = {}
+            for name, data in tools.items():
+                clean[bench_name][name] = {k: v for k, v in data.items() if k != "raw"}
+        with open(RESULTS_DIR / "hash_dir_results.json", "w") as f:
+            json.dump(clean, f, indent=2)
+
+        with open(RESULTS_DIR / "hash_dir_results.md", "w") as f:
+            f.write("# Directory Hashing Benchmarks\n\n")
+            f.write(table)
+
+        print(f"\nResults saved to {RESULTS_DIR}/hash_dir_results.json")
+    finally:
+        cleanup_tmpfs()
+
+
+if __name__ == "__main__":
+    main()
@@ -0,0 +1,143 @@
+#!/usr/bin/env python3
+"""Huge page benchmarks for large file comparison.
+
+Compares: komparu.compare with huge_pages=False vs huge_pages=True.
+Scenario: identical multi-GB files (full scan, worst case for TLB misses).
+
+Huge pages only matter when the kernel grants them, so the per-file
+outcome (hugetlbfs / madvise / refused) and the THP mode are recorded
+next to the timings. Point --dir at a hugetlbfs mount or a filesystem
+with file-backed THP to measure a real difference; on the default tmpfs
+it depends on /sys/kernel/mm/transparent_hugepage/shmem_enabled.
+
+Usage:
+    python bench_huge_pages.py                        # 4GB on tmpfs
+    python bench_huge_pages.py --size 8GB --dir /mnt/huge
+    python bench_huge_pages.py --fast                 # 1GB, fewer samples
+"""
+
+from __future__ import annotations
+
+import argparse
+import json
+import shutil
+from pathlib import Path
+
+from bench_dir import compute_stats, format_time, print_results_table, time_func
+from conftest import (
+    RESULTS_DIR,
+    cleanup_tmpfs,
+    create_test_files,
+    ensure_tmpfs,
+    size_label,
+    warm_page_cache,
+)
+
+GB = 1024 ** 3
+
+SIZES = {"1GB": 1 * GB, "2GB": 2 * GB, "4GB": 4 * GB, "8GB": 8 * GB}
+
+REPEATS = 10
+REPEATS_FAST = 3
+
+
+# ── Benchmark callables ──────────────────────────────────────────────
+
+def bench_normal_pages(file_a: str, file_b: str) -> None:
+    import komparu
+    komparu.compare(file_a, file_b)
+
+
+def bench_huge_pages(file_a: str, file_b: str) -> None:
+    import komparu
+    komparu.compare(file_a, file_b, huge_pages=True)
+
+
+def huge_page_outcome(file_a: str, file_b: str) -> dict:
+    import komparu
+    from komparu._helpers import thp_mode
+
+    out = komparu.FileDiff()
+    komparu.compare_into(file_a, file_b, out, huge_pages=True)
+    return {
+        "thp_mode": thp_mode(),
+        "io_a": out.io_a.huge_pages if out.io_a else None,
+        "io_b": out.io_b.huge_pages if out.io_b else None,
+    }
+
+
+def run_benchmarks(size: int, base: Path | None, fast: bool = False) -> tuple[dict, dict]:
+    data_root = base if base is not None else ensure_tmpfs()
+    repeats = REPEATS_FAST if fast else REPEATS
+    bench_name = f"identical_{size_label(size)}"
+
+    print(f"\n{'='*60}")
+    print(f"  {bench_name} in {data_root}")
+    print(f"{'='*60}")
+
+    data_dir = data_root / "huge_pages"
+    file_a, file_b = create_test_files(data_dir, size, "identical")
+    warm_page_cache(file_a, file_b)
+
+    a, b = str(file_a), str(file_b)
+    outcome = huge_page_outcome(a, b)
+    print(f"  huge pages: {outcome}")
+
+    results = {}
+    try:
+        for name, func in [
+            ("normal_pages", bench_normal_pages),
+            ("huge_pages", bench_huge_pages),
+        ]:
+            print(f"  {name}...", end=" ", flush=True)
+            times = time_func(func, (a, b), repeats=repeats, warmups=1)
+            stats = compute_stats(times)
+            results[name] = stats
+            print(f"{format_time(stats['median'])} (median)", flush=True)
+    finally:
+        shutil.rmtree(data_dir, ignore_errors=True)
+
+    return {bench_name: results}, outcome
+
+
+def main():
+    parser = argparse.ArgumentParser(description="Huge page benchmarks")
+    parser.add_argument("--size", choices=SIZES, default=None, help="File size (default: 4GB, 1GB with --fast)")
+    parser.add_argument("--dir", type=Path, default=None, help="Directory for test data (default: tmpfs)")
+    parser.add_argument("--fast", action="store_true", help="Quick run")
+    args = parser.parse_args()
+
+    size = SIZES[args.size or ("1GB" if args.fast else "4GB")]
+
+    try:
+        results, outcome = run_benchmarks(size, args.dir, fast=args.fast)
+        table = print_results_table(results)
+
+        clean = {
+            "outcome": outcome,
+            "results": {
+                bench_name: {
+                    name: {k: v for k, v in data.items() if k != "raw"}
+                    for name, data in tools.items()
+                }
+                for bench_name, tools in results.items()
+            },
+        }
+        with open(RESULTS_DIR / "huge_pages_results.json", "w") as f:
+            json.dump(clean, f, indent=2)
+
+        with open(RESULTS_DIR / "huge_pages_results.md", "w") as f:
+            f.write("# Huge Page Benchmarks\n\n")
+            f.write(
+                f"THP mode: `{outcome['thp_mode']}`; "
+                f"huge page outcome: `{outcome['io_a']}` / `{outcome['io_b']}`\n"
+            )
+            f.write(table)
+
+        print(f"\nResults saved to {RESULTS_DIR}/huge_pages_results.json")
+    finally:
+        cleanup_tmpfs()
+
+
+if __name__ == "__main__":
+    main()
@@ -0,0 +1,181 @@
+#!/usr/bin/env python3
+"""io_uring read path benchmarks for large file comparison.
+
+Compares: komparu.compare on the default mmap path, buffered reads
+(an ``opener`` returning ``open(path, "rb")``, i.e. one read() per chunk),
+and ``io_uring=True`` at several queue depths. Depth 1 keeps one read in
+flight, the same access pattern as a read() loop; higher depths show what
+batched readahead buys.
+Scenario: identical files (full scan), with a warm and a cold page cache.
+
+Cold runs evict both files with POSIX_FADV_DONTNEED before every sample,
+so they measure the device: use --dir on a real SSD/NVMe filesystem (the
+tmpfs default only exercises the warm case meaningfully).
+
+Usage:
+    python bench_io_uring.py --dir /mnt/nvme             # 4GB, warm + cold
+    python bench_io_uring.py --dir /mnt/nvme --fast      # 1GB, fewer samples
+    python bench_io_uring.py --depths 4 16 64
+"""
+
+from __future__ import annotations
+
+import argparse
+import json
+import os
+import shutil
+import time
+from pathlib import Path
+
+from bench_dir import compute_stats, format_time, print_results_table, time_func
+from conftest import (
+    RESULTS_DIR,
+    cleanup_tmpfs,
+    create_test_files,
+    ensure_tmpfs,
+    size_label,
+    warm_page_cache,
+)
+
+GB = 1024 ** 3
+
+SIZES = {"1GB": 1 * GB, "2GB": 2 * GB, "4GB": 4 * GB, "8GB": 8 * GB}
+
+DEPTHS = (1, 8, 32)
+
+REPEATS = 10
+REPEATS_FAST = 3
+
+
+# ── Benchmark callables ──────────────────────────────────────────────
+
+def bench_mmap(file_a: str, file_b: str) -> None:
+    import komparu
+    komparu.compare(file_a, file_b)
+
+
+def bench_buffered(file_a: str, file_b: str) -> None:
+    import komparu
+    komparu.compare(file_a, file_b, opener=lambda p: open(p, "rb"))
+
+
+def make_io_uring(depth: int):
+    def bench(file_a: str, file_b: str) -> None:
+        import komparu
+        komparu.compare(file_a, file_b, io_uring=True, io_uring_depth=depth)
+    return bench
+
+
+def io_uring_outcome(file_a: str, file_b: str) -> dict:
+    import komparu
+
+    out = komparu.FileDiff()
+    komparu.compare_into(file_a, file_b, out, io_uring=True)
+    return {
+        "io_a": out.io_a.path if out.io_a else None,
+        "io_b": out.io_b.path if out.io_b else None,
+        "fallback": out.io_a.fallback if out.io_a else None,
+    }
+
+
+def evict(*paths: str) -> None:
+    """Drop the files from the page cache (no root needed)."""
+    for p in paths:
+        fd = os.open(p, os.O_RDONLY)
+        try:
+            os.fsync(fd)
+            os.posix_fadvise(fd, 0, 0, os.POSIX_FADV_DONTNEED)
+        finally:
+            os.close(fd)
+
+
+def time_cold(func, args: tuple, repeats: int) -> list[float]:
+    times = []
+    for _ in range(repeats):
+        evict(*args)
+        t0 = time.perf_counter()
+        func(*args)
+        times.append(time.perf_counter() - t0)
+    return times
+
+
+def run_benchmarks(size: int, base: Path | None, depths: tuple[int, ...],
+                   fast: bool = False) -> tuple[dict, dict]:
+    data_root = base if base is not None else ensure_tmpfs()
+    repeats = REPEATS_FAST if fast else REPEATS
+    label = size_label(size)
+
+    print(f"\n{'='*60}")
+    print(f"  identical_{label} in {data_root}")
+    print(f"{'='*60}")
+
+    data_dir = data_root / "io_uring"
+    file_a, file_b = create_test_files(data_dir, size, "identical")
+    a, b = str(file_a), str(file_b)
+    outcome = io_uring_outcome(a, b)
+    print(f"  io_uring: {outcome}")
+
+    funcs = [("mmap", bench_mmap), ("buffered", bench_buffered)]
+    funcs += [(f"io_uring_depth_{d}", make_io_uring(d)) for d in depths]
+
+    results: dict[str, dict] = {f"warm_{label}": {}, f"cold_{label}": {}}
+    try:
+        warm_page_cache(file_a, file_b)
+        for name, func in funcs:
+            print(f"  warm {name}...", end=" ", flush=True)
+            stats = compute_stats(time_func(func, (a, b), repeats=repeats, warmups=1))
+            results[f"warm_{label}"][name] = stats
+            print(f"{format_time(stats['median'])} (median)", flush=True)
+        for name, func in funcs:
+            print(f"  cold {name}...", end=" ", flush=True)
+            stats = compute_stats(time_cold(func, (a, b), repeats))
+            results[f"cold_{label}"][name] = stats
+            print(f"{format_time(stats['median'])} (median)", flush=True)
+    finally:
+        shutil.rmtree(data_dir, ignore_errors=True)
+
+    return results, outcome
+
+
+def main():
+    parser = argparse.ArgumentParser(description="io_uring read path benchmarks")
+    parser.add_argument("--size", choices=SIZES, default=None, help="File size (default: 4GB, 1GB with --fast)")
+    parser.add_argument("--dir", type=Path, default=None, help="Directory for test data (default: tmpfs)")
+    parser.add_argument("--depths", type=int, nargs="+", default=DEPTHS, help="io_uring queue depths to run")
+    parser.add_argument("--fast", action="store_true", help="Quick run")
+    args = parser.parse_args()
+
+    size = SIZES[args.size or ("1GB" if args.fast else "4GB")]
+
+    try:
+        results, outcome = run_benchmarks(size, args.dir, tuple(args.depths), fast=args.fast)
+        table = print_results_table(results)
+
+        clean = {
+            "outcome": outcome,
+            "results": {
+                bench_name: {
+                    name: {k: v for k, v in data.items() if k != "raw"}
+                    for name, data in tools.items()
+                }
+                for bench_name, tools in results.items()
+            },
+        }
+        with open(RESULTS_DIR / "io_uring_results.json", "w") as f:
+            json.dump(clean, f, indent=2)
+
+        with open(RESULTS_DIR / "io_uring_results.md", "w") as f:
+            f.write("# io_uring Benchmarks\n\n")
+            f.write(
+                f"io path: `{outcome['io_a']}` / `{outcome['io_b']}`"
+                f" (fallback: `{outcome['fallback']}`)\n"
+            )
+            f.write(table)
+
+        print(f"\nResults saved to {RESULTS_DIR}/io_uring_results.json")
+    finally:
+        cleanup_tmpfs()
+
+
+if __name__ == "__main__":
+    main()
@@ -72,9 +72,12 @@ struct komparu_async_task {
     bool verify_ssl;
     bool allow_private;
     char *proxy;             /* Owned copy, or NULL */
+    komparu_transform_t transform_a;
+    komparu_transform_t transform_b;
 
     /* Dir-specific */
     bool follow_symlinks;
+    bool special_files;
     size_t max_workers;
 
     /* Archive-specific */
@@ -94,6 +97,7 @@ struct komparu_async_task {
     komparu_dir_result_t *dir_result;
     char error_buf[512];
     bool has_error;
+    bool decode_error;
 
     /* Lifecycle state (CAS-only transitions, see komparu_task_state_t) */
     _Atomic int state;
@@ -300,7 +304,10 @@ static void compare_worker(void *arg) {
 
     /* Same-file short-circuit via inode comparison */
 #ifndef KOMPARU_WINDOWS
-    if (!is_url(task->source_a) && !is_url(task->source_b)) {
+    if (!is_url(task->source_a) && !is_url(task->source_b) &&
+        !task->transform_a.decompress && !task->transform_a.collapse_zeros &&
+        task->transform_a.decode == KOMPARU_DECODE_NONE &&
+        task->transform_b.decode == KOMPARU_DECODE_NONE) {
         struct stat st_a, st_b;
         if (stat(task->source_a, &st_a) == 0 &&
             stat(task->source_b, &st_b) == 0 &&
@@ -356,6 +363,19 @@ static void compare_worker(void *arg) {
         return;
     }
 
+    /* Header/footer skip and decoding, layered over the raw readers */
+    if (KOMPARU_UNLIKELY(
+            komparu_reader_apply_transform(&ra, &task->transform_a, &err) != 0 ||
+            komparu_reader_apply_transform(&rb, &task->transform_b, &err) != 0)) {
+        ra->close(ra);
+        rb->close(rb);
+        snprintf(task->error_buf, sizeof(task->error_buf),
+                 "comparison error: %s", err ? err : "unknown");
+        task->has_error = true;
+        worker_finish(task);
+        return;
+    }
+
     /* Quick check */
     if (task->quick_check) {
         komparu_result_t qr = komparu_quick_check(
@@ -378,8 +398,17 @@ static void compare_worker(void *arg) {
         ra, rb, task->chunk_size, task->size_precheck, &err);
 
     if (task->cmp_result == KOMPARU_ERROR) {
-        snprintf(task->error_buf, sizeof(task->error_buf),
-                 "comparison error: %s", err ? err : "unknown");
+        const char *dec_a = komparu_reader_decode_error(ra);
+        const char *dec_b = komparu_reader_decode_error(rb);
+        if (dec_a || dec_b) {
+            snprintf(task->error_buf, sizeof(task->error_buf), "%s: %s",
+                     dec_a ? task->source_a : task->source_b,
+                     dec_a ? dec_a : dec_b);
+            task->decode_error = true;
+        } else {
+            snprintf(task->error_buf, sizeof(task->error_buf),
+                     "comparison error: %s", err ? err : "unknown");
+        }
         task->has_error = true;
     }
 
@@ -399,8 +428,9 @@ static void compare_dir_worker(void *arg) {
     task->dir_result = komparu_compare_dirs(
         task->source_a, task->source_b,
         task->chunk_size, task->size_precheck,
-        task->quick_check, task->follow_symlinks,
-        task->max_workers, &err);
+        task->quick_check, task->follow_symlinks, KOMPARU_LINKS_DEFAULT,
+        task->special_files, false, false, false, -1, NULL, task->max_workers, 0, false, false, NULL,
+        &err);
 
     if (!task->dir_result) {
         snprintf(task->error_buf, sizeof(task->error_buf),
@@ -558,6 +588,8 @@ komparu_async_task_t *komparu_async_compare(
     bool verify_ssl,
     bool allow_private,
     const char *proxy,
+    const komparu_transform_t *transform_a,
+    const komparu_transform_t *transform_b,
     const char **err_msg
 ) {
     komparu_pool_t *pool = get_pool();
@@ -604,6 +636,8 @@ komparu_async_task_t *komparu_async_compare(
     task->verify_ssl = verify_ssl;
     task->allow_private = allow_private;
     task->proxy = proxy ? strdup(proxy) : NULL;
+    if (transform_a) task->transform_a = *transform_a;
+    if (transform_b) task->transform_b = *transform_b;
 
     if (komparu_pool_submit(pool, compare_worker, task) != 0) {
         *err_msg = "async pool queue full";
@@ -622,6 +656,7 @@ komparu_async_task_t *komparu_async_compare_dir(
     bool size_precheck,
     bool quick_check,
     bool follow_symlinks,
+    bool special_files,
     size_t max_workers,
     const char **err_msg
 ) {
@@ -639,6 +674,7 @@ komparu_async_task_t *komparu_async_compare_dir(
     task->size_precheck = size_precheck;
     task->quick_check = quick_check;
     task->follow_symlinks = follow_symlinks;
+    task->special_files = special_files;
     task->max_workers = max_workers;
 
     if (komparu_pool_submit(pool, compare_dir_worker, task) != 0) {
@@ -798,7 +834,7 @@ int komparu_async_task_cmp_result(
     (void)atomic_load_explicit(&task->state, memory_order_acquire);
     if (task->has_error) {
         *err_msg = task->error_buf;
-        return -1;
+        return task->decode_error ? KOMPARU_ASYNC_DECODE_ERROR : -1;
     }
     *out = (task->cmp_result == KOMPARU_EQUAL);
     return 0;
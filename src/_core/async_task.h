@@ -25,6 +25,7 @@ typedef struct komparu_async_task komparu_async_task_t;
  * then reads the result with task_cmp_result().
  *
  * headers: NULL-terminated "Key: Value" array (copied), or NULL.
+ * transform_a/transform_b: per-source content transforms (copied), or NULL.
  * Returns NULL on error (pool full, OOM).
  */
 komparu_async_task_t *komparu_async_compare(
@@ -39,6 +40,8 @@ komparu_async_task_t *komparu_async_compare(
     bool verify_ssl,
     bool allow_private,
     const char *proxy,
+    const komparu_transform_t *transform_a,
+    const komparu_transform_t *transform_b,
     const char **err_msg
 );
 
@@ -55,6 +58,7 @@ komparu_async_task_t *komparu_async_compare_dir(
     bool size_precheck,
     bool quick_check,
     bool follow_symlinks,
+    bool special_files,
     size_t max_workers,
     const char **err_msg
 );
@@ -62,9 +66,13 @@ komparu_async_task_t *komparu_async_compare_dir(
 /** Get the read fd for asyncio.loop.add_reader(). */
 int komparu_async_task_fd(komparu_async_task_t *task);
 
+/** Returned by komparu_async_task_cmp_result() for invalid encoded input. */
+#define KOMPARU_ASYNC_DECODE_ERROR (-2)
+
 /**
  * Get comparison result. Call only after fd is readable.
- * Returns 0 on success (*out set), -1 on error (*err_msg set).
+ * Returns 0 on success (*out set), -1 on error (*err_msg set),
+ * or KOMPARU_ASYNC_DECODE_ERROR if a decoded source was malformed.
  */
 int komparu_async_task_cmp_result(
     komparu_async_task_t *task,
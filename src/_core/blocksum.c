@@ -0,0 +1,107 @@
+/**
+ * blocksum.c — Per-block weak/strong checksums (delta-sync signature).
+ */
+
+#include "blocksum.h"
+#include <stdlib.h>
+#include <string.h>
+
+uint32_t komparu_weak_checksum(const uint8_t *data, size_t len) {
+    uint32_t a = 0, b = 0;
+    for (size_t i = 0; i < len; i++) {
+        a += data[i];
+        b += (uint32_t)(len - i) * data[i];
+    }
+    return (a & 0xffff) | ((b & 0xffff) << 16);
+}
+
+/* Read until buf is full or EOF. Returns bytes read, -1 on error. */
+static int64_t read_block(komparu_reader_t *reader, uint8_t *buf, size_t size) {
+    size_t got = 0;
+    while (got < size) {
+        int64_t n = reader->read(reader, buf + got, size - got);
+        if (KOMPARU_UNLIKELY(n < 0)) return -1;
+        if (n == 0) break;
+        got += (size_t)n;
+    }
+    return (int64_t)got;
+}
+
+static int block_list_push(komparu_block_list_t *list, const komparu_block_sum_t *item) {
+    if (list->count == list->capacity) {
+        size_t cap = list->capacity ? list->capacity * 2 : 64;
+        komparu_block_sum_t *items = realloc(list->items, cap * sizeof(*items));
+        if (KOMPARU_UNLIKELY(!items)) return -1;
+        list->items = items;
+        list->capacity = cap;
+    }
+    list->items[list->count++] = *item;
+    return 0;
+}
+
+int komparu_block_checksums(
+    komparu_reader_t *reader,
+    size_t block_size,
+    komparu_block_list_t *out,
+    const char **err_msg
+) {
+    memset(out, 0, sizeof(*out));
+
+    /* Pre-size the list when the stream length is known */
+    int64_t total = reader->get_size(reader);
+    if (total > 0) {
+        size_t blocks = (size_t)((total + (int64_t)block_size - 1) / (int64_t)block_size);
+        out->items = malloc(blocks * sizeof(*out->items));
+        if (out->items) out->capacity = blocks;
+    }
+
+    uint8_t *buf = malloc(block_size);
+    if (KOMPARU_UNLIKELY(!buf)) {
+        komparu_block_list_free(out);
+        *err_msg = "out of memory";
+        return -1;
+    }
+
+    int64_t offset = 0;
+    for (;;) {
+        int64_t n = read_block(reader, buf, block_size);
+        if (KOMPARU_UNLIKELY(n < 0)) {
+            *err_msg = "read error";
+            goto fail;
+        }
+        if (n == 0) break;
+
+        komparu_block_sum_t item = {
+            .offset = offset,
+            .length = (size_t)n,
+            .weak = komparu_weak_checksum(buf, (size_t)n),
+        };
+        komparu_sha256_t ctx;
+        komparu_sha256_init(&ctx);
+        komparu_sha256_update(&ctx, buf, (size_t)n);
+        komparu_sha256_final(&ctx, item.strong);
+
+        if (KOMPARU_UNLIKELY(block_list_push(out, &item) != 0)) {
+            *err_msg = "out of memory";
+            goto fail;
+        }
+        offset += n;
+        if ((size_t)n < block_size) break;
+    }
+
+    free(buf);
+    return 0;
+
+fail:
+    free(buf);
+    komparu_block_list_free(out);
+    return -1;
+}
+
+void komparu_block_list_free(komparu_block_list_t *list) {
+    if (!list) return;
+    free(list->items);
+    list->items = NULL;
+    list->count = 0;
+    list->capacity = 0;
+}
@@ -0,0 +1,56 @@
+/**
+ * blocksum.h — Per-block weak/strong checksums (delta-sync signature).
+ *
+ * Splits a stream into fixed-size blocks and records, for each block, an
+ * rsync-style rolling checksum and a SHA-256 digest. This is the
+ * "signature" half of a delta-sync protocol: the other side rolls the weak
+ * checksum over its data and confirms candidate matches with the strong one.
+ */
+
+#ifndef KOMPARU_BLOCKSUM_H
+#define KOMPARU_BLOCKSUM_H
+
+#include "compat.h"
+#include "reader.h"
+#include "digest.h"
+
+typedef struct {
+    int64_t offset;                     /* block start in the stream */
+    size_t length;                      /* block_size, shorter for the last block */
+    uint32_t weak;                      /* a | (b << 16), see komparu_weak_checksum */
+    uint8_t strong[KOMPARU_SHA256_LEN]; /* SHA-256 of the block */
+} komparu_block_sum_t;
+
+typedef struct {
+    komparu_block_sum_t *items;
+    size_t count;
+    size_t capacity;
+} komparu_block_list_t;
+
+/**
+ * rsync weak checksum of a block:
+ *   a = sum(x[i]) mod 2^16
+ *   b = sum((len - i) * x[i]) mod 2^16
+ * Returned as a | (b << 16). Rolling by one byte is O(1).
+ */
+uint32_t komparu_weak_checksum(const uint8_t *data, size_t len);
+
+/**
+ * Checksum every block_size bytes of a reader, streaming.
+ *
+ * Memory is one block buffer plus the output list. An empty stream
+ * yields an empty list.
+ *
+ * Returns 0 on success (caller frees with komparu_block_list_free),
+ * -1 on error (*err_msg set, out left empty).
+ */
+int komparu_block_checksums(
+    komparu_reader_t *reader,
+    size_t block_size,
+    komparu_block_list_t *out,
+    const char **err_msg
+);
+
+void komparu_block_list_free(komparu_block_list_t *list);
+
+#endif /* KOMPARU_BLOCKSUM_H */
@@ -11,8 +11,13 @@
  */
 
 #include "compare.h"
+#include "digest.h"
+#include "reader_file.h"
+#include <math.h>
+#include <stdatomic.h>
 #include <stdlib.h>
 #include <string.h>
+#include <time.h>
 
 /* =========================================================================
  * Thread-local comparison buffers — avoid malloc/free per comparison.
@@ -62,6 +67,162 @@ void komparu_compare_tls_cleanup(void) {
     tl_buf_cap = 0;
 }
 
+/* =========================================================================
+ * Cancellation — a token bound per thread, polled once per chunk
+ * ========================================================================= */
+
+static _Thread_local komparu_cancel_t *tl_cancel = NULL;
+
+int64_t komparu_monotonic_ns(void) {
+#ifdef KOMPARU_WINDOWS
+    return (int64_t)GetTickCount64() * 1000000;
+#else
+    struct timespec ts;
+    clock_gettime(CLOCK_MONOTONIC, &ts);
+    return (int64_t)ts.tv_sec * 1000000000 + ts.tv_nsec;
+#endif
+}
+
+int komparu_cancel_state(komparu_cancel_t *cancel) {
+    if (!cancel) return KOMPARU_CANCEL_NONE;
+    if (atomic_load_explicit(&cancel->cancelled, memory_order_relaxed))
+        return KOMPARU_CANCEL_REQUESTED;
+    if (cancel->deadline_ns > 0 && komparu_monotonic_ns() >= cancel->deadline_ns)
+        return KOMPARU_CANCEL_DEADLINE;
+    return KOMPARU_CANCEL_NONE;
+}
+
+komparu_cancel_t *komparu_cancel_bind(komparu_cancel_t *cancel) {
+    komparu_cancel_t *prev = tl_cancel;
+    tl_cancel = cancel;
+    return prev;
+}
+
+komparu_cancel_t *komparu_cancel_bound(void) {
+    return tl_cancel;
+}
+
+int komparu_cancel_poll(const char **err_msg) {
+    if (KOMPARU_LIKELY(!tl_cancel)) return KOMPARU_CANCEL_NONE;
+    int state = komparu_cancel_state(tl_cancel);
+    if (state == KOMPARU_CANCEL_REQUESTED) *err_msg = "cancelled";
+    else if (state == KOMPARU_CANCEL_DEADLINE) *err_msg = "deadline exceeded";
+    return state;
+}
+
+/* =========================================================================
+ * Progress — a byte counter bound per thread, advanced once per chunk
+ * ========================================================================= */
+
+static _Thread_local _Atomic uint64_t *tl_progress = NULL;
+static _Thread_local uint64_t tl_progress_added = 0;
+
+_Atomic uint64_t *komparu_progress_bind(_Atomic uint64_t *bytes) {
+    _Atomic uint64_t *prev = tl_progress;
+    tl_progress = bytes;
+    tl_progress_added = 0;
+    return prev;
+}
+
+uint64_t komparu_progress_added(void) {
+    return tl_progress_added;
+}
+
+static inline void progress_add(int64_t n_a, int64_t n_b) {
+    if (KOMPARU_LIKELY(!tl_progress)) return;
+    uint64_t n = (uint64_t)(n_a > n_b ? n_a : n_b);
+    atomic_fetch_add_explicit(tl_progress, n, memory_order_relaxed);
+    tl_progress_added += n;
+}
+
+/* =========================================================================
+ * Sparse files — holes present in both sources are skipped, not read
+ * ========================================================================= */
+
+static _Atomic bool skip_holes = true;
+
+void komparu_set_skip_holes(bool skip) {
+    atomic_store_explicit(&skip_holes, skip, memory_order_relaxed);
+}
+
+/* Compare [from, to) of two seekable readers chunk by chunk */
+static komparu_result_t compare_range(
+    komparu_reader_t *reader_a,
+    komparu_reader_t *reader_b,
+    int64_t from,
+    int64_t to,
+    size_t chunk_size,
+    void *buf_a,
+    void *buf_b,
+    const char **err_msg
+) {
+    if (reader_a->seek(reader_a, from) != 0 || reader_b->seek(reader_b, from) != 0) {
+        *err_msg = "seek failed during sparse comparison";
+        return KOMPARU_ERROR;
+    }
+    while (from < to) {
+        if (KOMPARU_UNLIKELY(komparu_cancel_poll(err_msg))) return KOMPARU_ERROR;
+        size_t want = to - from < (int64_t)chunk_size ? (size_t)(to - from) : chunk_size;
+        int64_t n_a = reader_a->read(reader_a, buf_a, want);
+        int64_t n_b = reader_b->read(reader_b, buf_b, want);
+        if (n_a < 0) {
+            *err_msg = reader_a->source_name
+                ? reader_a->source_name
+                : "source A read error";
+            return KOMPARU_ERROR;
+        }
+        if (n_b < 0) {
+            *err_msg = reader_b->source_name
+                ? reader_b->source_name
+                : "source B read error";
+            return KOMPARU_ERROR;
+        }
+        progress_add(n_a, n_b);
+        if (n_a != n_b) return KOMPARU_DIFFERENT;
+        if (n_a == 0) break;
+        if (memcmp(buf_a, buf_b, (size_t)n_a) != 0) return KOMPARU_DIFFERENT;
+        from += n_a;
+    }
+    return KOMPARU_EQUAL;
+}
+
+/*
+ * Compare two sparse files of `size` bytes from `pos`. Wherever neither
+ * side has data both read as zeros, so only the stretch from the nearer
+ * data extent start to the nearer extent end is read each step; when
+ * the hole maps align, that is exactly each shared data extent. If a
+ * hole lookup fails, the rest is read in full.
+ */
+static komparu_result_t compare_sparse(
+    komparu_reader_t *reader_a,
+    komparu_reader_t *reader_b,
+    int64_t pos,
+    int64_t size,
+    size_t chunk_size,
+    void *buf_a,
+    void *buf_b,
+    const char **err_msg
+) {
+    while (pos < size) {
+        int64_t data_a, hole_a, data_b, hole_b;
+        if (komparu_reader_file_extent(reader_a, pos, &data_a, &hole_a) != 0 ||
+            komparu_reader_file_extent(reader_b, pos, &data_b, &hole_b) != 0) {
+            return compare_range(reader_a, reader_b, pos, size,
+                                 chunk_size, buf_a, buf_b, err_msg);
+        }
+        int64_t from = data_a < data_b ? data_a : data_b;
+        int64_t to = hole_a < hole_b ? hole_a : hole_b;
+        progress_add(from - pos, from - pos);
+        if (to > from) {
+            komparu_result_t r = compare_range(reader_a, reader_b, from, to,
+                                               chunk_size, buf_a, buf_b, err_msg);
+            if (r != KOMPARU_EQUAL) return r;
+        }
+        pos = to > from ? to : from;
+    }
+    return KOMPARU_EQUAL;
+}
+
 komparu_result_t komparu_compare(
     komparu_reader_t *reader_a,
     komparu_reader_t *reader_b,
@@ -96,10 +257,25 @@ komparu_result_t komparu_compare(
         return KOMPARU_ERROR;
     }
 
+    /* Step 2: Two sparse files of equal size skip the holes they share */
+    if (atomic_load_explicit(&skip_holes, memory_order_relaxed) &&
+        komparu_reader_file_sparse(reader_a) && komparu_reader_file_sparse(reader_b)) {
+        int64_t pos = komparu_reader_file_offset(reader_a);
+        int64_t size = reader_a->get_size(reader_a);
+        if (pos == komparu_reader_file_offset(reader_b) && size == reader_b->get_size(reader_b)) {
+            return compare_sparse(reader_a, reader_b, pos, size,
+                                  chunk_size, buf_a, buf_b, err_msg);
+        }
+    }
+
     komparu_result_t result = KOMPARU_EQUAL;
 
-    /* Step 2: Sequential chunk comparison */
+    /* Step 3: Sequential chunk comparison */
     for (;;) {
+        if (KOMPARU_UNLIKELY(komparu_cancel_poll(err_msg))) {
+            result = KOMPARU_ERROR;
+            break;
+        }
         int64_t n_a = reader_a->read(reader_a, buf_a, chunk_size);
         int64_t n_b = reader_b->read(reader_b, buf_b, chunk_size);
 
@@ -118,6 +294,7 @@ komparu_result_t komparu_compare(
             result = KOMPARU_ERROR;
             break;
         }
+        progress_add(n_a, n_b);
 
         /* Different read lengths → different content */
         if (n_a != n_b) {
@@ -141,6 +318,472 @@ komparu_result_t komparu_compare(
     return result;
 }
 
+/* Index of the first differing byte; buffers are known to differ */
+static size_t first_mismatch(const uint8_t *a, const uint8_t *b, size_t n) {
+    size_t i = 0;
+    while (i + 8 <= n) {
+        uint64_t wa, wb;
+        memcpy(&wa, a + i, 8);
+        memcpy(&wb, b + i, 8);
+        if (wa != wb) break;
+        i += 8;
+    }
+    while (i < n && a[i] == b[i]) i++;
+    return i;
+}
+
+komparu_result_t komparu_compare_detailed(
+    komparu_reader_t *reader_a,
+    komparu_reader_t *reader_b,
+    size_t chunk_size,
+    bool size_precheck,
+    komparu_compare_info_t *info,
+    const char **err_msg
+) {
+    if (chunk_size == 0) {
+        chunk_size = KOMPARU_DEFAULT_CHUNK_SIZE;
+    }
+
+    info->reason = -1;
+    info->first_diff = -1;
+    info->size_a = reader_a->get_size(reader_a);
+    info->size_b = reader_b->get_size(reader_b);
+
+    if (size_precheck && info->size_a >= 0 && info->size_b >= 0 &&
+        info->size_a != info->size_b) {
+        info->reason = KOMPARU_DIFF_SIZE;
+        return KOMPARU_DIFFERENT;
+    }
+
+    void *buf_a, *buf_b;
+    if (ensure_buffers(chunk_size, &buf_a, &buf_b) != 0) {
+        *err_msg = "out of memory";
+        return KOMPARU_ERROR;
+    }
+
+    int64_t pos = 0;
+    for (;;) {
+        if (KOMPARU_UNLIKELY(komparu_cancel_poll(err_msg))) return KOMPARU_ERROR;
+        int64_t n_a = reader_a->read(reader_a, buf_a, chunk_size);
+        int64_t n_b = reader_b->read(reader_b, buf_b, chunk_size);
+
+        if (n_a < 0) {
+            *err_msg = reader_a->source_name
+                ? reader_a->source_name
+                : "source A read error";
+            return KOMPARU_ERROR;
+        }
+        if (n_b < 0) {
+            *err_msg = reader_b->source_name
+                ? reader_b->source_name
+                : "source B read error";
+            return KOMPARU_ERROR;
+        }
+        progress_add(n_a, n_b);
+
+        size_t common = (size_t)(n_a < n_b ? n_a : n_b);
+        if (common > 0 && memcmp(buf_a, buf_b, common) != 0) {
+            info->reason = KOMPARU_DIFF_CONTENT;
+            info->first_diff = pos + (int64_t)first_mismatch(buf_a, buf_b, common);
+            return KOMPARU_DIFFERENT;
+        }
+
+        /* Readers fill until EOF, so a short side has ended */
+        if (n_a != n_b) {
+            info->reason = KOMPARU_DIFF_SIZE;
+            info->first_diff = pos + (int64_t)common;
+            if (n_a < n_b && info->size_a < 0) info->size_a = pos + n_a;
+            if (n_b < n_a && info->size_b < 0) info->size_b = pos + n_b;
+            return KOMPARU_DIFFERENT;
+        }
+
+        if (n_a == 0) {
+            if (info->size_a < 0) info->size_a = pos;
+            if (info->size_b < 0) info->size_b = pos;
+            return KOMPARU_EQUAL;
+        }
+
+        pos += n_a;
+    }
+}
+
+/* =========================================================================
+ * Differing byte count
+ * ========================================================================= */
+
+/* Number of positions where a and b differ, a word at a time */
+static uint64_t count_mismatch(const uint8_t *a, const uint8_t *b, size_t n) {
+    uint64_t count = 0;
+    size_t i = 0;
+    while (i + 8 <= n) {
+        uint64_t wa, wb;
+        memcpy(&wa, a + i, 8);
+        memcpy(&wb, b + i, 8);
+        uint64_t x = wa ^ wb;
+        if (x) {
+            /* Fold each byte onto its low bit, then sum the low bits */
+            x |= x >> 4;
+            x |= x >> 2;
+            x |= x >> 1;
+            x &= 0x0101010101010101ULL;
+            count += (x * 0x0101010101010101ULL) >> 56;
+        }
+        i += 8;
+    }
+    for (; i < n; i++) count += a[i] != b[i];
+    return count;
+}
+
+komparu_result_t komparu_count_diff(
+    komparu_reader_t *reader_a,
+    komparu_reader_t *reader_b,
+    size_t chunk_size,
+    int64_t *differing,
+    int64_t *total,
+    const char **err_msg
+) {
+    if (chunk_size == 0) chunk_size = KOMPARU_DEFAULT_CHUNK_SIZE;
+    *differing = 0;
+    *total = 0;
+
+    void *buf_a, *buf_b;
+    if (ensure_buffers(chunk_size, &buf_a, &buf_b) != 0) {
+        *err_msg = "out of memory";
+        return KOMPARU_ERROR;
+    }
+
+    komparu_reader_t *longer = NULL;
+    for (;;) {
+        if (KOMPARU_UNLIKELY(komparu_cancel_poll(err_msg))) return KOMPARU_ERROR;
+        int64_t n_a = reader_a->read(reader_a, buf_a, chunk_size);
+        int64_t n_b = reader_b->read(reader_b, buf_b, chunk_size);
+
+        if (n_a < 0) {
+            *err_msg = reader_a->source_name
+                ? reader_a->source_name
+                : "source A read error";
+            return KOMPARU_ERROR;
+        }
+        if (n_b < 0) {
+            *err_msg = reader_b->source_name
+                ? reader_b->source_name
+                : "source B read error";
+            return KOMPARU_ERROR;
+        }
+
+        size_t common = (size_t)(n_a < n_b ? n_a : n_b);
+        if (common > 0 && memcmp(buf_a, buf_b, common) != 0) {
+            *differing += (int64_t)count_mismatch(buf_a, buf_b, common);
+        }
+
+        int64_t longest = n_a > n_b ? n_a : n_b;
+        *differing += longest - (int64_t)common;
+        *total += longest;
+
+        /* Readers fill until EOF, so a short side has ended */
+        if (n_a != n_b) {
+            longer = n_a > n_b ? reader_a : reader_b;
+            break;
+        }
+        if (n_a == 0) break;
+    }
+
+    /* Every remaining byte of the longer source differs */
+    while (longer) {
+        if (KOMPARU_UNLIKELY(komparu_cancel_poll(err_msg))) return KOMPARU_ERROR;
+        int64_t n = longer->read(longer, buf_a, chunk_size);
+        if (n < 0) {
+            *err_msg = longer->source_name
+                ? longer->source_name
+                : "read error";
+            return KOMPARU_ERROR;
+        }
+        if (n == 0) break;
+        *differing += n;
+        *total += n;
+    }
+
+    return *differing == 0 ? KOMPARU_EQUAL : KOMPARU_DIFFERENT;
+}
+
+/*
+ * Add the differing positions of a[0..n) vs b[0..n), at source offset
+ * `base`, to *s. *in_run carries whether the byte before a[0] differed,
+ * so a run split across chunks counts once. Equal 8-byte words outside
+ * a run are skipped whole.
+ */
+static void count_runs(const uint8_t *a, const uint8_t *b, size_t n,
+                       int64_t base, bool *in_run, komparu_diff_stats_t *s) {
+    size_t i = 0;
+    while (i < n) {
+        if (!*in_run) {
+            while (i + 8 <= n) {
+                uint64_t wa, wb;
+                memcpy(&wa, a + i, 8);
+                memcpy(&wb, b + i, 8);
+                if (wa != wb) break;
+                i += 8;
+            }
+            if (i >= n) break;
+        }
+        bool differs = a[i] != b[i];
+        if (differs) {
+            if (!*in_run) {
+                s->ranges++;
+                if (s->first_diff < 0) s->first_diff = base + (int64_t)i;
+            }
+            s->differing++;
+        }
+        *in_run = differs;
+        i++;
+    }
+}
+
+komparu_result_t komparu_diff_stats(
+    komparu_reader_t *reader_a,
+    komparu_reader_t *reader_b,
+    size_t chunk_size,
+    komparu_diff_stats_t *stats,
+    const char **err_msg
+) {
+    if (chunk_size == 0) chunk_size = KOMPARU_DEFAULT_CHUNK_SIZE;
+    *stats = (komparu_diff_stats_t){.first_diff = -1};
+
+    void *buf_a, *buf_b;
+    if (ensure_buffers(chunk_size, &buf_a, &buf_b) != 0) {
+        *err_msg = "out of memory";
+        return KOMPARU_ERROR;
+    }
+
+    bool in_run = false;
+    komparu_reader_t *longer = NULL;
+    for (;;) {
+        if (KOMPARU_UNLIKELY(komparu_cancel_poll(err_msg))) return KOMPARU_ERROR;
+        int64_t n_a = reader_a->read(reader_a, buf_a, chunk_size);
+        int64_t n_b = reader_b->read(reader_b, buf_b, chunk_size);
+
+        if (n_a < 0) {
+            *err_msg = reader_a->source_name
+                ? reader_a->source_name
+                : "source A read error";
+            return KOMPARU_ERROR;
+        }
+        if (n_b < 0) {
+            *err_msg = reader_b->source_name
+                ? reader_b->source_name
+                : "source B read error";
+            return KOMPARU_ERROR;
+        }
+
+        size_t common = (size_t)(n_a < n_b ? n_a : n_b);
+        if (common > 0 && memcmp(buf_a, buf_b, common) != 0) {
+            count_runs(buf_a, buf_b, common, stats->size_a, &in_run, stats);
+        } else if (common > 0) {
+            in_run = false;
+        }
+        stats->size_a += n_a;
+        stats->size_b += n_b;
+
+        /* Readers fill until EOF, so a short side has ended */
+        if (n_a != n_b) {
+            longer = n_a > n_b ? reader_a : reader_b;
+            int64_t tail = (n_a > n_b ? n_a : n_b) - (int64_t)common;
+            if (!in_run) {
+                stats->ranges++;
+                if (stats->first_diff < 0)
+                    stats->first_diff = (n_a < n_b ? stats->size_a : stats->size_b);
+            }
+            stats->differing += tail;
+            break;
+        }
+        if (n_a == 0) break;
+    }
+
+    /* Every remaining byte of the longer source extends the final run */
+    while (longer) {
+        if (KOMPARU_UNLIKELY(komparu_cancel_poll(err_msg))) return KOMPARU_ERROR;
+        int64_t n = longer->read(longer, buf_a, chunk_size);
+        if (n < 0) {
+            *err_msg = longer->source_name
+                ? longer->source_name
+                : "read error";
+            return KOMPARU_ERROR;
+        }
+        if (n == 0) break;
+        stats->differing += n;
+        if (longer == reader_a) stats->size_a += n;
+        else stats->size_b += n;
+    }
+
+    return stats->differing == 0 ? KOMPARU_EQUAL : KOMPARU_DIFFERENT;
+}
+
+komparu_result_t komparu_compare_hash(
+    komparu_reader_t *reader_a,
+    komparu_reader_t *reader_b,
+    size_t chunk_size,
+    uint8_t *digest_a,
+    uint8_t *digest_b,
+    const char **err_msg
+) {
+    if (chunk_size == 0) chunk_size = KOMPARU_DEFAULT_CHUNK_SIZE;
+
+    void *buf_a, *buf_b;
+    if (ensure_buffers(chunk_size, &buf_a, &buf_b) != 0) {
+        *err_msg = "out of memory";
+        return KOMPARU_ERROR;
+    }
+
+    komparu_sha256_t ctx_a, ctx_b;
+    komparu_sha256_init(&ctx_a);
+    komparu_sha256_init(&ctx_b);
+    bool equal = true;
+    bool eof_a = false, eof_b = false;
+
+    while (!eof_a || !eof_b) {
+        if (KOMPARU_UNLIKELY(komparu_cancel_poll(err_msg))) return KOMPARU_ERROR;
+        int64_t n_a = eof_a ? 0 : reader_a->read(reader_a, buf_a, chunk_size);
+        int64_t n_b = eof_b ? 0 : reader_b->read(reader_b, buf_b, chunk_size);
+
+        if (n_a < 0) {
+            *err_msg = reader_a->source_name
+                ? reader_a->source_name
+                : "source A read error";
+            return KOMPARU_ERROR;
+        }
+        if (n_b < 0) {
+            *err_msg = reader_b->source_name
+                ? reader_b->source_name
+                : "source B read error";
+            return KOMPARU_ERROR;
+        }
+
+        komparu_sha256_update(&ctx_a, buf_a, (size_t)n_a);
+        komparu_sha256_update(&ctx_b, buf_b, (size_t)n_b);
+
+        /* Readers fill until EOF, so chunks stay aligned while equal */
+        if (equal && (n_a != n_b || memcmp(buf_a, buf_b, (size_t)n_a) != 0)) {
+            equal = false;
+        }
+        if (n_a < (int64_t)chunk_size) eof_a = true;
+        if (n_b < (int64_t)chunk_size) eof_b = true;
+    }
+
+    komparu_sha256_final(&ctx_a, digest_a);
+    komparu_sha256_final(&ctx_b, digest_b);
+    return equal ? KOMPARU_EQUAL : KOMPARU_DIFFERENT;
+}
+
+/* =========================================================================
+ * Numeric comparison — arrays of float32/float64 with tolerance
+ * ========================================================================= */
+
+int komparu_num_type_parse(const char *name, komparu_num_type_t *out) {
+    if (!name || strcmp(name, "float64") == 0) {
+        *out = KOMPARU_NUM_FLOAT64;
+    } else if (strcmp(name, "float32") == 0) {
+        *out = KOMPARU_NUM_FLOAT32;
+    } else {
+        return -1;
+    }
+    return 0;
+}
+
+size_t komparu_num_type_size(komparu_num_type_t type) {
+    return type == KOMPARU_NUM_FLOAT32 ? sizeof(float) : sizeof(double);
+}
+
+static bool num_close(double a, double b, const komparu_num_opts_t *o) {
+    if (a == b) return true;  /* also equal infinities and +0/-0 */
+    if (isnan(a) || isnan(b)) return o->nan_equal && isnan(a) && isnan(b);
+    if (isinf(a) || isinf(b)) return false;
+
+    double fa = fabs(a), fb = fabs(b);
+    double tol = o->rel_tol * (fa > fb ? fa : fb);
+    if (tol < o->abs_tol) tol = o->abs_tol;
+    return fabs(a - b) <= tol;
+}
+
+/* Index of the first element outside tolerance, or n if all are close */
+static size_t num_first_mismatch(
+    const uint8_t *a, const uint8_t *b, size_t n, const komparu_num_opts_t *o
+) {
+    for (size_t i = 0; i < n; i++) {
+        double va, vb;
+        if (o->type == KOMPARU_NUM_FLOAT32) {
+            float fa, fb;
+            memcpy(&fa, a + i * sizeof(float), sizeof(float));
+            memcpy(&fb, b + i * sizeof(float), sizeof(float));
+            va = fa;
+            vb = fb;
+        } else {
+            memcpy(&va, a + i * sizeof(double), sizeof(double));
+            memcpy(&vb, b + i * sizeof(double), sizeof(double));
+        }
+        if (!num_close(va, vb, o)) return i;
+    }
+    return n;
+}
+
+komparu_result_t komparu_compare_numeric(
+    komparu_reader_t *reader_a,
+    komparu_reader_t *reader_b,
+    size_t chunk_size,
+    const komparu_num_opts_t *opts,
+    const char **err_msg
+) {
+    size_t esize = komparu_num_type_size(opts->type);
+    if (chunk_size == 0) chunk_size = KOMPARU_DEFAULT_CHUNK_SIZE;
+    /* Whole elements per chunk, so none straddles a read boundary */
+    chunk_size -= chunk_size % esize;
+    if (chunk_size == 0) chunk_size = esize;
+
+    int64_t size_a = reader_a->get_size(reader_a);
+    int64_t size_b = reader_b->get_size(reader_b);
+    if (size_a >= 0 && size_b >= 0 && size_a != size_b) {
+        return KOMPARU_DIFFERENT;
+    }
+
+    void *buf_a, *buf_b;
+    if (ensure_buffers(chunk_size, &buf_a, &buf_b) != 0) {
+        *err_msg = "out of memory";
+        return KOMPARU_ERROR;
+    }
+
+    for (;;) {
+        if (KOMPARU_UNLIKELY(komparu_cancel_poll(err_msg))) return KOMPARU_ERROR;
+        int64_t n_a = reader_a->read(reader_a, buf_a, chunk_size);
+        int64_t n_b = reader_b->read(reader_b, buf_b, chunk_size);
+
+        if (n_a < 0) {
+            *err_msg = reader_a->source_name
+                ? reader_a->source_name
+                : "source A read error";
+            return KOMPARU_ERROR;
+        }
+        if (n_b < 0) {
+            *err_msg = reader_b->source_name
+                ? reader_b->source_name
+                : "source B read error";
+            return KOMPARU_ERROR;
+        }
+        if (n_a != n_b) return KOMPARU_DIFFERENT;
+        if (n_a == 0) return KOMPARU_EQUAL;
+        if ((size_t)n_a % esize != 0) {
+            *err_msg = "source length is not a multiple of the element size";
+            return KOMPARU_ERROR;
+        }
+
+        size_t count = (size_t)n_a / esize;
+        /* Identical bytes may still hold NaNs that must compare unequal */
+        if (opts->nan_equal && memcmp(buf_a, buf_b, (size_t)n_a) == 0)
+            continue;
+        if (num_first_mismatch(buf_a, buf_b, count, opts) < count) {
+            return KOMPARU_DIFFERENT;
+        }
+    }
+}
+
 komparu_result_t komparu_quick_check(
     komparu_reader_t *reader_a,
     komparu_reader_t *reader_b,
@@ -249,22 +892,32 @@ komparu_dir_result_t *komparu_dir_result_new(void) {
 
 void komparu_dir_result_free(komparu_dir_result_t *r) {
     if (!r) return;
-    for (size_t i = 0; i < r->diff_count; i++)
-        free(r->diffs[i].path);
+    if (!r->counts_only) {
+        for (size_t i = 0; i < r->diff_count; i++)
+            free(r->diffs[i].path);
+        for (size_t i = 0; i < r->only_left_count; i++)
+            free(r->only_left[i]);
+        for (size_t i = 0; i < r->only_right_count; i++)
+            free(r->only_right[i]);
+        for (size_t i = 0; i < r->error_count; i++)
+            free(r->errors[i]);
+        for (size_t i = 0; i < r->same_count; i++)
+            free(r->same[i]);
+    }
     free(r->diffs);
-    for (size_t i = 0; i < r->only_left_count; i++)
-        free(r->only_left[i]);
     free(r->only_left);
-    for (size_t i = 0; i < r->only_right_count; i++)
-        free(r->only_right[i]);
     free(r->only_right);
-    for (size_t i = 0; i < r->error_count; i++)
-        free(r->errors[i]);
     free(r->errors);
+    free(r->same);
     free(r);
 }
 
 int komparu_dir_result_add_diff(komparu_dir_result_t *r, const char *path, int reason) {
+    if (r->counts_only) {
+        r->diff_count++;
+        r->equal = false;
+        return 0;
+    }
     if (r->diff_count >= r->diff_cap) {
         size_t new_cap = r->diff_cap ? r->diff_cap * 2 : 64;
         komparu_diff_entry_t *tmp = realloc(r->diffs, new_cap * sizeof(*tmp));
@@ -281,6 +934,11 @@ int komparu_dir_result_add_diff(komparu_dir_result_t *r, const char *path, int r
 }
 
 int komparu_dir_result_add_only_left(komparu_dir_result_t *r, const char *path) {
+    if (r->counts_only) {
+        r->only_left_count++;
+        r->equal = false;
+        return 0;
+    }
     if (r->only_left_count >= r->only_left_cap) {
         size_t new_cap = r->only_left_cap ? r->only_left_cap * 2 : 64;
         char **tmp = realloc(r->only_left, new_cap * sizeof(char *));
@@ -296,6 +954,11 @@ int komparu_dir_result_add_only_left(komparu_dir_result_t *r, const char *path)
 }
 
 int komparu_dir_result_add_only_right(komparu_dir_result_t *r, const char *path) {
+    if (r->counts_only) {
+        r->only_right_count++;
+        r->equal = false;
+        return 0;
+    }
     if (r->only_right_count >= r->only_right_cap) {
         size_t new_cap = r->only_right_cap ? r->only_right_cap * 2 : 64;
         char **tmp = realloc(r->only_right, new_cap * sizeof(char *));
@@ -311,6 +974,10 @@ int komparu_dir_result_add_only_right(komparu_dir_result_t *r, const char *path)
 }
 
 int komparu_dir_result_add_error(komparu_dir_result_t *r, const char *path) {
+    if (r->counts_only) {
+        r->error_count++;
+        return 0;
+    }
     if (r->error_count >= r->error_cap) {
         size_t new_cap = r->error_cap ? r->error_cap * 2 : 64;
         char **tmp = realloc(r->errors, new_cap * sizeof(char *));
@@ -323,3 +990,18 @@ int komparu_dir_result_add_error(komparu_dir_result_t *r, const char *path) {
     r->error_count++;
     return 0;
 }
+
+int komparu_dir_result_add_same(komparu_dir_result_t *r, const char *path) {
+    if (r->counts_only || !r->list_equal) return 0;
+    if (r->same_count >= r->same_cap) {
+        size_t new_cap = r->same_cap ? r->same_cap * 2 : 64;
+        char **tmp = realloc(r->same, new_cap * sizeof(char *));
+        if (!tmp) return -1;
+        r->same = tmp;
+        r->same_cap = new_cap;
+    }
+    r->same[r->same_count] = strdup(path);
+    if (!r->same[r->same_count]) return -1;
+    r->same_count++;
+    return 0;
+}
@@ -35,6 +35,98 @@ komparu_result_t komparu_compare(
     const char **err_msg
 );
 
+/**
+ * Detailed comparison outcome, filled by komparu_compare_detailed().
+ * Every field is written on each call; those that do not apply are
+ * reset (first_diff = -1 when equal or decided by size precheck,
+ * sizes = -1 when unknown).
+ */
+typedef struct {
+    int reason;          /* -1 = equal, else KOMPARU_DIFF_CONTENT / _SIZE */
+    int64_t first_diff;  /* offset of the first differing byte, or -1 */
+    int64_t size_a;      /* size of source A, or -1 if unknown */
+    int64_t size_b;      /* size of source B, or -1 if unknown */
+} komparu_compare_info_t;
+
+/**
+ * Like komparu_compare, but also reports where and why sources differ.
+ *
+ * Scans sequentially from the current position, so first_diff is exact.
+ * When one source is a strict prefix of the other, reason is
+ * KOMPARU_DIFF_SIZE and first_diff is the length of the shorter one.
+ */
+komparu_result_t komparu_compare_detailed(
+    komparu_reader_t *reader_a,
+    komparu_reader_t *reader_b,
+    size_t chunk_size,
+    bool size_precheck,
+    komparu_compare_info_t *info,
+    const char **err_msg
+);
+
+/**
+ * Count differing byte positions over the full length of both readers.
+ *
+ * Never short-circuits. Positions past the end of the shorter source
+ * count as differing. *differing receives the count and *total the
+ * length of the longer source.
+ *
+ * Returns KOMPARU_EQUAL when nothing differs, KOMPARU_DIFFERENT, or
+ * KOMPARU_ERROR with *err_msg set.
+ */
+komparu_result_t komparu_count_diff(
+    komparu_reader_t *reader_a,
+    komparu_reader_t *reader_b,
+    size_t chunk_size,
+    int64_t *differing,
+    int64_t *total,
+    const char **err_msg
+);
+
+/** Full-scan difference statistics, filled by komparu_diff_stats(). */
+typedef struct {
+    int64_t differing;   /* differing byte positions */
+    int64_t ranges;      /* maximal runs of consecutive differing positions */
+    int64_t first_diff;  /* offset of the first differing byte, or -1 */
+    int64_t size_a;      /* bytes read from source A */
+    int64_t size_b;      /* bytes read from source B */
+} komparu_diff_stats_t;
+
+/**
+ * Like komparu_count_diff(), but also count the runs of differing
+ * positions and record the first one. Positions past the end of the
+ * shorter source start (or extend) one final run.
+ *
+ * Returns KOMPARU_EQUAL when nothing differs, KOMPARU_DIFFERENT, or
+ * KOMPARU_ERROR with *err_msg set.
+ */
+komparu_result_t komparu_diff_stats(
+    komparu_reader_t *reader_a,
+    komparu_reader_t *reader_b,
+    size_t chunk_size,
+    komparu_diff_stats_t *stats,
+    const char **err_msg
+);
+
+/**
+ * Compare two readers and SHA-256 both in the same pass.
+ *
+ * Never short-circuits: after a difference, both sources are still read
+ * to the end so each digest covers the whole source. Every byte is read
+ * once. digest_a and digest_b receive KOMPARU_SHA256_LEN bytes.
+ *
+ * Returns KOMPARU_EQUAL, KOMPARU_DIFFERENT, or KOMPARU_ERROR with
+ * *err_msg set.
+ */
+komparu_result_t komparu_compare_hash(
+    komparu_reader_t *reader_a,
+    komparu_reader_t *reader_b,
+    size_t chunk_size,
+    uint8_t *digest_a,
+    uint8_t *digest_b,
+    const char **err_msg
+);
+
 /**
  * Quick check: sample up to 5 offsets (start, end, 25%, 50%, 75%) before full scan.
  * Only works if both readers support seek.
@@ -51,6 +143,51 @@ komparu_result_t komparu_quick_check(
     const char **err_msg
 );
 
+/** Element types understood by komparu_compare_numeric(). */
+typedef enum {
+    KOMPARU_NUM_FLOAT32 = 0,
+    KOMPARU_NUM_FLOAT64 = 1,
+} komparu_num_type_t;
+
+/**
+ * Element-wise tolerance. Two values are equal if they compare ==, or
+ * |a - b| <= max(rel_tol * max(|a|, |b|), abs_tol). Infinities must match
+ * exactly. NaN equals NaN only when nan_equal is set.
+ */
+typedef struct {
+    komparu_num_type_t type;
+    double abs_tol;
+    double rel_tol;
+    bool nan_equal;
+} komparu_num_opts_t;
+
+/** Parse "float32" / "float64". Returns 0 on success, -1 if unknown. */
+int komparu_num_type_parse(const char *name, komparu_num_type_t *out);
+
+/** Element size in bytes. */
+size_t komparu_num_type_size(komparu_num_type_t type);
+
+/**
+ * Compare two readers as arrays of native-endian floating-point values.
+ *
+ * With nan_equal, byte-identical chunks skip the element-wise pass.
+ * Sources of different length are DIFFERENT; a trailing partial element
+ * is an error.
+ */
+komparu_result_t komparu_compare_numeric(
+    komparu_reader_t *reader_a,
+    komparu_reader_t *reader_b,
+    size_t chunk_size,
+    const komparu_num_opts_t *opts,
+    const char **err_msg
+);
+
+/**
+ * Whether komparu_compare() skips the holes two sparse local files share
+ * (default true). Process-wide; with false every byte is read.
+ */
+void komparu_set_skip_holes(bool skip);
+
 /**
  * Free thread-local comparison buffers.
  * Call from worker threads before exit to prevent leaks.
@@ -58,6 +195,66 @@ komparu_result_t komparu_quick_check(
  */
 void komparu_compare_tls_cleanup(void);
 
+/* =========================================================================
+ * Cancellation
+ * ========================================================================= */
+
+/**
+ * Cancellation token shared by a caller and the comparisons it runs.
+ *
+ * Zero-initialize. Setting `cancelled` from any thread stops every
+ * comparison bound to the token at its next chunk; with deadline_ns > 0
+ * (komparu_monotonic_ns() clock) they also stop once it has passed.
+ */
+typedef struct {
+    _Atomic bool cancelled;
+    int64_t deadline_ns;
+} komparu_cancel_t;
+
+#define KOMPARU_CANCEL_NONE      0
+#define KOMPARU_CANCEL_REQUESTED 1  /* cancelled was set */
+#define KOMPARU_CANCEL_DEADLINE  2  /* deadline_ns has passed */
+
+/** Monotonic clock in nanoseconds, for komparu_cancel_t.deadline_ns. */
+int64_t komparu_monotonic_ns(void);
+
+/** KOMPARU_CANCEL_* state of a token; NULL is never cancelled. */
+int komparu_cancel_state(komparu_cancel_t *cancel);
+
+/**
+ * Bind a token to the calling thread (NULL unbinds) and return the one
+ * bound before. The compare loops above and komparu_compare_dirs() check
+ * the bound token between chunks and fail with KOMPARU_ERROR and
+ * *err_msg "cancelled" or "deadline exceeded"; komparu_compare_dirs()
+ * also binds it on its pool workers.
+ */
+komparu_cancel_t *komparu_cancel_bind(komparu_cancel_t *cancel);
+
+/** Token bound to the calling thread, or NULL. */
+komparu_cancel_t *komparu_cancel_bound(void);
+
+/**
+ * KOMPARU_CANCEL_* state of the bound token; when nonzero, *err_msg is
+ * set to "cancelled" or "deadline exceeded".
+ */
+int komparu_cancel_poll(const char **err_msg);
+
+/* =========================================================================
+ * Progress — a byte counter bound per thread
+ * ========================================================================= */
+
+/**
+ * Bind a byte counter to the calling thread (NULL unbinds) and return the
+ * one bound before. komparu_compare() and komparu_compare_detailed() add
+ * the larger of the two read lengths of every chunk to it, so a long
+ * scan reports progress while it runs. Binding resets
+ * komparu_progress_added().
+ */
+_Atomic uint64_t *komparu_progress_bind(_Atomic uint64_t *bytes);
+
+/** Bytes added to the bound counter by this thread since it was bound. */
+uint64_t komparu_progress_added(void);
+
 /* =========================================================================
  * Directory / archive comparison result
  * ========================================================================= */
@@ -66,6 +263,9 @@ void komparu_compare_tls_cleanup(void);
 #define KOMPARU_DIFF_CONTENT    0
 #define KOMPARU_DIFF_SIZE       1
 #define KOMPARU_DIFF_READ_ERROR 2
+#define KOMPARU_DIFF_TYPE       3  /* file type or device numbers differ */
+#define KOMPARU_DIFF_BROKEN_SYMLINK 4  /* dangling symlink on either side */
+#define KOMPARU_DIFF_LINK_TARGET 5  /* both symlinks, different targets */
 
 typedef struct {
     char *path;
@@ -90,6 +290,17 @@ typedef struct komparu_dir_result {
     char **errors;
     size_t error_count;
     size_t error_cap;
+
+    /* Common entries that compared equal, kept only when list_equal is set */
+    bool list_equal;
+    char **same;
+    size_t same_count;
+    size_t same_cap;
+
+    /* Summary mode: add_* only bump the counts, no paths are stored */
+    bool counts_only;
+    size_t compared;        /* common entries compared */
+    uint64_t bytes_read;    /* content bytes read, both sides */
 } komparu_dir_result_t;
 
 komparu_dir_result_t *komparu_dir_result_new(void);
@@ -99,5 +310,6 @@ int komparu_dir_result_add_diff(komparu_dir_result_t *r, const char *path, int r
 int komparu_dir_result_add_only_left(komparu_dir_result_t *r, const char *path);
 int komparu_dir_result_add_only_right(komparu_dir_result_t *r, const char *path);
 int komparu_dir_result_add_error(komparu_dir_result_t *r, const char *path);
+int komparu_dir_result_add_same(komparu_dir_result_t *r, const char *path);
 
 #endif /* KOMPARU_COMPARE_H */
@@ -0,0 +1,271 @@
+/**
+ * digest.c — Streaming SHA-256 (FIPS 180-4).
+ *
+ * Portable C compression function, plus an x86-64 SHA-NI path selected
+ * at runtime. No external crypto library. Throughput is bound by the
+ * compression function, so directory hashing parallelizes across files
+ * rather than within one file.
+ */
+
+#include "digest.h"
+#include <stdlib.h>
+#include <string.h>
+#include <stdatomic.h>
+
+#if defined(__x86_64__) && (defined(__GNUC__) || defined(__clang__))
+#define KOMPARU_SHA_NI 1
+#include <immintrin.h>
+#endif
+
+/* =========================================================================
+ * SHA-256 core
+ * ========================================================================= */
+
+static const uint32_t K[64] = {
+    0x428a2f98, 0x71374491, 0xb5c0fbcf, 0xe9b5dba5, 0x3956c25b, 0x59f111f1, 0x923f82a4, 0xab1c5ed5,
+    0xd807aa98, 0x12835b01, 0x243185be, 0x550c7dc3, 0x72be5d74, 0x80deb1fe, 0x9bdc06a7, 0xc19bf174,
+    0xe49b69c1, 0xefbe4786, 0x0fc19dc6, 0x240ca1cc, 0x2de92c6f, 0x4a7484aa, 0x5cb0a9dc, 0x76f988da,
+    0x983e5152, 0xa831c66d, 0xb00327c8, 0xbf597fc7, 0xc6e00bf3, 0xd5a79147, 0x06ca6351, 0x14292967,
+    0x27b70a85, 0x2e1b2138, 0x4d2c6dfc, 0x53380d13, 0x650a7354, 0x766a0abb, 0x81c2c92e, 0x92722c85,
+    0xa2bfe8a1, 0xa81a664b, 0xc24b8b70, 0xc76c51a3, 0xd192e819, 0xd6990624, 0xf40e3585, 0x106aa070,
+    0x19a4c116, 0x1e376c08, 0x2748774c, 0x34b0bcb5, 0x391c0cb3, 0x4ed8aa4a, 0x5b9cca4f, 0x682e6ff3,
+    0x748f82ee, 0x78a5636f, 0x84c87814, 0x8cc70208, 0x90befffa, 0xa4506ceb, 0xbef9a3f7, 0xc67178f2,
+};
+
+#define ROTR(x, n) (((x) >> (n)) | ((x) << (32 - (n))))
+
+static void sha256_compress(uint32_t state[8], const uint8_t block[64]) {
+    uint32_t w[64];
+    for (int i = 0; i < 16; i++) {
+        w[i] = ((uint32_t)block[i * 4] << 24) |
+               ((uint32_t)block[i * 4 + 1] << 16) |
+               ((uint32_t)block[i * 4 + 2] << 8) |
+               ((uint32_t)block[i * 4 + 3]);
+    }
+    for (int i = 16; i < 64; i++) {
+        uint32_t s0 = ROTR(w[i - 15], 7) ^ ROTR(w[i - 15], 18) ^ (w[i - 15] >> 3);
+        uint32_t s1 = ROTR(w[i - 2], 17) ^ ROTR(w[i - 2], 19) ^ (w[i - 2] >> 10);
+        w[i] = w[i - 16] + s0 + w[i - 7] + s1;
+    }
+
+    uint32_t a = state[0], b = state[1], c = state[2], d = state[3];
+    uint32_t e = state[4], f = state[5], g = state[6], h = state[7];
+
+    for (int i = 0; i < 64; i++) {
+        uint32_t S1 = ROTR(e, 6) ^ ROTR(e, 11) ^ ROTR(e, 25);
+        uint32_t ch = (e & f) ^ (~e & g);
+        uint32_t t1 = h + S1 + ch + K[i] + w[i];
+        uint32_t S0 = ROTR(a, 2) ^ ROTR(a, 13) ^ ROTR(a, 22);
+        uint32_t maj = (a & b) ^ (a & c) ^ (b & c);
+        uint32_t t2 = S0 + maj;
+        h = g; g = f; f = e; e = d + t1;
+        d = c; c = b; b = a; a = t1 + t2;
+    }
+
+    state[0] += a; state[1] += b; state[2] += c; state[3] += d;
+    state[4] += e; state[5] += f; state[6] += g; state[7] += h;
+}
+
+static void sha256_blocks_portable(uint32_t state[8], const uint8_t *data, size_t nblocks) {
+    for (size_t i = 0; i < nblocks; i++)
+        sha256_compress(state, data + i * 64);
+}
+
+#ifdef KOMPARU_SHA_NI
+
+/*
+ * SHA-NI: state is kept as ABEF/CDGH lane pairs for sha256rnds2.
+ * Message schedule for group g >= 4 (W[4g..4g+3]):
+ *   msg2(msg1(W[g-4], W[g-3]) + alignr(W[g-1], W[g-2], 4), W[g-1])
+ */
+__attribute__((target("sha,sse4.1")))
+static void sha256_blocks_shani(uint32_t state[8], const uint8_t *data, size_t nblocks) {
+    const __m128i shuf = _mm_set_epi64x(0x0c0d0e0f08090a0bULL, 0x0405060700010203ULL);
+
+    __m128i tmp = _mm_loadu_si128((const __m128i *)&state[0]);
+    __m128i st1 = _mm_loadu_si128((const __m128i *)&state[4]);
+    tmp = _mm_shuffle_epi32(tmp, 0xB1);           /* CDAB */
+    st1 = _mm_shuffle_epi32(st1, 0x1B);           /* EFGH */
+    __m128i st0 = _mm_alignr_epi8(tmp, st1, 8);   /* ABEF */
+    st1 = _mm_blend_epi16(st1, tmp, 0xF0);        /* CDGH */
+
+    for (size_t b = 0; b < nblocks; b++, data += 64) {
+        __m128i abef = st0;
+        __m128i cdgh = st1;
+        __m128i w[4];
+
+        for (int g = 0; g < 16; g++) {
+            __m128i cur;
+            if (g < 4) {
+                cur = _mm_shuffle_epi8(
+                    _mm_loadu_si128((const __m128i *)(data + g * 16)), shuf);
+            } else {
+                __m128i w4 = w[g & 3];
+                __m128i w3 = w[(g + 1) & 3];
+                __m128i w2 = w[(g + 2) & 3];
+                __m128i w1 = w[(g + 3) & 3];
+                cur = _mm_sha256msg1_epu32(w4, w3);
+                cur = _mm_add_epi32(cur, _mm_alignr_epi8(w1, w2, 4));
+                cur = _mm_sha256msg2_epu32(cur, w1);
+            }
+            w[g & 3] = cur;
+
+            __m128i msg = _mm_add_epi32(
+                cur, _mm_loadu_si128((const __m128i *)&K[g * 4]));
+            st1 = _mm_sha256rnds2_epu32(st1, st0, msg);
+            msg = _mm_shuffle_epi32(msg, 0x0E);
+            st0 = _mm_sha256rnds2_epu32(st0, st1, msg);
+        }
+
+        st0 = _mm_add_epi32(st0, abef);
+        st1 = _mm_add_epi32(st1, cdgh);
+    }
+
+    tmp = _mm_shuffle_epi32(st0, 0x1B);           /* FEBA */
+    st1 = _mm_shuffle_epi32(st1, 0xB1);           /* DCHG */
+    st0 = _mm_blend_epi16(tmp, st1, 0xF0);        /* DCBA */
+    st1 = _mm_alignr_epi8(st1, tmp, 8);           /* HGFE */
+    _mm_storeu_si128((__m128i *)&state[0], st0);
+    _mm_storeu_si128((__m128i *)&state[4], st1);
+}
+
+#endif /* KOMPARU_SHA_NI */
+
+typedef void (*sha256_blocks_fn)(uint32_t state[8], const uint8_t *data, size_t nblocks);
+
+/* Selected on first use; the race is benign (every thread picks the same) */
+static _Atomic(sha256_blocks_fn) g_sha256_blocks = NULL;
+
+static sha256_blocks_fn sha256_blocks(void) {
+    sha256_blocks_fn fn = atomic_load_explicit(&g_sha256_blocks, memory_order_relaxed);
+    if (KOMPARU_LIKELY(fn != NULL)) return fn;
+
+    fn = sha256_blocks_portable;
+#ifdef KOMPARU_SHA_NI
+    __builtin_cpu_init();
+    if (__builtin_cpu_supports("sha") && __builtin_cpu_supports("sse4.1"))
+        fn = sha256_blocks_shani;
+#endif
+    atomic_store_explicit(&g_sha256_blocks, fn, memory_order_relaxed);
+    return fn;
+}
+
+void komparu_sha256_init(komparu_sha256_t *ctx) {
+    static const uint32_t iv[8] = {
+        0x6a09e667, 0xbb67ae85, 0x3c6ef372, 0xa54ff53a,
+        0x510e527f, 0x9b05688c, 0x1f83d9ab, 0x5be0cd19,
+    };
+    memcpy(ctx->state, iv, sizeof(iv));
+    ctx->total = 0;
+    ctx->block_len = 0;
+}
+
+void komparu_sha256_update(komparu_sha256_t *ctx, const void *data, size_t len) {
+    const uint8_t *p = (const uint8_t *)data;
+    ctx->total += len;
+
+    if (ctx->block_len > 0) {
+        size_t take = 64 - ctx->block_len;
+        if (take > len) take = len;
+        memcpy(ctx->block + ctx->block_len, p, take);
+        ctx->block_len += take;
+        p += take;
+        len -= take;
+        if (ctx->block_len < 64) return;
+        sha256_blocks()(ctx->state, ctx->block, 1);
+        ctx->block_len = 0;
+    }
+
+    if (len >= 64) {
+        size_t nblocks = len / 64;
+        sha256_blocks()(ctx->state, p, nblocks);
+        p += nblocks * 64;
+        len -= nblocks * 64;
+    }
+
+    if (len > 0) {
+        memcpy(ctx->block, p, len);
+        ctx->block_len = len;
+    }
+}
+
+void komparu_sha256_final(komparu_sha256_t *ctx, uint8_t out[KOMPARU_SHA256_LEN]) {
+    uint64_t bits = ctx->total * 8;
+
+    ctx->block[ctx->block_len++] = 0x80;
+    if (ctx->block_len > 56) {
+        memset(ctx->block + ctx->block_len, 0, 64 - ctx->block_len);
+        sha256_blocks()(ctx->state, ctx->block, 1);
+        ctx->block_len = 0;
+    }
+    memset(ctx->block + ctx->block_len, 0, 56 - ctx->block_len);
+    for (int i = 0; i < 8; i++)
+        ctx->block[56 + i] = (uint8_t)(bits >> (56 - 8 * i));
+    sha256_blocks()(ctx->state, ctx->block, 1);
+
+    for (int i = 0; i < 8; i++) {
+        out[i * 4]     = (uint8_t)(ctx->state[i] >> 24);
+        out[i * 4 + 1] = (uint8_t)(ctx->state[i] >> 16);
+        out[i * 4 + 2] = (uint8_t)(ctx->state[i] >> 8);
+        out[i * 4 + 3] = (uint8_t)(ctx->state[i]);
+    }
+}
+
+/* =========================================================================
+ * Reader hashing
+ * ========================================================================= */
+
+/* Per-thread chunk buffer, grown on demand (same scheme as compare.c) */
+static _Thread_local void *tl_hash_buf = NULL;
+static _Thread_local size_t tl_hash_cap = 0;
+
+int komparu_sha256_reader(
+    komparu_reader_t *reader,
+    size_t chunk_size,
+    uint8_t out[KOMPARU_SHA256_LEN],
+    const char **err_msg
+) {
+    if (chunk_size == 0) chunk_size = KOMPARU_DEFAULT_CHUNK_SIZE;
+
+    if (chunk_size > tl_hash_cap) {
+        void *nb = realloc(tl_hash_buf, chunk_size);
+        if (!nb) {
+            *err_msg = "out of memory";
+            return -1;
+        }
+        tl_hash_buf = nb;
+        tl_hash_cap = chunk_size;
+    }
+
+    komparu_sha256_t ctx;
+    komparu_sha256_init(&ctx);
+
+    for (;;) {
+        int64_t n = reader->read(reader, tl_hash_buf, chunk_size);
+        if (n == 0) break;
+        if (KOMPARU_UNLIKELY(n < 0)) {
+            *err_msg = "read error";
+            return -1;
+        }
+        komparu_sha256_update(&ctx, tl_hash_buf, (size_t)n);
+    }
+
+    komparu_sha256_final(&ctx, out);
+    return 0;
+}
+
+bool komparu_digest_equal(const uint8_t *a, const uint8_t *b, size_t len) {
+    volatile uint8_t acc = 0;
+    for (size_t i = 0; i < len; i++)
+        acc |= a[i] ^ b[i];
+    return acc == 0;
+}
+
+void komparu_digest_hex(const uint8_t *digest, size_t len, char *hex) {
+    static const char digits[] = "0123456789abcdef";
+    for (size_t i = 0; i < len; i++) {
+        hex[i * 2]     = digits[digest[i] >> 4];
+        hex[i * 2 + 1] = digits[digest[i] & 0x0f];
+    }
+    hex[len * 2] = '\0';
+}
@@ -0,0 +1,53 @@
+/**
+ * digest.h — Streaming SHA-256 for content fingerprints.
+ *
+ * Self-contained implementation (FIPS 180-4), no OpenSSL dependency.
+ */
+
+#ifndef KOMPARU_DIGEST_H
+#define KOMPARU_DIGEST_H
+
+#include "compat.h"
+#include "reader.h"
+
+#define KOMPARU_SHA256_LEN 32
+#define KOMPARU_SHA256_HEX_LEN (KOMPARU_SHA256_LEN * 2)
+
+typedef struct {
+    uint32_t state[8];
+    uint64_t total;       /* bytes hashed so far */
+    uint8_t block[64];    /* pending partial block */
+    size_t block_len;
+} komparu_sha256_t;
+
+void komparu_sha256_init(komparu_sha256_t *ctx);
+void komparu_sha256_update(komparu_sha256_t *ctx, const void *data, size_t len);
+void komparu_sha256_final(komparu_sha256_t *ctx, uint8_t out[KOMPARU_SHA256_LEN]);
+
+/**
+ * Hash all remaining bytes of a reader.
+ *
+ * Uses a thread-local chunk buffer of `chunk_size` bytes.
+ * Returns 0 on success, -1 on read error (*err_msg set).
+ */
+int komparu_sha256_reader(
+    komparu_reader_t *reader,
+    size_t chunk_size,
+    uint8_t out[KOMPARU_SHA256_LEN],
+    const char **err_msg
+);
+
+/**
+ * Compare two digests in time independent of where they differ.
+ * Returns true if equal.
+ */
+bool komparu_digest_equal(const uint8_t *a, const uint8_t *b, size_t len);
+
+/** Format a digest as lowercase hex into `hex` (NUL-terminated). */
+void komparu_digest_hex(
+    const uint8_t *digest,
+    size_t len,
+    char *hex
+);
+
+#endif /* KOMPARU_DIGEST_H */
@@ -19,9 +19,14 @@
 #include <errno.h>
 #include <dirent.h>
 #include <limits.h>
+#include <stdatomic.h>
 
 static _Thread_local char dirwalk_errbuf[512];
 
+/* Offending entry of the last walk that failed under regular_only */
+static _Thread_local char dirwalk_bad_path[PATH_MAX];
+static _Thread_local const char *dirwalk_bad_kind;
+
 /* =========================================================================
  * Arena allocator — contiguous string storage in 64KB blocks
  * ========================================================================= */
@@ -206,6 +211,231 @@ static int devino_set_check_and_add(devino_set_t *set, dev_t dev, ino_t ino) {
  * Recursive walker — uses fd-relative operations for performance
  * ========================================================================= */
 
+/* FIFOs, sockets and device nodes: compared by type, never opened */
+/* =========================================================================
+ * Walk filter — gitignore-style exclude/include patterns
+ * ========================================================================= */
+
+/* Match one "[...]" class at p against c. Returns the pattern past the
+ * closing ']', or NULL if the class is unterminated. */
+static const char *glob_class(const char *p, unsigned char c, bool *hit) {
+    const char *q = p + 1;
+    bool negate = *q == '!' || *q == '^';
+    if (negate) q++;
+    const char *first = q;
+    bool found = false;
+    while (*q && (q == first || *q != ']')) {
+        unsigned char lo = (unsigned char)*q++;
+        if (lo == '\\' && *q) lo = (unsigned char)*q++;
+        unsigned char hi = lo;
+        if (q[0] == '-' && q[1] && q[1] != ']') {
+            q++;
+            hi = (unsigned char)*q++;
+            if (hi == '\\' && *q) hi = (unsigned char)*q++;
+        }
+        if (lo <= c && c <= hi) found = true;
+    }
+    if (*q != ']') return NULL;
+    *hit = found != negate;
+    return q + 1;
+}
+
+static bool glob_match(const char *start, const char *p, const char *s) {
+    while (*p) {
+        switch (*p) {
+        case '*':
+            if (p[1] == '*' && (p == start || p[-1] == '/') &&
+                (p[2] == '/' || p[2] == '\0')) {
+                /* "**" component: zero or more whole directories */
+                if (p[2] == '\0') return true;
+                p += 3;
+                for (;;) {
+                    if (glob_match(start, p, s)) return true;
+                    s = strchr(s, '/');
+                    if (!s) return false;
+                    s++;
+                }
+            }
+            while (*p == '*') p++;
+            for (;;) {
+                if (glob_match(start, p, s)) return true;
+                if (*s == '\0' || *s == '/') return false;
+                s++;
+            }
+        case '?':
+            if (*s == '\0' || *s == '/') return false;
+            p++;
+            s++;
+            break;
+        case '[': {
+            if (*s == '\0' || *s == '/') return false;
+            bool hit;
+            const char *next = glob_class(p, (unsigned char)*s, &hit);
+            if (next) {
+                if (!hit) return false;
+                p = next;
+                s++;
+                break;
+            }
+            /* unterminated: a literal '[' */
+            if (*s != '[') return false;
+            p++;
+            s++;
+            break;
+        }
+        case '\\':
+            if (p[1]) p++;
+            /* fall through */
+        default:
+            if (*p != *s) return false;
+            p++;
+            s++;
+        }
+    }
+    return *s == '\0';
+}
+
+static bool pattern_hits(
+    const komparu_walk_pattern_t *pats, size_t n,
+    const char *rel_path, const char *name, bool is_dir
+) {
+    for (size_t k = 0; k < n; k++) {
+        if (pats[k].dir_only && !is_dir) continue;
+        const char *glob = pats[k].glob;
+        if (glob_match(glob, glob, pats[k].anchored ? rel_path : name))
+            return true;
+    }
+    return false;
+}
+
+static int parse_patterns(
+    komparu_walk_pattern_t **out, const char *const *src, size_t n,
+    const char **err_msg
+) {
+    *out = NULL;
+    if (n == 0) return 0;
+    komparu_walk_pattern_t *pats = calloc(n, sizeof(*pats));
+    if (KOMPARU_UNLIKELY(!pats)) {
+        *err_msg = "out of memory";
+        return -1;
+    }
+    *out = pats;
+    for (size_t k = 0; k < n; k++) {
+        const char *s = src[k];
+        size_t len = strlen(s);
+        pats[k].dir_only = len > 0 && s[len - 1] == '/';
+        while (len > 0 && s[len - 1] == '/') len--;
+        pats[k].anchored = *s == '/';
+        while (len > 0 && *s == '/') {
+            s++;
+            len--;
+        }
+        if (len == 0) {
+            *err_msg = "empty pattern";
+            return -1;
+        }
+        pats[k].glob = malloc(len + 1);
+        if (KOMPARU_UNLIKELY(!pats[k].glob)) {
+            *err_msg = "out of memory";
+            return -1;
+        }
+        memcpy(pats[k].glob, s, len);
+        pats[k].glob[len] = '\0';
+        if (memchr(pats[k].glob, '/', len)) pats[k].anchored = true;
+    }
+    return 0;
+}
+
+static void free_patterns(komparu_walk_pattern_t *pats, size_t n) {
+    if (!pats) return;
+    for (size_t k = 0; k < n; k++) free(pats[k].glob);
+    free(pats);
+}
+
+int komparu_walk_filter_init(
+    komparu_walk_filter_t *filter,
+    const char *const *exclude,
+    size_t n_exclude,
+    const char *const *include,
+    size_t n_include,
+    const char **err_msg
+) {
+    memset(filter, 0, sizeof(*filter));
+    filter->n_exclude = n_exclude;
+    filter->n_include = n_include;
+    if (parse_patterns(&filter->exclude, exclude, n_exclude, err_msg) != 0 ||
+        parse_patterns(&filter->include, include, n_include, err_msg) != 0) {
+        komparu_walk_filter_free(filter);
+        return -1;
+    }
+    return 0;
+}
+
+void komparu_walk_filter_free(komparu_walk_filter_t *filter) {
+    free_patterns(filter->exclude, filter->n_exclude);
+    free_patterns(filter->include, filter->n_include);
+    memset(filter, 0, sizeof(*filter));
+}
+
+bool komparu_walk_filter_keeps(const komparu_walk_filter_t *filter, const char *rel_path) {
+    char buf[PATH_MAX];
+    size_t len = strlen(rel_path);
+    if (len >= sizeof(buf)) return true;
+    memcpy(buf, rel_path, len + 1);
+    bool is_dir = len > 0 && buf[len - 1] == '/';
+    while (len > 0 && buf[len - 1] == '/') buf[--len] = '\0';
+    if (len == 0) return true;
+
+    bool included = filter->n_include == 0;
+    char *name = buf;
+    for (;;) {
+        char *slash = strchr(name, '/');
+        bool dir = slash != NULL || is_dir;
+        if (slash) *slash = '\0';
+        if (pattern_hits(filter->exclude, filter->n_exclude, buf, name, dir))
+            return false;
+        if (!included)
+            included = pattern_hits(filter->include, filter->n_include, buf, name, dir);
+        if (!slash) return dir || included;
+        *slash = '/';
+        name = slash + 1;
+    }
+}
+
+static inline bool is_special_mode(mode_t mode) {
+#ifdef KOMPARU_WINDOWS
+    (void)mode;
+    return false;
+#else
+    return S_ISFIFO(mode) || S_ISSOCK(mode) || S_ISCHR(mode) || S_ISBLK(mode);
+#endif
+}
+
+#ifndef KOMPARU_WINDOWS
+/* A symlink whose target does not resolve (missing, loop, or a file used
+ * as a directory component). */
+static bool is_broken_link(int dfd, const char *name) {
+    struct stat st;
+    if (fstatat(dfd, name, &st, 0) == 0) return false;
+    if (errno != ENOENT && errno != ELOOP && errno != ENOTDIR) return false;
+    return fstatat(dfd, name, &st, AT_SYMLINK_NOFOLLOW) == 0 && S_ISLNK(st.st_mode);
+}
+#endif
+
+/* Human-readable type of a non-regular, non-directory entry */
+static const char *entry_kind(mode_t mode) {
+#ifndef KOMPARU_WINDOWS
+    if (S_ISLNK(mode)) return "symlink";
+    if (S_ISFIFO(mode)) return "fifo";
+    if (S_ISSOCK(mode)) return "socket";
+    if (S_ISCHR(mode)) return "character device";
+    if (S_ISBLK(mode)) return "block device";
+#else
+    (void)mode;
+#endif
+    return "unknown type";
+}
+
 /* Guard against pathological directory depth (symlink cycles with
  * follow_symlinks=true, or genuinely deep trees). 256 levels of nesting
  * covers any real-world use case while preventing stack overflow. */
@@ -215,7 +445,14 @@ static int walk_recursive(
     int parent_fd,          /* consumed — fdopendir takes ownership */
     const char *rel_prefix, /* "" for root */
     int stat_flags,
+    bool include_special,   /* also list FIFOs, sockets and device nodes */
+    bool include_broken,    /* also list dangling symlinks */
+    bool regular_only,      /* fail on anything but regular files and dirs */
+    komparu_link_mode_t links,
     int depth,
+    int max_depth,          /* -1 = unlimited; subdirs at max_depth are not entered */
+    const komparu_walk_filter_t *filter,  /* NULL = keep everything */
+    bool included,          /* an include pattern matched a parent (or there are none) */
     devino_set_t *visited,  /* tracks visited directories for loop detection */
     komparu_pathlist_t *result,
     komparu_pathlist_t *errors,  /* NULL = ignore permission errors */
@@ -226,6 +463,10 @@ static int walk_recursive(
         *err_msg = "directory tree too deep (>256 levels)";
         return -1;
     }
+    if (KOMPARU_UNLIKELY(komparu_cancel_poll(err_msg))) {
+        close(parent_fd);
+        return -1;
+    }
     DIR *dir = fdopendir(parent_fd);
     if (KOMPARU_UNLIKELY(!dir)) {
         close(parent_fd);
@@ -246,27 +487,6 @@ static int walk_recursive(
             if (name[1] == '.' && name[2] == '\0') continue;
         }
 
-        struct stat st;
-        if (KOMPARU_UNLIKELY(fstatat(dfd, name, &st, stat_flags) != 0)) {
-            if (errors && (errno == EACCES || errno == EPERM)) {
-                /* Build relative path for the error entry */
-                char err_path[PATH_MAX];
-                int elen;
-                if (rel_prefix[0]) {
-                    elen = snprintf(err_path, sizeof(err_path), "%s/%s", rel_prefix, name);
-                } else {
-                    elen = snprintf(err_path, sizeof(err_path), "%s", name);
-                }
-                if (elen >= 0 && (size_t)elen < sizeof(err_path)) {
-                    if (KOMPARU_UNLIKELY(pathlist_append(errors, err_path, err_msg) != 0)) {
-                        closedir(dir);
-                        return -1;
-                    }
-                }
-            }
-            continue;
-        }
-
         /* Build relative path */
         char rel_path[PATH_MAX];
         int plen;
@@ -275,15 +495,88 @@ static int walk_recursive(
         } else {
             plen = snprintf(rel_path, sizeof(rel_path), "%s", name);
         }
-        if (KOMPARU_UNLIKELY(plen < 0 || (size_t)plen >= sizeof(rel_path)))
+        bool path_ok = plen >= 0 && (size_t)plen < sizeof(rel_path);
+
+        struct stat st;
+        if (KOMPARU_UNLIKELY(fstatat(dfd, name, &st, stat_flags) != 0)) {
+            int stat_errno = errno;
+            /* Unknown type: drop it if it would be dropped as a file */
+            if (filter && path_ok &&
+                (pattern_hits(filter->exclude, filter->n_exclude, rel_path, name, false) ||
+                 !(included || pattern_hits(filter->include, filter->n_include, rel_path, name, false))))
+                continue;
+#ifndef KOMPARU_WINDOWS
+            /* Following links: a dangling one is listed, not dropped */
+            if (include_broken && path_ok && is_broken_link(dfd, name)) {
+                if (KOMPARU_UNLIKELY(pathlist_append(result, rel_path, err_msg) != 0)) {
+                    closedir(dir);
+                    return -1;
+                }
+                continue;
+            }
+#endif
+            if (errors && path_ok && (stat_errno == EACCES || stat_errno == EPERM)) {
+                if (KOMPARU_UNLIKELY(pathlist_append(errors, rel_path, err_msg) != 0)) {
+                    closedir(dir);
+                    return -1;
+                }
+            }
+            continue;
+        }
+
+        if (KOMPARU_UNLIKELY(!path_ok))
             continue; /* path too long — skip */
 
-        if (S_ISREG(st.st_mode)) {
+        bool sub_included = included;
+        if (filter) {
+            bool is_dir = S_ISDIR(st.st_mode);
+            if (pattern_hits(filter->exclude, filter->n_exclude, rel_path, name, is_dir))
+                continue; /* excluded directories are never opened */
+            if (!included)
+                sub_included = pattern_hits(filter->include, filter->n_include, rel_path, name, is_dir);
+            if (!is_dir && !sub_included) continue;
+        }
+
+#ifndef KOMPARU_WINDOWS
+        if (links == KOMPARU_LINKS_SKIP && S_ISLNK(st.st_mode))
+            continue;
+#endif
+
+        if (regular_only && !S_ISREG(st.st_mode) && !S_ISDIR(st.st_mode)) {
+            snprintf(dirwalk_bad_path, sizeof(dirwalk_bad_path), "%s", rel_path);
+            dirwalk_bad_kind = entry_kind(st.st_mode);
+            closedir(dir);
+            return -1;
+        }
+
+#ifndef KOMPARU_WINDOWS
+        /* Compared by target string, never entered */
+        if (links == KOMPARU_LINKS_COMPARE && S_ISLNK(st.st_mode)) {
+            if (KOMPARU_UNLIKELY(pathlist_append(result, rel_path, err_msg) != 0)) {
+                closedir(dir);
+                return -1;
+            }
+            continue;
+        }
+
+        /* Not following links: list dangling ones, compared by target */
+        if (include_broken && S_ISLNK(st.st_mode) && is_broken_link(dfd, name)) {
+            if (KOMPARU_UNLIKELY(pathlist_append(result, rel_path, err_msg) != 0)) {
+                closedir(dir);
+                return -1;
+            }
+            continue;
+        }
+#endif
+
+        if (S_ISREG(st.st_mode) || (include_special && is_special_mode(st.st_mode))) {
             if (KOMPARU_UNLIKELY(pathlist_append(result, rel_path, err_msg) != 0)) {
                 closedir(dir);
                 return -1;
             }
         } else if (S_ISDIR(st.st_mode)) {
+            if (max_depth >= 0 && depth >= max_depth) continue;
+
             int sub_fd = openat(dfd, name, O_RDONLY | O_DIRECTORY | O_CLOEXEC);
             if (KOMPARU_UNLIKELY(sub_fd < 0)) {
                 if (errors && (errno == EACCES || errno == EPERM)) {
@@ -314,7 +607,7 @@ static int walk_recursive(
                 return -1;
             }
 
-            if (KOMPARU_UNLIKELY(walk_recursive(sub_fd, rel_path, stat_flags, depth + 1, visited, result, errors, err_msg) != 0)) {
+            if (KOMPARU_UNLIKELY(walk_recursive(sub_fd, rel_path, stat_flags, include_special, include_broken, regular_only, links, depth + 1, max_depth, filter, sub_included, visited, result, errors, err_msg) != 0)) {
                 closedir(dir);
                 return -1;
             }
@@ -331,9 +624,28 @@ int komparu_dirwalk(
     komparu_pathlist_t *result,
     komparu_pathlist_t *errors,
     const char **err_msg
+) {
+    return komparu_dirwalk_ex(base_dir, follow_symlinks, KOMPARU_LINKS_DEFAULT,
+                              false, false, false, -1, NULL,
+                              result, errors, err_msg);
+}
+
+int komparu_dirwalk_ex(
+    const char *base_dir,
+    bool follow_symlinks,
+    komparu_link_mode_t links,
+    bool include_special,
+    bool include_broken,
+    bool regular_only,
+    int max_depth,
+    const komparu_walk_filter_t *filter,
+    komparu_pathlist_t *result,
+    komparu_pathlist_t *errors,
+    const char **err_msg
 ) {
     memset(result, 0, sizeof(*result));
     if (errors) memset(errors, 0, sizeof(*errors));
+    dirwalk_bad_kind = NULL;
 
     int fd = open(base_dir, O_RDONLY | O_DIRECTORY | O_CLOEXEC);
     if (KOMPARU_UNLIKELY(fd < 0)) {
@@ -361,12 +673,27 @@ int komparu_dirwalk(
     }
     devino_set_check_and_add(&visited, root_st.st_dev, root_st.st_ino);
 
-    int stat_flags = follow_symlinks ? 0 : AT_SYMLINK_NOFOLLOW;
+    /* regular_only and the link modes must see links themselves, never
+     * their targets */
+    bool follow = follow_symlinks && !regular_only && links == KOMPARU_LINKS_DEFAULT;
+    int stat_flags = follow ? 0 : AT_SYMLINK_NOFOLLOW;
 
-    if (KOMPARU_UNLIKELY(walk_recursive(fd, "", stat_flags, 0, &visited, result, errors, err_msg) != 0)) {
+    if (KOMPARU_UNLIKELY(walk_recursive(fd, "", stat_flags, include_special, include_broken, regular_only, links, 0, max_depth, filter, !filter || filter->n_include == 0, &visited, result, errors, err_msg) != 0)) {
         devino_set_free(&visited);
         komparu_pathlist_free(result);
         if (errors) komparu_pathlist_free(errors);
+        if (dirwalk_bad_kind) {
+            char rel[PATH_MAX];
+            memcpy(rel, dirwalk_bad_path, sizeof(rel));
+            int n = snprintf(dirwalk_bad_path, sizeof(dirwalk_bad_path), "%s/%s",
+                             base_dir, rel);
+            if (KOMPARU_UNLIKELY(n < 0 || (size_t)n >= sizeof(dirwalk_bad_path)))
+                memcpy(dirwalk_bad_path, rel, sizeof(rel)); /* keep relative */
+            snprintf(dirwalk_errbuf, sizeof(dirwalk_errbuf),
+                     "'%.400s' is a %s, not a regular file", dirwalk_bad_path,
+                     dirwalk_bad_kind);
+            *err_msg = dirwalk_errbuf;
+        }
         return -1;
     }
 
@@ -380,32 +707,209 @@ int komparu_dirwalk(
     return 0;
 }
 
+const char *komparu_dirwalk_nonregular(const char **kind) {
+    if (!dirwalk_bad_kind) return NULL;
+    if (kind) *kind = dirwalk_bad_kind;
+    return dirwalk_bad_path;
+}
+
 /* =========================================================================
  * Per-file comparison task (used by both sequential and parallel paths)
  * ========================================================================= */
 
-typedef struct {
+typedef struct dir_cmp_task {
     char *full_path_a;
     char *full_path_b;
     char *rel_path;
     size_t chunk_size;
     bool size_precheck;
     bool quick_check;
+    bool special_files;
+    bool follow_symlinks; /* type checks see link targets, else the links */
+    bool compare_links;  /* symlinks compare by target string */
     int result_reason;  /* -1 = equal, else KOMPARU_DIFF_* */
+    uint64_t bytes_read;
+    uint64_t plan_bytes;                /* larger side's size, with progress */
+    komparu_dir_progress_t *progress;   /* NULL = not tracked */
+    atomic_bool *stop;                  /* shared: set on the first read error, NULL = keep going */
+    komparu_cancel_t *cancel;           /* caller's bound token, NULL = none */
+    const struct dir_cmp_task *same_as; /* earlier pair of the same two inodes, NULL = compare */
 } dir_cmp_task_t;
 
+#ifndef KOMPARU_WINDOWS
+/**
+ * Compare two entries by type when either is not a regular file.
+ * Returns -1 if equal, KOMPARU_DIFF_TYPE if type or device numbers
+ * differ, or -2 if both are regular files (content must be compared).
+ */
+static int special_cmp(const struct stat *sa, const struct stat *sb) {
+    if (S_ISREG(sa->st_mode) && S_ISREG(sb->st_mode)) return -2;
+    if ((sa->st_mode & S_IFMT) != (sb->st_mode & S_IFMT)) return KOMPARU_DIFF_TYPE;
+    if ((S_ISCHR(sa->st_mode) || S_ISBLK(sa->st_mode)) && sa->st_rdev != sb->st_rdev)
+        return KOMPARU_DIFF_TYPE;
+    return -1;
+}
+
+/* Dangling symlink: lstat succeeds on a link whose target stat fails */
+static bool path_is_broken_link(const char *path) {
+    struct stat st;
+    return stat(path, &st) != 0 && lstat(path, &st) == 0 && S_ISLNK(st.st_mode);
+}
+
+/**
+ * Compare entries when either is a dangling symlink.
+ * Returns -1 if both are links with the same target, KOMPARU_DIFF_BROKEN_SYMLINK
+ * otherwise, or -2 if neither side is a dangling symlink.
+ */
+static int broken_link_cmp(const char *path_a, const char *path_b) {
+    bool ba = path_is_broken_link(path_a);
+    bool bb = path_is_broken_link(path_b);
+    if (!ba && !bb) return -2;
+    if (!ba || !bb) return KOMPARU_DIFF_BROKEN_SYMLINK;
+
+    char ta[PATH_MAX], tb[PATH_MAX];
+    ssize_t la = readlink(path_a, ta, sizeof(ta));
+    ssize_t lb = readlink(path_b, tb, sizeof(tb));
+    if (la < 0 || lb < 0 || la != lb || memcmp(ta, tb, (size_t)la) != 0)
+        return KOMPARU_DIFF_BROKEN_SYMLINK;
+    return -1;
+}
+
+/**
+ * Compare entries as links when either is a symlink.
+ * Returns -1 if both are links with the same target, KOMPARU_DIFF_TYPE if
+ * only one is a link, KOMPARU_DIFF_LINK_TARGET if the targets differ,
+ * KOMPARU_DIFF_READ_ERROR if a side cannot be read, or -2 if neither side
+ * is a symlink.
+ */
+static int link_target_cmp(const char *path_a, const char *path_b) {
+    struct stat sa, sb;
+    if (lstat(path_a, &sa) != 0 || lstat(path_b, &sb) != 0)
+        return KOMPARU_DIFF_READ_ERROR;
+    bool la = S_ISLNK(sa.st_mode), lb = S_ISLNK(sb.st_mode);
+    if (!la && !lb) return -2;
+    if (!la || !lb) return KOMPARU_DIFF_TYPE;
+
+    char ta[PATH_MAX], tb[PATH_MAX];
+    ssize_t na = readlink(path_a, ta, sizeof(ta));
+    ssize_t nb = readlink(path_b, tb, sizeof(tb));
+    if (na < 0 || nb < 0) return KOMPARU_DIFF_READ_ERROR;
+    if (na != nb || memcmp(ta, tb, (size_t)na) != 0) return KOMPARU_DIFF_LINK_TARGET;
+    return -1;
+}
+#endif
+
+#ifndef KOMPARU_WINDOWS
+/* The (dev, ino) identity of both sides of one pair */
+typedef struct {
+    dev_t dev_a, dev_b;
+    ino_t ino_a, ino_b;
+    size_t index;
+} link_pair_t;
+
+static int link_pair_cmp(const void *x, const void *y) {
+    const link_pair_t *a = x, *b = y;
+    if (a->dev_a != b->dev_a) return a->dev_a < b->dev_a ? -1 : 1;
+    if (a->ino_a != b->ino_a) return a->ino_a < b->ino_a ? -1 : 1;
+    if (a->dev_b != b->dev_b) return a->dev_b < b->dev_b ? -1 : 1;
+    if (a->ino_b != b->ino_b) return a->ino_b < b->ino_b ? -1 : 1;
+    return a->index < b->index ? -1 : a->index > b->index;
+}
+
+static bool link_pair_same(const link_pair_t *a, const link_pair_t *b) {
+    return a->dev_a == b->dev_a && a->ino_a == b->ino_a &&
+           a->dev_b == b->dev_b && a->ino_b == b->ino_b;
+}
+
+/**
+ * Point every pair of regular files whose two inodes an earlier pair
+ * already has (hard links, bind mounts, followed symlinks) at that pair,
+ * so its content is compared once. Stores the number of pairs marked in
+ * *marked. Returns 0 on success, -1 when out of memory.
+ */
+static int link_pairs_mark(dir_cmp_task_t *tasks, size_t count, bool lstat_only,
+                           size_t *marked) {
+    link_pair_t *pairs = malloc(count * sizeof(*pairs));
+    if (KOMPARU_UNLIKELY(!pairs)) return -1;
+    int (*stat_fn)(const char *, struct stat *) = lstat_only ? lstat : stat;
+    size_t n = 0;
+    for (size_t k = 0; k < count; k++) {
+        struct stat sa, sb;
+        if (stat_fn(tasks[k].full_path_a, &sa) != 0 || stat_fn(tasks[k].full_path_b, &sb) != 0)
+            continue;
+        if (!S_ISREG(sa.st_mode) || !S_ISREG(sb.st_mode)) continue;
+        pairs[n++] = (link_pair_t){sa.st_dev, sb.st_dev, sa.st_ino, sb.st_ino, k};
+    }
+    qsort(pairs, n, sizeof(*pairs), link_pair_cmp);
+    *marked = 0;
+    size_t first = 0;
+    for (size_t k = 1; k < n; k++) {
+        if (!link_pair_same(&pairs[first], &pairs[k])) {
+            first = k;
+            continue;
+        }
+        tasks[pairs[k].index].same_as = &tasks[pairs[first].index];
+        (*marked)++;
+    }
+    free(pairs);
+    return 0;
+}
+#endif
+
+/* Close both readers, adding what they read to the task's byte count */
+static void task_close(dir_cmp_task_t *task, komparu_reader_t *ra, komparu_reader_t *rb) {
+    int64_t n;
+    if (ra) {
+        if ((n = komparu_reader_file_bytes_read(ra)) > 0) task->bytes_read += (uint64_t)n;
+        ra->close(ra);
+    }
+    if (rb) {
+        if ((n = komparu_reader_file_bytes_read(rb)) > 0) task->bytes_read += (uint64_t)n;
+        rb->close(rb);
+    }
+}
+
 static void dir_cmp_task_exec(void *arg) {
     dir_cmp_task_t *task = (dir_cmp_task_t *)arg;
     task->result_reason = -1;  /* assume equal */
 
     /* Same-file short-circuit via inode comparison */
 #ifndef KOMPARU_WINDOWS
+    if (task->compare_links) {
+        /* Before the inode check: two links to one file may still differ */
+        int r = link_target_cmp(task->full_path_a, task->full_path_b);
+        if (r != -2) {
+            task->result_reason = r;
+            return;
+        }
+    }
     {
+        int (*stat_fn)(const char *, struct stat *) = task->follow_symlinks ? stat : lstat;
         struct stat sa, sb;
-        if (stat(task->full_path_a, &sa) == 0 &&
-            stat(task->full_path_b, &sb) == 0 &&
-            sa.st_dev == sb.st_dev && sa.st_ino == sb.st_ino) {
-            return;  /* same file — equal */
+        if (stat_fn(task->full_path_a, &sa) == 0 &&
+            stat_fn(task->full_path_b, &sb) == 0) {
+            if (sa.st_dev == sb.st_dev && sa.st_ino == sb.st_ino)
+                return;  /* same file — equal */
+            if (S_ISLNK(sa.st_mode) || S_ISLNK(sb.st_mode)) {
+                /* Not following: a link is never read as what it points to */
+                int r = broken_link_cmp(task->full_path_a, task->full_path_b);
+                if (r == -2) r = link_target_cmp(task->full_path_a, task->full_path_b);
+                task->result_reason = r == -2 ? KOMPARU_DIFF_TYPE : r;
+                return;
+            }
+            if (task->special_files) {
+                int r = special_cmp(&sa, &sb);
+                if (r != -2) {
+                    task->result_reason = r;
+                    return;
+                }
+            }
+        } else {
+            int r = task->follow_symlinks
+                ? broken_link_cmp(task->full_path_a, task->full_path_b) : -2;
+            /* Anything else that cannot be stat'ed is not opened either */
+            task->result_reason = r != -2 ? r : KOMPARU_DIFF_READ_ERROR;
+            return;
         }
     }
 #endif
@@ -419,7 +923,7 @@ static void dir_cmp_task_exec(void *arg) {
 
     komparu_reader_t *rb = komparu_reader_file_open(task->full_path_b, &cmp_err);
     if (KOMPARU_UNLIKELY(!rb)) {
-        ra->close(ra);
+        task_close(task, ra, NULL);
         task->result_reason = KOMPARU_DIFF_READ_ERROR;
         return;
     }
@@ -429,8 +933,7 @@ static void dir_cmp_task_exec(void *arg) {
         int64_t sa = ra->get_size(ra);
         int64_t sb = rb->get_size(rb);
         if (sa >= 0 && sb >= 0 && sa != sb) {
-            ra->close(ra);
-            rb->close(rb);
+            task_close(task, ra, rb);
             task->result_reason = KOMPARU_DIFF_SIZE;
             return;
         }
@@ -440,8 +943,7 @@ static void dir_cmp_task_exec(void *arg) {
     if (task->quick_check) {
         komparu_result_t qr = komparu_quick_check(ra, rb, task->chunk_size, &cmp_err);
         if (qr == KOMPARU_DIFFERENT) {
-            ra->close(ra);
-            rb->close(rb);
+            task_close(task, ra, rb);
             task->result_reason = KOMPARU_DIFF_CONTENT;
             return;
         }
@@ -452,8 +954,7 @@ static void dir_cmp_task_exec(void *arg) {
     }
 
     komparu_result_t cr = komparu_compare(ra, rb, task->chunk_size, false, &cmp_err);
-    ra->close(ra);
-    rb->close(rb);
+    task_close(task, ra, rb);
 
     if (cr == KOMPARU_DIFFERENT)
         task->result_reason = KOMPARU_DIFF_CONTENT;
@@ -461,6 +962,52 @@ static void dir_cmp_task_exec(void *arg) {
         task->result_reason = KOMPARU_DIFF_READ_ERROR;
 }
 
+/* The path lock guards only a short copy, so spinning is cheap */
+void komparu_dir_progress_set_path(komparu_dir_progress_t *progress, const char *path) {
+    while (atomic_flag_test_and_set_explicit(&progress->path_lock, memory_order_acquire)) {}
+    snprintf(progress->path, sizeof(progress->path), "%s", path);
+    atomic_flag_clear_explicit(&progress->path_lock, memory_order_release);
+}
+
+void komparu_dir_progress_path(komparu_dir_progress_t *progress, char *buf, size_t cap) {
+    while (atomic_flag_test_and_set_explicit(&progress->path_lock, memory_order_acquire)) {}
+    snprintf(buf, cap, "%s", progress->path);
+    atomic_flag_clear_explicit(&progress->path_lock, memory_order_release);
+}
+
+/* Pool entry point: compare, then count the pair as done */
+static void dir_cmp_task_run(void *arg) {
+    dir_cmp_task_t *task = (dir_cmp_task_t *)arg;
+    uint64_t read = 0;
+    if ((task->stop && atomic_load_explicit(task->stop, memory_order_relaxed)) ||
+        komparu_cancel_state(task->cancel) != KOMPARU_CANCEL_NONE) {
+        task->result_reason = -1;  /* skipped; the whole run is discarded */
+    } else {
+        _Atomic uint64_t *prev_bytes = NULL;
+        if (task->progress) {
+            komparu_dir_progress_set_path(task->progress, task->rel_path);
+            prev_bytes = komparu_progress_bind(&task->progress->bytes_done);
+        }
+        komparu_cancel_t *prev = komparu_cancel_bind(task->cancel);
+        dir_cmp_task_exec(task);
+        komparu_cancel_bind(prev);
+        if (task->progress) {
+            read = komparu_progress_added();
+            komparu_progress_bind(prev_bytes);
+        }
+        if (task->stop && task->result_reason == KOMPARU_DIFF_READ_ERROR)
+            atomic_store_explicit(task->stop, true, memory_order_relaxed);
+    }
+    if (task->progress) {
+        /* Chunks already counted as they were read; top up to the plan */
+        if (read < task->plan_bytes)
+            atomic_fetch_add_explicit(&task->progress->bytes_done,
+                                      task->plan_bytes - read, memory_order_relaxed);
+        atomic_fetch_add_explicit(&task->progress->files_done, 1,
+                                  memory_order_release);
+    }
+}
+
 /* =========================================================================
  * Directory comparison — sorted merge of two directory trees
  * ========================================================================= */
@@ -472,19 +1019,31 @@ komparu_dir_result_t *komparu_compare_dirs(
     bool size_precheck,
     bool quick_check,
     bool follow_symlinks,
+    komparu_link_mode_t links,
+    bool special_files,
+    bool regular_only,
+    bool counts_only,
+    bool list_equal,
+    int max_depth,
+    const komparu_walk_filter_t *filter,
     size_t max_workers,
+    size_t max_memory,
+    bool stop_on_error,
+    bool hardlinks,
+    komparu_dir_progress_t *progress,
     const char **err_msg
 ) {
     /* Same-directory short-circuit: realpath both, compare strings.
      * Catches identical paths, symlinks, and trailing-slash variants. */
     char real_a[PATH_MAX], real_b[PATH_MAX];
-    if (realpath(dir_a, real_a) && realpath(dir_b, real_b) &&
+    if (!list_equal && realpath(dir_a, real_a) && realpath(dir_b, real_b) &&
         strcmp(real_a, real_b) == 0) {
         komparu_dir_result_t *r = komparu_dir_result_new();
         if (KOMPARU_UNLIKELY(!r)) {
             *err_msg = "out of memory";
             return NULL;
         }
+        r->counts_only = counts_only;
         return r;  /* equal=true, empty diff/only_left/only_right */
     }
 
@@ -493,13 +1052,35 @@ komparu_dir_result_t *komparu_compare_dirs(
     komparu_pathlist_t errors_a = {0};
     komparu_pathlist_t errors_b = {0};
 
-    if (komparu_dirwalk(dir_a, follow_symlinks, &paths_a, &errors_a, err_msg) != 0) {
+    /* Dangling links are listed unless links are skipped altogether */
+    bool broken = links != KOMPARU_LINKS_SKIP;
+    if (komparu_dirwalk_ex(dir_a, follow_symlinks, links, special_files, broken,
+                           regular_only, max_depth, filter,
+                           &paths_a, &errors_a, err_msg) != 0) {
         return NULL;
     }
 
-    if (komparu_dirwalk(dir_b, follow_symlinks, &paths_b, &errors_b, err_msg) != 0) {
+    if (komparu_dirwalk_ex(dir_b, follow_symlinks, links, special_files, broken,
+                           regular_only, max_depth, filter,
+                           &paths_b, &errors_b, err_msg) != 0) {
+        komparu_pathlist_free(&paths_a);
+        komparu_pathlist_free(&errors_a);
+        return NULL;
+    }
+
+    if (stop_on_error && (errors_a.count > 0 || errors_b.count > 0)) {
+        /* Walk order is readdir order; report the smallest path */
+        const char *first = NULL;
+        for (size_t k = 0; k < errors_a.count; k++)
+            if (!first || strcmp(errors_a.paths[k], first) < 0) first = errors_a.paths[k];
+        for (size_t k = 0; k < errors_b.count; k++)
+            if (!first || strcmp(errors_b.paths[k], first) < 0) first = errors_b.paths[k];
+        snprintf(dirwalk_errbuf, sizeof(dirwalk_errbuf), "cannot read %s", first);
+        *err_msg = dirwalk_errbuf;
         komparu_pathlist_free(&paths_a);
+        komparu_pathlist_free(&paths_b);
         komparu_pathlist_free(&errors_a);
+        komparu_pathlist_free(&errors_b);
         return NULL;
     }
 
@@ -512,6 +1093,8 @@ komparu_dir_result_t *komparu_compare_dirs(
         komparu_pathlist_free(&errors_b);
         return NULL;
     }
+    result->counts_only = counts_only;
+    result->list_equal = list_equal;
 
     /* Merge permission errors from both walks into the result */
     for (size_t k = 0; k < errors_a.count; k++) {
@@ -541,6 +1124,9 @@ komparu_dir_result_t *komparu_compare_dirs(
 
     if (chunk_size == 0) chunk_size = KOMPARU_DEFAULT_CHUNK_SIZE;
 
+    atomic_bool stop;
+    atomic_init(&stop, false);
+
     /* Phase 1: Sorted merge — identify only_left, only_right, common files */
     dir_cmp_task_t *tasks = NULL;
     size_t task_count = 0;
@@ -599,7 +1185,13 @@ komparu_dir_result_t *komparu_compare_dirs(
             t->chunk_size = chunk_size;
             t->size_precheck = size_precheck;
             t->quick_check = quick_check;
+            t->special_files = special_files;
+            t->follow_symlinks = follow_symlinks;
+            t->compare_links = links == KOMPARU_LINKS_COMPARE;
             t->result_reason = -1;
+            t->progress = progress;
+            t->stop = stop_on_error ? &stop : NULL;
+            t->cancel = komparu_cancel_bound();
 
             task_count++;
             i++; j++;
@@ -622,8 +1214,49 @@ komparu_dir_result_t *komparu_compare_dirs(
         j++;
     }
 
+    /* Pairs repeating the inodes of an earlier pair take its result */
+    size_t linked = 0;
+#ifndef KOMPARU_WINDOWS
+    if (hardlinks && task_count > 1 &&
+        KOMPARU_UNLIKELY(link_pairs_mark(tasks, task_count, links == KOMPARU_LINKS_COMPARE,
+                                         &linked) != 0)) {
+        *err_msg = "out of memory";
+        goto fail;
+    }
+#else
+    (void)hardlinks;
+#endif
+
+    /* Plan: totals for progress reporting */
+    if (progress) {
+        uint64_t bytes_total = 0;
+        for (size_t k = 0; k < task_count; k++) {
+            if (tasks[k].same_as) continue;
+            struct stat sa, sb;
+            uint64_t na = stat(tasks[k].full_path_a, &sa) == 0 ? (uint64_t)sa.st_size : 0;
+            uint64_t nb = stat(tasks[k].full_path_b, &sb) == 0 ? (uint64_t)sb.st_size : 0;
+            tasks[k].plan_bytes = na > nb ? na : nb;
+            bytes_total += tasks[k].plan_bytes;
+        }
+        atomic_store_explicit(&progress->bytes_total, bytes_total, memory_order_relaxed);
+        atomic_store_explicit(&progress->files_total, task_count - linked,
+                              memory_order_release);
+    }
+
     /* Phase 2: Execute file comparisons */
     if (task_count > 0) {
+        /* Memory cap: each active comparison holds two chunk buffers */
+        if (max_memory > 0) {
+            size_t budget = max_memory / (2 * chunk_size);
+            if (budget < 1) budget = 1;
+            if (max_workers == 0) {
+                max_workers = komparu_cpu_count();
+                if (max_workers > KOMPARU_MAX_DEFAULT_WORKERS)
+                    max_workers = KOMPARU_MAX_DEFAULT_WORKERS;
+            }
+            if (max_workers > budget) max_workers = budget;
+        }
+
         bool use_pool = (max_workers != 1 && task_count > 1);
         komparu_pool_t *pool = NULL;
 
@@ -634,12 +1267,14 @@ komparu_dir_result_t *komparu_compare_dirs(
 
         if (pool) {
             for (size_t k = 0; k < task_count; k++) {
-                if (KOMPARU_UNLIKELY(komparu_pool_submit(pool, dir_cmp_task_exec, &tasks[k]) != 0)) {
+                if (atomic_load_explicit(&stop, memory_order_relaxed)) break;
+                if (tasks[k].same_as) continue;
+                if (KOMPARU_UNLIKELY(komparu_pool_submit(pool, dir_cmp_task_run, &tasks[k]) != 0)) {
                     /* Submit failed — execute remaining tasks inline */
                     (void)komparu_pool_wait(pool);
                     komparu_pool_destroy(pool);
                     for (size_t m = k; m < task_count; m++)
-                        dir_cmp_task_exec(&tasks[m]);
+                        if (!tasks[m].same_as) dir_cmp_task_run(&tasks[m]);
                     pool = NULL;
                     break;
                 }
@@ -648,17 +1283,39 @@ komparu_dir_result_t *komparu_compare_dirs(
             komparu_pool_destroy(pool);
         } else {
             for (size_t k = 0; k < task_count; k++) {
-                dir_cmp_task_exec(&tasks[k]);
+                if (!tasks[k].same_as) dir_cmp_task_run(&tasks[k]);
+                if (atomic_load_explicit(&stop, memory_order_relaxed)) break;
             }
         }
 
+        /* Cancelled pairs were skipped or cut short: discard the run */
+        if (komparu_cancel_poll(err_msg)) goto fail;
+
+        if (atomic_load_explicit(&stop, memory_order_relaxed)) {
+            for (size_t k = 0; k < task_count; k++) {
+                if (tasks[k].result_reason == KOMPARU_DIFF_READ_ERROR) {
+                    snprintf(dirwalk_errbuf, sizeof(dirwalk_errbuf),
+                             "cannot read %s", tasks[k].rel_path);
+                    break;
+                }
+            }
+            *err_msg = dirwalk_errbuf;
+            goto fail;
+        }
+
         /* Phase 3: Collect results */
+        result->compared = task_count;
         for (size_t k = 0; k < task_count; k++) {
-            if (tasks[k].result_reason >= 0) {
-                if (KOMPARU_UNLIKELY(komparu_dir_result_add_diff(result, tasks[k].rel_path, tasks[k].result_reason) != 0)) {
+            result->bytes_read += tasks[k].bytes_read;
+            const dir_cmp_task_t *done = tasks[k].same_as ? tasks[k].same_as : &tasks[k];
+            if (done->result_reason >= 0) {
+                if (KOMPARU_UNLIKELY(komparu_dir_result_add_diff(result, tasks[k].rel_path, done->result_reason) != 0)) {
                     *err_msg = "out of memory";
                     goto fail;
                 }
+            } else if (KOMPARU_UNLIKELY(komparu_dir_result_add_same(result, tasks[k].rel_path) != 0)) {
+                *err_msg = "out of memory";
+                goto fail;
             }
         }
     }
@@ -687,6 +1344,170 @@ fail:
     return NULL;
 }
 
+/* =========================================================================
+ * Fail-fast identity check — no result bookkeeping
+ * ========================================================================= */
+
+typedef struct {
+    const char *dir_a;
+    const char *dir_b;
+    const char *rel_path;   /* points into the pathlist arena */
+    size_t chunk_size;
+    bool quick_check;
+    bool follow_symlinks;
+    atomic_bool *differ;    /* shared: set by the first task that finds a diff */
+} ident_task_t;
+
+static void ident_task_exec(void *arg) {
+    ident_task_t *task = (ident_task_t *)arg;
+    if (atomic_load_explicit(task->differ, memory_order_relaxed)) return;
+
+    char path_a[PATH_MAX], path_b[PATH_MAX];
+    int la = snprintf(path_a, sizeof(path_a), "%s/%s", task->dir_a, task->rel_path);
+    int lb = snprintf(path_b, sizeof(path_b), "%s/%s", task->dir_b, task->rel_path);
+    if (KOMPARU_UNLIKELY(la < 0 || (size_t)la >= sizeof(path_a) ||
+                         lb < 0 || (size_t)lb >= sizeof(path_b))) {
+        atomic_store_explicit(task->differ, true, memory_order_relaxed);
+        return;
+    }
+
+    /* Sizes were already checked by the caller */
+    dir_cmp_task_t cmp = {
+        .full_path_a = path_a,
+        .full_path_b = path_b,
+        .rel_path = (char *)task->rel_path,
+        .chunk_size = task->chunk_size,
+        .size_precheck = false,
+        .quick_check = task->quick_check,
+        .follow_symlinks = task->follow_symlinks,
+    };
+    dir_cmp_task_exec(&cmp);
+    if (cmp.result_reason >= 0)
+        atomic_store_explicit(task->differ, true, memory_order_relaxed);
+}
+
+/**
+ * Stat both sides of every common path and compare sizes.
+ * Returns true if all sizes match. Cheap compared to reading content,
+ * so it runs to completion before any file is opened.
+ */
+static bool ident_sizes_match(
+    const char *dir_a, const char *dir_b, const komparu_pathlist_t *paths
+) {
+    char path_a[PATH_MAX], path_b[PATH_MAX];
+    for (size_t k = 0; k < paths->count; k++) {
+        int la = snprintf(path_a, sizeof(path_a), "%s/%s", dir_a, paths->paths[k]);
+        int lb = snprintf(path_b, sizeof(path_b), "%s/%s", dir_b, paths->paths[k]);
+        if (la < 0 || (size_t)la >= sizeof(path_a) ||
+            lb < 0 || (size_t)lb >= sizeof(path_b))
+            return false;
+
+        struct stat sa, sb;
+        if (stat(path_a, &sa) != 0 || stat(path_b, &sb) != 0) return false;
+        if (sa.st_size != sb.st_size) return false;
+    }
+    return true;
+}
+
+int komparu_dirs_identical(
+    const char *dir_a,
+    const char *dir_b,
+    size_t chunk_size,
+    bool quick_check,
+    bool follow_symlinks,
+    size_t max_workers,
+    const char **err_msg
+) {
+    char real_a[PATH_MAX], real_b[PATH_MAX];
+    if (realpath(dir_a, real_a) && realpath(dir_b, real_b) &&
+        strcmp(real_a, real_b) == 0)
+        return 1;
+
+    komparu_pathlist_t paths_a = {0};
+    komparu_pathlist_t paths_b = {0};
+    komparu_pathlist_t errors_a = {0};
+    komparu_pathlist_t errors_b = {0};
+    int rc = 0;
+
+    if (komparu_dirwalk(dir_a, follow_symlinks, &paths_a, &errors_a, err_msg) != 0)
+        return -1;
+    if (komparu_dirwalk(dir_b, follow_symlinks, &paths_b, &errors_b, err_msg) != 0) {
+        rc = -1;
+        goto done;
+    }
+
+    /* Unreadable entries and differing file sets: not identical */
+    if (errors_a.count > 0 || errors_b.count > 0) goto done;
+    if (paths_a.count != paths_b.count) goto done;
+    for (size_t k = 0; k < paths_a.count; k++) {
+        if (strcmp(paths_a.paths[k], paths_b.paths[k]) != 0) goto done;
+    }
+
+    if (!ident_sizes_match(dir_a, dir_b, &paths_a)) goto done;
+
+    size_t count = paths_a.count;
+    if (count == 0) {
+        rc = 1;
+        goto done;
+    }
+    if (chunk_size == 0) chunk_size = KOMPARU_DEFAULT_CHUNK_SIZE;
+
+    ident_task_t *tasks = calloc(count, sizeof(ident_task_t));
+    if (KOMPARU_UNLIKELY(!tasks)) {
+        *err_msg = "out of memory";
+        rc = -1;
+        goto done;
+    }
+
+    atomic_bool differ;
+    atomic_init(&differ, false);
+
+    for (size_t k = 0; k < count; k++) {
+        tasks[k].dir_a = dir_a;
+        tasks[k].dir_b = dir_b;
+        tasks[k].rel_path = paths_a.paths[k];
+        tasks[k].chunk_size = chunk_size;
+        tasks[k].quick_check = quick_check;
+        tasks[k].follow_symlinks = follow_symlinks;
+        tasks[k].differ = &differ;
+    }
+
+    komparu_pool_t *pool = NULL;
+    if (max_workers != 1 && count > 1)
+        pool = komparu_pool_create(max_workers);
+    /* Fall back to sequential if pool creation fails */
+
+    if (pool) {
+        for (size_t k = 0; k < count; k++) {
+            if (atomic_load_explicit(&differ, memory_order_relaxed)) break;
+            if (KOMPARU_UNLIKELY(komparu_pool_submit(pool, ident_task_exec, &tasks[k]) != 0)) {
+                /* Submit failed — check remaining files inline */
+                for (size_t m = k; m < count; m++)
+                    ident_task_exec(&tasks[m]);
+                break;
+            }
+        }
+        /* Queued tasks see the flag and return immediately */
+        (void)komparu_pool_wait(pool);
+        komparu_pool_destroy(pool);
+    } else {
+        for (size_t k = 0; k < count; k++) {
+            ident_task_exec(&tasks[k]);
+            if (atomic_load_explicit(&differ, memory_order_relaxed)) break;
+        }
+    }
+
+    free(tasks);
+    rc = atomic_load(&differ) ? 0 : 1;
+
+done:
+    komparu_pathlist_free(&paths_a);
+    komparu_pathlist_free(&paths_b);
+    komparu_pathlist_free(&errors_a);
+    komparu_pathlist_free(&errors_b);
+    return rc;
+}
+
 /* =========================================================================
  * Directory vs URL map comparison — sorted merge of local tree vs URL set
  * ========================================================================= */
@@ -8,6 +8,7 @@
 #define KOMPARU_DIRWALK_H
 
 #include "compat.h"
+#include <stdatomic.h>
 
 /* Forward declaration */
 struct komparu_dir_result;
@@ -41,6 +42,74 @@ typedef struct {
     komparu_arena_t arena;
 } komparu_pathlist_t;
 
+/**
+ * What a walk does with symbolic links.
+ *
+ * KOMPARU_LINKS_DEFAULT follows them or not as follow_symlinks says; not
+ * following, only dangling links are listed. The other modes never follow:
+ * KOMPARU_LINKS_COMPARE lists every link, to be compared by target string,
+ * and KOMPARU_LINKS_SKIP leaves all links out, dangling ones included.
+ */
+typedef enum {
+    KOMPARU_LINKS_DEFAULT = 0,
+    KOMPARU_LINKS_COMPARE,
+    KOMPARU_LINKS_SKIP,
+} komparu_link_mode_t;
+
+/**
+ * One exclude or include pattern, gitignore-style.
+ *
+ * The glob is stored without its leading and trailing '/'. A pattern
+ * with no '/' but a trailing one matches an entry's name at any depth;
+ * otherwise it is anchored to the walk root and matched against the
+ * whole relative path. '*' and '?' never match '/', "[...]" is a class
+ * ('!' or '^' negates), '\' escapes, and a "**" component matches any
+ * number of directories.
+ */
+typedef struct {
+    char *glob;
+    bool dir_only;  /* pattern ended in '/': directories only */
+    bool anchored;  /* pattern had a '/' before its end */
+} komparu_walk_pattern_t;
+
+/**
+ * Entries to leave out of a walk.
+ *
+ * An entry matching an exclude pattern is skipped; an excluded
+ * directory is not opened at all. With include patterns, a file is
+ * kept only if it, or one of the directories it sits in, matches one of
+ * them. Exclusion wins.
+ */
+typedef struct {
+    komparu_walk_pattern_t *exclude;
+    size_t n_exclude;
+    komparu_walk_pattern_t *include;
+    size_t n_include;
+} komparu_walk_filter_t;
+
+/**
+ * Parse exclude and include patterns into a filter.
+ *
+ * Returns 0 on success, -1 on error (*err_msg set: empty pattern or out
+ * of memory). Free with komparu_walk_filter_free().
+ */
+int komparu_walk_filter_init(
+    komparu_walk_filter_t *filter,
+    const char *const *exclude,
+    size_t n_exclude,
+    const char *const *include,
+    size_t n_include,
+    const char **err_msg
+);
+
+void komparu_walk_filter_free(komparu_walk_filter_t *filter);
+
+/**
+ * Whether a walk with this filter would list rel_path. A trailing '/'
+ * marks a directory, kept unless it (or a parent) is excluded.
+ */
+bool komparu_walk_filter_keeps(const komparu_walk_filter_t *filter, const char *rel_path);
+
 /**
  * Walk a directory recursively and collect all regular file paths.
  *
@@ -61,17 +130,116 @@ int komparu_dirwalk(
     const char **err_msg
 );
 
+/**
+ * Like komparu_dirwalk, but with include_special also lists FIFOs,
+ * sockets and character/block devices alongside regular files.
+ * With include_broken, dangling symlinks are listed too (whether or not
+ * links are followed) instead of being skipped.
+ * With regular_only, any entry that is not a regular file or directory
+ * (symlinks included, even when following) fails the walk; see
+ * komparu_dirwalk_nonregular().
+ * max_depth >= 0 stops descending below that depth (0 = root entries
+ * only); -1 walks the whole tree.
+ * filter, if non-NULL, drops entries and prunes excluded directories
+ * during the walk (see komparu_walk_filter_t).
+ * links picks the symlink policy (see komparu_link_mode_t). Under
+ * regular_only, a link fails the walk unless links is KOMPARU_LINKS_SKIP.
+ */
+int komparu_dirwalk_ex(
+    const char *base_dir,
+    bool follow_symlinks,
+    komparu_link_mode_t links,
+    bool include_special,
+    bool include_broken,
+    bool regular_only,
+    int max_depth,
+    const komparu_walk_filter_t *filter,
+    komparu_pathlist_t *result,
+    komparu_pathlist_t *errors,
+    const char **err_msg
+);
+
+/**
+ * After a walk on this thread failed under regular_only, return the full
+ * path of the offending entry and set *kind ("symlink", "fifo", "socket",
+ * "character device", "block device"). Returns NULL otherwise.
+ */
+const char *komparu_dirwalk_nonregular(const char **kind);
+
 /**
  * Free a path list and all its strings.
  */
 void komparu_pathlist_free(komparu_pathlist_t *list);
 
+/**
+ * Progress counters of one komparu_compare_dirs() run.
+ *
+ * Zero-initialize before the call. The totals are stored once the walks
+ * and the merge are done (the plan); files_done grows as each file pair
+ * finishes and bytes_done as each chunk is read. A finished pair counts
+ * the larger of its two sizes, whether or not the compare read that far,
+ * so bytes_done reaches bytes_total at the end. path holds the relative
+ * path of the pair started last (truncated to fit); read it with
+ * komparu_dir_progress_path(). Safe to read from any thread while the
+ * comparison runs.
+ */
+#define KOMPARU_PROGRESS_PATH_MAX 1024
+
+typedef struct {
+    _Atomic uint64_t files_done;
+    _Atomic uint64_t files_total;
+    _Atomic uint64_t bytes_done;
+    _Atomic uint64_t bytes_total;
+    atomic_flag path_lock;
+    char path[KOMPARU_PROGRESS_PATH_MAX];
+} komparu_dir_progress_t;
+
+/** Store path as the current one in progress (any thread). */
+void komparu_dir_progress_set_path(komparu_dir_progress_t *progress, const char *path);
+
+/** Copy the current path into buf (cap > 0); "" before the first pair. */
+void komparu_dir_progress_path(komparu_dir_progress_t *progress, char *buf, size_t cap);
+
 /**
  * Compare two directories recursively.
  *
  * Walks both directories, merge-compares sorted path lists,
  * opens file readers and uses komparu_compare for each common entry.
  * If max_workers > 1, file comparisons run in parallel.
+ * With special_files, FIFOs, sockets and device nodes are included and
+ * compared by type (and major/minor for devices) instead of content.
+ * Dangling symlinks are listed on each side; two links with the same
+ * target compare equal, anything else is KOMPARU_DIFF_BROKEN_SYMLINK.
+ * With links = KOMPARU_LINKS_COMPARE, every link is compared by its target
+ * string instead: a different target is KOMPARU_DIFF_LINK_TARGET, a link
+ * against anything else KOMPARU_DIFF_TYPE. KOMPARU_LINKS_SKIP leaves links
+ * out of both walks.
+ * With regular_only, a non-regular entry on either side aborts the
+ * comparison (NULL, see komparu_dirwalk_nonregular).
+ * With counts_only, the result holds counts but no paths.
+ * With list_equal, it also lists the common entries that compared equal
+ * (see komparu_dir_result_t.same); two paths naming the same directory
+ * are then walked instead of short-circuited.
+ * max_depth >= 0 limits both walks (see komparu_dirwalk_ex); -1 = unlimited.
+ * filter, if non-NULL, applies to both walks.
+ * max_memory > 0 caps in-flight compare buffers (2 * chunk_size per active
+ * worker) by lowering the worker count, never below one; 0 = no cap.
+ * mmapped file pages are demand-paged and not counted.
+ * progress, if non-NULL, is updated as described above; planning then
+ * costs one extra stat() per common pair.
+ * Unreadable entries are normally listed as errors (walk) or read errors
+ * (diff) while the other pairs are still compared. With stop_on_error,
+ * the first one aborts the comparison instead: pairs not yet started are
+ * skipped, in-flight ones finish, and NULL is returned with *err_msg
+ * naming the first failing path in sorted order among those attempted.
+ * A token bound with komparu_cancel_bind() is checked per directory
+ * walked and per chunk compared, also on pool workers; once it fires,
+ * pairs not yet started are skipped and NULL is returned with *err_msg
+ * "cancelled" or "deadline exceeded".
+ * With hardlinks, a pair of regular files whose two (dev, ino) identities
+ * repeat those of an earlier pair (hard links within each tree, bind
+ * mounts) takes that pair's result instead of being read again; this
+ * costs one extra stat() per common pair. Ignored on Windows.
  *
  * Returns allocated dir_result_t on success, NULL on error.
  * Caller must free with komparu_dir_result_free().
@@ -83,6 +251,36 @@ komparu_dir_result_t *komparu_compare_dirs(
     bool size_precheck,
     bool quick_check,
     bool follow_symlinks,
+    komparu_link_mode_t links,
+    bool special_files,
+    bool regular_only,
+    bool counts_only,
+    bool list_equal,
+    int max_depth,
+    const komparu_walk_filter_t *filter,
+    size_t max_workers,
+    size_t max_memory,
+    bool stop_on_error,
+    bool hardlinks,
+    komparu_dir_progress_t *progress,
+    const char **err_msg
+);
+
+/**
+ * Check whether two directory trees are identical, failing fast.
+ *
+ * Stops at the first difference: differing file sets, then any size
+ * mismatch (stat only), then the first content difference. No diff
+ * report is built. Unreadable entries count as a difference.
+ *
+ * Returns 1 if identical, 0 if not, -1 on error (*err_msg set).
+ */
+int komparu_dirs_identical(
+    const char *dir_a,
+    const char *dir_b,
+    size_t chunk_size,
+    bool quick_check,
+    bool follow_symlinks,
     size_t max_workers,
     const char **err_msg
 );
@@ -0,0 +1,231 @@
+/**
+ * hashdir.c — Parallel content hashing of a directory tree.
+ *
+ * Phase 1: komparu_dirwalk collects sorted relative paths.
+ * Phase 2: one task per file is submitted to a bounded pool. Each task
+ *          writes its digest into its own preallocated slot, so results
+ *          need no locking and come out in sorted path order.
+ * Errors:  the first failure (lowest path index) wins, guarded by a
+ *          mutex. Tasks past the current lowest failure are skipped —
+ *          they cannot change the reported error.
+ */
+
+#include "hashdir.h"
+#include "pool.h"
+#include <stdlib.h>
+#include <string.h>
+#include <stdatomic.h>
+
+static _Thread_local char hashdir_errbuf[512];
+
+/* =========================================================================
+ * Shared error state
+ * ========================================================================= */
+
+typedef struct {
+#ifdef KOMPARU_WINDOWS
+    SRWLOCK lock;
+#else
+    pthread_mutex_t lock;
+#endif
+    _Atomic size_t first_index;  /* SIZE_MAX = no error */
+    char message[512];
+} hash_error_t;
+
+static void hash_error_init(hash_error_t *e) {
+#ifdef KOMPARU_WINDOWS
+    InitializeSRWLock(&e->lock);
+#else
+    pthread_mutex_init(&e->lock, NULL);
+#endif
+    atomic_init(&e->first_index, SIZE_MAX);
+    e->message[0] = '\0';
+}
+
+static void hash_error_destroy(hash_error_t *e) {
+#ifndef KOMPARU_WINDOWS
+    pthread_mutex_destroy(&e->lock);
+#else
+    (void)e;
+#endif
+}
+
+static void hash_error_record(
+    hash_error_t *e, size_t index, const char *path, const char *reason
+) {
+#ifdef KOMPARU_WINDOWS
+    AcquireSRWLockExclusive(&e->lock);
+#else
+    pthread_mutex_lock(&e->lock);
+#endif
+    if (index < atomic_load_explicit(&e->first_index, memory_order_relaxed)) {
+        snprintf(e->message, sizeof(e->message), "cannot hash '%s': %s",
+                 path, reason ? reason : "unknown error");
+        atomic_store_explicit(&e->first_index, index, memory_order_release);
+    }
+#ifdef KOMPARU_WINDOWS
+    ReleaseSRWLockExclusive(&e->lock);
+#else
+    pthread_mutex_unlock(&e->lock);
+#endif
+}
+
+/* =========================================================================
+ * Per-file hash task
+ * ========================================================================= */
+
+typedef struct {
+    const char *base_dir;
+    const char *rel_path;   /* points into the pathlist arena */
+    size_t index;
+    size_t chunk_size;
+    uint8_t *digest;        /* slot in the result array */
+    hash_error_t *error;
+} hash_task_t;
+
+static void hash_task_exec(void *arg) {
+    hash_task_t *task = (hash_task_t *)arg;
+
+    if (atomic_load_explicit(&task->error->first_index, memory_order_acquire)
+            < task->index)
+        return;
+
+    char full_path[PATH_MAX];
+    int n = snprintf(full_path, sizeof(full_path), "%s/%s",
+                     task->base_dir, task->rel_path);
+    if (KOMPARU_UNLIKELY(n < 0 || (size_t)n >= sizeof(full_path))) {
+        hash_error_record(task->error, task->index, task->rel_path,
+                          "path too long");
+        return;
+    }
+
+    const char *err = NULL;
+    komparu_reader_t *reader = komparu_reader_file_open(full_path, &err);
+    if (KOMPARU_UNLIKELY(!reader)) {
+        hash_error_record(task->error, task->index, task->rel_path, err);
+        return;
+    }
+
+    if (KOMPARU_UNLIKELY(komparu_sha256_reader(
+            reader, task->chunk_size, task->digest, &err) != 0)) {
+        hash_error_record(task->error, task->index, task->rel_path, err);
+    }
+    reader->close(reader);
+}
+
+/* =========================================================================
+ * Public API
+ * ========================================================================= */
+
+int komparu_hash_files(
+    const char *base_dir,
+    char *const *rel_paths,
+    size_t count,
+    size_t chunk_size,
+    size_t max_workers,
+    uint8_t (*digests)[KOMPARU_SHA256_LEN],
+    const char **err_msg
+) {
+    if (count == 0) return 0;
+    if (chunk_size == 0) chunk_size = KOMPARU_DEFAULT_CHUNK_SIZE;
+
+    hash_task_t *tasks = calloc(count, sizeof(hash_task_t));
+    if (KOMPARU_UNLIKELY(!tasks)) {
+        *err_msg = "out of memory";
+        return -1;
+    }
+
+    hash_error_t error;
+    hash_error_init(&error);
+
+    for (size_t k = 0; k < count; k++) {
+        tasks[k].base_dir = base_dir;
+        tasks[k].rel_path = rel_paths[k];
+        tasks[k].index = k;
+        tasks[k].chunk_size = chunk_size;
+        tasks[k].digest = digests[k];
+        tasks[k].error = &error;
+    }
+
+    komparu_pool_t *pool = NULL;
+    if (max_workers != 1 && count > 1)
+        pool = komparu_pool_create(max_workers);
+    /* Fall back to sequential if pool creation fails */
+
+    if (pool) {
+        for (size_t k = 0; k < count; k++) {
+            if (KOMPARU_UNLIKELY(komparu_pool_submit(pool, hash_task_exec, &tasks[k]) != 0)) {
+                /* Submit failed — hash remaining files inline */
+                for (size_t m = k; m < count; m++)
+                    hash_task_exec(&tasks[m]);
+                break;
+            }
+        }
+        /* Let in-flight workers finish before inspecting results */
+        (void)komparu_pool_wait(pool);
+        komparu_pool_destroy(pool);
+    } else {
+        for (size_t k = 0; k < count; k++)
+            hash_task_exec(&tasks[k]);
+    }
+
+    free(tasks);
+
+    int rc = 0;
+    if (atomic_load_explicit(&error.first_index, memory_order_acquire) != SIZE_MAX) {
+        memcpy(hashdir_errbuf, error.message, sizeof(hashdir_errbuf));
+        *err_msg = hashdir_errbuf;
+        rc = -1;
+    }
+    hash_error_destroy(&error);
+    return rc;
+}
+
+int komparu_hash_dir(
+    const char *base_dir,
+    bool follow_symlinks,
+    size_t chunk_size,
+    size_t max_workers,
+    komparu_hash_list_t *out,
+    const char **err_msg
+) {
+    memset(out, 0, sizeof(*out));
+
+    komparu_pathlist_t errors = {0};
+    if (komparu_dirwalk(base_dir, follow_symlinks, &out->paths, &errors, err_msg) != 0)
+        return -1;
+
+    if (errors.count > 0) {
+        snprintf(hashdir_errbuf, sizeof(hashdir_errbuf),
+                 "cannot hash '%s': permission denied", errors.paths[0]);
+        *err_msg = hashdir_errbuf;
+        komparu_pathlist_free(&errors);
+        komparu_pathlist_free(&out->paths);
+        return -1;
+    }
+    komparu_pathlist_free(&errors);
+
+    size_t count = out->paths.count;
+    if (count == 0) return 0;
+
+    out->digests = calloc(count, KOMPARU_SHA256_LEN);
+    if (KOMPARU_UNLIKELY(!out->digests)) {
+        komparu_hash_list_free(out);
+        *err_msg = "out of memory";
+        return -1;
+    }
+
+    if (komparu_hash_files(base_dir, out->paths.paths, count, chunk_size,
+                           max_workers, out->digests, err_msg) != 0) {
+        komparu_hash_list_free(out);
+        return -1;
+    }
+    return 0;
+}
+
+void komparu_hash_list_free(komparu_hash_list_t *list) {
+    if (!list) return;
+    komparu_pathlist_free(&list->paths);
+    free(list->digests);
+    list->digests = NULL;
+}
@@ -0,0 +1,64 @@
+/**
+ * hashdir.h — Parallel content hashing of a directory tree.
+ *
+ * Walks a directory with komparu_dirwalk and computes a SHA-256 digest
+ * of every regular file on a bounded thread pool.
+ */
+
+#ifndef KOMPARU_HASHDIR_H
+#define KOMPARU_HASHDIR_H
+
+#include "compat.h"
+#include "dirwalk.h"
+#include "digest.h"
+
+/**
+ * Hash list — sorted relative paths with parallel digest array.
+ * digests[i] is the SHA-256 of paths.paths[i].
+ */
+typedef struct {
+    komparu_pathlist_t paths;
+    uint8_t (*digests)[KOMPARU_SHA256_LEN];
+} komparu_hash_list_t;
+
+/**
+ * Hash every regular file under base_dir.
+ *
+ * max_workers: pool size (0 = auto, 1 = sequential).
+ * On a hash error (unreadable file, permission denied during the walk)
+ * returns -1 once all in-flight workers have finished. The reported
+ * error is the one for the first failing path in sorted order, so the
+ * message is deterministic regardless of scheduling.
+ *
+ * Returns 0 on success (caller frees with komparu_hash_list_free).
+ */
+int komparu_hash_dir(
+    const char *base_dir,
+    bool follow_symlinks,
+    size_t chunk_size,
+    size_t max_workers,
+    komparu_hash_list_t *out,
+    const char **err_msg
+);
+
+/**
+ * Hash an explicit list of files, each given relative to base_dir.
+ *
+ * digests must hold `count` entries; digests[i] receives the SHA-256 of
+ * rel_paths[i]. Error reporting follows komparu_hash_dir (first failing
+ * index wins). Returns 0 on success, -1 on error (*err_msg set).
+ */
+int komparu_hash_files(
+    const char *base_dir,
+    char *const *rel_paths,
+    size_t count,
+    size_t chunk_size,
+    size_t max_workers,
+    uint8_t (*digests)[KOMPARU_SHA256_LEN],
+    const char **err_msg
+);
+
+/** Free a hash list. */
+void komparu_hash_list_free(komparu_hash_list_t *list);
+
+#endif /* KOMPARU_HASHDIR_H */
@@ -9,13 +9,17 @@
 #include "module.h"
 #include "compare.h"
 #include "reader_file.h"
+#include "uring.h"
 #include "reader_http.h"
 #include "curl_share.h"
 #include "dirwalk.h"
 #include "reader_archive.h"
 #include "async_task.h"
+#include "hashdir.h"
+#include "blocksum.h"
 #include <string.h>
 #include <stdlib.h>
+#include <stdatomic.h>
 
 /* =========================================================================
  * URL detection — check if source is an HTTP(S) URL
@@ -102,6 +106,11 @@ static komparu_reader_t *open_reader(
     int verify_ssl,
     int allow_private,
     const char *proxy,
+    bool huge_pages,
+    bool block_devices,         /* also open block devices, full extent */
+    unsigned strategy,          /* 0, KOMPARU_FILE_MMAP or KOMPARU_FILE_BUFFERED */
+    unsigned uring_depth,       /* > 0: read local files via io_uring */
+    size_t prefetch_block,      /* > 0: read local files via the prefetch thread */
     const char **err_msg
 ) {
     if (is_url(source)) {
@@ -114,7 +123,205 @@ static komparu_reader_t *open_reader(
     }
 
     /* Local file */
-    return komparu_reader_file_open(source, err_msg);
+    unsigned flags = (huge_pages ? KOMPARU_FILE_HUGE_PAGES : 0u) |
+                     (block_devices ? KOMPARU_FILE_BLOCK_DEVICES : 0u) | strategy;
+    if (uring_depth > 0) {
+        return komparu_reader_file_open_uring(source, uring_depth, flags, err_msg);
+    }
+    if (prefetch_block > 0) {
+        return komparu_reader_file_open_prefetch(source, prefetch_block, flags, err_msg);
+    }
+    return komparu_reader_file_open_ex(source, flags, err_msg);
+}
+
+/*
+ * Map a strategy name to open_reader() arguments. "prefetch" reads ahead
+ * in blocks of `chunk_size`. Returns 0, or -1 with ValueError set.
+ */
+static int parse_strategy(const char *strategy, size_t chunk_size,
+                          unsigned *flags, size_t *prefetch_block) {
+    *flags = 0;
+    *prefetch_block = 0;
+    if (!strategy || strcmp(strategy, "auto") == 0) {
+        return 0;
+    } else if (strcmp(strategy, "mmap") == 0) {
+        *flags = KOMPARU_FILE_MMAP;
+    } else if (strcmp(strategy, "buffered") == 0) {
+        *flags = KOMPARU_FILE_BUFFERED;
+    } else if (strcmp(strategy, "prefetch") == 0) {
+        *prefetch_block = chunk_size;
+    } else {
+        PyErr_Format(PyExc_ValueError,
+                     "strategy must be 'auto', 'mmap', 'buffered' or 'prefetch', not '%s'",
+                     strategy);
+        return -1;
+    }
+    return 0;
+}
+
+/* =========================================================================
+ * Raise a komparu exception type (komparu._types.<name>) with a message.
+ * Falls back to ValueError if the Python package is not importable.
+ * Must be called with GIL held.
+ * ========================================================================= */
+
+static void raise_komparu_error(const char *type_name, const char *message) {
+    PyObject *mod = PyImport_ImportModule("komparu._types");
+    PyObject *exc = mod ? PyObject_GetAttrString(mod, type_name) : NULL;
+    Py_XDECREF(mod);
+    if (!exc) {
+        PyErr_Clear();
+        PyErr_SetString(PyExc_ValueError, message);
+        return;
+    }
+    PyErr_SetString(exc, message);
+    Py_DECREF(exc);
+}
+
+/*
+ * Raise the error for a local file that could not be opened:
+ * IsADirectoryError for a directory, FileNotFoundError otherwise.
+ */
+static void raise_open_error(const char *path, const char *err_msg) {
+    bool is_dir = err_msg && strcmp(err_msg, KOMPARU_ERR_IS_DIRECTORY) == 0;
+    PyErr_Format(is_dir ? PyExc_IsADirectoryError : PyExc_FileNotFoundError,
+                 "cannot open '%s': %s", path, err_msg ? err_msg : "unknown error");
+}
+
+/* Raise komparu._types.NonRegularFileError(path, kind) */
+static void raise_nonregular_error(const char *path, const char *kind) {
+    PyObject *mod = PyImport_ImportModule("komparu._types");
+    PyObject *exc = mod ? PyObject_GetAttrString(mod, "NonRegularFileError") : NULL;
+    Py_XDECREF(mod);
+    if (!exc) return;
+    PyObject *inst = PyObject_CallFunction(exc, "ss", path, kind);
+    Py_DECREF(exc);
+    if (!inst) return;
+    PyErr_SetObject((PyObject *)Py_TYPE(inst), inst);
+    Py_DECREF(inst);
+}
+
+/* komparu_cancel_t of a cancel_new() capsule into *out; None gives NULL */
+static int cancel_from_py(PyObject *obj, komparu_cancel_t **out) {
+    *out = NULL;
+    if (obj == Py_None) return 0;
+    *out = PyCapsule_GetPointer(obj, "komparu.cancel");
+    return *out ? 0 : -1;
+}
+
+/* Raise CancelledError or ComparisonTimeoutError if the token has fired */
+static bool raise_if_cancelled(komparu_cancel_t *cancel) {
+    switch (komparu_cancel_state(cancel)) {
+        case KOMPARU_CANCEL_REQUESTED:
+            raise_komparu_error("CancelledError", "comparison cancelled");
+            return true;
+        case KOMPARU_CANCEL_DEADLINE:
+            raise_komparu_error("ComparisonTimeoutError", "comparison deadline exceeded");
+            return true;
+        default:
+            return false;
+    }
+}
+
+/* =========================================================================
+ * Build per-source transforms from compare() keyword arguments.
+ * byte_map applies to both sources unless byte_map_b is given for B.
+ * Returns 0 on success, -1 with a Python exception set.
+ * ========================================================================= */
+
+static int parse_transforms(
+    long long header_skip,
+    long long footer_skip,
+    long long length,
+    bool decompress,
+    bool collapse_zeros,
+    const char *byte_map,
+    Py_ssize_t byte_map_len,
+    const char *byte_map_b,
+    Py_ssize_t byte_map_b_len,
+    const char *decode_a,
+    const char *decode_b,
+    komparu_transform_t *ta,
+    komparu_transform_t *tb
+) {
+    if (header_skip < 0 || footer_skip < 0) {
+        PyErr_SetString(PyExc_ValueError,
+                        "header_skip and footer_skip must be non-negative");
+        return -1;
+    }
+    if ((byte_map && byte_map_len != 256) || (byte_map_b && byte_map_b_len != 256)) {
+        PyErr_SetString(PyExc_ValueError, "byte_map must be 256 bytes");
+        return -1;
+    }
+
+    memset(ta, 0, sizeof(*ta));
+    ta->header_skip = header_skip;
+    ta->footer_skip = footer_skip;
+    ta->has_length = length >= 0;
+    ta->length = length;
+    ta->decompress = decompress;
+    ta->collapse_zeros = collapse_zeros;
+    if (byte_map) {
+        ta->has_byte_map = true;
+        memcpy(ta->byte_map, byte_map, sizeof(ta->byte_map));
+    }
+    *tb = *ta;
+    if (byte_map_b) {
+        tb->has_byte_map = true;
+        memcpy(tb->byte_map, byte_map_b, sizeof(tb->byte_map));
+    }
+
+    if (komparu_decode_parse(decode_a, &ta->decode) != 0 ||
+        komparu_decode_parse(decode_b, &tb->decode) != 0) {
+        PyErr_SetString(PyExc_ValueError,
+                        "decode must be 'none', 'base64' or 'hex'");
+        return -1;
+    }
+    return 0;
+}
+
+/* =========================================================================
+ * Detailed result: (equal, reason, first_diff_offset, size_a, size_b,
+ *                   io_a, io_b). Fields that do not apply are None;
+ * io_* is (path, fallback, huge_pages) for local file readers.
+ * ========================================================================= */
+
+static const char *diff_reason_str(int reason);
+
+static PyObject *offset_or_none(int64_t v) {
+    if (v < 0) Py_RETURN_NONE;
+    return PyLong_FromLongLong((long long)v);
+}
+
+static PyObject *io_info_to_python(bool known, const komparu_io_info_t *io) {
+    if (!known) Py_RETURN_NONE;
+    return Py_BuildValue("(sss)",
+        io->path == KOMPARU_IO_MMAP ? "mmap"
+            : io->path == KOMPARU_IO_URING ? "io_uring"
+            : io->path == KOMPARU_IO_PREFETCH ? "prefetch" : "read",
+        komparu_io_fallback_str(io->fallback),
+        komparu_huge_pages_str(io->huge));
+}
+
+static PyObject *detail_to_python(komparu_result_t result,
+                                  const komparu_compare_info_t *info,
+                                  bool io_a_known, const komparu_io_info_t *io_a,
+                                  bool io_b_known, const komparu_io_info_t *io_b) {
+    PyObject *reason;
+    if (info->reason >= 0) {
+        reason = PyUnicode_FromString(diff_reason_str(info->reason));
+        if (!reason) return NULL;
+    } else {
+        reason = Py_NewRef(Py_None);
+    }
+    return Py_BuildValue("(ONNNNNN)",
+        result == KOMPARU_EQUAL ? Py_True : Py_False,
+        reason,
+        offset_or_none(info->first_diff),
+        offset_or_none(info->size_a),
+        offset_or_none(info->size_b),
+        io_info_to_python(io_a_known, io_a),
+        io_info_to_python(io_b_known, io_b));
 }
 
 /* =========================================================================
@@ -135,24 +342,75 @@ static PyObject *py_compare(PyObject *self, PyObject *args, PyObject *kwargs) {
     int verify_ssl = 1;
     int allow_private = 0;
     const char *proxy = NULL;
+    long long header_skip = 0;
+    long long footer_skip = 0;
+    const char *decode_a = NULL;
+    const char *decode_b = NULL;
+    long long length = -1;
+    int decompress = 0;
+    int collapse_zero_runs = 0;
+    const char *byte_map = NULL;
+    Py_ssize_t byte_map_len = 0;
+    const char *byte_map_b = NULL;
+    Py_ssize_t byte_map_b_len = 0;
+    int huge_pages = 0;
+    int io_uring_depth = 0;
+    int detail = 0;
+    int block_devices = 0;
+    const char *strategy = NULL;
+    PyObject *py_cancel = Py_None;
+    PyObject *py_progress = Py_None;
 
     static char *kwlist[] = {
         "source_a", "source_b", "chunk_size", "size_precheck", "quick_check",
         "headers", "timeout", "follow_redirects", "verify_ssl", "allow_private",
-        "proxy", NULL
+        "proxy", "header_skip", "footer_skip", "decode_a", "decode_b",
+        "length", "decompress", "collapse_zero_runs", "byte_map",
+        "huge_pages", "io_uring_depth", "detail", "block_devices", "byte_map_b",
+        "strategy", "cancel", "progress", NULL
     };
 
-    if (!PyArg_ParseTupleAndKeywords(args, kwargs, "ss|nppOdpppz", kwlist,
+    if (!PyArg_ParseTupleAndKeywords(args, kwargs, "ss|nppOdpppzLLzzLppz#pippz#zOO", kwlist,
             &source_a, &source_b, &chunk_size, &size_precheck, &quick_check,
             &py_headers, &timeout, &follow_redirects, &verify_ssl,
-            &allow_private, &proxy)) {
+            &allow_private, &proxy, &header_skip, &footer_skip,
+            &decode_a, &decode_b, &length, &decompress, &collapse_zero_runs,
+            &byte_map, &byte_map_len, &huge_pages, &io_uring_depth, &detail,
+            &block_devices, &byte_map_b, &byte_map_b_len, &strategy, &py_cancel,
+            &py_progress)) {
         return NULL;
     }
 
+    /* The caller keeps the capsules alive for the duration of the call */
+    komparu_cancel_t *cancel;
+    if (cancel_from_py(py_cancel, &cancel) != 0) return NULL;
+    komparu_dir_progress_t *progress = NULL;
+    if (py_progress != Py_None) {
+        progress = PyCapsule_GetPointer(py_progress, "komparu.dir_progress");
+        if (!progress) return NULL;
+    }
+
     if (chunk_size <= 0) {
         PyErr_SetString(PyExc_ValueError, "chunk_size must be positive");
         return NULL;
     }
+    if (io_uring_depth < 0 || io_uring_depth > KOMPARU_URING_MAX_DEPTH) {
+        PyErr_Format(PyExc_ValueError, "io_uring_depth must be between 1 and %d",
+                     KOMPARU_URING_MAX_DEPTH);
+        return NULL;
+    }
+    unsigned strategy_flags = 0;
+    size_t prefetch_block = 0;
+    if (parse_strategy(strategy, (size_t)chunk_size, &strategy_flags, &prefetch_block) != 0) {
+        return NULL;
+    }
+
+    komparu_transform_t transform_a, transform_b;
+    if (parse_transforms(header_skip, footer_skip, length, (bool)decompress,
+                         (bool)collapse_zero_runs, byte_map, byte_map_len,
+                         byte_map_b, byte_map_b_len, decode_a, decode_b, &transform_a, &transform_b) != 0) {
+        return NULL;
+    }
 
     /* Validate headers type */
     if (py_headers != Py_None && !PyDict_Check(py_headers)) {
@@ -194,38 +452,84 @@ static PyObject *py_compare(PyObject *self, PyObject *args, PyObject *kwargs) {
     komparu_result_t result;
     komparu_reader_t *reader_a = NULL;
     komparu_reader_t *reader_b = NULL;
+    char decode_errbuf[512];
+    bool decode_failed = false;
+    komparu_compare_info_t info = {
+        .reason = -1, .first_diff = -1, .size_a = -1, .size_b = -1,
+    };
+    komparu_io_info_t io_a = {0}, io_b = {0};
+    bool io_a_known = false, io_b_known = false;
 
     KOMPARU_GIL_STATE_DECL
     KOMPARU_GIL_RELEASE()
+    komparu_cancel_t *prev_cancel = komparu_cancel_bind(cancel);
+    _Atomic uint64_t *prev_bytes = progress ? komparu_progress_bind(&progress->bytes_done) : NULL;
 
     /* Same-file short-circuit: if both are local files with same (dev, ino),
      * they are identical — no I/O needed. Covers same path, hard links,
      * symlinks to same target. */
 #ifndef KOMPARU_WINDOWS
-    if (!src_a_is_url && !src_b_is_url) {
+    if (!src_a_is_url && !src_b_is_url && !transform_a.decompress &&
+        !transform_a.collapse_zeros &&
+        transform_a.decode == KOMPARU_DECODE_NONE &&
+        transform_b.decode == KOMPARU_DECODE_NONE) {
         struct stat st_a, st_b;
         if (stat(src_a, &st_a) == 0 && stat(src_b, &st_b) == 0 &&
-            st_a.st_dev == st_b.st_dev && st_a.st_ino == st_b.st_ino) {
-            free_header_array(header_array, header_count);
-            free(proxy_copy);
-            KOMPARU_GIL_ACQUIRE()
-            free(src_a);
-            free(src_b);
-            Py_RETURN_TRUE;
+            st_a.st_dev == st_b.st_dev && st_a.st_ino == st_b.st_ino &&
+            !(block_devices && S_ISBLK(st_a.st_mode))) {  /* st_size is 0 */
+            int64_t body = (int64_t)st_a.st_size - header_skip - footer_skip;
+            if (body < 0) body = 0;
+            if (length >= 0 && body > length) body = length;
+            info.size_a = info.size_b = body;
+            result = KOMPARU_EQUAL;
+            goto done;
         }
     }
 #endif
 
     reader_a = open_reader(
-        src_a, header_array, timeout, follow_redirects, verify_ssl, allow_private, proxy_copy, &err_msg
+        src_a, header_array, timeout, follow_redirects, verify_ssl, allow_private, proxy_copy,
+        (bool)huge_pages, (bool)block_devices, strategy_flags, (unsigned)io_uring_depth,
+        prefetch_block, &err_msg
     );
     if (!reader_a) goto open_failed;
 
     reader_b = open_reader(
-        src_b, header_array, timeout, follow_redirects, verify_ssl, allow_private, proxy_copy, &err_msg
+        src_b, header_array, timeout, follow_redirects, verify_ssl, allow_private, proxy_copy,
+        (bool)huge_pages, (bool)block_devices, strategy_flags, (unsigned)io_uring_depth,
+        prefetch_block, &err_msg
     );
     if (!reader_b) goto open_failed;
 
+    /* I/O path of the raw readers, before transforms wrap them */
+    io_a_known = komparu_reader_file_io(reader_a, &io_a) == 0;
+    io_b_known = komparu_reader_file_io(reader_b, &io_b) == 0;
+
+    /* Header/footer skip and decoding, layered over the raw readers */
+    if (komparu_reader_apply_transform(&reader_a, &transform_a, &err_msg) != 0 ||
+        komparu_reader_apply_transform(&reader_b, &transform_b, &err_msg) != 0) {
+        result = KOMPARU_ERROR;
+        goto done;
+    }
+
+    /* One pair of the larger size, as a directory plan counts it */
+    if (progress) {
+        int64_t size_a = reader_a->get_size(reader_a);
+        int64_t size_b = reader_b->get_size(reader_b);
+        int64_t larger = size_a > size_b ? size_a : size_b;
+        atomic_store_explicit(&progress->bytes_total, larger > 0 ? (uint64_t)larger : 0,
+                              memory_order_relaxed);
+        atomic_store_explicit(&progress->files_total, 1, memory_order_release);
+    }
+
+    /* Detailed mode scans sequentially so the first difference is exact */
+    if (detail) {
+        result = komparu_compare_detailed(reader_a, reader_b,
+                                          (size_t)chunk_size, (bool)size_precheck,
+                                          &info, &err_msg);
+        goto done;
+    }
+
     /* Optional quick check */
     if (quick_check) {
         result = komparu_quick_check(reader_a, reader_b,
@@ -250,12 +554,35 @@ open_failed:
     result = KOMPARU_ERROR;
 
 done:
+    /* Invalid encoded input is reported separately from I/O errors */
+    if (result == KOMPARU_ERROR) {
+        const char *dec_err = komparu_reader_decode_error(reader_a);
+        if (!dec_err) dec_err = komparu_reader_decode_error(reader_b);
+        if (dec_err) {
+            snprintf(decode_errbuf, sizeof(decode_errbuf), "%s: %s",
+                     komparu_reader_decode_error(reader_a) ? src_a : src_b,
+                     dec_err);
+            decode_failed = true;
+        }
+    }
+
     /* Close readers before re-acquiring GIL — close() is pure C
      * (munmap, close(fd), curl_easy_cleanup) and can be slow for HTTP. */
     if (reader_a) reader_a->close(reader_a);
     if (reader_b) reader_b->close(reader_b);
     free_header_array(header_array, header_count);
     free(proxy_copy);
+    komparu_cancel_bind(prev_cancel);
+    if (progress) {
+        komparu_progress_bind(prev_bytes);
+        if (result != KOMPARU_ERROR) {
+            uint64_t total = atomic_load_explicit(&progress->bytes_total, memory_order_relaxed);
+            if (atomic_load_explicit(&progress->bytes_done, memory_order_relaxed) < total)
+                atomic_store_explicit(&progress->bytes_done, total, memory_order_relaxed);
+            atomic_store_explicit(&progress->files_total, 1, memory_order_relaxed);
+            atomic_store_explicit(&progress->files_done, 1, memory_order_release);
+        }
+    }
 
     KOMPARU_GIL_ACQUIRE()
 
@@ -266,6 +593,13 @@ done:
         return NULL;
     }
 
+    if (detail && result != KOMPARU_ERROR) {
+        free(src_a);
+        free(src_b);
+        return detail_to_python(result, &info,
+                                io_a_known, &io_a, io_b_known, &io_b);
+    }
+
     /* Convert result to Python */
     switch (result) {
         case KOMPARU_EQUAL:
@@ -277,21 +611,23 @@ done:
             free(src_b);
             Py_RETURN_FALSE;
         case KOMPARU_ERROR:
-            if (!reader_a) {
+            if (decode_failed) {
+                raise_komparu_error("DecodeError", decode_errbuf);
+            } else if (raise_if_cancelled(cancel)) {
+                /* raised */
+            } else if (!reader_a) {
                 if (src_a_is_url) {
                     PyErr_Format(PyExc_IOError, "cannot open '%s': %s",
                                  src_a, err_msg ? err_msg : "unknown error");
                 } else {
-                    PyErr_Format(PyExc_FileNotFoundError, "cannot open '%s': %s",
-                                 src_a, err_msg ? err_msg : "unknown error");
+                    raise_open_error(src_a, err_msg);
                 }
             } else if (!reader_b) {
                 if (src_b_is_url) {
                     PyErr_Format(PyExc_IOError, "cannot open '%s': %s",
                                  src_b, err_msg ? err_msg : "unknown error");
                 } else {
-                    PyErr_Format(PyExc_FileNotFoundError, "cannot open '%s': %s",
-                                 src_b, err_msg ? err_msg : "unknown error");
+                    raise_open_error(src_b, err_msg);
                 }
             } else {
                 PyErr_Format(PyExc_IOError, "comparison error: %s",
@@ -318,10 +654,26 @@ static const char *diff_reason_str(int reason) {
         case KOMPARU_DIFF_CONTENT: return "content_mismatch";
         case KOMPARU_DIFF_SIZE:    return "size_mismatch";
         case KOMPARU_DIFF_READ_ERROR: return "read_error";
+        case KOMPARU_DIFF_TYPE:    return "type_mismatch";
+        case KOMPARU_DIFF_BROKEN_SYMLINK: return "broken_symlink";
+        case KOMPARU_DIFF_LINK_TARGET: return "link_target_mismatch";
         default: return "unknown";
     }
 }
 
+/* Counts-only result: dict of equal plus integer tallies, no paths */
+static PyObject *dir_summary_to_python(komparu_dir_result_t *r) {
+    return Py_BuildValue(
+        "{s:O,s:n,s:n,s:n,s:n,s:n,s:K}",
+        "equal", r->equal ? Py_True : Py_False,
+        "compared", (Py_ssize_t)r->compared,
+        "differing", (Py_ssize_t)r->diff_count,
+        "only_left", (Py_ssize_t)r->only_left_count,
+        "only_right", (Py_ssize_t)r->only_right_count,
+        "errors", (Py_ssize_t)r->error_count,
+        "bytes_read", (unsigned long long)r->bytes_read);
+}
+
 static PyObject *dir_result_to_python(komparu_dir_result_t *r) {
     PyObject *dict = PyDict_New();
     if (!dict) return NULL;
@@ -413,6 +765,26 @@ static PyObject *dir_result_to_python(komparu_dir_result_t *r) {
         Py_DECREF(err_set);
     }
 
+    /* same: set[str] — common entries that compared equal, on request */
+    if (r->list_equal) {
+        PyObject *same = PySet_New(NULL);
+        if (!same) goto fail;
+        for (size_t i = 0; i < r->same_count; i++) {
+            PyObject *s = PyUnicode_FromString(r->same[i]);
+            if (!s || PySet_Add(same, s) < 0) {
+                Py_XDECREF(s);
+                Py_DECREF(same);
+                goto fail;
+            }
+            Py_DECREF(s);
+        }
+        if (PyDict_SetItemString(dict, "same", same) < 0) {
+            Py_DECREF(same);
+            goto fail;
+        }
+        Py_DECREF(same);
+    }
+
     return dict;
 
 fail:
@@ -420,6 +792,91 @@ fail:
     return NULL;
 }
 
+/* =========================================================================
+ * Walk filters: exclude/include pattern lists -> komparu_walk_filter_t
+ * ========================================================================= */
+
+/* Borrow UTF-8 pointers from a sequence of str; *seq keeps them alive */
+static const char **pattern_array(PyObject *obj, const char *name, PyObject **seq, size_t *count) {
+    *seq = NULL;
+    *count = 0;
+    if (obj == Py_None) return NULL;
+    *seq = PySequence_Fast(obj, name);
+    if (!*seq) return NULL;
+    *count = (size_t)PySequence_Fast_GET_SIZE(*seq);
+    const char **out = calloc(*count ? *count : 1, sizeof(char *));
+    if (!out) {
+        PyErr_NoMemory();
+        return NULL;
+    }
+    for (size_t i = 0; i < *count; i++) {
+        PyObject *item = PySequence_Fast_GET_ITEM(*seq, (Py_ssize_t)i);
+        if (!PyUnicode_Check(item)) {
+            PyErr_Format(PyExc_TypeError, "%s must contain only str", name);
+            free(out);
+            return NULL;
+        }
+        if (!(out[i] = PyUnicode_AsUTF8(item))) {
+            free(out);
+            return NULL;
+        }
+    }
+    return out;
+}
+
+/* Parse exclude/include into *filter with the GIL held.
+ * Returns 1 if a filter was built, 0 if both are None or empty, -1 on error. */
+static int walk_filter_from_py(PyObject *py_exclude, PyObject *py_include,
+                               komparu_walk_filter_t *filter) {
+    PyObject *seq_ex, *seq_in = NULL;
+    size_t n_ex, n_in = 0;
+    const char **ex = pattern_array(py_exclude, "exclude", &seq_ex, &n_ex);
+    const char **in = NULL;
+    int rc = -1;
+    if (PyErr_Occurred()) goto done;
+    in = pattern_array(py_include, "include", &seq_in, &n_in);
+    if (PyErr_Occurred()) goto done;
+    if (n_ex == 0 && n_in == 0) {
+        rc = 0;
+        goto done;
+    }
+    const char *err_msg = NULL;
+    if (komparu_walk_filter_init(filter, ex, n_ex, in, n_in, &err_msg) != 0) {
+        PyErr_Format(PyExc_ValueError, "invalid pattern: %s", err_msg);
+        goto done;
+    }
+    rc = 1;
+done:
+    free(ex);
+    free(in);
+    Py_XDECREF(seq_ex);
+    Py_XDECREF(seq_in);
+    return rc;
+}
+
+static PyObject *py_path_included(PyObject *self, PyObject *args, PyObject *kwargs) {
+    (void)self;
+
+    const char *path = NULL;
+    PyObject *py_exclude = Py_None;
+    PyObject *py_include = Py_None;
+
+    static char *kwlist[] = {"path", "exclude", "include", NULL};
+
+    if (!PyArg_ParseTupleAndKeywords(args, kwargs, "s|OO", kwlist,
+            &path, &py_exclude, &py_include)) {
+        return NULL;
+    }
+
+    komparu_walk_filter_t filter;
+    int has = walk_filter_from_py(py_exclude, py_include, &filter);
+    if (has < 0) return NULL;
+    if (has == 0) Py_RETURN_TRUE;
+    bool keep = komparu_walk_filter_keeps(&filter, path);
+    komparu_walk_filter_free(&filter);
+    return PyBool_FromLong(keep);
+}
+
 /* =========================================================================
  * Python wrapper: compare_dir(dir_a, dir_b, ...) -> dict
  * ========================================================================= */
@@ -434,28 +891,78 @@ static PyObject *py_compare_dir(PyObject *self, PyObject *args, PyObject *kwargs
     int quick_check = 1;
     int follow_symlinks = 1;
     Py_ssize_t max_workers = 0;  /* 0 = auto */
+    int special_files = 0;
+    int summary_only = 0;
+    int max_depth = -1;  /* -1 = unlimited */
+    Py_ssize_t max_memory = 0;  /* 0 = no cap */
+    int regular_only = 0;
+    PyObject *py_progress = Py_None;
+    int stop_on_error = 0;
+    PyObject *py_exclude = Py_None;
+    PyObject *py_include = Py_None;
+    const char *symlinks = NULL;  /* NULL = as follow_symlinks says */
+    PyObject *py_cancel = Py_None;
+    int hardlinks = 0;
+    int list_equal = 0;
 
     static char *kwlist[] = {
         "dir_a", "dir_b", "chunk_size", "size_precheck",
-        "quick_check", "follow_symlinks", "max_workers", NULL
+        "quick_check", "follow_symlinks", "max_workers",
+        "special_files", "summary_only", "max_depth", "max_memory",
+        "regular_only", "progress", "stop_on_error", "exclude", "include",
+        "symlinks", "cancel", "hardlinks", "list_equal", NULL
     };
 
-    if (!PyArg_ParseTupleAndKeywords(args, kwargs, "ss|npppn", kwlist,
+    if (!PyArg_ParseTupleAndKeywords(args, kwargs, "ss|npppnppinpOpOOzOpp", kwlist,
             &dir_a, &dir_b, &chunk_size, &size_precheck,
-            &quick_check, &follow_symlinks, &max_workers)) {
+            &quick_check, &follow_symlinks, &max_workers,
+            &special_files, &summary_only, &max_depth, &max_memory,
+            &regular_only, &py_progress, &stop_on_error,
+            &py_exclude, &py_include, &symlinks, &py_cancel, &hardlinks,
+            &list_equal)) {
         return NULL;
     }
 
+    komparu_link_mode_t links = KOMPARU_LINKS_DEFAULT;
+    if (symlinks) {
+        if (strcmp(symlinks, "follow") == 0) {
+            follow_symlinks = 1;
+        } else if (strcmp(symlinks, "compare-link") == 0) {
+            links = KOMPARU_LINKS_COMPARE;
+        } else if (strcmp(symlinks, "skip") == 0) {
+            links = KOMPARU_LINKS_SKIP;
+        } else {
+            PyErr_Format(PyExc_ValueError,
+                         "symlinks must be 'follow', 'compare-link' or 'skip', not '%s'",
+                         symlinks);
+            return NULL;
+        }
+    }
+
     if (chunk_size <= 0) {
         PyErr_SetString(PyExc_ValueError, "chunk_size must be positive");
         return NULL;
     }
 
+    /* The caller keeps the capsule alive for the duration of the call */
+    komparu_dir_progress_t *progress = NULL;
+    if (py_progress != Py_None) {
+        progress = PyCapsule_GetPointer(py_progress, "komparu.dir_progress");
+        if (!progress) return NULL;
+    }
+    komparu_cancel_t *cancel;
+    if (cancel_from_py(py_cancel, &cancel) != 0) return NULL;
+
+    komparu_walk_filter_t filter;
+    int has_filter = walk_filter_from_py(py_exclude, py_include, &filter);
+    if (has_filter < 0) return NULL;
+
     char *da = strdup(dir_a);
     char *db = strdup(dir_b);
     if (!da || !db) {
         free(da);
         free(db);
+        if (has_filter) komparu_walk_filter_free(&filter);
         PyErr_NoMemory();
         return NULL;
     }
@@ -466,16 +973,22 @@ static PyObject *py_compare_dir(PyObject *self, PyObject *args, PyObject *kwargs
     KOMPARU_GIL_STATE_DECL
     KOMPARU_GIL_RELEASE()
 
+    komparu_cancel_t *prev_cancel = komparu_cancel_bind(cancel);
     result = komparu_compare_dirs(da, db,
         (size_t)chunk_size, (bool)size_precheck,
-        (bool)quick_check, (bool)follow_symlinks,
+        (bool)quick_check, (bool)follow_symlinks, links, (bool)special_files,
+        (bool)regular_only, (bool)summary_only, (bool)list_equal, max_depth,
+        has_filter ? &filter : NULL,
         (size_t)(max_workers >= 0 ? max_workers : 0),
-        &err_msg);
+        (size_t)(max_memory >= 0 ? max_memory : 0),
+        (bool)stop_on_error, (bool)hardlinks, progress, &err_msg);
+    komparu_cancel_bind(prev_cancel);
 
     KOMPARU_GIL_ACQUIRE()
 
     free(da);
     free(db);
+    if (has_filter) komparu_walk_filter_free(&filter);
 
     /* Check for pending signals (e.g., Ctrl+C) raised while GIL was released */
     if (PyErr_CheckSignals() < 0) {
@@ -484,151 +997,1296 @@ static PyObject *py_compare_dir(PyObject *self, PyObject *args, PyObject *kwargs
     }
 
     if (!result) {
-        PyErr_Format(PyExc_IOError, "directory comparison failed: %s",
-                     err_msg ? err_msg : "unknown error");
+        const char *kind = NULL;
+        const char *bad = komparu_dirwalk_nonregular(&kind);
+        if (bad) {
+            raise_nonregular_error(bad, kind);
+        } else if (!raise_if_cancelled(cancel)) {
+            PyErr_Format(PyExc_IOError, "directory comparison failed: %s",
+                         err_msg ? err_msg : "unknown error");
+        }
         return NULL;
     }
 
-    PyObject *py_result = dir_result_to_python(result);
+    PyObject *py_result = summary_only
+        ? dir_summary_to_python(result)
+        : dir_result_to_python(result);
     komparu_dir_result_free(result);
     return py_result;
 }
 
 /* =========================================================================
- * Python wrapper: compare_archive(path_a, path_b, ...) -> dict
+ * Directory progress counters — read while compare_dir runs elsewhere
  * ========================================================================= */
 
-static PyObject *py_compare_archive(PyObject *self, PyObject *args, PyObject *kwargs) {
+static void dir_progress_capsule_destructor(PyObject *capsule) {
+    free(PyCapsule_GetPointer(capsule, "komparu.dir_progress"));
+}
+
+static PyObject *py_dir_progress_new(PyObject *self, PyObject *Py_UNUSED(args)) {
     (void)self;
+    komparu_dir_progress_t *progress = calloc(1, sizeof(*progress));
+    if (!progress) return PyErr_NoMemory();
+    PyObject *capsule = PyCapsule_New(progress, "komparu.dir_progress",
+                                      dir_progress_capsule_destructor);
+    if (!capsule) free(progress);
+    return capsule;
+}
 
-    const char *path_a = NULL;
-    const char *path_b = NULL;
-    Py_ssize_t chunk_size = KOMPARU_DEFAULT_CHUNK_SIZE;
-    long long max_decompressed_size = -1;  /* -1 = use default */
-    int max_compression_ratio = -1;
-    long long max_entries = -1;
-    long long max_entry_name_length = -1;
-    int hash_compare = 0;
+static PyObject *py_dir_progress_snapshot(PyObject *self, PyObject *arg) {
+    (void)self;
+    komparu_dir_progress_t *p = PyCapsule_GetPointer(arg, "komparu.dir_progress");
+    if (!p) return NULL;
+    /* Acquire on files_* pairs with the release stores in dirwalk.c, so
+     * a non-zero total implies bytes_total is set and files_done >= n
+     * implies those n pairs' bytes are counted. */
+    unsigned long long files_total = atomic_load_explicit(&p->files_total, memory_order_acquire);
+    unsigned long long files_done = atomic_load_explicit(&p->files_done, memory_order_acquire);
+    unsigned long long bytes_done = atomic_load_explicit(&p->bytes_done, memory_order_relaxed);
+    unsigned long long bytes_total = atomic_load_explicit(&p->bytes_total, memory_order_relaxed);
+    char path[KOMPARU_PROGRESS_PATH_MAX];
+    komparu_dir_progress_path(p, path, sizeof(path));
+    if (!path[0]) {
+        return Py_BuildValue("(KKKKO)", files_done, files_total, bytes_done, bytes_total, Py_None);
+    }
+    PyObject *py_path = PyUnicode_DecodeFSDefault(path);
+    if (!py_path) return NULL;
+    return Py_BuildValue("(KKKKN)", files_done, files_total, bytes_done, bytes_total, py_path);
+}
 
-    static char *kwlist[] = {
-        "path_a", "path_b", "chunk_size",
-        "max_decompressed_size", "max_compression_ratio",
-        "max_entries", "max_entry_name_length", "hash_compare", NULL
-    };
+/* =========================================================================
+ * Cancellation tokens — set from any thread while a comparison runs
+ * ========================================================================= */
 
-    if (!PyArg_ParseTupleAndKeywords(args, kwargs, "ss|nLiLLp", kwlist,
-            &path_a, &path_b, &chunk_size,
-            &max_decompressed_size, &max_compression_ratio,
-            &max_entries, &max_entry_name_length, &hash_compare)) {
-        return NULL;
-    }
+static void cancel_capsule_destructor(PyObject *capsule) {
+    free(PyCapsule_GetPointer(capsule, "komparu.cancel"));
+}
 
-    char *pa = strdup(path_a);
-    char *pb = strdup(path_b);
-    if (!pa || !pb) {
-        free(pa);
-        free(pb);
-        PyErr_NoMemory();
-        return NULL;
+static PyObject *py_cancel_new(PyObject *self, PyObject *arg) {
+    (void)self;
+    double timeout = -1.0;  /* < 0 = no deadline */
+    if (arg != Py_None) {
+        timeout = PyFloat_AsDouble(arg);
+        if (timeout == -1.0 && PyErr_Occurred()) return NULL;
+        if (!(timeout > 0)) {
+            PyErr_SetString(PyExc_ValueError, "timeout must be positive");
+            return NULL;
+        }
+    }
+    komparu_cancel_t *cancel = calloc(1, sizeof(*cancel));
+    if (!cancel) return PyErr_NoMemory();
+    if (timeout > 0) {
+        double ns = timeout * 1e9;
+        cancel->deadline_ns = komparu_monotonic_ns() + (ns < 9e18 ? (int64_t)ns : INT64_MAX / 2);
     }
+    PyObject *capsule = PyCapsule_New(cancel, "komparu.cancel", cancel_capsule_destructor);
+    if (!capsule) free(cancel);
+    return capsule;
+}
 
-    /* Apply defaults for -1 values */
-    int64_t mds = max_decompressed_size >= 0 ? (int64_t)max_decompressed_size : 0;
-    int mcr = max_compression_ratio >= 0 ? max_compression_ratio : 0;
-    int64_t me = max_entries >= 0 ? (int64_t)max_entries : 0;
-    int64_t menl = max_entry_name_length >= 0 ? (int64_t)max_entry_name_length : 0;
+static PyObject *py_cancel_set(PyObject *self, PyObject *arg) {
+    (void)self;
+    komparu_cancel_t *cancel = PyCapsule_GetPointer(arg, "komparu.cancel");
+    if (!cancel) return NULL;
+    atomic_store_explicit(&cancel->cancelled, true, memory_order_relaxed);
+    Py_RETURN_NONE;
+}
 
-    const char *err_msg = NULL;
-    komparu_dir_result_t *result;
+static PyObject *py_cancel_state(PyObject *self, PyObject *arg) {
+    (void)self;
+    komparu_cancel_t *cancel = PyCapsule_GetPointer(arg, "komparu.cancel");
+    if (!cancel) return NULL;
+    return PyLong_FromLong(komparu_cancel_state(cancel));
+}
+
+/* =========================================================================
+ * Decompressing streams — the built-in formats for the Python path
+ * ========================================================================= */
+
+typedef struct {
+    komparu_reader_t *reader;  /* NULL once closed */
+} decompress_stream_t;
 
+static void decompress_capsule_destructor(PyObject *capsule) {
+    decompress_stream_t *s = PyCapsule_GetPointer(capsule, "komparu.decompress");
+    if (!s) return;
+    if (s->reader) s->reader->close(s->reader);
+    free(s);
+}
+
+static PyObject *py_decompress_open(PyObject *self, PyObject *arg) {
+    (void)self;
+    const char *path = PyUnicode_AsUTF8(arg);
+    if (!path) return NULL;
+    decompress_stream_t *s = calloc(1, sizeof(*s));
+    char *src = strdup(path);
+    if (!s || !src) {
+        free(s);
+        free(src);
+        return PyErr_NoMemory();
+    }
+
+    const char *err_msg = NULL;
     KOMPARU_GIL_STATE_DECL
     KOMPARU_GIL_RELEASE()
+    komparu_reader_t *file = komparu_reader_file_open(src, &err_msg);
+    if (file) {
+        s->reader = komparu_reader_decompress_open(file, &err_msg);
+        if (!s->reader) file->close(file);
+    }
+    KOMPARU_GIL_ACQUIRE()
 
-    /* Same-archive short-circuit via inode comparison */
-#ifndef KOMPARU_WINDOWS
-    {
-        struct stat st_a, st_b;
-        if (stat(pa, &st_a) == 0 && stat(pb, &st_b) == 0 &&
-            st_a.st_dev == st_b.st_dev && st_a.st_ino == st_b.st_ino) {
-            free(pa);
-            free(pb);
-            komparu_dir_result_t *r = komparu_dir_result_new();
-            KOMPARU_GIL_ACQUIRE()
-            if (KOMPARU_UNLIKELY(!r)) {
-                PyErr_NoMemory();
-                return NULL;
-            }
-            PyObject *py_r = dir_result_to_python(r);
-            komparu_dir_result_free(r);
-            return py_r;
-        }
+    if (!s->reader) {
+        raise_open_error(src, err_msg);
+        free(src);
+        free(s);
+        return NULL;
     }
-#endif
+    free(src);
+    PyObject *capsule = PyCapsule_New(s, "komparu.decompress", decompress_capsule_destructor);
+    if (!capsule) {
+        s->reader->close(s->reader);
+        free(s);
+    }
+    return capsule;
+}
 
-    if (hash_compare) {
-        result = komparu_compare_archives_hashed(pa, pb,
-            mds, mcr, me, menl, NULL, &err_msg);
-    } else {
-        result = komparu_compare_archives(pa, pb,
-            (size_t)chunk_size, mds, mcr, me, menl, &err_msg);
+static PyObject *py_decompress_read(PyObject *self, PyObject *args) {
+    (void)self;
+    PyObject *capsule;
+    Py_ssize_t size;
+    if (!PyArg_ParseTuple(args, "On", &capsule, &size)) return NULL;
+    decompress_stream_t *s = PyCapsule_GetPointer(capsule, "komparu.decompress");
+    if (!s) return NULL;
+    if (!s->reader) {
+        PyErr_SetString(PyExc_ValueError, "read from a closed stream");
+        return NULL;
+    }
+    if (size < 0) {
+        PyErr_SetString(PyExc_ValueError, "size must be non-negative");
+        return NULL;
     }
+    PyObject *buf = PyBytes_FromStringAndSize(NULL, size);
+    if (!buf) return NULL;
 
+    komparu_reader_t *reader = s->reader;
+    int64_t n;
+    KOMPARU_GIL_STATE_DECL
+    KOMPARU_GIL_RELEASE()
+    n = size > 0 ? reader->read(reader, PyBytes_AS_STRING(buf), (size_t)size) : 0;
     KOMPARU_GIL_ACQUIRE()
 
-    free(pa);
-    free(pb);
-
-    /* Check for pending signals (e.g., Ctrl+C) raised while GIL was released */
-    if (PyErr_CheckSignals() < 0) {
-        if (result) komparu_dir_result_free(result);
+    if (n < 0) {
+        Py_DECREF(buf);
+        PyErr_Format(PyExc_IOError, "read error: %s",
+                     reader->source_name ? reader->source_name : "decompression failed");
         return NULL;
     }
+    if (n < size && _PyBytes_Resize(&buf, (Py_ssize_t)n) < 0) return NULL;
+    return buf;
+}
 
-    if (!result) {
-        PyErr_Format(PyExc_IOError, "archive comparison failed: %s",
-                     err_msg ? err_msg : "unknown error");
-        return NULL;
+static PyObject *py_decompress_close(PyObject *self, PyObject *arg) {
+    (void)self;
+    decompress_stream_t *s = PyCapsule_GetPointer(arg, "komparu.decompress");
+    if (!s) return NULL;
+    if (s->reader) {
+        s->reader->close(s->reader);
+        s->reader = NULL;
+    }
+    Py_RETURN_NONE;
+}
+
+static PyObject *py_set_skip_holes(PyObject *self, PyObject *arg) {
+    (void)self;
+    int skip = PyObject_IsTrue(arg);
+    if (skip < 0) return NULL;
+    komparu_set_skip_holes(skip);
+    Py_RETURN_NONE;
+}
+
+/* =========================================================================
+ * Python wrapper: dirs_identical(dir_a, dir_b, ...) -> bool
+ * ========================================================================= */
+
+static PyObject *py_dirs_identical(PyObject *self, PyObject *args, PyObject *kwargs) {
+    (void)self;
+
+    const char *dir_a = NULL;
+    const char *dir_b = NULL;
+    Py_ssize_t chunk_size = KOMPARU_DEFAULT_CHUNK_SIZE;
+    int quick_check = 1;
+    int follow_symlinks = 1;
+    Py_ssize_t max_workers = 0;  /* 0 = auto */
+
+    static char *kwlist[] = {
+        "dir_a", "dir_b", "chunk_size", "quick_check",
+        "follow_symlinks", "max_workers", NULL
+    };
+
+    if (!PyArg_ParseTupleAndKeywords(args, kwargs, "ss|nppn", kwlist,
+            &dir_a, &dir_b, &chunk_size, &quick_check,
+            &follow_symlinks, &max_workers)) {
+        return NULL;
+    }
+
+    if (chunk_size <= 0) {
+        PyErr_SetString(PyExc_ValueError, "chunk_size must be positive");
+        return NULL;
+    }
+
+    char *da = strdup(dir_a);
+    char *db = strdup(dir_b);
+    if (!da || !db) {
+        free(da);
+        free(db);
+        PyErr_NoMemory();
+        return NULL;
+    }
+
+    const char *err_msg = NULL;
+    int rc;
+
+    KOMPARU_GIL_STATE_DECL
+    KOMPARU_GIL_RELEASE()
+
+    rc = komparu_dirs_identical(da, db,
+        (size_t)chunk_size, (bool)quick_check, (bool)follow_symlinks,
+        (size_t)(max_workers >= 0 ? max_workers : 0),
+        &err_msg);
+
+    KOMPARU_GIL_ACQUIRE()
+
+    free(da);
+    free(db);
+
+    if (PyErr_CheckSignals() < 0) return NULL;
+
+    if (rc < 0) {
+        PyErr_Format(PyExc_IOError, "directory comparison failed: %s",
+                     err_msg ? err_msg : "unknown error");
+        return NULL;
+    }
+
+    return PyBool_FromLong(rc);
+}
+
+/* =========================================================================
+ * Python wrapper: hash_dir(directory, ...) -> dict[str, str]
+ * ========================================================================= */
+
+static PyObject *py_hash_dir(PyObject *self, PyObject *args, PyObject *kwargs) {
+    (void)self;
+
+    const char *directory = NULL;
+    Py_ssize_t chunk_size = KOMPARU_DEFAULT_CHUNK_SIZE;
+    int follow_symlinks = 1;
+    Py_ssize_t max_workers = 0;  /* 0 = auto */
+
+    static char *kwlist[] = {
+        "directory", "chunk_size", "follow_symlinks", "max_workers", NULL
+    };
+
+    if (!PyArg_ParseTupleAndKeywords(args, kwargs, "s|npn", kwlist,
+            &directory, &chunk_size, &follow_symlinks, &max_workers)) {
+        return NULL;
+    }
+
+    if (chunk_size <= 0) {
+        PyErr_SetString(PyExc_ValueError, "chunk_size must be positive");
+        return NULL;
+    }
+
+    char *dir_copy = strdup(directory);
+    if (!dir_copy) {
+        PyErr_NoMemory();
+        return NULL;
+    }
+
+    const char *err_msg = NULL;
+    komparu_hash_list_t hashes;
+    int rc;
+
+    KOMPARU_GIL_STATE_DECL
+    KOMPARU_GIL_RELEASE()
+
+    rc = komparu_hash_dir(dir_copy, (bool)follow_symlinks,
+        (size_t)chunk_size,
+        (size_t)(max_workers >= 0 ? max_workers : 0),
+        &hashes, &err_msg);
+
+    KOMPARU_GIL_ACQUIRE()
+
+    free(dir_copy);
+
+    if (PyErr_CheckSignals() < 0) {
+        if (rc == 0) komparu_hash_list_free(&hashes);
+        return NULL;
+    }
+
+    if (rc != 0) {
+        PyErr_Format(PyExc_IOError, "directory hashing failed: %s",
+                     err_msg ? err_msg : "unknown error");
+        return NULL;
+    }
+
+    PyObject *dict = PyDict_New();
+    if (!dict) {
+        komparu_hash_list_free(&hashes);
+        return NULL;
+    }
+
+    char hex[KOMPARU_SHA256_HEX_LEN + 1];
+    for (size_t i = 0; i < hashes.paths.count; i++) {
+        komparu_digest_hex(hashes.digests[i], KOMPARU_SHA256_LEN, hex);
+        PyObject *val = PyUnicode_FromStringAndSize(hex, KOMPARU_SHA256_HEX_LEN);
+        if (!val || PyDict_SetItemString(dict, hashes.paths.paths[i], val) < 0) {
+            Py_XDECREF(val);
+            Py_DECREF(dict);
+            komparu_hash_list_free(&hashes);
+            return NULL;
+        }
+        Py_DECREF(val);
+    }
+
+    komparu_hash_list_free(&hashes);
+    return dict;
+}
+
+/* =========================================================================
+ * Python wrapper: hash_files(directory, paths, ...) -> list[str]
+ * ========================================================================= */
+
+static void free_path_array(char **arr, size_t count) {
+    if (!arr) return;
+    for (size_t i = 0; i < count; i++) free(arr[i]);
+    free(arr);
+}
+
+static PyObject *py_hash_files(PyObject *self, PyObject *args, PyObject *kwargs) {
+    (void)self;
+
+    const char *directory = NULL;
+    PyObject *py_paths = NULL;
+    Py_ssize_t chunk_size = KOMPARU_DEFAULT_CHUNK_SIZE;
+    Py_ssize_t max_workers = 0;  /* 0 = auto */
+
+    static char *kwlist[] = {
+        "directory", "paths", "chunk_size", "max_workers", NULL
+    };
+
+    if (!PyArg_ParseTupleAndKeywords(args, kwargs, "sO|nn", kwlist,
+            &directory, &py_paths, &chunk_size, &max_workers)) {
+        return NULL;
+    }
+
+    if (chunk_size <= 0) {
+        PyErr_SetString(PyExc_ValueError, "chunk_size must be positive");
+        return NULL;
+    }
+
+    PyObject *seq = PySequence_Fast(py_paths, "paths must be a sequence");
+    if (!seq) return NULL;
+
+    /* Copy paths to C strings while the GIL is held */
+    size_t count = (size_t)PySequence_Fast_GET_SIZE(seq);
+    char **paths = calloc(count ? count : 1, sizeof(char *));
+    char *dir_copy = strdup(directory);
+    uint8_t (*digests)[KOMPARU_SHA256_LEN] = calloc(count ? count : 1, KOMPARU_SHA256_LEN);
+    if (!paths || !dir_copy || !digests) {
+        Py_DECREF(seq);
+        free(paths);
+        free(dir_copy);
+        free(digests);
+        PyErr_NoMemory();
+        return NULL;
+    }
+    for (size_t i = 0; i < count; i++) {
+        const char *p = PyUnicode_AsUTF8(PySequence_Fast_GET_ITEM(seq, (Py_ssize_t)i));
+        if (!p || !(paths[i] = strdup(p))) {
+            if (p) PyErr_NoMemory();
+            Py_DECREF(seq);
+            free_path_array(paths, i);
+            free(dir_copy);
+            free(digests);
+            return NULL;
+        }
+    }
+    Py_DECREF(seq);
+
+    const char *err_msg = NULL;
+    int rc;
+
+    KOMPARU_GIL_STATE_DECL
+    KOMPARU_GIL_RELEASE()
+
+    rc = komparu_hash_files(dir_copy, paths, count, (size_t)chunk_size,
+        (size_t)(max_workers >= 0 ? max_workers : 0),
+        digests, &err_msg);
+
+    KOMPARU_GIL_ACQUIRE()
+
+    free_path_array(paths, count);
+    free(dir_copy);
+
+    if (PyErr_CheckSignals() < 0) {
+        free(digests);
+        return NULL;
+    }
+
+    if (rc != 0) {
+        free(digests);
+        PyErr_Format(PyExc_IOError, "file hashing failed: %s",
+                     err_msg ? err_msg : "unknown error");
+        return NULL;
+    }
+
+    PyObject *list = PyList_New((Py_ssize_t)count);
+    if (!list) {
+        free(digests);
+        return NULL;
+    }
+
+    char hex[KOMPARU_SHA256_HEX_LEN + 1];
+    for (size_t i = 0; i < count; i++) {
+        komparu_digest_hex(digests[i], KOMPARU_SHA256_LEN, hex);
+        PyObject *val = PyUnicode_FromStringAndSize(hex, KOMPARU_SHA256_HEX_LEN);
+        if (!val) {
+            Py_DECREF(list);
+            free(digests);
+            return NULL;
+        }
+        PyList_SET_ITEM(list, (Py_ssize_t)i, val);
+    }
+
+    free(digests);
+    return list;
+}
+
+/* =========================================================================
+ * Python wrapper: verify_hash(path, digest, ...) -> bool
+ * ========================================================================= */
+
+static PyObject *py_verify_hash(PyObject *self, PyObject *args, PyObject *kwargs) {
+    (void)self;
+
+    const char *path = NULL;
+    Py_buffer expected;
+    Py_ssize_t chunk_size = KOMPARU_DEFAULT_CHUNK_SIZE;
+
+    static char *kwlist[] = { "path", "digest", "chunk_size", NULL };
+
+    if (!PyArg_ParseTupleAndKeywords(args, kwargs, "sy*|n", kwlist,
+            &path, &expected, &chunk_size)) {
+        return NULL;
+    }
+
+    if (chunk_size <= 0 || expected.len != KOMPARU_SHA256_LEN) {
+        PyBuffer_Release(&expected);
+        PyErr_SetString(PyExc_ValueError, chunk_size <= 0
+            ? "chunk_size must be positive"
+            : "digest must be 32 bytes");
+        return NULL;
+    }
+
+    /* Copy inputs while the GIL is held */
+    uint8_t want[KOMPARU_SHA256_LEN];
+    memcpy(want, expected.buf, sizeof(want));
+    PyBuffer_Release(&expected);
+
+    char *path_copy = strdup(path);
+    if (!path_copy) {
+        PyErr_NoMemory();
+        return NULL;
+    }
+
+    const char *err_msg = NULL;
+    uint8_t got[KOMPARU_SHA256_LEN];
+    bool opened = false;
+    int rc = -1;
+
+    KOMPARU_GIL_STATE_DECL
+    KOMPARU_GIL_RELEASE()
+
+    komparu_reader_t *reader = komparu_reader_file_open(path_copy, &err_msg);
+    if (reader) {
+        opened = true;
+        rc = komparu_sha256_reader(reader, (size_t)chunk_size, got, &err_msg);
+        reader->close(reader);
+    }
+
+    KOMPARU_GIL_ACQUIRE()
+
+    if (PyErr_CheckSignals() < 0) {
+        free(path_copy);
+        return NULL;
+    }
+
+    if (rc != 0 && !opened) {
+        raise_open_error(path_copy, err_msg);
+        free(path_copy);
+        return NULL;
+    }
+    if (rc != 0) {
+        PyErr_Format(PyExc_IOError, "cannot hash '%s': %s",
+                     path_copy, err_msg ? err_msg : "unknown error");
+        free(path_copy);
+        return NULL;
+    }
+    free(path_copy);
+
+    if (komparu_digest_equal(got, want, KOMPARU_SHA256_LEN)) Py_RETURN_TRUE;
+    Py_RETURN_FALSE;
+}
+
+/* =========================================================================
+ * Python wrapper: block_checksums(path, block_size) -> list[tuple]
+ * ========================================================================= */
+
+static PyObject *py_block_checksums(PyObject *self, PyObject *args, PyObject *kwargs) {
+    (void)self;
+
+    const char *path = NULL;
+    Py_ssize_t block_size = 0;
+
+    static char *kwlist[] = { "path", "block_size", NULL };
+
+    if (!PyArg_ParseTupleAndKeywords(args, kwargs, "sn", kwlist,
+            &path, &block_size)) {
+        return NULL;
+    }
+
+    if (block_size <= 0) {
+        PyErr_SetString(PyExc_ValueError, "block_size must be positive");
+        return NULL;
+    }
+
+    char *path_copy = strdup(path);
+    if (!path_copy) {
+        PyErr_NoMemory();
+        return NULL;
+    }
+
+    const char *err_msg = NULL;
+    komparu_block_list_t blocks = {0};
+    bool opened = false;
+    int rc = -1;
+
+    KOMPARU_GIL_STATE_DECL
+    KOMPARU_GIL_RELEASE()
+
+    komparu_reader_t *reader = komparu_reader_file_open(path_copy, &err_msg);
+    if (reader) {
+        opened = true;
+        rc = komparu_block_checksums(reader, (size_t)block_size, &blocks, &err_msg);
+        reader->close(reader);
+    }
+
+    KOMPARU_GIL_ACQUIRE()
+
+    if (PyErr_CheckSignals() < 0) {
+        komparu_block_list_free(&blocks);
+        free(path_copy);
+        return NULL;
+    }
+
+    if (rc != 0 && !opened) {
+        raise_open_error(path_copy, err_msg);
+        free(path_copy);
+        return NULL;
+    }
+    if (rc != 0) {
+        PyErr_Format(PyExc_IOError, "cannot read '%s': %s",
+                     path_copy, err_msg ? err_msg : "unknown error");
+        free(path_copy);
+        return NULL;
+    }
+    free(path_copy);
+
+    PyObject *list = PyList_New((Py_ssize_t)blocks.count);
+    if (!list) {
+        komparu_block_list_free(&blocks);
+        return NULL;
+    }
+    for (size_t k = 0; k < blocks.count; k++) {
+        const komparu_block_sum_t *b = &blocks.items[k];
+        PyObject *item = Py_BuildValue("(LnIy#)",
+            (long long)b->offset, (Py_ssize_t)b->length, (unsigned int)b->weak,
+            (const char *)b->strong, (Py_ssize_t)KOMPARU_SHA256_LEN);
+        if (!item) {
+            Py_DECREF(list);
+            komparu_block_list_free(&blocks);
+            return NULL;
+        }
+        PyList_SET_ITEM(list, (Py_ssize_t)k, item);
+    }
+    komparu_block_list_free(&blocks);
+    return list;
+}
+
+/* =========================================================================
+ * Python wrapper: compare_archive(path_a, path_b, ...) -> dict
+ * ========================================================================= */
+
+static PyObject *py_compare_archive(PyObject *self, PyObject *args, PyObject *kwargs) {
+    (void)self;
+
+    const char *path_a = NULL;
+    const char *path_b = NULL;
+    Py_ssize_t chunk_size = KOMPARU_DEFAULT_CHUNK_SIZE;
+    long long max_decompressed_size = -1;  /* -1 = use default */
+    int max_compression_ratio = -1;
+    long long max_entries = -1;
+    long long max_entry_name_length = -1;
+    int hash_compare = 0;
+
+    static char *kwlist[] = {
+        "path_a", "path_b", "chunk_size",
+        "max_decompressed_size", "max_compression_ratio",
+        "max_entries", "max_entry_name_length", "hash_compare", NULL
+    };
+
+    if (!PyArg_ParseTupleAndKeywords(args, kwargs, "ss|nLiLLp", kwlist,
+            &path_a, &path_b, &chunk_size,
+            &max_decompressed_size, &max_compression_ratio,
+            &max_entries, &max_entry_name_length, &hash_compare)) {
+        return NULL;
+    }
+
+    char *pa = strdup(path_a);
+    char *pb = strdup(path_b);
+    if (!pa || !pb) {
+        free(pa);
+        free(pb);
+        PyErr_NoMemory();
+        return NULL;
+    }
+
+    /* Apply defaults for -1 values */
+    int64_t mds = max_decompressed_size >= 0 ? (int64_t)max_decompressed_size : 0;
+    int mcr = max_compression_ratio >= 0 ? max_compression_ratio : 0;
+    int64_t me = max_entries >= 0 ? (int64_t)max_entries : 0;
+    int64_t menl = max_entry_name_length >= 0 ? (int64_t)max_entry_name_length : 0;
+
+    const char *err_msg = NULL;
+    komparu_dir_result_t *result;
+
+    KOMPARU_GIL_STATE_DECL
+    KOMPARU_GIL_RELEASE()
+
+    /* Same-archive short-circuit via inode comparison */
+#ifndef KOMPARU_WINDOWS
+    {
+        struct stat st_a, st_b;
+        if (stat(pa, &st_a) == 0 && stat(pb, &st_b) == 0 &&
+            st_a.st_dev == st_b.st_dev && st_a.st_ino == st_b.st_ino) {
+            free(pa);
+            free(pb);
+            komparu_dir_result_t *r = komparu_dir_result_new();
+            KOMPARU_GIL_ACQUIRE()
+            if (KOMPARU_UNLIKELY(!r)) {
+                PyErr_NoMemory();
+                return NULL;
+            }
+            PyObject *py_r = dir_result_to_python(r);
+            komparu_dir_result_free(r);
+            return py_r;
+        }
+    }
+#endif
+
+    if (hash_compare) {
+        result = komparu_compare_archives_hashed(pa, pb,
+            mds, mcr, me, menl, NULL, &err_msg);
+    } else {
+        result = komparu_compare_archives(pa, pb,
+            (size_t)chunk_size, mds, mcr, me, menl, &err_msg);
+    }
+
+    KOMPARU_GIL_ACQUIRE()
+
+    free(pa);
+    free(pb);
+
+    /* Check for pending signals (e.g., Ctrl+C) raised while GIL was released */
+    if (PyErr_CheckSignals() < 0) {
+        if (result) komparu_dir_result_free(result);
+        return NULL;
+    }
+
+    if (!result) {
+        PyErr_Format(PyExc_IOError, "archive comparison failed: %s",
+                     err_msg ? err_msg : "unknown error");
+        return NULL;
+    }
+
+    PyObject *py_result = dir_result_to_python(result);
+    komparu_dir_result_free(result);
+    return py_result;
+}
+
+/* =========================================================================
+ * Python wrapper: compare_dir_urls(dir_path, url_map, ...) -> dict
+ * ========================================================================= */
+
+static PyObject *py_compare_dir_urls(PyObject *self, PyObject *args, PyObject *kwargs) {
+    (void)self;
+
+    const char *dir_path = NULL;
+    PyObject *py_url_map = NULL;
+    Py_ssize_t chunk_size = KOMPARU_DEFAULT_CHUNK_SIZE;
+    int size_precheck = 1;
+    int quick_check = 1;
+    PyObject *py_headers = Py_None;
+    double timeout = 30.0;
+    int follow_redirects = 1;
+    int verify_ssl = 1;
+    int allow_private = 0;
+    const char *proxy = NULL;
+
+    static char *kwlist[] = {
+        "dir_path", "url_map", "chunk_size", "size_precheck", "quick_check",
+        "headers", "timeout", "follow_redirects", "verify_ssl", "allow_private",
+        "proxy", NULL
+    };
+
+    if (!PyArg_ParseTupleAndKeywords(args, kwargs, "sO|nppOdpppz", kwlist,
+            &dir_path, &py_url_map, &chunk_size, &size_precheck, &quick_check,
+            &py_headers, &timeout, &follow_redirects, &verify_ssl,
+            &allow_private, &proxy)) {
+        return NULL;
+    }
+
+    if (!PyDict_Check(py_url_map)) {
+        PyErr_SetString(PyExc_TypeError, "url_map must be a dict");
+        return NULL;
+    }
+
+    if (chunk_size <= 0) {
+        PyErr_SetString(PyExc_ValueError, "chunk_size must be positive");
+        return NULL;
+    }
+
+    if (py_headers != Py_None && !PyDict_Check(py_headers)) {
+        PyErr_SetString(PyExc_TypeError, "headers must be a dict or None");
+        return NULL;
+    }
+
+    /* Convert url_map dict to parallel C arrays */
+    Py_ssize_t map_size = PyDict_Size(py_url_map);
+    char **rel_paths = NULL;
+    char **url_strs = NULL;
+
+    if (map_size > 0) {
+        rel_paths = calloc((size_t)map_size, sizeof(char *));
+        url_strs = calloc((size_t)map_size, sizeof(char *));
+        if (!rel_paths || !url_strs) {
+            free(rel_paths);
+            free(url_strs);
+            PyErr_NoMemory();
+            return NULL;
+        }
+
+        PyObject *key, *value;
+        Py_ssize_t pos = 0;
+        Py_ssize_t idx = 0;
+        while (PyDict_Next(py_url_map, &pos, &key, &value)) {
+            const char *k = PyUnicode_AsUTF8(key);
+            const char *v = PyUnicode_AsUTF8(value);
+            if (!k || !v) {
+                /* Free already-duped strings */
+                for (Py_ssize_t j = 0; j < idx; j++) {
+                    free(rel_paths[j]);
+                    free(url_strs[j]);
+                }
+                free(rel_paths);
+                free(url_strs);
+                PyErr_SetString(PyExc_TypeError,
+                                "url_map keys and values must be strings");
+                return NULL;
+            }
+            rel_paths[idx] = strdup(k);
+            url_strs[idx] = strdup(v);
+            if (!rel_paths[idx] || !url_strs[idx]) {
+                /* Cleanup on OOM */
+                for (Py_ssize_t j = 0; j <= idx; j++) {
+                    free(rel_paths[j]);
+                    free(url_strs[j]);
+                }
+                free(rel_paths);
+                free(url_strs);
+                PyErr_NoMemory();
+                return NULL;
+            }
+            idx++;
+        }
+    }
+
+    /* Build headers */
+    const char *err_msg = NULL;
+    size_t header_count = 0;
+    const char **header_array = build_header_array(
+        py_headers, &header_count, &err_msg);
+    if (err_msg) {
+        for (Py_ssize_t j = 0; j < map_size; j++) {
+            free(rel_paths[j]);
+            free(url_strs[j]);
+        }
+        free(rel_paths);
+        free(url_strs);
+        PyErr_SetString(PyExc_ValueError, err_msg);
+        return NULL;
+    }
+
+    /* Copy dir_path and proxy — PyArg strings are only valid with GIL */
+    char *dir_copy = strdup(dir_path);
+    char *proxy_copy = proxy ? strdup(proxy) : NULL;
+    if (!dir_copy || (proxy && !proxy_copy)) {
+        free(dir_copy);
+        free(proxy_copy);
+        for (Py_ssize_t j = 0; j < map_size; j++) {
+            free(rel_paths[j]);
+            free(url_strs[j]);
+        }
+        free(rel_paths);
+        free(url_strs);
+        free_header_array(header_array, header_count);
+        PyErr_NoMemory();
+        return NULL;
+    }
+
+    komparu_dir_result_t *result;
+
+    KOMPARU_GIL_STATE_DECL
+    KOMPARU_GIL_RELEASE()
+
+    result = komparu_compare_dir_urls(
+        dir_copy,
+        (const char **)rel_paths,
+        (const char **)url_strs,
+        (size_t)map_size,
+        header_array,
+        (size_t)chunk_size,
+        (bool)size_precheck,
+        (bool)quick_check,
+        timeout,
+        (bool)follow_redirects,
+        (bool)verify_ssl,
+        (bool)allow_private,
+        proxy_copy,
+        &err_msg);
+
+    KOMPARU_GIL_ACQUIRE()
+
+    /* Cleanup C copies */
+    free(dir_copy);
+    free(proxy_copy);
+    for (Py_ssize_t j = 0; j < map_size; j++) {
+        free(rel_paths[j]);
+        free(url_strs[j]);
+    }
+    free(rel_paths);
+    free(url_strs);
+    free_header_array(header_array, header_count);
+
+    /* Check for pending signals (e.g., Ctrl+C) raised while GIL was released */
+    if (PyErr_CheckSignals() < 0) {
+        if (result) komparu_dir_result_free(result);
+        return NULL;
+    }
+
+    if (!result) {
+        PyErr_Format(PyExc_IOError, "dir_urls comparison failed: %s",
+                     err_msg ? err_msg : "unknown error");
+        return NULL;
+    }
+
+    PyObject *py_result = dir_result_to_python(result);
+    komparu_dir_result_free(result);
+    return py_result;
+}
+
+/* =========================================================================
+ * Python wrapper: compare_numeric(path_a, path_b, ...) -> bool
+ * ========================================================================= */
+
+static PyObject *py_compare_numeric(PyObject *self, PyObject *args, PyObject *kwargs) {
+    (void)self;
+
+    const char *path_a = NULL;
+    const char *path_b = NULL;
+    const char *dtype = NULL;
+    double abs_tol = 0.0;
+    double rel_tol = 0.0;
+    int nan_equal = 0;
+    Py_ssize_t chunk_size = KOMPARU_DEFAULT_CHUNK_SIZE;
+
+    static char *kwlist[] = {
+        "path_a", "path_b", "dtype", "abs_tol", "rel_tol", "nan_equal",
+        "chunk_size", NULL
+    };
+
+    if (!PyArg_ParseTupleAndKeywords(args, kwargs, "ss|zddpn", kwlist,
+            &path_a, &path_b, &dtype, &abs_tol, &rel_tol, &nan_equal,
+            &chunk_size)) {
+        return NULL;
+    }
+
+    if (chunk_size <= 0) {
+        PyErr_SetString(PyExc_ValueError, "chunk_size must be positive");
+        return NULL;
+    }
+
+    komparu_num_opts_t opts = {
+        .abs_tol = abs_tol, .rel_tol = rel_tol, .nan_equal = (bool)nan_equal,
+    };
+    if (komparu_num_type_parse(dtype, &opts.type) != 0) {
+        PyErr_SetString(PyExc_ValueError, "dtype must be 'float32' or 'float64'");
+        return NULL;
+    }
+    if (!(abs_tol >= 0.0) || !(rel_tol >= 0.0)) {
+        PyErr_SetString(PyExc_ValueError, "abs_tol and rel_tol must be non-negative");
+        return NULL;
+    }
+
+    char *src_a = strdup(path_a);
+    char *src_b = strdup(path_b);
+    if (!src_a || !src_b) {
+        free(src_a);
+        free(src_b);
+        PyErr_NoMemory();
+        return NULL;
+    }
+
+    const char *err_msg = NULL;
+    komparu_result_t result = KOMPARU_ERROR;
+    const char *failed = NULL;
+
+    KOMPARU_GIL_STATE_DECL
+    KOMPARU_GIL_RELEASE()
+
+    komparu_reader_t *reader_a = komparu_reader_file_open(src_a, &err_msg);
+    komparu_reader_t *reader_b = NULL;
+    if (!reader_a) {
+        failed = src_a;
+    } else if (!(reader_b = komparu_reader_file_open(src_b, &err_msg))) {
+        failed = src_b;
+    } else {
+        result = komparu_compare_numeric(reader_a, reader_b,
+                                         (size_t)chunk_size, &opts, &err_msg);
+    }
+
+    if (reader_a) reader_a->close(reader_a);
+    if (reader_b) reader_b->close(reader_b);
+
+    KOMPARU_GIL_ACQUIRE()
+
+    if (PyErr_CheckSignals() < 0) {
+        free(src_a);
+        free(src_b);
+        return NULL;
+    }
+
+    if (result == KOMPARU_ERROR) {
+        if (failed) {
+            raise_open_error(failed, err_msg);
+        } else {
+            PyErr_Format(PyExc_IOError, "comparison error: %s",
+                         err_msg ? err_msg : "unknown");
+        }
+    }
+    free(src_a);
+    free(src_b);
+
+    if (result == KOMPARU_ERROR) return NULL;
+    if (result == KOMPARU_EQUAL) Py_RETURN_TRUE;
+    Py_RETURN_FALSE;
+}
+
+/* =========================================================================
+ * Python wrapper: count_differing_bytes(path_a, path_b, ...) -> (int, int)
+ * ========================================================================= */
+
+static PyObject *py_count_differing_bytes(PyObject *self, PyObject *args, PyObject *kwargs) {
+    (void)self;
+
+    const char *path_a = NULL;
+    const char *path_b = NULL;
+    Py_ssize_t chunk_size = KOMPARU_DEFAULT_CHUNK_SIZE;
+
+    static char *kwlist[] = {"path_a", "path_b", "chunk_size", NULL};
+
+    if (!PyArg_ParseTupleAndKeywords(args, kwargs, "ss|n", kwlist,
+            &path_a, &path_b, &chunk_size)) {
+        return NULL;
+    }
+
+    if (chunk_size <= 0) {
+        PyErr_SetString(PyExc_ValueError, "chunk_size must be positive");
+        return NULL;
+    }
+
+    char *src_a = strdup(path_a);
+    char *src_b = strdup(path_b);
+    if (!src_a || !src_b) {
+        free(src_a);
+        free(src_b);
+        PyErr_NoMemory();
+        return NULL;
+    }
+
+    const char *err_msg = NULL;
+    komparu_result_t result = KOMPARU_ERROR;
+    const char *failed = NULL;
+    int64_t differing = 0, total = 0;
+
+    KOMPARU_GIL_STATE_DECL
+    KOMPARU_GIL_RELEASE()
+
+    komparu_reader_t *reader_a = komparu_reader_file_open(src_a, &err_msg);
+    komparu_reader_t *reader_b = NULL;
+    if (!reader_a) {
+        failed = src_a;
+    } else if (!(reader_b = komparu_reader_file_open(src_b, &err_msg))) {
+        failed = src_b;
+    } else {
+        result = komparu_count_diff(reader_a, reader_b, (size_t)chunk_size,
+                                    &differing, &total, &err_msg);
+    }
+
+    if (reader_a) reader_a->close(reader_a);
+    if (reader_b) reader_b->close(reader_b);
+
+    KOMPARU_GIL_ACQUIRE()
+
+    if (PyErr_CheckSignals() < 0) {
+        free(src_a);
+        free(src_b);
+        return NULL;
+    }
+
+    if (result == KOMPARU_ERROR) {
+        if (failed) {
+            raise_open_error(failed, err_msg);
+        } else {
+            PyErr_Format(PyExc_IOError, "comparison error: %s",
+                         err_msg ? err_msg : "unknown");
+        }
+    }
+    free(src_a);
+    free(src_b);
+
+    if (result == KOMPARU_ERROR) return NULL;
+    return Py_BuildValue("(LL)", (long long)differing, (long long)total);
+}
+
+/* =========================================================================
+ * Python wrapper: read_file(path, ...) -> (int, str, str)
+ * ========================================================================= */
+
+static PyObject *py_read_file(PyObject *self, PyObject *args, PyObject *kwargs) {
+    (void)self;
+
+    const char *path = NULL;
+    Py_ssize_t chunk_size = KOMPARU_DEFAULT_CHUNK_SIZE;
+    const char *strategy = NULL;
+    int io_uring_depth = 0;
+    PyObject *py_cancel = Py_None;
+
+    static char *kwlist[] = {"path", "chunk_size", "strategy", "io_uring_depth", "cancel", NULL};
+
+    if (!PyArg_ParseTupleAndKeywords(args, kwargs, "s|nziO", kwlist,
+            &path, &chunk_size, &strategy, &io_uring_depth, &py_cancel)) {
+        return NULL;
+    }
+
+    if (chunk_size <= 0) {
+        PyErr_SetString(PyExc_ValueError, "chunk_size must be positive");
+        return NULL;
+    }
+    if (io_uring_depth < 0 || io_uring_depth > KOMPARU_URING_MAX_DEPTH) {
+        PyErr_Format(PyExc_ValueError, "io_uring_depth must be between 1 and %d",
+                     KOMPARU_URING_MAX_DEPTH);
+        return NULL;
+    }
+    unsigned strategy_flags = 0;
+    size_t prefetch_block = 0;
+    if (parse_strategy(strategy, (size_t)chunk_size, &strategy_flags, &prefetch_block) != 0) {
+        return NULL;
+    }
+    komparu_cancel_t *cancel;
+    if (cancel_from_py(py_cancel, &cancel) != 0) return NULL;
+
+    char *src = strdup(path);
+    char *buf = malloc((size_t)chunk_size);
+    if (!src || !buf) {
+        free(src);
+        free(buf);
+        PyErr_NoMemory();
+        return NULL;
+    }
+
+    const char *err_msg = NULL;
+    bool opened = false;
+    int64_t total = 0;
+    komparu_io_info_t io = {0};
+    bool io_known = false;
+
+    KOMPARU_GIL_STATE_DECL
+    KOMPARU_GIL_RELEASE()
+
+    komparu_cancel_t *prev_cancel = komparu_cancel_bind(cancel);
+    komparu_reader_t *reader = open_reader(
+        src, NULL, 30.0, 1, 1, 0, NULL, false, false, strategy_flags,
+        (unsigned)io_uring_depth, prefetch_block, &err_msg
+    );
+    if (reader) {
+        opened = true;
+        io_known = komparu_reader_file_io(reader, &io) == 0;
+        for (;;) {
+            if (KOMPARU_UNLIKELY(komparu_cancel_poll(&err_msg))) {
+                total = -1;
+                break;
+            }
+            int64_t n = reader->read(reader, buf, (size_t)chunk_size);
+            if (n < 0) {
+                err_msg = reader->source_name ? reader->source_name : "read error";
+                total = -1;
+                break;
+            }
+            if (n == 0) break;
+            total += n;
+        }
+        reader->close(reader);
+    }
+    komparu_cancel_bind(prev_cancel);
+
+    KOMPARU_GIL_ACQUIRE()
+
+    free(buf);
+    if (PyErr_CheckSignals() < 0) {
+        free(src);
+        return NULL;
+    }
+    if (!opened) {
+        raise_open_error(src, err_msg);
+        free(src);
+        return NULL;
+    }
+    free(src);
+    if (total < 0) {
+        if (!raise_if_cancelled(cancel)) {
+            PyErr_Format(PyExc_IOError, "read error: %s", err_msg);
+        }
+        return NULL;
+    }
+    PyObject *info = io_info_to_python(io_known, &io);
+    if (!info) return NULL;
+    return Py_BuildValue("(LN)", (long long)total, info);
+}
+
+/* =========================================================================
+ * Python wrapper: diff_stats(path_a, path_b, ...) -> (int, int, int|None, int, int)
+ * ========================================================================= */
+
+static PyObject *py_diff_stats(PyObject *self, PyObject *args, PyObject *kwargs) {
+    (void)self;
+
+    const char *path_a = NULL;
+    const char *path_b = NULL;
+    Py_ssize_t chunk_size = KOMPARU_DEFAULT_CHUNK_SIZE;
+    PyObject *py_cancel = Py_None;
+
+    static char *kwlist[] = {"path_a", "path_b", "chunk_size", "cancel", NULL};
+
+    if (!PyArg_ParseTupleAndKeywords(args, kwargs, "ss|nO", kwlist,
+            &path_a, &path_b, &chunk_size, &py_cancel)) {
+        return NULL;
+    }
+
+    if (chunk_size <= 0) {
+        PyErr_SetString(PyExc_ValueError, "chunk_size must be positive");
+        return NULL;
+    }
+    komparu_cancel_t *cancel;
+    if (cancel_from_py(py_cancel, &cancel) != 0) return NULL;
+
+    char *src_a = strdup(path_a);
+    char *src_b = strdup(path_b);
+    if (!src_a || !src_b) {
+        free(src_a);
+        free(src_b);
+        PyErr_NoMemory();
+        return NULL;
+    }
+
+    const char *err_msg = NULL;
+    komparu_result_t result = KOMPARU_ERROR;
+    const char *failed = NULL;
+    komparu_diff_stats_t stats = {.first_diff = -1};
+
+    KOMPARU_GIL_STATE_DECL
+    KOMPARU_GIL_RELEASE()
+
+    komparu_cancel_t *prev_cancel = komparu_cancel_bind(cancel);
+    komparu_reader_t *reader_a = komparu_reader_file_open(src_a, &err_msg);
+    komparu_reader_t *reader_b = NULL;
+    if (!reader_a) {
+        failed = src_a;
+    } else if (!(reader_b = komparu_reader_file_open(src_b, &err_msg))) {
+        failed = src_b;
+    } else {
+        result = komparu_diff_stats(reader_a, reader_b, (size_t)chunk_size,
+                                    &stats, &err_msg);
+    }
+
+    if (reader_a) reader_a->close(reader_a);
+    if (reader_b) reader_b->close(reader_b);
+    komparu_cancel_bind(prev_cancel);
+
+    KOMPARU_GIL_ACQUIRE()
+
+    if (PyErr_CheckSignals() < 0) {
+        free(src_a);
+        free(src_b);
+        return NULL;
+    }
+
+    if (result == KOMPARU_ERROR) {
+        if (failed) {
+            raise_open_error(failed, err_msg);
+        } else if (!raise_if_cancelled(cancel)) {
+            PyErr_Format(PyExc_IOError, "comparison error: %s",
+                         err_msg ? err_msg : "unknown");
+        }
     }
+    free(src_a);
+    free(src_b);
 
-    PyObject *py_result = dir_result_to_python(result);
-    komparu_dir_result_free(result);
-    return py_result;
+    if (result == KOMPARU_ERROR) return NULL;
+    PyObject *first = stats.first_diff >= 0
+        ? PyLong_FromLongLong(stats.first_diff)
+        : Py_NewRef(Py_None);
+    if (!first) return NULL;
+    return Py_BuildValue("(LLNLL)", (long long)stats.differing, (long long)stats.ranges,
+                         first, (long long)stats.size_a, (long long)stats.size_b);
 }
 
 /* =========================================================================
- * Python wrapper: compare_dir_urls(dir_path, url_map, ...) -> dict
+ * Python wrapper: compare_hash(path_a, path_b, ...) -> (bool, str, str)
  * ========================================================================= */
 
-static PyObject *py_compare_dir_urls(PyObject *self, PyObject *args, PyObject *kwargs) {
+static PyObject *py_compare_hash(PyObject *self, PyObject *args, PyObject *kwargs) {
     (void)self;
 
-    const char *dir_path = NULL;
-    PyObject *py_url_map = NULL;
+    const char *path_a = NULL;
+    const char *path_b = NULL;
     Py_ssize_t chunk_size = KOMPARU_DEFAULT_CHUNK_SIZE;
-    int size_precheck = 1;
-    int quick_check = 1;
-    PyObject *py_headers = Py_None;
-    double timeout = 30.0;
-    int follow_redirects = 1;
-    int verify_ssl = 1;
-    int allow_private = 0;
-    const char *proxy = NULL;
-
-    static char *kwlist[] = {
-        "dir_path", "url_map", "chunk_size", "size_precheck", "quick_check",
-        "headers", "timeout", "follow_redirects", "verify_ssl", "allow_private",
-        "proxy", NULL
-    };
 
-    if (!PyArg_ParseTupleAndKeywords(args, kwargs, "sO|nppOdpppz", kwlist,
-            &dir_path, &py_url_map, &chunk_size, &size_precheck, &quick_check,
-            &py_headers, &timeout, &follow_redirects, &verify_ssl,
-            &allow_private, &proxy)) {
-        return NULL;
-    }
+    static char *kwlist[] = {"path_a", "path_b", "chunk_size", NULL};
 
-    if (!PyDict_Check(py_url_map)) {
-        PyErr_SetString(PyExc_TypeError, "url_map must be a dict");
+    if (!PyArg_ParseTupleAndKeywords(args, kwargs, "ss|n", kwlist,
+            &path_a, &path_b, &chunk_size)) {
         return NULL;
     }
 
@@ -637,143 +2295,130 @@ static PyObject *py_compare_dir_urls(PyObject *self, PyObject *args, PyObject *k
         return NULL;
     }
 
-    if (py_headers != Py_None && !PyDict_Check(py_headers)) {
-        PyErr_SetString(PyExc_TypeError, "headers must be a dict or None");
+    char *src_a = strdup(path_a);
+    char *src_b = strdup(path_b);
+    if (!src_a || !src_b) {
+        free(src_a);
+        free(src_b);
+        PyErr_NoMemory();
         return NULL;
     }
 
-    /* Convert url_map dict to parallel C arrays */
-    Py_ssize_t map_size = PyDict_Size(py_url_map);
-    char **rel_paths = NULL;
-    char **url_strs = NULL;
+    const char *err_msg = NULL;
+    komparu_result_t result = KOMPARU_ERROR;
+    const char *failed = NULL;
+    uint8_t digest_a[KOMPARU_SHA256_LEN], digest_b[KOMPARU_SHA256_LEN];
 
-    if (map_size > 0) {
-        rel_paths = calloc((size_t)map_size, sizeof(char *));
-        url_strs = calloc((size_t)map_size, sizeof(char *));
-        if (!rel_paths || !url_strs) {
-            free(rel_paths);
-            free(url_strs);
-            PyErr_NoMemory();
-            return NULL;
-        }
+    KOMPARU_GIL_STATE_DECL
+    KOMPARU_GIL_RELEASE()
 
-        PyObject *key, *value;
-        Py_ssize_t pos = 0;
-        Py_ssize_t idx = 0;
-        while (PyDict_Next(py_url_map, &pos, &key, &value)) {
-            const char *k = PyUnicode_AsUTF8(key);
-            const char *v = PyUnicode_AsUTF8(value);
-            if (!k || !v) {
-                /* Free already-duped strings */
-                for (Py_ssize_t j = 0; j < idx; j++) {
-                    free(rel_paths[j]);
-                    free(url_strs[j]);
-                }
-                free(rel_paths);
-                free(url_strs);
-                PyErr_SetString(PyExc_TypeError,
-                                "url_map keys and values must be strings");
-                return NULL;
-            }
-            rel_paths[idx] = strdup(k);
-            url_strs[idx] = strdup(v);
-            if (!rel_paths[idx] || !url_strs[idx]) {
-                /* Cleanup on OOM */
-                for (Py_ssize_t j = 0; j <= idx; j++) {
-                    free(rel_paths[j]);
-                    free(url_strs[j]);
-                }
-                free(rel_paths);
-                free(url_strs);
-                PyErr_NoMemory();
-                return NULL;
-            }
-            idx++;
-        }
+    komparu_reader_t *reader_a = komparu_reader_file_open(src_a, &err_msg);
+    komparu_reader_t *reader_b = NULL;
+    if (!reader_a) {
+        failed = src_a;
+    } else if (!(reader_b = komparu_reader_file_open(src_b, &err_msg))) {
+        failed = src_b;
+    } else {
+        result = komparu_compare_hash(reader_a, reader_b, (size_t)chunk_size,
+                                      digest_a, digest_b, &err_msg);
     }
 
-    /* Build headers */
-    const char *err_msg = NULL;
-    size_t header_count = 0;
-    const char **header_array = build_header_array(
-        py_headers, &header_count, &err_msg);
-    if (err_msg) {
-        for (Py_ssize_t j = 0; j < map_size; j++) {
-            free(rel_paths[j]);
-            free(url_strs[j]);
-        }
-        free(rel_paths);
-        free(url_strs);
-        PyErr_SetString(PyExc_ValueError, err_msg);
+    if (reader_a) reader_a->close(reader_a);
+    if (reader_b) reader_b->close(reader_b);
+
+    KOMPARU_GIL_ACQUIRE()
+
+    if (PyErr_CheckSignals() < 0) {
+        free(src_a);
+        free(src_b);
         return NULL;
     }
 
-    /* Copy dir_path and proxy — PyArg strings are only valid with GIL */
-    char *dir_copy = strdup(dir_path);
-    char *proxy_copy = proxy ? strdup(proxy) : NULL;
-    if (!dir_copy || (proxy && !proxy_copy)) {
-        free(dir_copy);
-        free(proxy_copy);
-        for (Py_ssize_t j = 0; j < map_size; j++) {
-            free(rel_paths[j]);
-            free(url_strs[j]);
+    if (result == KOMPARU_ERROR) {
+        if (failed) {
+            raise_open_error(failed, err_msg);
+        } else {
+            PyErr_Format(PyExc_IOError, "comparison error: %s",
+                         err_msg ? err_msg : "unknown");
         }
-        free(rel_paths);
-        free(url_strs);
-        free_header_array(header_array, header_count);
-        PyErr_NoMemory();
-        return NULL;
     }
+    free(src_a);
+    free(src_b);
 
-    komparu_dir_result_t *result;
+    if (result == KOMPARU_ERROR) return NULL;
+    char hex_a[KOMPARU_SHA256_HEX_LEN + 1], hex_b[KOMPARU_SHA256_HEX_LEN + 1];
+    komparu_digest_hex(digest_a, KOMPARU_SHA256_LEN, hex_a);
+    komparu_digest_hex(digest_b, KOMPARU_SHA256_LEN, hex_b);
+    return Py_BuildValue("(Nss)", PyBool_FromLong(result == KOMPARU_EQUAL), hex_a, hex_b);
+}
 
-    KOMPARU_GIL_STATE_DECL
-    KOMPARU_GIL_RELEASE()
+/* =========================================================================
+ * Python wrapper: compare_fds(fd_a, fd_b, ...) -> (bool, int | None)
+ * ========================================================================= */
 
-    result = komparu_compare_dir_urls(
-        dir_copy,
-        (const char **)rel_paths,
-        (const char **)url_strs,
-        (size_t)map_size,
-        header_array,
-        (size_t)chunk_size,
-        (bool)size_precheck,
-        (bool)quick_check,
-        timeout,
-        (bool)follow_redirects,
-        (bool)verify_ssl,
-        (bool)allow_private,
-        proxy_copy,
-        &err_msg);
+static PyObject *py_compare_fds(PyObject *self, PyObject *args, PyObject *kwargs) {
+    (void)self;
 
-    KOMPARU_GIL_ACQUIRE()
+    int fd_a = -1;
+    int fd_b = -1;
+    long long start_a = -1;
+    long long start_b = -1;
+    Py_ssize_t chunk_size = KOMPARU_DEFAULT_CHUNK_SIZE;
+    int size_precheck = 1;
 
-    /* Cleanup C copies */
-    free(dir_copy);
-    free(proxy_copy);
-    for (Py_ssize_t j = 0; j < map_size; j++) {
-        free(rel_paths[j]);
-        free(url_strs[j]);
-    }
-    free(rel_paths);
-    free(url_strs);
-    free_header_array(header_array, header_count);
+    static char *kwlist[] = {"fd_a", "fd_b", "start_a", "start_b",
+                             "chunk_size", "size_precheck", NULL};
 
-    /* Check for pending signals (e.g., Ctrl+C) raised while GIL was released */
-    if (PyErr_CheckSignals() < 0) {
-        if (result) komparu_dir_result_free(result);
+    if (!PyArg_ParseTupleAndKeywords(args, kwargs, "ii|LLnp", kwlist,
+            &fd_a, &fd_b, &start_a, &start_b, &chunk_size, &size_precheck)) {
         return NULL;
     }
 
-    if (!result) {
-        PyErr_Format(PyExc_IOError, "dir_urls comparison failed: %s",
-                     err_msg ? err_msg : "unknown error");
+    if (chunk_size <= 0) {
+        PyErr_SetString(PyExc_ValueError, "chunk_size must be positive");
         return NULL;
     }
 
-    PyObject *py_result = dir_result_to_python(result);
-    komparu_dir_result_free(result);
-    return py_result;
+    const char *err_msg = NULL;
+    komparu_result_t result = KOMPARU_ERROR;
+    int failed = -1;
+    komparu_compare_info_t info;
+
+    KOMPARU_GIL_STATE_DECL
+    KOMPARU_GIL_RELEASE()
+
+    komparu_reader_t *reader_a = komparu_reader_file_from_fd(fd_a, start_a, &err_msg);
+    komparu_reader_t *reader_b = NULL;
+    if (!reader_a) {
+        failed = fd_a;
+    } else if (!(reader_b = komparu_reader_file_from_fd(fd_b, start_b, &err_msg))) {
+        failed = fd_b;
+    } else {
+        result = komparu_compare_detailed(reader_a, reader_b, (size_t)chunk_size,
+                                          (bool)size_precheck, &info, &err_msg);
+    }
+
+    /* Borrowed descriptors: close() only unmaps and frees */
+    if (reader_a) reader_a->close(reader_a);
+    if (reader_b) reader_b->close(reader_b);
+
+    KOMPARU_GIL_ACQUIRE()
+
+    if (PyErr_CheckSignals() < 0) return NULL;
+
+    if (result == KOMPARU_ERROR) {
+        if (failed >= 0) {
+            PyErr_Format(PyExc_OSError, "cannot compare fd %d: %s",
+                         failed, err_msg ? err_msg : "unknown error");
+        } else {
+            PyErr_Format(PyExc_IOError, "comparison error: %s",
+                         err_msg ? err_msg : "unknown");
+        }
+        return NULL;
+    }
+    return Py_BuildValue("(ON)",
+        result == KOMPARU_EQUAL ? Py_True : Py_False,
+        offset_or_none(info.first_diff));
 }
 
 /* =========================================================================
@@ -827,17 +2472,30 @@ static PyObject *py_async_compare_start(PyObject *self, PyObject *args, PyObject
     int verify_ssl = 1;
     int allow_private = 0;
     const char *proxy = NULL;
+    long long header_skip = 0;
+    long long footer_skip = 0;
+    const char *decode_a = NULL;
+    const char *decode_b = NULL;
+    int decompress = 0;
+    int collapse_zero_runs = 0;
+    const char *byte_map = NULL;
+    Py_ssize_t byte_map_len = 0;
+    const char *byte_map_b = NULL;
+    Py_ssize_t byte_map_b_len = 0;
 
     static char *kwlist[] = {
         "source_a", "source_b", "chunk_size", "size_precheck", "quick_check",
         "headers", "timeout", "follow_redirects", "verify_ssl", "allow_private",
-        "proxy", NULL
+        "proxy", "header_skip", "footer_skip", "decode_a", "decode_b",
+        "decompress", "collapse_zero_runs", "byte_map", "byte_map_b", NULL
     };
 
-    if (!PyArg_ParseTupleAndKeywords(args, kwargs, "ss|nppOdpppz", kwlist,
+    if (!PyArg_ParseTupleAndKeywords(args, kwargs, "ss|nppOdpppzLLzzppz#z#", kwlist,
             &source_a, &source_b, &chunk_size, &size_precheck, &quick_check,
             &py_headers, &timeout, &follow_redirects, &verify_ssl,
-            &allow_private, &proxy)) {
+            &allow_private, &proxy, &header_skip, &footer_skip,
+            &decode_a, &decode_b, &decompress, &collapse_zero_runs,
+            &byte_map, &byte_map_len, &byte_map_b, &byte_map_b_len)) {
         return NULL;
     }
 
@@ -846,6 +2504,13 @@ static PyObject *py_async_compare_start(PyObject *self, PyObject *args, PyObject
         return NULL;
     }
 
+    komparu_transform_t transform_a, transform_b;
+    if (parse_transforms(header_skip, footer_skip, -1, (bool)decompress,
+                         (bool)collapse_zero_runs, byte_map, byte_map_len,
+                         byte_map_b, byte_map_b_len, decode_a, decode_b, &transform_a, &transform_b) != 0) {
+        return NULL;
+    }
+
     if (py_headers != Py_None && !PyDict_Check(py_headers)) {
         PyErr_SetString(PyExc_TypeError, "headers must be a dict or None");
         return NULL;
@@ -865,7 +2530,7 @@ static PyObject *py_async_compare_start(PyObject *self, PyObject *args, PyObject
         source_a, source_b, header_array,
         (size_t)chunk_size, (bool)size_precheck, (bool)quick_check,
         timeout, (bool)follow_redirects, (bool)verify_ssl, (bool)allow_private,
-        proxy, &err_msg
+        proxy, &transform_a, &transform_b, &err_msg
     );
 
     free_header_array(header_array, header_count);
@@ -898,7 +2563,12 @@ static PyObject *py_async_compare_result(PyObject *self, PyObject *arg) {
 
     const char *err_msg = NULL;
     bool result;
-    if (komparu_async_task_cmp_result(task, &result, &err_msg) != 0) {
+    int rc = komparu_async_task_cmp_result(task, &result, &err_msg);
+    if (rc == KOMPARU_ASYNC_DECODE_ERROR) {
+        raise_komparu_error("DecodeError", err_msg ? err_msg : "decode error");
+        return NULL;
+    }
+    if (rc != 0) {
         PyErr_Format(PyExc_IOError, "%s", err_msg ? err_msg : "unknown error");
         return NULL;
     }
@@ -917,15 +2587,18 @@ static PyObject *py_async_compare_dir_start(PyObject *self, PyObject *args, PyOb
     int quick_check = 1;
     int follow_symlinks = 1;
     Py_ssize_t max_workers = 0;
+    int special_files = 0;
 
     static char *kwlist[] = {
         "dir_a", "dir_b", "chunk_size", "size_precheck",
-        "quick_check", "follow_symlinks", "max_workers", NULL
+        "quick_check", "follow_symlinks", "max_workers",
+        "special_files", NULL
     };
 
-    if (!PyArg_ParseTupleAndKeywords(args, kwargs, "ss|npppn", kwlist,
+    if (!PyArg_ParseTupleAndKeywords(args, kwargs, "ss|npppnp", kwlist,
             &dir_a, &dir_b, &chunk_size, &size_precheck,
-            &quick_check, &follow_symlinks, &max_workers)) {
+            &quick_check, &follow_symlinks, &max_workers,
+            &special_files)) {
         return NULL;
     }
 
@@ -938,7 +2611,7 @@ static PyObject *py_async_compare_dir_start(PyObject *self, PyObject *args, PyOb
     komparu_async_task_t *task = komparu_async_compare_dir(
         dir_a, dir_b,
         (size_t)chunk_size, (bool)size_precheck, (bool)quick_check,
-        (bool)follow_symlinks,
+        (bool)follow_symlinks, (bool)special_files,
         (size_t)(max_workers >= 0 ? max_workers : 0),
         &err_msg
     );
@@ -1214,10 +2887,127 @@ static PyMethodDef module_methods[] = {
         (PyCFunction)(void(*)(void))py_compare_dir,
         METH_VARARGS | METH_KEYWORDS,
         "compare_dir(dir_a, dir_b, *, chunk_size=65536, size_precheck=True, "
-        "quick_check=True, follow_symlinks=True) -> dict\n\n"
+        "quick_check=True, follow_symlinks=True, special_files=False) -> dict\n\n"
         "Compare two directories recursively.\n"
         "Returns dict with equal, diff, only_left, only_right."
     },
+    {
+        "path_included",
+        (PyCFunction)(void(*)(void))py_path_included,
+        METH_VARARGS | METH_KEYWORDS,
+        "path_included(path, exclude=None, include=None) -> bool\n\n"
+        "Whether compare_dir(exclude=..., include=...) would list path.\n"
+        "A trailing '/' marks a directory."
+    },
+    {
+        "dir_progress_new",
+        py_dir_progress_new,
+        METH_NOARGS,
+        "dir_progress_new() -> capsule\n\n"
+        "Zeroed progress counters to pass as compare(progress=...) or "
+        "compare_dir(progress=...)."
+    },
+    {
+        "dir_progress_snapshot",
+        py_dir_progress_snapshot,
+        METH_O,
+        "dir_progress_snapshot(progress) -> (files_done, files_total, "
+        "bytes_done, bytes_total, path)\n\n"
+        "Read the counters and the current path (None before the first pair); "
+        "safe while compare or compare_dir runs on another thread."
+    },
+    {
+        "cancel_new",
+        py_cancel_new,
+        METH_O,
+        "cancel_new(timeout) -> capsule\n\n"
+        "Cancellation token to pass as compare(cancel=...) or "
+        "compare_dir(cancel=...); timeout (seconds or None) sets a deadline."
+    },
+    {
+        "cancel_set",
+        py_cancel_set,
+        METH_O,
+        "cancel_set(token)\n\n"
+        "Cancel; comparisons using the token stop at their next chunk."
+    },
+    {
+        "decompress_open",
+        py_decompress_open,
+        METH_O,
+        "decompress_open(path) -> capsule\n\n"
+        "Open a local file for reading with gzip, bzip2, xz or zstd content "
+        "decompressed natively; other content reads unchanged."
+    },
+    {
+        "decompress_read",
+        py_decompress_read,
+        METH_VARARGS,
+        "decompress_read(stream, size) -> bytes\n\n"
+        "Read up to size decompressed bytes; b'' at the end."
+    },
+    {
+        "decompress_close",
+        py_decompress_close,
+        METH_O,
+        "decompress_close(stream)\n\n"
+        "Close the file now rather than when the stream is collected."
+    },
+    {
+        "set_skip_holes",
+        py_set_skip_holes,
+        METH_O,
+        "set_skip_holes(skip)\n\n"
+        "Skip holes shared by two sparse files (process-wide, default True)."
+    },
+    {
+        "cancel_state",
+        py_cancel_state,
+        METH_O,
+        "cancel_state(token) -> int\n\n"
+        "0 = active, 1 = cancelled, 2 = deadline passed."
+    },
+    {
+        "dirs_identical",
+        (PyCFunction)(void(*)(void))py_dirs_identical,
+        METH_VARARGS | METH_KEYWORDS,
+        "dirs_identical(dir_a, dir_b, *, chunk_size=65536, quick_check=True, "
+        "follow_symlinks=True, max_workers=0) -> bool\n\n"
+        "Fail-fast check that two directory trees are identical.\n"
+        "Stops at the first missing file, size mismatch or content diff."
+    },
+    {
+        "hash_dir",
+        (PyCFunction)(void(*)(void))py_hash_dir,
+        METH_VARARGS | METH_KEYWORDS,
+        "hash_dir(directory, *, chunk_size=65536, follow_symlinks=True, "
+        "max_workers=0) -> dict\n\n"
+        "SHA-256 of every regular file under directory, hashed in parallel.\n"
+        "Returns dict mapping relative path to hex digest."
+    },
+    {
+        "hash_files",
+        (PyCFunction)(void(*)(void))py_hash_files,
+        METH_VARARGS | METH_KEYWORDS,
+        "hash_files(directory, paths, *, chunk_size=65536, max_workers=0) -> list\n\n"
+        "SHA-256 of each path (relative to directory), hashed in parallel.\n"
+        "Returns hex digests in input order."
+    },
+    {
+        "verify_hash",
+        (PyCFunction)(void(*)(void))py_verify_hash,
+        METH_VARARGS | METH_KEYWORDS,
+        "verify_hash(path, digest, *, chunk_size=65536) -> bool\n\n"
+        "SHA-256 of path compared in constant time against a 32-byte digest."
+    },
+    {
+        "block_checksums",
+        (PyCFunction)(void(*)(void))py_block_checksums,
+        METH_VARARGS | METH_KEYWORDS,
+        "block_checksums(path, block_size) -> list[tuple]\n\n"
+        "(offset, length, weak, strong) per block: rsync rolling checksum\n"
+        "and SHA-256 digest."
+    },
     {
         "compare_archive",
         (PyCFunction)(void(*)(void))py_compare_archive,
@@ -1235,6 +3025,54 @@ static PyMethodDef module_methods[] = {
         "Compare local directory against URL mapping.\n"
         "Returns dict with equal, diff, only_left, only_right."
     },
+    {
+        "compare_numeric",
+        (PyCFunction)(void(*)(void))py_compare_numeric,
+        METH_VARARGS | METH_KEYWORDS,
+        "compare_numeric(path_a, path_b, *, dtype='float64', abs_tol=0.0, "
+        "rel_tol=0.0, nan_equal=False, chunk_size=65536) -> bool\n\n"
+        "Compare two files as arrays of floating-point values within tolerance."
+    },
+    {
+        "count_differing_bytes",
+        (PyCFunction)(void(*)(void))py_count_differing_bytes,
+        METH_VARARGS | METH_KEYWORDS,
+        "count_differing_bytes(path_a, path_b, *, chunk_size=65536) -> (int, int)\n\n"
+        "Count differing byte positions; returns (differing, total)."
+    },
+    {
+        "read_file",
+        (PyCFunction)(void(*)(void))py_read_file,
+        METH_VARARGS | METH_KEYWORDS,
+        "read_file(path, *, chunk_size=65536, strategy='auto', io_uring_depth=0, "
+        "cancel=None) "
+        "-> (int, tuple | None)\n\n"
+        "Read a file or URL to EOF with the GIL released; returns (bytes, io_info)."
+    },
+    {
+        "diff_stats",
+        (PyCFunction)(void(*)(void))py_diff_stats,
+        METH_VARARGS | METH_KEYWORDS,
+        "diff_stats(path_a, path_b, *, chunk_size=65536, cancel=None) "
+        "-> (int, int, int | None, int, int)\n\n"
+        "Full scan; returns (differing, ranges, first_diff, size_a, size_b)."
+    },
+    {
+        "compare_hash",
+        (PyCFunction)(void(*)(void))py_compare_hash,
+        METH_VARARGS | METH_KEYWORDS,
+        "compare_hash(path_a, path_b, *, chunk_size=65536) -> (bool, str, str)\n\n"
+        "Compare two files and return both SHA-256 hex digests, one read each."
+    },
+    {
+        "compare_fds",
+        (PyCFunction)(void(*)(void))py_compare_fds,
+        METH_VARARGS | METH_KEYWORDS,
+        "compare_fds(fd_a, fd_b, *, start_a=-1, start_b=-1, chunk_size=65536, "
+        "size_precheck=True) -> (bool, int | None)\n\n"
+        "Compare two open descriptors from start (-1 = current offset) to EOF.\n"
+        "Returns (equal, first_diff_offset); descriptors are left open."
+    },
     {
         "compare_buffers",
         (PyCFunction)py_compare_buffers,
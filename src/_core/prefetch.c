@@ -0,0 +1,230 @@
+/**
+ * prefetch.c — Double-buffered readahead on a helper thread.
+ *
+ * Two block-sized slots are filled in file order by the helper and
+ * drained in the same order by the consumer. The helper reads into a
+ * slot without holding the lock; the consumer never touches a slot
+ * that is not ready, and the helper never touches one that is. A seek
+ * bumps the generation, so a read started before it is dropped when it
+ * completes instead of being handed out.
+ */
+
+#include "prefetch.h"
+#include <stdlib.h>
+#include <string.h>
+#include <errno.h>
+
+#ifndef KOMPARU_WINDOWS
+
+#include <sys/uio.h>
+
+typedef struct {
+    size_t len;         /* bytes held; 0 with ready = early EOF */
+    int error;          /* errno of a failed read, or 0 */
+    bool ready;
+} prefetch_slot_t;
+
+struct komparu_prefetch {
+    int fd;
+    int64_t file_size;
+    size_t block;
+    char *buffers;             /* 2 * block */
+
+    pthread_t thread;
+    pthread_mutex_t mu;
+    pthread_cond_t cond;       /* slot filled, slot drained, seek or stop */
+
+    /* Guarded by mu */
+    prefetch_slot_t slots[2];
+    unsigned head;             /* slot the consumer drains */
+    unsigned tail;             /* slot the helper fills next */
+    size_t head_pos;           /* bytes consumed from the head slot */
+    int64_t pos;               /* consumer's file position */
+    int64_t next;              /* file offset the helper reads next */
+    uint64_t generation;       /* bumped by every seek */
+    bool stop;
+};
+
+static size_t want(const komparu_prefetch_t *p, int64_t offset) {
+    int64_t left = p->file_size - offset;
+    if (left <= 0) return 0;
+    return left < (int64_t)p->block ? (size_t)left : p->block;
+}
+
+static void *prefetch_main(void *arg) {
+    komparu_prefetch_t *p = (komparu_prefetch_t *)arg;
+    pthread_mutex_lock(&p->mu);
+    for (;;) {
+        while (!p->stop && (p->slots[p->tail].ready || p->next >= p->file_size))
+            pthread_cond_wait(&p->cond, &p->mu);
+        if (p->stop) break;
+
+        /* Both slots free: fill them with one vectored read */
+        unsigned first = p->tail, second = first ^ 1u;
+        int64_t offset = p->next;
+        struct iovec iov[2];
+        int iovcnt = 1;
+        iov[0].iov_base = p->buffers + (size_t)first * p->block;
+        iov[0].iov_len = want(p, offset);
+        if (!p->slots[second].ready && first == p->head && p->head_pos == 0 &&
+            iov[0].iov_len == p->block) {
+            iov[1].iov_base = p->buffers + (size_t)second * p->block;
+            iov[1].iov_len = want(p, offset + (int64_t)p->block);
+            if (iov[1].iov_len > 0) iovcnt = 2;
+        }
+        uint64_t generation = p->generation;
+        pthread_mutex_unlock(&p->mu);
+
+        ssize_t n;
+        do {
+            n = iovcnt == 2 ? preadv(p->fd, iov, 2, (off_t)offset)
+                            : pread(p->fd, iov[0].iov_base, iov[0].iov_len, (off_t)offset);
+        } while (n < 0 && errno == EINTR);
+        int error = n < 0 ? errno : 0;
+
+        pthread_mutex_lock(&p->mu);
+        if (p->generation != generation) continue;  /* seeked meanwhile */
+        if (error) {
+            p->slots[first] = (prefetch_slot_t){0, error, true};
+            p->next = p->file_size;  /* nothing more to read */
+        } else {
+            /* A short read leaves the rest to the next one; none at all
+             * means the file shrank under us */
+            size_t got = (size_t)n;
+            size_t in_first = got < iov[0].iov_len ? got : iov[0].iov_len;
+            p->slots[first] = (prefetch_slot_t){in_first, 0, true};
+            p->tail = second;
+            if (got > in_first) {
+                p->slots[second] = (prefetch_slot_t){got - in_first, 0, true};
+                p->tail = first;
+            }
+            p->next = got == 0 ? p->file_size : offset + (int64_t)got;
+        }
+        pthread_cond_broadcast(&p->cond);
+    }
+    pthread_mutex_unlock(&p->mu);
+    return NULL;
+}
+
+komparu_prefetch_t *komparu_prefetch_open(int fd, int64_t file_size, size_t block_size) {
+    if (block_size == 0) {
+        errno = EINVAL;
+        return NULL;
+    }
+    komparu_prefetch_t *p = calloc(1, sizeof(*p));
+    if (!p) {
+        errno = ENOMEM;
+        return NULL;
+    }
+    p->buffers = malloc(2 * block_size);
+    if (!p->buffers) {
+        free(p);
+        errno = ENOMEM;
+        return NULL;
+    }
+    p->fd = fd;
+    p->file_size = file_size;
+    p->block = block_size;
+    pthread_mutex_init(&p->mu, NULL);
+    pthread_cond_init(&p->cond, NULL);
+    int rc = pthread_create(&p->thread, NULL, prefetch_main, p);
+    if (rc != 0) {
+        pthread_cond_destroy(&p->cond);
+        pthread_mutex_destroy(&p->mu);
+        free(p->buffers);
+        free(p);
+        errno = rc;
+        return NULL;
+    }
+    return p;
+}
+
+int64_t komparu_prefetch_read(komparu_prefetch_t *p, void *buf, size_t size) {
+    size_t done = 0;
+    pthread_mutex_lock(&p->mu);
+    while (done < size && p->pos < p->file_size) {
+        prefetch_slot_t *slot = &p->slots[p->head];
+        while (!slot->ready)
+            pthread_cond_wait(&p->cond, &p->mu);
+        if (slot->error) {
+            errno = slot->error;
+            pthread_mutex_unlock(&p->mu);
+            return -1;
+        }
+        size_t avail = slot->len - p->head_pos;
+        if (avail == 0) break;  /* file ended early */
+        size_t n = avail < size - done ? avail : size - done;
+        /* A ready slot is the consumer's: copy without the lock */
+        const char *src = p->buffers + (size_t)p->head * p->block + p->head_pos;
+        pthread_mutex_unlock(&p->mu);
+        memcpy((char *)buf + done, src, n);
+        pthread_mutex_lock(&p->mu);
+        done += n;
+        p->pos += (int64_t)n;
+        p->head_pos += n;
+        if (p->head_pos == slot->len) {
+            slot->ready = false;
+            p->head ^= 1u;
+            p->head_pos = 0;
+            pthread_cond_broadcast(&p->cond);
+        }
+    }
+    pthread_mutex_unlock(&p->mu);
+    return (int64_t)done;
+}
+
+int komparu_prefetch_seek(komparu_prefetch_t *p, int64_t offset) {
+    if (offset < 0 || offset > p->file_size) return -1;
+    pthread_mutex_lock(&p->mu);
+    p->generation++;
+    p->slots[0].ready = p->slots[1].ready = false;
+    p->head = p->tail = 0;
+    p->head_pos = 0;
+    p->pos = p->next = offset;
+    pthread_cond_broadcast(&p->cond);
+    pthread_mutex_unlock(&p->mu);
+    return 0;
+}
+
+void komparu_prefetch_close(komparu_prefetch_t *p) {
+    if (!p) return;
+    pthread_mutex_lock(&p->mu);
+    p->stop = true;
+    pthread_cond_broadcast(&p->cond);
+    pthread_mutex_unlock(&p->mu);
+    pthread_join(p->thread, NULL);
+    pthread_cond_destroy(&p->cond);
+    pthread_mutex_destroy(&p->mu);
+    free(p->buffers);
+    free(p);
+}
+
+#else /* KOMPARU_WINDOWS */
+
+komparu_prefetch_t *komparu_prefetch_open(int fd, int64_t file_size, size_t block_size) {
+    (void)fd;
+    (void)file_size;
+    (void)block_size;
+    errno = ENOSYS;
+    return NULL;
+}
+
+int64_t komparu_prefetch_read(komparu_prefetch_t *p, void *buf, size_t size) {
+    (void)p;
+    (void)buf;
+    (void)size;
+    errno = ENOSYS;
+    return -1;
+}
+
+int komparu_prefetch_seek(komparu_prefetch_t *p, int64_t offset) {
+    (void)p;
+    (void)offset;
+    return -1;
+}
+
+void komparu_prefetch_close(komparu_prefetch_t *p) {
+    (void)p;
+}
+
+#endif /* KOMPARU_WINDOWS */
@@ -0,0 +1,47 @@
+/**
+ * prefetch.h — Double-buffered readahead on a helper thread.
+ *
+ * A thread per file keeps the next block read into a second buffer while
+ * the consumer copies out of the current one, so the comparison of one
+ * chunk overlaps the read of the next on storage where a single
+ * synchronous read() at a time leaves the device idle. When both buffers
+ * are free (at the start and after a seek) they are filled with one
+ * preadv(). Portable to every POSIX system; on Windows the open call
+ * fails with ENOSYS and callers fall back to read().
+ */
+
+#ifndef KOMPARU_PREFETCH_H
+#define KOMPARU_PREFETCH_H
+
+#include "compat.h"
+
+typedef struct komparu_prefetch komparu_prefetch_t;
+
+/**
+ * Start reading `fd` (first `file_size` bytes) in blocks of `block_size`
+ * bytes. The first two blocks are requested immediately from offset 0.
+ *
+ * Returns NULL and sets errno if the thread cannot be started, on
+ * allocation failure, or ENOSYS where prefetch is not built. Does not
+ * take ownership of `fd`.
+ */
+komparu_prefetch_t *komparu_prefetch_open(int fd, int64_t file_size, size_t block_size);
+
+/**
+ * Copy up to `size` bytes from the current position into `buf`, waiting
+ * for the helper thread as needed. Fills the buffer unless EOF is reached.
+ *
+ * Returns bytes copied, 0 at EOF, or -1 on a read error (errno set).
+ */
+int64_t komparu_prefetch_read(komparu_prefetch_t *p, void *buf, size_t size);
+
+/**
+ * Drop buffered blocks and restart at `offset`.
+ * Returns 0, or -1 if `offset` is out of range.
+ */
+int komparu_prefetch_seek(komparu_prefetch_t *p, int64_t offset);
+
+/** Stop the helper thread, waiting for its read in progress, then free. */
+void komparu_prefetch_close(komparu_prefetch_t *p);
+
+#endif /* KOMPARU_PREFETCH_H */
@@ -71,6 +71,82 @@ typedef struct komparu_reader {
  */
 komparu_reader_t *komparu_reader_file_open(const char *path, const char **err_msg);
 
+/** Ask for huge pages on the file mapping (Linux; advisory). */
+#define KOMPARU_FILE_HUGE_PAGES 0x1u
+
+/**
+ * Also accept block devices (Unix), sized by the device's full extent
+ * rather than st_size. Regular files are unaffected.
+ */
+#define KOMPARU_FILE_BLOCK_DEVICES 0x2u
+
+/**
+ * Never map: read with buffered read() / ReadFile. Without this flag or
+ * KOMPARU_FILE_MMAP, files of at least KOMPARU_MMAP_THRESHOLD bytes are
+ * mapped and smaller ones read, since a mapping costs more to set up and
+ * tear down than a few read() calls.
+ */
+#define KOMPARU_FILE_BUFFERED 0x4u
+
+/** Map every non-empty file, whatever its size. */
+#define KOMPARU_FILE_MMAP 0x8u
+
+/** Smallest file mapped when neither strategy flag is set. */
+#define KOMPARU_MMAP_THRESHOLD ((int64_t)64 * 1024)
+
+/** err_msg of a file reader asked to open a directory. */
+#define KOMPARU_ERR_IS_DIRECTORY "is a directory"
+
+/** Same as komparu_reader_file_open() with KOMPARU_FILE_* flags. */
+komparu_reader_t *komparu_reader_file_open_ex(
+    const char *path,
+    unsigned flags,
+    const char **err_msg
+);
+
+/**
+ * Same as komparu_reader_file_open_ex(), but read through io_uring with
+ * `depth` block reads in flight (Linux, experimental). Falls back to
+ * read() when no ring can be set up; komparu_reader_file_io() reports
+ * the path taken. KOMPARU_FILE_HUGE_PAGES is ignored.
+ */
+komparu_reader_t *komparu_reader_file_open_uring(
+    const char *path,
+    unsigned depth,
+    unsigned flags,
+    const char **err_msg
+);
+
+/**
+ * Same as komparu_reader_file_open_ex(), but read by a helper thread
+ * that keeps the next `block_size` bytes ready in a second buffer
+ * (preadv() when both are free). Falls back to read() when the thread
+ * cannot be started, and on Windows; komparu_reader_file_io() reports
+ * the path taken. KOMPARU_FILE_HUGE_PAGES is ignored.
+ */
+komparu_reader_t *komparu_reader_file_open_prefetch(
+    const char *path,
+    size_t block_size,
+    unsigned flags,
+    const char **err_msg
+);
+
+/**
+ * Create a file reader over an already open descriptor, from byte
+ * `start` (-1 = the descriptor's current offset) to EOF.
+ *
+ * The descriptor is borrowed: close() leaves it open. Reads go through
+ * mmap or pread() (Unix) / positioned ReadFile (Windows), so its file
+ * offset is not moved, except by the Windows fallback. Offsets and
+ * sizes seen through the reader are relative to `start`. Only regular
+ * files are accepted.
+ */
+komparu_reader_t *komparu_reader_file_from_fd(
+    int fd,
+    int64_t start,
+    const char **err_msg
+);
+
 /**
  * Create an HTTP reader using libcurl.
  *
@@ -97,4 +173,125 @@ komparu_reader_t *komparu_reader_archive_open(
     const char **err_msg
 );
 
+/**
+ * Wrap a reader so only [header_skip, size - footer_skip) is visible.
+ *
+ * Offsets and sizes reported by the window are relative to header_skip.
+ * Sources shorter than header_skip + footer_skip yield an empty window.
+ * footer_skip > 0 requires inner->get_size() to be known.
+ *
+ * On success the window owns inner_reader (closed with the window).
+ * On error returns NULL and the caller still owns inner_reader.
+ */
+komparu_reader_t *komparu_reader_window_open(
+    komparu_reader_t *inner_reader,
+    int64_t header_skip,
+    int64_t footer_skip,
+    const char **err_msg
+);
+
+/**
+ * Cap the visible length of a window reader at max_length bytes.
+ * Has no effect on readers not created by komparu_reader_window_open().
+ */
+void komparu_reader_window_cap(komparu_reader_t *window, int64_t max_length);
+
+/** Content decodings applied on the fly by komparu_reader_decode_open(). */
+typedef enum {
+    KOMPARU_DECODE_NONE   = 0,
+    KOMPARU_DECODE_BASE64 = 1,
+    KOMPARU_DECODE_HEX    = 2,
+} komparu_decode_t;
+
+/**
+ * Parse a decoding name ("none", "base64", "hex"; NULL = none).
+ * Returns 0 on success, -1 if the name is unknown.
+ */
+int komparu_decode_parse(const char *name, komparu_decode_t *out);
+
+/**
+ * Wrap a reader so its content is decoded (base64 or hex) while read.
+ *
+ * ASCII whitespace in the input is ignored. The decoded size is unknown,
+ * so get_size() returns -1 and seek is not supported.
+ * On success the decoder owns inner_reader; on error the caller does.
+ */
+komparu_reader_t *komparu_reader_decode_open(
+    komparu_reader_t *inner_reader,
+    komparu_decode_t mode,
+    const char **err_msg
+);
+
+/**
+ * If `reader` is a decode reader whose input was invalid, return the
+ * reason. Returns NULL for other readers or when no decode error occurred.
+ */
+const char *komparu_reader_decode_error(komparu_reader_t *reader);
+
+/**
+ * Wrap a reader so gzip, bzip2, xz or zstd content is decompressed while
+ * read. The format is detected from magic bytes; other input passes
+ * through unchanged. get_size() returns -1 and seek is not supported.
+ *
+ * On success the wrapper owns inner_reader (closed with the wrapper).
+ * On error returns NULL and the caller still owns inner_reader.
+ */
+komparu_reader_t *komparu_reader_decompress_open(
+    komparu_reader_t *inner_reader,
+    const char **err_msg
+);
+
+/**
+ * Wrap a reader so every run of zero bytes reads as a single zero.
+ * get_size() returns -1 and seek is not supported.
+ * On success the wrapper owns inner_reader; on error the caller does.
+ */
+komparu_reader_t *komparu_reader_zeros_open(
+    komparu_reader_t *inner_reader,
+    const char **err_msg
+);
+
+/**
+ * Wrap a reader so every byte b reads as map[b]. Length-preserving:
+ * get_size() and seek() pass through to inner_reader.
+ * On success the wrapper owns inner_reader; on error the caller does.
+ */
+komparu_reader_t *komparu_reader_bytemap_open(
+    komparu_reader_t *inner_reader,
+    const uint8_t map[256],
+    const char **err_msg
+);
+
+/**
+ * Per-source content transforms, applied in field order by
+ * komparu_reader_apply_transform(). Zero-initialized = identity.
+ */
+typedef struct {
+    bool decompress;            /* transparent gzip/bzip2/xz/zstd, applied first */
+    int64_t header_skip;        /* bytes dropped from the start */
+    int64_t footer_skip;        /* bytes dropped from the end */
+    bool has_length;            /* keep only `length` bytes after header_skip */
+    int64_t length;
+    komparu_decode_t decode;    /* decoding applied after skipping */
+    bool has_byte_map;          /* map bytes to equivalence class representatives */
+    uint8_t byte_map[256];
+    bool collapse_zeros;        /* zero runs read as one zero, applied last */
+} komparu_transform_t;
+
+/** True if `t` is NULL or leaves content unchanged. */
+bool komparu_transform_is_identity(const komparu_transform_t *t);
+
+/**
+ * Wrap *reader with the decorators described by `t`.
+ *
+ * On success *reader is replaced by the outermost wrapper.
+ * On error returns -1; *reader is still a valid reader (possibly partly
+ * wrapped) that the caller must close.
+ */
+int komparu_reader_apply_transform(
+    komparu_reader_t **reader,
+    const komparu_transform_t *t,
+    const char **err_msg
+);
+
 #endif /* KOMPARU_READER_H */
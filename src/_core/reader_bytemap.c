@@ -0,0 +1,75 @@
+/**
+ * reader_bytemap.c — Map every byte through a 256-entry table.
+ *
+ * Used for equivalence classes: each byte of a class maps to the same
+ * canonical value, so streams that differ only in which member they use
+ * read the same. The mapping preserves length, so get_size() and seek()
+ * pass through and size precheck and quick check still apply.
+ */
+
+#include "reader.h"
+#include <stdlib.h>
+#include <string.h>
+
+typedef struct {
+    komparu_reader_t *inner;   /* owned */
+    uint8_t map[256];
+} bytemap_ctx_t;
+
+static int64_t bytemap_read(komparu_reader_t *self, void *buf, size_t size) {
+    bytemap_ctx_t *ctx = (bytemap_ctx_t *)self->ctx;
+    int64_t n = ctx->inner->read(ctx->inner, buf, size);
+    if (n <= 0) return n;
+
+    uint8_t *p = (uint8_t *)buf;
+    for (int64_t i = 0; i < n; i++)
+        p[i] = ctx->map[p[i]];
+    return n;
+}
+
+static int64_t bytemap_get_size(komparu_reader_t *self) {
+    bytemap_ctx_t *ctx = (bytemap_ctx_t *)self->ctx;
+    return ctx->inner->get_size(ctx->inner);
+}
+
+static int bytemap_seek(komparu_reader_t *self, int64_t offset) {
+    bytemap_ctx_t *ctx = (bytemap_ctx_t *)self->ctx;
+    return ctx->inner->seek(ctx->inner, offset);
+}
+
+static void bytemap_close(komparu_reader_t *self) {
+    if (!self) return;
+    bytemap_ctx_t *ctx = (bytemap_ctx_t *)self->ctx;
+    if (ctx) {
+        if (ctx->inner) ctx->inner->close(ctx->inner);
+        free(ctx);
+    }
+    free(self);
+}
+
+komparu_reader_t *komparu_reader_bytemap_open(
+    komparu_reader_t *inner,
+    const uint8_t map[256],
+    const char **err_msg
+) {
+    bytemap_ctx_t *ctx = calloc(1, sizeof(bytemap_ctx_t));
+    komparu_reader_t *reader = calloc(1, sizeof(komparu_reader_t));
+    if (!ctx || !reader) {
+        free(ctx);
+        free(reader);
+        *err_msg = "out of memory";
+        return NULL;
+    }
+
+    ctx->inner = inner;
+    memcpy(ctx->map, map, sizeof(ctx->map));
+
+    reader->read = bytemap_read;
+    reader->get_size = bytemap_get_size;
+    reader->seek = inner->seek ? bytemap_seek : NULL;
+    reader->close = bytemap_close;
+    reader->ctx = ctx;
+    reader->source_name = inner->source_name;
+
+    return reader;
+}
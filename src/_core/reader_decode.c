@@ -0,0 +1,266 @@
+/**
+ * reader_decode.c — Streaming base64/hex decoding over another reader.
+ *
+ * Decodes the inner reader's bytes on the fly so an encoded source can be
+ * compared against its raw counterpart. ASCII whitespace is ignored in
+ * both encodings. Invalid input makes read() fail; the reason is kept in
+ * the reader and retrieved with komparu_reader_decode_error().
+ *
+ * The decoded size is unknown up front, so get_size() returns -1 and the
+ * reader is not seekable (size precheck and quick check are skipped).
+ */
+
+#include "reader.h"
+#include <stdlib.h>
+#include <string.h>
+
+#define DECODE_IN_SIZE (64 * 1024)
+
+typedef struct {
+    komparu_reader_t *inner;   /* owned */
+    komparu_decode_t mode;
+
+    /* Raw input buffer */
+    uint8_t in[DECODE_IN_SIZE];
+    size_t in_len;
+    size_t in_pos;
+    bool in_eof;
+
+    /* Decoder state */
+    uint32_t acc;              /* accumulated bits */
+    int acc_count;             /* symbols in acc (base64: 0-3, hex: 0-1) */
+    bool padded;               /* base64: '=' seen, only padding may follow */
+    int pad_count;
+
+    /* Decoded bytes not yet delivered (at most one group) */
+    uint8_t pend[3];
+    size_t pend_len;
+    size_t pend_pos;
+
+    /* Offset of the current input symbol, for error messages */
+    int64_t consumed;
+    const char *error;         /* NULL or description of invalid input */
+    char errbuf[160];
+} decode_ctx_t;
+
+static int8_t b64_value(uint8_t c) {
+    if (c >= 'A' && c <= 'Z') return (int8_t)(c - 'A');
+    if (c >= 'a' && c <= 'z') return (int8_t)(c - 'a' + 26);
+    if (c >= '0' && c <= '9') return (int8_t)(c - '0' + 52);
+    if (c == '+') return 62;
+    if (c == '/') return 63;
+    return -1;
+}
+
+static int8_t hex_value(uint8_t c) {
+    if (c >= '0' && c <= '9') return (int8_t)(c - '0');
+    if (c >= 'a' && c <= 'f') return (int8_t)(c - 'a' + 10);
+    if (c >= 'A' && c <= 'F') return (int8_t)(c - 'A' + 10);
+    return -1;
+}
+
+static inline bool is_space(uint8_t c) {
+    return c == ' ' || c == '\t' || c == '\r' || c == '\n' ||
+           c == '\v' || c == '\f';
+}
+
+static void decode_fail(decode_ctx_t *ctx, const char *what, uint8_t c) {
+    if (c >= 0x20 && c < 0x7f) {
+        snprintf(ctx->errbuf, sizeof(ctx->errbuf),
+                 "invalid %s input at offset %lld: '%c'",
+                 what, (long long)ctx->consumed, c);
+    } else {
+        snprintf(ctx->errbuf, sizeof(ctx->errbuf),
+                 "invalid %s input at offset %lld: byte 0x%02x",
+                 what, (long long)ctx->consumed, c);
+    }
+    ctx->error = ctx->errbuf;
+}
+
+/**
+ * Decode one input symbol. Writes 0..3 bytes to out.
+ * Returns number of bytes written, or -1 on invalid input.
+ */
+static int decode_symbol(decode_ctx_t *ctx, uint8_t c, uint8_t *out) {
+    if (is_space(c)) return 0;
+
+    if (ctx->mode == KOMPARU_DECODE_HEX) {
+        int8_t v = hex_value(c);
+        if (v < 0) {
+            decode_fail(ctx, "hex", c);
+            return -1;
+        }
+        ctx->acc = (ctx->acc << 4) | (uint32_t)v;
+        if (++ctx->acc_count < 2) return 0;
+        out[0] = (uint8_t)ctx->acc;
+        ctx->acc = 0;
+        ctx->acc_count = 0;
+        return 1;
+    }
+
+    /* base64 */
+    if (c == '=') {
+        /* Padding only valid after 2 or 3 symbols of a quantum */
+        if (!ctx->padded && ctx->acc_count < 2) {
+            decode_fail(ctx, "base64", c);
+            return -1;
+        }
+        ctx->padded = true;
+        if (++ctx->pad_count + ctx->acc_count > 4) {
+            decode_fail(ctx, "base64", c);
+            return -1;
+        }
+        return 0;
+    }
+    if (ctx->padded) {
+        decode_fail(ctx, "base64", c);  /* data after padding */
+        return -1;
+    }
+    int8_t v = b64_value(c);
+    if (v < 0) {
+        decode_fail(ctx, "base64", c);
+        return -1;
+    }
+    ctx->acc = (ctx->acc << 6) | (uint32_t)v;
+    if (++ctx->acc_count < 4) return 0;
+    out[0] = (uint8_t)(ctx->acc >> 16);
+    out[1] = (uint8_t)(ctx->acc >> 8);
+    out[2] = (uint8_t)ctx->acc;
+    ctx->acc = 0;
+    ctx->acc_count = 0;
+    return 3;
+}
+
+/**
+ * Flush a trailing partial quantum at EOF.
+ * Returns bytes written (0..2), or -1 if the input was truncated.
+ */
+static int decode_finish(decode_ctx_t *ctx, uint8_t *out) {
+    if (ctx->acc_count == 0) return 0;
+
+    if (ctx->mode == KOMPARU_DECODE_HEX) {
+        snprintf(ctx->errbuf, sizeof(ctx->errbuf),
+                 "invalid hex input: odd number of digits");
+        ctx->error = ctx->errbuf;
+        return -1;
+    }
+
+    /* base64: 2 symbols -> 1 byte, 3 symbols -> 2 bytes (padding optional) */
+    int n = ctx->acc_count;
+    if (n == 1) {
+        snprintf(ctx->errbuf, sizeof(ctx->errbuf),
+                 "invalid base64 input: truncated final quantum");
+        ctx->error = ctx->errbuf;
+        return -1;
+    }
+    uint32_t acc = ctx->acc << (6 * (4 - n));
+    out[0] = (uint8_t)(acc >> 16);
+    if (n == 3) out[1] = (uint8_t)(acc >> 8);
+    ctx->acc = 0;
+    ctx->acc_count = 0;
+    return n - 1;
+}
+
+static int64_t decode_read(komparu_reader_t *self, void *buf, size_t size) {
+    decode_ctx_t *ctx = (decode_ctx_t *)self->ctx;
+    if (ctx->error) return -1;
+
+    uint8_t *out = (uint8_t *)buf;
+    size_t produced = 0;
+
+    /*
+     * Fill the caller's buffer completely unless EOF: the compare engine
+     * treats a short read on one side as a content difference.
+     */
+    while (produced < size) {
+        if (ctx->pend_pos < ctx->pend_len) {
+            out[produced++] = ctx->pend[ctx->pend_pos++];
+            continue;
+        }
+
+        if (ctx->in_pos >= ctx->in_len) {
+            if (ctx->in_eof) break;
+            int64_t n = ctx->inner->read(ctx->inner, ctx->in, sizeof(ctx->in));
+            if (n < 0) return -1;
+            if (n == 0) {
+                ctx->in_eof = true;
+                int w = decode_finish(ctx, ctx->pend);
+                if (w < 0) return -1;
+                ctx->pend_len = (size_t)w;
+                ctx->pend_pos = 0;
+                continue;
+            }
+            ctx->in_len = (size_t)n;
+            ctx->in_pos = 0;
+        }
+
+        int w = decode_symbol(ctx, ctx->in[ctx->in_pos], ctx->pend);
+        if (w < 0) return -1;
+        ctx->in_pos++;
+        ctx->consumed++;
+        ctx->pend_len = (size_t)w;
+        ctx->pend_pos = 0;
+    }
+
+    return (int64_t)produced;
+}
+
+static int64_t decode_get_size(komparu_reader_t *self) {
+    (void)self;
+    return -1;
+}
+
+static void decode_close(komparu_reader_t *self) {
+    if (!self) return;
+    decode_ctx_t *ctx = (decode_ctx_t *)self->ctx;
+    if (ctx) {
+        if (ctx->inner) ctx->inner->close(ctx->inner);
+        free(ctx);
+    }
+    free(self);
+}
+
+int komparu_decode_parse(const char *name, komparu_decode_t *out) {
+    if (!name || strcmp(name, "none") == 0) {
+        *out = KOMPARU_DECODE_NONE;
+    } else if (strcmp(name, "base64") == 0) {
+        *out = KOMPARU_DECODE_BASE64;
+    } else if (strcmp(name, "hex") == 0) {
+        *out = KOMPARU_DECODE_HEX;
+    } else {
+        return -1;
+    }
+    return 0;
+}
+
+komparu_reader_t *komparu_reader_decode_open(
+    komparu_reader_t *inner,
+    komparu_decode_t mode,
+    const char **err_msg
+) {
+    decode_ctx_t *ctx = calloc(1, sizeof(decode_ctx_t));
+    komparu_reader_t *reader = calloc(1, sizeof(komparu_reader_t));
+    if (!ctx || !reader) {
+        free(ctx);
+        free(reader);
+        *err_msg = "out of memory";
+        return NULL;
+    }
+
+    ctx->inner = inner;
+    ctx->mode = mode;
+
+    reader->read = decode_read;
+    reader->get_size = decode_get_size;
+    reader->seek = NULL;
+    reader->close = decode_close;
+    reader->ctx = ctx;
+    reader->source_name = inner->source_name;
+
+    return reader;
+}
+
+const char *komparu_reader_decode_error(komparu_reader_t *reader) {
+    if (!reader || reader->close != decode_close) return NULL;
+    return ((decode_ctx_t *)reader->ctx)->error;
+}
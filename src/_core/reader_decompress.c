@@ -0,0 +1,152 @@
+/**
+ * reader_decompress.c — Transparent decompression over another reader.
+ *
+ * Uses libarchive's raw format with the gzip, bzip2, xz and zstd filters.
+ * libarchive picks the filter from the stream's magic bytes; input that
+ * matches none of them passes through unchanged, so plain files compare
+ * raw. Decompression streams: memory is O(chunk), never O(content).
+ *
+ * The decompressed size is unknown up front, so get_size() returns -1 and
+ * the reader is not seekable (size precheck and quick check are skipped).
+ * A corrupt stream surfaces as a read error.
+ */
+
+#include "reader.h"
+#include <archive.h>
+#include <archive_entry.h>
+#include <errno.h>
+#include <stdlib.h>
+#include <string.h>
+
+static _Thread_local char decompress_errbuf[256];
+
+#define DECOMPRESS_IN_SIZE (64 * 1024)
+
+typedef struct {
+    komparu_reader_t *inner;   /* owned */
+    struct archive *ar;        /* NULL for empty input */
+    uint8_t in[DECOMPRESS_IN_SIZE];
+    size_t primed;             /* bytes of `in` read during open, not yet handed out */
+    bool done;
+} decompress_ctx_t;
+
+static la_ssize_t decompress_in(struct archive *a, void *ud, const void **buf) {
+    decompress_ctx_t *ctx = (decompress_ctx_t *)ud;
+    *buf = ctx->in;
+
+    if (ctx->primed > 0) {
+        size_t n = ctx->primed;
+        ctx->primed = 0;
+        return (la_ssize_t)n;
+    }
+
+    int64_t n = ctx->inner->read(ctx->inner, ctx->in, sizeof(ctx->in));
+    if (n < 0) {
+        archive_set_error(a, EIO, "read error");
+        return -1;
+    }
+    return (la_ssize_t)n;
+}
+
+static int64_t decompress_read(komparu_reader_t *self, void *buf, size_t size) {
+    decompress_ctx_t *ctx = (decompress_ctx_t *)self->ctx;
+    if (ctx->done || !ctx->ar) return 0;
+
+    uint8_t *out = (uint8_t *)buf;
+    size_t produced = 0;
+
+    /* Fill the caller's buffer completely unless EOF (see reader_decode.c) */
+    while (produced < size) {
+        la_ssize_t n = archive_read_data(ctx->ar, out + produced, size - produced);
+        if (n < 0) return -1;  /* corrupt or truncated stream */
+        if (n == 0) {
+            ctx->done = true;
+            break;
+        }
+        produced += (size_t)n;
+    }
+
+    return (int64_t)produced;
+}
+
+static int64_t decompress_get_size(komparu_reader_t *self) {
+    (void)self;
+    return -1;
+}
+
+static void decompress_close(komparu_reader_t *self) {
+    if (!self) return;
+    decompress_ctx_t *ctx = (decompress_ctx_t *)self->ctx;
+    if (ctx) {
+        if (ctx->ar) archive_read_free(ctx->ar);
+        if (ctx->inner) ctx->inner->close(ctx->inner);
+        free(ctx);
+    }
+    free(self);
+}
+
+komparu_reader_t *komparu_reader_decompress_open(
+    komparu_reader_t *inner,
+    const char **err_msg
+) {
+    decompress_ctx_t *ctx = calloc(1, sizeof(decompress_ctx_t));
+    komparu_reader_t *reader = calloc(1, sizeof(komparu_reader_t));
+    if (!ctx || !reader) {
+        free(ctx);
+        free(reader);
+        *err_msg = "out of memory";
+        return NULL;
+    }
+    ctx->inner = inner;
+
+    /* libarchive rejects empty input; an empty source stays empty */
+    int64_t n = inner->read(inner, ctx->in, sizeof(ctx->in));
+    if (n < 0) {
+        free(ctx);
+        free(reader);
+        *err_msg = "read error";
+        return NULL;
+    }
+    ctx->primed = (size_t)n;
+
+    if (n > 0) {
+        struct archive *ar = archive_read_new();
+        if (!ar) {
+            free(ctx);
+            free(reader);
+            *err_msg = "out of memory";
+            return NULL;
+        }
+        archive_read_support_filter_gzip(ar);
+        archive_read_support_filter_bzip2(ar);
+        archive_read_support_filter_xz(ar);
+        archive_read_support_filter_zstd(ar);
+        archive_read_support_format_raw(ar);
+        archive_read_support_format_empty(ar);  /* compressed empty content */
+
+        struct archive_entry *entry;
+        int rc = archive_read_open(ar, ctx, NULL, decompress_in, NULL);
+        if (rc == ARCHIVE_OK) rc = archive_read_next_header(ar, &entry);
+        if (rc == ARCHIVE_EOF) {
+            ctx->done = true;
+        } else if (rc != ARCHIVE_OK) {
+            snprintf(decompress_errbuf, sizeof(decompress_errbuf),
+                     "cannot decompress: %s", archive_error_string(ar));
+            *err_msg = decompress_errbuf;
+            archive_read_free(ar);
+            free(ctx);
+            free(reader);
+            return NULL;
+        }
+        ctx->ar = ar;
+    }
+
+    reader->read = decompress_read;
+    reader->get_size = decompress_get_size;
+    reader->seek = NULL;
+    reader->close = decompress_close;
+    reader->ctx = ctx;
+    reader->source_name = inner->source_name;
+
+    return reader;
+}
@@ -7,9 +7,25 @@
  */
 
 #include "reader_file.h"
+#include "uring.h"
+#include "prefetch.h"
 #include <string.h>
 #include <stdlib.h>
 #include <errno.h>
+#ifdef KOMPARU_LINUX
+#include <sys/vfs.h>
+#include <sys/ioctl.h>
+#include <linux/fs.h>
+#elif defined(KOMPARU_MACOS) || defined(__FreeBSD__) || defined(__DragonFly__)
+#include <sys/ioctl.h>
+#include <sys/disk.h>
+#elif defined(KOMPARU_WINDOWS)
+#include <io.h>
+#endif
+
+#ifndef HUGETLBFS_MAGIC
+#define HUGETLBFS_MAGIC 0x958458f6
+#endif
 
 /* Thread-safe error message buffer */
 static _Thread_local char komparu_errbuf[256];
@@ -82,13 +98,29 @@ int komparu_sigbus_init(void) {
  * File reader context
  * ========================================================================= */
 
+/* Why a file of `size` bytes is not to be mapped, or NONE to try mmap */
+static komparu_io_fallback_t mmap_skipped(int64_t size, unsigned flags) {
+    if (size <= 0) return KOMPARU_FALLBACK_EMPTY_FILE;
+    if (flags & KOMPARU_FILE_BUFFERED) return KOMPARU_FALLBACK_BUFFERED;
+    if (!(flags & KOMPARU_FILE_MMAP) && size < KOMPARU_MMAP_THRESHOLD)
+        return KOMPARU_FALLBACK_BELOW_THRESHOLD;
+    return KOMPARU_FALLBACK_NONE;
+}
+
 #ifndef KOMPARU_WINDOWS
 
 typedef struct {
     int fd;
     void *mapped;       /* mmap base address, or NULL if using read() */
-    int64_t file_size;
+    int64_t file_size;  /* Visible bytes, from `start` to EOF */
+    int64_t start;      /* File offset the reader begins at (fd readers) */
     int64_t offset;     /* Current read position */
+    int64_t bytes_read; /* Total bytes delivered by read(), across seeks */
+    bool borrowed;      /* fd belongs to the caller; never closed */
+    bool sparse;        /* fewer blocks allocated than st_size: has holes */
+    komparu_uring_t *uring; /* io_uring readahead, or NULL */
+    komparu_prefetch_t *prefetch; /* readahead thread, or NULL */
+    komparu_io_info_t io;
     char source[1024];  /* Source path for error messages */
 } file_ctx_t;
 
@@ -112,10 +144,11 @@ static int64_t file_read_mmap(komparu_reader_t *self, void *buf, size_t size) {
         return -1;
     }
 
-    memcpy(buf, (const char *)ctx->mapped + ctx->offset, to_read);
+    memcpy(buf, (const char *)ctx->mapped + ctx->start + ctx->offset, to_read);
     sigbus_armed = 0;
 
     ctx->offset += (int64_t)to_read;
+    ctx->bytes_read += (int64_t)to_read;
     return (int64_t)to_read;
 }
 
@@ -136,9 +169,9 @@ static int file_seek(komparu_reader_t *self, int64_t offset) {
 static void file_close_mmap(komparu_reader_t *self) {
     file_ctx_t *ctx = (file_ctx_t *)self->ctx;
     if (ctx->mapped != MAP_FAILED && ctx->mapped != NULL) {
-        munmap(ctx->mapped, (size_t)ctx->file_size);
+        munmap(ctx->mapped, (size_t)(ctx->start + ctx->file_size));
     }
-    if (ctx->fd >= 0) {
+    if (ctx->fd >= 0 && !ctx->borrowed) {
         close(ctx->fd);
     }
     free(ctx);
@@ -157,6 +190,7 @@ static int64_t file_read_fallback(komparu_reader_t *self, void *buf, size_t size
         return -1;
     }
     ctx->offset += n;
+    ctx->bytes_read += n;
     return (int64_t)n;
 }
 
@@ -172,6 +206,59 @@ static int file_seek_fallback(komparu_reader_t *self, int64_t offset) {
 
 static void file_close_fallback(komparu_reader_t *self) {
     file_ctx_t *ctx = (file_ctx_t *)self->ctx;
+    if (ctx->fd >= 0 && !ctx->borrowed) {
+        close(ctx->fd);
+    }
+    free(ctx);
+    free(self);
+}
+
+/* ---- read via pread() (borrowed descriptors: file offset untouched) ---- */
+
+static int64_t file_read_pread(komparu_reader_t *self, void *buf, size_t size) {
+    file_ctx_t *ctx = (file_ctx_t *)self->ctx;
+    if (ctx->offset >= ctx->file_size) {
+        return 0;
+    }
+    size_t remaining = (size_t)(ctx->file_size - ctx->offset);
+    ssize_t n;
+    do {
+        n = pread(ctx->fd, buf, size < remaining ? size : remaining,
+                  (off_t)(ctx->start + ctx->offset));
+    } while (n < 0 && errno == EINTR);
+    if (n < 0) {
+        return -1;
+    }
+    ctx->offset += n;
+    ctx->bytes_read += n;
+    return (int64_t)n;
+}
+
+/* ---- read via io_uring readahead ---- */
+
+static int64_t file_read_uring(komparu_reader_t *self, void *buf, size_t size) {
+    file_ctx_t *ctx = (file_ctx_t *)self->ctx;
+    int64_t n = komparu_uring_read(ctx->uring, buf, size);
+    if (n < 0) {
+        return -1;
+    }
+    ctx->offset += n;
+    ctx->bytes_read += n;
+    return n;
+}
+
+static int file_seek_uring(komparu_reader_t *self, int64_t offset) {
+    file_ctx_t *ctx = (file_ctx_t *)self->ctx;
+    if (komparu_uring_seek(ctx->uring, offset) != 0) {
+        return -1;
+    }
+    ctx->offset = offset;
+    return 0;
+}
+
+static void file_close_uring(komparu_reader_t *self) {
+    file_ctx_t *ctx = (file_ctx_t *)self->ctx;
+    komparu_uring_close(ctx->uring);
     if (ctx->fd >= 0) {
         close(ctx->fd);
     }
@@ -179,9 +266,100 @@ static void file_close_fallback(komparu_reader_t *self) {
     free(self);
 }
 
-/* ---- constructor ---- */
+/* ---- read via the prefetch thread ---- */
 
-komparu_reader_t *komparu_reader_file_open(const char *path, const char **err_msg) {
+static int64_t file_read_prefetch(komparu_reader_t *self, void *buf, size_t size) {
+    file_ctx_t *ctx = (file_ctx_t *)self->ctx;
+    int64_t n = komparu_prefetch_read(ctx->prefetch, buf, size);
+    if (n < 0) {
+        return -1;
+    }
+    ctx->offset += n;
+    ctx->bytes_read += n;
+    return n;
+}
+
+static int file_seek_prefetch(komparu_reader_t *self, int64_t offset) {
+    file_ctx_t *ctx = (file_ctx_t *)self->ctx;
+    if (komparu_prefetch_seek(ctx->prefetch, offset) != 0) {
+        return -1;
+    }
+    ctx->offset = offset;
+    return 0;
+}
+
+static void file_close_prefetch(komparu_reader_t *self) {
+    file_ctx_t *ctx = (file_ctx_t *)self->ctx;
+    komparu_prefetch_close(ctx->prefetch);
+    if (ctx->fd >= 0) {
+        close(ctx->fd);
+    }
+    free(ctx);
+    free(self);
+}
+
+/*
+ * MAP_HUGETLB only applies to anonymous and hugetlbfs mappings, and a
+ * hugetlbfs file is mapped with huge pages without it. For files on
+ * other filesystems, ask for transparent huge pages instead.
+ */
+static void request_huge_pages(int fd, void *mapped, size_t len,
+                               komparu_io_info_t *io) {
+#ifdef KOMPARU_LINUX
+    struct statfs sfs;
+    if (fstatfs(fd, &sfs) == 0 && (unsigned long)sfs.f_type == HUGETLBFS_MAGIC) {
+        io->huge = KOMPARU_HUGE_HUGETLBFS;
+        return;
+    }
+#else
+    (void)fd;
+#endif
+#ifdef MADV_HUGEPAGE
+    if (madvise(mapped, len, MADV_HUGEPAGE) == 0) {
+        io->huge = KOMPARU_HUGE_MADVISE;
+        return;
+    }
+    io->huge_error = errno;
+#else
+    (void)mapped;
+    (void)len;
+    io->huge_error = ENOTSUP;
+#endif
+    io->huge = KOMPARU_HUGE_REFUSED;
+}
+
+/*
+ * Full extent of a block device in bytes. st_size is 0 for device nodes,
+ * so ask the driver. Returns -1 with errno set if it cannot be queried.
+ */
+static int64_t block_device_size(int fd) {
+#if defined(KOMPARU_LINUX) && defined(BLKGETSIZE64)
+    uint64_t bytes;
+    if (ioctl(fd, BLKGETSIZE64, &bytes) != 0) return -1;
+    return (int64_t)bytes;
+#elif defined(DKIOCGETBLOCKCOUNT) && defined(DKIOCGETBLOCKSIZE)
+    uint64_t count;
+    uint32_t block;
+    if (ioctl(fd, DKIOCGETBLOCKCOUNT, &count) != 0 ||
+        ioctl(fd, DKIOCGETBLOCKSIZE, &block) != 0) return -1;
+    return (int64_t)(count * block);
+#elif defined(DIOCGMEDIASIZE)
+    off_t bytes;
+    if (ioctl(fd, DIOCGMEDIASIZE, &bytes) != 0) return -1;
+    return (int64_t)bytes;
+#else
+    /* Fall back to the end offset, which most systems report for devices */
+    off_t end = lseek(fd, 0, SEEK_END);
+    if (end < 0 || lseek(fd, 0, SEEK_SET) != 0) return -1;
+    return (int64_t)end;
+#endif
+}
+
+/* ---- constructors ---- */
+
+/* Open `path` and allocate the reader; I/O callbacks are left to the caller. */
+static komparu_reader_t *file_reader_new(const char *path, unsigned flags,
+                                         const char **err_msg) {
     int fd = open(path, O_RDONLY);
     if (fd < 0) {
         komparu_strerror(errno, komparu_errbuf, sizeof(komparu_errbuf));
@@ -197,8 +375,22 @@ komparu_reader_t *komparu_reader_file_open(const char *path, const char **err_ms
         return NULL;
     }
 
-    /* Reject non-regular files (directories, devices, pipes, sockets) */
-    if (!S_ISREG(st.st_mode)) {
+    /* Reject non-regular files (directories, devices, pipes, sockets),
+     * except block devices when the caller asked for them */
+    int64_t size = (int64_t)st.st_size;
+    if (S_ISBLK(st.st_mode) && (flags & KOMPARU_FILE_BLOCK_DEVICES)) {
+        size = block_device_size(fd);
+        if (size < 0) {
+            komparu_strerror(errno, komparu_errbuf, sizeof(komparu_errbuf));
+            *err_msg = komparu_errbuf;
+            close(fd);
+            return NULL;
+        }
+    } else if (S_ISDIR(st.st_mode)) {
+        *err_msg = KOMPARU_ERR_IS_DIRECTORY;
+        close(fd);
+        return NULL;
+    } else if (!S_ISREG(st.st_mode)) {
         *err_msg = "not a regular file";
         close(fd);
         return NULL;
@@ -216,20 +408,48 @@ komparu_reader_t *komparu_reader_file_open(const char *path, const char **err_ms
     }
 
     ctx->fd = fd;
-    ctx->file_size = (int64_t)st.st_size;
+    ctx->file_size = size;
     ctx->offset = 0;
+    ctx->sparse = S_ISREG(st.st_mode) && (int64_t)st.st_blocks * 512 < size;
     snprintf(ctx->source, sizeof(ctx->source), "%s", path);
 
     reader->ctx = ctx;
     reader->source_name = ctx->source;
     reader->get_size = file_get_size;
+    return reader;
+}
 
-    /* Try mmap for non-empty files */
-    if (st.st_size > 0) {
-        void *mapped = mmap(NULL, (size_t)st.st_size, PROT_READ, MAP_PRIVATE, fd, 0);
+static void file_use_read(komparu_reader_t *reader) {
+    file_ctx_t *ctx = (file_ctx_t *)reader->ctx;
+    ctx->mapped = NULL;
+    reader->read = file_read_fallback;
+    reader->seek = file_seek_fallback;
+    reader->close = file_close_fallback;
+}
+
+komparu_reader_t *komparu_reader_file_open_ex(
+    const char *path,
+    unsigned flags,
+    const char **err_msg
+) {
+    komparu_reader_t *reader = file_reader_new(path, flags, err_msg);
+    if (!reader) return NULL;
+    file_ctx_t *ctx = (file_ctx_t *)reader->ctx;
+    int fd = ctx->fd;
+    size_t size = (size_t)ctx->file_size;
+
+    /* Try mmap for non-empty files, unless the strategy says otherwise */
+    ctx->io.path = KOMPARU_IO_READ;
+    ctx->io.fallback = mmap_skipped(ctx->file_size, flags);
+    if (ctx->io.fallback == KOMPARU_FALLBACK_NONE) {
+        void *mapped = mmap(NULL, size, PROT_READ, MAP_PRIVATE, fd, 0);
         if (mapped != MAP_FAILED) {
+            ctx->io.path = KOMPARU_IO_MMAP;
+            ctx->io.fallback = KOMPARU_FALLBACK_NONE;
             /* Advise sequential access */
-            madvise(mapped, (size_t)st.st_size, MADV_SEQUENTIAL);
+            madvise(mapped, size, MADV_SEQUENTIAL);
+            if (flags & KOMPARU_FILE_HUGE_PAGES)
+                request_huge_pages(fd, mapped, size, &ctx->io);
             ctx->mapped = mapped;
             reader->read = file_read_mmap;
             reader->seek = file_seek;
@@ -237,16 +457,225 @@ komparu_reader_t *komparu_reader_file_open(const char *path, const char **err_ms
             return reader;
         }
         /* mmap failed — fall through to read() */
+        ctx->io.error = errno;
+        ctx->io.fallback = (errno == ENODEV || errno == EINVAL)
+            ? KOMPARU_FALLBACK_MMAP_UNSUPPORTED
+            : KOMPARU_FALLBACK_MMAP_FAILED;
     }
 
     /* Fallback: buffered read() */
+    file_use_read(reader);
+    return reader;
+}
+
+komparu_reader_t *komparu_reader_file_open_uring(
+    const char *path,
+    unsigned depth,
+    unsigned flags,
+    const char **err_msg
+) {
+    komparu_reader_t *reader = file_reader_new(path, flags, err_msg);
+    if (!reader) return NULL;
+    file_ctx_t *ctx = (file_ctx_t *)reader->ctx;
+
+    ctx->io.path = KOMPARU_IO_READ;
+    ctx->io.fallback = KOMPARU_FALLBACK_EMPTY_FILE;
+    if (ctx->file_size > 0) {
+        ctx->uring = komparu_uring_open(ctx->fd, ctx->file_size, depth);
+        if (ctx->uring) {
+            ctx->io.path = KOMPARU_IO_URING;
+            ctx->io.fallback = KOMPARU_FALLBACK_NONE;
+            reader->read = file_read_uring;
+            reader->seek = file_seek_uring;
+            reader->close = file_close_uring;
+            return reader;
+        }
+        /* ENOSYS, EPERM (sysctl/seccomp), ENOMEM... — plain read() */
+        ctx->io.error = errno;
+        ctx->io.fallback = KOMPARU_FALLBACK_URING_UNAVAILABLE;
+    }
+
+    file_use_read(reader);
+    return reader;
+}
+
+komparu_reader_t *komparu_reader_file_open_prefetch(
+    const char *path,
+    size_t block_size,
+    unsigned flags,
+    const char **err_msg
+) {
+    komparu_reader_t *reader = file_reader_new(path, flags, err_msg);
+    if (!reader) return NULL;
+    file_ctx_t *ctx = (file_ctx_t *)reader->ctx;
+
+    ctx->io.path = KOMPARU_IO_READ;
+    ctx->io.fallback = KOMPARU_FALLBACK_EMPTY_FILE;
+    if (ctx->file_size > 0) {
+        ctx->prefetch = komparu_prefetch_open(ctx->fd, ctx->file_size, block_size);
+        if (ctx->prefetch) {
+            ctx->io.path = KOMPARU_IO_PREFETCH;
+            ctx->io.fallback = KOMPARU_FALLBACK_NONE;
+            reader->read = file_read_prefetch;
+            reader->seek = file_seek_prefetch;
+            reader->close = file_close_prefetch;
+            return reader;
+        }
+        /* EAGAIN (thread limit), ENOMEM — plain read() */
+        ctx->io.error = errno;
+        ctx->io.fallback = KOMPARU_FALLBACK_PREFETCH_UNAVAILABLE;
+    }
+
+    file_use_read(reader);
+    return reader;
+}
+
+komparu_reader_t *komparu_reader_file_from_fd(
+    int fd,
+    int64_t start,
+    const char **err_msg
+) {
+    struct stat st;
+    if (fstat(fd, &st) != 0) {
+        komparu_strerror(errno, komparu_errbuf, sizeof(komparu_errbuf));
+        *err_msg = komparu_errbuf;
+        return NULL;
+    }
+    if (!S_ISREG(st.st_mode)) {
+        *err_msg = "not a regular file";
+        return NULL;
+    }
+    if (start < 0) {
+        off_t cur = lseek(fd, 0, SEEK_CUR);
+        if (cur < 0) {
+            komparu_strerror(errno, komparu_errbuf, sizeof(komparu_errbuf));
+            *err_msg = komparu_errbuf;
+            return NULL;
+        }
+        start = (int64_t)cur;
+    }
+    /* Past EOF reads as empty, like read() would */
+    int64_t end = (int64_t)st.st_size;
+    if (start > end) start = end;
+
+    komparu_reader_t *reader = calloc(1, sizeof(komparu_reader_t));
+    file_ctx_t *ctx = calloc(1, sizeof(file_ctx_t));
+    if (!reader || !ctx) {
+        *err_msg = "out of memory";
+        free(reader);
+        free(ctx);
+        return NULL;
+    }
+
+    ctx->fd = fd;
+    ctx->borrowed = true;
+    ctx->start = start;
+    ctx->file_size = end - start;
+    ctx->sparse = (int64_t)st.st_blocks * 512 < end;
+    snprintf(ctx->source, sizeof(ctx->source), "<fd %d>", fd);
+
+    reader->ctx = ctx;
+    reader->source_name = ctx->source;
+    reader->get_size = file_get_size;
+    reader->seek = file_seek;
+
+    /* Map the whole file (mmap offsets must be page-aligned) and read
+     * from `start`; the descriptor's open flags are left as they are */
+    ctx->io.path = KOMPARU_IO_READ;
+    ctx->io.fallback = KOMPARU_FALLBACK_EMPTY_FILE;
+    if (ctx->file_size > 0) {
+        void *mapped = mmap(NULL, (size_t)end, PROT_READ, MAP_PRIVATE, fd, 0);
+        if (mapped != MAP_FAILED) {
+            ctx->io.path = KOMPARU_IO_MMAP;
+            ctx->io.fallback = KOMPARU_FALLBACK_NONE;
+            madvise(mapped, (size_t)end, MADV_SEQUENTIAL);
+            ctx->mapped = mapped;
+            reader->read = file_read_mmap;
+            reader->close = file_close_mmap;
+            return reader;
+        }
+        ctx->io.error = errno;
+        ctx->io.fallback = (errno == ENODEV || errno == EINVAL)
+            ? KOMPARU_FALLBACK_MMAP_UNSUPPORTED
+            : KOMPARU_FALLBACK_MMAP_FAILED;
+    }
+
     ctx->mapped = NULL;
-    reader->read = file_read_fallback;
-    reader->seek = file_seek_fallback;
+    reader->read = file_read_pread;
     reader->close = file_close_fallback;
     return reader;
 }
 
+int komparu_reader_file_io(komparu_reader_t *reader, komparu_io_info_t *out) {
+    if (!reader || reader->get_size != file_get_size) return -1;
+    *out = ((file_ctx_t *)reader->ctx)->io;
+    return 0;
+}
+
+int64_t komparu_reader_file_bytes_read(komparu_reader_t *reader) {
+    if (!reader || reader->get_size != file_get_size) return -1;
+    return ((file_ctx_t *)reader->ctx)->bytes_read;
+}
+
+int64_t komparu_reader_file_offset(komparu_reader_t *reader) {
+    if (!reader || reader->get_size != file_get_size) return -1;
+    return ((file_ctx_t *)reader->ctx)->offset;
+}
+
+/* ---- hole map via SEEK_DATA / SEEK_HOLE ---- */
+
+bool komparu_reader_file_sparse(komparu_reader_t *reader) {
+#if defined(SEEK_DATA) && defined(SEEK_HOLE)
+    return reader && reader->get_size == file_get_size
+        && ((file_ctx_t *)reader->ctx)->sparse;
+#else
+    return false;
+#endif
+}
+
+int komparu_reader_file_extent(
+    komparu_reader_t *reader,
+    int64_t offset,
+    int64_t *data,
+    int64_t *hole
+) {
+#if defined(SEEK_DATA) && defined(SEEK_HOLE)
+    if (!komparu_reader_file_sparse(reader)) return -1;
+    file_ctx_t *ctx = (file_ctx_t *)reader->ctx;
+    if (offset < 0 || offset > ctx->file_size) return -1;
+    if (offset == ctx->file_size) {
+        *data = *hole = offset;
+        return 0;
+    }
+
+    /* read() fallbacks and borrowed descriptors rely on the file offset */
+    off_t saved = lseek(ctx->fd, 0, SEEK_CUR);
+    if (saved < 0) return -1;
+    int rc = 0;
+    int64_t end = ctx->start + ctx->file_size;
+    off_t d = lseek(ctx->fd, (off_t)(ctx->start + offset), SEEK_DATA);
+    off_t h = d;
+    if (d < 0 && errno == ENXIO) {
+        d = h = (off_t)end;            /* only a hole remains */
+    } else if (d < 0) {
+        rc = -1;
+    } else if (d < end) {
+        h = lseek(ctx->fd, d, SEEK_HOLE);
+        if (h < 0) rc = -1;
+    }
+    if (lseek(ctx->fd, saved, SEEK_SET) < 0) rc = -1;
+    if (rc != 0) return -1;
+
+    /* The file may have grown since it was opened */
+    *data = (d < end ? (int64_t)d : end) - ctx->start;
+    *hole = (h < end ? (int64_t)h : end) - ctx->start;
+    return 0;
+#else
+    (void)reader; (void)offset; (void)data; (void)hole;
+    return -1;
+#endif
+}
+
 #else /* KOMPARU_WINDOWS */
 
 /* =========================================================================
@@ -258,7 +687,11 @@ typedef struct {
     HANDLE hMapping;
     void *mapped;
     int64_t file_size;
+    int64_t start;      /* file offset the reader begins at (fd readers) */
     int64_t offset;
+    int64_t bytes_read;
+    bool borrowed;      /* hFile belongs to the caller's descriptor */
+    komparu_io_info_t io;
     char source[1024];
 } file_ctx_win_t;
 
@@ -273,7 +706,7 @@ static int64_t file_read_win(komparu_reader_t *self, void *buf, size_t size) {
         size_t to_read = (size < remaining) ? size : remaining;
 
         __try {
-            memcpy(buf, (const char *)ctx->mapped + ctx->offset, to_read);
+            memcpy(buf, (const char *)ctx->mapped + ctx->start + ctx->offset, to_read);
         } __except (GetExceptionCode() == EXCEPTION_IN_PAGE_ERROR
                         ? EXCEPTION_EXECUTE_HANDLER
                         : EXCEPTION_CONTINUE_SEARCH) {
@@ -281,15 +714,31 @@ static int64_t file_read_win(komparu_reader_t *self, void *buf, size_t size) {
         }
 
         ctx->offset += (int64_t)to_read;
+        ctx->bytes_read += (int64_t)to_read;
         return (int64_t)to_read;
     } else {
         /* ReadFile fallback */
         DWORD to_read = (size > MAXDWORD) ? MAXDWORD : (DWORD)size;
         DWORD bytes_read = 0;
-        if (!ReadFile(ctx->hFile, buf, to_read, &bytes_read, NULL)) {
+        if (ctx->borrowed) {
+            /* Positioned read from start; a synchronous handle still
+             * moves its file pointer past the bytes read */
+            if (ctx->offset >= ctx->file_size) return 0;
+            int64_t remaining = ctx->file_size - ctx->offset;
+            if ((int64_t)to_read > remaining) to_read = (DWORD)remaining;
+            OVERLAPPED ov = {0};
+            int64_t pos = ctx->start + ctx->offset;
+            ov.Offset = (DWORD)(pos & 0xFFFFFFFF);
+            ov.OffsetHigh = (DWORD)(pos >> 32);
+            if (!ReadFile(ctx->hFile, buf, to_read, &bytes_read, &ov) &&
+                GetLastError() != ERROR_HANDLE_EOF) {
+                return -1;
+            }
+        } else if (!ReadFile(ctx->hFile, buf, to_read, &bytes_read, NULL)) {
             return -1;
         }
         ctx->offset += bytes_read;
+        ctx->bytes_read += bytes_read;
         return (int64_t)bytes_read;
     }
 }
@@ -302,7 +751,7 @@ static int64_t file_get_size_win(komparu_reader_t *self) {
 static int file_seek_win(komparu_reader_t *self, int64_t offset) {
     file_ctx_win_t *ctx = (file_ctx_win_t *)self->ctx;
 
-    if (ctx->mapped) {
+    if (ctx->mapped || ctx->borrowed) {
         if (offset < 0 || offset > ctx->file_size) return -1;
         ctx->offset = offset;
         return 0;
@@ -321,12 +770,17 @@ static void file_close_win(komparu_reader_t *self) {
     file_ctx_win_t *ctx = (file_ctx_win_t *)self->ctx;
     if (ctx->mapped) UnmapViewOfFile(ctx->mapped);
     if (ctx->hMapping) CloseHandle(ctx->hMapping);
-    if (ctx->hFile != INVALID_HANDLE_VALUE) CloseHandle(ctx->hFile);
+    if (ctx->hFile != INVALID_HANDLE_VALUE && !ctx->borrowed) CloseHandle(ctx->hFile);
     free(ctx);
     free(self);
 }
 
-komparu_reader_t *komparu_reader_file_open(const char *path, const char **err_msg) {
+komparu_reader_t *komparu_reader_file_open_ex(
+    const char *path,
+    unsigned flags,
+    const char **err_msg
+) {
+    /* Huge pages are Linux-only; devices open as files */
     HANDLE hFile = CreateFileA(
         path, GENERIC_READ, FILE_SHARE_READ, NULL,
         OPEN_EXISTING, FILE_ATTRIBUTE_NORMAL, NULL
@@ -364,18 +818,24 @@ komparu_reader_t *komparu_reader_file_open(const char *path, const char **err_ms
     reader->seek = file_seek_win;
     reader->close = file_close_win;
 
-    /* Try memory mapping for non-empty files */
-    if (size.QuadPart > 0) {
+    /* Try memory mapping for non-empty files, unless the strategy says otherwise */
+    ctx->io.path = KOMPARU_IO_READ;
+    ctx->io.fallback = mmap_skipped(size.QuadPart, flags);
+    if (ctx->io.fallback == KOMPARU_FALLBACK_NONE) {
         HANDLE hMapping = CreateFileMappingA(hFile, NULL, PAGE_READONLY, 0, 0, NULL);
         if (hMapping) {
             void *mapped = MapViewOfFile(hMapping, FILE_MAP_READ, 0, 0, 0);
             if (mapped) {
                 ctx->hMapping = hMapping;
                 ctx->mapped = mapped;
+                ctx->io.path = KOMPARU_IO_MMAP;
+                ctx->io.fallback = KOMPARU_FALLBACK_NONE;
                 return reader;
             }
             CloseHandle(hMapping);
         }
+        ctx->io.error = (int)GetLastError();
+        ctx->io.fallback = KOMPARU_FALLBACK_MMAP_FAILED;
     }
 
     /* Fallback: ReadFile */
@@ -384,4 +844,186 @@ komparu_reader_t *komparu_reader_file_open(const char *path, const char **err_ms
     return reader;
 }
 
+/* No io_uring on Windows: plain ReadFile, reported as a fallback */
+komparu_reader_t *komparu_reader_file_open_uring(
+    const char *path,
+    unsigned depth,
+    unsigned flags,
+    const char **err_msg
+) {
+    (void)depth;
+    komparu_reader_t *reader = komparu_reader_file_open_ex(path, flags, err_msg);
+    if (!reader) return NULL;
+    file_ctx_win_t *ctx = (file_ctx_win_t *)reader->ctx;
+    if (ctx->mapped) {
+        UnmapViewOfFile(ctx->mapped);
+        CloseHandle(ctx->hMapping);
+        ctx->mapped = NULL;
+        ctx->hMapping = NULL;
+    }
+    ctx->io.path = KOMPARU_IO_READ;
+    if (ctx->file_size > 0) {
+        ctx->io.fallback = KOMPARU_FALLBACK_URING_UNAVAILABLE;
+        ctx->io.error = ERROR_NOT_SUPPORTED;
+    }
+    return reader;
+}
+
+/* No prefetch thread on Windows: plain ReadFile, reported as a fallback */
+komparu_reader_t *komparu_reader_file_open_prefetch(
+    const char *path,
+    size_t block_size,
+    unsigned flags,
+    const char **err_msg
+) {
+    (void)block_size;
+    komparu_reader_t *reader = komparu_reader_file_open_ex(path, flags, err_msg);
+    if (!reader) return NULL;
+    file_ctx_win_t *ctx = (file_ctx_win_t *)reader->ctx;
+    if (ctx->mapped) {
+        UnmapViewOfFile(ctx->mapped);
+        CloseHandle(ctx->hMapping);
+        ctx->mapped = NULL;
+        ctx->hMapping = NULL;
+    }
+    ctx->io.path = KOMPARU_IO_READ;
+    if (ctx->file_size > 0) {
+        ctx->io.fallback = KOMPARU_FALLBACK_PREFETCH_UNAVAILABLE;
+        ctx->io.error = ERROR_NOT_SUPPORTED;
+    }
+    return reader;
+}
+
+komparu_reader_t *komparu_reader_file_from_fd(
+    int fd,
+    int64_t start,
+    const char **err_msg
+) {
+    HANDLE hFile = (HANDLE)_get_osfhandle(fd);
+    if (hFile == INVALID_HANDLE_VALUE) {
+        *err_msg = "bad file descriptor";
+        return NULL;
+    }
+    if (GetFileType(hFile) != FILE_TYPE_DISK) {
+        *err_msg = "not a regular file";
+        return NULL;
+    }
+
+    LARGE_INTEGER size;
+    if (!GetFileSizeEx(hFile, &size)) {
+        *err_msg = "cannot get file size";
+        return NULL;
+    }
+    if (start < 0) {
+        LARGE_INTEGER zero = {0}, cur;
+        if (!SetFilePointerEx(hFile, zero, &cur, FILE_CURRENT)) {
+            *err_msg = "cannot get file position";
+            return NULL;
+        }
+        start = cur.QuadPart;
+    }
+    if (start > size.QuadPart) start = size.QuadPart;
+
+    komparu_reader_t *reader = calloc(1, sizeof(komparu_reader_t));
+    file_ctx_win_t *ctx = calloc(1, sizeof(file_ctx_win_t));
+    if (!reader || !ctx) {
+        *err_msg = "out of memory";
+        free(reader); free(ctx);
+        return NULL;
+    }
+
+    ctx->hFile = hFile;
+    ctx->borrowed = true;
+    ctx->start = start;
+    ctx->file_size = size.QuadPart - start;
+    snprintf(ctx->source, sizeof(ctx->source), "<fd %d>", fd);
+
+    reader->ctx = ctx;
+    reader->source_name = ctx->source;
+    reader->get_size = file_get_size_win;
+    reader->read = file_read_win;
+    reader->seek = file_seek_win;
+    reader->close = file_close_win;
+
+    ctx->io.path = KOMPARU_IO_READ;
+    ctx->io.fallback = KOMPARU_FALLBACK_EMPTY_FILE;
+    if (ctx->file_size > 0) {
+        HANDLE hMapping = CreateFileMappingA(hFile, NULL, PAGE_READONLY, 0, 0, NULL);
+        if (hMapping) {
+            void *mapped = MapViewOfFile(hMapping, FILE_MAP_READ, 0, 0, 0);
+            if (mapped) {
+                ctx->hMapping = hMapping;
+                ctx->mapped = mapped;
+                ctx->io.path = KOMPARU_IO_MMAP;
+                ctx->io.fallback = KOMPARU_FALLBACK_NONE;
+                return reader;
+            }
+            CloseHandle(hMapping);
+        }
+        ctx->io.error = (int)GetLastError();
+        ctx->io.fallback = KOMPARU_FALLBACK_MMAP_FAILED;
+    }
+    return reader;
+}
+
+int komparu_reader_file_io(komparu_reader_t *reader, komparu_io_info_t *out) {
+    if (!reader || reader->get_size != file_get_size_win) return -1;
+    *out = ((file_ctx_win_t *)reader->ctx)->io;
+    return 0;
+}
+
+int64_t komparu_reader_file_bytes_read(komparu_reader_t *reader) {
+    if (!reader || reader->get_size != file_get_size_win) return -1;
+    return ((file_ctx_win_t *)reader->ctx)->bytes_read;
+}
+
+int64_t komparu_reader_file_offset(komparu_reader_t *reader) {
+    if (!reader || reader->get_size != file_get_size_win) return -1;
+    return ((file_ctx_win_t *)reader->ctx)->offset;
+}
+
+/* Holes are not located on Windows; sparse files are read in full */
+bool komparu_reader_file_sparse(komparu_reader_t *reader) {
+    (void)reader;
+    return false;
+}
+
+int komparu_reader_file_extent(
+    komparu_reader_t *reader,
+    int64_t offset,
+    int64_t *data,
+    int64_t *hole
+) {
+    (void)reader; (void)offset; (void)data; (void)hole;
+    return -1;
+}
+
 #endif /* KOMPARU_WINDOWS */
+
+komparu_reader_t *komparu_reader_file_open(const char *path, const char **err_msg) {
+    return komparu_reader_file_open_ex(path, 0, err_msg);
+}
+
+const char *komparu_huge_pages_str(komparu_huge_pages_t huge) {
+    switch (huge) {
+        case KOMPARU_HUGE_NONE:      return "none";
+        case KOMPARU_HUGE_HUGETLBFS: return "hugetlbfs";
+        case KOMPARU_HUGE_MADVISE:   return "madvise";
+        case KOMPARU_HUGE_REFUSED:   return "refused";
+        default:                     return "unknown";
+    }
+}
+
+const char *komparu_io_fallback_str(komparu_io_fallback_t fallback) {
+    switch (fallback) {
+        case KOMPARU_FALLBACK_NONE:             return "none";
+        case KOMPARU_FALLBACK_EMPTY_FILE:       return "empty_file";
+        case KOMPARU_FALLBACK_MMAP_UNSUPPORTED: return "mmap_unsupported";
+        case KOMPARU_FALLBACK_MMAP_FAILED:      return "mmap_failed";
+        case KOMPARU_FALLBACK_URING_UNAVAILABLE: return "uring_unavailable";
+        case KOMPARU_FALLBACK_BELOW_THRESHOLD:  return "below_threshold";
+        case KOMPARU_FALLBACK_BUFFERED:         return "buffered";
+        case KOMPARU_FALLBACK_PREFETCH_UNAVAILABLE: return "prefetch_unavailable";
+        default:                                return "unknown";
+    }
+}
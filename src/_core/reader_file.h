@@ -18,4 +18,82 @@
  */
 int komparu_sigbus_init(void);
 
+/** I/O path chosen when a local file reader was opened. */
+typedef enum {
+    KOMPARU_IO_MMAP = 0,
+    KOMPARU_IO_READ = 1,       /* buffered read() / ReadFile */
+    KOMPARU_IO_URING = 2,      /* io_uring readahead (Linux) */
+    KOMPARU_IO_PREFETCH = 3,   /* double-buffered readahead thread */
+} komparu_io_path_t;
+
+/** Why a file reader fell back from mmap (io_uring, prefetch) to buffered reads. */
+typedef enum {
+    KOMPARU_FALLBACK_NONE = 0,
+    KOMPARU_FALLBACK_EMPTY_FILE,       /* nothing to map */
+    KOMPARU_FALLBACK_MMAP_UNSUPPORTED, /* filesystem cannot mmap (ENODEV etc.) */
+    KOMPARU_FALLBACK_MMAP_FAILED,      /* mmap refused for another reason */
+    KOMPARU_FALLBACK_URING_UNAVAILABLE, /* io_uring requested but not set up */
+    KOMPARU_FALLBACK_BELOW_THRESHOLD,  /* smaller than KOMPARU_MMAP_THRESHOLD */
+    KOMPARU_FALLBACK_BUFFERED,         /* KOMPARU_FILE_BUFFERED requested */
+    KOMPARU_FALLBACK_PREFETCH_UNAVAILABLE, /* prefetch thread not started */
+} komparu_io_fallback_t;
+
+/** Outcome of a KOMPARU_FILE_HUGE_PAGES request. */
+typedef enum {
+    KOMPARU_HUGE_NONE = 0,             /* not requested, or file not mapped */
+    KOMPARU_HUGE_HUGETLBFS,            /* file lives on hugetlbfs: mapping is huge already */
+    KOMPARU_HUGE_MADVISE,              /* MADV_HUGEPAGE accepted */
+    KOMPARU_HUGE_REFUSED,              /* kernel or platform refused */
+} komparu_huge_pages_t;
+
+typedef struct {
+    komparu_io_path_t path;
+    komparu_io_fallback_t fallback;
+    int error;                         /* errno / GetLastError() of failed map or ring, or 0 */
+    komparu_huge_pages_t huge;
+    int huge_error;                    /* errno of a refused huge page request, or 0 */
+} komparu_io_info_t;
+
+/**
+ * Report the I/O path of a reader from komparu_reader_file_open().
+ * Returns 0 and fills *out, or -1 if `reader` is not a local file reader.
+ */
+int komparu_reader_file_io(komparu_reader_t *reader, komparu_io_info_t *out);
+
+/**
+ * Bytes delivered by read() so far, including quick-check samples.
+ * Returns -1 if `reader` is not a local file reader.
+ */
+int64_t komparu_reader_file_bytes_read(komparu_reader_t *reader);
+
+/** Current read position, or -1 if `reader` is not a local file reader. */
+int64_t komparu_reader_file_offset(komparu_reader_t *reader);
+
+/**
+ * True if `reader` is a local file reader over a file with holes (fewer
+ * blocks allocated than its size) on a platform that can locate them
+ * with SEEK_DATA / SEEK_HOLE.
+ */
+bool komparu_reader_file_sparse(komparu_reader_t *reader);
+
+/**
+ * Locate the next data extent of a sparse file at or after `offset`:
+ * *data receives its start (`offset` itself inside data, the size when
+ * only a hole remains) and *hole its end. Offsets are relative to the
+ * reader's start; the descriptor's file offset is left as it was.
+ * Returns 0, or -1 if `reader` is not sparse or the lookup failed.
+ */
+int komparu_reader_file_extent(
+    komparu_reader_t *reader,
+    int64_t offset,
+    int64_t *data,
+    int64_t *hole
+);
+
+/** Stable lowercase name for a fallback reason ("none", "empty_file", ...). */
+const char *komparu_io_fallback_str(komparu_io_fallback_t fallback);
+
+/** Stable lowercase name for a huge page outcome ("none", "madvise", ...). */
+const char *komparu_huge_pages_str(komparu_huge_pages_t huge);
+
 #endif /* KOMPARU_READER_FILE_H */
@@ -0,0 +1,62 @@
+/**
+ * reader_transform.c — Apply per-source content transforms to a reader.
+ *
+ * Transforms are layered as reader decorators in a fixed order:
+ *   1. decompress (gzip / bzip2 / xz / zstd, detected by magic)
+ *   2. window  (header_skip / footer_skip / length on the content)
+ *   3. decode  (base64 / hex)
+ *   4. byte_map (equivalence classes, one representative per class)
+ *   5. collapse_zeros (runs of 0x00 read as one zero byte)
+ */
+
+#include "reader.h"
+
+bool komparu_transform_is_identity(const komparu_transform_t *t) {
+    return !t || (!t->decompress && t->header_skip == 0 && t->footer_skip == 0 &&
+                  !t->has_length && t->decode == KOMPARU_DECODE_NONE &&
+                  !t->has_byte_map && !t->collapse_zeros);
+}
+
+int komparu_reader_apply_transform(
+    komparu_reader_t **reader,
+    const komparu_transform_t *t,
+    const char **err_msg
+) {
+    if (komparu_transform_is_identity(t)) return 0;
+
+    if (t->decompress) {
+        komparu_reader_t *dc = komparu_reader_decompress_open(*reader, err_msg);
+        if (!dc) return -1;
+        *reader = dc;
+    }
+
+    if (t->header_skip > 0 || t->footer_skip > 0 || t->has_length) {
+        komparu_reader_t *win = komparu_reader_window_open(
+            *reader, t->header_skip, t->footer_skip, err_msg);
+        if (!win) return -1;
+        if (t->has_length) komparu_reader_window_cap(win, t->length);
+        *reader = win;
+    }
+
+    if (t->decode != KOMPARU_DECODE_NONE) {
+        komparu_reader_t *dec = komparu_reader_decode_open(
+            *reader, t->decode, err_msg);
+        if (!dec) return -1;
+        *reader = dec;
+    }
+
+    if (t->has_byte_map) {
+        komparu_reader_t *bm = komparu_reader_bytemap_open(
+            *reader, t->byte_map, err_msg);
+        if (!bm) return -1;
+        *reader = bm;
+    }
+
+    if (t->collapse_zeros) {
+        komparu_reader_t *z = komparu_reader_zeros_open(*reader, err_msg);
+        if (!z) return -1;
+        *reader = z;
+    }
+
+    return 0;
+}
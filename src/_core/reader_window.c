@@ -0,0 +1,134 @@
+/**
+ * reader_window.c — Windowed view over another reader.
+ *
+ * Exposes only the region [header_skip, size - footer_skip) of the
+ * inner reader. Offsets seen by callers are relative to the window
+ * start, so komparu_compare / komparu_quick_check work unchanged.
+ */
+
+#include "reader.h"
+#include <stdlib.h>
+#include <string.h>
+
+typedef struct {
+    komparu_reader_t *inner;  /* owned */
+    int64_t start;            /* absolute offset of window start */
+    int64_t length;           /* window length, or -1 if unbounded */
+    int64_t pos;              /* current position relative to start */
+} window_ctx_t;
+
+static int64_t window_read(komparu_reader_t *self, void *buf, size_t size) {
+    window_ctx_t *ctx = (window_ctx_t *)self->ctx;
+
+    if (ctx->length >= 0) {
+        if (ctx->pos >= ctx->length) return 0; /* EOF */
+        size_t remaining = (size_t)(ctx->length - ctx->pos);
+        if (size > remaining) size = remaining;
+    }
+
+    int64_t n = ctx->inner->read(ctx->inner, buf, size);
+    if (n > 0) ctx->pos += n;
+    return n;
+}
+
+static int64_t window_get_size(komparu_reader_t *self) {
+    window_ctx_t *ctx = (window_ctx_t *)self->ctx;
+    return ctx->length;
+}
+
+static int window_seek(komparu_reader_t *self, int64_t offset) {
+    window_ctx_t *ctx = (window_ctx_t *)self->ctx;
+    if (offset < 0 || !ctx->inner->seek) return -1;
+    if (ctx->inner->seek(ctx->inner, ctx->start + offset) != 0) return -1;
+    ctx->pos = offset;
+    return 0;
+}
+
+static void window_close(komparu_reader_t *self) {
+    if (!self) return;
+    window_ctx_t *ctx = (window_ctx_t *)self->ctx;
+    if (ctx) {
+        if (ctx->inner) ctx->inner->close(ctx->inner);
+        free(ctx);
+    }
+    free(self);
+}
+
+/**
+ * Advance the inner reader to `offset` from its current (start) position.
+ * Uses seek() when available, otherwise reads and discards.
+ */
+static int skip_to(komparu_reader_t *inner, int64_t offset) {
+    if (offset == 0) return 0;
+    if (inner->seek && inner->seek(inner, offset) == 0) return 0;
+
+    char scratch[8192];
+    int64_t left = offset;
+    while (left > 0) {
+        size_t want = left < (int64_t)sizeof(scratch)
+                          ? (size_t)left : sizeof(scratch);
+        int64_t n = inner->read(inner, scratch, want);
+        if (n <= 0) return -1;
+        left -= n;
+    }
+    return 0;
+}
+
+komparu_reader_t *komparu_reader_window_open(
+    komparu_reader_t *inner,
+    int64_t header_skip,
+    int64_t footer_skip,
+    const char **err_msg
+) {
+    if (header_skip < 0 || footer_skip < 0) {
+        *err_msg = "header_skip and footer_skip must be non-negative";
+        return NULL;
+    }
+
+    int64_t size = inner->get_size(inner);
+    int64_t length = -1;
+    if (size >= 0) {
+        /* Sources shorter than their framing have an empty body */
+        length = size - header_skip - footer_skip;
+        if (length < 0) length = 0;
+        if (header_skip > size) header_skip = size;
+    } else if (footer_skip > 0) {
+        *err_msg = "footer_skip requires a source of known size";
+        return NULL;
+    }
+
+    if (skip_to(inner, header_skip) != 0) {
+        *err_msg = "cannot skip header bytes";
+        return NULL;
+    }
+
+    window_ctx_t *ctx = calloc(1, sizeof(window_ctx_t));
+    komparu_reader_t *reader = calloc(1, sizeof(komparu_reader_t));
+    if (!ctx || !reader) {
+        free(ctx);
+        free(reader);
+        *err_msg = "out of memory";
+        return NULL;
+    }
+
+    ctx->inner = inner;
+    ctx->start = header_skip;
+    ctx->length = length;
+    ctx->pos = 0;
+
+    reader->read = window_read;
+    reader->get_size = window_get_size;
+    reader->seek = inner->seek ? window_seek : NULL;
+    reader->close = window_close;
+    reader->ctx = ctx;
+    reader->source_name = inner->source_name;
+
+    return reader;
+}
+
+void komparu_reader_window_cap(komparu_reader_t *window, int64_t max_length) {
+    if (!window || window->close != window_close || max_length < 0) return;
+    window_ctx_t *ctx = (window_ctx_t *)window->ctx;
+    if (ctx->length < 0 || ctx->length > max_length)
+        ctx->length = max_length;
+}
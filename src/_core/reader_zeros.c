@@ -0,0 +1,113 @@
+/**
+ * reader_zeros.c — Collapse runs of zero bytes over another reader.
+ *
+ * Every maximal run of 0x00 bytes is delivered as a single zero, so two
+ * streams that differ only in how much zero padding follows each field
+ * read the same. This is a fuzzy view: equal output does not imply equal
+ * sizes.
+ *
+ * The collapsed size is unknown up front, so get_size() returns -1 and
+ * the reader is not seekable (size precheck and quick check are skipped).
+ */
+
+#include "reader.h"
+#include <stdlib.h>
+#include <string.h>
+
+#define ZEROS_IN_SIZE (64 * 1024)
+
+typedef struct {
+    komparu_reader_t *inner;   /* owned */
+    uint8_t in[ZEROS_IN_SIZE];
+    size_t in_len;
+    size_t in_pos;
+    bool in_eof;
+    bool in_run;               /* last delivered byte was a zero */
+} zeros_ctx_t;
+
+static int64_t zeros_read(komparu_reader_t *self, void *buf, size_t size) {
+    zeros_ctx_t *ctx = (zeros_ctx_t *)self->ctx;
+    uint8_t *out = (uint8_t *)buf;
+    size_t produced = 0;
+
+    /* Fill the caller's buffer completely unless EOF (see reader_decode.c) */
+    while (produced < size) {
+        if (ctx->in_pos >= ctx->in_len) {
+            if (ctx->in_eof) break;
+            int64_t n = ctx->inner->read(ctx->inner, ctx->in, sizeof(ctx->in));
+            if (n < 0) return -1;
+            if (n == 0) {
+                ctx->in_eof = true;
+                break;
+            }
+            ctx->in_len = (size_t)n;
+            ctx->in_pos = 0;
+        }
+
+        const uint8_t *p = ctx->in + ctx->in_pos;
+        size_t avail = ctx->in_len - ctx->in_pos;
+
+        if (*p == 0) {
+            /* Swallow the run; emit one zero at its start */
+            size_t k = 0;
+            while (k < avail && p[k] == 0) k++;
+            ctx->in_pos += k;
+            if (!ctx->in_run) {
+                out[produced++] = 0;
+                ctx->in_run = true;
+            }
+            continue;
+        }
+
+        /* Copy non-zero bytes up to the next zero */
+        const uint8_t *z = memchr(p, 0, avail);
+        size_t span = z ? (size_t)(z - p) : avail;
+        if (span > size - produced) span = size - produced;
+        memcpy(out + produced, p, span);
+        produced += span;
+        ctx->in_pos += span;
+        ctx->in_run = false;
+    }
+
+    return (int64_t)produced;
+}
+
+static int64_t zeros_get_size(komparu_reader_t *self) {
+    (void)self;
+    return -1;
+}
+
+static void zeros_close(komparu_reader_t *self) {
+    if (!self) return;
+    zeros_ctx_t *ctx = (zeros_ctx_t *)self->ctx;
+    if (ctx) {
+        if (ctx->inner) ctx->inner->close(ctx->inner);
+        free(ctx);
+    }
+    free(self);
+}
+
+komparu_reader_t *komparu_reader_zeros_open(
+    komparu_reader_t *inner,
+    const char **err_msg
+) {
+    zeros_ctx_t *ctx = calloc(1, sizeof(zeros_ctx_t));
+    komparu_reader_t *reader = calloc(1, sizeof(komparu_reader_t));
+    if (!ctx || !reader) {
+        free(ctx);
+        free(reader);
+        *err_msg = "out of memory";
+        return NULL;
+    }
+
+    ctx->inner = inner;
+
+    reader->read = zeros_read;
+    reader->get_size = zeros_get_size;
+    reader->seek = NULL;
+    reader->close = zeros_close;
+    reader->ctx = ctx;
+    reader->source_name = inner->source_name;
+
+    return reader;
+}
@@ -0,0 +1,363 @@
+/**
+ * uring.c — Batched readahead over io_uring (Linux, experimental).
+ *
+ * The file is split into KOMPARU_URING_BLOCK_SIZE blocks starting at
+ * `base`. Block k lives in slot k % depth; while the consumer copies out
+ * of the head block, the next depth - 1 blocks are already queued. When
+ * the head block is drained its slot is resubmitted for block
+ * head + depth, and everything queued during one read call goes to the
+ * kernel in a single io_uring_enter.
+ */
+
+#include "uring.h"
+#include <stdlib.h>
+#include <string.h>
+#include <errno.h>
+
+#if defined(KOMPARU_LINUX) && !defined(KOMPARU_NO_IO_URING) && defined(__has_include)
+#if __has_include(<linux/io_uring.h>)
+#define KOMPARU_HAVE_IO_URING 1
+#endif
+#endif
+
+#ifdef KOMPARU_HAVE_IO_URING
+
+#include <linux/io_uring.h>
+#include <sys/syscall.h>
+#include <sys/uio.h>
+
+/* Same number on every architecture (unified syscall table) */
+#ifndef __NR_io_uring_setup
+#define __NR_io_uring_setup 425
+#endif
+#ifndef __NR_io_uring_enter
+#define __NR_io_uring_enter 426
+#endif
+
+typedef struct {
+    int64_t offset;     /* file offset of the block */
+    size_t len;         /* bytes requested; cut short on early EOF */
+    size_t filled;      /* bytes completed so far */
+    int error;          /* errno of a failed read, or 0 */
+    bool done;
+    struct iovec iov;   /* READV target; must outlive the submission */
+} uring_slot_t;
+
+struct komparu_uring {
+    int ring_fd;
+    int fd;
+    unsigned depth;
+
+    /* Submission queue (shared with the kernel) */
+    unsigned *sq_head, *sq_tail, *sq_mask, *sq_array;
+    unsigned sq_entries;
+    struct io_uring_sqe *sqes;
+
+    /* Completion queue (shared with the kernel) */
+    unsigned *cq_head, *cq_tail, *cq_mask;
+    struct io_uring_cqe *cqes;
+
+    void *sq_ptr, *cq_ptr;
+    size_t sq_len, cq_len, sqes_len;
+
+    unsigned inflight;   /* queued or submitted, not yet completed */
+    int64_t file_size;
+    int64_t base;        /* offset of block 0 */
+    int64_t head_block;  /* block being consumed */
+    int64_t next_block;  /* next block to submit */
+    size_t head_pos;     /* bytes consumed from the head block */
+    bool eof;
+
+    uring_slot_t *slots;
+    char *buffers;       /* depth * KOMPARU_URING_BLOCK_SIZE */
+};
+
+static int64_t block_offset(const komparu_uring_t *u, int64_t block) {
+    return u->base + block * (int64_t)KOMPARU_URING_BLOCK_SIZE;
+}
+
+static size_t block_len(const komparu_uring_t *u, int64_t block) {
+    int64_t left = u->file_size - block_offset(u, block);
+    if (left <= 0) return 0;
+    return left < KOMPARU_URING_BLOCK_SIZE ? (size_t)left : KOMPARU_URING_BLOCK_SIZE;
+}
+
+static int ring_enter(komparu_uring_t *u, unsigned min_complete) {
+    for (;;) {
+        unsigned pending = *u->sq_tail - __atomic_load_n(u->sq_head, __ATOMIC_ACQUIRE);
+        if (pending == 0 && min_complete == 0) return 0;
+        long rc = syscall(__NR_io_uring_enter, u->ring_fd, pending, min_complete,
+                          min_complete ? IORING_ENTER_GETEVENTS : 0, NULL, 0);
+        if (rc >= 0) return 0;
+        if (errno != EINTR && errno != EAGAIN && errno != EBUSY) return -1;
+        if (min_complete == 0) continue;
+        return 0;  /* interrupted wait: caller reaps and retries */
+    }
+}
+
+static int queue_read(komparu_uring_t *u, unsigned idx) {
+    uring_slot_t *slot = &u->slots[idx];
+    unsigned tail = *u->sq_tail;
+    if (tail - __atomic_load_n(u->sq_head, __ATOMIC_ACQUIRE) >= u->sq_entries &&
+        ring_enter(u, 0) != 0) {
+        return -1;
+    }
+
+    slot->iov.iov_base = u->buffers + (size_t)idx * KOMPARU_URING_BLOCK_SIZE + slot->filled;
+    slot->iov.iov_len = slot->len - slot->filled;
+
+    unsigned sq_idx = tail & *u->sq_mask;
+    struct io_uring_sqe *sqe = &u->sqes[sq_idx];
+    memset(sqe, 0, sizeof(*sqe));
+    sqe->opcode = IORING_OP_READV;
+    sqe->fd = u->fd;
+    sqe->off = (uint64_t)(slot->offset + (int64_t)slot->filled);
+    sqe->addr = (uint64_t)(uintptr_t)&slot->iov;
+    sqe->len = 1;
+    sqe->user_data = idx;
+    u->sq_array[sq_idx] = sq_idx;
+    __atomic_store_n(u->sq_tail, tail + 1, __ATOMIC_RELEASE);
+    u->inflight++;
+    return 0;
+}
+
+static int submit_block(komparu_uring_t *u, int64_t block) {
+    unsigned idx = (unsigned)(block % u->depth);
+    uring_slot_t *slot = &u->slots[idx];
+    slot->offset = block_offset(u, block);
+    slot->len = block_len(u, block);
+    slot->filled = 0;
+    slot->error = 0;
+    slot->done = false;
+    return queue_read(u, idx);
+}
+
+/* Process available completions; short reads are resubmitted. */
+static int reap(komparu_uring_t *u) {
+    unsigned head = *u->cq_head;
+    unsigned tail = __atomic_load_n(u->cq_tail, __ATOMIC_ACQUIRE);
+    int seen = 0;
+    while (head != tail) {
+        struct io_uring_cqe *cqe = &u->cqes[head & *u->cq_mask];
+        unsigned idx = (unsigned)cqe->user_data;
+        int res = cqe->res;
+        uring_slot_t *slot = &u->slots[idx];
+        head++;
+        seen++;
+        u->inflight--;
+
+        if (res == -EINTR || res == -EAGAIN) {
+            if (queue_read(u, idx) != 0) {
+                slot->error = errno;
+                slot->done = true;
+            }
+        } else if (res < 0) {
+            slot->error = -res;
+            slot->done = true;
+        } else if (res == 0) {
+            slot->len = slot->filled;  /* file shrank under us */
+            slot->done = true;
+        } else {
+            slot->filled += (size_t)res;
+            if (slot->filled < slot->len) {
+                if (queue_read(u, idx) != 0) {
+                    slot->error = errno;
+                    slot->done = true;
+                }
+            } else {
+                slot->done = true;
+            }
+        }
+    }
+    __atomic_store_n(u->cq_head, head, __ATOMIC_RELEASE);
+    return seen;
+}
+
+static int drain(komparu_uring_t *u) {
+    while (u->inflight > 0) {
+        if (reap(u) == 0 && ring_enter(u, 1) != 0) return -1;
+    }
+    return 0;
+}
+
+static int prime(komparu_uring_t *u) {
+    u->head_block = 0;
+    u->next_block = 0;
+    u->head_pos = 0;
+    u->eof = false;
+    while (u->next_block < (int64_t)u->depth && block_len(u, u->next_block) > 0) {
+        if (submit_block(u, u->next_block) != 0) return -1;
+        u->next_block++;
+    }
+    return ring_enter(u, 0);
+}
+
+static void ring_free(komparu_uring_t *u) {
+    if (u->sqes) munmap(u->sqes, u->sqes_len);
+    if (u->cq_ptr && u->cq_ptr != u->sq_ptr) munmap(u->cq_ptr, u->cq_len);
+    if (u->sq_ptr) munmap(u->sq_ptr, u->sq_len);
+    if (u->ring_fd >= 0) close(u->ring_fd);
+    free(u->slots);
+    free(u->buffers);
+    free(u);
+}
+
+komparu_uring_t *komparu_uring_open(int fd, int64_t file_size, unsigned depth) {
+    if (depth == 0 || depth > KOMPARU_URING_MAX_DEPTH || file_size < 0) {
+        errno = EINVAL;
+        return NULL;
+    }
+    /* No more slots than the file has blocks */
+    int64_t blocks = (file_size + KOMPARU_URING_BLOCK_SIZE - 1) / KOMPARU_URING_BLOCK_SIZE;
+    if (blocks < 1) blocks = 1;
+    if ((int64_t)depth > blocks) depth = (unsigned)blocks;
+
+    komparu_uring_t *u = calloc(1, sizeof(*u));
+    if (!u) return NULL;
+    u->ring_fd = -1;
+    u->fd = fd;
+    u->depth = depth;
+    u->file_size = file_size;
+
+    struct io_uring_params p;
+    memset(&p, 0, sizeof(p));
+    long ring_fd = syscall(__NR_io_uring_setup, depth, &p);
+    if (ring_fd < 0) goto fail;
+    u->ring_fd = (int)ring_fd;
+    u->sq_entries = p.sq_entries;
+
+    u->sq_len = p.sq_off.array + p.sq_entries * sizeof(unsigned);
+    u->cq_len = p.cq_off.cqes + p.cq_entries * sizeof(struct io_uring_cqe);
+    bool single_mmap = false;
+#ifdef IORING_FEAT_SINGLE_MMAP
+    single_mmap = (p.features & IORING_FEAT_SINGLE_MMAP) != 0;
+    if (single_mmap && u->cq_len > u->sq_len) u->sq_len = u->cq_len;
+#endif
+
+    void *sq_ptr = mmap(NULL, u->sq_len, PROT_READ | PROT_WRITE,
+                        MAP_SHARED | MAP_POPULATE, u->ring_fd, IORING_OFF_SQ_RING);
+    if (sq_ptr == MAP_FAILED) goto fail;
+    u->sq_ptr = sq_ptr;
+    if (single_mmap) {
+        u->cq_ptr = sq_ptr;
+    } else {
+        void *cq_ptr = mmap(NULL, u->cq_len, PROT_READ | PROT_WRITE,
+                            MAP_SHARED | MAP_POPULATE, u->ring_fd, IORING_OFF_CQ_RING);
+        if (cq_ptr == MAP_FAILED) goto fail;
+        u->cq_ptr = cq_ptr;
+    }
+    u->sqes_len = p.sq_entries * sizeof(struct io_uring_sqe);
+    void *sqes = mmap(NULL, u->sqes_len, PROT_READ | PROT_WRITE,
+                      MAP_SHARED | MAP_POPULATE, u->ring_fd, IORING_OFF_SQES);
+    if (sqes == MAP_FAILED) goto fail;
+    u->sqes = sqes;
+
+    char *sq = u->sq_ptr;
+    char *cq = u->cq_ptr;
+    u->sq_head = (unsigned *)(sq + p.sq_off.head);
+    u->sq_tail = (unsigned *)(sq + p.sq_off.tail);
+    u->sq_mask = (unsigned *)(sq + p.sq_off.ring_mask);
+    u->sq_array = (unsigned *)(sq + p.sq_off.array);
+    u->cq_head = (unsigned *)(cq + p.cq_off.head);
+    u->cq_tail = (unsigned *)(cq + p.cq_off.tail);
+    u->cq_mask = (unsigned *)(cq + p.cq_off.ring_mask);
+    u->cqes = (struct io_uring_cqe *)(cq + p.cq_off.cqes);
+
+    u->slots = calloc(depth, sizeof(uring_slot_t));
+    u->buffers = malloc((size_t)depth * KOMPARU_URING_BLOCK_SIZE);
+    if (!u->slots || !u->buffers) goto fail;
+
+    if (prime(u) != 0) goto fail;
+    return u;
+
+fail: {
+        int saved = errno;
+        drain(u);
+        ring_free(u);
+        errno = saved;
+        return NULL;
+    }
+}
+
+int64_t komparu_uring_read(komparu_uring_t *u, void *buf, size_t size) {
+    size_t copied = 0;
+    while (copied < size && !u->eof) {
+        size_t expect = block_len(u, u->head_block);
+        if (expect == 0) {
+            u->eof = true;
+            break;
+        }
+        unsigned idx = (unsigned)(u->head_block % u->depth);
+        uring_slot_t *slot = &u->slots[idx];
+        while (!slot->done) {
+            if (reap(u) == 0 && ring_enter(u, 1) != 0) return -1;
+        }
+        if (slot->error) {
+            errno = slot->error;
+            return -1;
+        }
+
+        size_t avail = slot->len - u->head_pos;
+        size_t n = size - copied < avail ? size - copied : avail;
+        memcpy((char *)buf + copied,
+               u->buffers + (size_t)idx * KOMPARU_URING_BLOCK_SIZE + u->head_pos, n);
+        copied += n;
+        u->head_pos += n;
+
+        if (u->head_pos == slot->len) {
+            if (slot->len < expect) u->eof = true;  /* truncated while reading */
+            u->head_block++;
+            u->head_pos = 0;
+            if (!u->eof && block_len(u, u->next_block) > 0) {
+                if (submit_block(u, u->next_block) != 0) return -1;
+                u->next_block++;
+            }
+        }
+    }
+    /* One syscall for everything queued during this call */
+    if (ring_enter(u, 0) != 0) return -1;
+    return (int64_t)copied;
+}
+
+int komparu_uring_seek(komparu_uring_t *u, int64_t offset) {
+    if (offset < 0 || offset > u->file_size) return -1;
+    if (drain(u) != 0) return -1;
+    u->base = offset;
+    return prime(u);
+}
+
+void komparu_uring_close(komparu_uring_t *u) {
+    if (!u) return;
+    drain(u);  /* the kernel may still be writing into our buffers */
+    ring_free(u);
+}
+
+#else /* !KOMPARU_HAVE_IO_URING */
+
+komparu_uring_t *komparu_uring_open(int fd, int64_t file_size, unsigned depth) {
+    (void)fd;
+    (void)file_size;
+    (void)depth;
+    errno = ENOSYS;
+    return NULL;
+}
+
+int64_t komparu_uring_read(komparu_uring_t *u, void *buf, size_t size) {
+    (void)u;
+    (void)buf;
+    (void)size;
+    errno = ENOSYS;
+    return -1;
+}
+
+int komparu_uring_seek(komparu_uring_t *u, int64_t offset) {
+    (void)u;
+    (void)offset;
+    return -1;
+}
+
+void komparu_uring_close(komparu_uring_t *u) {
+    (void)u;
+}
+
+#endif /* KOMPARU_HAVE_IO_URING */
@@ -0,0 +1,54 @@
+/**
+ * uring.h — Batched readahead over io_uring (Linux, experimental).
+ *
+ * Keeps `depth` block-sized reads in flight ahead of the consumer, so a
+ * sequential scan overlaps device latency with comparison instead of
+ * issuing one blocking read() per chunk. Talks to the kernel through the
+ * raw io_uring_setup/io_uring_enter syscalls; liburing is not required.
+ *
+ * Compiled out when the kernel headers lack <linux/io_uring.h> or when
+ * built with -DKOMPARU_IO_URING=OFF (defines KOMPARU_NO_IO_URING); the
+ * open call then fails with ENOSYS and callers fall back to read().
+ */
+
+#ifndef KOMPARU_URING_H
+#define KOMPARU_URING_H
+
+#include "compat.h"
+
+/* Largest accepted queue depth (one slot per in-flight read) */
+#define KOMPARU_URING_MAX_DEPTH 256
+
+/* Size of each read submitted to the ring; a reader buffers depth blocks */
+#define KOMPARU_URING_BLOCK_SIZE (128 * 1024)
+
+typedef struct komparu_uring komparu_uring_t;
+
+/**
+ * Set up a ring reading `fd` (first `file_size` bytes) with `depth`
+ * reads in flight. Reads are primed immediately from offset 0.
+ *
+ * Returns NULL and sets errno if io_uring is unavailable (ENOSYS when
+ * compiled out or the kernel lacks it, EPERM when disabled by sysctl or
+ * seccomp) or on allocation failure. Does not take ownership of `fd`.
+ */
+komparu_uring_t *komparu_uring_open(int fd, int64_t file_size, unsigned depth);
+
+/**
+ * Copy up to `size` bytes from the current position into `buf`, waiting
+ * for in-flight reads as needed. Fills the buffer unless EOF is reached.
+ *
+ * Returns bytes copied, 0 at EOF, or -1 on a read error (errno set).
+ */
+int64_t komparu_uring_read(komparu_uring_t *u, void *buf, size_t size);
+
+/**
+ * Drop queued readahead and restart at `offset`.
+ * Returns 0, or -1 if `offset` is out of range or resubmission fails.
+ */
+int komparu_uring_seek(komparu_uring_t *u, int64_t offset);
+
+/** Wait for in-flight reads, then tear down the ring and its buffers. */
+void komparu_uring_close(komparu_uring_t *u);
+
+#endif /* KOMPARU_URING_H */
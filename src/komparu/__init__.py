@@ -7,46 +7,214 @@ __version__ = "0.1.0"
 from komparu._types import (
     Source,
     DirResult,
+    DirSummary,
+    ProgressEvent,
+    WatchEvent,
+    FileStat,
+    DirReport,
+    ReportEntry,
     CompareResult,
+    FileDiff,
+    BatchResult,
+    Mismatch,
+    DiffStats,
+    TuneResult,
+    TuneTrial,
+    ThreeWayResult,
+    MultiTreeReport,
+    IOInfo,
+    BlockSum,
+    Manifest,
+    ManifestEntry,
+    TextPosition,
+    LineSetDiff,
+    TokenDiff,
     DiffReason,
+    MergeStatus,
+    EntryStatus,
     KomparuError,
     SourceNotFoundError,
     SourceReadError,
+    DecodeError,
     ArchiveError,
     ArchiveBombError,
     ConfigError,
     ComparisonTimeoutError,
+    CancelledError,
+    NonRegularFileError,
 )
+from komparu._cancel import CancelToken
+from komparu._cache import DigestCache
 from komparu._config import configure, get_config, reset_config
 from komparu._api import (
     compare,
+    compare_into,
+    compare_file_bytes,
+    compare_handles,
+    compare_sampled,
+    compare_head_tail,
+    compare_range,
+    compare_length_prefixed,
+    compare_numeric,
+    count_differing_bytes,
+    diff_stats,
+    common_prefix_len,
+    is_prefix,
+    first_difference,
     compare_dir,
+    is_subset,
+    compare_dir_summary,
+    compare_dir_report,
+    identical,
     compare_archive,
     compare_all,
     compare_many,
+    compare_batch,
     compare_dir_urls,
+    hash_dir,
+    compare_dir_hashes,
+    compare_three_way,
+    compare_trees,
+    group_by_top_dir,
+    verify_hash,
+    compare_and_hash,
+    block_checksums,
+    sync_file,
 )
+from komparu._text import (
+    compare_text, compare_text_lines, compare_text_unordered, compare_tokens,
+)
+from komparu._json import compare_json
+from komparu._decompress import register_decompressor
+from komparu._delta import apply_delta, delta_reader
+from komparu._git import compare_git_tree
+from komparu._fs import (
+    FileSystem, MemoryFS, OSFS, ResourceFS, StatFileSystem, TarFS, ZipFS,
+    compare_fs, open_archive,
+)
+from komparu._stream import compare_readers
+from komparu._report import (
+    register_report_format, write_report, write_three_way_report,
+)
+from komparu._snapshot import diff_since_snapshot, snapshot_dir
+from komparu._manifest import (
+    load_manifest, manifest_dir, register_hash, verify_manifest, write_manifest,
+)
+from komparu._html import diff_html
+from komparu._watch import Watcher
+from komparu._remote import RemoteTree, compare_remote, serve_tree
+from komparu._tune import tune_read
 
 __all__ = [
     "__version__",
     "compare",
+    "compare_into",
+    "compare_file_bytes",
+    "compare_handles",
+    "compare_sampled",
+    "compare_head_tail",
+    "compare_range",
+    "compare_length_prefixed",
+    "compare_numeric",
+    "count_differing_bytes",
+    "diff_stats",
+    "common_prefix_len",
+    "is_prefix",
+    "first_difference",
     "compare_dir",
+    "is_subset",
+    "compare_dir_summary",
+    "compare_dir_report",
+    "identical",
     "compare_archive",
     "compare_all",
     "compare_many",
+    "compare_batch",
     "compare_dir_urls",
+    "hash_dir",
+    "compare_dir_hashes",
+    "compare_three_way",
+    "compare_trees",
+    "group_by_top_dir",
+    "verify_hash",
+    "compare_and_hash",
+    "block_checksums",
+    "sync_file",
+    "compare_text",
+    "compare_text_lines",
+    "compare_text_unordered",
+    "compare_tokens",
+    "compare_json",
+    "compare_git_tree",
+    "compare_fs",
+    "FileSystem",
+    "StatFileSystem",
+    "OSFS",
+    "ZipFS",
+    "TarFS",
+    "open_archive",
+    "MemoryFS",
+    "ResourceFS",
+    "register_decompressor",
+    "delta_reader",
+    "apply_delta",
+    "compare_readers",
+    "write_report",
+    "write_three_way_report",
+    "register_report_format",
+    "snapshot_dir",
+    "diff_since_snapshot",
+    "manifest_dir",
+    "write_manifest",
+    "load_manifest",
+    "verify_manifest",
+    "register_hash",
+    "diff_html",
+    "Watcher",
+    "RemoteTree",
+    "compare_remote",
+    "serve_tree",
+    "tune_read",
     "configure",
     "get_config",
     "reset_config",
     "Source",
     "DirResult",
+    "DirSummary",
+    "DirReport",
+    "ReportEntry",
     "CompareResult",
+    "FileDiff",
+    "BatchResult",
+    "Mismatch",
+    "DiffStats",
+    "TuneResult",
+    "TuneTrial",
+    "ThreeWayResult",
+    "MultiTreeReport",
+    "IOInfo",
+    "ProgressEvent",
+    "WatchEvent",
+    "FileStat",
+    "CancelToken",
+    "DigestCache",
+    "BlockSum",
+    "Manifest",
+    "ManifestEntry",
+    "TextPosition",
+    "LineSetDiff",
+    "TokenDiff",
     "DiffReason",
+    "MergeStatus",
+    "EntryStatus",
     "KomparuError",
     "SourceNotFoundError",
     "SourceReadError",
+    "DecodeError",
     "ArchiveError",
     "ArchiveBombError",
     "ConfigError",
     "ComparisonTimeoutError",
+    "CancelledError",
+    "NonRegularFileError",
 ]
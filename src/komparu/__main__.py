@@ -0,0 +1,7 @@
+"""Entry point for ``python -m komparu``."""
+
+import sys
+
+from komparu._cli import main
+
+sys.exit(main())
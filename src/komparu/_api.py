@@ -2,116 +2,1751 @@
 
 from __future__ import annotations
 
-from komparu._types import Source, CompareResult
-from komparu._config import get_config
+import contextlib
+import io
+import logging
+import mmap
+import os
+import shutil
+import stat
+import tempfile
+import time
+from collections.abc import Callable, Iterable, Mapping, Sequence
+from typing import Any, Literal
+
+from komparu._types import (
+    Source, CompareResult, DiffReason, FileDiff, IOInfo, DirSummary, BlockSum,
+    MergeStatus, ThreeWayResult, MultiTreeReport,
+    BatchResult, KomparuError, Mismatch, DiffStats, DirReport, ReportEntry, EntryStatus,
+    ProgressEvent,
+)
+from komparu import _decompress
+from komparu._stream import (
+    ContentFilter, Opener, PathRewrite, compare_filtered, compare_opened, first_diff_opened,
+    rewrite_filter,
+)
+from komparu._text import same_text
+from komparu._config import get_config, get_logger
 from komparu._core import compare as _compare_c
+from komparu._core import compare_numeric as _compare_numeric_c
+from komparu._core import count_differing_bytes as _count_differing_bytes_c
+from komparu._core import diff_stats as _diff_stats_c
+from komparu._core import compare_fds as _compare_fds_c
 from komparu._core import compare_dir as _compare_dir_c
+from komparu._core import dir_progress_new as _dir_progress_new
+from komparu._core import dir_progress_snapshot as _dir_progress_snapshot
+from komparu._core import dirs_identical as _dirs_identical_c
 from komparu._core import compare_archive as _compare_archive_c
 from komparu._core import compare_dir_urls as _compare_dir_urls_c
-from komparu._validate import validate_path, validate_chunk_size, validate_timeout, validate_max_workers
-from komparu._helpers import resolve_headers, build_dir_result, filter_dir_result
+from komparu._core import hash_dir as _hash_dir_c
+from komparu._core import hash_files as _hash_files_c
+from komparu._core import verify_hash as _verify_hash_c
+from komparu._core import compare_hash as _compare_hash_c
+from komparu._core import block_checksums as _block_checksums_c
+from komparu._validate import (
+    validate_path, validate_chunk_size, validate_timeout, validate_max_workers,
+    validate_skip, validate_decode, validate_max_depth, validate_max_memory,
+    validate_io_uring_depth, validate_progress_interval, validate_patterns,
+    validate_strategy,
+    validate_symlinks, validate_metadata,
+)
+from komparu._helpers import (
+    resolve_headers, build_dir_result, filter_dir_result,
+    detect_renames as _detect_renames, compare_metadata as _compare_metadata,
+    metadata_diffs, metadata_reason, to_slash,
+    flag_encoding_mismatch as _flag_encoding_mismatch,
+    refilter_diff as _refilter_diff, slash_keys,
+    apply_known_diffs as _apply_known_diffs, load_known_diffs,
+    apply_rename_map as _apply_rename_map, normalize_rename_map,
+    equivalence_map, side_byte_maps, shared_locks, thp_mode, walk_filter,
+    link_targets_equal,
+)
+from komparu._gitignore import filter_gitignored
+from komparu._cancel import CancelToken, cancel_handle
+from komparu._snapshot import _hash, _scan, _under
+from komparu._cache import DigestCache, compare_dir_cached, open_cache, scan_filtered
+
+from komparu._types import DirResult  # noqa: F401 — re-export for type annotations
+
+# progress(files_done, files_total, bytes_done, bytes_total)
+DirProgress = Callable[[int, int, int, int], None]
+ProgressCallback = Callable[[ProgressEvent], None]
+
+
+def compare(
+    source_a: str | Source,
+    source_b: str | Source,
+    *,
+    chunk_size: int = 65536,
+    size_precheck: bool = True,
+    quick_check: bool = True,
+    headers: dict[str, str] | None = None,
+    timeout: float = 30.0,
+    follow_redirects: bool = True,
+    verify_ssl: bool = True,
+    proxy: str | None = None,
+    header_skip: int = 0,
+    footer_skip: int = 0,
+    decode_a: str = "none",
+    decode_b: str = "none",
+    decompress: bool = False,
+    collapse_zero_runs: bool = False,
+    equivalence_classes: list[bytes] | None = None,
+    case_fold: bool = False,
+    opener: Opener | None = None,
+    huge_pages: bool = False,
+    io_uring: bool = False,
+    io_uring_depth: int = 8,
+    strategy: str = "auto",
+    content_filter: ContentFilter | None = None,
+    include_slack: bool = False,
+    path_rewrite: PathRewrite | None = None,
+    translate_a: bytes | None = None,
+    translate_b: bytes | None = None,
+    lock_files: bool = False,
+    symlinks: str = "follow",
+    cancel: CancelToken | None = None,
+    on_progress: ProgressCallback | None = None,
+    progress_interval: float = 0.1,
+) -> bool:
+    """Compare two sources byte-by-byte.
+
+    :param source_a: File path, URL, or Source object.
+    :param source_b: File path, URL, or Source object.
+    :param chunk_size: Chunk size in bytes.
+    :param size_precheck: Compare sizes before content.
+    :param quick_check: Sample key offsets before full scan.
+    :param headers: Global HTTP headers for URL sources.
+    :param timeout: HTTP timeout in seconds.
+    :param follow_redirects: Follow HTTP redirects.
+    :param verify_ssl: Verify SSL certificates.
+    :param proxy: Proxy URL (e.g. http://host:port, socks5://host:port).
+    :param header_skip: Bytes to ignore at the start of each source.
+    :param footer_skip: Bytes to ignore at the end of each source.
+    :param decode_a: Decode source_a before comparing: "none", "base64" or "hex".
+    :param decode_b: Decode source_b before comparing: "none", "base64" or "hex".
+    :param decompress: Compare gzip/bzip2/xz/zstd sources (and formats added
+        with register_decompressor) by decompressed content. Sources in
+        no known format compare raw.
+    :param collapse_zero_runs: Fuzzy mode: a run of zero bytes matches a
+        zero run of any length on the other side. Files of different total
+        size can compare equal.
+    :param equivalence_classes: Fuzzy mode: groups of byte values that
+        compare equal (e.g. ``[b"\\t "]``). Not byte-exact.
+    :param case_fold: Fuzzy mode: ASCII letters compare case-insensitively
+        (``SELECT`` equals ``select``); other bytes are untouched. Folded
+        chunk by chunk while streaming.
+    :param opener: Open local paths through ``opener(path)`` (returning a
+        binary stream) instead of the native reader. Streams are compared
+        sequentially; sizes come from fstat or seeking when available.
+    :param huge_pages: Ask for huge pages on local file mappings to cut
+        TLB pressure on very large files. Advisory: a refusal falls back
+        to normal pages and is logged.
+    :param io_uring: Experimental (Linux): read local files through
+        io_uring with batched readahead instead of mmap. Falls back to
+        plain reads when io_uring is unavailable.
+    :param io_uring_depth: Reads kept in flight per file with ``io_uring``
+        (1-256, 128 KiB each).
+    :param strategy: How local files are read: ``"auto"`` maps files of
+        64 KiB or more and reads smaller ones, ``"mmap"`` maps every
+        non-empty file, ``"buffered"`` never maps. Files that cannot be
+        mapped (FUSE, some network filesystems) are read either way.
+        ``"prefetch"`` reads each file on a helper thread that keeps the
+        next ``chunk_size`` bytes ready while the current chunk is
+        compared, for slow storage where mmap page faults stall; it
+        falls back to plain reads if the thread cannot start.
+        :func:`tune_read` times these on a sample file.
+    :param content_filter: ``content_filter(path, stream)`` returns the
+        logical content of a local file (like a git clean filter); the
+        filtered streams are compared instead of the raw bytes.
+    :param include_slack: Also accept local block devices and compare them
+        over their full extent as reported by the device, including any
+        space past the end of the filesystem or image they hold. Regular
+        files have no readable slack, so this is a no-op for them.
+    :param path_rewrite: ``(from, to)`` pairs replaced in each local file's
+        content while streaming (after ``content_filter``), e.g. build
+        roots mapped to a placeholder. A plain textual substitution: it
+        knows nothing about paths, separators or case.
+    :param translate_a: 256-byte table: each byte ``x`` of source_a reads
+        as ``translate_a[x]`` (e.g. EBCDIC to ASCII), after decoding and
+        before ``equivalence_classes``/``case_fold``.
+    :param translate_b: Same for source_b.
+    :param lock_files: Hold a shared advisory ``flock()`` on each local
+        file while comparing, waiting for writers that hold an exclusive
+        one. Where locking fails, the files are compared unlocked and the
+        reason is logged.
+    :param symlinks: ``"follow"`` compares what local symlinks point to;
+        ``"compare-link"`` compares a symlink by its target string instead
+        (equal only if both sides are links to the same target).
+    :param cancel: Token to stop the comparison from another thread or
+        after a deadline; checked between chunks of the native scan (the
+        Python streaming paths check it only before starting).
+    :param on_progress: Called with a :class:`ProgressEvent` on the calling
+        thread at most once per ``progress_interval`` seconds while the
+        native scan runs on a worker thread. Not called by the Python
+        streaming paths (``content_filter``, ``opener``, registered
+        decompressors).
+    :param progress_interval: Seconds between ``on_progress`` polls.
+    :returns: True if sources are byte-identical.
+    :raises DecodeError: If a decoded source is not valid base64/hex.
+    :raises CancelledError: If ``cancel`` was cancelled.
+    :raises ComparisonTimeoutError: If the deadline of ``cancel`` passed.
+    """
+    validate_path(source_a, "source_a")
+    validate_path(source_b, "source_b")
+    validate_chunk_size(chunk_size)
+    validate_timeout(timeout)
+    validate_skip(header_skip, "header_skip")
+    validate_skip(footer_skip, "footer_skip")
+    validate_decode(decode_a, "decode_a")
+    validate_decode(decode_b, "decode_b")
+    validate_io_uring_depth(io_uring_depth)
+    validate_strategy(strategy, io_uring)
+    validate_symlinks(symlinks, ("follow", "compare-link"))
+    validate_progress_interval(progress_interval)
+    token = cancel_handle(cancel)
+    byte_map, byte_map_b = side_byte_maps(
+        equivalence_map(equivalence_classes, case_fold), translate_a, translate_b,
+    )
+
+    cfg = get_config()
+    log = get_logger()
+
+    path_a, path_b, h, p = _resolve_sources(source_a, source_b, headers, proxy)
+    if symlinks == "compare-link" and "://" not in path_a and "://" not in path_b:
+        same_link = link_targets_equal(path_a, path_b)
+        if same_link is not None:
+            log.debug("compare %s %s: symlink targets equal=%s", path_a, path_b, same_link)
+            return same_link
+    locks = shared_locks((path_a, path_b)) if lock_files else contextlib.nullcontext()
+
+    if path_rewrite:
+        what = "path_rewrite"
+        content_filter = rewrite_filter(path_rewrite, content_filter, chunk_size=chunk_size)
+    else:
+        what = "content_filter"
+    if content_filter is not None:
+        if "://" in path_a or "://" in path_b:
+            raise ValueError(f"{what} applies to local paths only")
+        if (header_skip or footer_skip or decode_a != "none" or decode_b != "none"
+                or decompress or collapse_zero_runs or byte_map):
+            raise ValueError(
+                f"{what} cannot be combined with header_skip, footer_skip, "
+                "decode, decompress, collapse_zero_runs, equivalence_classes, "
+                "case_fold or translate_a/translate_b"
+            )
+        log.debug("compare %s %s: %s, streaming in Python",
+                  path_a, path_b, what.replace("_", " "))
+        with locks:
+            return compare_filtered(
+                content_filter, path_a, path_b, chunk_size=chunk_size, opener=opener,
+            )
+
+    if opener is not None:
+        if "://" in path_a or "://" in path_b:
+            raise ValueError("opener applies to local paths only")
+        if (header_skip or footer_skip or decode_a != "none" or decode_b != "none"
+                or decompress or collapse_zero_runs or byte_map):
+            raise ValueError(
+                "opener cannot be combined with header_skip, footer_skip, "
+                "decode, decompress, collapse_zero_runs, equivalence_classes, "
+                "case_fold or translate_a/translate_b"
+            )
+        log.debug("compare %s %s: custom opener, streaming in Python",
+                  path_a, path_b)
+        with locks:
+            return compare_opened(
+                opener, path_a, path_b,
+                size_precheck=size_precheck, chunk_size=chunk_size,
+            )
+
+    if decompress and _use_python_decompress(path_a, path_b):
+        if (header_skip or footer_skip or decode_a != "none" or decode_b != "none"
+                or collapse_zero_runs or byte_map):
+            raise ValueError(
+                "registered decompressors cannot be combined with header_skip, "
+                "footer_skip, decode, collapse_zero_runs, equivalence_classes, case_fold "
+                "or translate_a/translate_b"
+            )
+        log.debug("compare %s %s: registered decompressor, streaming in Python",
+                  path_a, path_b)
+        start = time.perf_counter()
+        with locks:
+            equal = _decompress.compare_streams(path_a, path_b, chunk_size)
+        log.debug("compare %s %s: equal=%s in %.3fs",
+                  path_a, path_b, equal, time.perf_counter() - start)
+        return equal
+
+    if huge_pages:
+        _check_huge_pages(log)
+
+    start = time.perf_counter()
+    with locks:
+        equal = _run_polled(
+            _compare_c, (path_a, path_b), on_progress, progress_interval, path=path_a,
+            chunk_size=chunk_size,
+            size_precheck=size_precheck,
+            quick_check=quick_check,
+            headers=h,
+            timeout=timeout,
+            follow_redirects=follow_redirects,
+            verify_ssl=verify_ssl,
+            allow_private=cfg.allow_private_redirects,
+            proxy=p,
+            header_skip=header_skip,
+            footer_skip=footer_skip,
+            decode_a=decode_a,
+            decode_b=decode_b,
+            decompress=decompress,
+            collapse_zero_runs=collapse_zero_runs,
+            byte_map=byte_map,
+            byte_map_b=byte_map_b,
+            huge_pages=huge_pages,
+            io_uring_depth=io_uring_depth if io_uring else 0,
+            block_devices=include_slack,
+            strategy=strategy,
+            cancel=token,
+        )
+    log.debug("compare %s %s: equal=%s in %.3fs",
+              path_a, path_b, equal, time.perf_counter() - start)
+    return equal
+
+
+def _resolve_sources(
+    source_a: str | Source, source_b: str | Source,
+    headers: dict[str, str] | None, proxy: str | None,
+) -> tuple[str, str, dict[str, str] | None, str | None]:
+    """Paths or URLs of two sources, with the HTTP headers (per-source
+    ones first, then ``headers``, then the configured ones) and proxy the
+    native core gets for them."""
+    cfg = get_config()
+    path_a = source_a.url if isinstance(source_a, Source) else source_a
+    path_b = source_b.url if isinstance(source_b, Source) else source_b
+    global_h = headers if headers is not None else (cfg.headers or None)
+    h = resolve_headers(source_a, global_h) or resolve_headers(source_b, global_h) or global_h
+    return path_a, path_b, h or None, proxy if proxy is not None else cfg.proxy
+
+
+def _check_huge_pages(log: logging.Logger) -> None:
+    """Log why a huge page request will fall back to normal pages."""
+    mode = thp_mode()
+    if mode is None:
+        log.info("huge_pages: transparent huge pages unavailable on this "
+                 "system; using normal pages (hugetlbfs files excepted)")
+    elif mode == "never":
+        log.info("huge_pages: transparent huge pages disabled (mode 'never'); "
+                 "using normal pages (hugetlbfs files excepted)")
+
+
+def _use_python_decompress(path_a: str, path_b: str) -> bool:
+    """True if a local source matches a magic from register_decompressor."""
+    if "://" in path_a or "://" in path_b:
+        return False
+    try:
+        return _decompress.needs_python(path_a, path_b)
+    except OSError as e:
+        get_logger().debug("cannot sniff magic bytes (%s), using native path", e)
+        return False  # let the C core report the missing/unreadable file
+
+
+def compare_into(
+    source_a: str | Source,
+    source_b: str | Source,
+    out: FileDiff,
+    *,
+    chunk_size: int = 65536,
+    size_precheck: bool = True,
+    headers: dict[str, str] | None = None,
+    timeout: float = 30.0,
+    follow_redirects: bool = True,
+    verify_ssl: bool = True,
+    proxy: str | None = None,
+    header_skip: int = 0,
+    footer_skip: int = 0,
+    decode_a: str = "none",
+    decode_b: str = "none",
+    huge_pages: bool = False,
+    io_uring: bool = False,
+    io_uring_depth: int = 8,
+    strategy: str = "auto",
+    include_slack: bool = False,
+    lock_files: bool = False,
+    cancel: CancelToken | None = None,
+) -> bool:
+    """Compare two sources and write a diff summary into ``out``.
+
+    Lets batch callers reuse one :class:`FileDiff` across many
+    comparisons. Sources are scanned sequentially (no quick check), so
+    ``first_diff_offset`` is exact. With ``size_precheck`` a size
+    mismatch is reported without reading content, leaving
+    ``first_diff_offset`` as None. ``io_a``/``io_b`` record whether each
+    local file was read via mmap (or ``io_uring``) and, if not, why, plus
+    the outcome of ``huge_pages``. ``strategy``, ``include_slack``,
+    ``lock_files`` and ``cancel`` are as in :func:`compare`; with ``include_slack``, ``size_a``/``size_b``
+    are the device sizes.
+
+    :param source_a: File path, URL, or Source object.
+    :param source_b: File path, URL, or Source object.
+    :param out: Result object to fill; every field is overwritten.
+    :returns: ``out.equal``.
+    :raises DecodeError: If a decoded source is not valid base64/hex.
+    """
+    validate_path(source_a, "source_a")
+    validate_path(source_b, "source_b")
+    validate_chunk_size(chunk_size)
+    validate_timeout(timeout)
+    validate_skip(header_skip, "header_skip")
+    validate_skip(footer_skip, "footer_skip")
+    validate_decode(decode_a, "decode_a")
+    validate_decode(decode_b, "decode_b")
+    validate_io_uring_depth(io_uring_depth)
+    validate_strategy(strategy, io_uring)
+    token = cancel_handle(cancel)
+
+    cfg = get_config()
+    path_a, path_b, h, p = _resolve_sources(source_a, source_b, headers, proxy)
+
+    start = time.perf_counter()
+    with shared_locks((path_a, path_b)) if lock_files else contextlib.nullcontext():
+        equal, reason, offset, size_a, size_b, io_a, io_b = _compare_c(
+            path_a, path_b,
+            chunk_size=chunk_size,
+            size_precheck=size_precheck,
+            headers=h,
+            timeout=timeout,
+            follow_redirects=follow_redirects,
+            verify_ssl=verify_ssl,
+            allow_private=cfg.allow_private_redirects,
+            proxy=p,
+            header_skip=header_skip,
+            footer_skip=footer_skip,
+            decode_a=decode_a,
+            decode_b=decode_b,
+            huge_pages=huge_pages,
+            io_uring_depth=io_uring_depth if io_uring else 0,
+            detail=True,
+            block_devices=include_slack,
+            strategy=strategy,
+            cancel=token,
+        )
+    out.equal = equal
+    out.reason = DiffReason(reason) if reason is not None else None
+    out.first_diff_offset = offset
+    out.size_a = size_a
+    out.size_b = size_b
+    out.io_a = _io_info(io_a)
+    out.io_b = _io_info(io_b)
+    if huge_pages:
+        for path, io in ((path_a, out.io_a), (path_b, out.io_b)):
+            if io is not None and io.huge_pages == "refused":
+                get_logger().info("huge_pages: refused for %s; using normal pages", path)
+    if io_uring:
+        for path, io in ((path_a, out.io_a), (path_b, out.io_b)):
+            if io is not None and io.fallback == "uring_unavailable":
+                get_logger().info("io_uring: unavailable for %s; using read()", path)
+    if strategy == "prefetch":
+        for path, io in ((path_a, out.io_a), (path_b, out.io_b)):
+            if io is not None and io.fallback == "prefetch_unavailable":
+                get_logger().info("prefetch: unavailable for %s; using read()", path)
+    get_logger().debug(
+        "compare_into %s %s: io_a=%s io_b=%s equal=%s in %.3fs",
+        path_a, path_b, out.io_a, out.io_b, equal, time.perf_counter() - start,
+    )
+    return equal
+
+
+def _io_info(raw: tuple[str, str, str] | None) -> IOInfo | None:
+    if raw is None:
+        return None
+    path, fallback, huge = raw
+    return IOInfo(
+        path=path,
+        fallback=None if fallback == "none" else fallback,
+        huge_pages=None if huge == "none" else huge,
+    )
+
+
+def _first_diff(data: bytes | mmap.mmap, want: memoryview, chunk_size: int) -> int | None:
+    n = min(len(data), len(want))
+    for off in range(0, n, chunk_size):
+        lo, hi = off, min(off + chunk_size, n)
+        if data[lo:hi] == want[lo:hi]:
+            continue
+        # Narrow the differing chunk down to one byte
+        while hi - lo > 1:
+            mid = (lo + hi) // 2
+            if data[lo:mid] == want[lo:mid]:
+                lo = mid
+            else:
+                hi = mid
+        return lo
+    return None if len(data) == len(want) else n
+
+
+def compare_file_bytes(
+    path: str,
+    want: bytes | bytearray | memoryview,
+    *,
+    size_precheck: bool = True,
+    chunk_size: int = 65536,
+) -> tuple[bool, int | None]:
+    """Compare a local file against an expected in-memory buffer.
+
+    Meant for test assertions: the file is mmap'd (read for empty or
+    unmappable files) and compared against ``want`` chunk by chunk, so
+    a mismatch comes with the offset of the first differing byte. With
+    ``size_precheck`` a length mismatch returns immediately without
+    reading the file, and the offset is None.
+
+    :param path: Path to file.
+    :param want: Expected content.
+    :param size_precheck: Compare the file size against ``len(want)`` first.
+    :param chunk_size: Comparison chunk size in bytes.
+    :returns: ``(equal, first_diff_offset)``; the offset is None when
+        equal, and the shorter length if one is a prefix of the other.
+    """
+    validate_path(path, "path")
+    validate_chunk_size(chunk_size)
+    expected = memoryview(want).cast("B")
+
+    with open(path, "rb") as f:
+        size = os.fstat(f.fileno()).st_size
+        if size_precheck and size != len(expected):
+            return False, None
+        try:
+            data = mmap.mmap(f.fileno(), 0, access=mmap.ACCESS_READ) if size else f.read()
+        except (OSError, ValueError):
+            data = f.read()
+        try:
+            offset = _first_diff(data, expected, chunk_size)
+        finally:
+            if isinstance(data, mmap.mmap):
+                data.close()
+    return offset is None, offset
+
+
+def _fd_and_start(handle: object, name: str) -> tuple[int, int]:
+    if isinstance(handle, bool):
+        raise TypeError(f"{name} must be a file descriptor or binary file object")
+    if isinstance(handle, int):
+        return handle, -1  # C reads the descriptor's current offset
+    if isinstance(handle, io.TextIOBase):
+        raise TypeError(f"{name}: text streams are not supported, pass the binary file")
+    try:
+        fd = handle.fileno()  # type: ignore[attr-defined]
+    except (AttributeError, io.UnsupportedOperation):
+        raise TypeError(f"{name} must be a file descriptor or binary file object") from None
+    # A buffered reader's logical position is ahead of (or behind) the
+    # descriptor's offset by what sits in its buffer; tell() accounts for it
+    try:
+        return fd, handle.tell()  # type: ignore[attr-defined]
+    except (AttributeError, OSError, io.UnsupportedOperation):
+        return fd, -1
+
+
+def compare_handles(
+    a: int | io.IOBase,
+    b: int | io.IOBase,
+    *,
+    chunk_size: int = 65536,
+    size_precheck: bool = True,
+) -> tuple[bool, int | None]:
+    """Compare two already open files from their current positions to EOF.
+
+    For callers that open files themselves (special flags, ``O_DIRECT``,
+    a position already set). Each handle is used as-is: it is mmap'd
+    through its descriptor where possible and read with ``pread()``
+    otherwise, so neither handle is closed and neither file offset moves
+    (on Windows the unmappable fallback does move it). Both must refer
+    to regular files opened for reading.
+
+    A binary file object starts at its ``tell()`` position, which
+    accounts for read-ahead buffering; a bare descriptor at its offset.
+    Unflushed writes in a Python buffer are not seen — flush first.
+
+    :param a: First file: descriptor or binary file object with ``fileno()``.
+    :param b: Second file.
+    :param chunk_size: Comparison chunk size in bytes.
+    :param size_precheck: Compare the remaining lengths first; a mismatch
+        returns without reading and the offset is None.
+    :returns: ``(equal, first_diff_offset)``; the offset is relative to
+        the starting positions, None when equal, and the shorter length
+        if one is a prefix of the other.
+    :raises TypeError: If a handle is not a descriptor or binary file.
+    :raises OSError: If a descriptor is invalid, not a regular file, or
+        cannot be read.
+    """
+    validate_chunk_size(chunk_size)
+    fd_a, start_a = _fd_and_start(a, "a")
+    fd_b, start_b = _fd_and_start(b, "b")
+    return _compare_fds_c(
+        fd_a, fd_b, start_a=start_a, start_b=start_b,
+        chunk_size=chunk_size, size_precheck=size_precheck,
+    )
+
+
+def _compare_window(path_a: str, path_b: str, offset: int, length: int,
+                    chunk_size: int) -> bool:
+    """The same *length* bytes from *offset* of two files, compared in C."""
+    return _compare_c(path_a, path_b, chunk_size=chunk_size, quick_check=False,
+                      header_skip=offset, length=length)
+
+
+def compare_sampled(
+    path_a: str,
+    path_b: str,
+    *,
+    sample_every: int,
+    block_size: int = 65536,
+) -> bool:
+    """Probabilistically compare two files by reading every Nth block.
+
+    The files are split into ``block_size`` blocks and only blocks
+    0, N, 2N, … plus the final block are read and compared, each as a
+    C window like :func:`compare_range`. Differing
+    sizes short-circuit to False. This is a pre-screen, not a proof of
+    equality: a difference that falls entirely between sampled blocks
+    is missed, so True means "probably equal".
+
+    :param path_a: Path to first file.
+    :param path_b: Path to second file.
+    :param sample_every: Block stride N; 1 compares every block.
+    :param block_size: Block size in bytes.
+    :returns: False if the sizes or any sampled block differ.
+    :raises ValueError: If ``sample_every`` or ``block_size`` is not positive.
+    """
+    validate_path(path_a, "path_a")
+    validate_path(path_b, "path_b")
+    if block_size <= 0:
+        raise ValueError("block_size must be positive")
+    if block_size > 1024 * 1024 * 1024:
+        raise ValueError("block_size must be <= 1GB")
+    if sample_every <= 0:
+        raise ValueError("sample_every must be positive")
+
+    size = os.stat(path_a).st_size
+    if os.stat(path_b).st_size != size:
+        return False
+    blocks = -(-size // block_size)
+    indices = list(range(0, blocks, sample_every))
+    if blocks and indices[-1] != blocks - 1:
+        indices.append(blocks - 1)
+    return all(
+        _compare_window(path_a, path_b, i * block_size, min(block_size, size - i * block_size),
+                        min(block_size, 1024 * 1024))
+        for i in indices
+    )
+
+
+def compare_head_tail(
+    path_a: str,
+    path_b: str,
+    n: int,
+    *,
+    chunk_size: int = 65536,
+) -> bool:
+    """Probabilistically compare two files by their size, head and tail.
+
+    Only the first ``n`` and the last ``n`` bytes are read (the whole
+    file if it is at most ``2 * n`` long), each end as a C window like
+    :func:`compare_range`. Differing sizes short-circuit
+    to False. A change in the middle is missed, so True means "probably
+    equal" — a pre-screen before a full :func:`compare`.
+
+    :param path_a: Path to first file.
+    :param path_b: Path to second file.
+    :param n: Bytes to compare at each end.
+    :param chunk_size: Read size in bytes.
+    :returns: False if the sizes, heads or tails differ.
+    :raises ValueError: If ``n`` is negative.
+    """
+    validate_path(path_a, "path_a")
+    validate_path(path_b, "path_b")
+    validate_chunk_size(chunk_size)
+    if n < 0:
+        raise ValueError("n must be non-negative")
+
+    size = os.stat(path_a).st_size
+    if os.stat(path_b).st_size != size:
+        return False
+    windows = [(0, size)] if 2 * n >= size else [(0, n), (size - n, n)]
+    return all(_compare_window(path_a, path_b, offset, length, chunk_size)
+               for offset, length in windows if length)
+
+
+def compare_range(
+    path_a: str,
+    path_b: str,
+    offset: int,
+    length: int | None = None,
+    *,
+    chunk_size: int = 65536,
+    quick_check: bool = True,
+    strategy: str = "auto",
+    cancel: CancelToken | None = None,
+) -> bool:
+    """Compare the same byte range of two local files.
+
+    Only ``length`` bytes from ``offset`` are read from each file, e.g. a
+    fixed-size header, the downloaded part of a partial file or one
+    partition of a disk image; bytes outside the range are ignored. The
+    range must lie within both files: one that extends past the end of
+    either is an error rather than a shorter comparison.
+
+    :param path_a: Path to first file.
+    :param path_b: Path to second file.
+    :param offset: First byte of the range.
+    :param length: Bytes in the range; None for up to the end of each
+        file, which then requires equal sizes to compare equal.
+    :param chunk_size: Chunk size in bytes.
+    :param quick_check: Sample key offsets of the range before full scan.
+    :param strategy: As in :func:`compare`.
+    :param cancel: Token that stops the scan, as in :func:`compare`.
+    :returns: True if the ranges are byte-identical.
+    :raises ValueError: If ``offset`` or ``length`` is negative, or the
+        range extends past the end of a file.
+    :raises CancelledError: If cancel fired.
+    """
+    validate_path(path_a, "path_a")
+    validate_path(path_b, "path_b")
+    validate_chunk_size(chunk_size)
+    validate_strategy(strategy, False)
+    if offset < 0:
+        raise ValueError("offset must be non-negative")
+    if length is not None and length < 0:
+        raise ValueError("length must be non-negative")
+    end = offset + (length or 0)
+    for path in (path_a, path_b):
+        size = os.stat(path).st_size
+        if end > size:
+            raise ValueError(
+                f"range {offset}-{end} extends past the end of {path} ({size} bytes)"
+            )
+    return _compare_c(
+        path_a, path_b,
+        chunk_size=chunk_size,
+        quick_check=quick_check,
+        header_skip=offset,
+        length=-1 if length is None else length,
+        strategy=strategy,
+        cancel=cancel_handle(cancel),
+    )
+
+
+def compare_length_prefixed(
+    path_a: str,
+    path_b: str,
+    *,
+    header_size: int,
+    declared_length: Callable[[bytes], int],
+    chunk_size: int = 65536,
+    quick_check: bool = True,
+) -> bool:
+    """Compare two files whose logical length is declared in a header.
+
+    Reads the first ``header_size`` bytes of each file and passes them to
+    ``declared_length``, which returns the logical length of the record
+    (header included). If the two lengths differ the files are reported
+    as different without reading their bodies. Otherwise only that many
+    bytes are compared, so trailing padding is ignored. A file shorter
+    than its declared length is truncated and differs from the other,
+    even if both are cut short the same way.
+
+    :param path_a: Path to first file.
+    :param path_b: Path to second file.
+    :param header_size: Bytes to read before calling ``declared_length``.
+    :param declared_length: Maps a header to the logical length in bytes.
+        Receives fewer than ``header_size`` bytes if a file is shorter.
+    :param chunk_size: Chunk size in bytes.
+    :param quick_check: Sample key offsets before full scan.
+    :returns: True if the logical contents are identical.
+    :raises ValueError: If ``declared_length`` returns a negative length.
+    """
+    validate_path(path_a, "path_a")
+    validate_path(path_b, "path_b")
+    validate_chunk_size(chunk_size)
+    if header_size <= 0:
+        raise ValueError("header_size must be positive")
+
+    lengths = []
+    truncated = False
+    for path in (path_a, path_b):
+        with open(path, "rb") as f:
+            length = declared_length(f.read(header_size))
+            size = os.fstat(f.fileno()).st_size
+        if length < 0:
+            raise ValueError(f"declared_length returned {length} for {path}")
+        if size < length:
+            get_logger().debug("compare_length_prefixed %s: declares %d bytes, has %d",
+                               path, length, size)
+            truncated = True
+        lengths.append(length)
+
+    if lengths[0] != lengths[1] or truncated:
+        return False
+    return _compare_c(
+        path_a, path_b,
+        chunk_size=chunk_size,
+        quick_check=quick_check,
+        length=lengths[0],
+    )
+
+
+_NUMERIC_SIZES = {"float32": 4, "float64": 8}
+
+
+def compare_numeric(
+    path_a: str,
+    path_b: str,
+    *,
+    dtype: str = "float64",
+    abs_tol: float = 0.0,
+    rel_tol: float = 0.0,
+    nan_equal: bool = False,
+    chunk_size: int = 65536,
+) -> bool:
+    """Compare two files as arrays of floating-point numbers.
+
+    Elements are read in native byte order and compared pairwise: two
+    values are equal if ``abs(a - b) <= max(rel_tol * max(abs(a), abs(b)),
+    abs_tol)``, as in :func:`math.isclose`. Infinities must match exactly.
+    Unless ``nan_equal`` is set, a NaN makes the files differ even if
+    they are byte-identical.
+
+    :param path_a: Path to first file.
+    :param path_b: Path to second file.
+    :param dtype: Element type: "float32" or "float64".
+    :param abs_tol: Absolute tolerance.
+    :param rel_tol: Relative tolerance.
+    :param nan_equal: Treat NaN as equal to NaN.
+    :param chunk_size: Chunk size in bytes (rounded down to whole elements).
+    :returns: True if both files hold the same number of elements and every
+        pair is within tolerance.
+    :raises ValueError: If a file length is not a multiple of the element size.
+    """
+    validate_path(path_a, "path_a")
+    validate_path(path_b, "path_b")
+    validate_chunk_size(chunk_size)
+    esize = _NUMERIC_SIZES.get(dtype)
+    if esize is None:
+        raise ValueError(f"dtype must be one of {', '.join(_NUMERIC_SIZES)}")
+    if abs_tol < 0 or rel_tol < 0:
+        raise ValueError("abs_tol and rel_tol must be non-negative")
+
+    for path in (path_a, path_b):
+        size = os.stat(path).st_size
+        if size % esize:
+            raise ValueError(
+                f"{path}: size {size} is not a multiple of {esize} ({dtype})"
+            )
+
+    return _compare_numeric_c(
+        path_a, path_b,
+        dtype=dtype,
+        abs_tol=abs_tol,
+        rel_tol=rel_tol,
+        nan_equal=nan_equal,
+        chunk_size=chunk_size,
+    )
+
+
+def count_differing_bytes(
+    path_a: str,
+    path_b: str,
+    *,
+    chunk_size: int = 65536,
+) -> tuple[int, int]:
+    """Count the byte positions at which two files differ.
+
+    Both files are read in full with no short-circuit, so this costs a
+    complete scan even when they differ early. Bytes past the end of the
+    shorter file count as differing.
+
+    :param path_a: Path to first file.
+    :param path_b: Path to second file.
+    :param chunk_size: Chunk size in bytes.
+    :returns: ``(differing, total)`` where ``total`` is the length of the
+        longer file; ``differing == 0`` means the files are identical.
+    """
+    validate_path(path_a, "path_a")
+    validate_path(path_b, "path_b")
+    validate_chunk_size(chunk_size)
+    return _count_differing_bytes_c(path_a, path_b, chunk_size=chunk_size)
+
+
+def diff_stats(
+    path_a: str,
+    path_b: str,
+    *,
+    chunk_size: int = 65536,
+    cancel: CancelToken | None = None,
+) -> DiffStats:
+    """Scan two files in full and describe how much of them differs.
+
+    Unlike :func:`compare`, which stops at the first mismatch, every byte
+    is read: the result counts the differing positions, the runs they
+    form (a corrupted sector is one range, however long) and the
+    similarity as a percentage, for analysing a bad copy. Bytes past the
+    end of the shorter file differ and form the last range.
+
+    :param path_a: Path to first file.
+    :param path_b: Path to second file.
+    :param chunk_size: Chunk size in bytes.
+    :param cancel: Token that stops the scan, as in :func:`compare`.
+    :returns: DiffStats.
+    :raises CancelledError: If cancel fired.
+    :raises ComparisonTimeoutError: If cancel's deadline passed.
+    """
+    validate_path(path_a, "path_a")
+    validate_path(path_b, "path_b")
+    validate_chunk_size(chunk_size)
+    differing, ranges, first, size_a, size_b = _diff_stats_c(
+        path_a, path_b, chunk_size=chunk_size, cancel=cancel_handle(cancel),
+    )
+    return DiffStats(
+        size_a=size_a, size_b=size_b,
+        differing_bytes=differing, differing_ranges=ranges, first_diff_offset=first,
+    )
+
+
+def common_prefix_len(
+    path_a: str,
+    path_b: str,
+    *,
+    chunk_size: int = 65536,
+) -> int:
+    """Count the leading bytes two files share before they diverge.
+
+    This is the first-diff offset phrased positively: for identical files
+    it is their length, and when one file is a prefix of the other it is
+    the shorter length. Sizes are not pre-checked, so files of different
+    length are still scanned up to the first differing byte.
+
+    :param path_a: Path to first file.
+    :param path_b: Path to second file.
+    :param chunk_size: Chunk size in bytes.
+    :returns: Length of the common prefix, ``0 <= n <= min(size_a, size_b)``.
+    """
+    validate_path(path_a, "path_a")
+    validate_path(path_b, "path_b")
+    out = FileDiff()
+    if compare_into(path_a, path_b, out, chunk_size=chunk_size, size_precheck=False):
+        return out.size_a or 0
+    return out.first_diff_offset or 0
+
+
+def is_prefix(
+    path_a: str,
+    path_b: str,
+    *,
+    chunk_size: int = 65536,
+) -> Literal["a", "b", "equal"] | None:
+    """Check whether one file is the other with data appended.
+
+    The shorter file must match the start of the longer one byte for
+    byte, as when an append-only log has grown. Both files are scanned
+    up to the end of the shorter one (or the first differing byte).
+
+    :param path_a: Path to first file.
+    :param path_b: Path to second file.
+    :param chunk_size: Chunk size in bytes.
+    :returns: ``"a"`` if A is a strict prefix of B, ``"b"`` if B is a
+        strict prefix of A, ``"equal"`` if the files are identical, and
+        None if they differ within the shorter length.
+    """
+    validate_path(path_a, "path_a")
+    validate_path(path_b, "path_b")
+    out = FileDiff()
+    if compare_into(path_a, path_b, out, chunk_size=chunk_size, size_precheck=False):
+        return "equal"
+    if out.first_diff_offset == out.size_a:
+        return "a"
+    if out.first_diff_offset == out.size_b:
+        return "b"
+    return None
+
+
+def _window(path: str, start: int, size: int) -> bytes:
+    with open(path, "rb") as f:
+        f.seek(start)
+        return f.read(size)
+
+
+def first_difference(
+    path_a: str,
+    path_b: str,
+    *,
+    context: int = 16,
+    chunk_size: int = 65536,
+) -> Mismatch | None:
+    """Locate the first differing byte of two files.
+
+    The files are scanned in C up to the first difference, as by
+    :func:`common_prefix_len`; sizes are not pre-checked. Then up to
+    *context* bytes on each side of the offset are read from both files
+    for display.
+
+    :param path_a: Path to first file.
+    :param path_b: Path to second file.
+    :param context: Bytes of context before and after the offset.
+    :param chunk_size: Chunk size in bytes.
+    :returns: The first mismatch, or None if the files are identical.
+    :raises ValueError: If context is negative.
+    """
+    validate_path(path_a, "path_a")
+    validate_path(path_b, "path_b")
+    if context < 0:
+        raise ValueError("context must be non-negative")
+    out = FileDiff()
+    if compare_into(path_a, path_b, out, chunk_size=chunk_size, size_precheck=False):
+        return None
+    offset = out.first_diff_offset or 0
+    start = max(0, offset - context)
+    window_a = _window(path_a, start, offset - start + context + 1)
+    window_b = _window(path_b, start, offset - start + context + 1)
+    at = offset - start
+    return Mismatch(
+        offset=offset,
+        byte_a=window_a[at] if at < len(window_a) else None,
+        byte_b=window_b[at] if at < len(window_b) else None,
+        context_start=start,
+        context_a=window_a,
+        context_b=window_b,
+    )
+
+
+def compare_dir(
+    dir_a: str,
+    dir_b: str,
+    *,
+    chunk_size: int = 65536,
+    size_precheck: bool = True,
+    quick_check: bool = True,
+    follow_symlinks: bool = True,
+    max_workers: int = 0,
+    ignore: list[str] | None = None,
+    special_files: bool = False,
+    detect_renames: bool = False,
+    max_depth: int | None = None,
+    max_memory: int | None = None,
+    regular_files_only: bool = False,
+    compare_xattrs: bool = False,
+    content_filter: ContentFilter | None = None,
+    use_gitignore: bool = False,
+    progress: DirProgress | None = None,
+    progress_interval: float = 0.1,
+    known_diffs: str | None = None,
+    rename_map: dict[str, str] | None = None,
+    path_rewrite: PathRewrite | None = None,
+    detect_encoding_mismatch: bool = False,
+    stop_on_error: bool = False,
+    exclude: list[str] | None = None,
+    include: list[str] | None = None,
+    symlinks: str | None = None,
+    cancel: CancelToken | None = None,
+    on_progress: ProgressCallback | None = None,
+    metadata: list[str] | None = None,
+    mtime_tolerance: float = 0.0,
+    cache: str | DigestCache | None = None,
+    detect_hardlinks: bool = False,
+    opener: Opener | None = None,
+) -> DirResult:
+    """Compare two directories recursively.
+
+    :param dir_a: Path to first directory.
+    :param dir_b: Path to second directory.
+    :param chunk_size: Chunk size for file comparison.
+    :param size_precheck: Compare file sizes before content.
+    :param quick_check: Sample key offsets before full scan.
+    :param follow_symlinks: Follow symbolic links during traversal.
+    :param max_workers: Thread pool size (0=auto, 1=sequential).
+    :param ignore: Glob patterns to exclude (matched per path component).
+    :param special_files: Include FIFOs, sockets and device nodes, compared
+        by type (and major/minor for devices) instead of content.
+    :param detect_renames: Pair only_left/only_right files with identical
+        content (size + SHA-256) and report them in ``renamed``.
+    :param max_depth: Descend at most this many levels (0 = files in the
+        root only). Deeper entries are not walked and appear in no set.
+    :param max_memory: Cap on in-flight compare buffers in bytes. Each
+        active worker holds ``2 * chunk_size``; the pool is shrunk to fit.
+    :param regular_files_only: Fail on the first entry that is not a
+        regular file or directory (symlinks included, even when followed).
+    :param compare_xattrs: Also compare extended attributes of files with
+        equal content; mismatches are reported as XATTR_MISMATCH. Linux only.
+    :returns: DirResult with equal, diff, only_left, only_right.
+    :param content_filter: Re-compare files that differ byte-wise through
+        ``content_filter(path, stream)``; pairs with equal filtered output
+        are dropped from ``diff``. A filter error marks only that file
+        as READ_ERROR.
+    :param use_gitignore: Exclude paths ignored by the ``.gitignore``
+        files of either tree (root and nested, git's matching rules,
+        ``!`` negation included). ``.git`` is always excluded.
+    :param progress: ``progress(files_done, files_total, bytes_done,
+        bytes_total)`` for the whole tree, called on the calling thread at
+        most once per ``progress_interval`` seconds while the walk runs on
+        a worker thread. Totals are 0 until both trees are walked; a pair
+        counts the larger of its sizes once it is compared.
+    :param progress_interval: Seconds between ``progress`` and
+        ``on_progress`` polls.
+    :param on_progress: Called with a :class:`ProgressEvent` (counters as
+        for ``progress``, plus the path of the pair started last and the
+        elapsed time) on the same schedule. ``bytes_done`` advances as
+        each chunk is read.
+    :param known_diffs: Path to a file of relative paths (optionally
+        ``path @offset``) expected to differ. Listed differences go to
+        ``expected_diffs`` instead of ``diff`` and do not fail ``equal``;
+        listed files that now compare equal go to ``stale_known_diffs``.
+    :param rename_map: ``{path_in_a: path_in_b}`` for files moved on
+        purpose. Mapped files are compared with their target instead of
+        the same path; equal pairs go to ``renamed``, differing ones to
+        ``diff`` under the A path, and a pair missing a side leaves the
+        other in ``only_left``/``only_right``.
+    :param path_rewrite: ``(from, to)`` pairs replaced in the content of
+        files that differ byte-wise (after ``content_filter``); pairs equal
+        after the substitution are dropped from ``diff``. Textual, not
+        path-aware.
+    :param detect_encoding_mismatch: Report files that hold the same text
+        in a different encoding or BOM state as ENCODING_MISMATCH instead
+        of a content or size mismatch. They still count as differences.
+    :param stop_on_error: Abort on the first unreadable entry instead of
+        listing it in ``errors`` (walk) or as READ_ERROR (compare) and
+        carrying on. Pairs not yet started are skipped.
+    :param exclude: Gitignore-style patterns of paths to leave out,
+        applied during the walk: an excluded directory is not entered.
+        A trailing ``/`` matches directories only; a ``/`` elsewhere
+        anchors the pattern to the root; ``**`` spans directories.
+    :param include: Gitignore-style patterns; only files that match one,
+        or lie in a directory that does, are compared. ``exclude`` wins.
+    :param symlinks: Symlink policy, overriding ``follow_symlinks``:
+        ``"follow"`` compares what links point to (loops are walked once),
+        ``"compare-link"`` lists every link and compares target strings
+        (LINK_TARGET_MISMATCH; a link against a non-link is TYPE_MISMATCH),
+        ``"skip"`` leaves links out, dangling ones included.
+    :param cancel: Token to stop the comparison from another thread or
+        after a deadline; checked per directory walked and per chunk on
+        every worker. Pairs not yet started are skipped and no partial
+        result is returned.
+    :param metadata: Metadata checks for files with equal content, any of
+        ``"mode"`` (permission bits), ``"mtime"``, ``"uid"``, ``"gid"``
+        and ``"xattr"`` (same as ``compare_xattrs``). A failed check is
+        reported as MODE_MISMATCH, MTIME_MISMATCH, OWNER_MISMATCH or
+        XATTR_MISMATCH, the first in that order when several fail.
+    :param mtime_tolerance: Seconds two mtimes may differ and still match,
+        for filesystems with coarse timestamps.
+    :param cache: A DigestCache, or the directory of one: files of equal
+        size are compared by SHA-256, and files whose stat signature is
+        unchanged since a previous run are not read at all. Not with
+        ``special_files``, ``regular_files_only``, ``symlinks="compare-link"``,
+        ``size_precheck=False``, ``quick_check=False``, ``max_memory`` or
+        progress callbacks.
+    :param detect_hardlinks: Compare the content of each pair of inodes
+        once: a pair whose two files are hard links (or bind-mounted
+        views) of an earlier pair's takes its result without being read.
+        Costs one extra stat per common pair. A pair that is one inode on
+        both sides is never read, with or without this.
+    :param opener: Read every file through ``opener(path)``, as in
+        :func:`compare` (``content_filter`` included). The trees are
+        walked in Python and pairs compared as streams, so quick check,
+        ``max_memory`` and progress do not apply, and every difference is
+        CONTENT_MISMATCH. An opener error marks only that file as
+        READ_ERROR. Not with ``cache``, ``special_files``,
+        ``regular_files_only``, ``symlinks="compare-link"``,
+        ``detect_hardlinks``, ``detect_renames``, ``rename_map``,
+        ``known_diffs``, ``detect_encoding_mismatch`` or progress callbacks.
+    :raises NonRegularFileError: With ``regular_files_only``, naming the
+        offending path and its type.
+    :raises NotImplementedError: With ``compare_xattrs`` or an ``"xattr"``
+        check on a platform without xattr support in :mod:`os`.
+    :raises OSError: With ``stop_on_error``, naming the unreadable path.
+    :raises CancelledError: If ``cancel`` was cancelled.
+    :raises ComparisonTimeoutError: If the deadline of ``cancel`` passed.
+    """
+    validate_path(dir_a, "dir_a")
+    validate_path(dir_b, "dir_b")
+    validate_chunk_size(chunk_size)
+    validate_max_workers(max_workers)
+    validate_max_depth(max_depth)
+    validate_max_memory(max_memory, chunk_size)
+    validate_patterns(exclude, "exclude")
+    validate_patterns(include, "include")
+    validate_symlinks(symlinks)
+    token = cancel_handle(cancel)
+    if symlinks is not None:
+        follow_symlinks = symlinks == "follow"
+    if regular_files_only and special_files:
+        raise ValueError("regular_files_only and special_files are exclusive")
+    if cache is not None:
+        for name, used in (("special_files", special_files),
+                           ("regular_files_only", regular_files_only),
+                           ("symlinks='compare-link'", symlinks == "compare-link"),
+                           ("size_precheck=False", not size_precheck),
+                           ("quick_check=False", not quick_check),
+                           ("max_memory", max_memory is not None),
+                           ("progress", progress is not None),
+                           ("on_progress", on_progress is not None)):
+            if used:
+                raise ValueError(f"cache cannot be combined with {name}")
+    if opener is not None:
+        for name, used in (("cache", cache is not None),
+                           ("special_files", special_files),
+                           ("regular_files_only", regular_files_only),
+                           ("symlinks='compare-link'", symlinks == "compare-link"),
+                           ("detect_hardlinks", detect_hardlinks),
+                           ("detect_renames", detect_renames),
+                           ("rename_map", bool(rename_map)),
+                           ("known_diffs", known_diffs is not None),
+                           ("detect_encoding_mismatch", detect_encoding_mismatch),
+                           ("progress", progress is not None),
+                           ("on_progress", on_progress is not None)):
+            if used:
+                raise ValueError(f"opener cannot be combined with {name}")
+    validate_metadata(metadata, mtime_tolerance)
+    checks = set(metadata or ())
+    if compare_xattrs:
+        checks.add("xattr")
+    if "xattr" in checks and not hasattr(os, "listxattr"):
+        raise NotImplementedError("compare_xattrs is not supported on this platform")
+    validate_progress_interval(progress_interval)
+    known = load_known_diffs(known_diffs) if known_diffs is not None else None
+    renames = normalize_rename_map(rename_map) if rename_map else None
+    if path_rewrite:
+        content_filter = rewrite_filter(path_rewrite, content_filter, chunk_size=chunk_size)
+
+    log = get_logger()
+    start = time.perf_counter()
+    kwargs: dict = {
+        "chunk_size": chunk_size,
+        "size_precheck": size_precheck,
+        "quick_check": quick_check,
+        "follow_symlinks": follow_symlinks,
+        "max_workers": max_workers,
+        "special_files": special_files,
+        "max_depth": -1 if max_depth is None else max_depth,
+        "max_memory": max_memory or 0,
+        "regular_only": regular_files_only,
+        "stop_on_error": stop_on_error,
+        "exclude": exclude,
+        "include": include,
+        "symlinks": symlinks,
+        "cancel": token,
+        "hardlinks": detect_hardlinks,
+    }
+    keep = walk_filter(exclude, include)
+    if cache is not None:
+        digest_cache, owned = open_cache(cache)
+        try:
+            result = compare_dir_cached(
+                dir_a, dir_b, digest_cache,
+                chunk_size=chunk_size, follow_symlinks=follow_symlinks,
+                max_workers=max_workers, max_depth=max_depth, exclude=exclude,
+                include=include, stop_on_error=stop_on_error, cancel=cancel,
+                skip_links=symlinks == "skip",
+            )
+        finally:
+            if owned:
+                digest_cache.close()
+        log.debug("compare_dir %s %s: %d digests cached, %d files hashed",
+                  dir_a, dir_b, digest_cache.hits, digest_cache.misses)
+    elif opener is not None:
+        result = _compare_dir_opened(
+            dir_a, dir_b, opener,
+            chunk_size=chunk_size, size_precheck=size_precheck,
+            follow_symlinks=follow_symlinks, max_workers=max_workers,
+            max_depth=max_depth, keep=keep, stop_on_error=stop_on_error, cancel=cancel,
+        )
+    else:
+        raw = _run_polled(
+            _compare_dir_c, (dir_a, dir_b), on_progress, progress_interval,
+            dir_progress=progress, **kwargs,
+        )
+        result = build_dir_result(raw)
+    log.debug(
+        "compare_dir %s %s: %d differ, %d only left, %d only right, "
+        "%d errors in %.3fs",
+        dir_a, dir_b, len(result.diff), len(result.only_left),
+        len(result.only_right), len(result.errors), time.perf_counter() - start,
+    )
+    if ignore:
+        result = filter_dir_result(result, ignore)
+    if use_gitignore:
+        result = filter_gitignored(result, dir_a, dir_b)
+    if content_filter is not None:
+        result = _refilter_diff(
+            result, dir_a, dir_b,
+            lambda a, b: compare_filtered(
+                content_filter, a, b, chunk_size=chunk_size, opener=opener,
+            ),
+        )
+    if detect_encoding_mismatch:
+        result = _flag_encoding_mismatch(
+            result, dir_a, dir_b, lambda a, b: same_text(a, b, chunk_size),
+        )
+    if checks:
+        result = _compare_metadata(
+            result, dir_a, dir_b, checks, mtime_tolerance,
+            follow_symlinks, max_depth, ignore, keep,
+        )
+
+    def compared(paths: set[str]) -> set[str]:
+        if max_depth is not None:
+            paths = {p for p in paths if p.count("/") <= max_depth}
+        if keep is not None:
+            paths = {p for p in paths if keep(p)}
+        probe = DirResult(equal=False, diff={}, only_left=paths, only_right=set())
+        if ignore:
+            probe = filter_dir_result(probe, ignore)
+        if use_gitignore:
+            probe = filter_gitignored(probe, dir_a, dir_b)
+        return probe.only_left
+
+    if renames is not None:
+        def mapped_pair(a: str, b: str) -> DiffReason | None:
+            out = FileDiff()
+            compare_into(a, b, out, chunk_size=chunk_size, size_precheck=size_precheck)
+            return out.reason
+
+        result = _apply_rename_map(result, dir_a, dir_b, renames, mapped_pair, compared)
+        log.debug("compare_dir %s %s: %d of %d mapped renames equal",
+                  dir_a, dir_b, len(result.renamed), len(renames))
+    if detect_renames:
+        result = _detect_renames(
+            result, dir_a, dir_b, _hash_files_c, chunk_size, max_workers, follow_symlinks,
+        )
+        log.debug("compare_dir %s %s: %d renames detected",
+                  dir_a, dir_b, len(result.renamed))
+    if known is not None:
+        result = _apply_known_diffs(
+            result, dir_a, dir_b, known,
+            lambda a, b: common_prefix_len(a, b, chunk_size=chunk_size),
+            compared,
+        )
+        log.debug("compare_dir %s %s: %d known diffs, %d stale entries",
+                  dir_a, dir_b, len(result.expected_diffs),
+                  len(result.stale_known_diffs))
+    return result
+
+
+def _compare_dir_opened(
+    dir_a: str,
+    dir_b: str,
+    opener: Opener,
+    *,
+    chunk_size: int,
+    size_precheck: bool,
+    follow_symlinks: bool,
+    max_workers: int,
+    max_depth: int | None,
+    keep: Callable[[str], bool] | None,
+    stop_on_error: bool,
+    cancel: CancelToken | None,
+) -> DirResult:
+    """compare_dir's walk and content comparison, reading through *opener*."""
+    files_a, errors_a = scan_filtered(dir_a, follow_symlinks, max_depth, keep, stop_on_error)
+    files_b, errors_b = scan_filtered(dir_b, follow_symlinks, max_depth, keep, stop_on_error)
+    common = sorted(files_a.keys() & files_b.keys())
+
+    def cmp_pair(rel: str) -> DiffReason | None:
+        if cancel is not None:
+            cancel.raise_if_cancelled()
+        try:
+            equal = compare_opened(
+                opener, os.path.join(dir_a, rel), os.path.join(dir_b, rel),
+                size_precheck=size_precheck, chunk_size=chunk_size,
+            )
+        except Exception as e:
+            if stop_on_error:
+                raise
+            get_logger().info("compare_dir: opener failed for %s: %s", rel, e)
+            return DiffReason.READ_ERROR
+        return None if equal else DiffReason.CONTENT_MISMATCH
+
+    if max_workers == 1 or len(common) <= 1:
+        reasons = [cmp_pair(p) for p in common]
+    else:
+        from concurrent.futures import ThreadPoolExecutor
+
+        pool_size = max_workers if max_workers > 0 else min(len(common), 8)
+        with ThreadPoolExecutor(max_workers=pool_size) as pool:
+            reasons = list(pool.map(cmp_pair, common))
+
+    diff = {p: r for p, r in zip(common, reasons) if r is not None}
+    errors = errors_a | errors_b
+    only_left = {p for p in files_a.keys() - files_b.keys() if not _under(p, errors_b)}
+    only_right = {p for p in files_b.keys() - files_a.keys() if not _under(p, errors_a)}
+    return DirResult(
+        equal=not (diff or only_left or only_right or errors),
+        diff=diff,
+        only_left=only_left,
+        only_right=only_right,
+        errors=errors,
+    )
+
+
+def _run_polled(
+    fn: Callable[..., Any],
+    args: tuple,
+    on_progress: ProgressCallback | None,
+    interval: float,
+    *,
+    path: str | None = None,
+    dir_progress: DirProgress | None = None,
+    **kwargs: Any,
+) -> Any:
+    """Call a native compare, on a worker thread reporting its counters
+    if anyone listens.
+
+    The C call releases the GIL, so this thread is free to poll. A
+    callback exception (or Ctrl+C) propagates at once; the call itself
+    finishes in the background unless the caller cancels its token.
+    *path* stands in for the current path when the C side sets none.
+    """
+    if on_progress is None and dir_progress is None:
+        return fn(*args, **kwargs)
+
+    import threading
+
+    counters = _dir_progress_new()
+    outcome: dict = {}
+
+    def run() -> None:
+        try:
+            outcome["raw"] = fn(*args, progress=counters, **kwargs)
+        except BaseException as e:  # re-raised on the calling thread
+            outcome["error"] = e
 
-from komparu._types import DirResult  # noqa: F401 — re-export for type annotations
+    start = time.perf_counter()
+    worker = threading.Thread(target=run, name="komparu-compare", daemon=True)
+    worker.start()
+    last = None
+    while True:
+        worker.join(interval)
+        snapshot = _dir_progress_snapshot(counters)
+        if snapshot != last:
+            files_done, files_total, bytes_done, bytes_total, current = snapshot
+            if dir_progress is not None:
+                dir_progress(files_done, files_total, bytes_done, bytes_total)
+            if on_progress is not None:
+                on_progress(ProgressEvent(
+                    files_done, files_total, bytes_done, bytes_total,
+                    current if current is not None else path,
+                    time.perf_counter() - start,
+                ))
+            last = snapshot
+        if not worker.is_alive():
+            break
+    if "error" in outcome:
+        raise outcome["error"]
+    return outcome["raw"]
 
 
-def compare(
-    source_a: str | Source,
-    source_b: str | Source,
+def compare_dir_summary(
+    dir_a: str,
+    dir_b: str,
     *,
     chunk_size: int = 65536,
     size_precheck: bool = True,
     quick_check: bool = True,
-    headers: dict[str, str] | None = None,
-    timeout: float = 30.0,
-    follow_redirects: bool = True,
-    verify_ssl: bool = True,
-    proxy: str | None = None,
-) -> bool:
-    """Compare two sources byte-by-byte.
+    follow_symlinks: bool = True,
+    max_workers: int = 0,
+    special_files: bool = False,
+    max_depth: int | None = None,
+    max_memory: int | None = None,
+    regular_files_only: bool = False,
+    stop_on_error: bool = False,
+    exclude: list[str] | None = None,
+    include: list[str] | None = None,
+    symlinks: str | None = None,
+    cancel: CancelToken | None = None,
+    on_progress: ProgressCallback | None = None,
+    progress_interval: float = 0.1,
+    detect_hardlinks: bool = False,
+) -> DirSummary:
+    """Compare two directories and return only aggregate counts.
 
-    :param source_a: File path, URL, or Source object.
-    :param source_b: File path, URL, or Source object.
-    :param chunk_size: Chunk size in bytes.
-    :param size_precheck: Compare sizes before content.
+    Same comparison as :func:`compare_dir`, but no per-file paths are
+    collected, so memory stays flat on trees with many differences.
+
+    :param dir_a: Path to first directory.
+    :param dir_b: Path to second directory.
+    :param chunk_size: Chunk size for file comparison.
+    :param size_precheck: Compare file sizes before content.
     :param quick_check: Sample key offsets before full scan.
-    :param headers: Global HTTP headers for URL sources.
-    :param timeout: HTTP timeout in seconds.
-    :param follow_redirects: Follow HTTP redirects.
-    :param verify_ssl: Verify SSL certificates.
-    :param proxy: Proxy URL (e.g. http://host:port, socks5://host:port).
-    :returns: True if sources are byte-identical.
+    :param follow_symlinks: Follow symbolic links during traversal.
+    :param max_workers: Thread pool size (0=auto, 1=sequential).
+    :param special_files: Include FIFOs, sockets and device nodes.
+    :param max_depth: Descend at most this many levels (0 = root only).
+    :param max_memory: Cap on in-flight compare buffers in bytes. Each
+        active worker holds ``2 * chunk_size``; the pool is shrunk to fit.
+    :param regular_files_only: Fail on the first non-regular entry.
+    :param stop_on_error: Fail on the first unreadable entry.
+    :param exclude: Gitignore-style patterns to leave out of the walk.
+    :param include: Gitignore-style patterns of the files to compare.
+    :param symlinks: ``"follow"``, ``"compare-link"`` or ``"skip"``, as in
+        :func:`compare_dir`.
+    :param cancel: Cancellation token, as in :func:`compare_dir`.
+    :param on_progress: Progress callback, as in :func:`compare_dir`.
+    :param progress_interval: Seconds between ``on_progress`` polls.
+    :param detect_hardlinks: Compare each pair of inodes once, as in
+        :func:`compare_dir`.
+    :returns: DirSummary with counts, bytes read and duration.
+    :raises NonRegularFileError: With ``regular_files_only``.
+    :raises OSError: With ``stop_on_error``, naming the unreadable path.
     """
-    validate_path(source_a, "source_a")
-    validate_path(source_b, "source_b")
+    validate_path(dir_a, "dir_a")
+    validate_path(dir_b, "dir_b")
     validate_chunk_size(chunk_size)
-    validate_timeout(timeout)
-
-    cfg = get_config()
-
-    path_a = source_a.url if isinstance(source_a, Source) else source_a
-    path_b = source_b.url if isinstance(source_b, Source) else source_b
-
-    global_h = headers if headers is not None else (cfg.headers or None)
-    h_a = resolve_headers(source_a, global_h)
-    h_b = resolve_headers(source_b, global_h)
-    h = h_a or h_b or global_h
-
-    p = proxy if proxy is not None else cfg.proxy
+    validate_max_workers(max_workers)
+    validate_max_depth(max_depth)
+    validate_max_memory(max_memory, chunk_size)
+    validate_patterns(exclude, "exclude")
+    validate_patterns(include, "include")
+    validate_symlinks(symlinks)
+    if regular_files_only and special_files:
+        raise ValueError("regular_files_only and special_files are exclusive")
+    validate_progress_interval(progress_interval)
+    token = cancel_handle(cancel)
 
-    return _compare_c(
-        path_a, path_b,
+    start = time.perf_counter()
+    raw = _run_polled(
+        _compare_dir_c, (dir_a, dir_b), on_progress, progress_interval,
         chunk_size=chunk_size,
         size_precheck=size_precheck,
         quick_check=quick_check,
-        headers=h if h else None,
-        timeout=timeout,
-        follow_redirects=follow_redirects,
-        verify_ssl=verify_ssl,
-        allow_private=cfg.allow_private_redirects,
-        proxy=p,
+        follow_symlinks=follow_symlinks,
+        max_workers=max_workers,
+        special_files=special_files,
+        max_depth=-1 if max_depth is None else max_depth,
+        max_memory=max_memory or 0,
+        regular_only=regular_files_only,
+        stop_on_error=stop_on_error,
+        exclude=exclude,
+        include=include,
+        symlinks=symlinks,
+        summary_only=True,
+        cancel=token,
+        hardlinks=detect_hardlinks,
     )
+    summary = DirSummary(duration=time.perf_counter() - start, **raw)
+    get_logger().debug("compare_dir_summary %s %s: %s", dir_a, dir_b, summary)
+    return summary
 
 
-def compare_dir(
+def compare_dir_report(
     dir_a: str,
     dir_b: str,
     *,
+    offsets: bool = False,
     chunk_size: int = 65536,
     size_precheck: bool = True,
     quick_check: bool = True,
     follow_symlinks: bool = True,
     max_workers: int = 0,
     ignore: list[str] | None = None,
-) -> DirResult:
-    """Compare two directories recursively.
+    max_depth: int | None = None,
+    stop_on_error: bool = False,
+    exclude: list[str] | None = None,
+    include: list[str] | None = None,
+    symlinks: str | None = None,
+    cancel: CancelToken | None = None,
+    on_progress: ProgressCallback | None = None,
+    progress_interval: float = 0.1,
+    metadata: list[str] | None = None,
+    mtime_tolerance: float = 0.0,
+) -> DirReport:
+    """Compare two directories and report every path, matching ones too.
+
+    Runs the walk and content comparison of :func:`compare_dir` once,
+    keeping the files that matched, then stats each reported path for
+    its size on each side. Unreadable files (READ_ERROR) and unreadable
+    directories get the ERROR status. ``equal`` is that of
+    :func:`compare_dir`: unreadable directories and files whose metadata
+    cannot be read are ERROR entries that leave it unchanged, as they
+    go to ``errors`` there.
 
     :param dir_a: Path to first directory.
     :param dir_b: Path to second directory.
+    :param offsets: Also find the first differing byte of every file
+        pair with a content or size mismatch; reads those pairs again.
     :param chunk_size: Chunk size for file comparison.
     :param size_precheck: Compare file sizes before content.
     :param quick_check: Sample key offsets before full scan.
     :param follow_symlinks: Follow symbolic links during traversal.
     :param max_workers: Thread pool size (0=auto, 1=sequential).
     :param ignore: Glob patterns to exclude (matched per path component).
-    :returns: DirResult with equal, diff, only_left, only_right.
+    :param max_depth: Descend at most this many levels (0 = root only).
+    :param stop_on_error: Fail on the first unreadable entry.
+    :param exclude: Gitignore-style patterns to leave out of the walk.
+    :param include: Gitignore-style patterns of the files to compare.
+    :param symlinks: Symlink policy, as in :func:`compare_dir`; with
+        ``"compare-link"`` a link's size is the length of its target.
+    :param cancel: Cancellation token, as in :func:`compare_dir`; also
+        checked while ``offsets`` are found.
+    :param on_progress: Progress callback of the comparison.
+    :param progress_interval: Seconds between ``on_progress`` polls.
+    :param metadata: Metadata checks, as in :func:`compare_dir`; each
+        failing entry lists every check it failed in ``metadata``.
+    :param mtime_tolerance: Allowed mtime drift in seconds.
+    :returns: DirReport with one entry per path, sorted.
+    """
+    validate_path(dir_a, "dir_a")
+    validate_path(dir_b, "dir_b")
+    validate_chunk_size(chunk_size)
+    validate_max_workers(max_workers)
+    validate_max_depth(max_depth)
+    validate_patterns(exclude, "exclude")
+    validate_patterns(include, "include")
+    validate_symlinks(symlinks)
+    validate_metadata(metadata, mtime_tolerance)
+    if metadata and "xattr" in metadata and not hasattr(os, "listxattr"):
+        raise NotImplementedError("compare_xattrs is not supported on this platform")
+    validate_progress_interval(progress_interval)
+    if symlinks is not None:
+        follow_symlinks = symlinks == "follow"
+    links = symlinks == "compare-link"
+
+    raw = _run_polled(
+        _compare_dir_c, (dir_a, dir_b), on_progress, progress_interval,
+        chunk_size=chunk_size, size_precheck=size_precheck, quick_check=quick_check,
+        follow_symlinks=follow_symlinks, max_workers=max_workers,
+        max_depth=-1 if max_depth is None else max_depth,
+        stop_on_error=stop_on_error, exclude=exclude, include=include,
+        symlinks=symlinks, cancel=cancel_handle(cancel), list_equal=True,
+    )
+    result = build_dir_result(raw)
+    same = {to_slash(p) for p in raw["same"]}
+    if ignore:
+        result = filter_dir_result(result, ignore)
+        probe = DirResult(equal=False, diff={}, only_left=same, only_right=set())
+        same = filter_dir_result(probe, ignore).only_left
+
+    def size(root: str, path: str) -> int | None:
+        try:
+            st = os.stat(os.path.join(root, path), follow_symlinks=follow_symlinks)
+        except OSError:
+            return None
+        if stat.S_ISREG(st.st_mode) or links and stat.S_ISLNK(st.st_mode):
+            return st.st_size
+        return None
+
+    def first_offset(path: str) -> int | None:
+        out = FileDiff()
+        compare_into(os.path.join(dir_a, path), os.path.join(dir_b, path), out,
+                     chunk_size=chunk_size, size_precheck=False, cancel=cancel)
+        return out.first_diff_offset
+
+    entries = []
+    equal = result.equal
+    for path in same:
+        sa, sb = size(dir_a, path), size(dir_b, path)
+        failed: tuple[str, ...] = ()
+        if metadata:
+            try:
+                failed = tuple(metadata_diffs(
+                    os.path.join(dir_a, path), os.path.join(dir_b, path),
+                    metadata, mtime_tolerance, follow_symlinks,
+                ))
+            except PermissionError:
+                entries.append(ReportEntry(path, EntryStatus.ERROR, size_a=sa, size_b=sb))
+                continue
+        if failed:
+            equal = False
+            entries.append(ReportEntry(path, EntryStatus.DIFFERENT, metadata_reason(failed[0]),
+                                       sa, sb, metadata=failed))
+        else:
+            entries.append(ReportEntry(path, EntryStatus.EQUAL, size_a=sa, size_b=sb))
+    for path, reason in result.diff.items():
+        sa, sb = size(dir_a, path), size(dir_b, path)
+        offset = None
+        if (offsets and sa is not None and sb is not None
+                and reason in (DiffReason.CONTENT_MISMATCH, DiffReason.SIZE_MISMATCH)):
+            offset = first_offset(path)
+        status = EntryStatus.ERROR if reason is DiffReason.READ_ERROR else EntryStatus.DIFFERENT
+        entries.append(ReportEntry(path, status, reason, sa, sb, offset))
+    entries += [ReportEntry(p, EntryStatus.ONLY_LEFT, size_a=size(dir_a, p))
+                for p in result.only_left]
+    entries += [ReportEntry(p, EntryStatus.ONLY_RIGHT, size_b=size(dir_b, p))
+                for p in result.only_right]
+    entries += [ReportEntry(p, EntryStatus.ERROR) for p in result.errors]
+    entries.sort(key=lambda e: e.path)
+    return DirReport(dir_a=dir_a, dir_b=dir_b, equal=equal, entries=entries)
+
+
+def identical(
+    dir_a: str,
+    dir_b: str,
+    *,
+    chunk_size: int = 65536,
+    quick_check: bool = True,
+    follow_symlinks: bool = True,
+    max_workers: int = 0,
+) -> bool:
+    """Check whether two directory trees are identical.
+
+    Fail-fast counterpart of :func:`compare_dir`: returns ``False`` at the
+    first missing file, size mismatch or content difference, without
+    building a report.  Unreadable entries count as a difference.
+
+    :param dir_a: Path to first directory.
+    :param dir_b: Path to second directory.
+    :param chunk_size: Chunk size for file comparison.
+    :param quick_check: Sample key offsets before full scan.
+    :param follow_symlinks: Follow symbolic links during traversal.
+    :param max_workers: Thread pool size (0=auto, 1=sequential).
+    :returns: True if both trees hold the same files with the same content.
     """
     validate_path(dir_a, "dir_a")
     validate_path(dir_b, "dir_b")
     validate_chunk_size(chunk_size)
     validate_max_workers(max_workers)
 
-    raw = _compare_dir_c(
+    return _dirs_identical_c(
         dir_a, dir_b,
         chunk_size=chunk_size,
-        size_precheck=size_precheck,
         quick_check=quick_check,
         follow_symlinks=follow_symlinks,
         max_workers=max_workers,
     )
-    result = build_dir_result(raw)
-    if ignore:
-        result = filter_dir_result(result, ignore)
-    return result
+
+
+def is_subset(
+    subset: str,
+    superset: str,
+    *,
+    chunk_size: int = 65536,
+    quick_check: bool = True,
+    follow_symlinks: bool = True,
+    max_workers: int = 0,
+    ignore: list[str] | None = None,
+) -> tuple[bool, list[str]]:
+    """Check that every file of *subset* is in *superset* with equal content.
+
+    Files present only in *superset* are ignored, so a minimal image can
+    be checked against a full reference tree. Unreadable files of
+    *subset* count as failures; unreadable extras of *superset* do not.
+
+    :param subset: Directory whose files must all be present.
+    :param superset: Directory expected to contain them.
+    :param chunk_size: Chunk size for file comparison.
+    :param quick_check: Sample key offsets before full scan.
+    :param follow_symlinks: Follow symbolic links during traversal.
+    :param max_workers: Thread pool size (0=auto, 1=sequential).
+    :param ignore: Glob patterns to exclude, as in :func:`compare_dir`.
+    :returns: ``(ok, failing)`` where ``failing`` is the sorted list of
+        paths missing from *superset* or differing there.
+    """
+    result = compare_dir(
+        subset, superset,
+        chunk_size=chunk_size,
+        quick_check=quick_check,
+        follow_symlinks=follow_symlinks,
+        max_workers=max_workers,
+        ignore=ignore,
+    )
+    failing = set(result.diff) | result.only_left
+    failing |= {
+        p for p in result.errors if os.path.lexists(os.path.join(subset, p))
+    }
+    return not failing, sorted(failing)
 
 
 def compare_archive(
@@ -312,6 +1947,69 @@ def compare_many(
     )
 
 
+def compare_batch(
+    pairs: list[tuple[str, str]],
+    *,
+    max_workers: int = 0,
+    chunk_size: int = 65536,
+    size_precheck: bool = True,
+    opener: Opener | None = None,
+) -> list[BatchResult]:
+    """Compare an explicit list of local file pairs in parallel.
+
+    Each pair is compared as by :func:`compare_into`, so
+    ``first_diff_offset`` is exact for pairs read byte by byte. A size
+    mismatch caught by the precheck is not read and leaves it None;
+    pass ``size_precheck=False`` for the offset of every differing pair. An error
+    on one pair (missing file, directory, permission denied, ...) is
+    recorded in that pair's ``error`` and does not stop the others.
+
+    :param pairs: ``(path_a, path_b)`` tuples.
+    :param max_workers: Thread pool size (0=auto, 1=sequential).
+    :param chunk_size: Chunk size for file comparison.
+    :param size_precheck: Report a size mismatch without reading content.
+    :param opener: Read both files of each pair through ``opener(path)``,
+        as in :func:`compare`. An opener error is recorded in that pair's
+        ``error``.
+    :returns: One BatchResult per pair, in input order.
+    """
+    validate_chunk_size(chunk_size)
+    validate_max_workers(max_workers)
+    for path_a, path_b in pairs:
+        validate_path(path_a, "path_a")
+        validate_path(path_b, "path_b")
+
+    def _cmp_pair(pair: tuple[str, str]) -> BatchResult:
+        path_a, path_b = pair
+        if opener is not None:
+            try:
+                equal, offset = first_diff_opened(
+                    opener, path_a, path_b,
+                    size_precheck=size_precheck, chunk_size=chunk_size,
+                )
+            except Exception as e:
+                get_logger().info("compare_batch %s %s: %s", path_a, path_b, e)
+                return BatchResult(path_a, path_b, False, error=e)
+            return BatchResult(path_a, path_b, equal, offset)
+        out = FileDiff()
+        try:
+            compare_into(path_a, path_b, out,
+                         chunk_size=chunk_size, size_precheck=size_precheck)
+        except (KomparuError, OSError) as e:
+            get_logger().info("compare_batch %s %s: %s", path_a, path_b, e)
+            return BatchResult(path_a, path_b, False, error=e)
+        return BatchResult(path_a, path_b, out.equal, out.first_diff_offset)
+
+    if max_workers == 1 or len(pairs) <= 1:
+        return [_cmp_pair(p) for p in pairs]
+
+    from concurrent.futures import ThreadPoolExecutor
+
+    pool_size = max_workers if max_workers > 0 else min(len(pairs), 8)
+    with ThreadPoolExecutor(max_workers=pool_size) as pool:
+        return list(pool.map(_cmp_pair, pairs))
+
+
 def compare_dir_urls(
     dir_path: str,
     url_map: dict[str, str],
@@ -332,9 +2030,11 @@ def compare_dir_urls(
     file comparison via mmap. GIL is released for the entire operation.
 
     :param dir_path: Path to local directory.
-    :param url_map: Mapping of relative_path -> URL.
+    :param url_map: Mapping of relative_path -> URL. ``\\`` in a path is
+        read as ``/``.
     :param proxy: Proxy URL (e.g. http://host:port, socks5://host:port).
     :returns: DirResult with equal, diff, only_left, only_right.
+    :raises ValueError: If two ``url_map`` paths differ only in separators.
     """
     validate_path(dir_path, "dir_path")
     validate_chunk_size(chunk_size)
@@ -346,7 +2046,7 @@ def compare_dir_urls(
     p = proxy if proxy is not None else cfg.proxy
 
     raw = _compare_dir_urls_c(
-        dir_path, url_map,
+        dir_path, slash_keys(url_map, "url_map"),
         chunk_size=chunk_size,
         size_precheck=size_precheck,
         quick_check=quick_check,
@@ -358,3 +2058,461 @@ def compare_dir_urls(
         proxy=p,
     )
     return build_dir_result(raw)
+
+
+def hash_dir(
+    directory: str,
+    *,
+    chunk_size: int = 65536,
+    follow_symlinks: bool = True,
+    max_workers: int = 0,
+    cache: str | DigestCache | None = None,
+) -> dict[str, str]:
+    """Compute the SHA-256 of every regular file in a directory tree.
+
+    Files are hashed concurrently on a bounded C thread pool with the
+    GIL released. Digests do not depend on ``max_workers``.
+
+    :param directory: Path to directory.
+    :param chunk_size: Read chunk size in bytes.
+    :param follow_symlinks: Follow symbolic links during traversal.
+    :param max_workers: Thread pool size (0=auto, 1=sequential).
+    :param cache: A DigestCache, or the directory of one; files whose
+        stat signature is unchanged since they were cached are not read.
+    :returns: Mapping of relative path -> lowercase hex digest.
+    :raises OSError: If any file cannot be read (reported after
+        in-flight workers finish).
+    """
+    validate_path(directory, "directory")
+    validate_chunk_size(chunk_size)
+    validate_max_workers(max_workers)
+
+    if cache is not None:
+        digest_cache, owned = open_cache(cache)
+        try:
+            files, errors = _scan(directory, follow_symlinks)
+            if errors:
+                raise PermissionError(f"cannot read {min(errors)!r} in {directory!r}")
+            return digest_cache.digests(directory, sorted(files), chunk_size=chunk_size,
+                                        follow_symlinks=follow_symlinks,
+                                        max_workers=max_workers)
+        finally:
+            if owned:
+                digest_cache.close()
+
+    return _hash_dir_c(
+        directory,
+        chunk_size=chunk_size,
+        follow_symlinks=follow_symlinks,
+        max_workers=max_workers,
+    )
+
+
+def _digest_key(value: str | bytes, side: str, path: str) -> str:
+    if isinstance(value, str):
+        return value.lower()
+    if isinstance(value, (bytes, bytearray)):
+        return bytes(value).hex()
+    raise TypeError(
+        f"{side}[{path!r}] must be a hex str or bytes digest, "
+        f"got {type(value).__name__}"
+    )
+
+
+def compare_dir_hashes(
+    hashes_a: Mapping[str, str | bytes],
+    hashes_b: Mapping[str, str | bytes],
+) -> DirResult:
+    """Compare two manifests (relative path -> digest) without file access.
+
+    Manifests are typically produced by :func:`hash_dir` and stored for
+    later; one written on Windows with ``\\`` separators matches one
+    written on POSIX. Hex digests compare case-insensitively; raw ``bytes`` digests
+    are accepted and compared by value.
+
+    :param hashes_a: Manifest of the first tree.
+    :param hashes_b: Manifest of the second tree.
+    :returns: DirResult with ``diff`` (CONTENT_MISMATCH) for paths whose
+        digests differ, and ``only_left``/``only_right`` for paths present
+        in one manifest only.
+    :raises TypeError: If a digest is neither str nor bytes.
+    :raises ValueError: If two paths of one manifest differ only in
+        separators (``\\`` is read as ``/``).
+    """
+    hashes_a = slash_keys(hashes_a, "hashes_a")
+    hashes_b = slash_keys(hashes_b, "hashes_b")
+    diff: dict[str, DiffReason] = {}
+    only_left: set[str] = set()
+    for path, value in hashes_a.items():
+        if path not in hashes_b:
+            only_left.add(path)
+        elif (_digest_key(value, "hashes_a", path)
+              != _digest_key(hashes_b[path], "hashes_b", path)):
+            diff[path] = DiffReason.CONTENT_MISMATCH
+    only_right = {path for path in hashes_b if path not in hashes_a}
+
+    return DirResult(
+        equal=not (diff or only_left or only_right),
+        diff=diff,
+        only_left=only_left,
+        only_right=only_right,
+    )
+
+
+_HASH_BATCH = 256  # files of a three-way side hashed between cancel checks
+
+
+def _merge_status(was: object, left: object, right: object) -> MergeStatus:
+    """Status of one path from its content (None if absent) on each side."""
+    if left == was and right == was:
+        return MergeStatus.UNCHANGED
+    if right == was:
+        return MergeStatus.CHANGED_LEFT
+    if left == was:
+        return MergeStatus.CHANGED_RIGHT
+    if left == right:
+        return MergeStatus.CHANGED_BOTH_SAME
+    return MergeStatus.CONFLICT
+
+
+def _three_way_files(
+    base: str, left: str, right: str, chunk_size: int, cancel: CancelToken | None,
+) -> ThreeWayResult:
+    """compare_three_way of three files, by up to three comparisons."""
+    left_same = compare(base, left, chunk_size=chunk_size, cancel=cancel)
+    right_same = compare(base, right, chunk_size=chunk_size, cancel=cancel)
+    # Stand-ins for the contents: 0 = the base's, 1 = left's, 2 = a third one
+    ours = 0 if left_same else 1
+    if right_same:
+        theirs = 0
+    elif not left_same and compare(left, right, chunk_size=chunk_size, cancel=cancel):
+        theirs = 1
+    else:
+        theirs = 2
+    return ThreeWayResult(files={os.path.basename(base): _merge_status(0, ours, theirs)})
+
+
+def compare_three_way(
+    base: str | Mapping[str, str | bytes],
+    left: str | Mapping[str, str | bytes],
+    right: str | Mapping[str, str | bytes],
+    *,
+    chunk_size: int = 65536,
+    follow_symlinks: bool = True,
+    max_workers: int = 0,
+    exclude: list[str] | None = None,
+    include: list[str] | None = None,
+    cache: str | DigestCache | None = None,
+    cancel: CancelToken | None = None,
+) -> ThreeWayResult:
+    """Classify every file of a base/left/right triple for a merge.
+
+    Each side is a directory, hashed with :func:`hash_dir`, or a stored
+    manifest (relative path -> digest), so a base manifest can be reused
+    across merges. A file absent from a side counts as deleted there.
+    Three regular files are compared pairwise instead, without hashing,
+    and give a single entry named after ``base``.
+
+    :param base: Common ancestor tree, manifest or file.
+    :param left: First descendant tree, manifest or file.
+    :param right: Second descendant tree, manifest or file.
+    :param chunk_size: Read chunk size for hashing directories.
+    :param follow_symlinks: Follow symbolic links while hashing.
+    :param max_workers: Hashing thread pool size (0=auto, 1=sequential).
+    :param exclude: Gitignore-style patterns of paths to leave out, as in
+        :func:`compare_dir`; excluded files are not read.
+    :param include: Gitignore-style patterns of the only files to classify.
+    :param cache: A DigestCache, or the directory of one, for hashing
+        directory sides, as in :func:`hash_dir`.
+    :param cancel: Token checked between batches of hashed files (and
+        passed to :func:`compare` for three files).
+    :returns: ThreeWayResult mapping each path to its MergeStatus.
+    :raises CancelledError: If cancel fired.
+    :raises OSError: If a file of a directory side cannot be read.
+    :raises TypeError: If a manifest digest is neither str nor bytes.
+    :raises ValueError: If files are mixed with directories or manifests.
+    """
+    validate_patterns(exclude, "exclude")
+    validate_patterns(include, "include")
+    sides = (base, left, right)
+    if any(isinstance(s, str) and os.path.isfile(s) for s in sides):
+        if not all(isinstance(s, str) and os.path.isfile(s) for s in sides):
+            raise ValueError("base, left and right must all be files, or none of them")
+        return _three_way_files(base, left, right, chunk_size, cancel)
+
+    keep = walk_filter(exclude, include)
+    digest_cache, owned = open_cache(cache) if cache is not None else (None, False)
+
+    def digests(side: str | Mapping[str, str | bytes], name: str) -> dict[str, str]:
+        if isinstance(side, str) and keep is None and cancel is None:
+            side = hash_dir(side, chunk_size=chunk_size, follow_symlinks=follow_symlinks,
+                            max_workers=max_workers, cache=digest_cache)
+        elif isinstance(side, str):
+            found, errors = _scan(side, follow_symlinks)
+            if any(keep is None or keep(p + "/") for p in errors):
+                raise PermissionError(f"cannot read {min(errors)!r} in {side!r}")
+            paths = sorted(p for p in found if keep is None or keep(p))
+            directory, side = side, {}
+            for i in range(0, len(paths), _HASH_BATCH):
+                if cancel is not None:
+                    cancel.raise_if_cancelled()
+                batch = paths[i:i + _HASH_BATCH]
+                if digest_cache is not None:
+                    side.update(digest_cache.digests(directory, batch, chunk_size=chunk_size,
+                                                     follow_symlinks=follow_symlinks,
+                                                     max_workers=max_workers))
+                else:
+                    side.update(_hash(directory, batch, chunk_size, max_workers))
+        elif keep is not None:
+            side = {p: v for p, v in slash_keys(side, name).items() if keep(p)}
+        return {p: _digest_key(v, name, p) for p, v in slash_keys(side, name).items()}
+
+    try:
+        in_base = digests(base, "base")
+        in_left = digests(left, "left")
+        in_right = digests(right, "right")
+    finally:
+        if owned:
+            digest_cache.close()
+    if cancel is not None:
+        cancel.raise_if_cancelled()
+    files = {
+        path: _merge_status(in_base.get(path), in_left.get(path), in_right.get(path))
+        for path in sorted(in_base.keys() | in_left.keys() | in_right.keys())
+    }
+    get_logger().debug(
+        "compare_three_way: %d files, %d conflicts",
+        len(files), sum(s is MergeStatus.CONFLICT for s in files.values()),
+    )
+    return ThreeWayResult(files=files)
+
+
+def compare_trees(
+    dirs: Sequence[str],
+    *,
+    chunk_size: int = 65536,
+    follow_symlinks: bool = True,
+    max_workers: int = 0,
+) -> MultiTreeReport:
+    """Check that N replicas of a directory tree are identical.
+
+    Each replica is hashed once with :func:`hash_dir` and paths are
+    compared by digest, so every file is read once per replica instead
+    of once per pair. Replicas are hashed one after another, so at most
+    *max_workers* files are being read at any time.
+
+    :param dirs: Two or more replica directories.
+    :param chunk_size: Read chunk size in bytes.
+    :param follow_symlinks: Follow symbolic links while hashing.
+    :param max_workers: Hashing thread pool size (0=auto, 1=sequential).
+    :returns: MultiTreeReport grouping, for each path, the replicas that
+        hold it by content.
+    :raises ValueError: If fewer than two directories are given, or one
+        is given twice.
+    :raises OSError: If a file cannot be read.
+    """
+    dirs = tuple(dirs)
+    if len(dirs) < 2:
+        raise ValueError("compare_trees needs at least two directories")
+    if len(set(dirs)) != len(dirs):
+        raise ValueError("compare_trees: each directory may be given only once")
+    for i, d in enumerate(dirs):
+        validate_path(d, f"dirs[{i}]")
+
+    digests = [
+        hash_dir(d, chunk_size=chunk_size, follow_symlinks=follow_symlinks,
+                 max_workers=max_workers)
+        for d in dirs
+    ]
+    files: dict[str, list[set[str]]] = {}
+    for path in sorted(set().union(*digests)):
+        by_digest: dict[str, set[str]] = {}
+        for d, tree in zip(dirs, digests):
+            if path in tree:
+                by_digest.setdefault(tree[path], set()).add(d)
+        files[path] = list(by_digest.values())
+    report = MultiTreeReport(dirs=dirs, files=files)
+    get_logger().debug(
+        "compare_trees: %d replicas, %d files, %d diverged",
+        len(dirs), len(files), len(report.diverged),
+    )
+    return report
+
+
+def group_by_top_dir(
+    result: DirResult,
+    include: Iterable[str] = (),
+) -> dict[str, DirResult]:
+    """Split a DirResult by the first component of each path.
+
+    Every set and mapping of *result* is bucketed; files in the root go
+    under ``""``, renames under the top directory of their source path.
+    Each group's ``equal`` is recomputed from its own entries.
+
+    :param result: Result of :func:`compare_dir` or a sibling.
+    :param include: Group names to report even when they hold no entries
+        (e.g. every service directory), as equal, empty results.
+    :returns: Group name -> DirResult, sorted by name.
+    """
+    def top(path: str) -> str:
+        head, sep, _ = path.partition("/")
+        return head if sep else ""
+
+    parts: dict[str, dict] = {}
+
+    def bucket(path: str) -> dict:
+        name = top(path)
+        if name not in parts:
+            parts[name] = {
+                "diff": {}, "only_left": set(), "only_right": set(),
+                "errors": set(), "renamed": [], "expected_diffs": {},
+                "stale_known_diffs": set(),
+            }
+        return parts[name]
+
+    for name in include:
+        bucket(name + "/")
+    for path, reason in result.diff.items():
+        bucket(path)["diff"][path] = reason
+    for field in ("only_left", "only_right", "errors", "stale_known_diffs"):
+        for path in getattr(result, field):
+            bucket(path)[field].add(path)
+    for src, dst in result.renamed:
+        bucket(src)["renamed"].append((src, dst))
+    for path, reason in result.expected_diffs.items():
+        bucket(path)["expected_diffs"][path] = reason
+
+    return {
+        name: DirResult(
+            equal=not (p["diff"] or p["only_left"] or p["only_right"]), **p,
+        )
+        for name, p in sorted(parts.items())
+    }
+
+
+_HASH_ALGOS = {"sha256": 32}
+
+
+def verify_hash(
+    path: str,
+    expected: str,
+    *,
+    algo: str = "sha256",
+    chunk_size: int = 65536,
+) -> bool:
+    """Check a file against a known digest.
+
+    The file is hashed in one streaming pass with the GIL released and
+    the result is compared in constant time.
+
+    :param path: Path to file.
+    :param expected: Expected digest as hex (case-insensitive).
+    :param algo: Hash algorithm; only "sha256" is supported.
+    :param chunk_size: Read chunk size in bytes.
+    :returns: True if the digest of ``path`` equals ``expected``.
+    :raises ValueError: If ``algo`` is unknown or ``expected`` is not a
+        hex digest of the right length.
+    """
+    validate_path(path, "path")
+    validate_chunk_size(chunk_size)
+    size = _HASH_ALGOS.get(algo)
+    if size is None:
+        raise ValueError(f"algo must be one of {', '.join(_HASH_ALGOS)}")
+    try:
+        digest = bytes.fromhex(expected)
+    except (TypeError, ValueError):
+        raise ValueError("expected must be a hex string") from None
+    if len(digest) != size:
+        raise ValueError(f"expected must be {size * 2} hex digits for {algo}")
+
+    return _verify_hash_c(path, digest, chunk_size=chunk_size)
+
+
+def compare_and_hash(
+    path_a: str,
+    path_b: str,
+    *,
+    algo: str = "sha256",
+    chunk_size: int = 65536,
+) -> tuple[bool, str, str]:
+    """Compare two files and return both digests from the same read.
+
+    Each file is read exactly once, with the GIL released, and hashed
+    while it is compared. There is no early exit: after a difference both
+    files are still read to the end, so the digests cover all of each.
+    No size pre-check is made for the same reason.
+
+    :param path_a: Path to first file.
+    :param path_b: Path to second file.
+    :param algo: Hash algorithm; only "sha256" is supported.
+    :param chunk_size: Read chunk size in bytes.
+    :returns: ``(equal, digest_a, digest_b)`` with lowercase hex digests.
+    :raises ValueError: If ``algo`` is unknown.
+    """
+    validate_path(path_a, "path_a")
+    validate_path(path_b, "path_b")
+    validate_chunk_size(chunk_size)
+    if algo not in _HASH_ALGOS:
+        raise ValueError(f"algo must be one of {', '.join(_HASH_ALGOS)}")
+
+    return _compare_hash_c(path_a, path_b, chunk_size=chunk_size)
+
+
+def block_checksums(path: str, block_size: int) -> list[BlockSum]:
+    """Compute per-block checksums: the signature half of a delta sync.
+
+    The file is split into ``block_size`` blocks (the last may be shorter)
+    and read in one streaming pass with the GIL released. Each block gets
+    an rsync-style rolling checksum for cheap candidate matching and a
+    SHA-256 digest to confirm it.
+
+    :param path: Path to file.
+    :param block_size: Block size in bytes.
+    :returns: One BlockSum per block, in file order; empty for an empty file.
+    :raises ValueError: If ``block_size`` is not positive or exceeds 1GB.
+    """
+    validate_path(path, "path")
+    if block_size <= 0:
+        raise ValueError("block_size must be positive")
+    if block_size > 1024 * 1024 * 1024:
+        raise ValueError("block_size must be <= 1GB")
+
+    return [BlockSum(*raw) for raw in _block_checksums_c(path, block_size)]
+
+
+def sync_file(src: str, dst: str, *, chunk_size: int = 65536) -> bool:
+    """Copy ``src`` over ``dst`` only if their contents differ.
+
+    When the files are equal, ``dst`` is left untouched (mtime included),
+    so mtime-driven rebuilds downstream are not triggered. Otherwise
+    ``src`` is copied with its metadata to a temporary file next to
+    ``dst`` and renamed over it, so readers never see a partial file.
+
+    :param src: Path to source file.
+    :param dst: Path to destination file; need not exist.
+    :param chunk_size: Chunk size for the comparison.
+    :returns: True if ``dst`` was written, False if it was already equal.
+    """
+    validate_path(src, "src")
+    validate_path(dst, "dst")
+    validate_chunk_size(chunk_size)
+
+    if os.path.isfile(dst) and compare(src, dst, chunk_size=chunk_size):
+        get_logger().debug("sync_file %s %s: unchanged", src, dst)
+        return False
+
+    fd, tmp = tempfile.mkstemp(
+        prefix=".komparu-", dir=os.path.dirname(os.path.abspath(dst)),
+    )
+    os.close(fd)
+    try:
+        shutil.copy2(src, tmp)
+        os.replace(tmp, dst)
+    except BaseException:
+        try:
+            os.unlink(tmp)
+        except OSError:
+            pass
+        raise
+    get_logger().info("sync_file: copied %s to %s", src, dst)
+    return True
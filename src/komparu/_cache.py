@@ -0,0 +1,313 @@
+"""Persistent digest cache: files unchanged since the last run are not read."""
+
+from __future__ import annotations
+
+import os
+import sqlite3
+import threading
+import time
+from collections.abc import Callable
+from types import TracebackType
+
+from komparu._cancel import CancelToken
+from komparu._helpers import walk_filter
+from komparu._snapshot import _RACY_NS, _hash, _scan, _under
+from komparu._types import DiffReason, DirResult
+from komparu._validate import validate_path
+
+_FILE = "komparu-digests.sqlite3"
+_VERSION = 1  # PRAGMA user_version; any other value rebuilds the cache
+_BATCH = 500  # paths per lookup query, below SQLite's variable limit
+
+_SCHEMA = """
+CREATE TABLE IF NOT EXISTS digests (
+    path TEXT PRIMARY KEY,
+    dev INTEGER NOT NULL,
+    ino INTEGER NOT NULL,
+    size INTEGER NOT NULL,
+    mtime_ns INTEGER NOT NULL,
+    ctime_ns INTEGER NOT NULL,
+    digest TEXT NOT NULL
+) WITHOUT ROWID
+"""
+
+_Signature = tuple[int, int, int, int, int]  # dev, ino, size, mtime_ns, ctime_ns
+
+
+class DigestCache:
+    """SHA-256 digests of files, kept on disk across runs.
+
+    A cached digest is used only while the file's device, inode, size,
+    mtime and ctime are all unchanged; anything else re-hashes it and
+    replaces the entry. Files modified less than 2 s before they were
+    hashed, or changed while being hashed, are not stored. Hard links to
+    one inode are read once. Entries are keyed by absolute path, so one
+    cache serves any number of trees.
+    A cache written by another version, or a damaged one, is rebuilt.
+
+    :param cache_dir: Directory holding the cache file; created if needed.
+    :raises OSError: If the directory cannot be created.
+    """
+
+    def __init__(self, cache_dir: str) -> None:
+        validate_path(cache_dir, "cache_dir")
+        os.makedirs(cache_dir, exist_ok=True)
+        self.path = os.path.join(cache_dir, _FILE)
+        # Digests taken from the cache, files hashed, and bytes read for them
+        self.hits = 0
+        self.misses = 0
+        self.bytes_hashed = 0
+        self._lock = threading.Lock()
+        try:
+            self._db = self._open()
+        except sqlite3.DatabaseError:
+            os.remove(self.path)  # not a database, or damaged: start over
+            self._db = self._open()
+
+    def _open(self) -> sqlite3.Connection:
+        db = sqlite3.connect(self.path, timeout=30.0, check_same_thread=False)
+        try:
+            (version,) = db.execute("PRAGMA user_version").fetchone()
+            if version != _VERSION:
+                db.execute("DROP TABLE IF EXISTS digests")
+                db.execute(f"PRAGMA user_version = {_VERSION}")
+            db.execute(_SCHEMA)
+            db.commit()
+        except BaseException:
+            db.close()
+            raise
+        return db
+
+    def _signature(self, path: str, follow_symlinks: bool) -> _Signature | None:
+        try:
+            st = os.stat(path) if follow_symlinks else os.lstat(path)
+        except OSError:
+            return None
+        return st.st_dev, st.st_ino, st.st_size, st.st_mtime_ns, st.st_ctime_ns
+
+    def _lookup(self, keys: list[str]) -> dict[str, tuple]:
+        rows: dict[str, tuple] = {}
+        for i in range(0, len(keys), _BATCH):
+            batch = keys[i:i + _BATCH]
+            marks = ",".join("?" * len(batch))
+            for row in self._db.execute(
+                f"SELECT path, dev, ino, size, mtime_ns, ctime_ns, digest"
+                f" FROM digests WHERE path IN ({marks})", batch,
+            ):
+                rows[row[0]] = row[1:]
+        return rows
+
+    def digests(
+        self,
+        directory: str,
+        paths: list[str],
+        *,
+        chunk_size: int = 65536,
+        follow_symlinks: bool = True,
+        max_workers: int = 0,
+        unreadable: set[str] | None = None,
+    ) -> dict[str, str]:
+        """SHA-256 of each of *paths* under *directory*, hashing only
+        files without a valid entry (natively, on a C thread pool).
+
+        :param directory: Root the paths are relative to.
+        :param paths: ``/``-separated relative paths of regular files.
+        :param chunk_size: Read chunk size in bytes.
+        :param follow_symlinks: Stat through symbolic links.
+        :param max_workers: Hashing thread pool size (0=auto, 1=sequential).
+        :param unreadable: If given, paths that cannot be read are added
+            to it and left out instead of raising.
+        :returns: Lowercase hex digests; paths that can no longer be
+            stat'd are left out.
+        :raises OSError: If a file cannot be read and *unreadable* is None.
+        """
+        root = os.path.abspath(directory)
+        sigs = {}
+        for p in paths:
+            sig = self._signature(os.path.join(root, p), follow_symlinks)
+            if sig is not None:
+                sigs[p] = sig
+        with self._lock:
+            rows = self._lookup([os.path.join(root, p) for p in sigs])
+            result: dict[str, str] = {}
+            missing = []
+            for p, sig in sigs.items():
+                row = rows.get(os.path.join(root, p))
+                if row is not None and tuple(row[:5]) == sig:
+                    result[p] = row[5]
+                else:
+                    missing.append(p)
+            self.hits += len(result)
+            if not missing:
+                return result
+            # Hard links share an inode: read each one once
+            first: dict[tuple[int, int], str] = {}
+            for p in missing:
+                first.setdefault(sigs[p][:2], p)
+            try:
+                hashed = _hash(root, list(first.values()), chunk_size, max_workers)
+            except OSError:
+                if unreadable is None:
+                    raise
+                hashed = {}
+                for p in first.values():  # one failure fails the batch: retry singly
+                    try:
+                        hashed.update(_hash(root, [p], chunk_size, 1))
+                    except OSError:
+                        pass
+            fresh = {}
+            for p in missing:
+                digest = hashed.get(first[sigs[p][:2]])
+                if digest is None:
+                    unreadable.add(p)
+                else:
+                    fresh[p] = digest
+            self.misses += len(fresh)
+            self.bytes_hashed += sum(sigs[p][2] for p in first.values() if p in hashed)
+            now = time.time_ns()
+            store = []
+            for p in fresh:
+                sig = sigs[p]
+                # mtime can be as coarse as 2 s: a file this fresh may change
+                # again without its signature changing; and one that changed
+                # while it was hashed has a digest of neither version
+                if now - sig[3] >= _RACY_NS and self._signature(
+                        os.path.join(root, p), follow_symlinks) == sig:
+                    store.append((os.path.join(root, p), *sig, fresh[p]))
+            if store:
+                self._db.executemany(
+                    "INSERT OR REPLACE INTO digests VALUES (?, ?, ?, ?, ?, ?, ?)", store)
+                self._db.commit()
+            result.update(fresh)
+            return result
+
+    def clear(self) -> None:
+        """Drop every entry."""
+        with self._lock:
+            self._db.execute("DELETE FROM digests")
+            self._db.commit()
+
+    def __len__(self) -> int:
+        with self._lock:
+            return self._db.execute("SELECT COUNT(*) FROM digests").fetchone()[0]
+
+    def close(self) -> None:
+        """Close the cache file."""
+        self._db.close()
+
+    def __enter__(self) -> DigestCache:
+        return self
+
+    def __exit__(
+        self,
+        exc_type: type[BaseException] | None,
+        exc: BaseException | None,
+        tb: TracebackType | None,
+    ) -> None:
+        self.close()
+
+
+def open_cache(cache: str | DigestCache) -> tuple[DigestCache, bool]:
+    """The DigestCache for a ``cache=`` argument, and whether the caller
+    opened it (and so must close it)."""
+    if isinstance(cache, DigestCache):
+        return cache, False
+    if isinstance(cache, str):
+        return DigestCache(cache), True
+    raise TypeError(f"cache must be a directory path or a DigestCache, got {type(cache).__name__}")
+
+
+def scan_filtered(
+    directory: str,
+    follow_symlinks: bool,
+    max_depth: int | None,
+    keep: Callable[[str], bool] | None,
+    stop_on_error: bool,
+    broken: set[str] | None = None,
+) -> tuple[dict[str, tuple[int, int]], set[str]]:
+    """:func:`_scan` limited by compare_dir's ``max_depth`` and walk filter."""
+    files, errors = _scan(directory, follow_symlinks, broken=broken)
+    if max_depth is not None:
+        files = {p: s for p, s in files.items() if p.count("/") <= max_depth}
+    if keep is not None:
+        files = {p: s for p, s in files.items() if keep(p)}
+        errors = {p for p in errors if keep(p + "/")}
+    if errors and stop_on_error:
+        raise PermissionError(f"cannot read {min(errors)!r} in {directory!r}")
+    if broken is not None:
+        broken.intersection_update(files)
+    return files, errors
+
+
+def _same_target(dir_a: str, dir_b: str, path: str) -> bool:
+    try:
+        return os.readlink(os.path.join(dir_a, path)) == os.readlink(os.path.join(dir_b, path))
+    except OSError:
+        return False
+
+
+def compare_dir_cached(
+    dir_a: str,
+    dir_b: str,
+    cache: DigestCache,
+    *,
+    chunk_size: int,
+    follow_symlinks: bool,
+    max_workers: int,
+    max_depth: int | None,
+    exclude: list[str] | None,
+    include: list[str] | None,
+    stop_on_error: bool,
+    cancel: CancelToken | None,
+    skip_links: bool = False,
+) -> DirResult:
+    """compare_dir's walk and content comparison, by cached digests.
+
+    Files of different size differ without being read; the rest are
+    compared by SHA-256, so only files changed since the last run are
+    read at all. As in the C walker, dangling symlinks are listed
+    (unless *skip_links*) and compared by target, and a file that cannot
+    be read is a READ_ERROR.
+    """
+    keep = walk_filter(exclude, include)
+    broken_a: set[str] = set()
+    broken_b: set[str] = set()
+    files_a, errors_a = scan_filtered(dir_a, follow_symlinks, max_depth, keep, stop_on_error,
+                                      None if skip_links else broken_a)
+    files_b, errors_b = scan_filtered(dir_b, follow_symlinks, max_depth, keep, stop_on_error,
+                                      None if skip_links else broken_b)
+    if cancel is not None:
+        cancel.raise_if_cancelled()
+    common = files_a.keys() & files_b.keys()
+    links = (broken_a | broken_b) & common
+    diff = {p: DiffReason.BROKEN_SYMLINK for p in links
+            if not (p in broken_a and p in broken_b and _same_target(dir_a, dir_b, p))}
+    common -= links
+    diff.update({p: DiffReason.SIZE_MISMATCH for p in common if files_a[p][0] != files_b[p][0]})
+    same_size = sorted(common - diff.keys())
+    unreadable: set[str] = set()
+    digests_a = cache.digests(dir_a, same_size, chunk_size=chunk_size,
+                              follow_symlinks=follow_symlinks, max_workers=max_workers,
+                              unreadable=unreadable)
+    if cancel is not None:
+        cancel.raise_if_cancelled()
+    digests_b = cache.digests(dir_b, same_size, chunk_size=chunk_size,
+                              follow_symlinks=follow_symlinks, max_workers=max_workers,
+                              unreadable=unreadable)
+    for p in same_size:
+        a, b = digests_a.get(p), digests_b.get(p)
+        if a is None or b is None:
+            diff[p] = DiffReason.READ_ERROR  # unreadable, or removed since the walk
+        elif a != b:
+            diff[p] = DiffReason.CONTENT_MISMATCH
+
+    errors = errors_a | errors_b
+    only_left = {p for p in files_a.keys() - files_b.keys() if not _under(p, errors_b)}
+    only_right = {p for p in files_b.keys() - files_a.keys() if not _under(p, errors_a)}
+    return DirResult(
+        equal=not (diff or only_left or only_right or errors),
+        diff={p: diff[p] for p in sorted(diff)},
+        only_left=only_left,
+        only_right=only_right,
+        errors=errors,
+    )
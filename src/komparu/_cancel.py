@@ -0,0 +1,55 @@
+"""Cancellation tokens and deadlines for long comparisons."""
+
+from __future__ import annotations
+
+from komparu._core import cancel_new as _cancel_new
+from komparu._core import cancel_set as _cancel_set
+from komparu._core import cancel_state as _cancel_state
+from komparu._types import CancelledError, ComparisonTimeoutError
+
+_REQUESTED = 1
+_DEADLINE = 2
+
+
+class CancelToken:
+    """Stops the comparisons it is passed to, from any thread.
+
+    Pass it as ``cancel=`` and call :meth:`cancel` from another thread;
+    the native read loops check it once per chunk, and directory walks
+    once per directory, so even a multi-GB file stops within a chunk.
+    A comparison that sees the token raises :class:`CancelledError`, or
+    :class:`ComparisonTimeoutError` once the deadline has passed. One
+    token can serve many comparisons; it cannot be reset.
+
+    :param timeout: Seconds from now until the deadline; None for none.
+    """
+
+    __slots__ = ("_handle",)
+
+    def __init__(self, timeout: float | None = None) -> None:
+        self._handle = _cancel_new(timeout)
+
+    def cancel(self) -> None:
+        """Stop every comparison using this token at its next check."""
+        _cancel_set(self._handle)
+
+    @property
+    def cancelled(self) -> bool:
+        """True once :meth:`cancel` was called or the deadline passed."""
+        return _cancel_state(self._handle) != 0
+
+    def raise_if_cancelled(self) -> None:
+        """Raise the error a comparison would raise now, if any."""
+        state = _cancel_state(self._handle)
+        if state == _REQUESTED:
+            raise CancelledError("comparison cancelled")
+        if state == _DEADLINE:
+            raise ComparisonTimeoutError("comparison deadline exceeded")
+
+
+def cancel_handle(token: CancelToken | None) -> object | None:
+    """The native token to pass to the C core, checking it first."""
+    if token is None:
+        return None
+    token.raise_if_cancelled()
+    return token._handle
@@ -0,0 +1,923 @@
+"""Command-line interface: ``komparu A B``.
+
+Exit status follows cmp(1)/diff(1): 0 if equal, 1 if different, 2 on error.
+Ctrl+C (SIGINT) cancels the comparison and exits with 130, as shells do.
+
+``komparu manifest DIR`` writes the sizes and digests of a tree, and
+``komparu verify DIR MANIFEST`` checks a tree against one, so two trees
+on different machines can be compared by exchanging only the manifest.
+``komparu watch A B`` keeps comparing two trees as they change.
+``komparu remote DIR HOST:PATH`` compares against a tree on another host
+through ``komparu serve`` at the far end of an ssh connection.
+``komparu tune FILE`` times read strategies and chunk sizes on a sample
+file and prints the fastest as ``--chunk-size``/``--strategy`` options.
+``komparu three-way BASE A B`` tells, per path, whether A, B or both
+changed it since a common base, and exits with 1 on conflicts.
+"""
+
+from __future__ import annotations
+
+import argparse
+import os
+import shutil
+import sys
+import threading
+from collections.abc import Callable, Sequence
+from typing import Any, TextIO
+
+from komparu._api import (
+    compare, compare_dir, compare_dir_report, compare_dir_summary, compare_range,
+    compare_three_way, diff_stats, first_difference,
+)
+from komparu._cache import DigestCache
+from komparu._cancel import CancelToken
+from komparu._fs import compare_fs
+from komparu._manifest import manifest_dir, verify_manifest, write_manifest
+from komparu._remote import RemoteTree, serve_tree
+from komparu._report import report_formats, write_report, write_three_way_report
+from komparu._tune import TUNE_CHUNK_SIZES, TUNE_STRATEGIES, tune_read
+from komparu._types import (
+    CancelledError, DiffReason, DiffStats, DirResult, DirSummary, KomparuError, MergeStatus,
+    Mismatch, ProgressEvent,
+)
+from komparu._validate import METADATA_CHECKS
+from komparu._watch import BACKENDS, Watcher
+
+EXIT_EQUAL = 0
+EXIT_DIFFERENT = 1
+EXIT_ERROR = 2
+EXIT_INTERRUPTED = 130  # 128 + SIGINT
+
+_CONTEXT = 8  # bytes shown on each side of the first difference
+
+
+def _check_list(value: str) -> list[str]:
+    checks = [c.strip() for c in value.split(",") if c.strip()]
+    for check in checks:
+        if check not in METADATA_CHECKS:
+            raise argparse.ArgumentTypeError(
+                f"unknown check {check!r} (choose from {', '.join(METADATA_CHECKS)})"
+            )
+    return checks
+
+
+def _build_parser() -> argparse.ArgumentParser:
+    parser = argparse.ArgumentParser(
+        prog="komparu",
+        description="Compare two files or directory trees byte-by-byte.",
+        epilog="'komparu manifest DIR' and 'komparu verify DIR MANIFEST' hash a "
+               "tree and check another against the result.",
+    )
+    parser.add_argument("a", help="first file or directory")
+    parser.add_argument("b", help="second file or directory")
+    parser.add_argument(
+        "-s", "--summary-only", action="store_true",
+        help="print aggregate counts instead of per-file lines (directories)",
+    )
+    parser.add_argument(
+        "-v", "--verbose", action="store_true",
+        help="print a one-line summary when the inputs are equal",
+    )
+    parser.add_argument(
+        "--chunk-size", type=int, default=65536, metavar="BYTES",
+        help="read chunk size (default: 65536)",
+    )
+    parser.add_argument(
+        "--no-quick-check", dest="quick_check", action="store_false",
+        help="skip sampling key offsets before the full scan",
+    )
+    parser.add_argument(
+        "--first-diff", action="store_true",
+        help="print the offset and surrounding bytes of the first difference "
+             "(files; with --format, offsets per file)",
+    )
+    parser.add_argument(
+        # Formats registered before the arguments are parsed are accepted too
+        "--format", choices=("text", *report_formats()), default="text",
+        help="output format for directories: every path with status and sizes, "
+             "or JUnit XML or SARIF for CI (default: text)",
+    )
+    parser.add_argument(
+        "-j", "--jobs", type=int, default=0, metavar="N",
+        help="compare up to N files at once (directories; default: auto, 1: sequential)",
+    )
+    parser.add_argument(
+        "--stop-on-error", action="store_true",
+        help="fail on the first unreadable file instead of listing it (directories)",
+    )
+    parser.add_argument(
+        "--detect-hardlinks", action="store_true",
+        help="read pairs of hard-linked files once (directories)",
+    )
+    parser.add_argument(
+        "--exclude", action="append", metavar="PATTERN",
+        help="skip paths matching a gitignore-style pattern, e.g. '*.log' or "
+             "'.git/'; excluded directories are not walked (repeatable)",
+    )
+    parser.add_argument(
+        "--include", action="append", metavar="PATTERN",
+        help="compare only files matching a gitignore-style pattern (repeatable)",
+    )
+    parser.add_argument(
+        "--symlinks", choices=("follow", "compare-link", "skip"),
+        help="follow links (default), compare their target strings, or skip "
+             "them (skip: directories only)",
+    )
+    parser.add_argument(
+        "--strategy", choices=("auto", "mmap", "buffered", "prefetch"), default="auto",
+        help="map files of 64 KiB or more (default), map every file, never map, "
+             "or read ahead on a helper thread (files; see 'komparu tune')",
+    )
+    parser.add_argument(
+        "--progress", action="store_true",
+        help="show bytes compared, throughput and ETA on stderr",
+    )
+    parser.add_argument(
+        "--check", type=_check_list, default=[], metavar="LIST",
+        help="also compare metadata of files with equal content: a comma-separated "
+             "list of mode, mtime, uid, gid and xattr (directories)",
+    )
+    parser.add_argument(
+        "--mtime-tolerance", type=float, default=0.0, metavar="SECONDS",
+        help="let mtimes differ by up to SECONDS for --check mtime (default: 0)",
+    )
+    parser.add_argument(
+        "--cache-dir", metavar="DIR",
+        help="keep file digests in DIR so files unchanged since the last run are "
+             "not read again (directories; default: $KOMPARU_CACHE_DIR)",
+    )
+    parser.add_argument(
+        "--no-cache", action="store_true",
+        help="do not use a digest cache, even if --cache-dir or "
+             "KOMPARU_CACHE_DIR is set",
+    )
+    parser.add_argument(
+        "--archive", action="store_true",
+        help="compare zip and tar (.tar, .tar.gz, ...) files by their contents, "
+             "against a directory or another archive",
+    )
+    parser.add_argument(
+        "--stats", action="store_true",
+        help="read two files in full and print how many bytes and ranges differ "
+             "and how similar they are",
+    )
+    parser.add_argument(
+        "--offset", type=int, metavar="BYTES",
+        help="compare two files only from byte BYTES on (default: 0)",
+    )
+    parser.add_argument(
+        "--length", type=int, metavar="BYTES",
+        help="compare two files only over BYTES bytes (default: to the end)",
+    )
+    return parser
+
+
+def _build_manifest_parser() -> argparse.ArgumentParser:
+    parser = argparse.ArgumentParser(
+        prog="komparu manifest",
+        description="Write the size and digest of every file of a tree as JSON.",
+    )
+    parser.add_argument("dir", help="directory to hash")
+    parser.add_argument(
+        "-o", "--output", metavar="FILE",
+        help="write the manifest to FILE instead of stdout",
+    )
+    parser.add_argument(
+        "-a", "--algorithm", default="sha256",
+        help="sha256 (default), sha512, blake2b, blake3, xxh64 or xxh3_128; "
+             "blake3 and xxh* need the blake3 or xxhash package",
+    )
+    parser.add_argument(
+        "--chunk-size", type=int, default=65536, metavar="BYTES",
+        help="read chunk size (default: 65536)",
+    )
+    parser.add_argument(
+        "-j", "--jobs", type=int, default=0, metavar="N",
+        help="hash up to N files at once (default: auto, 1: sequential)",
+    )
+    return parser
+
+
+def _build_verify_parser() -> argparse.ArgumentParser:
+    parser = argparse.ArgumentParser(
+        prog="komparu verify",
+        description="Check a tree against a manifest written by 'komparu manifest'.",
+    )
+    parser.add_argument("dir", help="directory to check")
+    parser.add_argument("manifest", help="manifest file")
+    parser.add_argument(
+        "-v", "--verbose", action="store_true",
+        help="print a one-line summary when the tree matches",
+    )
+    parser.add_argument(
+        "--chunk-size", type=int, default=65536, metavar="BYTES",
+        help="read chunk size (default: 65536)",
+    )
+    parser.add_argument(
+        "-j", "--jobs", type=int, default=0, metavar="N",
+        help="hash up to N files at once (default: auto, 1: sequential)",
+    )
+    return parser
+
+
+def _build_watch_parser() -> argparse.ArgumentParser:
+    parser = argparse.ArgumentParser(
+        prog="komparu watch",
+        description="Compare two trees, then keep comparing the paths that change "
+                    "and report when they diverge or converge.",
+    )
+    parser.add_argument("dir_a", help="first directory")
+    parser.add_argument("dir_b", help="second directory")
+    parser.add_argument(
+        "--backend", choices=BACKENDS, default="auto",
+        help="how changes are noticed: inotify (Linux) or a periodic rescan "
+             "(default: auto)",
+    )
+    parser.add_argument(
+        "--interval", type=float, default=1.0, metavar="SECONDS",
+        help="seconds between rescans of the poll backend (default: 1)",
+    )
+    parser.add_argument(
+        "--exclude", action="append", metavar="PATTERN",
+        help="skip paths matching a gitignore-style pattern (repeatable)",
+    )
+    parser.add_argument(
+        "--include", action="append", metavar="PATTERN",
+        help="compare only files matching a gitignore-style pattern (repeatable)",
+    )
+    parser.add_argument(
+        "--until-equal", action="store_true",
+        help="exit with status 0 as soon as the trees are equal",
+    )
+    parser.add_argument(
+        "--chunk-size", type=int, default=65536, metavar="BYTES",
+        help="read chunk size (default: 65536)",
+    )
+    return parser
+
+
+def _build_serve_parser() -> argparse.ArgumentParser:
+    parser = argparse.ArgumentParser(
+        prog="komparu serve",
+        description="Answer 'komparu remote' requests about a tree on stdin and "
+                    "stdout, e.g. as 'ssh host komparu serve DIR'.",
+    )
+    parser.add_argument("dir", help="directory to serve")
+    parser.add_argument(
+        "--cache-dir", metavar="DIR",
+        help="keep file digests in DIR so unchanged files are not read again",
+    )
+    return parser
+
+
+def _build_remote_parser() -> argparse.ArgumentParser:
+    parser = argparse.ArgumentParser(
+        prog="komparu remote",
+        description="Compare a local tree with one on another host by exchanging "
+                    "sizes and digests over ssh; no file content is copied.",
+    )
+    parser.add_argument("dir", help="local directory")
+    parser.add_argument("remote", help="[user@]host:path of the remote directory")
+    parser.add_argument(
+        "--ssh", default="ssh", metavar="COMMAND",
+        help="ssh command, with any options (default: ssh)",
+    )
+    parser.add_argument(
+        "--agent", default="komparu", metavar="COMMAND",
+        help="command that runs komparu on the remote host (default: komparu)",
+    )
+    parser.add_argument(
+        "--ranges", action="store_true",
+        help="for files that differ in content, list the differing byte ranges "
+             "found by exchanging block checksums",
+    )
+    parser.add_argument(
+        "--block-size", type=int, default=65536, metavar="BYTES",
+        help="block size of --ranges (default: 65536)",
+    )
+    parser.add_argument(
+        "--exclude", action="append", metavar="PATTERN",
+        help="skip paths matching a gitignore-style pattern (repeatable)",
+    )
+    parser.add_argument(
+        "--include", action="append", metavar="PATTERN",
+        help="compare only files matching a gitignore-style pattern (repeatable)",
+    )
+    parser.add_argument(
+        "--cache-dir", metavar="DIR",
+        help="keep local file digests in DIR so unchanged files are not read again",
+    )
+    parser.add_argument(
+        "--chunk-size", type=int, default=65536, metavar="BYTES",
+        help="read chunk size (default: 65536)",
+    )
+    parser.add_argument(
+        "-j", "--jobs", type=int, default=0, metavar="N",
+        help="hash up to N local files at once (default: auto, 1: sequential)",
+    )
+    return parser
+
+
+def _build_tune_parser() -> argparse.ArgumentParser:
+    parser = argparse.ArgumentParser(
+        prog="komparu tune",
+        description="Time reading a sample file with each read strategy and chunk "
+                    "size and recommend the fastest.",
+    )
+    parser.add_argument("file", help="sample file on the storage to be compared")
+    parser.add_argument(
+        "--chunk-size", type=int, action="append", metavar="BYTES",
+        help="chunk size to try (repeatable; default: "
+             f"{', '.join(str(n) for n in TUNE_CHUNK_SIZES)})",
+    )
+    parser.add_argument(
+        "--strategy", choices=TUNE_STRATEGIES, action="append",
+        help="strategy to try (repeatable; default: all)",
+    )
+    parser.add_argument(
+        "--rounds", type=int, default=3, metavar="N",
+        help="timed reads per combination; the fastest counts (default: 3)",
+    )
+    return parser
+
+
+def _build_three_way_parser() -> argparse.ArgumentParser:
+    parser = argparse.ArgumentParser(
+        prog="komparu three-way",
+        description="Classify every path of two trees (or files) by how each "
+                    "changed since a common base: unchanged, changed in A, in B, "
+                    "in both the same way, or in conflict.",
+    )
+    parser.add_argument("base", help="common base directory or file")
+    parser.add_argument("a", help="first descendant")
+    parser.add_argument("b", help="second descendant")
+    parser.add_argument(
+        "-v", "--verbose", action="store_true",
+        help="also list unchanged paths",
+    )
+    parser.add_argument(
+        "--format", choices=("text", "json", "ndjson"), default="text",
+        help="output format: one line per changed path, or every path with "
+             "its status as JSON (default: text)",
+    )
+    parser.add_argument(
+        "--exclude", action="append", metavar="PATTERN",
+        help="skip paths matching a gitignore-style pattern (repeatable)",
+    )
+    parser.add_argument(
+        "--include", action="append", metavar="PATTERN",
+        help="compare only files matching a gitignore-style pattern (repeatable)",
+    )
+    parser.add_argument(
+        "-j", "--jobs", type=int, default=0, metavar="N",
+        help="hash up to N files at once (default: auto, 1: sequential)",
+    )
+    parser.add_argument(
+        "--chunk-size", type=int, default=65536, metavar="BYTES",
+        help="read chunk size (default: 65536)",
+    )
+    parser.add_argument(
+        "--cache-dir", metavar="DIR",
+        help="keep file digests in DIR so unchanged files are not read again",
+    )
+    return parser
+
+
+def _cache_dir(args: argparse.Namespace) -> str | None:
+    """Digest cache directory for a directory comparison: ``--cache-dir``,
+    else ``$KOMPARU_CACHE_DIR``; ``--no-cache`` turns both off."""
+    if args.no_cache:
+        return None
+    conflicts = [flag for flag, used in (
+        ("--summary-only", args.summary_only),
+        ("--format", args.format != "text"),
+        ("--progress", args.progress),
+        ("--symlinks compare-link", args.symlinks == "compare-link"),
+        ("--no-quick-check", not args.quick_check),
+        ("--archive", args.archive),
+    ) if used]
+    if args.cache_dir is not None:
+        if conflicts:
+            raise ValueError(f"--cache-dir cannot be combined with {conflicts[0]}")
+        return args.cache_dir
+    if conflicts:
+        return None  # the environment default applies only where it can
+    return os.environ.get("KOMPARU_CACHE_DIR") or None
+
+
+def _run_cached(args: argparse.Namespace, cache_dir: str, out: TextIO,
+                cancel: CancelToken) -> int:
+    with DigestCache(cache_dir) as cache:
+        result = compare_dir(
+            args.a, args.b,
+            chunk_size=args.chunk_size, max_workers=args.jobs,
+            stop_on_error=args.stop_on_error, exclude=args.exclude,
+            include=args.include, symlinks=args.symlinks, cancel=cancel,
+            metadata=args.check, mtime_tolerance=args.mtime_tolerance, cache=cache,
+            detect_hardlinks=args.detect_hardlinks,
+        )
+    if result.equal and args.verbose:
+        # Equal trees share every file, and each was looked up on both sides
+        _print_equal((cache.hits + cache.misses) // 2, cache.bytes_hashed, out)
+        return EXIT_EQUAL
+    _print_result(result, out)
+    return EXIT_EQUAL if result.equal else EXIT_DIFFERENT
+
+
+def _print_result(result: DirResult, out: TextIO,
+                  ranges: dict[str, list[tuple[int, int]]] | None = None) -> None:
+    for path in sorted(result.diff):
+        line = f"differ: {path} ({result.diff[path].value})"
+        if ranges and path in ranges:
+            line += " at " + ", ".join(f"{start}-{end}" for start, end in ranges[path])
+        out.write(line + "\n")
+    for path in sorted(result.only_left):
+        out.write(f"only in A: {path}\n")
+    for path in sorted(result.only_right):
+        out.write(f"only in B: {path}\n")
+    for path in sorted(result.errors):
+        out.write(f"error: {path}\n")
+
+
+def _print_equal(files: int, bytes_read: int, out: TextIO) -> None:
+    noun = "file" if files == 1 else "files"
+    out.write(f"{files} {noun} compared, {bytes_read} bytes read, equal\n")
+
+
+def _file_bytes_read(a: str, b: str) -> int:
+    """Bytes an equal file comparison read: both sides in full, or none
+    for two names of the same file (URLs are not stat'ed)."""
+    if not (os.path.isfile(a) and os.path.isfile(b)) or os.path.samefile(a, b):
+        return 0
+    return 2 * os.path.getsize(a)
+
+
+def _print_stats(a: str, b: str, stats: DiffStats, out: TextIO) -> None:
+    similarity = f"{stats.similarity:.2f}"
+    if similarity == "100.00" and not stats.equal:
+        similarity = "99.99"  # never round a difference away
+    line = f"{a} and {b}: {stats.differing_bytes} of {stats.total} bytes differ"
+    if not stats.equal:
+        noun = "range" if stats.differing_ranges == 1 else "ranges"
+        line += (f" in {stats.differing_ranges} {noun},"
+                 f" first at offset {stats.first_diff_offset}")
+    out.write(f"{line} ({similarity}% similar)\n")
+
+
+def _hex_context(data: bytes, at: int) -> str:
+    """Hex bytes of a context window, the one at *at* in brackets."""
+    cells = [f"{b:02x}" for b in data]
+    if at < len(cells):
+        cells[at] = f"[{cells[at]}]"
+    else:
+        cells.append("[EOF]")
+    return " ".join(cells)
+
+
+def _print_first_diff(a: str, b: str, m: Mismatch, out: TextIO) -> None:
+    at = m.offset - m.context_start
+    out.write(f"{a} and {b} differ at offset {m.offset}\n")
+    for name, data in ((a, m.context_a), (b, m.context_b)):
+        out.write(f"  {name} @ {m.context_start}: {_hex_context(data, at)}\n")
+
+
+def _human(n: float) -> str:
+    for unit in ("B", "KiB", "MiB", "GiB"):
+        if n < 1024:
+            return f"{n:.0f} {unit}" if unit == "B" else f"{n:.1f} {unit}"
+        n /= 1024
+    return f"{n:.1f} TiB"
+
+
+def _clock(seconds: float) -> str:
+    minutes, secs = divmod(int(seconds + 0.5), 60)
+    hours, minutes = divmod(minutes, 60)
+    return f"{hours}:{minutes:02d}:{secs:02d}" if hours else f"{minutes}:{secs:02d}"
+
+
+def _progress_line(event: ProgressEvent) -> str:
+    if event.bytes_total:
+        done = min(event.bytes_done, event.bytes_total)
+        parts = [f"{100 * done / event.bytes_total:5.1f}%",
+                 f"{_human(event.bytes_done)} / {_human(event.bytes_total)}"]
+    else:
+        parts = [_human(event.bytes_done)]
+    eta = event.eta
+    parts += [f"{_human(event.rate)}/s", "ETA " + ("--:--" if eta is None else _clock(eta))]
+    if event.files_total > 1:
+        parts.append(f"{event.files_done}/{event.files_total} files")
+    if event.path:
+        parts.append(event.path)
+    return "  ".join(parts)
+
+
+class _ProgressBar:
+    """``on_progress`` callback drawing on stderr: one line redrawn in
+    place on a terminal, else a line per (less frequent) update."""
+
+    def __init__(self, stream: TextIO) -> None:
+        self._stream = stream
+        self._tty = stream.isatty()
+        self._drawn = False
+        self.interval = 0.2 if self._tty else 2.0
+
+    def __call__(self, event: ProgressEvent) -> None:
+        line = _progress_line(event)
+        if self._tty:
+            width = shutil.get_terminal_size().columns - 1
+            self._stream.write("\r" + line[:width] + "\x1b[K")
+        else:
+            self._stream.write(line + "\n")
+        self._stream.flush()
+        self._drawn = True
+
+    def close(self) -> None:
+        """End the redrawn line, so later output starts on a fresh one."""
+        if self._drawn and self._tty:
+            self._stream.write("\n")
+            self._stream.flush()
+        self._drawn = False
+
+
+def _with_progress(fn: Callable[..., Any], bar: _ProgressBar | None) -> Callable[..., Any]:
+    """*fn* reporting to *bar*, which is closed before the caller prints."""
+    if bar is None:
+        return fn
+
+    def call(*args: Any, **kwargs: Any) -> Any:
+        try:
+            return fn(*args, on_progress=bar, progress_interval=bar.interval, **kwargs)
+        finally:
+            bar.close()
+
+    return call
+
+
+def _print_summary(summary: DirSummary, out: TextIO) -> None:
+    out.write(f"compared:   {summary.compared}\n")
+    out.write(f"differing:  {summary.differing}\n")
+    out.write(f"only in A:  {summary.only_left}\n")
+    out.write(f"only in B:  {summary.only_right}\n")
+    out.write(f"errors:     {summary.errors}\n")
+    out.write(f"bytes read: {summary.bytes_read}\n")
+    out.write(f"duration:   {summary.duration:.3f}s\n")
+
+
+def main(argv: Sequence[str] | None = None) -> int:
+    """Run the CLI and return the exit status.
+
+    The comparison runs on a worker thread so that Ctrl+C reaches this
+    one while the native scan holds no GIL; it then cancels the scan.
+
+    :param argv: Arguments without the program name (default: sys.argv[1:]).
+    :returns: 0 if equal, 1 if different, 2 on error, 130 if interrupted.
+    """
+    argv = sys.argv[1:] if argv is None else list(argv)
+    if argv[:1] == ["--"]:
+        # Only operands follow, so "komparu -- manifest b" compares a file named manifest
+        args, run = _build_parser().parse_args(argv), _run
+    elif argv and argv[0] in _COMMANDS:
+        build, run = _COMMANDS[argv[0]]
+        args = build().parse_args(argv[1:])
+    else:
+        args, run = _build_parser().parse_args(argv), _run
+    out = sys.stdout
+    cancel = CancelToken()
+    outcome: dict = {}
+
+    def work() -> None:
+        try:
+            outcome["status"] = run(args, out, cancel)
+        except BaseException as e:  # re-raised on the calling thread
+            outcome["error"] = e
+
+    worker = threading.Thread(target=work, name="komparu-cli", daemon=True)
+    worker.start()
+    try:
+        while worker.is_alive():
+            worker.join(0.1)
+    except KeyboardInterrupt:
+        cancel.cancel()
+        try:
+            worker.join()
+        except KeyboardInterrupt:
+            pass  # a second Ctrl+C: stop waiting for a Python-side scan
+        sys.stderr.write("komparu: interrupted\n")
+        return EXIT_INTERRUPTED
+    if "error" in outcome:
+        raise outcome["error"]
+    return outcome["status"]
+
+
+def _run(args: argparse.Namespace, out: TextIO, cancel: CancelToken) -> int:
+    bar = _ProgressBar(sys.stderr) if args.progress else None
+    try:
+        cache_dir = _cache_dir(args)
+        ranged = args.offset is not None or args.length is not None
+        if args.archive:
+            for flag, used in (("--format", args.format != "text"),
+                               ("--summary-only", args.summary_only),
+                               ("--first-diff", args.first_diff),
+                               ("--stats", args.stats),
+                               ("--offset/--length", ranged)):
+                if used:
+                    raise ValueError(f"--archive cannot be combined with {flag}")
+            result = compare_fs(
+                args.a, args.b,
+                chunk_size=args.chunk_size, exclude=args.exclude, include=args.include,
+                metadata=args.check, mtime_tolerance=args.mtime_tolerance, cancel=cancel,
+            )
+            if result.equal and args.verbose:
+                out.write("archive contents are equal\n")
+            _print_result(result, out)
+            return EXIT_EQUAL if result.equal else EXIT_DIFFERENT
+
+        if args.stats:
+            for flag, used in (("--format", args.format != "text"),
+                               ("--first-diff", args.first_diff),
+                               ("--check", bool(args.check)),
+                               ("--offset/--length", ranged)):
+                if used:
+                    raise ValueError(f"--stats cannot be combined with {flag}")
+            if not (os.path.isfile(args.a) and os.path.isfile(args.b)):
+                raise ValueError("--stats needs two files")
+            stats = diff_stats(args.a, args.b, chunk_size=args.chunk_size, cancel=cancel)
+            _print_stats(args.a, args.b, stats, out)
+            return EXIT_EQUAL if stats.equal else EXIT_DIFFERENT
+
+        if ranged:
+            for flag, used in (("--format", args.format != "text"),
+                               ("--first-diff", args.first_diff),
+                               ("--check", bool(args.check))):
+                if used:
+                    raise ValueError(f"--offset/--length cannot be combined with {flag}")
+            if not (os.path.isfile(args.a) and os.path.isfile(args.b)):
+                raise ValueError("--offset/--length needs two files")
+            offset = args.offset or 0
+            equal = compare_range(
+                args.a, args.b, offset, args.length,
+                chunk_size=args.chunk_size, quick_check=args.quick_check,
+                strategy=args.strategy, cancel=cancel,
+            )
+            if not equal:
+                out.write(f"{args.a} and {args.b} differ\n")
+                return EXIT_DIFFERENT
+            if args.verbose:
+                length = args.length
+                if length is None:
+                    length = os.path.getsize(args.a) - offset
+                same = os.path.samefile(args.a, args.b)
+                _print_equal(1, 0 if same else 2 * length, out)
+            return EXIT_EQUAL
+
+        if args.format != "text":
+            if not (os.path.isdir(args.a) and os.path.isdir(args.b)):
+                raise ValueError(f"--format {args.format} needs two directories")
+            if args.summary_only:
+                raise ValueError(f"--format {args.format} cannot be combined with --summary-only")
+            report = _with_progress(compare_dir_report, bar)(
+                args.a, args.b, offsets=args.first_diff,
+                chunk_size=args.chunk_size, quick_check=args.quick_check,
+                max_workers=args.jobs, stop_on_error=args.stop_on_error,
+                exclude=args.exclude, include=args.include, symlinks=args.symlinks,
+                cancel=cancel, metadata=args.check, mtime_tolerance=args.mtime_tolerance,
+            )
+            write_report(report, args.format, out)
+            return EXIT_EQUAL if report.equal else EXIT_DIFFERENT
+
+        if os.path.isdir(args.a) and os.path.isdir(args.b):
+            if args.summary_only and args.check:
+                raise ValueError("--check cannot be combined with --summary-only")
+            if cache_dir is not None:
+                return _run_cached(args, cache_dir, out, cancel)
+            if args.summary_only:
+                summary = _with_progress(compare_dir_summary, bar)(
+                    args.a, args.b,
+                    chunk_size=args.chunk_size, quick_check=args.quick_check,
+                    max_workers=args.jobs, stop_on_error=args.stop_on_error,
+                    exclude=args.exclude, include=args.include, symlinks=args.symlinks,
+                    cancel=cancel, detect_hardlinks=args.detect_hardlinks,
+                )
+                _print_summary(summary, out)
+                return EXIT_EQUAL if summary.equal else EXIT_DIFFERENT
+            if args.verbose:
+                # Counts come from the summary pass; only a differing tree
+                # is walked again to list paths.
+                summary = _with_progress(compare_dir_summary, bar)(
+                    args.a, args.b,
+                    chunk_size=args.chunk_size, quick_check=args.quick_check,
+                    max_workers=args.jobs, stop_on_error=args.stop_on_error,
+                    exclude=args.exclude, include=args.include, symlinks=args.symlinks,
+                    cancel=cancel, detect_hardlinks=args.detect_hardlinks,
+                )
+                if summary.equal and not args.check:
+                    _print_equal(summary.compared, summary.bytes_read, out)
+                    return EXIT_EQUAL
+            result = _with_progress(compare_dir, bar)(
+                args.a, args.b,
+                chunk_size=args.chunk_size, quick_check=args.quick_check,
+                max_workers=args.jobs, stop_on_error=args.stop_on_error,
+                exclude=args.exclude, include=args.include, symlinks=args.symlinks,
+                cancel=cancel, metadata=args.check, mtime_tolerance=args.mtime_tolerance,
+                detect_hardlinks=args.detect_hardlinks,
+            )
+            if result.equal and args.verbose:
+                # Content matched in the summary pass, metadata only now.
+                _print_equal(summary.compared, summary.bytes_read, out)
+                return EXIT_EQUAL
+            _print_result(result, out)
+            return EXIT_EQUAL if result.equal else EXIT_DIFFERENT
+
+        if args.check:
+            raise ValueError("--check needs two directories")
+        if args.first_diff:
+            mismatch = first_difference(args.a, args.b, context=_CONTEXT,
+                                        chunk_size=args.chunk_size)
+            equal = mismatch is None
+        else:
+            equal = _with_progress(compare, bar)(
+                args.a, args.b,
+                chunk_size=args.chunk_size, quick_check=args.quick_check,
+                symlinks=args.symlinks or "follow", strategy=args.strategy,
+                cancel=cancel,
+            )
+        if equal:
+            if args.verbose:
+                _print_equal(1, _file_bytes_read(args.a, args.b), out)
+            return EXIT_EQUAL
+        if args.first_diff:
+            _print_first_diff(args.a, args.b, mismatch, out)
+        else:
+            out.write(f"{args.a} and {args.b} differ\n")
+        return EXIT_DIFFERENT
+    except CancelledError:
+        return EXIT_INTERRUPTED  # reported by main()
+    except (OSError, ValueError, KomparuError) as e:
+        sys.stderr.write(f"komparu: {e}\n")
+        return EXIT_ERROR
+
+
+def _run_manifest(args: argparse.Namespace, out: TextIO, cancel: CancelToken) -> int:
+    try:
+        manifest = manifest_dir(args.dir, algorithm=args.algorithm,
+                                chunk_size=args.chunk_size, max_workers=args.jobs)
+        if args.output is None:
+            write_manifest(manifest, out)
+        else:
+            with open(args.output, "w", encoding="utf-8") as f:
+                write_manifest(manifest, f)
+        return EXIT_EQUAL
+    except (OSError, ValueError, KomparuError) as e:
+        sys.stderr.write(f"komparu: {e}\n")
+        return EXIT_ERROR
+
+
+def _run_verify(args: argparse.Namespace, out: TextIO, cancel: CancelToken) -> int:
+    try:
+        result = verify_manifest(args.dir, args.manifest,
+                                 chunk_size=args.chunk_size, max_workers=args.jobs)
+    except (OSError, ValueError, KomparuError) as e:
+        sys.stderr.write(f"komparu: {e}\n")
+        return EXIT_ERROR
+    for path in sorted(result.diff):
+        out.write(f"differ: {path} ({result.diff[path].value})\n")
+    for path in sorted(result.only_left):
+        out.write(f"missing: {path}\n")
+    for path in sorted(result.only_right):
+        out.write(f"extra: {path}\n")
+    for path in sorted(result.errors):
+        out.write(f"error: {path}\n")
+    if result.equal and args.verbose:
+        out.write("tree matches the manifest\n")
+    return EXIT_EQUAL if result.equal else EXIT_DIFFERENT
+
+
+def _run_watch(args: argparse.Namespace, out: TextIO, cancel: CancelToken) -> int:
+    try:
+        watcher = Watcher(args.dir_a, args.dir_b, interval=args.interval,
+                          chunk_size=args.chunk_size, exclude=args.exclude,
+                          include=args.include, backend=args.backend)
+    except (OSError, ValueError, KomparuError) as e:
+        sys.stderr.write(f"komparu: {e}\n")
+        return EXIT_ERROR
+    with watcher:
+        result = watcher.result
+        out.write("equal\n" if result.equal else "different\n")
+        _print_result(result, out)
+        out.flush()
+        while not (args.until_equal and result.equal):
+            if cancel.cancelled:
+                return EXIT_INTERRUPTED  # reported by main()
+            event = watcher.poll(0.25)
+            if event is None:
+                continue
+            result = event.result
+            out.write(f"{event.kind}\n")
+            _print_result(result, out)
+            out.flush()
+    return EXIT_EQUAL
+
+
+def _run_serve(args: argparse.Namespace, out: TextIO, cancel: CancelToken) -> int:
+    try:
+        serve_tree(args.dir, cache=args.cache_dir)
+    except (OSError, ValueError, KomparuError) as e:
+        sys.stderr.write(f"komparu: {e}\n")
+        return EXIT_ERROR
+    return EXIT_EQUAL
+
+
+def _run_remote(args: argparse.Namespace, out: TextIO, cancel: CancelToken) -> int:
+    try:
+        with RemoteTree(args.remote, ssh=args.ssh, agent=args.agent) as remote:
+            result = remote.compare(
+                args.dir, chunk_size=args.chunk_size, max_workers=args.jobs,
+                exclude=args.exclude, include=args.include, cache=args.cache_dir,
+                cancel=cancel,
+            )
+            ranges = None
+            if args.ranges:
+                ranges = {
+                    p: remote.diff_ranges(os.path.join(args.dir, p), p,
+                                          block_size=args.block_size)
+                    for p, reason in result.diff.items()
+                    if reason is DiffReason.CONTENT_MISMATCH
+                }
+    except CancelledError:
+        return EXIT_INTERRUPTED  # reported by main()
+    except (OSError, ValueError, KomparuError) as e:
+        sys.stderr.write(f"komparu: {e}\n")
+        return EXIT_ERROR
+    _print_result(result, out, ranges)
+    return EXIT_EQUAL if result.equal else EXIT_DIFFERENT
+
+
+def _run_tune(args: argparse.Namespace, out: TextIO, cancel: CancelToken) -> int:
+    try:
+        result = tune_read(
+            args.file, chunk_sizes=args.chunk_size or TUNE_CHUNK_SIZES,
+            strategies=args.strategy or TUNE_STRATEGIES, rounds=args.rounds, cancel=cancel,
+        )
+    except CancelledError:
+        return EXIT_INTERRUPTED  # reported by main()
+    except (OSError, ValueError, KomparuError) as e:
+        sys.stderr.write(f"komparu: {e}\n")
+        return EXIT_ERROR
+    out.write(f"sample: {result.path} ({_human(result.size)}, best of {args.rounds})\n")
+    for trial in result.trials:
+        out.write(f"{trial.strategy:<9} {trial.chunk_size:>8}  {_human(trial.throughput)}/s\n")
+    for strategy, reason in result.unavailable.items():
+        out.write(f"{strategy:<9} unavailable ({reason})\n")
+    if not result.trials:
+        sys.stderr.write("komparu: no strategy could be timed\n")
+        return EXIT_ERROR
+    best = result.best
+    if best.strategy == "io_uring":
+        # not selectable from the command line
+        out.write(f"recommended: compare(..., chunk_size={best.chunk_size}, io_uring=True)\n")
+    else:
+        out.write(f"recommended: --chunk-size {best.chunk_size} --strategy {best.strategy}\n")
+    return EXIT_EQUAL
+
+
+_MERGE_TEXT = {
+    MergeStatus.UNCHANGED: "unchanged",
+    MergeStatus.CHANGED_LEFT: "changed in A",
+    MergeStatus.CHANGED_RIGHT: "changed in B",
+    MergeStatus.CHANGED_BOTH_SAME: "changed in both",
+    MergeStatus.CONFLICT: "conflict",
+}
+
+
+def _run_three_way(args: argparse.Namespace, out: TextIO, cancel: CancelToken) -> int:
+    try:
+        result = compare_three_way(
+            args.base, args.a, args.b,
+            chunk_size=args.chunk_size, max_workers=args.jobs,
+            exclude=args.exclude, include=args.include, cache=args.cache_dir,
+            cancel=cancel,
+        )
+    except CancelledError:
+        return EXIT_INTERRUPTED  # reported by main()
+    except (OSError, ValueError, KomparuError) as e:
+        sys.stderr.write(f"komparu: {e}\n")
+        return EXIT_ERROR
+    if args.format != "text":
+        write_three_way_report(result, args.format, out)
+    else:
+        for path, status in result.files.items():
+            if status is not MergeStatus.UNCHANGED or args.verbose:
+                out.write(f"{_MERGE_TEXT[status]}: {path}\n")
+    return EXIT_EQUAL if result.clean else EXIT_DIFFERENT
+
+
+# argv[0] words that select a subcommand instead of naming a file (unless after "--")
+_COMMANDS = {
+    "manifest": (_build_manifest_parser, _run_manifest),
+    "verify": (_build_verify_parser, _run_verify),
+    "watch": (_build_watch_parser, _run_watch),
+    "serve": (_build_serve_parser, _run_serve),
+    "remote": (_build_remote_parser, _run_remote),
+    "tune": (_build_tune_parser, _run_tune),
+    "three-way": (_build_three_way_parser, _run_three_way),
+}
@@ -2,8 +2,15 @@
 
 from __future__ import annotations
 
+import logging
 from dataclasses import dataclass, field
 
+from komparu._core import set_skip_holes as _set_skip_holes_c
+
+# Library logger: silent unless the application configures logging
+_default_logger = logging.getLogger("komparu")
+_default_logger.addHandler(logging.NullHandler())
+
 
 @dataclass
 class KomparuConfig:
@@ -21,6 +28,7 @@ class KomparuConfig:
     verify_ssl: bool = True
     size_precheck: bool = True
     quick_check: bool = True
+    skip_holes: bool = True  # process-wide, applied by configure()
 
     # HTTP
     headers: dict[str, str] = field(default_factory=dict)
@@ -40,6 +48,9 @@ class KomparuConfig:
     # SSRF protection
     allow_private_redirects: bool = False
 
+    # Diagnostics
+    logger: logging.Logger | None = None  # None = the "komparu" logger
+
 
 # Global singleton
 _config = KomparuConfig()
@@ -55,6 +66,8 @@ def configure(**kwargs) -> None:
     :param verify_ssl: Verify SSL certificates.
     :param size_precheck: Compare sizes before content.
     :param quick_check: Sample key offsets before full scan.
+    :param skip_holes: Skip holes two sparse local files share instead
+        of reading their zeros (False reads every byte).
     :param headers: Global HTTP headers.
     :param max_decompressed_size: Max decompressed bytes per archive (None = no limit).
     :param max_compression_ratio: Max compression ratio (None = no limit).
@@ -63,6 +76,7 @@ def configure(**kwargs) -> None:
     :param comparison_timeout: Wall-clock timeout per comparison (None = no limit).
     :param proxy: Proxy URL (e.g. http://host:port, socks5://host:port).
     :param allow_private_redirects: Allow redirects to private networks.
+    :param logger: Logger for diagnostic events (None = ``komparu``).
     """
     global _config
     # Validate all keys first to avoid partial updates
@@ -72,6 +86,8 @@ def configure(**kwargs) -> None:
             raise ConfigError(f"unknown config option: {key!r}")
     for key, value in kwargs.items():
         setattr(_config, key, value)
+    if "skip_holes" in kwargs:
+        _set_skip_holes_c(bool(kwargs["skip_holes"]))
 
 
 def get_config() -> KomparuConfig:
@@ -79,7 +95,13 @@ def get_config() -> KomparuConfig:
     return _config
 
 
+def get_logger() -> logging.Logger:
+    """Get the logger diagnostic events are sent to."""
+    return _config.logger or _default_logger
+
+
 def reset_config() -> None:
     """Reset configuration to defaults."""
     global _config
     _config = KomparuConfig()
+    _set_skip_holes_c(True)
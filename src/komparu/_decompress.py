@@ -0,0 +1,100 @@
+"""Decompressor registry for ``compare(decompress=True)``.
+
+gzip, bzip2, xz and zstd are decompressed natively in the C core. Formats
+registered with :func:`register_decompressor` are matched by magic bytes
+here, and such pairs are compared by a streaming Python path instead; a
+side in a built-in format is still decompressed by the C core there.
+"""
+
+from __future__ import annotations
+
+from collections.abc import Callable
+from contextlib import ExitStack
+from typing import BinaryIO
+
+from komparu._core import decompress_close as _decompress_close_c
+from komparu._core import decompress_open as _decompress_open_c
+from komparu._core import decompress_read as _decompress_read_c
+from komparu._stream import compare_readers
+
+Decompressor = Callable[[BinaryIO], BinaryIO]
+
+_custom: dict[bytes, Decompressor] = {}
+
+
+class _NativeStream:
+    """A local file read through the C core's built-in decompressors."""
+
+    def __init__(self, path: str) -> None:
+        self._handle = _decompress_open_c(path)
+
+    def read(self, size: int = -1) -> bytes:
+        if size < 0:
+            return b"".join(iter(lambda: self.read(1 << 20), b""))
+        return _decompress_read_c(self._handle, size)
+
+    def close(self) -> None:
+        _decompress_close_c(self._handle)
+
+
+def register_decompressor(magic: bytes, fn: Decompressor) -> None:
+    """Register a decompressor for files starting with *magic*.
+
+    *fn* receives the file opened in binary mode and returns a readable
+    binary stream of the decompressed content. Registered entries take
+    precedence over the built-in formats; re-registering a magic replaces it.
+
+    :param magic: Leading bytes that identify the format.
+    :param fn: Wraps a compressed stream into a decompressed one.
+    :raises ValueError: If magic is empty.
+    :raises TypeError: If fn is not callable.
+    """
+    if not isinstance(magic, (bytes, bytearray)) or not magic:
+        raise ValueError("magic must be non-empty bytes")
+    if not callable(fn):
+        raise TypeError("fn must be callable")
+    _custom[bytes(magic)] = fn
+
+
+def _match(head: bytes, table: dict[bytes, Decompressor]) -> Decompressor | None:
+    for magic in sorted(table, key=len, reverse=True):
+        if head.startswith(magic):
+            return table[magic]
+    return None
+
+
+def _read_head(path: str) -> bytes:
+    size = max(map(len, _custom), default=0)
+    with open(path, "rb") as f:
+        return f.read(size)
+
+
+def needs_python(path_a: str, path_b: str) -> bool:
+    """True if either file starts with a registered custom magic."""
+    if not _custom:
+        return False
+    return any(
+        _match(_read_head(p), _custom) is not None for p in (path_a, path_b)
+    )
+
+
+def _open(stack: ExitStack, path: str) -> BinaryIO:
+    fn = _match(_read_head(path), _custom)
+    if fn is None:
+        native = _NativeStream(path)
+        stack.callback(native.close)
+        return native  # type: ignore[return-value]
+    f = stack.enter_context(open(path, "rb"))
+    stream = fn(f)
+    close = getattr(stream, "close", None)
+    if close is not None:
+        stack.callback(close)
+    return stream
+
+
+def compare_streams(path_a: str, path_b: str, chunk_size: int) -> bool:
+    """Compare the decompressed content of two local files chunk by chunk."""
+    with ExitStack() as stack:
+        return compare_readers(
+            _open(stack, path_a), _open(stack, path_b), chunk_size=chunk_size,
+        )
@@ -0,0 +1,113 @@
+"""Delta streams: the chunks of one file that differ from another."""
+
+from __future__ import annotations
+
+import io
+import struct
+from collections.abc import Iterator
+from typing import BinaryIO
+
+from komparu._stream import _read_full
+from komparu._validate import validate_chunk_size, validate_path
+
+# Record header: offset in B (u64) and payload length (u32), big-endian.
+# A record with length 0 ends the stream; its offset is B's size.
+_RECORD = struct.Struct(">QI")
+
+
+def _records(fa: BinaryIO, fb: BinaryIO, chunk_size: int) -> Iterator[bytes]:
+    offset = 0
+    while True:
+        chunk_b = _read_full(fb, chunk_size)
+        if not chunk_b:
+            break
+        if _read_full(fa, chunk_size) != chunk_b:
+            yield _RECORD.pack(offset, len(chunk_b))
+            yield chunk_b
+        offset += len(chunk_b)
+    yield _RECORD.pack(offset, 0)
+
+
+class _DeltaStream(io.RawIOBase):
+    """Raw stream over the records of two open files; owns the files."""
+
+    def __init__(self, fa: BinaryIO, fb: BinaryIO, chunk_size: int) -> None:
+        self._files = (fa, fb)
+        self._records = _records(fa, fb, chunk_size)
+        self._pending = memoryview(b"")
+
+    def readable(self) -> bool:
+        return True
+
+    def readinto(self, buf) -> int:  # type: ignore[override]
+        while not self._pending:
+            piece = next(self._records, None)
+            if piece is None:
+                return 0
+            self._pending = memoryview(piece)
+        n = min(len(buf), len(self._pending))
+        buf[:n] = self._pending[:n]
+        self._pending = self._pending[n:]
+        return n
+
+    def close(self) -> None:
+        if not self.closed:
+            for f in self._files:
+                f.close()
+        super().close()
+
+
+def delta_reader(path_a: str, path_b: str, *, chunk_size: int = 65536) -> BinaryIO:
+    """Stream the chunks of ``path_b`` that differ from ``path_a``.
+
+    Both files are split into ``chunk_size`` chunks at the same offsets.
+    For each chunk of B that differs from A (or lies past A's end), the
+    stream carries a record: a 12-byte header — offset in B (u64) and
+    length (u32), big-endian — followed by B's bytes. A final header with
+    length 0 gives B's total size. Writing every record over a copy of A
+    and truncating to that size reconstructs B (see :func:`apply_delta`).
+
+    The files are read lazily as the stream is consumed; close it (or use
+    it as a context manager) to release them.
+
+    :param path_a: Path to the base file.
+    :param path_b: Path to the target file.
+    :param chunk_size: Chunk size; also the largest record payload.
+    :returns: Readable binary stream of records.
+    """
+    validate_path(path_a, "path_a")
+    validate_path(path_b, "path_b")
+    validate_chunk_size(chunk_size)
+    fa = open(path_a, "rb")
+    try:
+        fb = open(path_b, "rb")
+    except BaseException:
+        fa.close()
+        raise
+    return io.BufferedReader(_DeltaStream(fa, fb, chunk_size))
+
+
+def apply_delta(path: str, delta: BinaryIO) -> None:
+    """Apply a :func:`delta_reader` stream to ``path`` in place.
+
+    ``path`` must hold the base file A; afterwards it holds B.
+
+    :param path: File to patch.
+    :param delta: Stream produced by :func:`delta_reader`.
+    :raises ValueError: If the stream is truncated.
+    """
+    validate_path(path, "path")
+    with open(path, "r+b") as f:
+        while True:
+            header = _read_full(delta, _RECORD.size)
+            if len(header) != _RECORD.size:
+                raise ValueError("delta stream truncated")
+            offset, length = _RECORD.unpack(header)
+            if length == 0:
+                f.truncate(offset)
+                return
+            data = _read_full(delta, length)
+            if len(data) != length:
+                raise ValueError("delta stream truncated")
+            f.seek(offset)
+            f.write(data)
@@ -0,0 +1,414 @@
+"""Directory comparison over virtual filesystems: archives, package data, in-memory trees."""
+
+from __future__ import annotations
+
+import io
+import os
+import stat
+import tarfile
+import time
+import zipfile
+from collections.abc import Callable, Mapping
+from contextlib import ExitStack, closing
+from importlib.resources.abc import Traversable
+from typing import BinaryIO, Protocol, runtime_checkable
+
+from komparu._cancel import CancelToken
+from komparu._helpers import _METADATA_REASONS, filter_dir_result, walk_filter
+from komparu._snapshot import _scan, _under
+from komparu._stream import _open_with, compare_readers
+from komparu._types import DiffReason, DirResult, FileStat
+from komparu._validate import (
+    validate_chunk_size, validate_max_depth, validate_metadata, validate_patterns,
+)
+
+
+@runtime_checkable
+class FileSystem(Protocol):
+    """A read-only tree of files that :func:`compare_fs` can walk."""
+
+    def files(self) -> Mapping[str, int | None]:
+        """Every regular file: ``/``-separated relative path → size, or
+        None if the size is not known without reading."""
+        ...
+
+    def open(self, path: str) -> BinaryIO:
+        """Open a file listed by :meth:`files` for binary reading."""
+        ...
+
+
+@runtime_checkable
+class StatFileSystem(FileSystem, Protocol):
+    """A :class:`FileSystem` that also reports metadata, for ``metadata=``."""
+
+    def stat(self, path: str) -> FileStat:
+        """Metadata of a file listed by :meth:`files`."""
+        ...
+
+
+class OSFS:
+    """A directory on disk.
+
+    Without following, each symlink is listed as a file whose content is
+    its target path, as :class:`TarFS` and :class:`ZipFS` store them.
+
+    :param root: Directory path.
+    :param follow_symlinks: Follow symbolic links during traversal.
+    """
+
+    def __init__(self, root: str, *, follow_symlinks: bool = True) -> None:
+        self.root = root
+        self.follow_symlinks = follow_symlinks
+        self.errors: set[str] = set()  # unreadable paths of the last files()
+
+    def files(self) -> dict[str, int | None]:
+        files, self.errors = _scan(self.root, self.follow_symlinks, not self.follow_symlinks)
+        return {p: size for p, (size, _mtime) in files.items()}
+
+    def open(self, path: str) -> BinaryIO:
+        full = os.path.join(self.root, path)
+        if not self.follow_symlinks and os.path.islink(full):
+            return io.BytesIO(os.fsencode(os.readlink(full)))
+        return open(full, "rb")
+
+    def stat(self, path: str) -> FileStat:
+        st = os.stat(os.path.join(self.root, path), follow_symlinks=self.follow_symlinks)
+        return FileStat(
+            mode=stat.S_IMODE(st.st_mode), mtime_ns=st.st_mtime_ns,
+            uid=st.st_uid, gid=st.st_gid,
+        )
+
+
+class ZipFS:
+    """The members of a zip archive, read with :mod:`zipfile`.
+
+    Unix permission bits are known for archives made on Unix; mtimes are
+    the archive's local timestamps, with 2-second resolution.
+
+    :param archive: Path of the archive or an open :class:`zipfile.ZipFile`.
+    """
+
+    def __init__(self, archive: str | zipfile.ZipFile) -> None:
+        self._zip = archive if isinstance(archive, zipfile.ZipFile) else zipfile.ZipFile(archive)
+        self._infos = {
+            info.filename.replace("\\", "/").lstrip("/"): info
+            for info in self._zip.infolist() if not info.is_dir()
+        }
+
+    def files(self) -> dict[str, int | None]:
+        return {p: info.file_size for p, info in self._infos.items()}
+
+    def open(self, path: str) -> BinaryIO:
+        return self._zip.open(self._infos[path])  # type: ignore[return-value]
+
+    def stat(self, path: str) -> FileStat:
+        info = self._infos[path]
+        mode = info.external_attr >> 16
+        return FileStat(
+            mode=stat.S_IMODE(mode) if info.create_system == 3 and mode else None,
+            mtime_ns=int(time.mktime(info.date_time + (0, 0, -1))) * 1_000_000_000,
+        )
+
+    def close(self) -> None:
+        self._zip.close()
+
+
+def _member_path(name: str) -> str:
+    """Archive member name as a relative path: ``./etc/x`` → ``etc/x``."""
+    path = name.replace("\\", "/")
+    while path.startswith(("./", "/")):
+        path = path[2:] if path.startswith("./") else path[1:]
+    return path
+
+
+class TarFS:
+    """The members of a tar archive, plain or compressed (gzip, bzip2,
+    xz), read with :mod:`tarfile`.
+
+    Leading ``./`` and ``/`` are stripped from member names, as container
+    layers often carry them; a name stored twice counts as its last copy,
+    as extraction would leave it. Hard links count as the file they link
+    to, and a symlink as a file whose content is its target path, as
+    :class:`OSFS` lists one without following; directories and special
+    members are not listed. Member
+    order is kept, so a compressed archive read as the first side of
+    :func:`compare_fs` is decompressed once.
+
+    :param archive: Path of the archive or an open :class:`tarfile.TarFile`.
+    """
+
+    def __init__(self, archive: str | tarfile.TarFile) -> None:
+        self._tar = archive if isinstance(archive, tarfile.TarFile) else tarfile.open(archive)
+        members: dict[str, tarfile.TarInfo] = {}
+        for member in self._tar.getmembers():
+            if member.isfile() or member.islnk() or member.issym():
+                path = _member_path(member.name)
+                members.pop(path, None)  # re-insert so the order is the last copy's
+                members[path] = member
+        self._members = members
+
+    def _target(self, member: tarfile.TarInfo) -> tarfile.TarInfo:
+        if member.islnk():
+            return self._members.get(_member_path(member.linkname), member)
+        return member
+
+    def files(self) -> dict[str, int | None]:
+        return {
+            p: len(os.fsencode(m.linkname)) if m.issym() else self._target(m).size
+            for p, m in self._members.items()
+        }
+
+    def open(self, path: str) -> BinaryIO:
+        member = self._target(self._members[path])
+        if member.issym():
+            return io.BytesIO(os.fsencode(member.linkname))
+        f = self._tar.extractfile(member)
+        if f is None:
+            raise OSError(f"cannot read {path!r} from the archive")
+        return f  # type: ignore[return-value]
+
+    def stat(self, path: str) -> FileStat:
+        m = self._members[path]
+        return FileStat(
+            mode=stat.S_IMODE(m.mode), mtime_ns=int(m.mtime) * 1_000_000_000,
+            uid=m.uid, gid=m.gid,
+        )
+
+    def close(self) -> None:
+        self._tar.close()
+
+
+def open_archive(path: str) -> ZipFS | TarFS:
+    """Open a zip or tar archive (by content, not extension) as a tree.
+
+    :param path: Archive file.
+    :returns: A :class:`ZipFS` or :class:`TarFS`; close it when done.
+    :raises ValueError: If the file is neither a zip nor a tar archive.
+    """
+    if zipfile.is_zipfile(path):
+        return ZipFS(path)
+    if tarfile.is_tarfile(path):
+        return TarFS(path)
+    raise ValueError(f"{path}: not a zip or tar archive")
+
+
+class MemoryFS:
+    """An in-memory tree, for tests and fixtures.
+
+    :param files: Relative path → content.
+    """
+
+    def __init__(self, files: Mapping[str, bytes]) -> None:
+        self._files = {p.replace("\\", "/").lstrip("/"): bytes(c) for p, c in files.items()}
+
+    def files(self) -> dict[str, int | None]:
+        return {p: len(c) for p, c in self._files.items()}
+
+    def open(self, path: str) -> BinaryIO:
+        return io.BytesIO(self._files[path])
+
+
+class ResourceFS:
+    """Files below an :mod:`importlib.resources` traversable, such as data
+    embedded in an installed (possibly zipped) package.
+
+    Sizes are not known up front, so every pair present on both sides is
+    read.
+
+    :param root: E.g. ``importlib.resources.files("mypkg") / "data"``.
+    """
+
+    def __init__(self, root: Traversable) -> None:
+        self._root = root
+
+    def files(self) -> dict[str, int | None]:
+        found: dict[str, int | None] = {}
+        pending: list[tuple[str, Traversable]] = [("", self._root)]
+        while pending:
+            prefix, node = pending.pop()
+            for child in node.iterdir():
+                if child.is_dir():
+                    pending.append((prefix + child.name + "/", child))
+                elif child.is_file():
+                    found[prefix + child.name] = None
+        return found
+
+    def open(self, path: str) -> BinaryIO:
+        return self._root.joinpath(*path.split("/")).open("rb")
+
+
+_FS_CHECKS = ("mode", "mtime", "uid", "gid")
+
+
+def _is_archive(fs: FileSystem | str) -> bool:
+    return isinstance(fs, (ZipFS, TarFS)) or isinstance(fs, str) and os.path.isfile(fs)
+
+
+def _as_fs(fs: FileSystem | str, name: str, stack: ExitStack, follow_symlinks: bool) -> FileSystem:
+    if isinstance(fs, str):
+        if os.path.isfile(fs):
+            return stack.enter_context(closing(open_archive(fs)))
+        return OSFS(fs, follow_symlinks=follow_symlinks)
+    if not isinstance(fs, FileSystem):
+        raise TypeError(f"{name} must be a FileSystem or a path, got {type(fs).__name__}")
+    return fs
+
+
+def _first_failed(
+    st_a: FileStat, st_b: FileStat, checks: set[str], tolerance_ns: int,
+) -> str | None:
+    """First of *checks* the two stats fail; values a side lacks pass."""
+    for check in _FS_CHECKS:
+        if check not in checks:
+            continue
+        key = "mtime_ns" if check == "mtime" else check
+        va, vb = getattr(st_a, key), getattr(st_b, key)
+        if va is None or vb is None:
+            continue
+        if abs(va - vb) > tolerance_ns if check == "mtime" else va != vb:
+            return check
+    return None
+
+
+def _compare_trees(
+    fs_a: FileSystem,
+    fs_b: FileSystem,
+    chunk_size: int,
+    size_precheck: bool,
+    keep: Callable[[str], bool] | None,
+    max_depth: int | None,
+    checks: set[str],
+    tolerance_ns: int,
+    cancel: CancelToken | None,
+) -> DirResult:
+    files_a, files_b = fs_a.files(), fs_b.files()
+    errors = set(getattr(fs_a, "errors", ())) | set(getattr(fs_b, "errors", ()))
+
+    def wanted(path: str) -> bool:
+        if max_depth is not None and path.count("/") > max_depth:
+            return False
+        return keep is None or keep(path)
+
+    names_a = {p for p in files_a if wanted(p)}
+    names_b = {p for p in files_b if wanted(p)}
+    diff: dict[str, DiffReason] = {}
+    # The first side's order: a compressed tarball is then read front to back
+    for path in [p for p in files_a if p in names_a and p in names_b]:
+        if cancel is not None:
+            cancel.raise_if_cancelled()
+        size_a, size_b = files_a[path], files_b[path]
+        if size_precheck and size_a is not None and size_b is not None and size_a != size_b:
+            diff[path] = DiffReason.SIZE_MISMATCH
+            continue
+        try:
+            with ExitStack() as stack:
+                equal = compare_readers(
+                    _open_with(stack, fs_a.open, path), _open_with(stack, fs_b.open, path),
+                    chunk_size=chunk_size,
+                )
+        except OSError:
+            diff[path] = DiffReason.READ_ERROR
+            continue
+        if not equal:
+            diff[path] = (DiffReason.SIZE_MISMATCH
+                          if size_a is not None and size_b is not None and size_a != size_b
+                          else DiffReason.CONTENT_MISMATCH)
+        elif checks:
+            failed = _first_failed(fs_a.stat(path), fs_b.stat(path), checks, tolerance_ns)
+            if failed is not None:
+                diff[path] = _METADATA_REASONS[failed]
+
+    only_left = {p for p in names_a - names_b if not _under(p, errors)}
+    only_right = {p for p in names_b - names_a if not _under(p, errors)}
+    return DirResult(
+        equal=not (diff or only_left or only_right or errors),
+        diff=diff,
+        only_left=only_left,
+        only_right=only_right,
+        errors=errors,
+    )
+
+
+def compare_fs(
+    fs_a: FileSystem | str,
+    fs_b: FileSystem | str,
+    *,
+    chunk_size: int = 65536,
+    size_precheck: bool = True,
+    ignore: list[str] | None = None,
+    exclude: list[str] | None = None,
+    include: list[str] | None = None,
+    max_depth: int | None = None,
+    metadata: list[str] | None = None,
+    mtime_tolerance: float = 0.0,
+    cancel: CancelToken | None = None,
+) -> DirResult:
+    """Compare two file trees, either of which may be virtual.
+
+    Each side is a :class:`FileSystem` — :class:`OSFS`, :class:`ZipFS`,
+    :class:`TarFS`, :class:`MemoryFS`, :class:`ResourceFS` or any object
+    with ``files()`` and ``open()`` — or a path: a directory, or an
+    archive file opened with :func:`open_archive` for the call. A
+    directory path compared with an archive is read as
+    ``OSFS(path, follow_symlinks=False)``, so symlinks on both sides
+    compare by target path. Two
+    on-disk trees go straight to :func:`~komparu.compare_dir` and its
+    native thread pool; otherwise file pairs are streamed through
+    :func:`~komparu.compare_readers` one at a time, in the first side's
+    order, sizes first where both are known. Entry order, mtimes and
+    ownership never matter unless requested with ``metadata``.
+
+    :param fs_a: First tree.
+    :param fs_b: Second tree.
+    :param chunk_size: Read chunk size in bytes.
+    :param size_precheck: Report known, differing sizes without reading.
+    :param ignore: Glob patterns to exclude (matched per path component).
+    :param exclude: Gitignore-style patterns of paths to leave out.
+    :param include: Gitignore-style patterns of the files to compare.
+    :param max_depth: Compare files at most this many levels down.
+    :param metadata: ``"mode"``, ``"mtime"``, ``"uid"`` and ``"gid"``
+        checks for files with equal content, as in
+        :func:`~komparu.compare_dir`; both sides must be
+        :class:`StatFileSystem`. A value a side does not know (None) is
+        not checked. ``"xattr"`` needs two on-disk trees.
+    :param mtime_tolerance: Allowed mtime drift in seconds.
+    :param cancel: Token checked before each pair.
+    :returns: DirResult; ``errors`` lists unreadable paths of an
+        :class:`OSFS` side and makes the result unequal.
+    :raises TypeError: If a side is neither a FileSystem nor a path.
+    :raises ValueError: If a metadata check is not available for a side,
+        or a file path is not a zip or tar archive.
+    :raises CancelledError: If ``cancel`` was cancelled.
+    """
+    validate_chunk_size(chunk_size)
+    validate_max_depth(max_depth)
+    validate_patterns(exclude, "exclude")
+    validate_patterns(include, "include")
+    validate_metadata(metadata, mtime_tolerance)
+    follow = not (_is_archive(fs_a) or _is_archive(fs_b))
+    with ExitStack() as stack:
+        fs_a, fs_b = _as_fs(fs_a, "fs_a", stack, follow), _as_fs(fs_b, "fs_b", stack, follow)
+        if isinstance(fs_a, OSFS) and isinstance(fs_b, OSFS) \
+                and fs_a.follow_symlinks == fs_b.follow_symlinks:
+            from komparu._api import compare_dir
+
+            return compare_dir(
+                fs_a.root, fs_b.root,
+                chunk_size=chunk_size, size_precheck=size_precheck,
+                symlinks="follow" if fs_a.follow_symlinks else "compare-link", ignore=ignore,
+                exclude=exclude, include=include, max_depth=max_depth,
+                metadata=metadata, mtime_tolerance=mtime_tolerance, cancel=cancel,
+            )
+
+        checks = set(metadata or ())
+        if checks - set(_FS_CHECKS):
+            raise ValueError("the xattr check needs two on-disk trees")
+        if checks and not (isinstance(fs_a, StatFileSystem)
+                           and isinstance(fs_b, StatFileSystem)):
+            raise ValueError("metadata checks need a stat() method on both filesystems")
+        result = _compare_trees(
+            fs_a, fs_b, chunk_size, size_precheck, walk_filter(exclude, include),
+            max_depth, checks, round(mtime_tolerance * 1_000_000_000), cancel,
+        )
+    return filter_dir_result(result, ignore) if ignore else result
+
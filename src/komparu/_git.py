@@ -0,0 +1,187 @@
+"""Compare a working directory against a tree from git history."""
+
+from __future__ import annotations
+
+import hashlib
+import os
+import stat
+import subprocess
+from collections.abc import Iterable
+
+from komparu._helpers import filter_dir_result, to_slash
+from komparu._types import (
+    DiffReason, DirResult, SourceNotFoundError, SourceReadError,
+)
+from komparu._validate import validate_chunk_size, validate_path
+
+_SYMLINK = "120000"
+_GITLINK = "160000"
+
+# Object id length (hex) → hash used by the repository's object format
+_OID_HASH = {40: "sha1", 64: "sha256"}
+
+
+def _git(repo: str, *args: str) -> subprocess.CompletedProcess[bytes]:
+    try:
+        return subprocess.run(
+            ["git", "-C", repo, *args], capture_output=True, check=False,
+        )
+    except FileNotFoundError:
+        raise SourceReadError("git executable not found") from None
+
+
+def _resolve_tree(repo: str, commitish: str, subpath: str) -> str:
+    """Object id of the tree at *subpath* ("" = root) of *commitish*."""
+    spec = f"{commitish}^{{tree}}:{subpath}"
+    proc = _git(repo, "rev-parse", "--verify", "--quiet", "--end-of-options", spec)
+    if proc.returncode == 0 and subpath:
+        oid = proc.stdout.decode().strip()
+        if _git(repo, "cat-file", "-t", oid).stdout.strip() != b"tree":
+            raise SourceNotFoundError(f"{repo}: {subpath!r} at {commitish!r} is not a directory")
+    if proc.returncode == 1:
+        raise SourceNotFoundError(f"{repo}: no tree at {commitish!r}:{subpath!r}")
+    if proc.returncode != 0:
+        msg = proc.stderr.decode(errors="replace").strip()
+        raise SourceReadError(f"{repo}: {msg}")
+    return proc.stdout.decode().strip()
+
+
+def _ls_tree(repo: str, tree: str) -> dict[str, tuple[str, str, int]]:
+    """Map each path below *tree* to ``(mode, oid, size)``; size is -1
+    for submodules."""
+    proc = _git(repo, "ls-tree", "-r", "-z", "-l", tree)
+    if proc.returncode != 0:
+        msg = proc.stderr.decode(errors="replace").strip()
+        raise SourceReadError(f"{repo}: git ls-tree failed: {msg}")
+    entries: dict[str, tuple[str, str, int]] = {}
+    for record in proc.stdout.split(b"\0"):
+        if not record:
+            continue
+        meta, path = record.split(b"\t", 1)
+        mode, _type, oid, size = meta.decode().split()
+        entries[os.fsdecode(path)] = (mode, oid, -1 if size == "-" else int(size))
+    return entries
+
+
+def _blob_oid(algo: str, chunks: Iterable[bytes], size: int) -> str:
+    h = hashlib.new(algo)
+    h.update(b"blob %d\0" % size)
+    for chunk in chunks:
+        h.update(chunk)
+    return h.hexdigest()
+
+
+def _file_oid(path: str, algo: str, size: int, chunk_size: int) -> str:
+    with open(path, "rb") as f:
+        return _blob_oid(algo, iter(lambda: f.read(chunk_size), b""), size)
+
+
+def _worktree_paths(base: str, skip: set[str]) -> tuple[set[str], set[str]]:
+    """Files and symlinks below *base*, excluding ``.git`` and submodules,
+    plus the directories that could not be listed."""
+    found: set[str] = set()
+    errors: set[str] = set()
+
+    def onerror(e: OSError) -> None:
+        if e.filename is not None:
+            errors.add(to_slash(os.path.relpath(e.filename, base)))
+
+    for root, dirs, files in os.walk(base, onerror=onerror):
+        rel_root = to_slash(os.path.relpath(root, base))
+        prefix = "" if rel_root == "." else rel_root + "/"
+        if not prefix:
+            dirs[:] = [d for d in dirs if d != ".git"]
+        kept = []
+        for d in dirs:
+            rel = prefix + d
+            if os.path.islink(os.path.join(root, d)):
+                found.add(rel)
+            elif rel not in skip:
+                kept.append(d)
+        dirs[:] = kept
+        found.update(prefix + name for name in files)
+    return found, errors
+
+
+def compare_git_tree(
+    repo: str,
+    commitish: str,
+    subpath: str = "",
+    *,
+    ignore: list[str] | None = None,
+    chunk_size: int = 65536,
+) -> DirResult:
+    """Compare a working directory against its state at a git commit.
+
+    Nothing is checked out: the tree at ``commitish`` (optionally narrowed
+    to ``subpath``) is listed with ``git ls-tree``, and each working file
+    is hashed as a git blob and matched against the recorded object id.
+    Sizes are compared first, so most changed files are not read. Symlinks
+    compare by target; submodules are skipped. ``.git`` is not walked, but
+    untracked files are: they land in ``only_right`` unless excluded with
+    ``ignore`` (``.gitignore`` is not consulted). As in :func:`compare_dir`,
+    a tracked file that cannot be read is a READ_ERROR, and a working
+    directory that cannot be listed goes to ``errors``.
+
+    :param repo: Path to the repository's working tree.
+    :param commitish: Commit, tag, branch or any tree-ish git accepts.
+    :param subpath: Directory within the repository to compare ("" = root).
+    :param ignore: Glob patterns to exclude (matched per path component).
+    :param chunk_size: Read chunk size for hashing.
+    :returns: DirResult with the commit's tree as the left side and the
+        working directory as the right side.
+    :raises SourceNotFoundError: If ``commitish``/``subpath`` names no tree.
+    :raises SourceReadError: If git is missing or ``repo`` is not a
+        repository.
+    """
+    validate_path(repo, "repo")
+    validate_chunk_size(chunk_size)
+    sub = subpath.strip("/")
+    tree = _resolve_tree(repo, commitish, sub)
+    algo = _OID_HASH.get(len(tree))
+    if algo is None:
+        raise SourceReadError(f"{repo}: unknown object format for {tree}")
+
+    entries = _ls_tree(repo, tree)
+    base = os.path.join(repo, sub) if sub else repo
+    gitlinks = {p for p, (mode, _, _) in entries.items() if mode == _GITLINK}
+
+    diff: dict[str, DiffReason] = {}
+    only_left: set[str] = set()
+    errors: set[str] = set()
+    for rel, (mode, oid, size) in entries.items():
+        if mode == _GITLINK:
+            continue
+        path = os.path.join(base, rel)
+        try:
+            st = os.lstat(path)
+            if mode == _SYMLINK:
+                if not stat.S_ISLNK(st.st_mode):
+                    diff[rel] = DiffReason.TYPE_MISMATCH
+                    continue
+                target = os.fsencode(os.readlink(path))
+                if _blob_oid(algo, [target], len(target)) != oid:
+                    diff[rel] = DiffReason.CONTENT_MISMATCH
+            elif not stat.S_ISREG(st.st_mode):
+                diff[rel] = DiffReason.TYPE_MISMATCH
+            elif st.st_size != size:
+                diff[rel] = DiffReason.SIZE_MISMATCH
+            elif _file_oid(path, algo, size, chunk_size) != oid:
+                diff[rel] = DiffReason.CONTENT_MISMATCH
+        except (FileNotFoundError, NotADirectoryError):
+            only_left.add(rel)
+        except OSError:
+            diff[rel] = DiffReason.READ_ERROR
+
+    only_right: set[str] = set()
+    if os.path.isdir(base):
+        found, errors = _worktree_paths(base, gitlinks)
+        only_right = found - entries.keys()
+    result = DirResult(
+        equal=not (diff or only_left or only_right),
+        diff=diff,
+        only_left=only_left,
+        only_right=only_right,
+        errors=errors,
+    )
+    return filter_dir_result(result, ignore) if ignore else result
@@ -0,0 +1,176 @@
+"""``.gitignore`` matching for directory comparison."""
+
+from __future__ import annotations
+
+import os
+import re
+from dataclasses import dataclass
+
+from komparu._helpers import to_slash
+from komparu._types import DirResult
+
+
+@dataclass(frozen=True, slots=True)
+class _Rule:
+    base: str             # directory holding the .gitignore ("" = root)
+    regex: re.Pattern[str]
+    negate: bool
+    dir_only: bool
+
+
+def _class(pattern: str, i: int) -> tuple[str, int]:
+    """Translate the bracket expression starting at ``pattern[i] == "["``."""
+    j = i + 1
+    if j < len(pattern) and pattern[j] in "!^":
+        j += 1
+    if j < len(pattern) and pattern[j] == "]":
+        j += 1
+    while j < len(pattern) and pattern[j] != "]":
+        j += 1
+    if j >= len(pattern):
+        return re.escape("["), i + 1  # unterminated: literal "["
+    body = pattern[i + 1:j]
+    if body[0] in "!^":
+        body = "^" + body[1:]
+    return "[" + body.replace("\\", "\\\\") + "]", j + 1
+
+
+def _translate(pattern: str) -> str:
+    """Regex for a gitignore glob, matched against a path relative to its base."""
+    anchored = "/" in pattern
+    pattern = pattern.lstrip("/") if pattern.startswith("/") else pattern
+    out = [] if anchored else ["(?:.*/)?"]
+    i, n = 0, len(pattern)
+    while i < n:
+        c = pattern[i]
+        if pattern.startswith("**", i):
+            at_start = i == 0 or pattern[i - 1] == "/"
+            if at_start and pattern.startswith("**/", i):
+                out.append("(?:.*/)?")
+                i += 3
+                continue
+            if at_start and i + 2 == n:
+                out.append(".*")
+                i += 2
+                continue
+            out.append("[^/]*")
+            i += 2
+        elif c == "*":
+            out.append("[^/]*")
+            i += 1
+        elif c == "?":
+            out.append("[^/]")
+            i += 1
+        elif c == "[":
+            piece, i = _class(pattern, i)
+            out.append(piece)
+        elif c == "\\" and i + 1 < n:
+            out.append(re.escape(pattern[i + 1]))
+            i += 2
+        else:
+            out.append(re.escape(c))
+            i += 1
+    return "".join(out)
+
+
+def _parse(line: str, base: str) -> _Rule | None:
+    line = line.rstrip("\r\n")
+    while line.endswith(" ") and not line.endswith("\\ "):
+        line = line[:-1]
+    if not line or line.startswith("#"):
+        return None
+    negate = line.startswith("!")
+    if negate:
+        line = line[1:]
+    elif line.startswith("\\!") or line.startswith("\\#"):
+        line = line[1:]
+    dir_only = line.endswith("/")
+    line = line.rstrip("/")
+    if not line:
+        return None
+    try:
+        regex = re.compile(_translate(line), re.DOTALL)
+    except re.error:
+        return None  # git skips patterns it cannot parse
+    return _Rule(base, regex, negate, dir_only)
+
+
+class GitIgnore:
+    """The ``.gitignore`` rules of one tree, loaded from the root down.
+
+    Directories that are themselves ignored are not descended into, so
+    their ``.gitignore`` files are not read — as in git.
+    """
+
+    def __init__(self, root: str) -> None:
+        self.rules: list[_Rule] = []
+        for dirpath, dirs, _files in os.walk(root):
+            rel = to_slash(os.path.relpath(dirpath, root))
+            rel = "" if rel == "." else rel
+            self._load(os.path.join(dirpath, ".gitignore"), rel)
+            prefix = rel + "/" if rel else ""
+            dirs[:] = [d for d in dirs if not self.ignored(prefix + d, True)]
+
+    def _load(self, path: str, base: str) -> None:
+        try:
+            with open(path, encoding="utf-8", errors="surrogateescape") as f:
+                lines = f.readlines()
+        except (FileNotFoundError, NotADirectoryError, IsADirectoryError):
+            return
+        for line in lines:
+            rule = _parse(line, base)
+            if rule is not None:
+                self.rules.append(rule)
+
+    def _match(self, path: str, is_dir: bool) -> bool:
+        ignored = False
+        for rule in self.rules:
+            if rule.dir_only and not is_dir:
+                continue
+            if rule.base:
+                if not path.startswith(rule.base + "/"):
+                    continue
+                rel = path[len(rule.base) + 1:]
+            else:
+                rel = path
+            if rule.regex.fullmatch(rel):
+                ignored = not rule.negate
+        return ignored
+
+    def ignored(self, path: str, is_dir: bool) -> bool:
+        """True if *path* (``/``-separated, relative to the root) is ignored.
+
+        A path below an ignored directory is ignored whatever later rules
+        say: git cannot re-include a file whose parent is excluded.
+        """
+        parts = path.split("/")
+        if ".git" in parts:
+            return True
+        for i in range(1, len(parts)):
+            if self._match("/".join(parts[:i]), True):
+                return True
+        return self._match(path, is_dir)
+
+
+def filter_gitignored(result: DirResult, dir_a: str, dir_b: str) -> DirResult:
+    """Drop entries ignored by the ``.gitignore`` files of either tree."""
+    sides = [(GitIgnore(root), root) for root in (dir_a, dir_b)]
+
+    def keep(path: str) -> bool:
+        for rules, root in sides:
+            is_dir = os.path.isdir(os.path.join(root, path))
+            if rules.ignored(path, is_dir):
+                return False
+        return True
+
+    diff = {k: v for k, v in result.diff.items() if keep(k)}
+    only_left = {p for p in result.only_left if keep(p)}
+    only_right = {p for p in result.only_right if keep(p)}
+    errors = {p for p in result.errors if keep(p)}
+    return DirResult(
+        equal=not (diff or only_left or only_right),
+        diff=diff,
+        only_left=only_left,
+        only_right=only_right,
+        errors=errors,
+    )
@@ -2,11 +2,27 @@
 
 from __future__ import annotations
 
+import contextlib
+import dataclasses
+import errno
+import os
+import stat
+from collections.abc import Callable, Iterable, Iterator, Mapping
 from fnmatch import fnmatch
 from pathlib import PurePosixPath
+from typing import TypeVar
 
+from komparu._core import path_included as _path_included_c
+from komparu._config import get_logger
 from komparu._types import DiffReason, DirResult, Source
 
+try:
+    import fcntl
+except ImportError:  # Windows
+    fcntl = None  # type: ignore[assignment]
+
+V = TypeVar("V")
+
 
 def resolve_headers(source: str | Source, global_headers: dict[str, str] | None) -> dict[str, str] | None:
     """Merge per-source headers with global headers. Source wins."""
@@ -19,12 +35,200 @@ def resolve_headers(source: str | Source, global_headers: dict[str, str] | None)
     return global_headers
 
 
+_THP_ENABLED = "/sys/kernel/mm/transparent_hugepage/enabled"
+
+
+def thp_mode() -> str | None:
+    """Active transparent huge page mode ("always", "madvise", "never").
+
+    Returns None if the kernel does not expose THP (not Linux, or built
+    without it).
+    """
+    try:
+        with open(_THP_ENABLED) as f:
+            text = f.read()
+    except OSError:
+        return None
+    start = text.find("[")
+    end = text.find("]", start)
+    return text[start + 1:end] if start >= 0 and end > start else None
+
+
+@contextlib.contextmanager
+def shared_locks(paths: Iterable[str]) -> Iterator[None]:
+    """Hold a shared ``flock()`` on each local path for the ``with`` body.
+
+    Blocks while another process holds an exclusive lock. Writers that
+    do not lock are not kept out: the lock is advisory. A path that
+    cannot be opened is skipped (the comparison reports it), and one
+    that cannot be locked — NFS without lockd, a platform without
+    ``flock()`` — is compared unlocked, logged at INFO.
+    """
+    log = get_logger()
+    fds: list[int] = []
+    try:
+        for path in paths:
+            if "://" in path:
+                continue
+            if fcntl is None:
+                log.info("lock_files: flock() not available on this platform; "
+                         "comparing %s unlocked", path)
+                continue
+            try:
+                fd = os.open(path, os.O_RDONLY)
+            except OSError:
+                continue
+            fds.append(fd)
+            try:
+                fcntl.flock(fd, fcntl.LOCK_SH)
+            except OSError as e:
+                log.info("lock_files: cannot lock %s (%s); comparing unlocked",
+                         path, e.strerror or e)
+        yield
+    finally:
+        for fd in fds:
+            os.close(fd)  # drops the lock
+
+
+def equivalence_map(
+    classes: Iterable[Iterable[int]] | None, case_fold: bool = False,
+) -> bytes | None:
+    """Build a 256-byte table mapping each byte to its class representative.
+
+    Each class is a group of byte values (e.g. ``b"\\t "``) that compare
+    equal; its smallest member is the representative. Bytes in no class
+    map to themselves. ``case_fold`` adds the ASCII letter pairs
+    (``A``/``a`` … ``Z``/``z``), merged with any class that shares a letter.
+
+    :returns: The table, or None if no class merges two values.
+    :raises ValueError: If a value is outside 0..255 or in two classes.
+    """
+    if not classes and not case_fold:
+        return None
+    table = bytearray(range(256))
+    seen: set[int] = set()
+    merged = False
+    for group in classes or ():
+        members = set(group)
+        for b in members:
+            if not isinstance(b, int) or not 0 <= b <= 255:
+                raise ValueError(
+                    f"equivalence_classes values must be bytes 0..255, got {b!r}"
+                )
+        overlap = members & seen
+        if overlap:
+            raise ValueError(
+                f"byte 0x{min(overlap):02x} is in more than one equivalence class"
+            )
+        seen |= members
+        if len(members) > 1:
+            rep = min(members)
+            for b in members:
+                table[b] = rep
+            merged = True
+    if case_fold:
+        _merge_case_pairs(table)
+        merged = True
+    return bytes(table) if merged else None
+
+
+def side_byte_maps(
+    equivalence: bytes | None,
+    translate_a: bytes | None,
+    translate_b: bytes | None,
+) -> tuple[bytes | None, bytes | None]:
+    """Combine per-side translation tables with an equivalence map.
+
+    Each side's bytes go through its translation first, then through
+    *equivalence*. Returns ``(byte_map, byte_map_b)`` for the C layer:
+    ``byte_map_b`` is None when both sides use ``byte_map``.
+
+    :raises ValueError: If a table is not exactly 256 bytes.
+    :raises TypeError: If a table is not bytes-like.
+    """
+    if translate_a is None and translate_b is None:
+        return equivalence, None
+    maps = []
+    for table, name in ((translate_a, "translate_a"), (translate_b, "translate_b")):
+        if table is None:
+            maps.append(equivalence or bytes(range(256)))
+            continue
+        try:
+            table = bytes(memoryview(table).cast("B"))
+        except TypeError:
+            raise TypeError(f"{name} must be a bytes-like table") from None
+        if len(table) != 256:
+            raise ValueError(f"{name} must be 256 bytes, got {len(table)}")
+        if equivalence is not None:
+            table = table.translate(equivalence)
+        maps.append(table)
+    map_a, map_b = maps
+    return map_a, (None if map_b == map_a else map_b)
+
+
+def _merge_case_pairs(table: bytearray) -> None:
+    """Join the classes of each ASCII upper/lower pair in *table*."""
+    groups: dict[int, set[int]] = {}
+    for b, rep in enumerate(table):
+        groups.setdefault(rep, set()).add(b)
+    for upper in range(ord("A"), ord("Z") + 1):
+        rep_u, rep_l = table[upper], table[upper + 32]
+        if rep_u == rep_l:
+            continue
+        members = groups.pop(rep_u) | groups.pop(rep_l)
+        rep = min(members)
+        groups[rep] = members
+        for b in members:
+            table[b] = rep
+
+
+def to_slash(path: str) -> str:
+    """*path* with the OS separator replaced by ``/`` (a no-op on POSIX)."""
+    return path if os.sep == "/" else path.replace(os.sep, "/")
+
+
+def slash_keys(mapping: Mapping[str, V], name: str) -> dict[str, V]:
+    """Copy of a manifest with ``\\`` in its paths turned into ``/``.
+
+    Manifests may have been written on Windows, so a backslash is taken
+    as a separator whatever the current OS.
+
+    :raises ValueError: If two paths become the same.
+    """
+    out: dict[str, V] = {}
+    for path, value in mapping.items():
+        key = path.replace("\\", "/")
+        if key in out:
+            raise ValueError(f"{name}: {path!r} duplicates {key!r} after separator normalization")
+        out[key] = value
+    return out
+
+
 def _path_matches_ignore(path: str, patterns: list[str]) -> bool:
     """Check if any component of *path* matches any ignore pattern."""
-    parts = PurePosixPath(path).parts
+    parts = PurePosixPath(to_slash(path)).parts
     return any(fnmatch(part, pat) for part in parts for pat in patterns)
 
 
+def link_targets_equal(path_a: str, path_b: str) -> bool | None:
+    """Compare two paths as symlinks: None if neither is one, else
+    whether both are links with the same target string."""
+    link_a, link_b = os.path.islink(path_a), os.path.islink(path_b)
+    if not (link_a or link_b):
+        return None
+    return link_a and link_b and os.readlink(path_a) == os.readlink(path_b)
+
+
+def walk_filter(
+    exclude: list[str] | None, include: list[str] | None,
+) -> Callable[[str], bool] | None:
+    """Predicate telling whether the walk keeps a relative path, or None
+    if there are no patterns. A trailing ``/`` marks a directory."""
+    if not exclude and not include:
+        return None
+    return lambda path: _path_included_c(path, exclude, include)
+
+
 def filter_dir_result(result: DirResult, ignore: list[str]) -> DirResult:
     """Remove entries whose path matches any ignore glob pattern.
 
@@ -51,18 +255,428 @@ def filter_dir_result(result: DirResult, ignore: list[str]) -> DirResult:
     errors = {p for p in result.errors
               if not _path_matches_ignore(p, ignore)}
 
-    return DirResult(equal=equal, diff=diff,
-                     only_left=only_left, only_right=only_right,
-                     errors=errors)
+    return dataclasses.replace(result, equal=equal, diff=diff,
+                               only_left=only_left, only_right=only_right,
+                               errors=errors)
+
+
+def detect_renames(
+    result: DirResult,
+    dir_a: str,
+    dir_b: str,
+    hash_files: Callable[..., list[str]],
+    chunk_size: int,
+    max_workers: int,
+    follow_symlinks: bool = False,
+) -> DirResult:
+    """Pair ``only_left``/``only_right`` entries with identical content.
+
+    Candidates are grouped by size first (stat only, through links when
+    *follow_symlinks*); only sizes present on both sides are hashed. Only
+    regular files are candidates: unfollowed and dangling symlinks and
+    special files are never opened. Files
+    with equal (size, digest) are paired in sorted path order; unpaired
+    files stay in ``only_left``/``only_right``.
+    """
+    if not result.only_left or not result.only_right:
+        return result
+
+    def by_size(base: str, paths: set[str]) -> dict[int, list[str]]:
+        groups: dict[int, list[str]] = {}
+        for p in sorted(paths):
+            try:
+                full = os.path.join(base, p)
+                st = os.stat(full) if follow_symlinks else os.lstat(full)
+            except OSError:
+                continue  # removed since the walk, or a dangling link
+            if stat.S_ISREG(st.st_mode):
+                groups.setdefault(st.st_size, []).append(p)
+        return groups
+
+    sizes_a = by_size(dir_a, result.only_left)
+    sizes_b = by_size(dir_b, result.only_right)
+    common = sizes_a.keys() & sizes_b.keys()
+    if not common:
+        return result
+
+    cand_a = [p for s in sorted(common) for p in sizes_a[s]]
+    cand_b = [p for s in sorted(common) for p in sizes_b[s]]
+    kw = {"chunk_size": chunk_size, "max_workers": max_workers}
+    digests_b: dict[str, list[str]] = {}
+    for p, d in zip(cand_b, hash_files(dir_b, cand_b, **kw)):
+        digests_b.setdefault(d, []).append(p)
+
+    renamed: list[tuple[str, str]] = []
+    for p, d in zip(cand_a, hash_files(dir_a, cand_a, **kw)):
+        targets = digests_b.get(d)
+        if targets:
+            renamed.append((p, targets.pop(0)))
+    if not renamed:
+        return result
+
+    return dataclasses.replace(
+        result,
+        only_left=result.only_left - {a for a, _ in renamed},
+        only_right=result.only_right - {b for _, b in renamed},
+        renamed=sorted(result.renamed + renamed),
+    )
+
+
+def normalize_rename_map(rename_map: Mapping[str, str]) -> dict[str, str]:
+    """``rename_map`` with ``/`` separators on both sides.
+
+    :raises ValueError: If two paths map to the same target.
+    """
+    out: dict[str, str] = {}
+    seen: set[str] = set()
+    for a, b in slash_keys(rename_map, "rename_map").items():
+        b = b.replace("\\", "/")
+        if b in seen:
+            raise ValueError(f"rename_map: {b!r} is the target of more than one path")
+        seen.add(b)
+        out[a] = b
+    return out
+
+
+def apply_rename_map(
+    result: DirResult,
+    dir_a: str,
+    dir_b: str,
+    rename_map: dict[str, str],
+    compare_pair: Callable[[str, str], DiffReason | None],
+    compared: Callable[[set[str]], set[str]],
+) -> DirResult:
+    """Pair files across *rename_map* (A path -> B path) instead of by path.
+
+    Every path named in the map loses its same-path pairing: a mapped A
+    file is compared with its B target, while a B file at a mapped A path
+    (or an A file at a target path) is left unmatched. Equal pairs go to
+    ``renamed``, differing ones to ``diff`` under the A path; if one side
+    of a pair is missing, the other lands in ``only_left``/``only_right``.
+    *compare_pair* returns None for equal content, else the DiffReason; an
+    exception marks the pair READ_ERROR. Paths *compared* drops (depth,
+    ignore patterns) are left out.
+    """
+    targets = set(rename_map.values())
+    touched = compared(set(rename_map) | targets)
+    if not touched:
+        return result
+
+    def is_file(base: str, rel: str) -> bool:
+        return os.path.isfile(os.path.join(base, rel))
+
+    diff = {k: v for k, v in result.diff.items() if k not in touched}
+    only_left = result.only_left - touched
+    only_right = result.only_right - touched
+    renamed = list(result.renamed)
+    for a, b in rename_map.items():
+        if a not in touched or b not in touched:
+            continue
+        has_a, has_b = is_file(dir_a, a), is_file(dir_b, b)
+        if has_a and has_b:
+            try:
+                reason = compare_pair(os.path.join(dir_a, a), os.path.join(dir_b, b))
+            except Exception as e:
+                get_logger().info("rename_map: cannot compare %s -> %s: %s", a, b, e)
+                reason = DiffReason.READ_ERROR
+            if reason is None:
+                renamed.append((a, b))
+            else:
+                diff[a] = reason
+        elif has_a:
+            only_left.add(a)
+        elif has_b:
+            only_right.add(b)
+    for rel in touched:
+        if rel not in rename_map and is_file(dir_a, rel):
+            only_left.add(rel)
+        if rel not in targets and is_file(dir_b, rel):
+            only_right.add(rel)
+
+    renamed.sort()
+    return dataclasses.replace(
+        result,
+        equal=not (diff or only_left or only_right),
+        diff=diff,
+        only_left=only_left,
+        only_right=only_right,
+        renamed=renamed,
+    )
+
+
+def refilter_diff(
+    result: DirResult,
+    dir_a: str,
+    dir_b: str,
+    compare_pair: Callable[[str, str], bool],
+) -> DirResult:
+    """Re-compare content and size mismatches with *compare_pair*.
+
+    Pairs it reports equal are dropped from ``diff``. An exception from
+    it marks only that path as READ_ERROR and is logged; the rest of the
+    result is kept.
+    """
+    candidates = [
+        p for p, reason in result.diff.items()
+        if reason in (DiffReason.CONTENT_MISMATCH, DiffReason.SIZE_MISMATCH)
+    ]
+    if not candidates:
+        return result
+
+    diff = dict(result.diff)
+    for rel in candidates:
+        try:
+            if compare_pair(os.path.join(dir_a, rel), os.path.join(dir_b, rel)):
+                del diff[rel]
+        except Exception as e:
+            get_logger().info("content_filter failed for %s: %s", rel, e)
+            diff[rel] = DiffReason.READ_ERROR
+
+    return dataclasses.replace(
+        result,
+        equal=not (diff or result.only_left or result.only_right),
+        diff=diff,
+    )
+
+
+def flag_encoding_mismatch(
+    result: DirResult,
+    dir_a: str,
+    dir_b: str,
+    same_text: Callable[[str, str], bool],
+) -> DirResult:
+    """Re-label content and size mismatches that are an encoding change only.
+
+    Pairs *same_text* reports as holding the same text stay in ``diff``
+    as ENCODING_MISMATCH. A pair that cannot be read keeps its reason.
+    """
+    diff = dict(result.diff)
+    for rel, reason in result.diff.items():
+        if reason not in (DiffReason.CONTENT_MISMATCH, DiffReason.SIZE_MISMATCH):
+            continue
+        try:
+            if same_text(os.path.join(dir_a, rel), os.path.join(dir_b, rel)):
+                diff[rel] = DiffReason.ENCODING_MISMATCH
+        except OSError as e:
+            get_logger().info("detect_encoding_mismatch: cannot read %s: %s", rel, e)
+
+    if diff == result.diff:
+        return result
+    return dataclasses.replace(result, diff=diff)
+
+
+def _xattrs(path: str, follow_symlinks: bool) -> dict[str, bytes]:
+    try:
+        names = os.listxattr(path, follow_symlinks=follow_symlinks)
+    except OSError as e:
+        if e.errno in (errno.ENOTSUP, errno.EOPNOTSUPP):
+            return {}
+        raise
+    return {
+        name: os.getxattr(path, name, follow_symlinks=follow_symlinks)
+        for name in names
+    }
+
+
+_METADATA_REASONS = {
+    "mode": DiffReason.MODE_MISMATCH,
+    "mtime": DiffReason.MTIME_MISMATCH,
+    "uid": DiffReason.OWNER_MISMATCH,
+    "gid": DiffReason.OWNER_MISMATCH,
+    "xattr": DiffReason.XATTR_MISMATCH,
+}
+
+METADATA_REASONS = frozenset(_METADATA_REASONS.values())
+
+
+def metadata_reason(check: str) -> DiffReason:
+    """DiffReason reported for a failed ``metadata`` check."""
+    return _METADATA_REASONS[check]
+
+
+def metadata_diffs(
+    path_a: str,
+    path_b: str,
+    checks: Iterable[str],
+    mtime_tolerance: float,
+    follow_symlinks: bool,
+) -> list[str]:
+    """Names of the *checks* two files fail, in ``METADATA_CHECKS`` order.
+
+    ``mode`` compares permission bits (setuid, setgid and sticky too),
+    not the file type; ``mtime`` allows *mtime_tolerance* seconds of
+    drift; xattrs compare the full name → value mapping.
+    """
+    checks = set(checks)
+    sa = os.stat(path_a, follow_symlinks=follow_symlinks)
+    sb = os.stat(path_b, follow_symlinks=follow_symlinks)
+    tolerance_ns = round(mtime_tolerance * 1_000_000_000)
+    failed = []
+    for check in _METADATA_REASONS:
+        if check not in checks:
+            continue
+        if check == "mode":
+            differs = stat.S_IMODE(sa.st_mode) != stat.S_IMODE(sb.st_mode)
+        elif check == "mtime":
+            differs = abs(sa.st_mtime_ns - sb.st_mtime_ns) > tolerance_ns
+        elif check == "uid":
+            differs = sa.st_uid != sb.st_uid
+        elif check == "gid":
+            differs = sa.st_gid != sb.st_gid
+        else:
+            differs = _xattrs(path_a, follow_symlinks) != _xattrs(path_b, follow_symlinks)
+        if differs:
+            failed.append(check)
+    return failed
+
+
+def compare_metadata(
+    result: DirResult,
+    dir_a: str,
+    dir_b: str,
+    checks: Iterable[str],
+    mtime_tolerance: float,
+    follow_symlinks: bool,
+    max_depth: int | None,
+    ignore: list[str] | None,
+    keep: Callable[[str], bool] | None = None,
+) -> DirResult:
+    """Flag files with equal content but differing metadata.
+
+    Walks ``dir_a`` and, for every file present on both sides that is not
+    already in ``diff`` or ``errors``, runs :func:`metadata_diffs`. A
+    failed check is added to ``diff`` with its reason (the first one when
+    several fail); files whose metadata cannot be read (EACCES/EPERM) go
+    to ``errors``. A filesystem without xattr support counts as having
+    none.
+    """
+    checks = set(checks)
+    diff = dict(result.diff)
+    errors = set(result.errors)
+    skip = result.diff.keys() | result.errors | result.only_left
+
+    for root, dirs, files in os.walk(dir_a, followlinks=follow_symlinks):
+        rel_root = to_slash(os.path.relpath(root, dir_a))
+        prefix = "" if rel_root == "." else rel_root + "/"
+        if max_depth is not None and prefix.count("/") >= max_depth:
+            dirs.clear()
+        else:
+            if ignore:
+                dirs[:] = [d for d in dirs if not _path_matches_ignore(d, ignore)]
+            if keep is not None:
+                dirs[:] = [d for d in dirs if keep(prefix + d + "/")]
+        for name in files:
+            rel = prefix + name
+            if rel in skip or (ignore and _path_matches_ignore(rel, ignore)):
+                continue
+            if keep is not None and not keep(rel):
+                continue
+            path_b = os.path.join(dir_b, rel)
+            if not os.path.lexists(path_b):
+                continue
+            try:
+                failed = metadata_diffs(
+                    os.path.join(root, name), path_b, checks, mtime_tolerance,
+                    follow_symlinks,
+                )
+            except PermissionError:
+                errors.add(rel)
+                continue
+            if failed:
+                diff[rel] = _METADATA_REASONS[failed[0]]
+
+    if len(diff) == len(result.diff) and len(errors) == len(result.errors):
+        return result
+    return dataclasses.replace(
+        result,
+        equal=result.equal and len(diff) == len(result.diff),
+        diff=diff,
+        errors=errors,
+    )
+
+
+def load_known_diffs(path: str) -> dict[str, set[int]]:
+    """Parse a known-differences file into path -> allowed offsets.
+
+    One entry per line: a relative path, optionally followed by
+    whitespace and ``@<offset>`` to accept only a first difference at
+    that byte offset. An empty offset set accepts any difference.
+    Blank lines and lines starting with ``#`` are skipped; ``\\`` in a
+    path is read as ``/``.
+
+    :raises ValueError: On a malformed offset.
+    """
+    entries: dict[str, set[int]] = {}
+    with open(path, encoding="utf-8") as f:
+        for lineno, line in enumerate(f, 1):
+            line = line.strip()
+            if not line or line.startswith("#"):
+                continue
+            offset = None
+            head, _, tail = line.rpartition(" ")
+            if head and tail.startswith("@"):
+                try:
+                    offset = int(tail[1:])
+                except ValueError:
+                    raise ValueError(f"{path}:{lineno}: bad offset {tail!r}") from None
+                if offset < 0:
+                    raise ValueError(f"{path}:{lineno}: bad offset {tail!r}")
+                line = head.rstrip()
+            offsets = entries.setdefault(line.replace("\\", "/"), set())
+            if offset is not None:
+                offsets.add(offset)
+    return entries
+
+
+def apply_known_diffs(
+    result: DirResult,
+    dir_a: str,
+    dir_b: str,
+    known: dict[str, set[int]],
+    first_diff: Callable[[str, str], int],
+    compared: Callable[[set[str]], set[str]],
+) -> DirResult:
+    """Move allowlisted differences out of ``diff`` and flag stale entries.
+
+    A listed file in ``diff`` (other than READ_ERROR) moves to
+    ``expected_diffs``; with offsets, only if *first_diff* of the pair is
+    one of them. A listed file that is on both sides, not in ``diff``,
+    and that *compared* keeps (i.e. it was compared at all) is stale.
+    """
+    diff = dict(result.diff)
+    expected: dict[str, DiffReason] = {}
+    for rel, offsets in known.items():
+        reason = diff.get(rel)
+        if reason is None or reason is DiffReason.READ_ERROR:
+            continue
+        if offsets and first_diff(os.path.join(dir_a, rel), os.path.join(dir_b, rel)) not in offsets:
+            continue
+        expected[rel] = diff.pop(rel)
+
+    candidates = {
+        rel for rel in known
+        if rel not in result.diff and rel not in result.errors
+        and os.path.isfile(os.path.join(dir_a, rel))
+        and os.path.isfile(os.path.join(dir_b, rel))
+    }
+    stale = compared(candidates) if candidates else set()
+
+    return dataclasses.replace(
+        result,
+        equal=not (diff or result.only_left or result.only_right),
+        diff=diff,
+        expected_diffs=expected,
+        stale_known_diffs=stale,
+    )
 
 
 def build_dir_result(raw: dict) -> DirResult:
     """Convert C extension dict to DirResult."""
-    diff = {k: DiffReason(v) for k, v in raw["diff"].items()}
+    diff = {to_slash(k): DiffReason(v) for k, v in raw["diff"].items()}
     return DirResult(
         equal=raw["equal"],
         diff=diff,
-        only_left=raw["only_left"],
-        only_right=raw["only_right"],
-        errors=raw.get("errors", set()),
+        only_left={to_slash(p) for p in raw["only_left"]},
+        only_right={to_slash(p) for p in raw["only_right"]},
+        errors={to_slash(p) for p in raw.get("errors", set())},
     )
@@ -0,0 +1,160 @@
+"""Structural JSON comparison with ignored JSONPath locations."""
+
+from __future__ import annotations
+
+import json
+import re
+from typing import Any, NamedTuple
+
+from komparu._types import DecodeError
+from komparu._validate import validate_path
+
+_STEP = re.compile(
+    r"""\.\.(?P<desc>\*|[^.\[]+)"""
+    r"""|\.(?P<key>\*|[^.\[]+)"""
+    r"""|\[(?:(?P<star>\*)|(?P<index>-?\d+)|'(?P<sq>[^']*)'|"(?P<dq>[^"]*)")\]"""
+)
+
+
+class _Step(NamedTuple):
+    kind: str  # "key", "index", "any" or "desc"
+    value: Any = None  # key name, list index, or desc key (None = every child)
+
+
+def _parse_path(path: str) -> list[_Step]:
+    """Split a JSONPath such as ``$.items[*].id`` into steps."""
+    if not isinstance(path, str) or not path.startswith("$"):
+        raise ValueError(f"invalid JSON path {path!r}: must start with '$'")
+    steps: list[_Step] = []
+    pos = 1
+    while pos < len(path):
+        m = _STEP.match(path, pos)
+        if m is None:
+            raise ValueError(f"invalid JSON path {path!r} at offset {pos}")
+        if m["desc"] is not None:
+            steps.append(_Step("desc", None if m["desc"] == "*" else m["desc"]))
+        elif m["key"] == "*" or m["star"] is not None:
+            steps.append(_Step("any"))
+        elif m["key"] is not None:
+            steps.append(_Step("key", m["key"]))
+        elif m["index"] is not None:
+            steps.append(_Step("index", int(m["index"])))
+        else:
+            steps.append(_Step("key", m["sq"] if m["sq"] is not None else m["dq"]))
+        pos = m.end()
+    if not steps:
+        raise ValueError(f"invalid JSON path {path!r}: '$' alone would ignore everything")
+    return steps
+
+
+def _select(node: Any, step: _Step) -> list[Any]:
+    """Keys or indices of the children of *node* that *step* matches."""
+    if isinstance(node, dict):
+        if step.kind == "any" or step.kind == "desc" and step.value is None:
+            return list(node)
+        if step.kind in ("key", "desc") and step.value in node:
+            return [step.value]
+    elif isinstance(node, list):
+        if step.kind == "any" or step.kind == "desc" and step.value is None:
+            return list(range(len(node)))
+        if step.kind == "index" and -len(node) <= step.value < len(node):
+            return [step.value % len(node)]
+    return []
+
+
+def _containers(node: Any) -> list[Any]:
+    """*node* and every dict or list below it."""
+    found, pending = [], [node]
+    while pending:
+        current = pending.pop()
+        if isinstance(current, dict):
+            found.append(current)
+            pending.extend(current.values())
+        elif isinstance(current, list):
+            found.append(current)
+            pending.extend(current)
+    return found
+
+
+def _strip(node: Any, steps: list[_Step]) -> None:
+    """Delete everything *steps* matches below *node*, in place."""
+    step, rest = steps[0], steps[1:]
+    parents = _containers(node) if step.kind == "desc" else [node]
+    for parent in parents:
+        keys = _select(parent, step)
+        if rest:
+            for key in keys:
+                _strip(parent[key], rest)
+        elif isinstance(parent, list):
+            for key in sorted(keys, reverse=True):
+                del parent[key]
+        else:
+            for key in keys:
+                del parent[key]
+
+
+def _equal(a: Any, b: Any) -> bool:
+    # true/false are not the numbers 1/0, though Python's == says so
+    if isinstance(a, bool) or isinstance(b, bool):
+        return type(a) is type(b) and a == b
+    if isinstance(a, dict):
+        return (isinstance(b, dict) and a.keys() == b.keys()
+                and all(_equal(v, b[k]) for k, v in a.items()))
+    if isinstance(a, list):
+        return (isinstance(b, list) and len(a) == len(b)
+                and all(_equal(x, y) for x, y in zip(a, b)))
+    if isinstance(a, (int, float)):
+        return isinstance(b, (int, float)) and a == b
+    return type(a) is type(b) and a == b
+
+
+def _load(path: str) -> Any:
+    with open(path, "rb") as f:
+        data = f.read()
+    try:
+        return json.loads(data)
+    except UnicodeDecodeError as e:
+        raise DecodeError(f"{path}: not valid JSON text: {e.reason}") from None
+    except json.JSONDecodeError as e:
+        raise DecodeError(f"{path}: not valid JSON: {e}") from None
+
+
+def compare_json(
+    path_a: str,
+    path_b: str,
+    *,
+    ignore_paths: list[str] | None = None,
+) -> bool:
+    """Compare two JSON documents by value rather than by bytes.
+
+    Whitespace, object key order and number spelling (``1``, ``1.0``,
+    ``1e0``) do not matter; ``true`` and ``1`` still differ. Array order
+    does. Before comparing, every location matched by ``ignore_paths`` is
+    removed from both documents, so volatile fields such as timestamps
+    or request IDs do not count.
+
+    Paths use a JSONPath subset: ``$`` is the root, ``.name`` or
+    ``['name']`` an object member, ``[n]`` an array element (negative
+    counts from the end), ``.*`` or ``[*]`` every child, and ``..name``
+    (or ``..*``) a member at any depth. A path that matches nothing is
+    not an error.
+
+    Both files are parsed in full in memory. UTF-8, UTF-16 and UTF-32
+    are detected automatically.
+
+    :param path_a: Path to first JSON file.
+    :param path_b: Path to second JSON file.
+    :param ignore_paths: JSONPath expressions of locations to drop.
+    :returns: True if the documents are equal outside the ignored paths.
+    :raises DecodeError: If a file is not valid JSON.
+    :raises ValueError: If a path expression is invalid.
+    """
+    validate_path(path_a, "path_a")
+    validate_path(path_b, "path_b")
+    parsed = [_parse_path(p) for p in ignore_paths or ()]
+
+    doc_a, doc_b = _load(path_a), _load(path_b)
+    for steps in parsed:
+        _strip(doc_a, steps)
+        _strip(doc_b, steps)
+    return _equal(doc_a, doc_b)
@@ -0,0 +1,266 @@
+"""Hash manifests: sizes and digests of a tree, verified elsewhere later."""
+
+from __future__ import annotations
+
+import hashlib
+import importlib
+import json
+import os
+from collections.abc import Callable
+from typing import Any, TextIO
+
+from komparu._helpers import slash_keys
+from komparu._snapshot import _hash, _scan, _under
+from komparu._types import DiffReason, DirResult, Manifest, ManifestEntry
+from komparu._validate import validate_chunk_size, validate_max_workers, validate_path
+
+_FORMAT = "komparu-manifest"
+_VERSION = 1
+
+HashFactory = Callable[[], Any]  # hashlib-style object: update(bytes), hexdigest()
+
+_hashes: dict[str, HashFactory] = {
+    "sha256": hashlib.sha256,  # hashed natively, not through hashlib
+    "sha512": hashlib.sha512,
+    "blake2b": hashlib.blake2b,
+}
+
+# Third-party hashes, imported on first use: name -> (module, attribute)
+_OPTIONAL = {
+    "blake3": ("blake3", "blake3"),
+    "xxh64": ("xxhash", "xxh64"),
+    "xxh3_128": ("xxhash", "xxh3_128"),
+}
+
+
+def register_hash(name: str, factory: HashFactory) -> None:
+    """Register a hash algorithm for :func:`manifest_dir`.
+
+    *factory* is called once per file and must return an object with
+    ``update(bytes)`` and ``hexdigest()``, as :mod:`hashlib` constructors
+    do. Re-registering a name replaces it, built-in ones included.
+
+    :param name: Algorithm name stored in the manifest.
+    :param factory: Returns a fresh hash object.
+    :raises ValueError: If name is empty.
+    :raises TypeError: If factory is not callable.
+    """
+    if not isinstance(name, str) or not name:
+        raise ValueError("name must be a non-empty string")
+    if not callable(factory):
+        raise TypeError("factory must be callable")
+    _hashes[name] = factory
+
+
+def _factory(algorithm: str) -> HashFactory | None:
+    """Hash constructor for *algorithm*; None selects the native SHA-256."""
+    factory = _hashes.get(algorithm)
+    if factory is None and algorithm in _OPTIONAL:
+        module, attr = _OPTIONAL[algorithm]
+        try:
+            factory = getattr(importlib.import_module(module), attr)
+        except ImportError:
+            raise ValueError(f"algorithm {algorithm!r} needs the {module!r} package") from None
+        _hashes[algorithm] = factory
+    if factory is None:
+        known = ", ".join(sorted(_hashes.keys() | _OPTIONAL.keys()))
+        raise ValueError(f"unknown hash algorithm {algorithm!r} (known: {known})")
+    return None if factory is hashlib.sha256 else factory
+
+
+def _hash_file(path: str, factory: HashFactory, chunk_size: int) -> str:
+    h = factory()
+    with open(path, "rb") as f:
+        while chunk := f.read(chunk_size):
+            h.update(chunk)
+    return h.hexdigest().lower()
+
+
+def _digests(
+    directory: str, paths: list[str], factory: HashFactory | None,
+    chunk_size: int, max_workers: int,
+) -> dict[str, str]:
+    if factory is None:
+        return _hash(directory, paths, chunk_size, max_workers)
+
+    def one(rel: str) -> str:
+        return _hash_file(os.path.join(directory, rel), factory, chunk_size)
+
+    if max_workers == 1 or len(paths) < 2:
+        return {p: one(p) for p in paths}
+
+    from concurrent.futures import ThreadPoolExecutor
+
+    # hashlib releases the GIL while hashing large chunks
+    pool_size = max_workers if max_workers > 0 else min(len(paths), 8)
+    with ThreadPoolExecutor(max_workers=pool_size) as pool:
+        return dict(zip(paths, pool.map(one, paths)))
+
+
+def manifest_dir(
+    directory: str,
+    *,
+    algorithm: str = "sha256",
+    chunk_size: int = 65536,
+    follow_symlinks: bool = True,
+    max_workers: int = 0,
+) -> Manifest:
+    """Record the size and digest of every regular file of *directory*.
+
+    Write the result with :func:`write_manifest`, move the file to
+    another machine, and check a tree there with :func:`verify_manifest`;
+    only digests travel, never content. SHA-256 is hashed natively on a
+    C thread pool with the GIL released; ``sha512``, ``blake2b``,
+    ``blake3`` (needs the ``blake3`` package), ``xxh64`` and ``xxh3_128``
+    (need ``xxhash``) and names added with :func:`register_hash` go
+    through their Python objects on a thread pool.
+
+    :param directory: Tree to hash.
+    :param algorithm: Hash algorithm name.
+    :param chunk_size: Read chunk size in bytes.
+    :param follow_symlinks: Follow symbolic links during traversal.
+    :param max_workers: Hashing thread pool size (0=auto, 1=sequential).
+    :returns: Manifest with ``/``-separated relative paths.
+    :raises ValueError: If the algorithm is unknown or its package is
+        not installed.
+    :raises NotADirectoryError: If directory is not a directory.
+    :raises PermissionError: If a file or directory cannot be read; a
+        manifest that silently lacked it would not verify elsewhere.
+    :raises OSError: If a file cannot be read.
+    """
+    validate_path(directory, "directory")
+    validate_chunk_size(chunk_size)
+    validate_max_workers(max_workers)
+    factory = _factory(algorithm)
+
+    files, errors = _scan(directory, follow_symlinks)
+    if errors:
+        raise PermissionError(f"cannot read {min(errors)!r} in {directory!r}")
+    digests = _digests(directory, sorted(files), factory, chunk_size, max_workers)
+    return Manifest(
+        algorithm=algorithm,
+        files={p: ManifestEntry(files[p][0], digests[p]) for p in sorted(files)},
+    )
+
+
+def write_manifest(manifest: Manifest, out: TextIO) -> None:
+    """Write a :class:`Manifest` to *out* as JSON.
+
+    The document holds ``format``, ``version``, ``algorithm`` and a
+    ``files`` list of ``{"path", "size", "digest"}`` objects sorted by
+    path. :func:`load_manifest` reads it back.
+
+    :param manifest: Manifest to write.
+    :param out: Text stream to write to.
+    """
+    doc = {
+        "format": _FORMAT,
+        "version": _VERSION,
+        "algorithm": manifest.algorithm,
+        "files": [
+            {"path": p, "size": manifest.files[p].size, "digest": manifest.files[p].digest}
+            for p in sorted(manifest.files)
+        ],
+    }
+    json.dump(doc, out, indent=1)
+    out.write("\n")
+
+
+def load_manifest(path: str) -> Manifest:
+    """Read a manifest written by :func:`write_manifest`.
+
+    Paths written with ``\\`` separators (on Windows) are read as ``/``;
+    hex digests are lowercased.
+
+    :param path: Manifest file.
+    :returns: The Manifest.
+    :raises FileNotFoundError: If the file does not exist.
+    :raises ValueError: If the file is not a komparu manifest.
+    """
+    validate_path(path, "path")
+    with open(path, encoding="utf-8") as f:
+        try:
+            doc = json.load(f)
+        except json.JSONDecodeError as e:
+            raise ValueError(f"{path}: not a manifest ({e})") from None
+    if not isinstance(doc, dict) or doc.get("format") != _FORMAT:
+        raise ValueError(f"{path}: not a manifest")
+    if doc.get("version") != _VERSION:
+        raise ValueError(f"{path}: unsupported manifest version {doc.get('version')!r}")
+    try:
+        algorithm = str(doc["algorithm"])
+        files = {
+            str(e["path"]): ManifestEntry(int(e["size"]), str(e["digest"]).lower())
+            for e in doc["files"]
+        }
+    except (KeyError, TypeError, ValueError, AttributeError):
+        raise ValueError(f"{path}: malformed manifest") from None
+    if len(files) != len(doc["files"]):
+        raise ValueError(f"{path}: duplicate paths in manifest")
+    return Manifest(algorithm=algorithm, files=slash_keys(files, path))
+
+
+def verify_manifest(
+    directory: str,
+    manifest: str | Manifest,
+    *,
+    chunk_size: int = 65536,
+    follow_symlinks: bool = True,
+    max_workers: int = 0,
+) -> DirResult:
+    """Check *directory* against a manifest built on this or another machine.
+
+    Files whose size differs from the manifest are reported without
+    being read; the rest are hashed with the manifest's algorithm and
+    their digests compared.
+
+    :param directory: Tree to check.
+    :param manifest: A Manifest, or the path of a manifest file.
+    :param chunk_size: Read chunk size in bytes.
+    :param follow_symlinks: Follow symbolic links during traversal.
+    :param max_workers: Hashing thread pool size (0=auto, 1=sequential).
+    :returns: DirResult with the manifest as the first side:
+        ``only_left`` holds files missing from the tree, ``only_right``
+        files the manifest lacks, and ``diff`` differing ones
+        (SIZE_MISMATCH or CONTENT_MISMATCH). ``errors`` lists paths that
+        could not be stat'd.
+    :raises ValueError: If the manifest is invalid or its algorithm is
+        not available here.
+    :raises NotADirectoryError: If directory is not a directory.
+    :raises OSError: If a file cannot be read.
+    """
+    validate_path(directory, "directory")
+    validate_chunk_size(chunk_size)
+    validate_max_workers(max_workers)
+    if isinstance(manifest, str):
+        manifest = load_manifest(manifest)
+    elif not isinstance(manifest, Manifest):
+        raise TypeError(f"manifest must be a Manifest or a path, got {type(manifest).__name__}")
+    factory = _factory(manifest.algorithm)
+
+    files, errors = _scan(directory, follow_symlinks)
+    expected = manifest.files
+    diff: dict[str, DiffReason] = {}
+    same_size = []
+    for p, (size, _mtime) in files.items():
+        entry = expected.get(p)
+        if entry is None:
+            continue
+        if size != entry.size:
+            diff[p] = DiffReason.SIZE_MISMATCH
+        else:
+            same_size.append(p)
+    digests = _digests(directory, sorted(same_size), factory, chunk_size, max_workers)
+    for p, digest in digests.items():
+        if digest != expected[p].digest:
+            diff[p] = DiffReason.CONTENT_MISMATCH
+
+    only_left = {p for p in expected if p not in files and not _under(p, errors)}
+    only_right = {p for p in files if p not in expected}
+    return DirResult(
+        equal=not (diff or only_left or only_right or errors),
+        diff=diff,
+        only_left=only_left,
+        only_right=only_right,
+        errors=errors,
+    )
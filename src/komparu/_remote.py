@@ -0,0 +1,422 @@
+"""Remote trees: compare against a directory on another host by digests.
+
+``komparu serve DIR`` is a small agent speaking JSON lines on stdin and
+stdout, one reply per request, so any byte pipe carries it; RemoteTree
+starts one over ``ssh`` by default. Only listings, digests and block
+checksums cross the wire, never file content:
+
+* ``{"op": "hello", "version": 1}`` → ``{"ok": true, "version": 1, "root": ...}``
+* ``{"op": "list", "follow_symlinks", "exclude", "include"}`` →
+  ``{"files": {path: size}, "errors": [path, ...]}``
+* ``{"op": "digests", "paths": [...], "chunk_size"}`` → ``{"digests": {path: sha256}}``
+* ``{"op": "blocks", "path", "block_size"}`` →
+  ``{"blocks": [[offset, length, weak, sha256], ...]}``
+* ``{"op": "bye"}`` → ``{"ok": true}``, and the agent exits
+
+A failed request is answered with ``{"ok": false, "error": message}``
+and the agent keeps serving.
+"""
+
+from __future__ import annotations
+
+import json
+import os
+import shlex
+import subprocess
+import sys
+import threading
+from collections.abc import Sequence
+from types import TracebackType
+from typing import Any, BinaryIO
+
+from komparu._api import block_checksums
+from komparu._cache import DigestCache, open_cache
+from komparu._cancel import CancelToken
+from komparu._helpers import walk_filter
+from komparu._snapshot import _hash, _scan, _under
+from komparu._types import BlockSum, DiffReason, DirResult, KomparuError, SourceReadError
+from komparu._validate import validate_chunk_size, validate_path, validate_patterns
+
+_VERSION = 1
+_BATCH = 1000  # paths per digests request
+
+
+def _inside(root: str, rel: str) -> str | None:
+    """Absolute path of *rel* under *root* (a real path), or None if its
+    symlinks resolve outside it.
+
+    :raises ValueError: If *rel* is absolute or climbs with ``..``.
+    """
+    if not isinstance(rel, str) or not rel or rel.startswith("/") or ".." in rel.split("/"):
+        raise ValueError(f"path outside the served tree: {rel!r}")
+    path = os.path.realpath(os.path.join(root, rel))
+    return path if os.path.commonpath([root, path]) == root else None
+
+
+def _listing(
+    directory: str, follow_symlinks: bool,
+    exclude: list[str] | None, include: list[str] | None,
+) -> tuple[dict[str, int], set[str]]:
+    """Sizes of the regular files of a tree that pass the filters, and
+    unreadable paths."""
+    keep = walk_filter(exclude, include)
+    files, errors = _scan(directory, follow_symlinks)
+    sizes = {p: s[0] for p, s in files.items() if keep is None or keep(p)}
+    if keep is not None:
+        errors = {p for p in errors if keep(p + "/")}
+    return sizes, errors
+
+
+class _Agent:
+    """Request handlers of ``komparu serve``."""
+
+    def __init__(self, root: str, cache: DigestCache | None) -> None:
+        self._root = root
+        self._real = os.path.realpath(root)
+        self._cache = cache
+
+    def op_hello(self, request: dict) -> dict:
+        return {"version": _VERSION, "root": self._root}
+
+    def op_list(self, request: dict) -> dict:
+        exclude, include = request.get("exclude"), request.get("include")
+        validate_patterns(exclude, "exclude")
+        validate_patterns(include, "include")
+        files, errors = _listing(self._root, bool(request.get("follow_symlinks", True)),
+                                 exclude, include)
+        return {"files": files, "errors": sorted(errors)}
+
+    def op_digests(self, request: dict) -> dict:
+        paths = list(request["paths"])
+        chunk_size = int(request.get("chunk_size", 65536))
+        validate_chunk_size(chunk_size)
+        # A link out of the tree is refused on its own; the client reads
+        # a missing digest as READ_ERROR
+        refused = {p for p in paths if _inside(self._real, p) is None}
+        paths = [p for p in paths if p not in refused]
+        if self._cache is not None:
+            digests = self._cache.digests(self._root, paths, chunk_size=chunk_size)
+        else:
+            digests = _hash(self._root, paths, chunk_size, 0)
+        return {"digests": digests, "refused": sorted(refused)}
+
+    def op_blocks(self, request: dict) -> dict:
+        path = _inside(self._real, request["path"])
+        if path is None:
+            raise ValueError(f"path outside the served tree: {request['path']!r}")
+        blocks = block_checksums(path, int(request["block_size"]))
+        return {"blocks": [[b.offset, b.length, b.weak, b.strong.hex()] for b in blocks]}
+
+    def op_bye(self, request: dict) -> dict:
+        return {}
+
+
+def serve_tree(
+    directory: str,
+    *,
+    stdin: BinaryIO | None = None,
+    stdout: BinaryIO | None = None,
+    cache: str | DigestCache | None = None,
+) -> None:
+    """Answer RemoteTree requests about *directory* until ``bye`` or EOF.
+
+    This is ``komparu serve DIR``: run it at the far end of a pipe, such
+    as ``ssh host komparu serve DIR``. Paths in requests are relative
+    to *directory*; any that would leave it are refused, and so are
+    paths whose symlinks resolve outside it.
+
+    :param directory: Tree to serve.
+    :param stdin: Binary stream to read requests from (default: stdin).
+    :param stdout: Binary stream to write replies to (default: stdout).
+    :param cache: A DigestCache, or the directory of one, for the digests
+        of this side.
+    :raises NotADirectoryError: If directory is not a directory.
+    """
+    validate_path(directory, "directory")
+    if not os.path.isdir(directory):
+        raise NotADirectoryError(f"not a directory: {directory!r}")
+    stdin = sys.stdin.buffer if stdin is None else stdin
+    stdout = sys.stdout.buffer if stdout is None else stdout
+    digest_cache, owned = open_cache(cache) if cache is not None else (None, False)
+    agent = _Agent(os.path.abspath(directory), digest_cache)
+    try:
+        for line in stdin:
+            op = None
+            try:
+                request = json.loads(line)
+                op = request["op"]
+                handler = getattr(agent, f"op_{op}", None)
+                if handler is None:
+                    raise ValueError(f"unknown op {op!r}")
+                reply: dict[str, Any] = {"ok": True, **handler(request)}
+            except (KeyError, TypeError, ValueError) as e:
+                reply = {"ok": False, "error": f"bad request: {e}"}
+            except (OSError, KomparuError) as e:
+                reply = {"ok": False, "error": str(e)}
+            stdout.write(json.dumps(reply).encode() + b"\n")
+            stdout.flush()
+            if op == "bye":
+                break
+    finally:
+        if owned:
+            digest_cache.close()
+
+
+def _ssh_argv(remote: str, ssh: str, agent: str) -> list[str]:
+    host, sep, path = remote.partition(":")
+    if not sep or not host:
+        raise ValueError(f"remote must be host:path, got {remote!r}")
+    # ssh hands its arguments to the remote shell as one command line
+    return [*shlex.split(ssh), host, f"{agent} serve {shlex.quote(path or '.')}"]
+
+
+class RemoteTree:
+    """A directory on another host, reached through ``komparu serve``.
+
+    *remote* is ``[user@]host:path``, run as ``ssh host komparu serve
+    path``, or the argv of any command that starts an agent speaking the
+    protocol on its stdin and stdout (``docker exec -i ...``). Use it as
+    a context manager, or call :meth:`close`.
+
+    :param remote: ``host:path``, or an agent command line.
+    :param ssh: SSH command for a ``host:path`` remote, split like a shell.
+    :param agent: Command that runs komparu on the remote host.
+    :raises ValueError: If *remote* is a string without ``host:``.
+    :raises SourceReadError: If the agent cannot be started or does not
+        answer.
+    """
+
+    def __init__(self, remote: str | Sequence[str], *, ssh: str = "ssh",
+                 agent: str = "komparu") -> None:
+        argv = _ssh_argv(remote, ssh, agent) if isinstance(remote, str) else list(remote)
+        try:
+            self._proc = subprocess.Popen(argv, stdin=subprocess.PIPE, stdout=subprocess.PIPE)
+        except OSError as e:
+            raise SourceReadError(f"cannot start {argv[0]!r}: {e.strerror}") from None
+        try:
+            hello = self._call("hello", version=_VERSION)
+            if hello.get("version") != _VERSION:
+                raise SourceReadError(f"remote agent speaks protocol version "
+                                      f"{hello.get('version')!r}, expected {_VERSION}")
+        except BaseException:
+            self._kill()
+            raise
+        self.root: str = hello["root"]
+
+    def _call(self, op: str, **fields: Any) -> dict:
+        try:
+            self._proc.stdin.write(json.dumps({"op": op, **fields}).encode() + b"\n")
+            self._proc.stdin.flush()
+        except (BrokenPipeError, ValueError):
+            pass  # the agent is gone; reading says how it ended
+        return self._reply()
+
+    def _reply(self) -> dict:
+        try:
+            line = self._proc.stdout.readline()
+        except ValueError:
+            line = b""
+        if not line:
+            status = self._proc.wait()
+            raise SourceReadError(f"remote agent exited with status {status}")
+        try:
+            reply = json.loads(line)
+        except ValueError:
+            raise SourceReadError("remote agent sent a malformed reply") from None
+        if not reply.get("ok"):
+            raise SourceReadError(f"remote: {reply.get('error')}")
+        return reply
+
+    def files(
+        self, *, follow_symlinks: bool = True,
+        exclude: list[str] | None = None, include: list[str] | None = None,
+    ) -> tuple[dict[str, int], set[str]]:
+        """Sizes of the remote regular files, and unreadable remote paths."""
+        reply = self._call("list", follow_symlinks=follow_symlinks,
+                           exclude=exclude, include=include)
+        return reply["files"], set(reply["errors"])
+
+    def digests(self, paths: Sequence[str], *, chunk_size: int = 65536,
+                cancel: CancelToken | None = None) -> dict[str, str]:
+        """SHA-256 of remote files, hashed on the remote host."""
+        result: dict[str, str] = {}
+        paths = list(paths)
+        for i in range(0, len(paths), _BATCH):
+            if cancel is not None:
+                cancel.raise_if_cancelled()
+            result.update(self._call("digests", paths=paths[i:i + _BATCH],
+                                     chunk_size=chunk_size)["digests"])
+        return result
+
+    def block_checksums(self, path: str, block_size: int) -> list[BlockSum]:
+        """:func:`block_checksums` of a remote file."""
+        blocks = self._call("blocks", path=path, block_size=block_size)["blocks"]
+        return [BlockSum(o, n, w, bytes.fromhex(s)) for o, n, w, s in blocks]
+
+    def compare(
+        self,
+        directory: str,
+        *,
+        chunk_size: int = 65536,
+        follow_symlinks: bool = True,
+        max_workers: int = 0,
+        exclude: list[str] | None = None,
+        include: list[str] | None = None,
+        cache: str | DigestCache | None = None,
+        cancel: CancelToken | None = None,
+    ) -> DirResult:
+        """Compare a local directory (first side) with the remote tree.
+
+        Sizes are exchanged first; files whose sizes match are hashed
+        with SHA-256 on each host, concurrently, and only the digests
+        are sent.
+
+        :param directory: Local tree.
+        :param chunk_size: Read chunk size in bytes, on both hosts.
+        :param follow_symlinks: Follow symbolic links during traversal.
+        :param max_workers: Local hashing thread pool size (0=auto, 1=sequential).
+        :param exclude: Gitignore-style patterns of paths to leave out.
+        :param include: Gitignore-style patterns; only matching files are compared.
+        :param cache: A DigestCache, or the directory of one, for local digests.
+        :param cancel: Token checked between requests.
+        :returns: DirResult; ``errors`` holds unreadable paths of either side.
+        :raises NotADirectoryError: If directory is not a directory.
+        :raises SourceReadError: If the agent fails or goes away.
+        """
+        validate_path(directory, "directory")
+        validate_chunk_size(chunk_size)
+        validate_patterns(exclude, "exclude")
+        validate_patterns(include, "include")
+        local, errors_a = _listing(directory, follow_symlinks, exclude, include)
+        remote, errors_b = self.files(follow_symlinks=follow_symlinks,
+                                      exclude=exclude, include=include)
+        common = local.keys() & remote.keys()
+        diff = {p: DiffReason.SIZE_MISMATCH for p in common if local[p] != remote[p]}
+        same_size = sorted(common - diff.keys())
+
+        # The agent hashes its side while this one hashes locally
+        outcome: dict = {}
+
+        def fetch() -> None:
+            try:
+                outcome["digests"] = self.digests(same_size, chunk_size=chunk_size, cancel=cancel)
+            except BaseException as e:  # re-raised on the calling thread
+                outcome["error"] = e
+
+        worker = threading.Thread(target=fetch, name="komparu-remote", daemon=True)
+        worker.start()
+        digest_cache, owned = open_cache(cache) if cache is not None else (None, False)
+        try:
+            if digest_cache is not None:
+                digests_a = digest_cache.digests(directory, same_size, chunk_size=chunk_size,
+                                                 follow_symlinks=follow_symlinks,
+                                                 max_workers=max_workers)
+            else:
+                digests_a = _hash(directory, same_size, chunk_size, max_workers)
+        finally:
+            if owned:
+                digest_cache.close()
+            worker.join()
+        if "error" in outcome:
+            raise outcome["error"]
+        digests_b = outcome["digests"]
+        for p in same_size:
+            a, b = digests_a.get(p), digests_b.get(p)
+            if a is None or b is None:
+                diff[p] = DiffReason.READ_ERROR
+            elif a != b:
+                diff[p] = DiffReason.CONTENT_MISMATCH
+
+        errors = errors_a | errors_b
+        only_left = {p for p in local.keys() - remote.keys() if not _under(p, errors_b)}
+        only_right = {p for p in remote.keys() - local.keys() if not _under(p, errors_a)}
+        return DirResult(
+            equal=not (diff or only_left or only_right or errors),
+            diff={p: diff[p] for p in sorted(diff)},
+            only_left=only_left,
+            only_right=only_right,
+            errors=errors,
+        )
+
+    def diff_ranges(self, local_path: str, path: str, *,
+                    block_size: int = 65536) -> list[tuple[int, int]]:
+        """Byte ranges where a local file and a remote one differ.
+
+        Both sides send per-block rolling checksums and SHA-256 digests
+        (:func:`block_checksums`); a block whose digests differ, or
+        that only one file has, is reported. Adjacent blocks are merged.
+
+        :param local_path: Local file.
+        :param path: Remote file, relative to the served tree.
+        :param block_size: Block size in bytes; the ranges are this coarse.
+        :returns: ``(start, end)`` pairs, end exclusive, in file order;
+            empty if the files are equal.
+        """
+        local = block_checksums(local_path, block_size)
+        remote = self.block_checksums(path, block_size)
+        ranges: list[tuple[int, int]] = []
+        for i in range(max(len(local), len(remote))):
+            a = local[i] if i < len(local) else None
+            b = remote[i] if i < len(remote) else None
+            if a is not None and b is not None and (a.length, a.strong) == (b.length, b.strong):
+                continue
+            start = i * block_size
+            end = start + max(a.length if a else 0, b.length if b else 0)
+            if ranges and ranges[-1][1] == start:
+                ranges[-1] = (ranges[-1][0], end)
+            else:
+                ranges.append((start, end))
+        return ranges
+
+    def _kill(self) -> None:
+        if self._proc.poll() is None:
+            self._proc.kill()
+        self._proc.wait()
+
+    def close(self) -> None:
+        """Tell the agent to exit and wait for it."""
+        if self._proc.poll() is None:
+            try:
+                self._call("bye")
+            except SourceReadError:
+                pass
+            try:
+                self._proc.wait(timeout=5)
+            except subprocess.TimeoutExpired:
+                self._kill()
+        for stream in (self._proc.stdin, self._proc.stdout):
+            stream.close()
+
+    def __enter__(self) -> RemoteTree:
+        return self
+
+    def __exit__(
+        self,
+        exc_type: type[BaseException] | None,
+        exc: BaseException | None,
+        tb: TracebackType | None,
+    ) -> None:
+        self.close()
+
+
+def compare_remote(
+    directory: str,
+    remote: str | Sequence[str],
+    *,
+    ssh: str = "ssh",
+    agent: str = "komparu",
+    **options: Any,
+) -> DirResult:
+    """Compare a local directory with one on another host, by digests.
+
+    Opens a :class:`RemoteTree`, runs :meth:`RemoteTree.compare` with
+    *options* and closes it.
+
+    :param directory: Local tree (first side).
+    :param remote: ``host:path``, or an agent command line.
+    :param ssh: SSH command for a ``host:path`` remote.
+    :param agent: Command that runs komparu on the remote host.
+    :returns: DirResult, as :meth:`RemoteTree.compare`.
+    """
+    with RemoteTree(remote, ssh=ssh, agent=agent) as tree:
+        return tree.compare(directory, **options)
@@ -0,0 +1,381 @@
+"""Machine-readable reports of a directory comparison (JSON, JUnit, SARIF, CI annotations)."""
+
+from __future__ import annotations
+
+import dataclasses
+import json
+import os
+import posixpath
+import re
+import urllib.parse
+import xml.etree.ElementTree as ET
+from collections.abc import Callable
+from pathlib import Path
+from typing import TextIO
+
+from komparu._types import (
+    DiffReason, DirReport, DirResult, EntryStatus, ReportEntry, ThreeWayResult,
+)
+
+ReportWriter = Callable[[DirResult | DirReport, TextIO], None]
+
+
+def _result_doc(result: DirResult) -> dict:
+    return {
+        "equal": result.equal,
+        "diff": {p: result.diff[p].value for p in sorted(result.diff)},
+        "only_left": sorted(result.only_left),
+        "only_right": sorted(result.only_right),
+        "errors": sorted(result.errors),
+        "renamed": [list(pair) for pair in result.renamed],
+        "expected_diffs": {
+            p: result.expected_diffs[p].value for p in sorted(result.expected_diffs)
+        },
+        "stale_known_diffs": sorted(result.stale_known_diffs),
+    }
+
+
+def _write_json(result: DirResult | DirReport, out: TextIO) -> None:
+    """Every DirResult field; a DirReport adds its directories, counts
+    and entries."""
+    if isinstance(result, DirReport):
+        doc = _result_doc(_as_result(result))
+        doc.update({
+            "dir_a": result.dir_a,
+            "dir_b": result.dir_b,
+            "counts": {s.value: n for s, n in result.counts.items()},
+            "entries": [_entry_dict(e) for e in result.entries],
+        })
+    else:
+        doc = _result_doc(result)
+    json.dump(doc, out, indent=2)
+    out.write("\n")
+
+
+def _escape_data(text: str) -> str:
+    return text.replace("%", "%25").replace("\r", "%0D").replace("\n", "%0A")
+
+
+def _escape_property(text: str) -> str:
+    return _escape_data(text).replace(":", "%3A").replace(",", "%2C")
+
+
+def _write_github(result: DirResult | DirReport, out: TextIO) -> None:
+    """GitHub Actions workflow commands, one annotation per entry."""
+    if isinstance(result, DirReport):
+        result = _as_result(result)
+
+    def emit(level: str, path: str, message: str) -> None:
+        out.write(f"::{level} file={_escape_property(path)}::{_escape_data(message)}\n")
+
+    for path in sorted(result.diff):
+        emit("error", path, f"differs ({result.diff[path].value})")
+    for path in sorted(result.only_left):
+        emit("error", path, "only in A")
+    for path in sorted(result.only_right):
+        emit("error", path, "only in B")
+    for path in sorted(result.errors):
+        emit("warning", path, "could not be read")
+    for path in sorted(result.expected_diffs):
+        emit("notice", path, f"known difference ({result.expected_diffs[path].value})")
+    for path in sorted(result.stale_known_diffs):
+        emit("notice", path, "listed in known_diffs but now equal")
+
+
+def _entry_dict(entry: ReportEntry) -> dict:
+    return {
+        "path": entry.path,
+        "status": entry.status.value,
+        "reason": entry.reason.value if entry.reason is not None else None,
+        "size_a": entry.size_a,
+        "size_b": entry.size_b,
+        "first_diff_offset": entry.first_diff_offset,
+        "metadata": list(entry.metadata),
+    }
+
+
+def _entry_message(entry: ReportEntry) -> str:
+    if entry.status is EntryStatus.DIFFERENT:
+        text = f"differs ({entry.reason.value})" if entry.reason else "differs"
+        if entry.first_diff_offset is not None:
+            text += f" at offset {entry.first_diff_offset}"
+        if len(entry.metadata) > 1:
+            text += f"; failed checks: {', '.join(entry.metadata)}"
+        return text
+    if entry.status is EntryStatus.ONLY_LEFT:
+        return "only in A"
+    if entry.status is EntryStatus.ONLY_RIGHT:
+        return "only in B"
+    if entry.status is EntryStatus.ERROR:
+        return "could not be read"
+    return "equal"
+
+
+def _entry_rule(entry: ReportEntry) -> str:
+    """SARIF rule id and JUnit failure type: the reason, else the status."""
+    return entry.reason.value if entry.reason is not None else entry.status.value
+
+
+_RULE_TEXT = {
+    EntryStatus.ONLY_LEFT.value: "Path exists only in the first directory",
+    EntryStatus.ONLY_RIGHT.value: "Path exists only in the second directory",
+    EntryStatus.ERROR.value: "Path could not be read",
+}
+
+
+def _size(size: int | None) -> str:
+    return "absent" if size is None else f"size {size}"
+
+
+# Characters XML 1.0 cannot hold, escaped or not; lone surrogates are
+# undecodable filename bytes (surrogateescape)
+_XML_INVALID = re.compile("[\x00-\x08\x0b\x0c\x0e-\x1f\ud800-\udfff\ufffe\uffff]")
+
+
+def _xml_char(match: re.Match[str]) -> str:
+    code = ord(match[0])
+    if code < 0x100:
+        return f"\\x{code:02x}"
+    if 0xdc80 <= code <= 0xdcff:
+        return f"\\x{code - 0xdc00:02x}"
+    return f"\\u{code:04x}"
+
+
+def _xml(text: str) -> str:
+    """*text* with the characters XML cannot hold written as ``\\xNN``."""
+    return _XML_INVALID.sub(_xml_char, text)
+
+
+def _write_junit(result: DirResult | DirReport, out: TextIO) -> None:
+    """One test case per path; differences fail, unreadable paths error."""
+    report = _as_report(result)
+    counts = report.counts
+    failures = (counts[EntryStatus.DIFFERENT] + counts[EntryStatus.ONLY_LEFT]
+                + counts[EntryStatus.ONLY_RIGHT])
+    totals = {"tests": str(len(report.entries)), "failures": str(failures),
+              "errors": str(counts[EntryStatus.ERROR])}
+    suites = ET.Element("testsuites", name="komparu", **totals)
+    name = f"{report.dir_a} vs {report.dir_b}" if report.dir_a or report.dir_b else "komparu"
+    suite = ET.SubElement(suites, "testsuite", name=_xml(name), skipped="0", **totals)
+    for entry in report.entries:
+        path = _xml(entry.path)
+        case = ET.SubElement(suite, "testcase", classname="komparu", name=path, file=path)
+        if entry.status is EntryStatus.EQUAL:
+            continue
+        tag = "error" if entry.status is EntryStatus.ERROR else "failure"
+        detail = ET.SubElement(case, tag, type=_entry_rule(entry),
+                               message=_xml(f"{entry.path}: {_entry_message(entry)}"))
+        detail.text = _xml(
+            f"{posixpath.join(report.dir_a, entry.path)}: {_size(entry.size_a)}\n"
+            f"{posixpath.join(report.dir_b, entry.path)}: {_size(entry.size_b)}\n")
+    ET.indent(suites)
+    out.write('<?xml version="1.0" encoding="UTF-8"?>\n')
+    out.write(ET.tostring(suites, encoding="unicode"))
+    out.write("\n")
+
+
+def _dir_uri(directory: str) -> str:
+    return Path(os.path.abspath(directory)).as_uri().rstrip("/") + "/"
+
+
+def _write_sarif(result: DirResult | DirReport, out: TextIO) -> None:
+    """SARIF 2.1.0: one result per path that is not equal."""
+    from komparu import __version__
+
+    report = _as_report(result)
+    based = bool(report.dir_a or report.dir_b)
+    rules: dict[str, dict] = {}
+    results = []
+    for entry in report.entries:
+        if entry.status is EntryStatus.EQUAL:
+            continue
+        rule = _entry_rule(entry)
+        text = _RULE_TEXT.get(rule, f"Files differ: {rule.replace('_', ' ')}")
+        rules.setdefault(rule, {"id": rule, "shortDescription": {"text": text}})
+        side = "DIR_A" if entry.status is EntryStatus.ONLY_LEFT else "DIR_B"
+        artifact = {"uri": urllib.parse.quote(entry.path)}
+        if based:
+            artifact["uriBaseId"] = side
+        location: dict = {"artifactLocation": artifact}
+        if entry.first_diff_offset is not None:
+            location["region"] = {"byteOffset": entry.first_diff_offset, "byteLength": 1}
+        results.append({
+            "ruleId": rule,
+            "level": "warning" if entry.status is EntryStatus.ERROR else "error",
+            "message": {"text": f"{entry.path}: {_entry_message(entry)}"},
+            "locations": [{"physicalLocation": location}],
+            "properties": {"status": entry.status.value, "size_a": entry.size_a,
+                           "size_b": entry.size_b, "metadata": list(entry.metadata)},
+        })
+    run: dict = {"tool": {"driver": {"name": "komparu", "version": __version__,
+                                     "rules": [rules[r] for r in sorted(rules)]}}}
+    if based:
+        run["originalUriBaseIds"] = {"DIR_A": {"uri": _dir_uri(report.dir_a)},
+                                     "DIR_B": {"uri": _dir_uri(report.dir_b)}}
+    run["results"] = results
+    doc = {
+        "$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+        "version": "2.1.0",
+        "runs": [run],
+    }
+    json.dump(doc, out, indent=2)
+    out.write("\n")
+
+
+def _write_ndjson(result: DirResult | DirReport, out: TextIO) -> None:
+    """One compact entry object per line and nothing else."""
+    for entry in _as_report(result).entries:
+        out.write(json.dumps(_entry_dict(entry), separators=(",", ":")))
+        out.write("\n")
+
+
+def _as_report(result: DirResult | DirReport) -> DirReport:
+    """*result* as a DirReport; a DirResult gives entries for the paths
+    that are not equal, without sizes or directories."""
+    if isinstance(result, DirReport):
+        return result
+    entries = [
+        ReportEntry(p, EntryStatus.ERROR if r is DiffReason.READ_ERROR else EntryStatus.DIFFERENT, r)
+        for p, r in result.diff.items()
+    ]
+    entries += [ReportEntry(p, EntryStatus.ONLY_LEFT) for p in result.only_left]
+    entries += [ReportEntry(p, EntryStatus.ONLY_RIGHT) for p in result.only_right]
+    entries += [ReportEntry(p, EntryStatus.ERROR) for p in result.errors]
+    entries.sort(key=lambda e: e.path)
+    return DirReport(dir_a="", dir_b="", equal=result.equal, entries=entries)
+
+
+def _as_result(report: DirReport) -> DirResult:
+    """The DirResult fields a DirReport carries."""
+    def having(status: EntryStatus) -> set[str]:
+        return {e.path for e in report.entries if e.status is status}
+
+    return DirResult(
+        equal=report.equal,
+        diff={e.path: e.reason for e in report.entries
+              if e.reason is not None and e.status is not EntryStatus.EQUAL},
+        only_left=having(EntryStatus.ONLY_LEFT),
+        only_right=having(EntryStatus.ONLY_RIGHT),
+        errors={e.path for e in report.entries
+                if e.status is EntryStatus.ERROR and e.reason is None},
+    )
+
+
+_formats: dict[str, ReportWriter] = {
+    "json": _write_json,
+    "ndjson": _write_ndjson,
+    "github": _write_github,
+    "junit": _write_junit,
+    "sarif": _write_sarif,
+}
+
+
+def report_formats() -> list[str]:
+    """Names :func:`write_report` accepts, registered ones included."""
+    return sorted(_formats)
+
+
+def register_report_format(name: str, fn: ReportWriter) -> None:
+    """Register a report format for :func:`write_report`.
+
+    *fn* receives the result and the output stream; the result is
+    whatever was passed to :func:`write_report`, a :class:`DirResult` or
+    a :class:`DirReport`. Re-registering a name replaces it, built-in
+    formats included.
+
+    :param name: Format name passed to :func:`write_report`.
+    :param fn: Writes *result* to *out*.
+    :raises ValueError: If name is empty.
+    :raises TypeError: If fn is not callable.
+    """
+    if not isinstance(name, str) or not name:
+        raise ValueError("name must be a non-empty string")
+    if not callable(fn):
+        raise TypeError("fn must be callable")
+    _formats[name] = fn
+
+
+def write_three_way_report(result: ThreeWayResult, format: str, out: TextIO) -> None:
+    """Write a :class:`ThreeWayResult` to *out* as ``"json"`` or ``"ndjson"``.
+
+    ``"json"`` is one object with ``clean``, per-status ``counts`` and the
+    ``entries`` list; ``"ndjson"`` writes one compact ``{"path", "status"}``
+    object per line and nothing else. Entries are sorted by path and
+    include unchanged paths.
+
+    :param result: Result of :func:`compare_three_way`.
+    :param format: ``"json"`` or ``"ndjson"``.
+    :param out: Text stream to write to.
+    :raises ValueError: If the format is unknown.
+    """
+    entries = [{"path": p, "status": result.files[p].value} for p in sorted(result.files)]
+    if format == "json":
+        doc = {
+            "clean": result.clean,
+            "counts": {s.value: n for s, n in result.counts.items()},
+            "entries": entries,
+        }
+        json.dump(doc, out, indent=2)
+        out.write("\n")
+    elif format == "ndjson":
+        for entry in entries:
+            out.write(json.dumps(entry, separators=(",", ":")))
+            out.write("\n")
+    else:
+        raise ValueError(f"unknown report format {format!r} (known: json, ndjson)")
+
+
+def _rebase(result: DirResult | DirReport, root: str) -> DirResult | DirReport:
+    def at(path: str) -> str:
+        return posixpath.join(root, path)
+
+    if isinstance(result, DirReport):
+        return dataclasses.replace(
+            result, entries=[dataclasses.replace(e, path=at(e.path)) for e in result.entries],
+        )
+    return DirResult(
+        equal=result.equal,
+        diff={at(p): r for p, r in result.diff.items()},
+        only_left={at(p) for p in result.only_left},
+        only_right={at(p) for p in result.only_right},
+        errors={at(p) for p in result.errors},
+        renamed=[(at(a), at(b)) for a, b in result.renamed],
+        expected_diffs={at(p): r for p, r in result.expected_diffs.items()},
+        stale_known_diffs={at(p) for p in result.stale_known_diffs},
+    )
+
+
+def write_report(
+    result: DirResult | DirReport,
+    format: str,
+    out: TextIO,
+    *,
+    root: str = "",
+) -> None:
+    """Write *result* to *out* in a registered format.
+
+    Built in: ``"json"`` (one object, sorted lists; a DirReport adds both
+    directories, per-status ``counts`` and the ``entries`` list),
+    ``"ndjson"`` (one compact entry object per line), ``"github"``
+    (``::error file=...::`` workflow commands, shown inline on pull
+    requests), ``"junit"`` (JUnit XML, one test case per path) and
+    ``"sarif"`` (SARIF 2.1.0, one result per path that is not equal).
+    Entry-based formats list only the paths that are not equal for a
+    DirResult, without sizes; pass the :func:`compare_dir_report` of the
+    same trees for every path. More can be added with
+    :func:`register_report_format`.
+
+    :param result: Result of :func:`compare_dir` or a sibling, or of
+        :func:`compare_dir_report`.
+    :param format: Registered format name.
+    :param out: Text stream to write to.
+    :param root: Prefix joined to every path, e.g. the compared
+        directory relative to the repository root for annotations.
+    :raises ValueError: If the format is not registered.
+    """
+    try:
+        writer = _formats[format]
+    except KeyError:
+        known = ", ".join(sorted(_formats))
+        raise ValueError(f"unknown report format {format!r} (known: {known})") from None
+    writer(_rebase(result, root.replace("\\", "/")) if root else result, out)
@@ -0,0 +1,252 @@
+"""Directory snapshots: a stored manifest and the changes since it was taken."""
+
+from __future__ import annotations
+
+import json
+import os
+import stat
+import tempfile
+import time
+
+from komparu._core import hash_files as _hash_files_c
+from komparu._types import DiffReason, DirResult
+from komparu._validate import validate_chunk_size, validate_max_workers, validate_path
+
+_FORMAT = "komparu-snapshot"
+_VERSION = 1
+
+# mtime granularity can be as coarse as 2 s (FAT); a file whose recorded
+# mtime is this close to the snapshot may have changed again unseen
+_RACY_NS = 2_000_000_000
+
+
+def _scan(
+    directory: str, follow_symlinks: bool, links: bool = False,
+    broken: set[str] | None = None,
+) -> tuple[dict[str, tuple[int, int]], set[str]]:
+    """``{path: (size, mtime_ns)}`` of every regular file (and, with
+    *links* and not following, every symlink), plus unreadable paths.
+
+    Each directory is entered once, by ``(st_dev, st_ino)``, so symlink
+    cycles end as in the C walker. With a *broken* set, dangling symlinks
+    are listed too (by their own lstat) and added to it.
+    """
+    if not os.path.isdir(directory):
+        raise NotADirectoryError(f"not a directory: {directory!r}")
+    files: dict[str, tuple[int, int]] = {}
+    errors: set[str] = set()
+    root = os.stat(directory)
+    visited = {(root.st_dev, root.st_ino)}
+    pending = [""]
+    while pending:
+        rel_dir = pending.pop()
+        try:
+            with os.scandir(os.path.join(directory, rel_dir) if rel_dir else directory) as it:
+                entries = list(it)
+        except FileNotFoundError:
+            continue  # removed during the scan
+        except OSError:
+            errors.add(rel_dir)
+            continue
+        for entry in entries:
+            rel = f"{rel_dir}/{entry.name}" if rel_dir else entry.name
+            try:
+                st = entry.stat(follow_symlinks=follow_symlinks)
+            except FileNotFoundError:
+                if broken is not None and entry.is_symlink():
+                    try:
+                        st = entry.stat(follow_symlinks=False)
+                    except OSError:
+                        continue
+                    files[rel] = (st.st_size, st.st_mtime_ns)
+                    broken.add(rel)
+                continue  # dangling symlink or removed during the scan
+            except OSError:
+                errors.add(rel)
+                continue
+            if broken is not None and stat.S_ISLNK(st.st_mode) and not os.path.exists(entry.path):
+                files[rel] = (st.st_size, st.st_mtime_ns)
+                broken.add(rel)
+            elif stat.S_ISDIR(st.st_mode):
+                if (st.st_dev, st.st_ino) in visited:
+                    continue
+                visited.add((st.st_dev, st.st_ino))
+                pending.append(rel)
+            elif stat.S_ISREG(st.st_mode) or links and stat.S_ISLNK(st.st_mode):
+                files[rel] = (st.st_size, st.st_mtime_ns)
+    return files, errors
+
+
+def _under(path: str, errors: set[str]) -> bool:
+    """True if *path* or a directory above it is in *errors*."""
+    parts = path.split("/")
+    return any("/".join(parts[:i]) in errors for i in range(1, len(parts) + 1))
+
+
+def _hash(directory: str, paths: list[str], chunk_size: int, max_workers: int) -> dict[str, str]:
+    if not paths:
+        return {}
+    digests = _hash_files_c(directory, paths, chunk_size=chunk_size, max_workers=max_workers)
+    return dict(zip(paths, digests))
+
+
+def _write(manifest_path: str, taken_ns: int, entries: dict[str, dict]) -> None:
+    doc = {
+        "format": _FORMAT,
+        "version": _VERSION,
+        "taken_ns": taken_ns,
+        "files": {p: entries[p] for p in sorted(entries)},
+    }
+    # Write next to the target and rename, so a crash never leaves half a manifest
+    parent = os.path.dirname(os.path.abspath(manifest_path))
+    fd, tmp = tempfile.mkstemp(prefix=".komparu-snapshot-", dir=parent)
+    try:
+        with os.fdopen(fd, "w", encoding="utf-8") as f:
+            json.dump(doc, f, indent=1)
+            f.write("\n")
+        os.replace(tmp, manifest_path)
+    except BaseException:
+        os.unlink(tmp)
+        raise
+
+
+def _read(manifest_path: str) -> tuple[int, dict[str, dict]]:
+    with open(manifest_path, encoding="utf-8") as f:
+        try:
+            doc = json.load(f)
+        except json.JSONDecodeError as e:
+            raise ValueError(f"{manifest_path}: not a snapshot manifest ({e})") from None
+    if not isinstance(doc, dict) or doc.get("format") != _FORMAT:
+        raise ValueError(f"{manifest_path}: not a snapshot manifest")
+    if doc.get("version") != _VERSION:
+        raise ValueError(f"{manifest_path}: unsupported snapshot version {doc.get('version')!r}")
+    try:
+        taken_ns = int(doc["taken_ns"])
+        files = {
+            str(p): {"size": int(e["size"]), "mtime_ns": int(e["mtime_ns"]),
+                     "sha256": str(e["sha256"])}
+            for p, e in doc["files"].items()
+        }
+    except (KeyError, TypeError, ValueError, AttributeError):
+        raise ValueError(f"{manifest_path}: malformed snapshot manifest") from None
+    return taken_ns, files
+
+
+def snapshot_dir(
+    directory: str,
+    manifest_path: str,
+    *,
+    chunk_size: int = 65536,
+    follow_symlinks: bool = True,
+    max_workers: int = 0,
+) -> dict[str, str]:
+    """Hash every regular file of *directory* and store a manifest.
+
+    The manifest records each file's size, mtime and SHA-256 as JSON at
+    *manifest_path*, replacing any previous one atomically. Pass it to
+    :func:`diff_since_snapshot` later to see what changed.
+
+    :param directory: Tree to snapshot.
+    :param manifest_path: Where to write the manifest.
+    :param chunk_size: Read chunk size in bytes.
+    :param follow_symlinks: Follow symbolic links during traversal.
+    :param max_workers: Hashing thread pool size (0=auto, 1=sequential).
+    :returns: Mapping of relative path -> lowercase hex digest, as
+        :func:`hash_dir`.
+    :raises NotADirectoryError: If directory is not a directory.
+    :raises OSError: If a file cannot be read or the manifest written.
+    """
+    validate_path(directory, "directory")
+    validate_path(manifest_path, "manifest_path")
+    validate_chunk_size(chunk_size)
+    validate_max_workers(max_workers)
+
+    taken_ns = time.time_ns()
+    files, _errors = _scan(directory, follow_symlinks)
+    digests = _hash(directory, sorted(files), chunk_size, max_workers)
+    _write(manifest_path, taken_ns, {
+        p: {"size": size, "mtime_ns": mtime, "sha256": digests[p]}
+        for p, (size, mtime) in files.items()
+    })
+    return digests
+
+
+def diff_since_snapshot(
+    directory: str,
+    manifest_path: str,
+    *,
+    update: bool = False,
+    chunk_size: int = 65536,
+    follow_symlinks: bool = True,
+    max_workers: int = 0,
+) -> DirResult:
+    """Report what changed in *directory* since :func:`snapshot_dir`.
+
+    Only files whose size or mtime differ from the manifest are read and
+    re-hashed; the rest are trusted unchanged. A file touched but not
+    modified is therefore not reported. A change within the same mtime
+    tick as the snapshot cannot be seen by stat alone, so files recorded
+    with an mtime less than two seconds before the snapshot (or later)
+    are always re-hashed.
+
+    :param directory: Tree to check.
+    :param manifest_path: Manifest written by :func:`snapshot_dir`.
+    :param update: Rewrite the manifest with the current state afterwards,
+        reusing the digests of unchanged files.
+    :param chunk_size: Read chunk size in bytes.
+    :param follow_symlinks: Follow symbolic links during traversal.
+    :param max_workers: Hashing thread pool size (0=auto, 1=sequential).
+    :returns: DirResult with the snapshot as the first side: ``only_left``
+        holds removed files, ``only_right`` added ones, and ``diff``
+        modified ones (SIZE_MISMATCH or CONTENT_MISMATCH). ``errors``
+        lists paths that could not be stat'd.
+    :raises FileNotFoundError: If the manifest does not exist.
+    :raises ValueError: If the manifest is not a snapshot manifest.
+    :raises OSError: If a changed file cannot be read.
+    """
+    validate_path(directory, "directory")
+    validate_path(manifest_path, "manifest_path")
+    validate_chunk_size(chunk_size)
+    validate_max_workers(max_workers)
+
+    taken_ns, old = _read(manifest_path)
+    now_ns = time.time_ns()
+    files, errors = _scan(directory, follow_symlinks)
+
+    diff: dict[str, DiffReason] = {}
+    suspect = []
+    for p, (size, mtime) in files.items():
+        entry = old.get(p)
+        if entry is None:
+            continue
+        if size != entry["size"]:
+            diff[p] = DiffReason.SIZE_MISMATCH
+        elif mtime != entry["mtime_ns"] or entry["mtime_ns"] >= taken_ns - _RACY_NS:
+            suspect.append(p)
+    added = sorted(p for p in files if p not in old)
+    rehash = sorted(suspect) + (sorted(diff) + added if update else [])
+    digests = _hash(directory, rehash, chunk_size, max_workers)
+    for p in suspect:
+        if digests[p] != old[p]["sha256"].lower():
+            diff[p] = DiffReason.CONTENT_MISMATCH
+
+    # Unreadable is not removed: keep those out of only_left
+    only_left = {p for p in old if p not in files and not _under(p, errors)}
+
+    if update:
+        entries = {
+            p: {"size": size, "mtime_ns": mtime, "sha256": digests.get(p) or old[p]["sha256"]}
+            for p, (size, mtime) in files.items()
+        }
+        for p, entry in old.items():
+            if p not in files and _under(p, errors):
+                entries[p] = entry
+        _write(manifest_path, now_ns, entries)
+
+    return DirResult(
+        equal=not (diff or only_left or added),
+        diff=diff,
+        only_left=only_left,
+        only_right=set(added),
+        errors=errors,
+    )
@@ -0,0 +1,313 @@
+"""Comparison of already-open binary streams."""
+
+from __future__ import annotations
+
+import os
+import re
+import stat
+from collections.abc import Callable
+from contextlib import ExitStack
+from typing import BinaryIO
+
+from komparu._validate import validate_chunk_size
+
+Opener = Callable[[str], BinaryIO]
+ContentFilter = Callable[[str, BinaryIO], BinaryIO]
+# (from, to) substitutions; str is encoded as UTF-8
+PathRewrite = list[tuple[str | bytes, str | bytes]]
+Buffer = bytes | bytearray | memoryview
+
+
+def _read_full(f: BinaryIO, size: int) -> bytes:
+    """Read up to *size* bytes, retrying short reads until EOF."""
+    buf = f.read(size)
+    if buf and len(buf) < size:
+        parts = [buf]
+        got = len(buf)
+        while got < size:
+            more = f.read(size - got)
+            if not more:
+                break
+            parts.append(more)
+            got += len(more)
+        buf = b"".join(parts)
+    return buf
+
+
+class _BufferReader:
+    """``read(n)`` over a bytes-like object, one chunk copied at a time."""
+
+    def __init__(self, data: Buffer) -> None:
+        self._view = memoryview(data).cast("B")
+        self._pos = 0
+
+    def read(self, size: int = -1) -> bytes:
+        end = len(self._view) if size < 0 else self._pos + size
+        chunk = bytes(self._view[self._pos:end])
+        self._pos += len(chunk)
+        return chunk
+
+
+def _as_reader(source: BinaryIO | Buffer, size: int | None) -> tuple[BinaryIO, int | None]:
+    if isinstance(source, (bytes, bytearray, memoryview)):
+        view = memoryview(source)
+        return _BufferReader(view), view.nbytes  # type: ignore[return-value]
+    return source, size
+
+
+def compare_readers(
+    reader_a: BinaryIO | Buffer,
+    reader_b: BinaryIO | Buffer,
+    *,
+    size_a: int | None = None,
+    size_b: int | None = None,
+    size_precheck: bool = False,
+    chunk_size: int = 65536,
+) -> bool:
+    """Compare two binary streams chunk by chunk.
+
+    When both sizes are given (e.g. from HTTP Content-Length or archive
+    entry headers) and differ, returns False before reading anything, so
+    neither stream is consumed. Declared sizes are not otherwise checked
+    against the actual content.
+
+    Either side may also be a bytes-like object; its length counts as a
+    declared size, and it is read in chunks without an up-front copy.
+    With *size_precheck*, a missing size is taken from the stream itself
+    when that is cheap: a regular file's ``fstat()``, or seeking to the
+    end of a seekable stream and back. Pipes and sockets stay unsized.
+
+    :param reader_a: First stream (anything with ``read(n) -> bytes``)
+        or bytes-like object.
+    :param reader_b: Second stream or bytes-like object.
+    :param size_a: Declared length of reader_a, if known.
+    :param size_b: Declared length of reader_b, if known.
+    :param size_precheck: Measure streams without a declared length.
+    :param chunk_size: Read chunk size in bytes.
+    :returns: True if both streams yield identical bytes.
+    :raises ValueError: If a declared size is negative.
+    """
+    validate_chunk_size(chunk_size)
+    for size, name in ((size_a, "size_a"), (size_b, "size_b")):
+        if size is not None and size < 0:
+            raise ValueError(f"{name} must be non-negative")
+    reader_a, size_a = _as_reader(reader_a, size_a)
+    reader_b, size_b = _as_reader(reader_b, size_b)
+    if size_precheck:
+        if size_a is None:
+            size_a = _stream_size(reader_a)
+        if size_b is None:
+            size_b = _stream_size(reader_b)
+
+    if size_a is not None and size_b is not None:
+        if size_a != size_b:
+            return False
+        if size_a == 0:
+            return True
+
+    while True:
+        ca = _read_full(reader_a, chunk_size)
+        cb = _read_full(reader_b, chunk_size)
+        if ca != cb:
+            return False
+        if not ca:
+            return True
+
+
+def _stream_size(f: BinaryIO) -> int | None:
+    """Size of an opened stream, or None if it cannot be told cheaply."""
+    try:
+        st = os.fstat(f.fileno())
+    except (AttributeError, OSError, ValueError):
+        pass
+    else:
+        if stat.S_ISREG(st.st_mode):  # a pipe's st_size is meaningless
+            return st.st_size
+    seekable = getattr(f, "seekable", None)
+    if seekable is None or not seekable():
+        return None
+    pos = f.tell()
+    end = f.seek(0, os.SEEK_END)
+    f.seek(pos)
+    return end - pos
+
+
+def _open_with(stack: ExitStack, opener: Opener, path: str) -> BinaryIO:
+    f = opener(path)
+    close = getattr(f, "close", None)
+    if close is not None:
+        stack.callback(close)
+    return f
+
+
+def compare_opened(
+    opener: Opener,
+    path_a: str,
+    path_b: str,
+    *,
+    size_precheck: bool,
+    chunk_size: int,
+) -> bool:
+    """Open both paths through *opener* and compare the streams."""
+    with ExitStack() as stack:
+        f_a = _open_with(stack, opener, path_a)
+        f_b = _open_with(stack, opener, path_b)
+        size_a = size_b = None
+        if size_precheck:
+            size_a = _stream_size(f_a)
+            size_b = _stream_size(f_b)
+        return compare_readers(
+            f_a, f_b, size_a=size_a, size_b=size_b, chunk_size=chunk_size,
+        )
+
+
+def first_diff_opened(
+    opener: Opener,
+    path_a: str,
+    path_b: str,
+    *,
+    size_precheck: bool,
+    chunk_size: int,
+) -> tuple[bool, int | None]:
+    """Like :func:`compare_opened`, plus the offset of the first differing
+    byte (the end of the shorter stream if one is a prefix of the other).
+
+    The offset is None when the streams are equal, or when the size
+    precheck reports a mismatch without reading.
+    """
+    with ExitStack() as stack:
+        f_a = _open_with(stack, opener, path_a)
+        f_b = _open_with(stack, opener, path_b)
+        if size_precheck:
+            size_a, size_b = _stream_size(f_a), _stream_size(f_b)
+            if size_a is not None and size_b is not None and size_a != size_b:
+                return False, None
+        offset = 0
+        while True:
+            ca = _read_full(f_a, chunk_size)
+            cb = _read_full(f_b, chunk_size)
+            if ca != cb:
+                n = min(len(ca), len(cb))
+                i = next((i for i in range(n) if ca[i] != cb[i]), n)
+                return False, offset + i
+            if not ca:
+                return True, None
+            offset += len(ca)
+
+
+def _open_binary(path: str) -> BinaryIO:
+    return open(path, "rb")
+
+
+def compare_filtered(
+    content_filter: ContentFilter,
+    path_a: str,
+    path_b: str,
+    *,
+    chunk_size: int,
+    opener: Opener | None = None,
+) -> bool:
+    """Compare the output of *content_filter* applied to each file.
+
+    The filter may change the length, so there is no size precheck.
+    """
+    with ExitStack() as stack:
+        streams = []
+        for path in (path_a, path_b):
+            raw = _open_with(stack, opener or _open_binary, path)
+            streams.append(_open_with(stack, lambda p: content_filter(p, raw), path))
+        return compare_readers(*streams, chunk_size=chunk_size)
+
+
+class _RewriteStream:
+    """Binary stream of *raw* with byte substitutions applied on the fly.
+
+    Matches are found as ``re.sub`` would over the whole content (leftmost
+    first, longest ``from`` first at a position). The last ``longest - 1``
+    bytes of each chunk are held back until more data arrives, so a match
+    spanning two reads is still replaced.
+    """
+
+    def __init__(self, raw: BinaryIO, table: dict[bytes, bytes], chunk_size: int) -> None:
+        self._raw = raw
+        self._table = table
+        froms = sorted(table, key=len, reverse=True)
+        self._regex = re.compile(b"|".join(re.escape(f) for f in froms))
+        self._hold = len(froms[0]) - 1
+        self._chunk = chunk_size
+        self._pending = b""  # raw bytes not yet scanned
+        self._out = b""      # rewritten bytes not yet returned
+        self._eof = False
+
+    def _fill(self) -> None:
+        data = _read_full(self._raw, self._chunk)
+        if not data:
+            self._eof = True
+        buf = self._pending + data
+        limit = len(buf) if self._eof else max(len(buf) - self._hold, 0)
+        parts, pos = [], 0
+        for m in self._regex.finditer(buf):
+            if m.start() >= limit:
+                break
+            parts.append(buf[pos:m.start()])
+            parts.append(self._table[m.group()])
+            pos = m.end()
+        keep = max(pos, limit)
+        parts.append(buf[pos:keep])
+        self._pending = buf[keep:]
+        self._out += b"".join(parts)
+
+    def read(self, n: int = -1) -> bytes:
+        while not self._eof and (n < 0 or len(self._out) < n):
+            self._fill()
+        if n < 0:
+            n = len(self._out)
+        data, self._out = self._out[:n], self._out[n:]
+        return data
+
+    def close(self) -> None:
+        close = getattr(self._raw, "close", None)
+        if close is not None:
+            close()
+
+
+def _as_bytes(value: str | bytes, what: str) -> bytes:
+    if isinstance(value, str):
+        return value.encode("utf-8")
+    if isinstance(value, (bytes, bytearray)):
+        return bytes(value)
+    raise TypeError(f"path_rewrite {what} must be str or bytes, got {type(value).__name__}")
+
+
+def rewrite_filter(
+    rewrites: PathRewrite,
+    base: ContentFilter | None = None,
+    *,
+    chunk_size: int = 65536,
+) -> ContentFilter:
+    """Content filter that applies *rewrites* to each file, after *base*.
+
+    :raises ValueError: If a ``from`` string is empty.
+    :raises TypeError: If an entry is not a (str|bytes, str|bytes) pair.
+    """
+    table: dict[bytes, bytes] = {}
+    for entry in rewrites:
+        try:
+            if isinstance(entry, (str, bytes)):
+                raise TypeError
+            old, new = entry
+        except (TypeError, ValueError):
+            raise TypeError("path_rewrite entries must be (from, to) pairs") from None
+        key = _as_bytes(old, "from")
+        if not key:
+            raise ValueError("path_rewrite 'from' must not be empty")
+        table[key] = _as_bytes(new, "to")
+    if not table:
+        return base if base is not None else (lambda path, stream: stream)
+
+    def apply(path: str, stream: BinaryIO) -> BinaryIO:
+        if base is not None:
+            stream = base(path, stream)
+        return _RewriteStream(stream, table, chunk_size)  # type: ignore[return-value]
+
+    return apply
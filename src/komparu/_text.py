@@ -0,0 +1,451 @@
+"""Line-oriented text comparison."""
+
+from __future__ import annotations
+
+import codecs
+import hashlib
+import re
+from collections import Counter
+from collections.abc import Callable, Iterable, Iterator
+from itertools import dropwhile, islice, zip_longest
+from typing import Any, TextIO
+
+from komparu._types import DecodeError, LineSetDiff, TextPosition, TokenDiff
+from komparu._validate import validate_path
+
+_EOF = object()
+
+# UTF-32 LE before UTF-16 LE: its BOM starts with the same two bytes
+_BOMS = (
+    (b"\xef\xbb\xbf", "utf-8-sig"),
+    (b"\xff\xfe\x00\x00", "utf-32"),
+    (b"\x00\x00\xfe\xff", "utf-32"),
+    (b"\xff\xfe", "utf-16"),
+    (b"\xfe\xff", "utf-16"),
+)
+_SNIFF = 8192
+
+# Splits an open text stream into significant tokens. Each item is a
+# token, or a ``(token, position)`` pair whose position is reported back.
+Tokenizer = Callable[[TextIO], Iterable[Any]]
+
+
+def _iter_lines(path: str, encoding: str, newline: str = "") -> Iterator[str]:
+    """Yield lines of *path*, line terminators included.
+
+    ``newline`` is passed to open(): "" splits on any terminator,
+    "\\n" on LF only.
+
+    :raises DecodeError: If the file is not valid in *encoding*.
+    """
+    try:
+        with open(path, encoding=encoding, newline=newline) as f:
+            for line in f:
+                yield line
+    except UnicodeDecodeError as e:
+        raise DecodeError(f"{path}: not valid {encoding}: {e.reason}") from None
+
+
+def _side_encodings(
+    encoding: str, encoding_a: str | None, encoding_b: str | None,
+) -> tuple[str, str]:
+    """Resolve the per-file encodings, rejecting unknown codec names."""
+    pair = (encoding_a or encoding, encoding_b or encoding)
+    for name in pair:
+        try:
+            codecs.lookup(name)
+        except LookupError:
+            raise ValueError(f"unknown encoding: {name!r}") from None
+    return pair
+
+
+def _sniff_encoding(path: str) -> str | None:
+    """Guess the codec of *path* from its BOM and first bytes, or None if binary.
+
+    A BOM decides. Without one, NUL bytes in only the odd (or even)
+    positions mean BOM-less UTF-16, other NULs mean binary, valid UTF-8
+    means UTF-8, and anything else is taken as cp1252.
+    """
+    with open(path, "rb") as f:
+        head = f.read(_SNIFF)
+    for bom, codec in _BOMS:
+        if head.startswith(bom):
+            return codec
+    if b"\0" in head:
+        even, odd = head[0::2].count(0), head[1::2].count(0)
+        if even == 0 and odd * 4 >= len(head):
+            return "utf-16-le"
+        if odd == 0 and even * 4 >= len(head):
+            return "utf-16-be"
+        return None
+    try:
+        # final=False: a sequence cut off at the end of the sample is fine
+        codecs.getincrementaldecoder("utf-8")().decode(head, final=False)
+    except UnicodeDecodeError:
+        return "cp1252"
+    return "utf-8"
+
+
+def same_text(path_a: str, path_b: str, chunk_size: int = 65536) -> bool:
+    """True if two files decode to the same text, each in its sniffed encoding.
+
+    Nothing but the encoding and BOM is normalized; line terminators
+    still count. Binary files and files that fail to decode are never
+    the same text.
+    """
+    enc_a, enc_b = _sniff_encoding(path_a), _sniff_encoding(path_b)
+    if enc_a is None or enc_b is None:
+        return False
+    try:
+        with open(path_a, encoding=enc_a, newline="") as fa, \
+                open(path_b, encoding=enc_b, newline="") as fb:
+            while True:
+                # Text reads return exactly chunk_size characters until EOF
+                ca, cb = fa.read(chunk_size), fb.read(chunk_size)
+                if ca != cb:
+                    return False
+                if not ca:
+                    return True
+    except UnicodeDecodeError:
+        return False
+
+
+def _compile_patterns(patterns: list[str] | None) -> list[re.Pattern[str]]:
+    if not patterns:
+        return []
+    try:
+        return [re.compile(p) for p in patterns]
+    except re.error as e:
+        raise ValueError(f"invalid ignore_line_patterns entry: {e}") from None
+
+
+def _prologue_stripper(
+    prologue: str | int | None,
+) -> Callable[[Iterator[str]], Iterator[str]] | None:
+    """Build the per-file filter for ``strip_prologue``, or None."""
+    if prologue is None:
+        return None
+    if isinstance(prologue, bool) or not isinstance(prologue, (int, str)):
+        raise TypeError("strip_prologue must be a regex string or a line count")
+    if isinstance(prologue, int):
+        if prologue < 0:
+            raise ValueError("strip_prologue line count must be non-negative")
+        return lambda lines: islice(lines, prologue, None)
+    try:
+        pattern = re.compile(prologue)
+    except re.error as e:
+        raise ValueError(f"invalid strip_prologue pattern: {e}") from None
+    return lambda lines: dropwhile(lambda line: pattern.search(line.rstrip("\r\n")), lines)
+
+
+def _final_newline_only(
+    line_a: Any, line_b: Any, rest_a: Iterator[str], rest_b: Iterator[str],
+) -> bool:
+    """True if the first differing pair is one side plus a final newline.
+
+    Both files must end right after the pair, so only the very last
+    ``\n`` or ``\r\n`` of one file may be the difference.
+    """
+    a = "" if line_a is _EOF else line_a
+    b = "" if line_b is _EOF else line_b
+    shorter, longer = (a, b) if len(a) < len(b) else (b, a)
+    if longer not in (shorter + "\n", shorter + "\r\n"):
+        return False
+    return next(rest_a, _EOF) is _EOF and next(rest_b, _EOF) is _EOF
+
+
+def compare_text(
+    path_a: str,
+    path_b: str,
+    *,
+    encoding: str = "utf-8",
+    encoding_a: str | None = None,
+    encoding_b: str | None = None,
+    ignore_line_patterns: list[str] | None = None,
+    strip_prologue: str | int | None = None,
+    ignore_final_newline: bool = False,
+) -> bool:
+    """Compare two text files line by line.
+
+    Lines are paired by position and compared including their line
+    terminators. A pair where both lines match any of
+    ``ignore_line_patterns`` (``re.search``, terminator excluded) is
+    skipped; a line matching on one side only still counts as a difference.
+
+    ``strip_prologue`` drops a leading header, such as a license block,
+    from each file on its own before lines are paired: a line count drops
+    that many lines, a regex drops leading lines while they match it
+    (``re.search``, terminator excluded). The two prologues may differ in
+    length.
+
+    With ``ignore_final_newline``, files that differ only in that one of
+    them ends with a ``\n`` or ``\r\n`` the other lacks compare equal.
+    Nothing else at the end is relaxed: ``\r\n`` against ``\n``, or two
+    extra newlines, still differ.
+
+    :param path_a: Path to first text file.
+    :param path_b: Path to second text file.
+    :param encoding: Text encoding of both files.
+    :param encoding_a: Encoding of the first file, if it differs.
+    :param encoding_b: Encoding of the second file, if it differs.
+    :param ignore_line_patterns: Regexes for lines to skip when both sides match.
+    :param strip_prologue: Regex or line count of a header to drop from
+        the start of each file.
+    :param ignore_final_newline: Treat a missing final newline on one
+        side as equal.
+    :returns: True if the files are equal as text.
+    :raises DecodeError: If a file is not valid in its encoding.
+    :raises ValueError: If an encoding is unknown, a pattern is invalid
+        or the line count is negative.
+    """
+    validate_path(path_a, "path_a")
+    validate_path(path_b, "path_b")
+    enc_a, enc_b = _side_encodings(encoding, encoding_a, encoding_b)
+    patterns = _compile_patterns(ignore_line_patterns)
+    strip = _prologue_stripper(strip_prologue)
+
+    def ignored(line: str) -> bool:
+        text = line.rstrip("\r\n")
+        return any(p.search(text) for p in patterns)
+
+    lines_a = _iter_lines(path_a, enc_a)
+    lines_b = _iter_lines(path_b, enc_b)
+    if strip is not None:
+        lines_a, lines_b = strip(lines_a), strip(lines_b)
+    for line_a, line_b in zip_longest(lines_a, lines_b, fillvalue=_EOF):
+        if line_a is _EOF or line_b is _EOF:
+            break
+        if line_a == line_b:
+            continue
+        if patterns and ignored(line_a) and ignored(line_b):
+            continue
+        break
+    else:
+        return True
+    return ignore_final_newline and _final_newline_only(line_a, line_b, lines_a, lines_b)
+
+
+def _common_prefix(a: str, b: str) -> int:
+    n = min(len(a), len(b))
+    for i in range(n):
+        if a[i] != b[i]:
+            return i
+    return n
+
+
+def _is_marker(text: str, marker: str) -> bool:
+    return text == marker or text.startswith(marker + " ")
+
+
+def _conflict_lines(path: str, encoding: str) -> tuple[int, ...]:
+    """Line numbers of complete git conflict blocks in *path*.
+
+    Only a ``<<<<<<<`` … ``=======`` … ``>>>>>>>`` sequence (with an
+    optional diff3 ``|||||||`` base marker) counts, so a lone ``=======``
+    such as a reST underline is not flagged.
+    """
+    found: list[int] = []
+    block: list[int] = []
+    state = 0  # 0 = outside, 1 = after <<<<<<<, 2 = after =======
+    for lineno, line in enumerate(_iter_lines(path, encoding, newline="\n"), 1):
+        text = line.rstrip("\r\n")
+        if _is_marker(text, "<<<<<<<"):
+            block = [lineno]
+            state = 1
+        elif state == 1 and _is_marker(text, "|||||||"):
+            block.append(lineno)
+        elif state == 1 and text == "=======":
+            block.append(lineno)
+            state = 2
+        elif state == 2 and _is_marker(text, ">>>>>>>"):
+            block.append(lineno)
+            found.extend(block)
+            state = 0
+    return tuple(found)
+
+
+def compare_text_lines(
+    path_a: str,
+    path_b: str,
+    *,
+    encoding: str = "utf-8",
+    encoding_a: str | None = None,
+    encoding_b: str | None = None,
+    detect_conflicts: bool = False,
+) -> TextPosition:
+    """Compare two text files and locate the first difference.
+
+    Lines are counted by ``\\n``; a ``\\r`` is ordinary content. If one
+    file is a prefix of the other, the position is where the shorter file
+    ends (column 1 of the next line if it ends with a newline).
+
+    With ``detect_conflicts``, both files are first scanned for unresolved
+    git merge conflict blocks. If either has one, the result is not equal,
+    ``conflict`` is True and the marker lines are reported instead of a
+    position.
+
+    :param path_a: Path to first text file.
+    :param path_b: Path to second text file.
+    :param encoding: Text encoding of both files.
+    :param encoding_a: Encoding of the first file, if it differs.
+    :param encoding_b: Encoding of the second file, if it differs.
+    :param detect_conflicts: Report conflict markers as a distinct outcome.
+    :returns: TextPosition with 1-based line and column of the first
+        difference, or ``equal=True``.
+    :raises DecodeError: If a file is not valid in its encoding.
+    :raises ValueError: If an encoding is unknown.
+    """
+    validate_path(path_a, "path_a")
+    validate_path(path_b, "path_b")
+    enc_a, enc_b = _side_encodings(encoding, encoding_a, encoding_b)
+
+    if detect_conflicts:
+        conflicts_a = _conflict_lines(path_a, enc_a)
+        conflicts_b = _conflict_lines(path_b, enc_b)
+        if conflicts_a or conflicts_b:
+            return TextPosition(
+                equal=False, conflicts_a=conflicts_a, conflicts_b=conflicts_b,
+            )
+
+    lines_a = _iter_lines(path_a, enc_a, newline="\n")
+    lines_b = _iter_lines(path_b, enc_b, newline="\n")
+    lineno = 0
+    for line_a, line_b in zip_longest(lines_a, lines_b, fillvalue=_EOF):
+        lineno += 1
+        if line_a == line_b:
+            continue
+        if line_a is _EOF or line_b is _EOF:
+            return TextPosition(equal=False, line=lineno, column=1)
+        return TextPosition(
+            equal=False, line=lineno, column=_common_prefix(line_a, line_b) + 1,
+        )
+    return TextPosition(equal=True)
+
+
+def _line_key(line: str) -> bytes:
+    return hashlib.blake2b(line.encode("utf-8", "surrogatepass"), digest_size=16).digest()
+
+
+def _surplus(path: str, encoding: str, wanted: Counter[bytes]) -> list[str]:
+    """Collect lines of *path* whose key still has a surplus in *wanted*."""
+    out: list[str] = []
+    for line in _iter_lines(path, encoding):
+        text = line.rstrip("\r\n")
+        key = _line_key(text)
+        if wanted[key] > 0:
+            wanted[key] -= 1
+            out.append(text)
+    return out
+
+
+def compare_text_unordered(
+    path_a: str,
+    path_b: str,
+    *,
+    encoding: str = "utf-8",
+    encoding_a: str | None = None,
+    encoding_b: str | None = None,
+) -> LineSetDiff:
+    """Compare two text files as multisets of lines, ignoring line order.
+
+    Duplicates count: a line present twice in one file and once in the
+    other is reported once as surplus. Line terminators are stripped, so
+    a missing final newline does not matter.
+
+    Files are streamed; memory holds a 16-byte digest per distinct line
+    rather than the lines themselves. Surplus lines are recovered in a
+    second pass over the files only if the multisets differ.
+
+    :param path_a: Path to first text file.
+    :param path_b: Path to second text file.
+    :param encoding: Text encoding of both files.
+    :param encoding_a: Encoding of the first file, if it differs.
+    :param encoding_b: Encoding of the second file, if it differs.
+    :returns: LineSetDiff with surplus lines per side, in file order.
+    :raises DecodeError: If a file is not valid in its encoding.
+    :raises ValueError: If an encoding is unknown.
+    """
+    validate_path(path_a, "path_a")
+    validate_path(path_b, "path_b")
+    enc_a, enc_b = _side_encodings(encoding, encoding_a, encoding_b)
+
+    counts: Counter[bytes] = Counter()
+    for line in _iter_lines(path_a, enc_a):
+        counts[_line_key(line.rstrip("\r\n"))] += 1
+    for line in _iter_lines(path_b, enc_b):
+        counts[_line_key(line.rstrip("\r\n"))] -= 1
+
+    left = Counter({k: n for k, n in counts.items() if n > 0})
+    right = Counter({k: -n for k, n in counts.items() if n < 0})
+    if not left and not right:
+        return LineSetDiff(equal=True)
+
+    return LineSetDiff(
+        equal=False,
+        only_left=_surplus(path_a, enc_a, left) if left else [],
+        only_right=_surplus(path_b, enc_b, right) if right else [],
+    )
+
+
+def _tokens(path: str, encoding: str, tokenizer: Tokenizer) -> Iterator[tuple[Any, Any]]:
+    """Yield ``(token, position)`` from *tokenizer* run over *path*.
+
+    :raises DecodeError: If the file is not valid in *encoding*.
+    """
+    try:
+        with open(path, encoding=encoding, newline="") as f:
+            for item in tokenizer(f):
+                if isinstance(item, tuple):
+                    token, position = item
+                    yield token, position
+                else:
+                    yield item, None
+    except UnicodeDecodeError as e:
+        raise DecodeError(f"{path}: not valid {encoding}: {e.reason}") from None
+
+
+def compare_tokens(
+    path_a: str,
+    path_b: str,
+    tokenizer: Tokenizer,
+    *,
+    encoding: str = "utf-8",
+    encoding_a: str | None = None,
+    encoding_b: str | None = None,
+) -> TokenDiff:
+    """Compare two text files as streams of tokens.
+
+    ``tokenizer`` receives each file opened in text mode (``newline=""``,
+    so terminators reach it unchanged, as the csv module expects) and
+    yields the tokens that matter; everything it drops — insignificant
+    whitespace, comments — is ignored. Items may be bare tokens or
+    ``(token, position)`` pairs; only the token is compared. Both streams
+    are consumed in lockstep and stop at the first difference.
+
+    :param path_a: Path to first text file.
+    :param path_b: Path to second text file.
+    :param tokenizer: ``tokenizer(stream)`` yielding tokens.
+    :param encoding: Text encoding of both files.
+    :param encoding_a: Encoding of the first file, if it differs.
+    :param encoding_b: Encoding of the second file, if it differs.
+    :returns: TokenDiff with the index, tokens and positions of the first
+        difference, or ``equal=True``.
+    :raises DecodeError: If a file is not valid in its encoding.
+    :raises ValueError: If an encoding is unknown.
+    """
+    validate_path(path_a, "path_a")
+    validate_path(path_b, "path_b")
+    enc_a, enc_b = _side_encodings(encoding, encoding_a, encoding_b)
+
+    tokens_a = _tokens(path_a, enc_a, tokenizer)
+    tokens_b = _tokens(path_b, enc_b, tokenizer)
+    pairs = zip_longest(tokens_a, tokens_b, fillvalue=(_EOF, None))
+    for index, ((tok_a, pos_a), (tok_b, pos_b)) in enumerate(pairs):
+        if tok_a is _EOF or tok_b is _EOF or tok_a != tok_b:
+            return TokenDiff(
+                equal=False, index=index,
+                token_a=None if tok_a is _EOF else tok_a,
+                token_b=None if tok_b is _EOF else tok_b,
+                position_a=pos_a, position_b=pos_b,
+            )
+    return TokenDiff(equal=True)
@@ -0,0 +1,98 @@
+"""Read tuning: time chunk sizes and read strategies on a sample file."""
+
+from __future__ import annotations
+
+import os
+import time
+from collections.abc import Sequence
+
+from komparu._cancel import CancelToken, cancel_handle
+from komparu._config import get_logger
+from komparu._core import read_file as _read_file_c
+from komparu._types import TuneResult, TuneTrial
+from komparu._validate import validate_chunk_size, validate_io_uring_depth, validate_path
+
+TUNE_STRATEGIES = ("mmap", "buffered", "prefetch", "io_uring")
+TUNE_CHUNK_SIZES = (16 * 1024, 64 * 1024, 256 * 1024, 1024 * 1024, 4 * 1024 * 1024)
+
+# IOInfo.path each strategy reads through when it is available
+_PATHS = {"mmap": "mmap", "buffered": "read", "prefetch": "prefetch", "io_uring": "io_uring"}
+
+
+def _read(path: str, strategy: str, chunk_size: int, depth: int,
+          token: object | None) -> tuple[int, tuple[str, str, str]]:
+    if strategy == "io_uring":
+        return _read_file_c(path, chunk_size=chunk_size, io_uring_depth=depth, cancel=token)
+    return _read_file_c(path, chunk_size=chunk_size, strategy=strategy, cancel=token)
+
+
+def tune_read(
+    path: str,
+    *,
+    chunk_sizes: Sequence[int] = TUNE_CHUNK_SIZES,
+    strategies: Sequence[str] = TUNE_STRATEGIES,
+    rounds: int = 3,
+    io_uring_depth: int = 8,
+    cancel: CancelToken | None = None,
+) -> TuneResult:
+    """Time reading a sample file with each strategy and chunk size.
+
+    Every combination reads the whole file ``rounds`` times and keeps
+    the fastest; the file is read once first so all of them see the same
+    page cache state. Pick a sample on the storage that will be compared:
+    a file already cached measures copying, one larger than memory (or
+    read after dropping the cache) measures the device. A strategy that
+    falls back to plain reads on this system is left out of the trials
+    and listed in ``unavailable`` instead.
+
+    :param path: Local regular file to read.
+    :param chunk_sizes: Chunk sizes to try, in bytes.
+    :param strategies: Any of ``"mmap"``, ``"buffered"``, ``"prefetch"``
+        and ``"io_uring"``.
+    :param rounds: Timed reads per combination.
+    :param io_uring_depth: Reads in flight for the ``"io_uring"`` trials.
+    :param cancel: Token that stops the benchmark, as in :func:`compare`.
+    :returns: TuneResult; ``best.options`` are keyword arguments for
+        :func:`compare`.
+    :raises CancelledError: If cancel fired.
+    """
+    validate_path(path, "path")
+    if not chunk_sizes:
+        raise ValueError("chunk_sizes cannot be empty")
+    for chunk_size in chunk_sizes:
+        validate_chunk_size(chunk_size)
+    for strategy in strategies:
+        if strategy not in TUNE_STRATEGIES:
+            raise ValueError(
+                f"strategy must be one of {', '.join(TUNE_STRATEGIES)}, not {strategy!r}"
+            )
+    if rounds < 1:
+        raise ValueError("rounds must be positive")
+    validate_io_uring_depth(io_uring_depth)
+    if os.stat(path).st_size == 0:
+        raise ValueError(f"cannot tune on an empty file: {path}")
+    token = cancel_handle(cancel)
+
+    size, _ = _read(path, "buffered", TUNE_CHUNK_SIZES[1], io_uring_depth, token)
+    trials: list[TuneTrial] = []
+    unavailable: dict[str, str] = {}
+    for strategy in strategies:
+        for chunk_size in chunk_sizes:
+            seconds = None
+            for _ in range(rounds):
+                start = time.perf_counter()
+                size, io = _read(path, strategy, chunk_size, io_uring_depth, token)
+                elapsed = time.perf_counter() - start
+                if io[0] != _PATHS[strategy]:
+                    break
+                seconds = elapsed if seconds is None else min(seconds, elapsed)
+            if seconds is None:
+                unavailable[strategy] = io[1]
+                break
+            trial = TuneTrial(
+                strategy=strategy, chunk_size=chunk_size, seconds=seconds,
+                throughput=size / seconds if seconds > 0 else float("inf"),
+            )
+            get_logger().debug("tune %s: %s", path, trial)
+            trials.append(trial)
+    return TuneResult(path=path, size=size, trials=trials, unavailable=unavailable)
@@ -4,6 +4,7 @@ from __future__ import annotations
 
 from dataclasses import dataclass, field
 from enum import Enum
+from typing import Any
 
 
 class DiffReason(str, Enum):
@@ -14,6 +15,33 @@ class DiffReason(str, Enum):
     MISSING = "missing"
     TYPE_MISMATCH = "type_mismatch"
     READ_ERROR = "read_error"
+    BROKEN_SYMLINK = "broken_symlink"
+    XATTR_MISMATCH = "xattr_mismatch"
+    MODE_MISMATCH = "mode_mismatch"
+    MTIME_MISMATCH = "mtime_mismatch"
+    OWNER_MISMATCH = "owner_mismatch"
+    ENCODING_MISMATCH = "encoding_mismatch"
+    LINK_TARGET_MISMATCH = "link_target_mismatch"
+
+
+class MergeStatus(str, Enum):
+    """How a file changed between a merge base and two descendants."""
+
+    UNCHANGED = "unchanged"
+    CHANGED_LEFT = "changed_left"
+    CHANGED_RIGHT = "changed_right"
+    CHANGED_BOTH_SAME = "changed_both_same"
+    CONFLICT = "conflict"
+
+
+class EntryStatus(str, Enum):
+    """Outcome of one path in a DirReport."""
+
+    EQUAL = "equal"
+    DIFFERENT = "different"
+    ONLY_LEFT = "only_left"
+    ONLY_RIGHT = "only_right"
+    ERROR = "error"
 
 
 @dataclass(frozen=True, slots=True)
@@ -49,6 +77,12 @@ class DirResult:
     :param only_left: Files only in the first source.
     :param only_right: Files only in the second source.
     :param errors: Paths skipped due to permission denied (EACCES/EPERM).
+    :param renamed: ``(from, to)`` pairs of files moved with identical
+        content (only with ``detect_renames=True``), sorted by ``from``.
+    :param expected_diffs: Differing files listed in ``known_diffs``;
+        they do not affect ``equal``.
+    :param stale_known_diffs: ``known_diffs`` entries whose files now
+        compare equal.
     """
 
     equal: bool
@@ -56,6 +90,153 @@ class DirResult:
     only_left: set[str]
     only_right: set[str]
     errors: set[str] = field(default_factory=set)
+    renamed: list[tuple[str, str]] = field(default_factory=list)
+    expected_diffs: dict[str, DiffReason] = field(default_factory=dict)
+    stale_known_diffs: set[str] = field(default_factory=set)
+
+
+@dataclass(frozen=True, slots=True)
+class ReportEntry:
+    """One path of a DirReport.
+
+    :param path: Relative path, ``/``-separated.
+    :param status: Whether the path matched, differed, exists on one side
+        only or could not be read.
+    :param reason: Why it differs (READ_ERROR for unreadable files), or
+        None for the other statuses.
+    :param size_a: Size in the first tree, or None if absent or not a
+        regular file.
+    :param size_b: Size in the second tree, or None.
+    :param first_diff_offset: Offset of the first differing byte, when
+        requested and both sides are regular files; else None.
+    :param metadata: Every ``metadata`` check the pair failed (such as
+        ``"mode"`` or ``"mtime"``) when its content matched; ``reason``
+        names the first of them.
+    """
+
+    path: str
+    status: EntryStatus
+    reason: DiffReason | None = None
+    size_a: int | None = None
+    size_b: int | None = None
+    first_diff_offset: int | None = None
+    metadata: tuple[str, ...] = ()
+
+
+@dataclass(frozen=True, slots=True)
+class DirReport:
+    """Per-path report of a directory comparison, matching files included.
+
+    :param dir_a: First directory as passed in.
+    :param dir_b: Second directory.
+    :param equal: Same as :attr:`DirResult.equal`; ERROR entries other
+        than READ_ERROR ones do not affect it.
+    :param entries: Every compared path, sorted by path.
+    """
+
+    dir_a: str
+    dir_b: str
+    equal: bool
+    entries: list[ReportEntry]
+
+    @property
+    def counts(self) -> dict[EntryStatus, int]:
+        """Number of entries per status, every status present."""
+        counts = dict.fromkeys(EntryStatus, 0)
+        for entry in self.entries:
+            counts[entry.status] += 1
+        return counts
+
+
+@dataclass(frozen=True, slots=True)
+class DirSummary:
+    """Aggregate counts of a directory comparison, without paths.
+
+    :param equal: True if all files are identical.
+    :param compared: Files present on both sides and compared.
+    :param differing: Compared files that differ.
+    :param only_left: Files only in the first directory.
+    :param only_right: Files only in the second directory.
+    :param errors: Paths skipped due to permission denied.
+    :param bytes_read: Content bytes read from both sides.
+    :param duration: Wall-clock time of the comparison in seconds.
+    """
+
+    equal: bool
+    compared: int
+    differing: int
+    only_left: int
+    only_right: int
+    errors: int
+    bytes_read: int
+    duration: float
+
+
+@dataclass(frozen=True, slots=True)
+class ProgressEvent:
+    """Progress of a running compare or compare_dir, passed to ``on_progress``.
+
+    :param files_done: File pairs finished so far.
+    :param files_total: File pairs to compare; 0 until both trees are walked.
+    :param bytes_done: Bytes scanned so far, counting the larger side of
+        each pair; a finished pair counts its full larger size.
+    :param bytes_total: Sum of the larger size of every pair; 0 until
+        planned or when the sizes are unknown (some URLs).
+    :param path: Relative path of the pair started last (directories) or
+        the first source (files); None before the first pair.
+    :param elapsed: Seconds since the comparison started.
+    """
+
+    files_done: int
+    files_total: int
+    bytes_done: int
+    bytes_total: int
+    path: str | None
+    elapsed: float
+
+    @property
+    def rate(self) -> float:
+        """Average throughput so far in bytes per second."""
+        return self.bytes_done / self.elapsed if self.elapsed > 0 else 0.0
+
+    @property
+    def eta(self) -> float | None:
+        """Seconds left at the average rate; None while it is unknown."""
+        if not self.bytes_total or not self.rate:
+            return None
+        return max(self.bytes_total - self.bytes_done, 0) / self.rate
+
+
+@dataclass(frozen=True, slots=True)
+class WatchEvent:
+    """A change in how two watched trees compare, yielded by Watcher.
+
+    :param kind: ``"diverged"`` when equal trees start to differ,
+        ``"converged"`` when they become equal again, ``"changed"`` when
+        differing trees now differ in another way.
+    :param result: The whole comparison as of this event.
+    :param changed: Relative paths compared again for this event.
+    """
+
+    kind: str
+    result: DirResult
+    changed: frozenset[str]
+
+
+@dataclass(frozen=True, slots=True)
+class FileStat:
+    """Metadata of a file in a virtual filesystem; None where unknown.
+
+    :param mode: Permission bits (``stat.S_IMODE``), without the type.
+    :param mtime_ns: Modification time in nanoseconds since the epoch.
+    :param uid: Owner user id.
+    :param gid: Owner group id.
+    """
+
+    mode: int | None = None
+    mtime_ns: int | None = None
+    uid: int | None = None
+    gid: int | None = None
 
 
 @dataclass(frozen=True, slots=True)
@@ -72,6 +253,346 @@ class CompareResult:
     diff: dict[tuple[str, str], bool]
 
 
+@dataclass(frozen=True, slots=True)
+class TextPosition:
+    """Outcome of compare_text_lines.
+
+    :param equal: True if the files are equal as text.
+    :param line: 1-based line of the first difference (None if equal
+        or if conflict markers were found).
+    :param column: 1-based column (in characters) on that line
+        (None if equal).
+    :param conflicts_a: 1-based lines of merge conflict markers in the
+        first file (``detect_conflicts`` only).
+    :param conflicts_b: Same for the second file.
+    """
+
+    equal: bool
+    line: int | None = None
+    column: int | None = None
+    conflicts_a: tuple[int, ...] = ()
+    conflicts_b: tuple[int, ...] = ()
+
+    @property
+    def conflict(self) -> bool:
+        """True if either file contains unresolved conflict markers."""
+        return bool(self.conflicts_a or self.conflicts_b)
+
+
+@dataclass(frozen=True, slots=True)
+class LineSetDiff:
+    """Outcome of compare_text_unordered.
+
+    :param equal: True if both files hold the same multiset of lines.
+    :param only_left: Lines in excess in the first file, terminators
+        stripped; a line appears once per surplus occurrence.
+    :param only_right: Same for the second file.
+    """
+
+    equal: bool
+    only_left: list[str] = field(default_factory=list)
+    only_right: list[str] = field(default_factory=list)
+
+
+@dataclass(frozen=True, slots=True)
+class TokenDiff:
+    """Outcome of compare_tokens.
+
+    :param equal: True if both files yield the same token stream.
+    :param index: 0-based index of the first differing token (None if equal).
+    :param token_a: That token in the first file; None if the first
+        file's stream ended there.
+    :param token_b: Same for the second file.
+    :param position_a: Position the tokenizer paired with ``token_a``
+        (None if it yields bare tokens).
+    :param position_b: Same for ``token_b``.
+    """
+
+    equal: bool
+    index: int | None = None
+    token_a: Any = None
+    token_b: Any = None
+    position_a: Any = None
+    position_b: Any = None
+
+
+@dataclass(frozen=True, slots=True)
+class BlockSum:
+    """Checksums of one fixed-size block, as returned by block_checksums.
+
+    :param offset: Block start in the file.
+    :param length: Block length (the last block may be shorter).
+    :param weak: rsync rolling checksum, ``a | (b << 16)``.
+    :param strong: SHA-256 digest of the block (32 bytes).
+    """
+
+    offset: int
+    length: int
+    weak: int
+    strong: bytes
+
+
+@dataclass(frozen=True, slots=True)
+class ManifestEntry:
+    """One file of a Manifest.
+
+    :param size: File size in bytes.
+    :param digest: Lowercase hex digest of the content.
+    """
+
+    size: int
+    digest: str
+
+
+@dataclass(frozen=True, slots=True)
+class Manifest:
+    """Sizes and digests of a directory tree, as built by manifest_dir.
+
+    :param algorithm: Hash algorithm of every digest, e.g. ``"sha256"``.
+    :param files: Relative ``/``-separated path -> ManifestEntry.
+    """
+
+    algorithm: str
+    files: dict[str, ManifestEntry]
+
+
+@dataclass(frozen=True, slots=True)
+class IOInfo:
+    """I/O path used to read a local file.
+
+    :param path: ``"mmap"``, ``"read"`` (buffered reads), ``"io_uring"`` or
+        ``"prefetch"`` (readahead thread).
+    :param fallback: Why mmap (io_uring, prefetch) was not used:
+        ``"empty_file"``, ``"mmap_unsupported"`` (filesystem cannot mmap),
+        ``"mmap_failed"``, ``"uring_unavailable"``, ``"prefetch_unavailable"``,
+        ``"below_threshold"`` (``strategy="auto"`` and smaller than 64 KiB)
+        or ``"buffered"`` (``strategy="buffered"``); None when the preferred
+        path was used.
+    :param huge_pages: Outcome of ``huge_pages=True``: ``"hugetlbfs"``,
+        ``"madvise"`` or ``"refused"``; None if not requested or not mapped.
+    """
+
+    path: str
+    fallback: str | None = None
+    huge_pages: str | None = None
+
+
+@dataclass(slots=True)
+class FileDiff:
+    """Reusable, caller-owned result of :func:`komparu.compare_into`.
+
+    Every field is overwritten on each call; fields that do not apply
+    are reset to ``None`` (e.g. ``first_diff_offset`` when equal).
+
+    :param equal: True if the sources are byte-identical.
+    :param reason: Why the sources differ, or None if equal.
+    :param first_diff_offset: Offset of the first differing byte, or None.
+    :param size_a: Size of the first source, or None if unknown.
+    :param size_b: Size of the second source, or None if unknown.
+    :param io_a: I/O path for the first source, or None if it is not a
+        local file or was not opened (same-file short-circuit).
+    :param io_b: I/O path for the second source, or None.
+    """
+
+    equal: bool = False
+    reason: DiffReason | None = None
+    first_diff_offset: int | None = None
+    size_a: int | None = None
+    size_b: int | None = None
+    io_a: IOInfo | None = None
+    io_b: IOInfo | None = None
+
+
+@dataclass(frozen=True, slots=True)
+class Mismatch:
+    """First differing byte of two files, as returned by first_difference.
+
+    :param offset: Offset of the first differing byte. If one file is a
+        prefix of the other, the shorter length.
+    :param byte_a: Byte of the first file at ``offset``, or None past its end.
+    :param byte_b: Byte of the second file at ``offset``, or None.
+    :param context_start: File offset at which both context windows start.
+    :param context_a: Bytes of the first file around ``offset``, from
+        ``context_start``; shorter near either end of the file.
+    :param context_b: Bytes of the second file from ``context_start``.
+    """
+
+    offset: int
+    byte_a: int | None
+    byte_b: int | None
+    context_start: int
+    context_a: bytes
+    context_b: bytes
+
+
+@dataclass(frozen=True, slots=True)
+class DiffStats:
+    """Full-scan difference statistics, as returned by diff_stats.
+
+    :param size_a: Length of the first file.
+    :param size_b: Length of the second file.
+    :param differing_bytes: Byte positions that differ; positions past
+        the end of the shorter file count.
+    :param differing_ranges: Runs of consecutive differing positions.
+    :param first_diff_offset: Offset of the first differing byte, or None
+        if the files are identical.
+    """
+
+    size_a: int
+    size_b: int
+    differing_bytes: int
+    differing_ranges: int
+    first_diff_offset: int | None
+
+    @property
+    def equal(self) -> bool:
+        """True if nothing differs."""
+        return self.differing_bytes == 0
+
+    @property
+    def total(self) -> int:
+        """Length of the longer file."""
+        return max(self.size_a, self.size_b)
+
+    @property
+    def similarity(self) -> float:
+        """Percentage of positions that match (100.0 for two empty files)."""
+        if self.total == 0:
+            return 100.0
+        return 100.0 * (self.total - self.differing_bytes) / self.total
+
+
+@dataclass(frozen=True, slots=True)
+class TuneTrial:
+    """One read configuration timed by tune_read.
+
+    :param strategy: ``"mmap"``, ``"buffered"``, ``"prefetch"`` or ``"io_uring"``.
+    :param chunk_size: Read chunk size in bytes.
+    :param seconds: Fastest of the timed reads of the whole sample.
+    :param throughput: Sample bytes per second at that time.
+    """
+
+    strategy: str
+    chunk_size: int
+    seconds: float
+    throughput: float
+
+    @property
+    def options(self) -> dict[str, object]:
+        """Keyword arguments that select this configuration in compare()."""
+        if self.strategy == "io_uring":
+            return {"chunk_size": self.chunk_size, "io_uring": True}
+        return {"chunk_size": self.chunk_size, "strategy": self.strategy}
+
+
+@dataclass(frozen=True, slots=True)
+class TuneResult:
+    """Read benchmark of a sample file, as returned by tune_read.
+
+    :param path: The sample file.
+    :param size: Its length in bytes.
+    :param trials: Every configuration that ran on its own path, in the
+        order tried.
+    :param unavailable: Strategies that fell back to plain reads here
+        (io_uring off Linux or refused, prefetch without threads), mapped
+        to the IOInfo fallback reason.
+    """
+
+    path: str
+    size: int
+    trials: list[TuneTrial]
+    unavailable: dict[str, str] = field(default_factory=dict)
+
+    @property
+    def best(self) -> TuneTrial:
+        """The fastest trial."""
+        return min(self.trials, key=lambda t: t.seconds)
+
+
+@dataclass(frozen=True, slots=True)
+class BatchResult:
+    """Outcome of one pair in compare_batch.
+
+    :param path_a: The pair's first path.
+    :param path_b: The pair's second path.
+    :param equal: True if the files are byte-identical (False on error).
+    :param first_diff_offset: Offset of the first differing byte, or None
+        if equal, on error, or when sizes differ with ``size_precheck``.
+    :param error: The exception that stopped this pair, or None.
+    """
+
+    path_a: str
+    path_b: str
+    equal: bool
+    first_diff_offset: int | None = None
+    error: Exception | None = None
+
+
+@dataclass(frozen=True, slots=True)
+class ThreeWayResult:
+    """Outcome of compare_three_way.
+
+    :param files: Every path present in base, left or right, with its
+        MergeStatus. Additions and deletions count as changes.
+    """
+
+    files: dict[str, MergeStatus]
+
+    @property
+    def conflicts(self) -> list[str]:
+        """Sorted paths changed differently on both sides."""
+        return sorted(p for p, s in self.files.items() if s is MergeStatus.CONFLICT)
+
+    @property
+    def clean(self) -> bool:
+        """True if the merge has no conflicts."""
+        return MergeStatus.CONFLICT not in self.files.values()
+
+    @property
+    def counts(self) -> dict[MergeStatus, int]:
+        """Number of paths per status, every status present."""
+        counts = dict.fromkeys(MergeStatus, 0)
+        for status in self.files.values():
+            counts[status] += 1
+        return counts
+
+
+@dataclass(frozen=True, slots=True)
+class MultiTreeReport:
+    """Outcome of compare_trees.
+
+    :param dirs: The compared replicas, in the order given.
+    :param files: Every path present in any replica, mapped to the
+        replicas holding it grouped by identical content, in order of
+        first appearance. A replica lacking the path is in no group.
+    """
+
+    dirs: tuple[str, ...]
+    files: dict[str, list[set[str]]]
+
+    @property
+    def diverged(self) -> list[str]:
+        """Sorted paths missing from a replica or differing between replicas."""
+        n = len(self.dirs)
+        return sorted(p for p, groups in self.files.items()
+                      if len(groups) != 1 or len(groups[0]) != n)
+
+    @property
+    def missing(self) -> dict[str, set[str]]:
+        """Path -> replicas lacking it, for paths absent somewhere."""
+        out: dict[str, set[str]] = {}
+        for path, groups in self.files.items():
+            present = set().union(*groups)
+            if len(present) != len(self.dirs):
+                out[path] = set(self.dirs) - present
+        return out
+
+    @property
+    def equal(self) -> bool:
+        """True if every replica holds the same files with the same content."""
+        return not self.diverged
+
+
 # ---- Errors ----
 
 class KomparuError(Exception):
@@ -86,6 +607,10 @@ class SourceReadError(KomparuError):
     """I/O or HTTP read error."""
 
 
+class DecodeError(KomparuError):
+    """Source content is not valid for the requested decoding."""
+
+
 class ArchiveError(KomparuError):
     """Cannot read or parse archive."""
 
@@ -100,3 +625,16 @@ class ConfigError(KomparuError):
 
 class ComparisonTimeoutError(KomparuError):
     """Comparison exceeded wall-clock timeout."""
+
+
+class CancelledError(KomparuError):
+    """Comparison stopped through its :class:`CancelToken`."""
+
+
+class NonRegularFileError(KomparuError):
+    """Directory entry is not a regular file (``regular_files_only``)."""
+
+    def __init__(self, path: str, kind: str) -> None:
+        super().__init__(f"'{path}' is a {kind}, not a regular file")
+        self.path = path
+        self.kind = kind
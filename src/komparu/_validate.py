@@ -23,8 +23,97 @@ def validate_timeout(timeout: float | None) -> None:
         raise ValueError("timeout must be positive")
 
 
+def validate_progress_interval(interval: float) -> None:
+    if interval <= 0:
+        raise ValueError("progress_interval must be positive")
+
+
 def validate_max_workers(max_workers: int) -> None:
     if max_workers < 0:
         raise ValueError("max_workers must be non-negative")
     if max_workers > 256:
         raise ValueError("max_workers must be <= 256")
+
+
+def validate_io_uring_depth(depth: int) -> None:
+    if not 1 <= depth <= 256:
+        raise ValueError("io_uring_depth must be between 1 and 256")
+
+
+STRATEGIES = ("auto", "mmap", "buffered", "prefetch")
+
+
+def validate_strategy(strategy: str, io_uring: bool) -> None:
+    if strategy not in STRATEGIES:
+        raise ValueError(
+            f"strategy must be one of {', '.join(STRATEGIES)}, not {strategy!r}"
+        )
+    if io_uring and strategy != "auto":
+        raise ValueError(f"strategy={strategy!r} cannot be combined with io_uring")
+
+
+def validate_max_depth(max_depth: int | None) -> None:
+    if max_depth is not None and max_depth < 0:
+        raise ValueError("max_depth must be non-negative")
+
+
+def validate_patterns(patterns: list[str] | None, name: str) -> None:
+    if patterns is None:
+        return
+    if isinstance(patterns, str):
+        raise TypeError(f"{name} must be a list of patterns, not a str")
+    for pattern in patterns:
+        if not isinstance(pattern, str):
+            raise TypeError(f"{name} must contain only str")
+        if not pattern.strip("/"):
+            raise ValueError(f"{name} pattern cannot be empty: {pattern!r}")
+
+
+SYMLINK_MODES = ("follow", "compare-link", "skip")
+
+
+def validate_symlinks(mode: str | None, allowed: tuple[str, ...] = SYMLINK_MODES) -> None:
+    if mode is not None and mode not in allowed:
+        raise ValueError(
+            f"symlinks must be one of {', '.join(allowed)}, not {mode!r}"
+        )
+
+
+METADATA_CHECKS = ("mode", "mtime", "uid", "gid", "xattr")
+
+
+def validate_metadata(checks: list[str] | None, mtime_tolerance: float) -> None:
+    if mtime_tolerance < 0:
+        raise ValueError("mtime_tolerance must be non-negative")
+    if checks is None:
+        return
+    if isinstance(checks, str):
+        raise TypeError("metadata must be a list of check names, not a str")
+    for check in checks:
+        if check not in METADATA_CHECKS:
+            raise ValueError(
+                f"metadata checks must be among {', '.join(METADATA_CHECKS)}, not {check!r}"
+            )
+
+
+def validate_max_memory(max_memory: int | None, chunk_size: int) -> None:
+    if max_memory is None:
+        return
+    if max_memory < 2 * chunk_size:
+        raise ValueError(
+            "max_memory must be at least 2 * chunk_size "
+            f"({2 * chunk_size} bytes)"
+        )
+
+
+def validate_skip(skip: int, name: str) -> None:
+    if skip < 0:
+        raise ValueError(f"{name} must be non-negative")
+
+
+_DECODINGS = ("none", "base64", "hex")
+
+
+def validate_decode(decode: str, name: str) -> None:
+    if decode not in _DECODINGS:
+        raise ValueError(f"{name} must be one of {', '.join(_DECODINGS)}")
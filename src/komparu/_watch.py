@@ -0,0 +1,413 @@
+"""Watch mode: keep two trees compared as they change."""
+
+from __future__ import annotations
+
+import ctypes
+import errno
+import os
+import select
+import stat
+import struct
+import sys
+import threading
+import time
+from collections.abc import Iterator
+from types import TracebackType
+
+from komparu._api import compare, compare_dir
+from komparu._helpers import walk_filter
+from komparu._snapshot import _scan
+from komparu._types import DiffReason, DirResult, KomparuError, WatchEvent
+from komparu._validate import validate_chunk_size, validate_path, validate_patterns
+
+BACKENDS = ("auto", "inotify", "poll")
+
+# Longest a wait blocks before close() and a poll timeout are looked at again
+_SLICE = 0.25
+# Quiet time that ends a burst of inotify events, and the cap on one burst
+_SETTLE = 0.05
+_SETTLE_MAX = 1.0
+
+_IN_MODIFY = 0x00000002
+_IN_ATTRIB = 0x00000004
+_IN_CLOSE_WRITE = 0x00000008
+_IN_MOVED_FROM = 0x00000040
+_IN_MOVED_TO = 0x00000080
+_IN_CREATE = 0x00000100
+_IN_DELETE = 0x00000200
+_IN_DELETE_SELF = 0x00000400
+_IN_MOVE_SELF = 0x00000800
+_IN_Q_OVERFLOW = 0x00004000
+_IN_IGNORED = 0x00008000
+_IN_ONLYDIR = 0x01000000
+_IN_DONT_FOLLOW = 0x02000000
+_IN_ISDIR = 0x40000000
+_IN_NONBLOCK = 0o4000
+_IN_CLOEXEC = 0o2000000
+
+_IN_MASK = (_IN_MODIFY | _IN_ATTRIB | _IN_CLOSE_WRITE | _IN_MOVED_FROM | _IN_MOVED_TO
+            | _IN_CREATE | _IN_DELETE | _IN_DELETE_SELF | _IN_MOVE_SELF)
+_IN_EVENT = struct.Struct("iIII")  # wd, mask, cookie, len; then len bytes of name
+
+# (changed files, changed directories, everything may have changed)
+_Changes = tuple[set[str], set[str], bool]
+
+
+def _join(rel_dir: str, name: str) -> str:
+    return f"{rel_dir}/{name}" if rel_dir else name
+
+
+def _inotify_libc() -> ctypes.CDLL | None:
+    """libc with the inotify calls, or None where there are none."""
+    if not sys.platform.startswith("linux"):
+        return None
+    try:
+        libc = ctypes.CDLL(None, use_errno=True)
+        libc.inotify_init1.argtypes = [ctypes.c_int]
+        libc.inotify_add_watch.argtypes = [ctypes.c_int, ctypes.c_char_p, ctypes.c_uint32]
+        libc.inotify_rm_watch.argtypes = [ctypes.c_int, ctypes.c_int]
+    except (OSError, AttributeError):
+        return None
+    return libc
+
+
+class _Inotify:
+    """Kernel change notifications for every directory of both trees."""
+
+    def __init__(self, libc: ctypes.CDLL, roots: tuple[str, str], follow_symlinks: bool) -> None:
+        fd = libc.inotify_init1(_IN_NONBLOCK | _IN_CLOEXEC)
+        if fd < 0:
+            err = ctypes.get_errno()
+            raise OSError(err, f"inotify_init1: {os.strerror(err)}")
+        self._libc = libc
+        self._fd = fd
+        self._roots = roots
+        self._follow = follow_symlinks
+        self._flags = _IN_MASK | _IN_ONLYDIR | (0 if follow_symlinks else _IN_DONT_FOLLOW)
+        self._dirs: dict[int, tuple[int, str]] = {}  # wd -> (root index, relative dir)
+        try:
+            for side in range(len(roots)):
+                self._watch_tree(side, "")
+        except BaseException:
+            os.close(fd)
+            raise
+
+    def _watch_tree(self, side: int, rel_dir: str) -> None:
+        top = os.path.join(self._roots[side], rel_dir) if rel_dir else self._roots[side]
+        for path, subdirs, _files in os.walk(top, followlinks=self._follow):
+            rel = os.path.relpath(path, self._roots[side]).replace(os.sep, "/")
+            wd = self._libc.inotify_add_watch(self._fd, os.fsencode(path), self._flags)
+            if wd < 0:
+                err = ctypes.get_errno()
+                if err == errno.ENOSPC:
+                    raise OSError(err, "inotify watch limit reached; raise "
+                                       "fs.inotify.max_user_watches or use the poll backend")
+                subdirs.clear()  # removed or unreadable: nothing below to watch
+                continue
+            self._dirs[wd] = (side, "" if rel == "." else rel)
+
+    def _unwatch_tree(self, side: int, rel_dir: str) -> None:
+        prefix = rel_dir + "/"
+        for wd, (s, d) in list(self._dirs.items()):
+            if s == side and (d == rel_dir or d.startswith(prefix)):
+                self._libc.inotify_rm_watch(self._fd, wd)
+                del self._dirs[wd]
+
+    def _readable(self, timeout: float) -> bool:
+        return bool(select.select([self._fd], [], [], timeout)[0])
+
+    def wait(self, timeout: float) -> _Changes | None:
+        if not self._readable(timeout):
+            return None
+        files: set[str] = set()
+        dirs: set[str] = set()
+        full = False
+        # A copy or an rsync run is a burst of events: take it whole
+        end = time.monotonic() + _SETTLE_MAX
+        while True:
+            full |= self._drain(files, dirs)
+            if time.monotonic() >= end or not self._readable(_SETTLE):
+                break
+        return files, dirs, full
+
+    def _drain(self, files: set[str], dirs: set[str]) -> bool:
+        """Read pending events into *files* and *dirs*; True if the
+        kernel queue overflowed and events were lost."""
+        try:
+            data = os.read(self._fd, 65536)
+        except BlockingIOError:
+            return False
+        overflow = False
+        offset = 0
+        while offset + _IN_EVENT.size <= len(data):
+            wd, mask, _cookie, length = _IN_EVENT.unpack_from(data, offset)
+            offset += _IN_EVENT.size
+            name = os.fsdecode(data[offset:offset + length].rstrip(b"\0"))
+            offset += length
+            if mask & _IN_Q_OVERFLOW:
+                overflow = True
+                continue
+            entry = self._dirs.get(wd)
+            if entry is None:
+                continue
+            side, rel_dir = entry
+            if mask & _IN_IGNORED:
+                del self._dirs[wd]
+            elif not name:
+                if mask & (_IN_DELETE_SELF | _IN_MOVE_SELF):
+                    dirs.add(rel_dir)
+            elif mask & _IN_ISDIR:
+                rel = _join(rel_dir, name)
+                if mask & (_IN_CREATE | _IN_MOVED_TO):
+                    self._watch_tree(side, rel)
+                    dirs.add(rel)
+                elif mask & (_IN_DELETE | _IN_MOVED_FROM):
+                    self._unwatch_tree(side, rel)
+                    dirs.add(rel)
+            else:
+                files.add(_join(rel_dir, name))
+        return overflow
+
+    def close(self) -> None:
+        os.close(self._fd)
+
+
+class _Poll:
+    """Rescan both trees every *interval* seconds and diff the stats."""
+
+    def __init__(self, roots: tuple[str, str], follow_symlinks: bool, interval: float) -> None:
+        self._roots = roots
+        self._follow = follow_symlinks
+        self._interval = interval
+        self._stats = [self._scan(root) for root in roots]
+        self._next = time.monotonic() + interval
+
+    def _scan(self, root: str) -> dict[str, tuple[int, int]]:
+        try:
+            return _scan(root, self._follow)[0]
+        except NotADirectoryError:
+            return {}  # the root itself was removed
+
+    def wait(self, timeout: float) -> _Changes | None:
+        delay = self._next - time.monotonic()
+        if delay > timeout:
+            time.sleep(timeout)
+            return None
+        if delay > 0:
+            time.sleep(delay)
+        self._next = time.monotonic() + self._interval
+        files: set[str] = set()
+        for side, root in enumerate(self._roots):
+            old, new = self._stats[side], self._scan(root)
+            files |= {p for p in old.keys() | new.keys() if old.get(p) != new.get(p)}
+            self._stats[side] = new
+        return files, set(), False
+
+    def close(self) -> None:
+        pass
+
+
+class Watcher:
+    """Keep two directory trees compared while they change.
+
+    The trees are compared once in full when the watcher is created;
+    after that only paths reported changed are compared again, and an
+    event is produced whenever the outcome differs from the last one.
+    On Linux changes come from inotify; elsewhere, or with
+    ``backend="poll"``, both trees are rescanned every *interval* seconds.
+
+    Iterate over the watcher to receive :class:`WatchEvent` objects until
+    :meth:`close` is called, or call :meth:`poll` to wait for one at a time.
+
+    :param dir_a: First directory.
+    :param dir_b: Second directory.
+    :param interval: Seconds between rescans of the poll backend.
+    :param chunk_size: Chunk size for file comparison.
+    :param follow_symlinks: Follow symbolic links during traversal.
+    :param exclude: Gitignore-style patterns of paths to leave out.
+    :param include: Gitignore-style patterns; only matching files are compared.
+    :param backend: ``"auto"``, ``"inotify"`` (Linux only) or ``"poll"``.
+    :raises ValueError: If an argument is invalid or the backend is not
+        available here.
+    :raises NotADirectoryError: If either path is not a directory.
+    :raises OSError: If the inotify watch limit is reached.
+    """
+
+    def __init__(
+        self,
+        dir_a: str,
+        dir_b: str,
+        *,
+        interval: float = 1.0,
+        chunk_size: int = 65536,
+        follow_symlinks: bool = True,
+        exclude: list[str] | None = None,
+        include: list[str] | None = None,
+        backend: str = "auto",
+    ) -> None:
+        validate_path(dir_a, "dir_a")
+        validate_path(dir_b, "dir_b")
+        validate_chunk_size(chunk_size)
+        validate_patterns(exclude, "exclude")
+        validate_patterns(include, "include")
+        if not isinstance(interval, (int, float)) or interval <= 0:
+            raise ValueError(f"interval must be positive, got {interval!r}")
+        if backend not in BACKENDS:
+            raise ValueError(f"backend must be one of {', '.join(BACKENDS)}, got {backend!r}")
+        for d in (dir_a, dir_b):
+            if not os.path.isdir(d):
+                raise NotADirectoryError(f"not a directory: {d!r}")
+        libc = None if backend == "poll" else _inotify_libc()
+        if backend == "inotify" and libc is None:
+            raise ValueError("the inotify backend is only available on Linux")
+
+        self._roots = (dir_a, dir_b)
+        self._chunk_size = chunk_size
+        self._follow = follow_symlinks
+        self._exclude = exclude
+        self._include = include
+        self._keep = walk_filter(exclude, include)
+        self._lock = threading.Lock()
+        self._closed = False
+        # Watch before the first comparison, so no change slips in between
+        if libc is not None:
+            self._backend: _Inotify | _Poll = _Inotify(libc, self._roots, follow_symlinks)
+            self.backend = "inotify"
+        else:
+            self._backend = _Poll(self._roots, follow_symlinks, interval)
+            self.backend = "poll"
+        try:
+            self._rescan()
+        except BaseException:
+            self._backend.close()
+            raise
+
+    @property
+    def result(self) -> DirResult:
+        """The comparison as of the last event (or creation)."""
+        return DirResult(
+            equal=not (self._diff or self._only_left or self._only_right or self._errors),
+            diff={p: self._diff[p] for p in sorted(self._diff)},
+            only_left=set(self._only_left),
+            only_right=set(self._only_right),
+            errors=set(self._errors),
+        )
+
+    def _rescan(self) -> None:
+        result = compare_dir(*self._roots, chunk_size=self._chunk_size,
+                             follow_symlinks=self._follow,
+                             exclude=self._exclude, include=self._include)
+        self._diff = dict(result.diff)
+        self._only_left = set(result.only_left)
+        self._only_right = set(result.only_right)
+        self._errors = set(result.errors)
+
+    def _is_file(self, side: int, rel: str) -> bool:
+        path = os.path.join(self._roots[side], rel)
+        try:
+            st = os.stat(path) if self._follow else os.lstat(path)
+        except OSError:
+            return False
+        return stat.S_ISREG(st.st_mode)
+
+    def _compare(self, rel: str) -> DiffReason | None:
+        a, b = (os.path.join(root, rel) for root in self._roots)
+        try:
+            if os.path.getsize(a) != os.path.getsize(b):
+                return DiffReason.SIZE_MISMATCH
+            equal = compare(a, b, chunk_size=self._chunk_size)
+        except (OSError, KomparuError):
+            return DiffReason.READ_ERROR  # a later event re-compares it
+        return None if equal else DiffReason.CONTENT_MISMATCH
+
+    def _update(self, rel: str) -> None:
+        self._diff.pop(rel, None)
+        self._only_left.discard(rel)
+        self._only_right.discard(rel)
+        in_a, in_b = self._is_file(0, rel), self._is_file(1, rel)
+        if in_a and in_b:
+            reason = self._compare(rel)
+            if reason is not None:
+                self._diff[rel] = reason
+        elif in_a:
+            self._only_left.add(rel)
+        elif in_b:
+            self._only_right.add(rel)
+
+    def _under(self, rel_dir: str) -> set[str]:
+        """Paths below *rel_dir* now on either side or known to differ."""
+        prefix = rel_dir + "/" if rel_dir else ""
+        known = self._diff.keys() | self._only_left | self._only_right
+        paths = {p for p in known if p.startswith(prefix)}
+        for root in self._roots:
+            top = os.path.join(root, rel_dir) if rel_dir else root
+            if os.path.isdir(top):
+                paths.update(prefix + p for p in _scan(top, self._follow)[0])
+        return paths
+
+    def _apply(self, changes: _Changes) -> WatchEvent | None:
+        files, dirs, full = changes
+        before = self.result
+        if full:
+            self._rescan()
+            after = self.result
+            paths = (before.diff.keys() | before.only_left | before.only_right
+                     | after.diff.keys() | after.only_left | after.only_right)
+        else:
+            paths = set(files)
+            for d in dirs:
+                paths |= self._under(d)
+            if self._keep is not None:
+                paths = {p for p in paths if self._keep(p)}
+            for p in paths:
+                self._update(p)
+            after = self.result
+        if after == before:
+            return None
+        kind = "converged" if after.equal else "diverged" if before.equal else "changed"
+        return WatchEvent(kind=kind, result=after, changed=frozenset(paths))
+
+    def poll(self, timeout: float | None = None) -> WatchEvent | None:
+        """Wait for the next change in how the trees compare.
+
+        :param timeout: Seconds to wait; None waits until an event or
+            :meth:`close`.
+        :returns: The event, or None on timeout or once closed.
+        """
+        deadline = None if timeout is None else time.monotonic() + timeout
+        while True:
+            wait = _SLICE if deadline is None else min(_SLICE, deadline - time.monotonic())
+            with self._lock:
+                if self._closed:
+                    return None
+                changes = self._backend.wait(max(wait, 0.0))
+                event = None if changes is None else self._apply(changes)
+            if event is not None:
+                return event
+            if deadline is not None and time.monotonic() >= deadline:
+                return None
+
+    def __iter__(self) -> Iterator[WatchEvent]:
+        while not self._closed:
+            event = self.poll(_SLICE)
+            if event is not None:
+                yield event
+
+    def close(self) -> None:
+        """Stop watching; safe to call from another thread and more than once."""
+        if self._closed:
+            return
+        self._closed = True
+        with self._lock:
+            self._backend.close()
+
+    def __enter__(self) -> Watcher:
+        return self
+
+    def __exit__(
+        self,
+        exc_type: type[BaseException] | None,
+        exc: BaseException | None,
+        tb: TracebackType | None,
+    ) -> None:
+        self.close()
@@ -19,6 +19,7 @@ from __future__ import annotations
 import asyncio
 from typing import Any
 
+from komparu._api import _use_python_decompress
 from komparu._config import get_config
 from komparu._core import (
     async_compare_start,
@@ -31,8 +32,13 @@ from komparu._core import (
     async_compare_dir_urls_result,
 )
 from komparu._types import CompareResult, DirResult, Source
-from komparu._validate import validate_path, validate_chunk_size, validate_timeout, validate_max_workers
-from komparu._helpers import build_dir_result, filter_dir_result
+from komparu._validate import (
+    validate_path, validate_chunk_size, validate_timeout, validate_max_workers,
+    validate_skip, validate_decode,
+)
+from komparu._helpers import (
+    build_dir_result, equivalence_map, filter_dir_result, side_byte_maps, slash_keys,
+)
 
 
 def _source_path(source: str | Source) -> str:
@@ -79,6 +85,16 @@ async def compare(
     follow_redirects: bool = True,
     verify_ssl: bool = True,
     proxy: str | None = None,
+    header_skip: int = 0,
+    footer_skip: int = 0,
+    decode_a: str = "none",
+    decode_b: str = "none",
+    decompress: bool = False,
+    collapse_zero_runs: bool = False,
+    equivalence_classes: list[bytes] | None = None,
+    case_fold: bool = False,
+    translate_a: bytes | None = None,
+    translate_b: bytes | None = None,
 ) -> bool:
     """Compare two sources byte-by-byte (async).
 
@@ -87,17 +103,51 @@ async def compare(
     :param source_a: File path, URL, or Source object.
     :param source_b: File path, URL, or Source object.
     :param proxy: Proxy URL (e.g. http://host:port, socks5://host:port).
+    :param header_skip: Bytes to ignore at the start of each source.
+    :param footer_skip: Bytes to ignore at the end of each source.
+    :param decode_a: Decode source_a before comparing: "none", "base64" or "hex".
+    :param decode_b: Decode source_b before comparing: "none", "base64" or "hex".
+    :param decompress: Compare gzip/bzip2/xz/zstd sources by decompressed
+        content. A local file matching a register_decompressor magic
+        raises ValueError, since that format is only read in Python; use
+        komparu.compare for it.
+    :param collapse_zero_runs: Fuzzy mode: a run of zero bytes matches a
+        zero run of any length on the other side. Files of different total
+        size can compare equal.
+    :param equivalence_classes: Fuzzy mode: groups of byte values that
+        compare equal (e.g. ``[b"\\t "]``). Not byte-exact.
+    :param case_fold: Fuzzy mode: ASCII letters compare case-insensitively
+        (``SELECT`` equals ``select``); other bytes are untouched. Folded
+        chunk by chunk while streaming.
+    :param translate_a: 256-byte table applied to each byte of source_a
+        before equivalence_classes/case_fold.
+    :param translate_b: Same for source_b.
     :returns: True if sources are byte-identical.
+    :raises DecodeError: If a decoded source is not valid base64/hex.
+    :raises ValueError: If decompress is set and a local file matches a
+        registered decompressor.
     """
     validate_path(source_a, "source_a")
     validate_path(source_b, "source_b")
     validate_chunk_size(chunk_size)
     validate_timeout(timeout)
+    validate_skip(header_skip, "header_skip")
+    validate_skip(footer_skip, "footer_skip")
+    validate_decode(decode_a, "decode_a")
+    validate_decode(decode_b, "decode_b")
+    byte_map, byte_map_b = side_byte_maps(
+        equivalence_map(equivalence_classes, case_fold), translate_a, translate_b,
+    )
 
     cfg = get_config()
 
     path_a = _source_path(source_a)
     path_b = _source_path(source_b)
+    if decompress and _use_python_decompress(path_a, path_b):
+        raise ValueError(
+            "registered decompressors are not supported by komparu.aio; "
+            "use komparu.compare"
+        )
 
     h = headers if headers is not None else (cfg.headers or None)
     p = proxy if proxy is not None else cfg.proxy
@@ -113,6 +163,14 @@ async def compare(
         verify_ssl=verify_ssl,
         allow_private=cfg.allow_private_redirects,
         proxy=p,
+        header_skip=header_skip,
+        footer_skip=footer_skip,
+        decode_a=decode_a,
+        decode_b=decode_b,
+        decompress=decompress,
+        collapse_zero_runs=collapse_zero_runs,
+        byte_map=byte_map,
+        byte_map_b=byte_map_b,
     )
 
     return await _await_task(fd, lambda: async_compare_result(task))
@@ -128,6 +186,7 @@ async def compare_dir(
     follow_symlinks: bool = True,
     max_workers: int = 0,
     ignore: list[str] | None = None,
+    special_files: bool = False,
 ) -> DirResult:
     """Compare two directories recursively (async).
 
@@ -136,6 +195,8 @@ async def compare_dir(
     :param dir_a: Path to first directory.
     :param dir_b: Path to second directory.
     :param ignore: Glob patterns to exclude (matched per path component).
+    :param special_files: Include FIFOs, sockets and device nodes, compared
+        by type (and major/minor for devices) instead of content.
     :returns: DirResult with equal, diff, only_left, only_right.
     """
     validate_path(dir_a, "dir_a")
@@ -150,6 +211,7 @@ async def compare_dir(
         quick_check=quick_check,
         follow_symlinks=follow_symlinks,
         max_workers=max_workers,
+        special_files=special_files,
     )
 
     raw = await _await_task(fd, lambda: async_compare_dir_result(task))
@@ -335,7 +397,7 @@ async def compare_dir_urls(
     p = proxy if proxy is not None else cfg.proxy
 
     fd, task = async_compare_dir_urls_start(
-        dir_path, url_map,
+        dir_path, slash_keys(url_map, "url_map"),
         chunk_size=chunk_size,
         size_precheck=size_precheck,
         quick_check=quick_check,
@@ -2,6 +2,7 @@
 
 from __future__ import annotations
 
+import base64
 import io
 import os
 import tarfile
@@ -61,6 +62,58 @@ class TestAsyncCompare:
         b.write_bytes(b"much longer content")
         assert await komparu.aio.compare(str(a), str(b)) is False
 
+    @pytest.mark.asyncio
+    async def test_header_footer_skip(self, tmp_path: Path):
+        body = os.urandom(4096)
+        a = tmp_path / "a.bin"
+        b = tmp_path / "b.bin"
+        a.write_bytes(b"HDR1" + body + b"F1")
+        b.write_bytes(b"HDR2" + body + b"F2")
+        assert await komparu.aio.compare(str(a), str(b)) is False
+        assert await komparu.aio.compare(
+            str(a), str(b), header_skip=4, footer_skip=2,
+        ) is True
+
+    @pytest.mark.asyncio
+    async def test_decode_base64(self, tmp_path: Path):
+        raw = os.urandom(2048)
+        a = tmp_path / "a.bin"
+        b = tmp_path / "b.b64"
+        a.write_bytes(raw)
+        b.write_bytes(base64.b64encode(raw))
+        assert await komparu.aio.compare(str(a), str(b), decode_b="base64") is True
+        b.write_bytes(b"!" + base64.b64encode(raw))
+        with pytest.raises(komparu.DecodeError):
+            await komparu.aio.compare(str(a), str(b), decode_b="base64")
+
+    @pytest.mark.asyncio
+    async def test_equivalence_classes(self, tmp_path: Path):
+        a = tmp_path / "a.txt"
+        b = tmp_path / "b.txt"
+        a.write_bytes(b"\tindented\n")
+        b.write_bytes(b" indented\n")
+        assert await komparu.aio.compare(str(a), str(b)) is False
+        assert await komparu.aio.compare(
+            str(a), str(b), equivalence_classes=[b"\t "],
+        ) is True
+
+    @pytest.mark.asyncio
+    async def test_case_fold(self, tmp_path: Path):
+        a = tmp_path / "a.sql"
+        b = tmp_path / "b.sql"
+        a.write_bytes(b"SELECT 1;\n")
+        b.write_bytes(b"select 1;\n")
+        assert await komparu.aio.compare(str(a), str(b), case_fold=True) is True
+
+    @pytest.mark.asyncio
+    async def test_translate(self, tmp_path: Path):
+        a = tmp_path / "a.dat"
+        b = tmp_path / "b.dat"
+        a.write_bytes("HELLO".encode("cp500"))
+        b.write_bytes(b"HELLO")
+        table = bytes(range(256)).decode("cp500").encode("latin-1")
+        assert await komparu.aio.compare(str(a), str(b), translate_a=table) is True
+
     @pytest.mark.asyncio
     async def test_large_file(self, tmp_path: Path):
         content = os.urandom(256 * 1024)
@@ -119,6 +172,22 @@ class TestAsyncCompare:
         url = httpserver.url_for("/f.txt")
         assert await komparu.aio.compare(str(a), url) is False
 
+    @pytest.mark.asyncio
+    async def test_registered_decompressor_rejected(self, tmp_path: Path):
+        from komparu import _decompress
+
+        a = tmp_path / "a.rev"
+        a.write_bytes(b"REV!cba")
+        b = tmp_path / "b.bin"
+        b.write_bytes(b"abc")
+        komparu.register_decompressor(b"REV!", lambda f: io.BytesIO(f.read()[4:][::-1]))
+        try:
+            with pytest.raises(ValueError, match="registered decompressors"):
+                await komparu.aio.compare(str(a), str(b), decompress=True)
+            assert await komparu.aio.compare(str(a), str(b)) is False
+        finally:
+            _decompress._custom.clear()
+
 
 # =========================================================================
 # compare — concurrent async comparisons
@@ -225,6 +294,14 @@ class TestAsyncCompareDir:
         result = await komparu.aio.compare_dir(str(a), str(b))
         assert result.equal is True
 
+    @pytest.mark.asyncio
+    async def test_special_files(self, make_dir):
+        a = make_dir("a", {"entry": b"data", "f.txt": b"x"})
+        b = make_dir("b", {"f.txt": b"x"})
+        os.mkfifo(b / "entry")
+        result = await komparu.aio.compare_dir(str(a), str(b), special_files=True)
+        assert result.diff == {"entry": DiffReason.TYPE_MISMATCH}
+
 
 # =========================================================================
 # compare_archive — async archive comparison
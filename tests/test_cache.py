@@ -0,0 +1,176 @@
+"""Tests for the persistent digest cache behind compare_dir(cache=...)."""
+
+from __future__ import annotations
+
+import os
+import sqlite3
+import time
+
+import pytest
+
+import komparu
+from komparu import DiffReason
+
+_HOUR_AGO = time.time() - 3600
+
+
+def _tree(root, files):
+    for rel, data in files.items():
+        path = root / rel
+        path.parent.mkdir(parents=True, exist_ok=True)
+        path.write_bytes(data)
+        os.utime(path, (_HOUR_AGO, _HOUR_AGO))
+    return root
+
+
+class TestCompareDirCached:
+    """Unchanged files are compared by their cached digests."""
+
+    def test_second_run_reads_nothing(self, tmp_path):
+        files = {"a.txt": b"alpha", "sub/b.bin": b"\0" * 3000}
+        a = _tree(tmp_path / "a", files)
+        b = _tree(tmp_path / "b", files)
+        with komparu.DigestCache(str(tmp_path / "cache")) as cache:
+            assert komparu.compare_dir(str(a), str(b), cache=cache).equal is True
+            assert (cache.hits, cache.misses, len(cache)) == (0, 4, 4)
+            assert komparu.compare_dir(str(a), str(b), cache=cache).equal is True
+            assert (cache.hits, cache.misses) == (4, 4)
+            assert cache.bytes_hashed == 2 * (5 + 3000)
+
+    def test_matches_compare_dir(self, tmp_path):
+        a = _tree(tmp_path / "a", {"same": b"1", "content": b"ab", "size": b"a",
+                                   "left": b"", "d/e/deep": b"x"})
+        b = _tree(tmp_path / "b", {"same": b"1", "content": b"ac", "size": b"aa",
+                                   "right": b"", "d/e/deep": b"y"})
+        cache = str(tmp_path / "cache")
+        for options in ({}, {"exclude": ["d/"]}, {"include": ["s*"]}, {"max_depth": 0}):
+            assert (komparu.compare_dir(str(a), str(b), cache=cache, **options)
+                    == komparu.compare_dir(str(a), str(b), **options))
+
+    def test_dangling_links_match_compare_dir(self, tmp_path):
+        a = _tree(tmp_path / "a", {"file": b"1"})
+        b = _tree(tmp_path / "b", {"file": b"1", "link": b"1"})
+        for name, target in (("dang", "gone"), ("same", "gone"), ("link", "gone"),
+                             ("moved", "gone")):
+            os.symlink(target, a / name)
+        os.symlink("gone", b / "same")
+        os.symlink("elsewhere", b / "moved")
+        cache = str(tmp_path / "cache")
+        for symlinks in ("follow", "skip", None):
+            assert (komparu.compare_dir(str(a), str(b), cache=cache, symlinks=symlinks)
+                    == komparu.compare_dir(str(a), str(b), symlinks=symlinks))
+        result = komparu.compare_dir(str(a), str(b), cache=cache)
+        assert result.only_left == {"dang"}
+        assert result.diff == {"link": DiffReason.BROKEN_SYMLINK,
+                               "moved": DiffReason.BROKEN_SYMLINK}
+
+    @pytest.mark.skipif(os.geteuid() == 0, reason="root can read any file")
+    def test_unreadable_file_is_read_error(self, tmp_path):
+        a = _tree(tmp_path / "a", {"ok": b"1", "secret": b"2"})
+        b = _tree(tmp_path / "b", {"ok": b"1", "secret": b"2"})
+        os.chmod(b / "secret", 0)
+        try:
+            result = komparu.compare_dir(str(a), str(b), cache=str(tmp_path / "cache"))
+            assert result == komparu.compare_dir(str(a), str(b))
+        finally:
+            os.chmod(b / "secret", 0o644)
+        assert result.diff == {"secret": DiffReason.READ_ERROR}
+
+    def test_change_with_restored_mtime(self, tmp_path):
+        a = _tree(tmp_path / "a", {"f": b"1234"})
+        b = _tree(tmp_path / "b", {"f": b"1234"})
+        cache = str(tmp_path / "cache")
+        assert komparu.compare_dir(str(a), str(b), cache=cache).equal is True
+        st = os.stat(b / "f")
+        (b / "f").write_bytes(b"1235")
+        os.utime(b / "f", ns=(st.st_atime_ns, st.st_mtime_ns))  # ctime still moves
+        result = komparu.compare_dir(str(a), str(b), cache=cache)
+        assert result.diff == {"f": DiffReason.CONTENT_MISMATCH}
+
+    def test_replaced_file(self, tmp_path):
+        a = _tree(tmp_path / "a", {"f": b"old"})
+        b = _tree(tmp_path / "b", {"f": b"old"})
+        cache = str(tmp_path / "cache")
+        komparu.compare_dir(str(a), str(b), cache=cache)
+        _tree(tmp_path / "new", {"f": b"new"})
+        os.replace(tmp_path / "new" / "f", b / "f")  # another inode, same size and mtime
+        result = komparu.compare_dir(str(a), str(b), cache=cache)
+        assert result.diff == {"f": DiffReason.CONTENT_MISMATCH}
+
+    def test_fresh_files_not_stored(self, tmp_path):
+        a = tmp_path / "a"
+        a.mkdir()
+        (a / "f").write_bytes(b"just written")
+        with komparu.DigestCache(str(tmp_path / "cache")) as cache:
+            assert komparu.compare_dir(str(a), str(a), cache=cache).equal is True
+            assert len(cache) == 0
+
+    def test_cancelled(self, tmp_path):
+        a = _tree(tmp_path / "a", {"f": b"1"})
+        token = komparu.CancelToken()
+        token.cancel()
+        with pytest.raises(komparu.CancelledError):
+            komparu.compare_dir(str(a), str(a), cache=str(tmp_path / "cache"), cancel=token)
+
+    def test_rejected_options(self, tmp_path):
+        a = _tree(tmp_path / "a", {})
+        cache = str(tmp_path / "cache")
+        with pytest.raises(ValueError, match="special_files"):
+            komparu.compare_dir(str(a), str(a), cache=cache, special_files=True)
+        with pytest.raises(ValueError, match="compare-link"):
+            komparu.compare_dir(str(a), str(a), cache=cache, symlinks="compare-link")
+        with pytest.raises(ValueError, match="on_progress"):
+            komparu.compare_dir(str(a), str(a), cache=cache, on_progress=print)
+        for option in ({"size_precheck": False}, {"quick_check": False}, {"max_memory": 1 << 20}):
+            with pytest.raises(ValueError, match=next(iter(option))):
+                komparu.compare_dir(str(a), str(a), cache=cache, **option)
+        with pytest.raises(TypeError, match="DigestCache"):
+            komparu.compare_dir(str(a), str(a), cache=42)
+
+
+class TestHashDirCached:
+    """hash_dir(cache=...) returns the digests hash_dir computes."""
+
+    def test_same_digests(self, tmp_path):
+        root = _tree(tmp_path / "t", {"a": b"a", "sub/b": b"bb"})
+        cache = komparu.DigestCache(str(tmp_path / "cache"))
+        assert komparu.hash_dir(str(root), cache=cache) == komparu.hash_dir(str(root))
+        assert komparu.hash_dir(str(root), cache=cache) == komparu.hash_dir(str(root))
+        assert cache.hits == 2
+        cache.close()
+
+
+class TestDigestCache:
+    """The cache file survives runs and is rebuilt when unusable."""
+
+    def test_persists_and_clears(self, tmp_path):
+        root = _tree(tmp_path / "t", {"a": b"a"})
+        cache_dir = str(tmp_path / "deep" / "cache")
+        komparu.hash_dir(str(root), cache=cache_dir)
+        with komparu.DigestCache(cache_dir) as cache:
+            assert len(cache) == 1
+            cache.clear()
+            assert len(cache) == 0
+
+    def test_damaged_file_rebuilt(self, tmp_path):
+        root = _tree(tmp_path / "t", {"a": b"a"})
+        cache = komparu.DigestCache(str(tmp_path / "cache"))
+        path = cache.path
+        cache.close()
+        with open(path, "wb") as f:
+            f.write(b"not a database" * 100)
+        with komparu.DigestCache(str(tmp_path / "cache")) as cache:
+            assert len(cache) == 0
+            komparu.hash_dir(str(root), cache=cache)
+            assert len(cache) == 1
+
+    def test_other_version_rebuilt(self, tmp_path):
+        root = _tree(tmp_path / "t", {"a": b"a"})
+        cache_dir = str(tmp_path / "cache")
+        komparu.hash_dir(str(root), cache=cache_dir)
+        db = sqlite3.connect(os.path.join(cache_dir, os.listdir(cache_dir)[0]))
+        db.execute("PRAGMA user_version = 999")
+        db.commit()
+        db.close()
+        with komparu.DigestCache(cache_dir) as cache:
+            assert len(cache) == 0
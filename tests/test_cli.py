@@ -0,0 +1,628 @@
+"""Tests for the command-line interface."""
+
+from __future__ import annotations
+
+import json
+import os
+import sys
+import tarfile
+import threading
+from pathlib import Path
+
+import pytest
+
+import komparu
+from komparu._cli import main
+from komparu._config import reset_config
+
+
+@pytest.fixture
+def make_dir(tmp_path: Path):
+    """Create a directory tree from a dict of {relative_path: content}."""
+
+    def _make(name: str, files: dict[str, bytes]) -> Path:
+        d = tmp_path / name
+        d.mkdir(parents=True, exist_ok=True)
+        for rel, content in files.items():
+            p = d / rel
+            p.parent.mkdir(parents=True, exist_ok=True)
+            p.write_bytes(content)
+        return d
+
+    return _make
+
+
+class TestFiles:
+    """Two file arguments compare the files."""
+
+    def test_equal(self, make_file, capsys):
+        a = make_file("a.txt", b"same")
+        b = make_file("b.txt", b"same")
+        assert main([str(a), str(b)]) == 0
+        assert capsys.readouterr().out == ""
+
+    def test_different(self, make_file, capsys):
+        a = make_file("a.txt", b"one")
+        b = make_file("b.txt", b"two")
+        assert main([str(a), str(b)]) == 1
+        assert capsys.readouterr().out == f"{a} and {b} differ\n"
+
+    def test_verbose_equal(self, make_file, capsys):
+        a = make_file("a.txt", b"same")
+        b = make_file("b.txt", b"same")
+        assert main(["-v", str(a), str(b)]) == 0
+        assert capsys.readouterr().out == "1 file compared, 8 bytes read, equal\n"
+
+    def test_verbose_different(self, make_file, capsys):
+        a = make_file("a.txt", b"one")
+        b = make_file("b.txt", b"two")
+        assert main(["--verbose", str(a), str(b)]) == 1
+        assert capsys.readouterr().out == f"{a} and {b} differ\n"
+
+    def test_missing(self, tmp_path, make_file, capsys):
+        a = make_file("a.txt", b"data")
+        assert main([str(a), str(tmp_path / "nope")]) == 2
+        assert "nope" in capsys.readouterr().err
+
+    def test_first_diff(self, make_file, capsys):
+        a = make_file("a.bin", b"\0" * 20 + b"A" + b"\0" * 20)
+        b = make_file("b.bin", b"\0" * 20 + b"B" + b"\0" * 20)
+        assert main(["--first-diff", str(a), str(b)]) == 1
+        lines = capsys.readouterr().out.splitlines()
+        assert lines[0] == f"{a} and {b} differ at offset 20"
+        ctx = " ".join(["00"] * 8)
+        assert lines[1] == f"  {a} @ 12: {ctx} [41] {ctx}"
+        assert lines[2] == f"  {b} @ 12: {ctx} [42] {ctx}"
+
+    def test_first_diff_past_end(self, make_file, capsys):
+        a = make_file("a.bin", b"ab")
+        b = make_file("b.bin", b"abc")
+        assert main(["--first-diff", str(a), str(b)]) == 1
+        lines = capsys.readouterr().out.splitlines()
+        assert lines[0].endswith("differ at offset 2")
+        assert lines[1].endswith(": 61 62 [EOF]")
+        assert lines[2].endswith(": 61 62 [63]")
+
+    def test_first_diff_equal(self, make_file, capsys):
+        a = make_file("a.txt", b"same")
+        b = make_file("b.txt", b"same")
+        assert main(["--first-diff", str(a), str(b)]) == 0
+        assert capsys.readouterr().out == ""
+
+    def test_strategy(self, make_file):
+        a = make_file("a.bin", b"x" * 100_000)
+        b = make_file("b.bin", b"x" * 99_999 + b"y")
+        for strategy in ("auto", "mmap", "buffered", "prefetch"):
+            assert main(["--strategy", strategy, str(a), str(a)]) == 0
+            assert main(["--strategy", strategy, str(a), str(b)]) == 1
+
+    def test_stats(self, make_file, capsys):
+        a = make_file("a.bin", b"0123456789" * 100)
+        b = make_file("b.bin", b"0123X56789" * 50 + b"0123456789" * 50)
+        assert main(["--stats", str(a), str(b)]) == 1
+        assert capsys.readouterr().out == (
+            f"{a} and {b}: 50 of 1000 bytes differ in 50 ranges, first at offset 4 (95.00% similar)\n"
+        )
+        assert main(["--stats", str(a), str(a)]) == 0
+        assert capsys.readouterr().out == f"{a} and {a}: 0 of 1000 bytes differ (100.00% similar)\n"
+        big = make_file("big.bin", b"x" * 100_000)
+        near = make_file("near.bin", b"x" * 99_999 + b"y")
+        assert main(["--stats", str(big), str(near)]) == 1
+        assert "(99.99% similar)" in capsys.readouterr().out
+
+    def test_stats_rejected(self, make_file, make_dir, capsys):
+        a = make_file("a.bin", b"x")
+        d = make_dir("d", {"f": b"x"})
+        assert main(["--stats", str(d), str(d)]) == 2
+        assert "--stats needs two files" in capsys.readouterr().err
+        assert main(["--stats", "--first-diff", str(a), str(a)]) == 2
+        assert "cannot be combined with --first-diff" in capsys.readouterr().err
+
+    def test_range(self, make_file, capsys):
+        a = make_file("a.bin", b"HDR1" + b"x" * 96)
+        b = make_file("b.bin", b"HDR2" + b"x" * 96)
+        assert main([str(a), str(b)]) == 1
+        capsys.readouterr()
+        assert main(["--offset", "4", str(a), str(b)]) == 0
+        assert main(["--offset", "4", "--length", "10", "-v", str(a), str(b)]) == 0
+        assert capsys.readouterr().out == "1 file compared, 20 bytes read, equal\n"
+        assert main(["--length", "4", str(a), str(b)]) == 1
+        assert capsys.readouterr().out == f"{a} and {b} differ\n"
+        for strategy in ("mmap", "buffered"):
+            assert main(["--strategy", strategy, "--offset", "4", str(a), str(b)]) == 0
+
+    def test_range_rejected(self, make_file, make_dir, capsys):
+        a = make_file("a.bin", b"x" * 10)
+        d = make_dir("d", {"f": b"x"})
+        assert main(["--offset", "8", "--length", "4", str(a), str(a)]) == 2
+        assert "range 8-12 extends past the end" in capsys.readouterr().err
+        assert main(["--offset", "-1", str(a), str(a)]) == 2
+        assert "offset must be non-negative" in capsys.readouterr().err
+        assert main(["--length", "1", str(d), str(d)]) == 2
+        assert "--offset/--length needs two files" in capsys.readouterr().err
+        assert main(["--offset", "1", "--first-diff", str(a), str(a)]) == 2
+        assert "cannot be combined with --first-diff" in capsys.readouterr().err
+        assert main(["--offset", "1", "--stats", str(a), str(a)]) == 2
+        assert "--stats cannot be combined with --offset/--length" in capsys.readouterr().err
+
+    def test_sigint_cancels(self, tmp_path, capsys):
+        import os
+        import signal
+        import threading
+        import time
+
+        for name in ("a.img", "b.img"):
+            with open(tmp_path / name, "wb") as f:
+                f.truncate(8 << 30)  # sparse
+        komparu.configure(skip_holes=False)
+        threading.Timer(0.2, os.kill, (os.getpid(), signal.SIGINT)).start()
+        start = time.monotonic()
+        try:
+            assert main(["--no-quick-check", str(tmp_path / "a.img"), str(tmp_path / "b.img")]) == 130
+        finally:
+            reset_config()
+        assert time.monotonic() - start < 3
+        assert capsys.readouterr().err == "komparu: interrupted\n"
+
+    def test_progress(self, make_file, capsys):
+        a = make_file("a.bin", b"x" * 5000)
+        b = make_file("b.bin", b"x" * 4999 + b"y")
+        assert main(["--progress", str(a), str(b)]) == 1
+        captured = capsys.readouterr()
+        assert captured.out == f"{a} and {b} differ\n"
+        last = captured.err.splitlines()[-1]
+        assert last.startswith("100.0%  4.9 KiB / 4.9 KiB  ")
+        assert "ETA 0:00" in last and last.endswith(str(a))
+
+
+class TestDirs:
+    """Two directory arguments compare the trees."""
+
+    def test_per_file_output(self, make_dir, capsys):
+        a = make_dir("a", {"same": b"x", "changed": b"1", "left": b"l"})
+        b = make_dir("b", {"same": b"x", "changed": b"2", "right": b"r"})
+        assert main([str(a), str(b)]) == 1
+        assert capsys.readouterr().out == (
+            "differ: changed (content_mismatch)\n"
+            "only in A: left\n"
+            "only in B: right\n"
+        )
+
+    def test_equal(self, make_dir, capsys):
+        a = make_dir("a", {"f": b"data"})
+        b = make_dir("b", {"f": b"data"})
+        assert main([str(a), str(b)]) == 0
+        assert capsys.readouterr().out == ""
+
+    def test_verbose_equal(self, make_dir, capsys):
+        a = make_dir("a", {"f": b"data", "sub/g": b"more"})
+        b = make_dir("b", {"f": b"data", "sub/g": b"more"})
+        assert main(["-v", "--no-quick-check", str(a), str(b)]) == 0
+        assert capsys.readouterr().out == "2 files compared, 16 bytes read, equal\n"
+
+    def test_verbose_different_lists_paths(self, make_dir, capsys):
+        a = make_dir("a", {"same": b"x", "changed": b"1"})
+        b = make_dir("b", {"same": b"x", "changed": b"2"})
+        assert main(["-v", str(a), str(b)]) == 1
+        assert capsys.readouterr().out == "differ: changed (content_mismatch)\n"
+
+    def test_summary_only(self, make_dir, capsys):
+        a = make_dir("a", {f"d{i}": b"a" for i in range(5)} | {"left": b""})
+        b = make_dir("b", {f"d{i}": b"b" for i in range(5)})
+        assert main(["--summary-only", str(a), str(b)]) == 1
+        out = capsys.readouterr().out
+        assert "d0" not in out
+        lines = dict(line.split(":", 1) for line in out.splitlines())
+        assert lines["compared"].strip() == "5"
+        assert lines["differing"].strip() == "5"
+        assert lines["only in A"].strip() == "1"
+        assert lines["only in B"].strip() == "0"
+        assert int(lines["bytes read"]) > 0
+        assert lines["duration"].strip().endswith("s")
+
+    def test_summary_only_equal_exit_code(self, make_dir, capsys):
+        a = make_dir("a", {"f": b"data"})
+        b = make_dir("b", {"f": b"data"})
+        assert main(["-s", str(a), str(b)]) == 0
+        assert "differing:  0" in capsys.readouterr().out
+
+    def test_jobs(self, make_dir, capsys):
+        files = {f"f{i}": b"x" for i in range(20)}
+        a = make_dir("a", files)
+        b = make_dir("b", files | {"f7": b"y"})
+        for jobs in ("1", "4"):
+            assert main(["-j", jobs, str(a), str(b)]) == 1
+            assert capsys.readouterr().out == "differ: f7 (content_mismatch)\n"
+
+    def test_jobs_invalid(self, make_dir, capsys):
+        a = make_dir("a", {"f": b"x"})
+        assert main(["--jobs", "-1", str(a), str(a)]) == 2
+        assert "max_workers" in capsys.readouterr().err
+
+    @pytest.mark.skipif(not Path("/proc/self/mem").exists(), reason="needs /proc/self/mem")
+    def test_stop_on_error(self, make_dir, capsys):
+        a = make_dir("a", {"ok": b"1"})
+        b = make_dir("b", {"ok": b"1", "m": b""})
+        (a / "m").symlink_to("/proc/self/mem")
+        assert main([str(a), str(b)]) == 1
+        assert capsys.readouterr().out == "differ: m (read_error)\n"
+        assert main(["--stop-on-error", str(a), str(b)]) == 2
+        assert "cannot read m" in capsys.readouterr().err
+
+    def test_detect_hardlinks(self, make_dir, capsys):
+        a = make_dir("a", {"f": b"1234"})
+        b = make_dir("b", {"f": b"1235"})
+        os.link(a / "f", a / "g")
+        os.link(b / "f", b / "g")
+        assert main(["-v", "--detect-hardlinks", str(a), str(b)]) == 1
+        assert capsys.readouterr().out == (
+            "differ: f (content_mismatch)\n"
+            "differ: g (content_mismatch)\n"
+        )
+
+    def test_exclude(self, make_dir, capsys):
+        a = make_dir("a", {"app": b"1", "run.log": b"a", ".git/HEAD": b"a"})
+        b = make_dir("b", {"app": b"1", "run.log": b"b", ".git/HEAD": b"b"})
+        assert main(["--exclude", "*.log", "--exclude", ".git/", str(a), str(b)]) == 0
+        assert main(["--exclude", "*.log", str(a), str(b)]) == 1
+        assert capsys.readouterr().out == "differ: .git/HEAD (content_mismatch)\n"
+
+    def test_include(self, make_dir, capsys):
+        a = make_dir("a", {"x.py": b"1", "y.txt": b"a"})
+        b = make_dir("b", {"x.py": b"1", "y.txt": b"b"})
+        assert main(["-s", "--include", "*.py", str(a), str(b)]) == 0
+        assert "compared:   1\n" in capsys.readouterr().out
+
+    def test_symlinks(self, make_dir, capsys):
+        a = make_dir("a", {"d1": b"x", "d2": b"x"})
+        b = make_dir("b", {"d1": b"x", "d2": b"x"})
+        (a / "l").symlink_to("d1")
+        (b / "l").symlink_to("d2")
+        assert main([str(a), str(b)]) == 0
+        assert main(["--symlinks", "compare-link", str(a), str(b)]) == 1
+        assert capsys.readouterr().out == "differ: l (link_target_mismatch)\n"
+        assert main(["--symlinks", "skip", str(a), str(b)]) == 0
+        assert main(["--symlinks", "compare-link", str(a / "l"), str(b / "l")]) == 1
+        assert main(["--symlinks", "skip", str(a / "l"), str(b / "l")]) == 2
+
+    def test_format_json(self, make_dir, capsys):
+        a = make_dir("a", {"same": b"x", "changed": b"abc", "left": b"1"})
+        b = make_dir("b", {"same": b"x", "changed": b"abd", "right": b"22"})
+        assert main(["--format", "json", "--first-diff", str(a), str(b)]) == 1
+        doc = json.loads(capsys.readouterr().out)
+        assert doc["equal"] is False
+        assert doc["counts"] == {"equal": 1, "different": 1, "only_left": 1,
+                                 "only_right": 1, "error": 0}
+        by_path = {e["path"]: e for e in doc["entries"]}
+        assert by_path["changed"]["reason"] == "content_mismatch"
+        assert by_path["changed"]["first_diff_offset"] == 2
+        assert by_path["right"] == {"path": "right", "status": "only_right", "reason": None,
+                                    "size_a": None, "size_b": 2, "first_diff_offset": None,
+                                    "metadata": []}
+
+    def test_format_ndjson(self, make_dir, capsys):
+        a = make_dir("a", {"f1": b"x", "f2": b"y"})
+        b = make_dir("b", {"f1": b"x", "f2": b"y"})
+        assert main(["--format", "ndjson", str(a), str(b)]) == 0
+        lines = capsys.readouterr().out.splitlines()
+        assert [json.loads(line)["path"] for line in lines] == ["f1", "f2"]
+        assert all(json.loads(line)["status"] == "equal" for line in lines)
+
+    def test_format_junit(self, make_dir, capsys):
+        a = make_dir("a", {"same": b"x", "changed": b"ab"})
+        b = make_dir("b", {"same": b"x", "changed": b"ac"})
+        assert main(["--format", "junit", "--first-diff", str(a), str(b)]) == 1
+        out = capsys.readouterr().out
+        assert '<failure type="content_mismatch" message="changed: differs ' \
+               '(content_mismatch) at offset 1">' in out
+        assert '<testcase classname="komparu" name="same" file="same" />' in out
+
+    def test_format_sarif(self, make_dir, capsys):
+        a = make_dir("a", {"f": b"1"})
+        b = make_dir("b", {"f": b"1", "extra": b""})
+        assert main(["--format", "sarif", str(a), str(b)]) == 1
+        (result,) = json.loads(capsys.readouterr().out)["runs"][0]["results"]
+        assert result["ruleId"] == "only_right"
+
+    def test_format_registered(self, make_dir, capsys):
+        komparu.register_report_format(
+            "cli-paths", lambda report, out: out.write(" ".join(e.path for e in report.entries)))
+        a = make_dir("a", {"f": b"1", "g": b"2"})
+        assert main(["--format", "cli-paths", str(a), str(a)]) == 0
+        assert capsys.readouterr().out == "f g"
+
+    def test_format_github(self, make_dir, capsys):
+        a = make_dir("a", {"f": b"1"})
+        b = make_dir("b", {"f": b"2"})
+        assert main(["--format", "github", str(a), str(b)]) == 1
+        assert capsys.readouterr().out.startswith("::error file=f")
+
+    def test_format_needs_dirs(self, make_file, capsys):
+        a = make_file("a.txt", b"x")
+        assert main(["--format", "json", str(a), str(a)]) == 2
+        assert "two directories" in capsys.readouterr().err
+
+    def test_format_with_summary_only(self, make_dir, capsys):
+        a = make_dir("a", {"f": b"x"})
+        assert main(["--format", "json", "-s", str(a), str(a)]) == 2
+        assert "--summary-only" in capsys.readouterr().err
+
+    def test_progress(self, make_dir, capsys):
+        a = make_dir("a", {"f1": b"x", "f2": b"y", "sub/f3": b"z"})
+        b = make_dir("b", {"f1": b"x", "f2": b"Y", "sub/f3": b"z"})
+        assert main(["--progress", str(a), str(b)]) == 1
+        captured = capsys.readouterr()
+        assert captured.out == "differ: f2 (content_mismatch)\n"
+        assert "3/3 files" in captured.err.splitlines()[-1]
+
+    def test_check(self, make_dir, capsys):
+        a = make_dir("a", {"f.sh": b"x", "g": b"y"})
+        b = make_dir("b", {"f.sh": b"x", "g": b"y"})
+        os.chmod(a / "f.sh", 0o755)
+        os.chmod(b / "f.sh", 0o644)
+        assert main([str(a), str(b)]) == 0
+        assert main(["--check", "mode,mtime", "--mtime-tolerance", "60", str(a), str(b)]) == 1
+        assert capsys.readouterr().out == "differ: f.sh (mode_mismatch)\n"
+        assert main(["--check", "mode", "--format", "json", str(a), str(b)]) == 1
+        entries = {e["path"]: e for e in json.loads(capsys.readouterr().out)["entries"]}
+        assert entries["f.sh"]["metadata"] == ["mode"]
+
+    def test_check_verbose(self, make_dir, capsys):
+        a = make_dir("a", {"f": b"x"})
+        b = make_dir("b", {"f": b"x"})
+        assert main(["-v", "--check", "mode", str(a), str(b)]) == 0
+        assert capsys.readouterr().out == "1 file compared, 4 bytes read, equal\n"
+        os.chmod(a / "f", 0o600)
+        os.chmod(b / "f", 0o644)
+        assert main(["-v", "--check", "mode", str(a), str(b)]) == 1
+        assert capsys.readouterr().out == "differ: f (mode_mismatch)\n"
+
+    def test_check_rejected(self, make_dir, make_file, capsys):
+        a = make_dir("a", {"f": b"x"})
+        with pytest.raises(SystemExit):
+            main(["--check", "size", str(a), str(a)])
+        assert "unknown check 'size'" in capsys.readouterr().err
+        assert main(["--check", "mode", "-s", str(a), str(a)]) == 2
+        assert "--summary-only" in capsys.readouterr().err
+        f = make_file("f.txt", b"x")
+        assert main(["--check", "mode", str(f), str(f)]) == 2
+        assert "two directories" in capsys.readouterr().err
+
+
+class TestArchive:
+    """--archive reads zip and tar files as trees of their contents."""
+
+    def test_against_directory(self, make_dir, tmp_path, capsys):
+        d = make_dir("d", {"f": b"one", "g": b"two"})
+        archive = tmp_path / "d.tar.gz"
+        with tarfile.open(archive, "w:gz") as tf:
+            tf.add(d / "f", arcname="./f")
+            tf.add(d / "g", arcname="./g")
+        assert main(["--archive", "-v", str(archive), str(d)]) == 0
+        assert capsys.readouterr().out == "archive contents are equal\n"
+        (d / "g").write_bytes(b"TWO")
+        assert main(["--archive", str(archive), str(d)]) == 1
+        assert capsys.readouterr().out == "differ: g (content_mismatch)\n"
+
+    def test_rejected(self, make_dir, make_file, capsys):
+        d = make_dir("d", {"f": b"x"})
+        assert main(["--archive", "--format", "json", str(d), str(d)]) == 2
+        assert "--archive cannot be combined with --format" in capsys.readouterr().err
+        f = make_file("f.txt", b"x")
+        assert main(["--archive", str(f), str(d)]) == 2
+        assert "not a zip or tar archive" in capsys.readouterr().err
+
+
+class TestManifest:
+    """'manifest' and 'verify' subcommands hash a tree and check another."""
+
+    def test_manifest_then_verify(self, make_dir, tmp_path, capsys):
+        a = make_dir("a", {"f": b"x", "sub/g": b"yy"})
+        b = make_dir("b", {"f": b"x", "sub/g": b"yy"})
+        manifest = tmp_path / "m.json"
+        assert main(["manifest", str(a), "-o", str(manifest)]) == 0
+        assert json.loads(manifest.read_text())["algorithm"] == "sha256"
+        assert main(["verify", "-v", str(b), str(manifest)]) == 0
+        assert capsys.readouterr().out == "tree matches the manifest\n"
+
+    def test_verify_lists_changes(self, make_dir, tmp_path, capsys):
+        a = make_dir("a", {"edited": b"1", "gone": b"g"})
+        b = make_dir("b", {"edited": b"2", "new": b"n"})
+        manifest = tmp_path / "m.json"
+        assert main(["manifest", "-a", "blake2b", str(a), "-o", str(manifest)]) == 0
+        assert main(["verify", str(b), str(manifest)]) == 1
+        assert capsys.readouterr().out == (
+            "differ: edited (content_mismatch)\n"
+            "missing: gone\n"
+            "extra: new\n"
+        )
+
+    def test_manifest_to_stdout(self, make_dir, capsys):
+        a = make_dir("a", {"f": b"x"})
+        assert main(["manifest", str(a)]) == 0
+        doc = json.loads(capsys.readouterr().out)
+        assert [e["path"] for e in doc["files"]] == ["f"]
+
+    def test_errors(self, make_dir, tmp_path, capsys):
+        a = make_dir("a", {"f": b"x"})
+        assert main(["manifest", "-a", "nope", str(a)]) == 2
+        assert "unknown hash algorithm" in capsys.readouterr().err
+        assert main(["verify", str(a), str(tmp_path / "missing.json")]) == 2
+        assert capsys.readouterr().err.startswith("komparu: ")
+
+    def test_double_dash_compares_files(self, tmp_path, capsys):
+        (tmp_path / "manifest").write_bytes(b"x")
+        (tmp_path / "other").write_bytes(b"y")
+        cwd = os.getcwd()
+        os.chdir(tmp_path)
+        try:
+            assert main(["--", "manifest", "manifest"]) == 0
+            assert main(["--", "manifest", "other"]) == 1
+        finally:
+            os.chdir(cwd)
+
+
+
+def _age(root: Path) -> Path:
+    """Backdate every file under root, so the digest cache may keep it."""
+    for path in root.rglob("*"):
+        os.utime(path, (0, 1_000_000_000))
+    return root
+
+
+class TestCache:
+    """'--cache-dir' keeps digests between runs; '--no-cache' turns it off."""
+
+    def test_second_run_reads_nothing(self, make_dir, tmp_path, capsys):
+        a = _age(make_dir("a", {"f": b"12345", "sub/g": b"x"}))
+        b = _age(make_dir("b", {"f": b"12345", "sub/g": b"x"}))
+        cache = str(tmp_path / "cache")
+        assert main(["-v", "--cache-dir", cache, str(a), str(b)]) == 0
+        assert capsys.readouterr().out == "2 files compared, 12 bytes read, equal\n"
+        assert main(["-v", "--cache-dir", cache, str(a), str(b)]) == 0
+        assert capsys.readouterr().out == "2 files compared, 0 bytes read, equal\n"
+        (b / "f").write_bytes(b"12346")
+        assert main(["--cache-dir", cache, str(a), str(b)]) == 1
+        assert capsys.readouterr().out == "differ: f (content_mismatch)\n"
+
+    def test_environment_and_no_cache(self, make_dir, tmp_path, capsys):
+        a = _age(make_dir("a", {"f": b"1"}))
+        cache = tmp_path / "cache"
+        os.environ["KOMPARU_CACHE_DIR"] = str(cache)
+        try:
+            assert main(["--no-cache", str(a), str(a)]) == 0
+            assert not cache.exists()
+            assert main([str(a), str(a)]) == 0
+            assert cache.is_dir()
+            assert main(["-s", str(a), str(a)]) == 0  # summary counts skip the cache
+        finally:
+            del os.environ["KOMPARU_CACHE_DIR"]
+        capsys.readouterr()
+
+    def test_rejected(self, make_dir, tmp_path, capsys):
+        a = make_dir("a", {"f": b"1"})
+        cache = str(tmp_path / "cache")
+        assert main(["--cache-dir", cache, "-s", str(a), str(a)]) == 2
+        assert "--cache-dir cannot be combined with --summary-only" in capsys.readouterr().err
+        assert main(["--cache-dir", cache, "--format", "json", str(a), str(a)]) == 2
+        assert "--format" in capsys.readouterr().err
+
+
+class TestWatch:
+    """'watch' reports each change and can stop once the trees agree."""
+
+    def test_until_equal(self, make_dir, capsys):
+        a = make_dir("a", {"f": b"1", "g": b"x"})
+        b = make_dir("b", {"f": b"2", "g": b"x"})
+        threading.Timer(0.3, (b / "f").write_bytes, [b"1"]).start()
+        assert main(["watch", "--backend", "poll", "--interval", "0.05",
+                     "--until-equal", str(a), str(b)]) == 0
+        assert capsys.readouterr().out == (
+            "different\n"
+            "differ: f (content_mismatch)\n"
+            "converged\n"
+        )
+
+    def test_already_equal(self, make_dir, capsys):
+        a = make_dir("a", {"f": b"1"})
+        assert main(["watch", "--until-equal", str(a), str(a)]) == 0
+        assert capsys.readouterr().out == "equal\n"
+
+    def test_errors(self, make_dir, tmp_path, capsys):
+        a = make_dir("a", {})
+        assert main(["watch", str(a), str(tmp_path / "missing")]) == 2
+        assert capsys.readouterr().err.startswith("komparu: not a directory")
+
+
+class TestRemote:
+    """'remote' compares against a tree served at the end of an ssh pipe."""
+
+    def _ssh(self, tmp_path: Path) -> str:
+        # Stands in for ssh: runs the remote command line locally
+        script = tmp_path / "fake-ssh"
+        script.write_text(f"#!{sys.executable}\n"
+                          "import os, sys\n"
+                          "os.execvp('sh', ['sh', '-c', sys.argv[-1]])\n")
+        script.chmod(0o755)
+        return str(script)
+
+    def test_ranges(self, make_dir, tmp_path, capsys):
+        a = make_dir("a", {"f": b"aaaabbbbcccc", "same": b"1", "left": b""})
+        b = make_dir("b", {"f": b"aaaaBBBBcccc", "same": b"1"})
+        assert main(["remote", "--ssh", self._ssh(tmp_path),
+                     "--agent", f"{sys.executable} -m komparu",
+                     "--ranges", "--block-size", "4", str(a), f"host:{b}"]) == 1
+        assert capsys.readouterr().out == (
+            "differ: f (content_mismatch) at 4-8\n"
+            "only in A: left\n"
+        )
+
+    def test_equal(self, make_dir, tmp_path):
+        a = make_dir("a", {"f": b"1"})
+        assert main(["remote", "--ssh", self._ssh(tmp_path),
+                     "--agent", f"{sys.executable} -m komparu", str(a), f"host:{a}"]) == 0
+
+    def test_errors(self, make_dir, tmp_path, capsys):
+        a = make_dir("a", {})
+        assert main(["remote", str(a), "no-host"]) == 2
+        assert capsys.readouterr().err == "komparu: remote must be host:path, got 'no-host'\n"
+        assert main(["serve", str(tmp_path / "missing")]) == 2
+        assert capsys.readouterr().err.startswith("komparu: not a directory")
+
+
+class TestTune:
+    """'tune' times read strategies and prints the fastest as options."""
+
+    def test_output(self, tmp_path, capsys):
+        sample = tmp_path / "sample.bin"
+        sample.write_bytes(os.urandom(200_000))
+        assert main(["tune", "--strategy", "buffered", "--strategy", "prefetch",
+                     "--chunk-size", "4096", "--chunk-size", "65536",
+                     "--rounds", "1", str(sample)]) == 0
+        lines = capsys.readouterr().out.splitlines()
+        assert lines[0] == f"sample: {sample} (195.3 KiB, best of 1)"
+        assert [line.split()[:2] for line in lines[1:5]] == [
+            ["buffered", "4096"], ["buffered", "65536"],
+            ["prefetch", "4096"], ["prefetch", "65536"],
+        ]
+        assert lines[5].startswith("recommended: --chunk-size ")
+        assert len(lines) == 6
+
+    def test_errors(self, tmp_path, capsys):
+        assert main(["tune", str(tmp_path / "missing")]) == 2
+        assert capsys.readouterr().err.startswith("komparu: ")
+        empty = tmp_path / "empty"
+        empty.write_bytes(b"")
+        assert main(["tune", str(empty)]) == 2
+        assert capsys.readouterr().err == f"komparu: cannot tune on an empty file: {empty}\n"
+
+
+class TestThreeWay:
+    """'three-way' classifies paths against a common base."""
+
+    def test_output(self, make_dir, capsys):
+        base = make_dir("base", {"same": b"s", "ours": b"1", "theirs": b"1", "clash": b"1"})
+        a = make_dir("a", {"same": b"s", "ours": b"2", "theirs": b"1", "clash": b"2"})
+        b = make_dir("b", {"same": b"s", "ours": b"1", "theirs": b"2", "clash": b"3"})
+        assert main(["three-way", str(base), str(a), str(b)]) == 1
+        assert capsys.readouterr().out == (
+            "conflict: clash\nchanged in A: ours\nchanged in B: theirs\n"
+        )
+        assert main(["three-way", "-v", "--exclude", "clash", str(base), str(a), str(b)]) == 0
+        assert capsys.readouterr().out == (
+            "changed in A: ours\nunchanged: same\nchanged in B: theirs\n"
+        )
+
+    def test_files_json(self, make_file, capsys):
+        base = make_file("base.txt", b"1")
+        a = make_file("a.txt", b"2")
+        assert main(["three-way", "--format", "json", str(base), str(a), str(a)]) == 0
+        doc = json.loads(capsys.readouterr().out)
+        assert doc["entries"] == [{"path": "base.txt", "status": "changed_both_same"}]
+
+    def test_errors(self, make_dir, tmp_path, capsys):
+        d = make_dir("d", {"f": b"x"})
+        assert main(["three-way", str(d), str(d), str(tmp_path / "missing")]) == 2
+        assert capsys.readouterr().err.startswith("komparu: ")
+        assert main(["three-way", str(d / "f"), str(d), str(d)]) == 2
+        assert "all be files" in capsys.readouterr().err
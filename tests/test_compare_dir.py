@@ -2,6 +2,7 @@
 
 from __future__ import annotations
 
+import io
 import os
 from pathlib import Path
 
@@ -9,6 +10,7 @@ import pytest
 
 import komparu
 from komparu import DiffReason
+from komparu._config import reset_config
 
 
 @pytest.fixture
@@ -26,6 +28,36 @@ def make_dir(tmp_path: Path):
     return _make
 
 
+
+class TestCompareDirSummary:
+    """compare_dir_summary returns counts without paths."""
+
+    def test_counts(self, make_dir):
+        a = make_dir("a", {"same": b"x", "size": b"1", "content": b"ab", "left": b"l"})
+        b = make_dir("b", {"same": b"x", "size": b"12", "content": b"ac", "right": b"r"})
+        s = komparu.compare_dir_summary(str(a), str(b))
+        assert s.equal is False
+        assert (s.compared, s.differing, s.only_left, s.only_right, s.errors) == (3, 2, 1, 1, 0)
+        assert s.duration >= 0
+
+    def test_equal(self, make_dir):
+        a = make_dir("a", {"x/y.txt": b"data", "z": b"zz"})
+        b = make_dir("b", {"x/y.txt": b"data", "z": b"zz"})
+        s = komparu.compare_dir_summary(str(a), str(b), quick_check=False)
+        assert s.equal is True
+        assert (s.compared, s.differing) == (2, 0)
+        assert s.bytes_read == 2 * (4 + 2)
+
+    def test_matches_compare_dir(self, make_dir):
+        files_a = {f"f{i}": bytes([i]) * 100 for i in range(50)}
+        files_b = {f"f{i}": bytes([i if i % 3 else i + 1]) * 100 for i in range(50)}
+        a = make_dir("a", files_a)
+        b = make_dir("b", files_b)
+        full = komparu.compare_dir(str(a), str(b))
+        s = komparu.compare_dir_summary(str(a), str(b))
+        assert s.differing == len(full.diff)
+        assert s.compared == 50
+
 class TestSameDir:
     """Same directory compared with itself should short-circuit."""
 
@@ -62,6 +94,134 @@ class TestSameDir:
         assert result.equal is True
 
 
+class TestBrokenSymlinks:
+    """Dangling symlinks are compared by target instead of dropped."""
+
+    def test_same_target_equal(self, make_dir):
+        a = make_dir("a", {"f": b"x"})
+        b = make_dir("b", {"f": b"x"})
+        (a / "link").symlink_to("missing.txt")
+        (b / "link").symlink_to("missing.txt")
+        for follow in (True, False):
+            result = komparu.compare_dir(str(a), str(b), follow_symlinks=follow)
+            assert result.equal is True
+
+    def test_different_target(self, make_dir):
+        a = make_dir("a", {"f": b"x"})
+        b = make_dir("b", {"f": b"x"})
+        (a / "link").symlink_to("missing-1")
+        (b / "link").symlink_to("missing-2")
+        result = komparu.compare_dir(str(a), str(b), follow_symlinks=False)
+        assert result.diff == {"link": DiffReason.BROKEN_SYMLINK}
+
+    def test_broken_vs_regular_file(self, make_dir):
+        a = make_dir("a", {"f": b"x"})
+        b = make_dir("b", {"f": b"x", "link": b"real"})
+        (a / "link").symlink_to("missing")
+        result = komparu.compare_dir(str(a), str(b))
+        assert result.diff == {"link": DiffReason.BROKEN_SYMLINK}
+        assert result.errors == set()
+
+    def test_one_side_only(self, make_dir):
+        a = make_dir("a", {"f": b"x"})
+        b = make_dir("b", {"f": b"x"})
+        (a / "sub").mkdir()
+        (a / "sub" / "link").symlink_to("../nowhere")
+        result = komparu.compare_dir(str(a), str(b))
+        assert result.only_left == {"sub/link"}
+
+
+class TestSymlinkModes:
+    """symlinks= picks follow, compare-link or skip for every link."""
+
+    def test_follow_compares_content(self, make_dir):
+        a = make_dir("a", {"data": b"same", "f": b"same"})
+        b = make_dir("b", {"data": b"same", "f": b"same"})
+        (a / "link").symlink_to("data")
+        (b / "link").symlink_to("f")
+        result = komparu.compare_dir(str(a), str(b), symlinks="follow", follow_symlinks=False)
+        assert result.equal is True
+
+    def test_follow_loop_walked_once(self, make_dir):
+        a = make_dir("a", {"sub/f": b"x"})
+        b = make_dir("b", {"sub/f": b"x"})
+        (a / "sub" / "up").symlink_to("..")
+        (b / "sub" / "up").symlink_to("..")
+        result = komparu.compare_dir(str(a), str(b), symlinks="follow")
+        assert result.equal is True
+
+    def test_compare_link_targets(self, make_dir):
+        a = make_dir("a", {"data": b"same", "f": b"same"})
+        b = make_dir("b", {"data": b"same", "f": b"same"})
+        (a / "same").symlink_to("data")
+        (b / "same").symlink_to("data")
+        (a / "moved").symlink_to("data")
+        (b / "moved").symlink_to("f")
+        result = komparu.compare_dir(str(a), str(b), symlinks="compare-link")
+        assert result.diff == {"moved": DiffReason.LINK_TARGET_MISMATCH}
+
+    def test_compare_link_same_file_different_target(self, make_dir):
+        """Two links reaching one file through different paths still differ."""
+        shared = make_dir("shared", {"f": b"x"})
+        a = make_dir("a", {})
+        b = make_dir("b", {})
+        a.mkdir()
+        b.mkdir()
+        (a / "l").symlink_to(shared / "f")
+        (b / "l").symlink_to(os.path.relpath(shared / "f", b))
+        result = komparu.compare_dir(str(a), str(b), symlinks="compare-link")
+        assert result.diff == {"l": DiffReason.LINK_TARGET_MISMATCH}
+
+    def test_compare_link_vs_file(self, make_dir):
+        a = make_dir("a", {"data": b"x"})
+        b = make_dir("b", {"data": b"x", "l": b"x"})
+        (a / "l").symlink_to("data")
+        result = komparu.compare_dir(str(a), str(b), symlinks="compare-link")
+        assert result.diff == {"l": DiffReason.TYPE_MISMATCH}
+
+    def test_compare_link_does_not_enter_directories(self, make_dir):
+        a = make_dir("a", {"real/f": b"1"})
+        b = make_dir("b", {"real/f": b"1", "other/f": b"2"})
+        (a / "dir").symlink_to("real")
+        (b / "dir").symlink_to("real")
+        result = komparu.compare_dir(str(a), str(b), symlinks="compare-link")
+        assert result.only_right == {"other/f"}
+        assert not result.diff
+
+    def test_skip_drops_all_links(self, make_dir):
+        a = make_dir("a", {"f": b"x"})
+        b = make_dir("b", {"f": b"x"})
+        (a / "live").symlink_to("f")
+        (a / "dangling").symlink_to("missing")
+        (b / "dangling").symlink_to("elsewhere")
+        result = komparu.compare_dir(str(a), str(b), symlinks="skip")
+        assert result.equal is True
+        assert not result.only_left
+
+    def test_skip_with_regular_files_only(self, make_dir):
+        a = make_dir("a", {"f": b"x"})
+        (a / "l").symlink_to("f")
+        assert komparu.compare_dir(str(a), str(a) + "/", symlinks="skip",
+                                   regular_files_only=True).equal is True
+
+    def test_summary_and_report(self, make_dir):
+        a = make_dir("a", {"data": b"x"})
+        b = make_dir("b", {"data": b"x"})
+        (a / "l").symlink_to("data")
+        (b / "l").symlink_to("data")
+        summary = komparu.compare_dir_summary(str(a), str(b), symlinks="compare-link")
+        assert summary.compared == 2
+        report = komparu.compare_dir_report(str(a), str(b), symlinks="compare-link")
+        entry = next(e for e in report.entries if e.path == "l")
+        assert entry.status is komparu.EntryStatus.EQUAL
+        assert entry.size_a == len("data")
+
+    def test_invalid_mode(self, make_dir):
+        a = make_dir("a", {"f": b"x"})
+        with pytest.raises(ValueError, match="symlinks"):
+            komparu.compare_dir(str(a), str(a), symlinks="ignore")
+
+
 class TestCrossDirHardlinks:
     """Cross-directory hardlinks exercise per-file inode check in dir_cmp_task_exec."""
 
@@ -76,6 +236,49 @@ class TestCrossDirHardlinks:
         assert result.equal is True
 
 
+class TestDetectHardlinks:
+    """detect_hardlinks reads each pair of inodes once."""
+
+    def _linked(self, tmp_path: Path, name: str, data: bytes) -> Path:
+        d = tmp_path / name
+        (d / "sub").mkdir(parents=True)
+        (d / "f").write_bytes(data)
+        os.link(d / "f", d / "g")
+        os.link(d / "f", d / "sub" / "h")
+        return d
+
+    def test_linked_pairs_read_once(self, tmp_path: Path):
+        a = self._linked(tmp_path, "a", b"x" * 100_000)
+        b = self._linked(tmp_path, "b", b"x" * 99_999 + b"y")
+        plain = komparu.compare_dir_summary(str(a), str(b), quick_check=False)
+        linked = komparu.compare_dir_summary(str(a), str(b), quick_check=False,
+                                             detect_hardlinks=True)
+        assert (linked.compared, linked.differing) == (plain.compared, plain.differing) == (3, 3)
+        assert linked.bytes_read * 3 == plain.bytes_read
+        result = komparu.compare_dir(str(a), str(b), detect_hardlinks=True, max_workers=1)
+        assert result.diff == {p: DiffReason.CONTENT_MISMATCH for p in ("f", "g", "sub/h")}
+
+    def test_equal(self, tmp_path: Path):
+        a = self._linked(tmp_path, "a", b"same")
+        b = self._linked(tmp_path, "b", b"same")
+        assert komparu.compare_dir(str(a), str(b), detect_hardlinks=True).equal is True
+
+    def test_links_on_one_side_only(self, make_dir, tmp_path: Path):
+        """Copies on the other side are still compared one by one."""
+        a = self._linked(tmp_path, "a", b"data")
+        b = make_dir("b", {"f": b"data", "g": b"dat!", "sub/h": b"data"})
+        result = komparu.compare_dir(str(a), str(b), detect_hardlinks=True)
+        assert result.diff == {"g": DiffReason.CONTENT_MISMATCH}
+
+    def test_with_cache(self, tmp_path: Path):
+        a = self._linked(tmp_path, "a", b"data")
+        b = self._linked(tmp_path, "b", b"data")
+        with komparu.DigestCache(str(tmp_path / "cache")) as cache:
+            result = komparu.compare_dir(str(a), str(b), cache=cache, detect_hardlinks=True)
+            assert result.equal is True
+            assert cache.bytes_hashed == 2 * 4
+
+
 class TestIdenticalDirs:
     """Two identical directories should return equal=True."""
 
@@ -219,6 +422,728 @@ class TestDirOptions:
         result = komparu.compare_dir(str(a), str(b), quick_check=False)
         assert result.equal is True
 
+    def test_max_memory_single_worker(self, make_dir):
+        files_a = {f"f{i}": bytes([i]) * 5000 for i in range(20)}
+        files_b = dict(files_a, f7=b"\xff" * 5000)
+        a = make_dir("a", files_a)
+        b = make_dir("b", files_b)
+        result = komparu.compare_dir(
+            str(a), str(b), chunk_size=4096, max_workers=8, max_memory=8192,
+        )
+        assert set(result.diff) == {"f7"}
+
+    def test_max_memory_summary(self, make_dir):
+        a = make_dir("a", {"x": b"1", "y": b"2"})
+        b = make_dir("b", {"x": b"1", "y": b"3"})
+        s = komparu.compare_dir_summary(str(a), str(b), max_memory=1 << 20)
+        assert (s.compared, s.differing) == (2, 1)
+
+    def test_max_memory_too_small(self, make_dir):
+        a = make_dir("a", {"x": b"1"})
+        with pytest.raises(ValueError, match="max_memory"):
+            komparu.compare_dir(str(a), str(a), chunk_size=65536, max_memory=65536)
+
+
+class TestMaxDepth:
+    """max_depth stops descending below the cutoff."""
+
+    def test_root_only(self, make_dir):
+        a = make_dir("a", {"top": b"x", "sub/deep": b"1"})
+        b = make_dir("b", {"top": b"x", "sub/deep": b"2"})
+        assert komparu.compare_dir(str(a), str(b), max_depth=0).equal is True
+        assert komparu.compare_dir(str(a), str(b)).equal is False
+
+    def test_two_levels(self, make_dir):
+        a = make_dir("a", {"l1/f": b"a", "l1/l2/f": b"a", "l1/l2/l3/f": b"a"})
+        b = make_dir("b", {"l1/f": b"a", "l1/l2/f": b"b", "l1/l2/l3/f": b"b"})
+        result = komparu.compare_dir(str(a), str(b), max_depth=2)
+        assert set(result.diff) == {"l1/l2/f"}
+
+    def test_only_in_sets_at_boundary(self, make_dir):
+        a = make_dir("a", {"keep": b"k", "extra": b"e", "left_dir/f": b"1"})
+        b = make_dir("b", {"keep": b"k", "right_dir/f": b"2"})
+        result = komparu.compare_dir(str(a), str(b), max_depth=0)
+        assert result.only_left == {"extra"}
+        assert result.only_right == set()
+
+    def test_summary(self, make_dir):
+        a = make_dir("a", {"f": b"x", "d/g": b"1"})
+        b = make_dir("b", {"f": b"x", "d/g": b"2"})
+        s = komparu.compare_dir_summary(str(a), str(b), max_depth=0)
+        assert (s.equal, s.compared) == (True, 1)
+
+    def test_negative_rejected(self, make_dir):
+        a = make_dir("a", {"f": b"x"})
+        with pytest.raises(ValueError, match="max_depth"):
+            komparu.compare_dir(str(a), str(a), max_depth=-1)
+
+
+class TestIdentical:
+    """Fail-fast identical() gate."""
+
+    def test_identical_trees(self, make_dir):
+        files = {"a.txt": b"hello", "sub/b.bin": os.urandom(5000), "empty": b""}
+        a = make_dir("a", files)
+        b = make_dir("b", files)
+        assert komparu.identical(str(a), str(b)) is True
+
+    def test_same_path(self, make_dir):
+        a = make_dir("a", {"f.txt": b"x"})
+        assert komparu.identical(str(a), str(a)) is True
+
+    def test_empty_dirs(self, tmp_path: Path):
+        (tmp_path / "a").mkdir()
+        (tmp_path / "b").mkdir()
+        assert komparu.identical(str(tmp_path / "a"), str(tmp_path / "b")) is True
+
+    def test_missing_file(self, make_dir):
+        a = make_dir("a", {"f.txt": b"x", "g.txt": b"y"})
+        b = make_dir("b", {"f.txt": b"x"})
+        assert komparu.identical(str(a), str(b)) is False
+        assert komparu.identical(str(b), str(a)) is False
+
+    def test_renamed_file(self, make_dir):
+        a = make_dir("a", {"f.txt": b"x"})
+        b = make_dir("b", {"g.txt": b"x"})
+        assert komparu.identical(str(a), str(b)) is False
+
+    def test_size_mismatch(self, make_dir):
+        a = make_dir("a", {"f.txt": b"short"})
+        b = make_dir("b", {"f.txt": b"longer content"})
+        assert komparu.identical(str(a), str(b)) is False
+
+    def test_content_mismatch(self, make_dir):
+        a = make_dir("a", {"f.txt": b"aaaa"})
+        b = make_dir("b", {"f.txt": b"aaab"})
+        assert komparu.identical(str(a), str(b)) is False
+
+    def test_many_files_one_diff(self, make_dir):
+        files = {f"f{i:03d}.bin": os.urandom(2048) for i in range(64)}
+        a = make_dir("a", files)
+        changed = dict(files)
+        changed["f040.bin"] = b"\0" + files["f040.bin"][1:]
+        b = make_dir("b", changed)
+        assert komparu.identical(str(a), str(b)) is False
+        assert komparu.identical(str(a), str(b), max_workers=1) is False
+        assert komparu.identical(str(a), str(b), max_workers=4) is False
+
+    def test_nonexistent_dir(self, tmp_path: Path):
+        a = tmp_path / "exists"
+        a.mkdir()
+        with pytest.raises(IOError):
+            komparu.identical(str(a), str(tmp_path / "nope"))
+
+
+class TestIsSubset:
+    """is_subset() ignores extra files in the superset."""
+
+    def test_subset_ok(self, make_dir):
+        sub = make_dir("img", {"bin/app": b"app", "etc/conf": b"k=1"})
+        ref = make_dir("ref", {"bin/app": b"app", "etc/conf": b"k=1", "doc/README": b"r"})
+        assert komparu.is_subset(str(sub), str(ref)) == (True, [])
+
+    def test_missing_and_differing(self, make_dir):
+        sub = make_dir("img", {"bin/app": b"app", "etc/conf": b"k=2", "lib/x.so": b"x"})
+        ref = make_dir("ref", {"bin/app": b"app", "etc/conf": b"k=1"})
+        assert komparu.is_subset(str(sub), str(ref)) == (False, ["etc/conf", "lib/x.so"])
+
+    def test_not_symmetric(self, make_dir):
+        small = make_dir("small", {"a": b"a"})
+        big = make_dir("big", {"a": b"a", "b": b"b"})
+        assert komparu.is_subset(str(small), str(big))[0] is True
+        assert komparu.is_subset(str(big), str(small)) == (False, ["b"])
+
+    def test_empty_subset(self, make_dir, tmp_path: Path):
+        (tmp_path / "empty").mkdir()
+        ref = make_dir("ref", {"a": b"a"})
+        assert komparu.is_subset(str(tmp_path / "empty"), str(ref)) == (True, [])
+
+    def test_ignore(self, make_dir):
+        sub = make_dir("img", {"app": b"1", "build.log": b"local"})
+        ref = make_dir("ref", {"app": b"1"})
+        assert komparu.is_subset(str(sub), str(ref), ignore=["*.log"]) == (True, [])
+
+    def test_nonexistent_superset(self, make_dir, tmp_path: Path):
+        sub = make_dir("img", {"a": b"a"})
+        with pytest.raises(IOError):
+            komparu.is_subset(str(sub), str(tmp_path / "nope"))
+
+
+class TestSpecialFiles:
+    """special_files=True compares FIFOs, sockets and devices by type."""
+
+    def test_fifo_skipped_by_default(self, make_dir):
+        a = make_dir("a", {"f.txt": b"x"})
+        b = make_dir("b", {"f.txt": b"x"})
+        os.mkfifo(a / "pipe")
+        result = komparu.compare_dir(str(a), str(b))
+        assert result.equal is True
+
+    def test_fifo_both_sides(self, make_dir):
+        a = make_dir("a", {"f.txt": b"x"})
+        b = make_dir("b", {"f.txt": b"x"})
+        os.mkfifo(a / "pipe")
+        os.mkfifo(b / "pipe")
+        result = komparu.compare_dir(str(a), str(b), special_files=True)
+        assert result.equal is True
+
+    def test_fifo_only_left(self, make_dir):
+        a = make_dir("a", {"f.txt": b"x"})
+        b = make_dir("b", {"f.txt": b"x"})
+        os.mkfifo(a / "pipe")
+        result = komparu.compare_dir(str(a), str(b), special_files=True)
+        assert result.only_left == {"pipe"}
+
+    def test_fifo_vs_regular(self, make_dir):
+        a = make_dir("a", {"entry": b"data"})
+        b = make_dir("b", {})
+        b.mkdir()
+        os.mkfifo(b / "entry")
+        result = komparu.compare_dir(str(a), str(b), special_files=True)
+        assert result.diff == {"entry": DiffReason.TYPE_MISMATCH}
+
+    def test_fifo_vs_socket(self, make_dir):
+        import socket
+
+        a = make_dir("a", {})
+        b = make_dir("b", {})
+        a.mkdir()
+        b.mkdir()
+        os.mkfifo(a / "s")
+        sock = socket.socket(socket.AF_UNIX, socket.SOCK_STREAM)
+        try:
+            sock.bind(str(b / "s"))
+            result = komparu.compare_dir(str(a), str(b), special_files=True)
+        finally:
+            sock.close()
+        assert result.diff == {"s": DiffReason.TYPE_MISMATCH}
+
+    @pytest.mark.skipif(os.getuid() != 0, reason="mknod requires root")
+    def test_device_numbers(self, make_dir):
+        import stat
+
+        a = make_dir("a", {})
+        b = make_dir("b", {})
+        a.mkdir()
+        b.mkdir()
+        mode = stat.S_IFCHR | 0o600
+        os.mknod(a / "same", mode, os.makedev(1, 3))
+        os.mknod(b / "same", mode, os.makedev(1, 3))
+        os.mknod(a / "other", mode, os.makedev(1, 3))
+        os.mknod(b / "other", mode, os.makedev(1, 5))
+        result = komparu.compare_dir(str(a), str(b), special_files=True)
+        assert result.diff == {"other": DiffReason.TYPE_MISMATCH}
+
+    def test_link_to_fifo_not_followed(self, make_dir, tmp_path):
+        a = make_dir("a", {})
+        b = make_dir("b", {})
+        a.mkdir()
+        b.mkdir()
+        os.mkfifo(a / "p")
+        os.mkfifo(tmp_path / "target")
+        os.symlink(tmp_path / "target", b / "p")
+        result = komparu.compare_dir(str(a), str(b), special_files=True)
+        assert result.equal is True
+        result = komparu.compare_dir(str(a), str(b), special_files=True, follow_symlinks=False)
+        assert result.only_left == {"p"}
+        result = komparu.compare_dir(str(a), str(b), special_files=True, follow_symlinks=False,
+                                     symlinks="compare-link")
+        assert result.diff == {"p": DiffReason.TYPE_MISMATCH}
+
+
+class TestRegularFilesOnly:
+    """regular_files_only=True fails on the first non-regular entry."""
+
+    def test_plain_trees_compare(self, make_dir):
+        a = make_dir("a", {"f.txt": b"x", "sub/g.txt": b"y"})
+        b = make_dir("b", {"f.txt": b"x", "sub/g.txt": b"z"})
+        result = komparu.compare_dir(str(a), str(b), regular_files_only=True)
+        assert result.diff == {"sub/g.txt": DiffReason.CONTENT_MISMATCH}
+
+    def test_fifo_raises(self, make_dir):
+        a = make_dir("a", {"f.txt": b"x"})
+        b = make_dir("b", {"f.txt": b"x"})
+        os.mkfifo(b / "pipe")
+        with pytest.raises(komparu.NonRegularFileError) as exc:
+            komparu.compare_dir(str(a), str(b), regular_files_only=True)
+        assert exc.value.path == f"{b}/pipe"
+        assert exc.value.kind == "fifo"
+
+    def test_symlink_raises_even_when_followed(self, make_dir):
+        a = make_dir("a", {"f.txt": b"x"})
+        b = make_dir("b", {"f.txt": b"x"})
+        os.symlink("f.txt", a / "link")
+        with pytest.raises(komparu.NonRegularFileError) as exc:
+            komparu.compare_dir(
+                str(a), str(b), follow_symlinks=True, regular_files_only=True,
+            )
+        assert exc.value.kind == "symlink"
+        assert "link" in str(exc.value)
+
+    def test_socket_in_summary(self, make_dir):
+        import socket
+
+        a = make_dir("a", {"f.txt": b"x"})
+        b = make_dir("b", {"f.txt": b"x"})
+        sock = socket.socket(socket.AF_UNIX, socket.SOCK_STREAM)
+        try:
+            sock.bind(str(a / "s"))
+            with pytest.raises(komparu.NonRegularFileError) as exc:
+                komparu.compare_dir_summary(
+                    str(a), str(b), regular_files_only=True,
+                )
+        finally:
+            sock.close()
+        assert exc.value.kind == "socket"
+
+    def test_is_komparu_error(self, make_dir):
+        a = make_dir("a", {"f.txt": b"x"})
+        b = make_dir("b", {"f.txt": b"x"})
+        os.mkfifo(a / "pipe")
+        with pytest.raises(komparu.KomparuError):
+            komparu.compare_dir(str(a), str(b), regular_files_only=True)
+
+    def test_exclusive_with_special_files(self, make_dir):
+        a = make_dir("a", {"f.txt": b"x"})
+        with pytest.raises(ValueError, match="exclusive"):
+            komparu.compare_dir(
+                str(a), str(a), regular_files_only=True, special_files=True,
+            )
+
+
+def _setxattr(path: Path, name: str, value: bytes) -> None:
+    if not hasattr(os, "setxattr"):
+        pytest.skip("xattrs not supported")
+    try:
+        os.setxattr(path, name, value)
+    except OSError:
+        pytest.skip("filesystem does not support user xattrs")
+
+
+class TestCompareXattrs:
+    """compare_xattrs=True flags equal content with differing xattrs."""
+
+    def test_differing_value(self, make_dir):
+        a = make_dir("a", {"f.txt": b"x", "g.txt": b"y"})
+        b = make_dir("b", {"f.txt": b"x", "g.txt": b"y"})
+        _setxattr(a / "f.txt", "user.label", b"one")
+        _setxattr(b / "f.txt", "user.label", b"two")
+        result = komparu.compare_dir(str(a), str(b), compare_xattrs=True)
+        assert result.equal is False
+        assert result.diff == {"f.txt": DiffReason.XATTR_MISMATCH}
+
+    def test_missing_attribute(self, make_dir):
+        a = make_dir("a", {"sub/f.txt": b"x"})
+        b = make_dir("b", {"sub/f.txt": b"x"})
+        _setxattr(a / "sub" / "f.txt", "user.label", b"one")
+        result = komparu.compare_dir(str(a), str(b), compare_xattrs=True)
+        assert result.diff == {"sub/f.txt": DiffReason.XATTR_MISMATCH}
+
+    def test_matching_xattrs_equal(self, make_dir):
+        a = make_dir("a", {"f.txt": b"x"})
+        b = make_dir("b", {"f.txt": b"x"})
+        _setxattr(a / "f.txt", "user.label", b"same")
+        _setxattr(b / "f.txt", "user.label", b"same")
+        assert komparu.compare_dir(str(a), str(b), compare_xattrs=True).equal is True
+
+    def test_off_by_default(self, make_dir):
+        a = make_dir("a", {"f.txt": b"x"})
+        b = make_dir("b", {"f.txt": b"x"})
+        _setxattr(a / "f.txt", "user.label", b"one")
+        assert komparu.compare_dir(str(a), str(b)).equal is True
+
+    def test_content_mismatch_wins(self, make_dir):
+        a = make_dir("a", {"f.txt": b"x"})
+        b = make_dir("b", {"f.txt": b"z"})
+        _setxattr(a / "f.txt", "user.label", b"one")
+        result = komparu.compare_dir(str(a), str(b), compare_xattrs=True)
+        assert result.diff == {"f.txt": DiffReason.CONTENT_MISMATCH}
+
+    def test_respects_ignore_and_depth(self, make_dir):
+        a = make_dir("a", {"f.log": b"x", "sub/g.txt": b"y"})
+        b = make_dir("b", {"f.log": b"x", "sub/g.txt": b"y"})
+        _setxattr(a / "f.log", "user.label", b"one")
+        _setxattr(a / "sub" / "g.txt", "user.label", b"one")
+        result = komparu.compare_dir(
+            str(a), str(b), compare_xattrs=True, ignore=["*.log"], max_depth=0,
+        )
+        assert result.equal is True
+
+
+def _same_mtime(*paths: Path, mtime: int = 1_700_000_000) -> None:
+    for path in paths:
+        os.utime(path, (mtime, mtime))
+
+
+class TestMetadataChecks:
+    """metadata= flags equal content with differing mode, mtime or owner."""
+
+    def test_mode(self, make_dir):
+        a = make_dir("a", {"f.sh": b"x", "g.txt": b"y"})
+        b = make_dir("b", {"f.sh": b"x", "g.txt": b"y"})
+        os.chmod(a / "f.sh", 0o755)
+        os.chmod(b / "f.sh", 0o644)
+        result = komparu.compare_dir(str(a), str(b), metadata=["mode"])
+        assert result.equal is False
+        assert result.diff == {"f.sh": DiffReason.MODE_MISMATCH}
+        assert komparu.compare_dir(str(a), str(b)).equal is True
+
+    def test_mtime_tolerance(self, make_dir):
+        a = make_dir("a", {"f.txt": b"x"})
+        b = make_dir("b", {"f.txt": b"x"})
+        _same_mtime(a / "f.txt")
+        _same_mtime(b / "f.txt", mtime=1_700_000_001)
+        result = komparu.compare_dir(str(a), str(b), metadata=["mtime"])
+        assert result.diff == {"f.txt": DiffReason.MTIME_MISMATCH}
+        result = komparu.compare_dir(str(a), str(b), metadata=["mtime"], mtime_tolerance=2)
+        assert result.equal is True
+
+    def test_owner(self, make_dir):
+        if not hasattr(os, "geteuid") or os.geteuid() != 0:
+            pytest.skip("changing ownership needs root")
+        a = make_dir("a", {"f.txt": b"x"})
+        b = make_dir("b", {"f.txt": b"x"})
+        os.chown(b / "f.txt", os.stat(a / "f.txt").st_uid, 12345)
+        assert komparu.compare_dir(str(a), str(b), metadata=["uid"]).equal is True
+        result = komparu.compare_dir(str(a), str(b), metadata=["gid"])
+        assert result.diff == {"f.txt": DiffReason.OWNER_MISMATCH}
+
+    def test_first_failed_check_wins(self, make_dir):
+        a = make_dir("a", {"f.txt": b"x"})
+        b = make_dir("b", {"f.txt": b"x"})
+        os.chmod(a / "f.txt", 0o600)
+        os.chmod(b / "f.txt", 0o644)
+        _same_mtime(a / "f.txt")
+        _same_mtime(b / "f.txt", mtime=1_600_000_000)
+        result = komparu.compare_dir(str(a), str(b), metadata=["mtime", "mode"])
+        assert result.diff == {"f.txt": DiffReason.MODE_MISMATCH}
+
+    def test_content_mismatch_wins(self, make_dir):
+        a = make_dir("a", {"f.txt": b"x"})
+        b = make_dir("b", {"f.txt": b"z"})
+        os.chmod(a / "f.txt", 0o600)
+        result = komparu.compare_dir(str(a), str(b), metadata=["mode"])
+        assert result.diff == {"f.txt": DiffReason.CONTENT_MISMATCH}
+
+    def test_xattr_check(self, make_dir):
+        a = make_dir("a", {"f.txt": b"x"})
+        b = make_dir("b", {"f.txt": b"x"})
+        _setxattr(a / "f.txt", "user.label", b"one")
+        result = komparu.compare_dir(str(a), str(b), metadata=["xattr"])
+        assert result.diff == {"f.txt": DiffReason.XATTR_MISMATCH}
+
+    def test_report_lists_every_failed_check(self, make_dir):
+        a = make_dir("a", {"f.txt": b"x", "same.txt": b"y"})
+        b = make_dir("b", {"f.txt": b"x", "same.txt": b"y"})
+        os.chmod(a / "f.txt", 0o600)
+        os.chmod(b / "f.txt", 0o644)
+        _same_mtime(a / "f.txt", a / "same.txt", b / "same.txt")
+        _same_mtime(b / "f.txt", mtime=1_600_000_000)
+        report = komparu.compare_dir_report(str(a), str(b), metadata=["mode", "mtime"])
+        by_path = {e.path: e for e in report.entries}
+        assert by_path["f.txt"].reason is DiffReason.MODE_MISMATCH
+        assert by_path["f.txt"].metadata == ("mode", "mtime")
+        assert by_path["same.txt"].status is komparu.EntryStatus.EQUAL
+        assert by_path["same.txt"].metadata == ()
+
+    def test_report_unreadable_metadata_keeps_equal(self, make_dir):
+        # Like DirResult.errors, an ERROR entry without a reason leaves equal alone.
+        a = make_dir("a", {"f.txt": b"x", "same.txt": b"y"})
+        b = make_dir("b", {"f.txt": b"x", "same.txt": b"y"})
+        original = komparu._api.metadata_diffs
+
+        def denied(path_a, *args):
+            if path_a.endswith("f.txt"):
+                raise PermissionError(path_a)
+            return original(path_a, *args)
+
+        komparu._api.metadata_diffs = denied
+        try:
+            report = komparu.compare_dir_report(str(a), str(b), metadata=["mode"])
+        finally:
+            komparu._api.metadata_diffs = original
+        by_path = {e.path: e for e in report.entries}
+        assert by_path["f.txt"] == komparu.ReportEntry("f.txt", komparu.EntryStatus.ERROR,
+                                                       size_a=1, size_b=1)
+        assert by_path["same.txt"].status is komparu.EntryStatus.EQUAL
+        assert report.equal is True
+
+    def test_invalid(self, make_dir):
+        a = make_dir("a", {"f.txt": b"x"})
+        with pytest.raises(ValueError, match="metadata checks"):
+            komparu.compare_dir(str(a), str(a), metadata=["size"])
+        with pytest.raises(TypeError, match="list"):
+            komparu.compare_dir(str(a), str(a), metadata="mode")
+        with pytest.raises(ValueError, match="mtime_tolerance"):
+            komparu.compare_dir(str(a), str(a), mtime_tolerance=-1)
+
+
+class TestContentFilter:
+    """content_filter= re-compares differing files through a filter."""
+
+    @staticmethod
+    def _strip_comments(path, stream):
+        lines = [ln for ln in stream.read().splitlines(True) if not ln.startswith(b"#")]
+        return io.BytesIO(b"".join(lines))
+
+    def test_filtered_equal_dropped(self, make_dir):
+        a = make_dir("a", {"x.cfg": b"# v1\nk=1\n", "y.cfg": b"k=1\n"})
+        b = make_dir("b", {"x.cfg": b"# version 2\nk=1\n", "y.cfg": b"k=2\n"})
+        result = komparu.compare_dir(str(a), str(b), content_filter=self._strip_comments)
+        assert result.diff == {"y.cfg": DiffReason.CONTENT_MISMATCH}
+
+    def test_all_equal_after_filter(self, make_dir):
+        a = make_dir("a", {"x.cfg": b"# v1\nk=1\n"})
+        b = make_dir("b", {"x.cfg": b"# v2\nk=1\n"})
+        result = komparu.compare_dir(str(a), str(b), content_filter=self._strip_comments)
+        assert result.equal is True
+
+    def test_filter_error_per_file(self, make_dir):
+        a = make_dir("a", {"bad.cfg": b"1", "ok.cfg": b"# a\nk\n"})
+        b = make_dir("b", {"bad.cfg": b"2", "ok.cfg": b"# b\nk\n"})
+
+        def flt(path, stream):
+            if path.endswith("bad.cfg"):
+                raise ValueError("cannot parse")
+            return self._strip_comments(path, stream)
+
+        result = komparu.compare_dir(str(a), str(b), content_filter=flt)
+        assert result.diff == {"bad.cfg": DiffReason.READ_ERROR}
+
+    def test_identical_files_not_filtered(self, make_dir):
+        a = make_dir("a", {"x.cfg": b"same"})
+        b = make_dir("b", {"x.cfg": b"same"})
+        calls = []
+
+        def flt(path, stream):
+            calls.append(path)
+            return stream
+
+        assert komparu.compare_dir(str(a), str(b), content_filter=flt).equal is True
+        assert calls == []
+
+    def test_refilter_keeps_other_fields(self, make_dir):
+        from komparu._helpers import refilter_diff
+
+        a = make_dir("a", {"x.cfg": b"# a\nk\n"})
+        b = make_dir("b", {"x.cfg": b"# bb\nk\n"})
+        result = komparu.DirResult(
+            equal=False, diff={"x.cfg": DiffReason.SIZE_MISMATCH},
+            only_left=set(), only_right=set(), errors={"locked"},
+            renamed=[("old", "new")],
+            expected_diffs={"v.txt": DiffReason.CONTENT_MISMATCH},
+            stale_known_diffs={"s.txt"},
+        )
+        out = refilter_diff(
+            result, str(a), str(b),
+            lambda p, q: komparu.compare(p, q, content_filter=self._strip_comments),
+        )
+        assert out.diff == {}
+        assert out.errors == {"locked"}
+        assert out.renamed == [("old", "new")]
+        assert out.expected_diffs == {"v.txt": DiffReason.CONTENT_MISMATCH}
+        assert out.stale_known_diffs == {"s.txt"}
+
+
+class TestDirOpener:
+    """opener= reads every file of both trees through a custom function."""
+
+    @staticmethod
+    def _unxor(path):
+        with open(path, "rb") as f:
+            return io.BytesIO(bytes(c ^ 0x5A for c in f.read()))
+
+    def test_pairs_read_through_opener(self, make_dir):
+        a = make_dir("a", {"x": bytes(c ^ 0x5A for c in b"plain"), "sub/y": b"\x00"})
+        b = make_dir("b", {"x": b"plain", "sub/y": b"\x00", "z": b""})
+        opened = []
+
+        def opener(path):
+            opened.append(os.path.relpath(path, str(a.parent)))
+            return self._unxor(path) if path.startswith(str(a)) else open(path, "rb")
+
+        result = komparu.compare_dir(str(a), str(b), opener=opener, max_workers=1)
+        assert result.diff == {"sub/y": DiffReason.CONTENT_MISMATCH}
+        assert result.only_right == {"z"}
+        assert sorted(opened) == ["a/sub/y", "a/x", "b/sub/y", "b/x"]
+
+    def test_opener_error_per_file(self, make_dir):
+        a = make_dir("a", {"bad": b"1", "ok": b"2"})
+        b = make_dir("b", {"bad": b"1", "ok": b"2"})
+
+        def opener(path):
+            if path.endswith("bad"):
+                raise PermissionError(path)
+            return open(path, "rb")
+
+        result = komparu.compare_dir(str(a), str(b), opener=opener)
+        assert result.diff == {"bad": DiffReason.READ_ERROR}
+        with pytest.raises(PermissionError):
+            komparu.compare_dir(str(a), str(b), opener=opener, stop_on_error=True)
+
+    def test_content_filter_uses_opener(self, make_dir):
+        a = make_dir("a", {"x.cfg": bytes(c ^ 0x5A for c in b"# a\nk\n")})
+        b = make_dir("b", {"x.cfg": bytes(c ^ 0x5A for c in b"# bb\nk\n")})
+        result = komparu.compare_dir(
+            str(a), str(b), opener=self._unxor,
+            content_filter=TestContentFilter._strip_comments,
+        )
+        assert result.equal is True
+
+    @pytest.mark.parametrize("option", [
+        {"cache": "c"}, {"detect_renames": True}, {"known_diffs": "k"},
+        {"special_files": True}, {"detect_hardlinks": True},
+    ])
+    def test_rejects_direct_readers(self, make_dir, option):
+        a = make_dir("a", {"x": b"1"})
+        with pytest.raises(ValueError, match="opener"):
+            komparu.compare_dir(str(a), str(a), opener=self._unxor, **option)
+
+
+class TestPathRewrite:
+    """path_rewrite= drops pairs that match after substitution."""
+
+    def test_rewritten_equal_dropped(self, make_dir):
+        a = make_dir("a", {"x.log": b"cwd=/ci/a\n", "y.log": b"v1"})
+        b = make_dir("b", {"x.log": b"cwd=/ci/b\n", "y.log": b"v2"})
+        result = komparu.compare_dir(
+            str(a), str(b), path_rewrite=[("/ci/a", "ROOT"), ("/ci/b", "ROOT")],
+        )
+        assert result.diff == {"y.log": DiffReason.CONTENT_MISMATCH}
+
+
+class TestEncodingMismatch:
+    """detect_encoding_mismatch labels same-text, different-bytes files."""
+
+    TEXT = "naïve café — 12 €\nsecond line\n"
+
+    def _compare(self, make_dir, data_a: bytes, data_b: bytes, **kw):
+        a = make_dir("a", {"f.txt": data_a, "other.txt": b"one"})
+        b = make_dir("b", {"f.txt": data_b, "other.txt": b"two"})
+        return komparu.compare_dir(str(a), str(b), detect_encoding_mismatch=True, **kw)
+
+    def test_off_by_default(self, make_dir):
+        a = make_dir("a", {"f.txt": self.TEXT.encode("utf-8")})
+        b = make_dir("b", {"f.txt": self.TEXT.encode("utf-16")})
+        result = komparu.compare_dir(str(a), str(b))
+        assert result.diff["f.txt"] in (DiffReason.SIZE_MISMATCH, DiffReason.CONTENT_MISMATCH)
+
+    def test_utf8_vs_utf16(self, make_dir):
+        result = self._compare(make_dir, self.TEXT.encode("utf-8"), self.TEXT.encode("utf-16"))
+        assert result.diff == {
+            "f.txt": DiffReason.ENCODING_MISMATCH,
+            "other.txt": DiffReason.CONTENT_MISMATCH,
+        }
+        assert result.equal is False
+
+    def test_bom_only(self, make_dir):
+        data = self.TEXT.encode("utf-8")
+        result = self._compare(make_dir, data, b"\xef\xbb\xbf" + data)
+        assert result.diff["f.txt"] is DiffReason.ENCODING_MISMATCH
+
+    def test_bomless_utf16(self, make_dir):
+        result = self._compare(
+            make_dir, self.TEXT.encode("utf-16-be"), self.TEXT.encode("utf-8"),
+        )
+        assert result.diff["f.txt"] is DiffReason.ENCODING_MISMATCH
+
+    def test_legacy_codepage(self, make_dir):
+        result = self._compare(
+            make_dir, self.TEXT.encode("cp1252"), self.TEXT.encode("utf-32"),
+        )
+        assert result.diff["f.txt"] is DiffReason.ENCODING_MISMATCH
+
+    def test_text_change_is_still_content(self, make_dir):
+        result = self._compare(
+            make_dir, self.TEXT.encode("utf-8"), self.TEXT.upper().encode("utf-16"),
+        )
+        assert result.diff["f.txt"] in (DiffReason.SIZE_MISMATCH, DiffReason.CONTENT_MISMATCH)
+
+    def test_line_endings_not_normalized(self, make_dir):
+        result = self._compare(
+            make_dir, b"a\nb\n", b"\xef\xbb\xbfa\r\nb\r\n",
+        )
+        assert result.diff["f.txt"] is DiffReason.SIZE_MISMATCH
+
+    def test_binary_not_flagged(self, make_dir):
+        result = self._compare(make_dir, b"\x00\x01\x02\x00", b"\x00\x01\x03\x00")
+        assert result.diff["f.txt"] is DiffReason.CONTENT_MISMATCH
+
+
+class TestDetectRenames:
+    """detect_renames pairs moved files with identical content."""
+
+    def test_moved_file(self, make_dir):
+        a = make_dir("a", {"old/data.bin": b"payload", "keep.txt": b"k"})
+        b = make_dir("b", {"new/data.bin": b"payload", "keep.txt": b"k"})
+        result = komparu.compare_dir(str(a), str(b), detect_renames=True)
+        assert result.renamed == [("old/data.bin", "new/data.bin")]
+        assert result.only_left == set()
+        assert result.only_right == set()
+        assert result.equal is False
+
+    def test_off_by_default(self, make_dir):
+        a = make_dir("a", {"x.txt": b"same"})
+        b = make_dir("b", {"y.txt": b"same"})
+        result = komparu.compare_dir(str(a), str(b))
+        assert result.renamed == []
+        assert result.only_left == {"x.txt"}
+
+    def test_same_size_different_content(self, make_dir):
+        a = make_dir("a", {"x.txt": b"aaaa"})
+        b = make_dir("b", {"y.txt": b"bbbb"})
+        result = komparu.compare_dir(str(a), str(b), detect_renames=True)
+        assert result.renamed == []
+        assert result.only_left == {"x.txt"}
+        assert result.only_right == {"y.txt"}
+
+    def test_duplicates_pair_once(self, make_dir):
+        a = make_dir("a", {"a1": b"dup", "a2": b"dup"})
+        b = make_dir("b", {"b1": b"dup"})
+        result = komparu.compare_dir(str(a), str(b), detect_renames=True)
+        assert result.renamed == [("a1", "b1")]
+        assert result.only_left == {"a2"}
+        assert result.only_right == set()
+
+    def test_multiple_renames_sorted(self, make_dir):
+        a = make_dir("a", {"z_old": b"one", "m_old": b"two!", "gone": b"x"})
+        b = make_dir("b", {"z_new": b"one", "m_new": b"two!", "added": b"yy"})
+        result = komparu.compare_dir(
+            str(a), str(b), detect_renames=True, max_workers=1,
+        )
+        assert result.renamed == [("m_old", "m_new"), ("z_old", "z_new")]
+        assert result.only_left == {"gone"}
+        assert result.only_right == {"added"}
+
+    def test_with_ignore(self, make_dir):
+        a = make_dir("a", {"x.log": b"same", "src/a.py": b"code"})
+        b = make_dir("b", {"y.log": b"same", "lib/a.py": b"code"})
+        result = komparu.compare_dir(
+            str(a), str(b), ignore=["*.log"], detect_renames=True,
+        )
+        assert result.renamed == [("src/a.py", "lib/a.py")]
+
+    def test_dangling_link_and_fifo_not_candidates(self, make_dir):
+        a = make_dir("a", {"moved": b"data"})
+        b = make_dir("b", {"target": b"data"})
+        os.symlink("missing", a / "dang")
+        os.mkfifo(a / "pipe")
+        os.mkfifo(b / "pipe2")
+        result = komparu.compare_dir(str(a), str(b), detect_renames=True, special_files=True)
+        assert result.renamed == [("moved", "target")]
+        assert result.only_left == {"dang", "pipe"}
+        assert result.only_right == {"pipe2"}
+
+    def test_followed_link_is_candidate(self, make_dir, tmp_path):
+        a = make_dir("a", {"moved": b"data"})
+        b = make_dir("b", {"other": b"x"})
+        (tmp_path / "outside").write_bytes(b"data")
+        os.symlink(tmp_path / "outside", b / "link")
+        result = komparu.compare_dir(str(a), str(b), detect_renames=True, symlinks="follow")
+        assert result.renamed == [("moved", "link")]
+        result = komparu.compare_dir(str(a), str(b), detect_renames=True, symlinks="compare-link")
+        assert result.renamed == []
+
 
 # ---- New tests: Unicode paths ----
 
@@ -623,6 +1548,568 @@ class TestIgnorePatterns:
         assert result.only_left == set()
 
 
+class TestExcludeInclude:
+    """exclude=/include= filter the walk with gitignore-style patterns."""
+
+    def test_exclude_name_at_any_depth(self, make_dir):
+        a = make_dir("a", {"app.py": b"x", "run.log": b"1", "sub/deep.log": b"1"})
+        b = make_dir("b", {"app.py": b"x", "run.log": b"2"})
+        result = komparu.compare_dir(str(a), str(b), exclude=["*.log"])
+        assert result.equal is True
+        assert not result.only_left
+
+    def test_trailing_slash_matches_directories_only(self, make_dir):
+        a = make_dir("a", {".git/HEAD": b"a", "x/.git": b"a"})
+        b = make_dir("b", {".git/HEAD": b"b", "x/.git": b"b"})
+        result = komparu.compare_dir(str(a), str(b), exclude=[".git/"])
+        assert set(result.diff) == {"x/.git"}
+
+    def test_anchored_pattern(self, make_dir):
+        a = make_dir("a", {"build/out": b"a", "src/build/out": b"a"})
+        b = make_dir("b", {"build/out": b"b", "src/build/out": b"b"})
+        result = komparu.compare_dir(str(a), str(b), exclude=["/build"])
+        assert set(result.diff) == {"src/build/out"}
+        result = komparu.compare_dir(str(a), str(b), exclude=["src/build/"])
+        assert set(result.diff) == {"build/out"}
+
+    def test_double_star(self, make_dir):
+        a = make_dir("a", {"gen/x.pb.go": b"a", "api/v1/gen/y.pb.go": b"a", "api/z.go": b"a"})
+        b = make_dir("b", {"gen/x.pb.go": b"b", "api/v1/gen/y.pb.go": b"b", "api/z.go": b"b"})
+        result = komparu.compare_dir(str(a), str(b), exclude=["**/gen/**"])
+        assert set(result.diff) == {"api/z.go"}
+
+    @pytest.mark.skipif(not os.path.exists("/proc/self/mem"), reason="needs /proc/self/mem")
+    def test_excluded_directory_not_walked(self, make_dir):
+        """A pruned subtree is never read, so its errors cannot stop the run."""
+        a = make_dir("a", {"keep.txt": b"x"})
+        b = make_dir("b", {"keep.txt": b"x", "vendor/mem": b""})
+        (a / "vendor").mkdir()
+        (a / "vendor" / "mem").symlink_to("/proc/self/mem")  # read() fails with EIO
+        with pytest.raises(OSError, match="vendor/mem"):
+            komparu.compare_dir(str(a), str(b), ignore=["vendor"], stop_on_error=True)
+        result = komparu.compare_dir(str(a), str(b), exclude=["vendor/"], stop_on_error=True)
+        assert result.equal is True
+
+    def test_include_files(self, make_dir):
+        a = make_dir("a", {"main.py": b"a", "notes.txt": b"a", "pkg/mod.py": b"x"})
+        b = make_dir("b", {"main.py": b"a", "notes.txt": b"b", "pkg/mod.py": b"x",
+                           "extra.md": b"b"})
+        result = komparu.compare_dir(str(a), str(b), include=["*.py"])
+        assert result.equal is True
+
+    def test_include_directory(self, make_dir):
+        a = make_dir("a", {"src/a.c": b"a", "src/sub/b.c": b"a", "doc/c.md": b"a"})
+        b = make_dir("b", {"src/a.c": b"b", "src/sub/b.c": b"a", "doc/c.md": b"b"})
+        result = komparu.compare_dir(str(a), str(b), include=["src/"])
+        assert set(result.diff) == {"src/a.c"}
+
+    def test_exclude_wins_over_include(self, make_dir):
+        a = make_dir("a", {"x.py": b"a", "tests/y.py": b"a"})
+        b = make_dir("b", {"x.py": b"b", "tests/y.py": b"b"})
+        result = komparu.compare_dir(str(a), str(b), include=["*.py"], exclude=["tests/"])
+        assert set(result.diff) == {"x.py"}
+
+    def test_summary_and_report(self, make_dir):
+        a = make_dir("a", {"a.txt": b"x", "b.log": b"1"})
+        b = make_dir("b", {"a.txt": b"x", "b.log": b"2"})
+        summary = komparu.compare_dir_summary(str(a), str(b), exclude=["*.log"])
+        assert summary.equal is True
+        assert summary.compared == 1
+        report = komparu.compare_dir_report(str(a), str(b), exclude=["*.log"])
+        assert [e.path for e in report.entries] == ["a.txt"]
+
+    def test_invalid_patterns(self, make_dir):
+        a = make_dir("a", {"f": b"x"})
+        with pytest.raises(ValueError, match="exclude"):
+            komparu.compare_dir(str(a), str(a), exclude=["/"])
+        with pytest.raises(TypeError, match="include"):
+            komparu.compare_dir(str(a), str(a), include="*.py")
+
+
+class TestDirProgress:
+    """progress reports whole-tree counters from the calling thread."""
+
+    def _trees(self, make_dir):
+        files_a = {f"d{i % 3}/f{i}": b"x" * (1000 + i) for i in range(30)}
+        files_b = dict(files_a)
+        files_b["d0/f0"] = b"y" * 1000
+        files_b["d1/f1"] = b"x" * 5000
+        files_a["only_a"] = b"left"
+        return make_dir("a", files_a), make_dir("b", files_b)
+
+    def test_final_totals(self, make_dir):
+        a, b = self._trees(make_dir)
+        calls = []
+        result = komparu.compare_dir(str(a), str(b), progress=lambda *c: calls.append(c),
+                                     progress_interval=0.001)
+        assert "d0/f0" in result.diff
+        expected_bytes = sum(1000 + i for i in range(30)) - 1001 + 5000
+        assert calls[-1] == (30, 30, expected_bytes, expected_bytes)
+
+    def test_monotonic_and_throttled(self, make_dir):
+        a, b = self._trees(make_dir)
+        calls = []
+        komparu.compare_dir(str(a), str(b), max_workers=4,
+                            progress=lambda *c: calls.append(c), progress_interval=0.001)
+        assert len(calls) == len(set(calls))  # only changes are reported
+        for prev, cur in zip(calls, calls[1:]):
+            assert cur[0] >= prev[0] and cur[2] >= prev[2]
+        for done, total, bdone, btotal in calls:
+            assert done <= total and bdone <= btotal
+
+    def test_calling_thread(self, make_dir):
+        import threading
+
+        a, b = self._trees(make_dir)
+        threads = set()
+        komparu.compare_dir(str(a), str(b), max_workers=4,
+                            progress=lambda *c: threads.add(threading.get_ident()))
+        assert threads == {threading.get_ident()}
+
+    def test_callback_error_propagates(self, make_dir):
+        a, b = self._trees(make_dir)
+
+        def fail(*counts):
+            raise RuntimeError("stop")
+
+        with pytest.raises(RuntimeError, match="stop"):
+            komparu.compare_dir(str(a), str(b), progress=fail)
+
+    def test_walk_error_propagates(self, make_dir, tmp_path: Path):
+        a, _ = self._trees(make_dir)
+        with pytest.raises(OSError):
+            komparu.compare_dir(str(a), str(tmp_path / "missing"), progress=lambda *c: None)
+
+    def test_invalid_interval(self, make_dir):
+        a, b = self._trees(make_dir)
+        with pytest.raises(ValueError, match="progress_interval"):
+            komparu.compare_dir(str(a), str(b), progress=lambda *c: None, progress_interval=0)
+
+    def test_events(self, make_dir):
+        a, b = self._trees(make_dir)
+        events, calls = [], []
+        komparu.compare_dir(str(a), str(b), max_workers=1, progress_interval=0.001,
+                            progress=lambda *c: calls.append(c), on_progress=events.append)
+        assert [(e.files_done, e.files_total, e.bytes_done, e.bytes_total)
+                for e in events] == calls
+        assert events[-1].path.startswith("d")  # a compared pair, not only_a
+
+    def test_events_inside_large_file(self, tmp_path: Path):
+        for side in ("a", "b"):
+            (tmp_path / side).mkdir()
+            with open(tmp_path / side / "big.img", "wb") as f:
+                f.truncate(512 << 20)  # sparse
+        events = []
+        komparu.configure(skip_holes=False)
+        try:
+            komparu.compare_dir(str(tmp_path / "a"), str(tmp_path / "b"),
+                                on_progress=events.append, progress_interval=0.001)
+        finally:
+            reset_config()
+        assert any(e.files_done == 0 and 0 < e.bytes_done < e.bytes_total for e in events)
+        assert events[-1].path == "big.img"
+
+    def test_summary_and_report(self, make_dir):
+        a, b = self._trees(make_dir)
+        for run in (komparu.compare_dir_summary, komparu.compare_dir_report):
+            events = []
+            run(str(a), str(b), on_progress=events.append, progress_interval=0.001)
+            assert events[-1].files_done == events[-1].files_total == 30
+
+
+class TestDirCancel:
+    """A CancelToken stops the walk and the pool workers."""
+
+    def setup_method(self):
+        komparu.configure(skip_holes=False)
+
+    def teardown_method(self):
+        reset_config()
+
+    def _trees(self, tmp_path: Path, files: int = 4) -> tuple[str, str]:
+        for side in ("a", "b"):
+            d = tmp_path / side
+            d.mkdir()
+            for i in range(files):
+                with open(d / f"f{i}.img", "wb") as f:
+                    f.truncate(4 << 30)  # sparse
+        return str(tmp_path / "a"), str(tmp_path / "b")
+
+    def test_cancel_from_thread(self, tmp_path):
+        import threading
+        import time
+
+        a, b = self._trees(tmp_path)
+        token = komparu.CancelToken()
+        threading.Timer(0.1, token.cancel).start()
+        start = time.monotonic()
+        with pytest.raises(komparu.CancelledError):
+            komparu.compare_dir(a, b, max_workers=2, quick_check=False, cancel=token)
+        assert time.monotonic() - start < 2
+
+    def test_deadline_sequential(self, tmp_path):
+        a, b = self._trees(tmp_path)
+        token = komparu.CancelToken(timeout=0.1)
+        with pytest.raises(komparu.ComparisonTimeoutError):
+            komparu.compare_dir_summary(a, b, max_workers=1, quick_check=False, cancel=token)
+
+    def test_already_cancelled(self, make_dir):
+        a = make_dir("a", {"f": b"x"})
+        b = make_dir("b", {"f": b"y"})
+        token = komparu.CancelToken()
+        token.cancel()
+        with pytest.raises(komparu.CancelledError):
+            komparu.compare_dir(str(a), str(b), cancel=token)
+        with pytest.raises(komparu.CancelledError):
+            komparu.compare_dir_report(str(a), str(b), cancel=token)
+
+    def test_unused_token(self, make_dir):
+        a = make_dir("a", {"f": b"x", "d/g": b"1"})
+        b = make_dir("b", {"f": b"y", "d/g": b"1"})
+        token = komparu.CancelToken(timeout=60)
+        result = komparu.compare_dir(str(a), str(b), max_workers=2, cancel=token)
+        assert set(result.diff) == {"f"}
+
+
+class TestKnownDiffs:
+    """known_diffs downgrades allowlisted differences."""
+
+    def _allow(self, tmp_path: Path, text: str) -> str:
+        p = tmp_path / "known.txt"
+        p.write_text(text)
+        return str(p)
+
+    def test_listed_diff_is_expected(self, make_dir, tmp_path: Path):
+        a = make_dir("a", {"flaky.bin": b"aaaa", "ok": b"1"})
+        b = make_dir("b", {"flaky.bin": b"aaab", "ok": b"1"})
+        result = komparu.compare_dir(str(a), str(b), known_diffs=self._allow(tmp_path, "flaky.bin\n"))
+        assert result.equal is True
+        assert result.diff == {}
+        assert result.expected_diffs == {"flaky.bin": DiffReason.CONTENT_MISMATCH}
+        assert result.stale_known_diffs == set()
+
+    def test_unlisted_diff_still_fails(self, make_dir, tmp_path: Path):
+        a = make_dir("a", {"flaky.bin": b"aaaa", "real": b"1"})
+        b = make_dir("b", {"flaky.bin": b"aaab", "real": b"2"})
+        result = komparu.compare_dir(str(a), str(b), known_diffs=self._allow(tmp_path, "flaky.bin\n"))
+        assert result.equal is False
+        assert set(result.diff) == {"real"}
+
+    def test_stale_entry(self, make_dir, tmp_path: Path):
+        a = make_dir("a", {"fixed": b"same", "sub/gone": b"x"})
+        b = make_dir("b", {"fixed": b"same"})
+        allow = self._allow(tmp_path, "# fixed upstream?\n\nfixed\nsub/gone\nnever/existed\n")
+        result = komparu.compare_dir(str(a), str(b), known_diffs=allow)
+        assert result.stale_known_diffs == {"fixed"}
+        assert result.only_left == {"sub/gone"}
+        assert result.equal is False
+
+    def test_offset_must_match(self, make_dir, tmp_path: Path):
+        a = make_dir("a", {"x.bin": b"0123456789", "y.bin": b"0123456789"})
+        b = make_dir("b", {"x.bin": b"0123X56789", "y.bin": b"01234567X9"})
+        allow = self._allow(tmp_path, "x.bin @4\ny.bin @4\n")
+        result = komparu.compare_dir(str(a), str(b), known_diffs=allow)
+        assert set(result.expected_diffs) == {"x.bin"}
+        assert set(result.diff) == {"y.bin"}
+
+    def test_path_with_spaces_and_backslashes(self, make_dir, tmp_path: Path):
+        a = make_dir("a", {"my dir/out file": b"1"})
+        b = make_dir("b", {"my dir/out file": b"2"})
+        result = komparu.compare_dir(str(a), str(b), known_diffs=self._allow(tmp_path, "my dir\\out file\n"))
+        assert set(result.expected_diffs) == {"my dir/out file"}
+
+    def test_ignored_entry_not_stale(self, make_dir, tmp_path: Path):
+        a = make_dir("a", {"cache/x": b"1"})
+        b = make_dir("b", {"cache/x": b"1"})
+        result = komparu.compare_dir(str(a), str(b), ignore=["cache"],
+                                     known_diffs=self._allow(tmp_path, "cache/x\n"))
+        assert result.stale_known_diffs == set()
+
+    def test_bad_offset(self, make_dir, tmp_path: Path):
+        a = make_dir("a", {"f": b"1"})
+        with pytest.raises(ValueError, match="known.txt:1"):
+            komparu.compare_dir(str(a), str(a), known_diffs=self._allow(tmp_path, "f @x\n"))
+
+
+class TestRenameMap:
+    """rename_map pairs files across a known reorganization."""
+
+    def test_all_paths_renamed(self, make_dir):
+        a = make_dir("a", {"old/x.txt": b"one", "old/y.txt": b"two"})
+        b = make_dir("b", {"new/x.txt": b"one", "new/y.txt": b"TWO"})
+        result = komparu.compare_dir(
+            str(a), str(b),
+            rename_map={"old/x.txt": "new/x.txt", "old/y.txt": "new/y.txt"},
+        )
+        assert result.renamed == [("old/x.txt", "new/x.txt")]
+        assert result.diff == {"old/y.txt": DiffReason.CONTENT_MISMATCH}
+        assert result.only_left == set()
+        assert result.only_right == set()
+        assert result.equal is False
+
+    def test_reorganization_preserved(self, make_dir):
+        a = make_dir("a", {"src/main.c": b"int main;", "README": b"hi"})
+        b = make_dir("b", {"lib/main.c": b"int main;", "README": b"hi"})
+        result = komparu.compare_dir(str(a), str(b), rename_map={"src/main.c": "lib/main.c"})
+        assert result.equal is True
+        assert result.renamed == [("src/main.c", "lib/main.c")]
+
+    def test_missing_side_reported(self, make_dir):
+        a = make_dir("a", {"kept": b"1", "dropped": b"2"})
+        b = make_dir("b", {"kept.new": b"1", "appeared": b"3"})
+        result = komparu.compare_dir(
+            str(a), str(b),
+            rename_map={"kept": "kept.new", "dropped": "dropped.new", "never": "appeared"},
+        )
+        assert result.renamed == [("kept", "kept.new")]
+        assert result.only_left == {"dropped"}
+        assert result.only_right == {"appeared"}
+
+    def test_mapping_overrides_same_path(self, make_dir):
+        a = make_dir("a", {"x": b"old x", "y": b"new x"})
+        b = make_dir("b", {"x": b"new x", "y": b"new x"})
+        result = komparu.compare_dir(str(a), str(b), rename_map={"y": "x"})
+        assert result.renamed == [("y", "x")]
+        assert result.only_left == {"x"}
+        assert result.only_right == {"y"}
+
+    def test_swap(self, make_dir):
+        a = make_dir("a", {"p": b"P", "q": b"Q"})
+        b = make_dir("b", {"p": b"Q", "q": b"P"})
+        result = komparu.compare_dir(str(a), str(b), rename_map={"p": "q", "q": "p"})
+        assert result.equal is True
+        assert result.renamed == [("p", "q"), ("q", "p")]
+
+    def test_unmapped_files_compared_by_path(self, make_dir):
+        a = make_dir("a", {"moved": b"m", "stay": b"1"})
+        b = make_dir("b", {"moved2": b"m", "stay": b"2"})
+        result = komparu.compare_dir(str(a), str(b), rename_map={"moved": "moved2"})
+        assert result.diff == {"stay": DiffReason.CONTENT_MISMATCH}
+
+    def test_ignored_paths_left_out(self, make_dir):
+        a = make_dir("a", {"a.log": b"1"})
+        b = make_dir("b", {"b.log": b"2"})
+        result = komparu.compare_dir(
+            str(a), str(b), ignore=["*.log"], rename_map={"a.log": "b.log"},
+        )
+        assert result.equal is True
+        assert result.diff == {}
+
+    def test_backslash_keys(self, make_dir):
+        a = make_dir("a", {"old/f": b"x"})
+        b = make_dir("b", {"new/f": b"x"})
+        result = komparu.compare_dir(str(a), str(b), rename_map={"old\\f": "new\\f"})
+        assert result.renamed == [("old/f", "new/f")]
+
+    def test_duplicate_target(self, make_dir):
+        a = make_dir("a", {})
+        b = make_dir("b", {})
+        with pytest.raises(ValueError, match="target of more than one"):
+            komparu.compare_dir(str(a), str(b), rename_map={"x": "t", "y": "t"})
+
+    def test_combined_with_detect_renames(self, make_dir):
+        a = make_dir("a", {"mapped": b"m", "moved": b"content"})
+        b = make_dir("b", {"mapped2": b"m", "elsewhere": b"content"})
+        result = komparu.compare_dir(
+            str(a), str(b), rename_map={"mapped": "mapped2"}, detect_renames=True,
+        )
+        assert result.renamed == [("mapped", "mapped2"), ("moved", "elsewhere")]
+
+
+class TestCompareDirReport:
+    """compare_dir_report lists every path with its status and sizes."""
+
+    def test_statuses_and_sizes(self, make_dir):
+        a = make_dir("a", {"same": b"x", "sub/changed": b"abcd", "left": b"1", "short": b"ab"})
+        b = make_dir("b", {"same": b"x", "sub/changed": b"abXd", "right": b"22", "short": b"abc"})
+        report = komparu.compare_dir_report(str(a), str(b))
+        assert report.equal is False
+        assert [e.path for e in report.entries] == ["left", "right", "same", "short", "sub/changed"]
+        by_path = {e.path: e for e in report.entries}
+        assert by_path["same"] == komparu.ReportEntry("same", komparu.EntryStatus.EQUAL,
+                                                      size_a=1, size_b=1)
+        assert by_path["sub/changed"].reason is DiffReason.CONTENT_MISMATCH
+        assert by_path["short"].status is komparu.EntryStatus.DIFFERENT
+        assert (by_path["short"].size_a, by_path["short"].size_b) == (2, 3)
+        assert (by_path["left"].size_a, by_path["left"].size_b) == (1, None)
+        assert (by_path["right"].size_a, by_path["right"].size_b) == (None, 2)
+        assert by_path["sub/changed"].first_diff_offset is None
+        assert report.counts[komparu.EntryStatus.DIFFERENT] == 2
+        assert report.counts[komparu.EntryStatus.ERROR] == 0
+
+    def test_offsets(self, make_dir):
+        a = make_dir("a", {"changed": b"abcd", "short": b"ab"})
+        b = make_dir("b", {"changed": b"abXd", "short": b"abc"})
+        report = komparu.compare_dir_report(str(a), str(b), offsets=True)
+        assert {e.path: e.first_diff_offset for e in report.entries} == {"changed": 2, "short": 2}
+
+    def test_equal(self, make_dir):
+        files = {"x": b"1", "d/y": b"2"}
+        report = komparu.compare_dir_report(str(make_dir("a", files)), str(make_dir("b", files)))
+        assert report.equal is True
+        assert {e.status for e in report.entries} == {komparu.EntryStatus.EQUAL}
+
+    def test_same_directory_lists_files(self, make_dir):
+        a = make_dir("a", {"x": b"1", "d/y": b"22"})
+        report = komparu.compare_dir_report(str(a), str(a))
+        assert report.equal is True
+        assert [(e.path, e.size_a, e.size_b) for e in report.entries] == [
+            ("d/y", 2, 2), ("x", 1, 1)]
+
+    def test_ignore_and_max_depth(self, make_dir):
+        files = {"keep": b"1", "skip.log": b"2", "deep/f": b"3"}
+        a, b = make_dir("a", files), make_dir("b", files)
+        report = komparu.compare_dir_report(str(a), str(b), ignore=["*.log"], max_depth=0)
+        assert [e.path for e in report.entries] == ["keep"]
+
+    def test_read_error_is_error(self, make_dir):
+        if not os.path.exists("/proc/self/mem"):
+            pytest.skip("needs /proc/self/mem")
+        a = make_dir("a", {"ok": b"1"})
+        b = make_dir("b", {"ok": b"1", "m": b""})
+        (a / "m").symlink_to("/proc/self/mem")
+        report = komparu.compare_dir_report(str(a), str(b), offsets=True)
+        entry = report.entries[0]
+        assert (entry.path, entry.status, entry.reason) == (
+            "m", komparu.EntryStatus.ERROR, DiffReason.READ_ERROR)
+        assert entry.first_diff_offset is None
+
+
+class TestGroupByTopDir:
+    """group_by_top_dir buckets a result by first path component."""
+
+    def test_groups(self, make_dir):
+        a = make_dir("a", {"auth/x": b"1", "auth/y": b"1", "billing/z": b"1", "top": b"1"})
+        b = make_dir("b", {"auth/x": b"2", "auth/new": b"1", "billing/z": b"1", "top": b"2"})
+        groups = komparu.group_by_top_dir(komparu.compare_dir(str(a), str(b)))
+        assert list(groups) == ["", "auth"]
+        auth = groups["auth"]
+        assert auth.equal is False
+        assert auth.diff == {"auth/x": DiffReason.CONTENT_MISMATCH}
+        assert auth.only_left == {"auth/y"}
+        assert auth.only_right == {"auth/new"}
+        assert groups[""].diff == {"top": DiffReason.CONTENT_MISMATCH}
+
+    def test_include_reports_clean_groups(self, make_dir):
+        a = make_dir("a", {"auth/x": b"1", "billing/z": b"1"})
+        b = make_dir("b", {"auth/x": b"2", "billing/z": b"1"})
+        groups = komparu.group_by_top_dir(
+            komparu.compare_dir(str(a), str(b)), include=sorted(os.listdir(a)),
+        )
+        assert groups["billing"].equal is True
+        assert groups["billing"].diff == {}
+        assert len(groups["auth"].diff) == 1
+
+    def test_renamed_and_known_diffs(self):
+        result = komparu.DirResult(
+            equal=True, diff={}, only_left=set(), only_right=set(),
+            errors={"svc/locked"},
+            renamed=[("svc/old", "other/new")],
+            expected_diffs={"svc/flaky": DiffReason.CONTENT_MISMATCH},
+            stale_known_diffs={"other/fixed"},
+        )
+        groups = komparu.group_by_top_dir(result)
+        assert groups["svc"].renamed == [("svc/old", "other/new")]
+        assert groups["svc"].errors == {"svc/locked"}
+        assert groups["svc"].expected_diffs == {"svc/flaky": DiffReason.CONTENT_MISMATCH}
+        assert groups["svc"].equal is True
+        assert groups["other"].stale_known_diffs == {"other/fixed"}
+
+    def test_empty(self):
+        result = komparu.DirResult(equal=True, diff={}, only_left=set(), only_right=set())
+        assert komparu.group_by_top_dir(result) == {}
+
+
+class TestUseGitignore:
+    """use_gitignore applies .gitignore files with git's semantics."""
+
+    def test_default_off(self, make_dir):
+        a = make_dir("a", {".gitignore": b"*.log\n", "x.log": b"1"})
+        b = make_dir("b", {".gitignore": b"*.log\n"})
+        assert komparu.compare_dir(str(a), str(b)).only_left == {"x.log"}
+
+    def test_glob_and_negation(self, make_dir):
+        gi = b"# logs\n*.log\n!keep.log\n"
+        a = make_dir("a", {".gitignore": gi, "x.log": b"1", "keep.log": b"a", "sub/y.log": b"1"})
+        b = make_dir("b", {".gitignore": gi, "keep.log": b"b"})
+        result = komparu.compare_dir(str(a), str(b), use_gitignore=True)
+        assert result.only_left == set()
+        assert set(result.diff) == {"keep.log"}
+
+    def test_nested_gitignore(self, make_dir):
+        a = make_dir("a", {
+            "src/.gitignore": b"gen.c\n",
+            "src/gen.c": b"generated",
+            "gen.c": b"kept",
+        })
+        b = make_dir("b", {"src/.gitignore": b"gen.c\n"})
+        result = komparu.compare_dir(str(a), str(b), use_gitignore=True)
+        assert result.only_left == {"gen.c"}
+
+    def test_nested_overrides_parent(self, make_dir):
+        a = make_dir("a", {
+            ".gitignore": b"*.dat\n",
+            "fixtures/.gitignore": b"!*.dat\n",
+            "fixtures/t.dat": b"1",
+            "t.dat": b"1",
+        })
+        b = make_dir("b", {".gitignore": b"*.dat\n", "fixtures/.gitignore": b"!*.dat\n"})
+        result = komparu.compare_dir(str(a), str(b), use_gitignore=True)
+        assert result.only_left == {"fixtures/t.dat"}
+
+    def test_directory_pattern(self, make_dir):
+        a = make_dir("a", {".gitignore": b"build/\n", "build/out.o": b"1", "src/build/x": b"1"})
+        b = make_dir("b", {".gitignore": b"build/\n"})
+        result = komparu.compare_dir(str(a), str(b), use_gitignore=True)
+        assert result.equal is True
+
+    def test_dir_only_pattern_skips_files(self, make_dir):
+        a = make_dir("a", {".gitignore": b"build/\n", "build": b"a file"})
+        b = make_dir("b", {".gitignore": b"build/\n"})
+        result = komparu.compare_dir(str(a), str(b), use_gitignore=True)
+        assert result.only_left == {"build"}
+
+    def test_anchored_pattern(self, make_dir):
+        a = make_dir("a", {".gitignore": b"/out\n", "out/a": b"1", "src/out/b": b"1"})
+        b = make_dir("b", {".gitignore": b"/out\n"})
+        result = komparu.compare_dir(str(a), str(b), use_gitignore=True)
+        assert result.only_left == {"src/out/b"}
+
+    def test_double_star(self, make_dir):
+        gi = b"docs/**/*.tmp\n"
+        a = make_dir("a", {".gitignore": gi, "docs/x.tmp": b"1", "docs/a/b/y.tmp": b"1", "z.tmp": b"1"})
+        b = make_dir("b", {".gitignore": gi})
+        result = komparu.compare_dir(str(a), str(b), use_gitignore=True)
+        assert result.only_left == {"z.tmp"}
+
+    def test_no_reinclude_under_ignored_dir(self, make_dir):
+        gi = b"vendor/\n!vendor/keep.txt\n"
+        a = make_dir("a", {".gitignore": gi, "vendor/keep.txt": b"1"})
+        b = make_dir("b", {".gitignore": gi})
+        result = komparu.compare_dir(str(a), str(b), use_gitignore=True)
+        assert result.equal is True
+
+    def test_either_side_ignores(self, make_dir):
+        a = make_dir("a", {".gitignore": b"dist\n", "dist/app": b"1"})
+        b = make_dir("b", {".gitignore": b"", "extra/dist": b"1"})
+        result = komparu.compare_dir(str(a), str(b), use_gitignore=True)
+        assert result.only_left == set()
+        assert result.only_right == set()
+        assert set(result.diff) == {".gitignore"}
+
+    def test_dot_git_excluded(self, make_dir):
+        a = make_dir("a", {".git/HEAD": b"ref: a", "f": b"1"})
+        b = make_dir("b", {".git/HEAD": b"ref: b", "f": b"1"})
+        assert komparu.compare_dir(str(a), str(b), use_gitignore=True).equal is True
+
+    def test_escapes_and_classes(self, make_dir):
+        gi = b"\\#hash\nfile[0-9].txt\n"
+        a = make_dir("a", {".gitignore": gi, "#hash": b"1", "file3.txt": b"1", "fileX.txt": b"1"})
+        b = make_dir("b", {".gitignore": gi})
+        result = komparu.compare_dir(str(a), str(b), use_gitignore=True)
+        assert result.only_left == {"fileX.txt"}
+
+
 # ---- Permission denied errors ----
 
 
@@ -0,0 +1,147 @@
+"""Tests for comparing a working directory against a git tree."""
+
+from __future__ import annotations
+
+import os
+import shutil
+import subprocess
+from pathlib import Path
+
+import pytest
+
+import komparu
+from komparu import DiffReason
+
+
+def _git(repo: Path, *args: str) -> str:
+    env = {
+        **os.environ,
+        "GIT_AUTHOR_NAME": "t", "GIT_AUTHOR_EMAIL": "t@example.com",
+        "GIT_COMMITTER_NAME": "t", "GIT_COMMITTER_EMAIL": "t@example.com",
+        "GIT_CONFIG_GLOBAL": os.devnull, "GIT_CONFIG_SYSTEM": os.devnull,
+    }
+    proc = subprocess.run(
+        ["git", "-C", str(repo), *args],
+        capture_output=True, check=True, env=env, text=True,
+    )
+    return proc.stdout.strip()
+
+
+@pytest.fixture
+def repo(tmp_path: Path):
+    """A repository with one commit tagged ``v1``."""
+    if shutil.which("git") is None:
+        pytest.skip("git not installed")
+    r = tmp_path / "repo"
+    r.mkdir()
+    _git(r, "init", "-q")
+    (r / "README").write_bytes(b"hello\n")
+    (r / "src").mkdir()
+    (r / "src" / "main.c").write_bytes(b"int main(void) { return 0; }\n")
+    (r / "src" / "util.c").write_bytes(b"/* util */\n")
+    os.symlink("main.c", r / "src" / "entry.c")
+    _git(r, "add", "-A")
+    _git(r, "commit", "-q", "-m", "v1")
+    _git(r, "tag", "v1")
+    return r
+
+
+class TestCompareGitTree:
+    """compare_git_tree diffs the working tree against a commit."""
+
+    def test_clean_checkout_equal(self, repo):
+        result = komparu.compare_git_tree(str(repo), "HEAD")
+        assert result.equal is True
+        assert result.diff == {}
+
+    def test_modified_same_size(self, repo):
+        (repo / "README").write_bytes(b"HELLO\n")
+        result = komparu.compare_git_tree(str(repo), "v1")
+        assert result.diff == {"README": DiffReason.CONTENT_MISMATCH}
+
+    def test_modified_size(self, repo):
+        (repo / "src" / "util.c").write_bytes(b"/* util, longer */\n")
+        result = komparu.compare_git_tree(str(repo), "v1")
+        assert result.diff == {"src/util.c": DiffReason.SIZE_MISMATCH}
+
+    def test_deleted_and_untracked(self, repo):
+        (repo / "README").unlink()
+        (repo / "NEW").write_bytes(b"new")
+        result = komparu.compare_git_tree(str(repo), "v1")
+        assert result.only_left == {"README"}
+        assert result.only_right == {"NEW"}
+        assert result.equal is False
+
+    def test_history_commit(self, repo):
+        (repo / "README").write_bytes(b"changed\n")
+        _git(repo, "commit", "-q", "-am", "v2")
+        assert komparu.compare_git_tree(str(repo), "HEAD").equal is True
+        assert komparu.compare_git_tree(str(repo), "v1").diff == {
+            "README": DiffReason.SIZE_MISMATCH,
+        }
+        assert komparu.compare_git_tree(str(repo), "HEAD~1").equal is False
+
+    def test_subpath(self, repo):
+        (repo / "README").write_bytes(b"outside the subpath\n")
+        result = komparu.compare_git_tree(str(repo), "v1", "src")
+        assert result.equal is True
+        (repo / "src" / "main.c").write_bytes(b"int main(void) { return 1; }\n")
+        result = komparu.compare_git_tree(str(repo), "v1", "src/")
+        assert result.diff == {"main.c": DiffReason.CONTENT_MISMATCH}
+
+    def test_symlink_target(self, repo):
+        os.unlink(repo / "src" / "entry.c")
+        os.symlink("util.c", repo / "src" / "entry.c")
+        result = komparu.compare_git_tree(str(repo), "v1")
+        assert result.diff == {"src/entry.c": DiffReason.CONTENT_MISMATCH}
+
+    def test_type_mismatch(self, repo):
+        os.unlink(repo / "src" / "entry.c")
+        (repo / "src" / "entry.c").write_bytes(b"int main(void) { return 0; }\n")
+        result = komparu.compare_git_tree(str(repo), "v1")
+        assert result.diff == {"src/entry.c": DiffReason.TYPE_MISMATCH}
+
+    def test_ignore(self, repo):
+        (repo / "build.log").write_bytes(b"log")
+        result = komparu.compare_git_tree(str(repo), "v1", ignore=["*.log"])
+        assert result.equal is True
+
+    @pytest.mark.skipif(os.geteuid() == 0, reason="root ignores permissions")
+    def test_unreadable_file_is_read_error(self, repo):
+        (repo / "README").chmod(0o000)
+        try:
+            result = komparu.compare_git_tree(str(repo), "v1")
+        finally:
+            (repo / "README").chmod(0o644)
+        assert result.equal is False
+        assert result.diff == {"README": DiffReason.READ_ERROR}
+
+    @pytest.mark.skipif(os.geteuid() == 0, reason="root ignores permissions")
+    def test_unlistable_dir_in_errors(self, repo):
+        (repo / "extra").mkdir()
+        (repo / "extra").chmod(0o300)
+        try:
+            result = komparu.compare_git_tree(str(repo), "v1")
+        finally:
+            (repo / "extra").chmod(0o755)
+        assert result.errors == {"extra"}
+
+    def test_unknown_commitish(self, repo):
+        with pytest.raises(komparu.SourceNotFoundError):
+            komparu.compare_git_tree(str(repo), "no-such-ref")
+
+    def test_unknown_subpath(self, repo):
+        with pytest.raises(komparu.SourceNotFoundError):
+            komparu.compare_git_tree(str(repo), "v1", "missing")
+
+    def test_not_a_repository(self, tmp_path):
+        if shutil.which("git") is None:
+            pytest.skip("git not installed")
+        plain = tmp_path / "plain"
+        plain.mkdir()
+        with pytest.raises(komparu.SourceReadError):
+            komparu.compare_git_tree(str(plain), "HEAD")
+
+    def test_subpath_is_file(self, repo):
+        with pytest.raises(komparu.SourceNotFoundError, match="not a directory"):
+            komparu.compare_git_tree(str(repo), "v1", "README")
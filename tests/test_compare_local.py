@@ -2,12 +2,25 @@
 
 from __future__ import annotations
 
+import base64
+import bz2
+import gzip
+import io
+import lzma
+import math
 import os
+import shutil
+import struct
+import subprocess
+import threading
+import time
 from pathlib import Path
 
 import pytest
 
 import komparu
+from komparu import DiffReason
+from komparu._config import reset_config
 
 
 class TestCompareIdentical:
@@ -161,7 +174,7 @@ class TestCompareEdgeCases:
         d.mkdir()
         f = tmp_dir / "file.txt"
         f.write_bytes(b"data")
-        with pytest.raises((IsADirectoryError, IOError, FileNotFoundError)):
+        with pytest.raises(IsADirectoryError, match="is a directory"):
             komparu.compare(str(d), str(f))
 
     def test_permission_denied(self, make_file):
@@ -217,9 +230,1864 @@ class TestCompareOptions:
         ) is True
 
 
+class TestHeaderFooterSkip:
+    """Test header_skip / footer_skip body-region comparison."""
+
+    def test_different_headers_equal(self, make_file):
+        body = os.urandom(5000)
+        a = make_file("a.bin", b"HDR1" + body)
+        b = make_file("b.bin", b"HDR2" + body)
+        assert komparu.compare(str(a), str(b)) is False
+        assert komparu.compare(str(a), str(b), header_skip=4) is True
+
+    def test_different_footers_equal(self, make_file):
+        body = os.urandom(5000)
+        a = make_file("a.bin", body + b"crc:0001")
+        b = make_file("b.bin", body + b"crc:9999")
+        assert komparu.compare(str(a), str(b), footer_skip=8) is True
+
+    def test_header_and_footer(self, make_file):
+        body = b"payload" * 1000
+        a = make_file("a.bin", b"v1" + body + b"end1")
+        b = make_file("b.bin", b"v2" + body + b"end2")
+        assert komparu.compare(
+            str(a), str(b), header_skip=2, footer_skip=4,
+        ) is True
+
+    def test_body_difference_detected(self, make_file):
+        a = make_file("a.bin", b"HDR" + b"x" * 1000 + b"FT")
+        b = make_file("b.bin", b"HDR" + b"x" * 999 + b"y" + b"FT")
+        assert komparu.compare(
+            str(a), str(b), header_skip=3, footer_skip=2,
+        ) is False
+
+    def test_body_length_mismatch(self, make_file):
+        a = make_file("a.bin", b"H" + b"body" + b"F")
+        b = make_file("b.bin", b"H" + b"body!" + b"F")
+        assert komparu.compare(
+            str(a), str(b), header_skip=1, footer_skip=1,
+        ) is False
+        assert komparu.compare(
+            str(a), str(b), header_skip=1, footer_skip=1,
+            size_precheck=False, quick_check=False,
+        ) is False
+
+    def test_shorter_than_framing(self, make_file):
+        """Sources shorter than header + footer have an empty body."""
+        a = make_file("a.bin", b"abc")
+        b = make_file("b.bin", b"xyz12")
+        assert komparu.compare(
+            str(a), str(b), header_skip=4, footer_skip=4,
+        ) is True
+
+    def test_chunk_boundaries(self, make_file):
+        body = os.urandom(100_000)
+        a = make_file("a.bin", os.urandom(37) + body + os.urandom(11))
+        b = make_file("b.bin", os.urandom(37) + body + os.urandom(11))
+        assert komparu.compare(
+            str(a), str(b), header_skip=37, footer_skip=11, chunk_size=4096,
+        ) is True
+
+    def test_negative_skip_rejected(self, make_file):
+        a = make_file("a.bin", b"data")
+        with pytest.raises(ValueError, match="header_skip"):
+            komparu.compare(str(a), str(a), header_skip=-1)
+        with pytest.raises(ValueError, match="footer_skip"):
+            komparu.compare(str(a), str(a), footer_skip=-1)
+
+
+class TestDecode:
+    """Test decode_a / decode_b on-the-fly decoding."""
+
+    def test_base64_vs_raw(self, make_file):
+        raw = os.urandom(10_000)
+        a = make_file("a.der", raw)
+        b = make_file("b.b64", base64.encodebytes(raw))  # 76-col lines
+        assert komparu.compare(str(a), str(b), decode_b="base64") is True
+        assert komparu.compare(str(b), str(a), decode_a="base64") is True
+
+    def test_hex_vs_raw(self, make_file):
+        raw = os.urandom(5000)
+        a = make_file("a.bin", raw)
+        b = make_file("b.hex", raw.hex().upper().encode() + b"\n")
+        assert komparu.compare(str(a), str(b), decode_b="hex") is True
+
+    def test_base64_vs_hex(self, make_file):
+        raw = b"same bytes, two encodings"
+        a = make_file("a.b64", base64.b64encode(raw))
+        b = make_file("b.hex", raw.hex().encode())
+        assert komparu.compare(
+            str(a), str(b), decode_a="base64", decode_b="hex",
+        ) is True
+
+    def test_unpadded_tail_lengths(self, make_file):
+        for n in range(0, 8):
+            raw = os.urandom(n)
+            a = make_file(f"raw{n}", raw)
+            b = make_file(f"enc{n}", base64.b64encode(raw))
+            assert komparu.compare(str(a), str(b), decode_b="base64") is True
+
+    def test_decoded_difference(self, make_file):
+        a = make_file("a.bin", b"hello world")
+        b = make_file("b.b64", base64.b64encode(b"hello World"))
+        assert komparu.compare(str(a), str(b), decode_b="base64") is False
+
+    def test_decoded_length_difference(self, make_file):
+        a = make_file("a.bin", b"hello")
+        b = make_file("b.hex", b"hello!".hex().encode())
+        assert komparu.compare(str(a), str(b), decode_b="hex") is False
+
+    def test_invalid_base64_raises(self, make_file):
+        a = make_file("a.bin", b"data")
+        b = make_file("b.b64", b"ZGF0YQ==*")
+        with pytest.raises(komparu.DecodeError, match="b.b64"):
+            komparu.compare(str(a), str(b), decode_b="base64")
+
+    def test_invalid_hex_raises(self, make_file):
+        a = make_file("a.bin", b"\x01")
+        b = make_file("b.hex", b"0")  # odd number of digits
+        with pytest.raises(komparu.DecodeError, match="odd number"):
+            komparu.compare(str(a), str(b), decode_b="hex", size_precheck=False)
+
+    def test_same_file_still_decoded(self, make_file):
+        a = make_file("a.b64", b"not base64!")
+        with pytest.raises(komparu.DecodeError):
+            komparu.compare(str(a), str(a), decode_a="base64", decode_b="base64")
+
+    def test_pem_body_with_skip(self, make_file):
+        """header/footer skip strips armor before decoding."""
+        raw = os.urandom(300)
+        header = b"-----BEGIN DATA-----\n"
+        footer = b"-----END DATA-----\n"
+        a = make_file("a.der", raw)
+        b = make_file("b.pem", header + base64.encodebytes(raw) + footer)
+        assert komparu.compare(
+            str(b), str(b), header_skip=len(header), footer_skip=len(footer),
+            decode_a="base64", decode_b="base64",
+        ) is True
+
+    def test_invalid_decode_name(self, make_file):
+        a = make_file("a.bin", b"x")
+        with pytest.raises(ValueError, match="decode_a"):
+            komparu.compare(str(a), str(a), decode_a="rot13")
+
+
 # ---- New tests: Unicode file paths ----
 
 
+class TestDecompress:
+    """Test decompress=True magic-detected decompression."""
+
+    def test_formats_vs_raw(self, make_file):
+        raw = os.urandom(50_000) * 3
+        a = make_file("a.bin", raw)
+        for name, data in (
+            ("b.gz", gzip.compress(raw)),
+            ("b.bz2", bz2.compress(raw)),
+            ("b.xz", lzma.compress(raw)),
+        ):
+            b = make_file(name, data)
+            assert komparu.compare(str(a), str(b), decompress=True) is True
+            assert komparu.compare(str(a), str(b)) is False
+
+    def test_mixed_formats(self, make_file):
+        raw = b"log line\n" * 10_000
+        a = make_file("a.gz", gzip.compress(raw))
+        b = make_file("b.xz", lzma.compress(raw))
+        assert komparu.compare(str(a), str(b), decompress=True) is True
+
+    def test_content_differs(self, make_file):
+        a = make_file("a.gz", gzip.compress(b"hello world"))
+        b = make_file("b.gz", gzip.compress(b"hello there"))
+        assert komparu.compare(str(a), str(b), decompress=True) is False
+
+    def test_plain_files_compare_raw(self, make_file):
+        a = make_file("a.txt", b"plain text")
+        b = make_file("b.txt", b"plain text")
+        c = make_file("c.txt", b"plain TEXT")
+        assert komparu.compare(str(a), str(b), decompress=True) is True
+        assert komparu.compare(str(a), str(c), decompress=True) is False
+
+    def test_empty_files(self, make_file):
+        a = make_file("a", b"")
+        b = make_file("b.gz", gzip.compress(b""))
+        assert komparu.compare(str(a), str(b), decompress=True) is True
+
+    def test_with_header_skip(self, make_file):
+        raw = b"HDR1" + b"payload" * 100
+        a = make_file("a.gz", gzip.compress(raw))
+        b = make_file("b.bin", b"HDR2" + b"payload" * 100)
+        assert komparu.compare(
+            str(a), str(b), decompress=True, header_skip=4,
+        ) is True
+
+    def test_corrupt_stream(self, make_file):
+        data = gzip.compress(os.urandom(10_000))
+        a = make_file("a.gz", data[:len(data) // 2])
+        b = make_file("b.gz", data)
+        with pytest.raises(IOError):
+            komparu.compare(str(a), str(b), decompress=True)
+
+    def test_register_custom(self, make_file):
+        from komparu import _decompress
+
+        def unreverse(f):
+            assert f.read(4) == b"REV!"
+            return io.BytesIO(f.read()[::-1])
+
+        komparu.register_decompressor(b"REV!", unreverse)
+        try:
+            raw = b"abcdef" * 1000
+            a = make_file("a.rev", b"REV!" + raw[::-1])
+            b = make_file("b.gz", gzip.compress(raw))
+            c = make_file("c.bin", raw)
+            assert komparu.compare(str(a), str(b), decompress=True) is True
+            assert komparu.compare(str(a), str(c), decompress=True) is True
+            assert komparu.compare(str(a), str(c)) is False
+        finally:
+            _decompress._custom.clear()
+
+    def test_register_custom_against_zstd(self, make_file):
+        from komparu import _decompress
+
+        raw = b"payload-" * 20
+        # Single-segment zstd frame holding one raw block.
+        frame = (b"\x28\xb5\x2f\xfd\x20" + bytes([len(raw)])
+                 + ((len(raw) << 3) | 1).to_bytes(3, "little") + raw)
+        komparu.register_decompressor(b"REV!", lambda f: io.BytesIO(f.read()[4:][::-1]))
+        try:
+            a = make_file("a.rev", b"REV!" + raw[::-1])
+            b = make_file("b.zst", frame)
+            assert komparu.compare(str(b), str(make_file("c.bin", raw)), decompress=True) is True
+            assert komparu.compare(str(a), str(b), decompress=True) is True
+        finally:
+            _decompress._custom.clear()
+
+    def test_register_empty_magic(self):
+        with pytest.raises(ValueError, match="magic"):
+            komparu.register_decompressor(b"", lambda f: f)
+
+
+class TestCollapseZeroRuns:
+    """Test collapse_zero_runs fuzzy matching of zero padding."""
+
+    def test_padding_lengths_differ(self, make_file):
+        a = make_file("a.rec", b"name\0\0\0\0age\0\0id\0")
+        b = make_file("b.rec", b"name\0age\0\0\0\0\0id\0\0\0")
+        assert komparu.compare(str(a), str(b), collapse_zero_runs=True) is True
+        assert komparu.compare(str(a), str(b)) is False
+
+    def test_zero_run_vs_none(self, make_file):
+        a = make_file("a", b"ab\0cd")
+        b = make_file("b", b"abcd")
+        assert komparu.compare(str(a), str(b), collapse_zero_runs=True) is False
+
+    def test_nonzero_difference(self, make_file):
+        a = make_file("a", b"field\0\0x")
+        b = make_file("b", b"field\0y")
+        assert komparu.compare(str(a), str(b), collapse_zero_runs=True) is False
+
+    def test_runs_across_chunks(self, make_file):
+        body = b"".join(bytes([i % 255 + 1]) * 100 + b"\0" * (i * 997 % 70_000)
+                        for i in range(40))
+        a = make_file("a", body)
+        b = make_file("b", body.replace(b"\0" * 3, b"\0"))
+        assert komparu.compare(
+            str(a), str(b), collapse_zero_runs=True, chunk_size=4096,
+        ) is True
+
+    def test_all_zero_files(self, make_file):
+        a = make_file("a", b"\0" * 10)
+        b = make_file("b", b"\0" * 100_000)
+        c = make_file("c", b"")
+        assert komparu.compare(str(a), str(b), collapse_zero_runs=True) is True
+        assert komparu.compare(str(a), str(c), collapse_zero_runs=True) is False
+
+
+class TestEquivalenceClasses:
+    """equivalence_classes treats grouped byte values as equal."""
+
+    def test_tab_space(self, make_file):
+        a = make_file("a.txt", b"if x:\n\treturn 1\n")
+        b = make_file("b.txt", b"if x:\n return 1\n")
+        assert komparu.compare(str(a), str(b)) is False
+        assert komparu.compare(
+            str(a), str(b), equivalence_classes=[b"\t "],
+        ) is True
+
+    def test_other_bytes_still_differ(self, make_file):
+        a = make_file("a.txt", b"\tx")
+        b = make_file("b.txt", b" y")
+        assert komparu.compare(
+            str(a), str(b), equivalence_classes=[b"\t "],
+        ) is False
+
+    def test_length_preserved(self, make_file):
+        a = make_file("a.txt", b"\t\t")
+        b = make_file("b.txt", b" ")
+        assert komparu.compare(
+            str(a), str(b), equivalence_classes=[b"\t "],
+        ) is False
+
+    def test_multiple_classes(self, make_file):
+        a = make_file("a.txt", b"A-b")
+        b = make_file("b.txt", b"a_B")
+        classes = [b"Aa", b"Bb", b"-_"]
+        assert komparu.compare(str(a), str(b), equivalence_classes=classes) is True
+
+    def test_large_file_quick_check(self, make_file):
+        body = os.urandom(300_000).replace(b"\t", b" ")
+        a = make_file("a.bin", body[:150_000] + b"\t" + body[150_001:])
+        b = make_file("b.bin", body[:150_000] + b" " + body[150_001:])
+        assert komparu.compare(
+            str(a), str(b), chunk_size=4096, equivalence_classes=[b"\t "],
+        ) is True
+
+    def test_overlapping_classes_rejected(self):
+        with pytest.raises(ValueError, match="more than one"):
+            komparu.compare("a", "b", equivalence_classes=[b"ab", b"bc"])
+
+    def test_out_of_range_rejected(self):
+        with pytest.raises(ValueError, match="0..255"):
+            komparu.compare("a", "b", equivalence_classes=[[9, 256]])
+
+
+class TestCaseFold:
+    """case_fold compares ASCII letters case-insensitively."""
+
+    def test_sql_keywords(self, make_file):
+        a = make_file("a.sql", b"SELECT id FROM users WHERE x = 1;\n")
+        b = make_file("b.sql", b"select id from Users where x = 1;\n")
+        assert komparu.compare(str(a), str(b)) is False
+        assert komparu.compare(str(a), str(b), case_fold=True) is True
+
+    def test_other_bytes_exact(self, make_file):
+        a = make_file("a.sql", b"select 1;")
+        b = make_file("b.sql", b"select 2;")
+        assert komparu.compare(str(a), str(b), case_fold=True) is False
+
+    def test_non_ascii_untouched(self, make_file):
+        a = make_file("a.txt", "\u00c9T\u00c9".encode())
+        b = make_file("b.txt", "\u00e9t\u00e9".encode())
+        assert komparu.compare(str(a), str(b), case_fold=True) is False
+        c = make_file("c.txt", "\u00c9t\u00c9".encode())
+        assert komparu.compare(str(a), str(c), case_fold=True) is True
+
+    def test_not_adjacent_ascii(self, make_file):
+        # '@' (0x40) and '`' (0x60) differ by 0x20 but are not letters
+        a = make_file("a.txt", b"[@]")
+        b = make_file("b.txt", b"{`}")
+        assert komparu.compare(str(a), str(b), case_fold=True) is False
+
+    def test_across_chunks(self, make_file):
+        body = os.urandom(200_000).replace(b"Q", b"q")
+        a = make_file("a.bin", body + b"QUERY")
+        b = make_file("b.bin", body + b"query")
+        assert komparu.compare(str(a), str(b), chunk_size=4096, case_fold=True) is True
+
+    def test_with_equivalence_classes(self, make_file):
+        a = make_file("a.txt", b"A B")
+        b = make_file("b.txt", b"a\tb")
+        assert komparu.compare(
+            str(a), str(b), case_fold=True, equivalence_classes=[b"\t "],
+        ) is True
+
+    def test_merges_with_letter_class(self, make_file):
+        # 'A' ~ '_' by class and 'A' ~ 'a' by folding, so 'a' ~ '_'
+        a = make_file("a.txt", b"a")
+        b = make_file("b.txt", b"_")
+        assert komparu.compare(
+            str(a), str(b), case_fold=True, equivalence_classes=[b"A_"],
+        ) is True
+
+
+# EBCDIC (code page 500) byte -> Latin-1 byte; both are 256-entry charsets
+_EBCDIC_TO_LATIN1 = bytes(range(256)).decode("cp500").encode("latin-1")
+
+
+class TestTranslate:
+    """translate_a/translate_b map each side's bytes through a table."""
+
+    def test_ebcdic_vs_ascii(self, make_file):
+        text = "CUSTOMER 0042, BALANCE: 17.50\n"
+        a = make_file("a.dat", text.encode("cp500"))
+        b = make_file("b.dat", text.encode("latin-1"))
+        assert komparu.compare(str(a), str(b)) is False
+        assert komparu.compare(str(a), str(b), translate_a=_EBCDIC_TO_LATIN1) is True
+
+    def test_content_difference_remains(self, make_file):
+        a = make_file("a.dat", "BALANCE 17".encode("cp500"))
+        b = make_file("b.dat", b"BALANCE 18")
+        assert komparu.compare(str(a), str(b), translate_a=_EBCDIC_TO_LATIN1) is False
+
+    def test_side_b(self, make_file):
+        a = make_file("a.dat", b"ABC")
+        b = make_file("b.dat", "ABC".encode("cp500"))
+        assert komparu.compare(str(a), str(b), translate_b=_EBCDIC_TO_LATIN1) is True
+        assert komparu.compare(str(a), str(b), translate_a=_EBCDIC_TO_LATIN1) is False
+
+    def test_both_sides(self, make_file):
+        rot = bytes((x + 1) % 256 for x in range(256))
+        unrot = bytes((x - 1) % 256 for x in range(256))
+        a = make_file("a.bin", b"abc")
+        b = make_file("b.bin", b"\x62\x63\x64")
+        c = make_file("c.bin", b"\x60\x61\x62")
+        assert komparu.compare(str(b), str(c), translate_a=unrot, translate_b=rot) is True
+        assert komparu.compare(str(a), str(b), translate_a=rot, translate_b=rot) is False
+
+    def test_then_case_fold(self, make_file):
+        a = make_file("a.dat", "select".encode("cp500"))
+        b = make_file("b.dat", b"SELECT")
+        assert komparu.compare(
+            str(a), str(b), translate_a=_EBCDIC_TO_LATIN1, case_fold=True,
+        ) is True
+
+    def test_across_chunks(self, make_file):
+        text = ("RECORD %06d\n" * 20_000) % tuple(range(20_000))
+        a = make_file("a.dat", text.encode("cp500"))
+        b = make_file("b.dat", text.encode("latin-1"))
+        assert komparu.compare(
+            str(a), str(b), chunk_size=4096, translate_a=_EBCDIC_TO_LATIN1,
+        ) is True
+
+    def test_wrong_length(self, make_file):
+        a = make_file("a.dat", b"x")
+        with pytest.raises(ValueError, match="256 bytes"):
+            komparu.compare(str(a), str(a), translate_a=b"\x00" * 255)
+
+    def test_not_bytes(self, make_file):
+        a = make_file("a.dat", b"x")
+        with pytest.raises(TypeError, match="translate_b"):
+            komparu.compare(str(a), str(a), translate_b=list(range(256)))
+
+
+class TestLockFiles:
+    """lock_files= holds a shared flock on each file while comparing."""
+
+    def test_compare_result_unchanged(self, make_file):
+        a = make_file("a.bin", b"same")
+        b = make_file("b.bin", b"same")
+        c = make_file("c.bin", b"diff")
+        assert komparu.compare(str(a), str(b), lock_files=True) is True
+        assert komparu.compare(str(a), str(c), lock_files=True) is False
+
+    def test_missing_file_still_raises(self, make_file, tmp_path):
+        a = make_file("a.bin", b"x")
+        with pytest.raises(FileNotFoundError):
+            komparu.compare(str(a), str(tmp_path / "nope"), lock_files=True)
+
+    @pytest.mark.skipif(os.name != "posix", reason="flock() is POSIX only")
+    def test_waits_for_exclusive_writer(self, make_file):
+        import fcntl
+
+        a = make_file("a.bin", b"old!")
+        b = make_file("b.bin", b"new!")
+        writer = os.open(a, os.O_RDWR)
+        fcntl.flock(writer, fcntl.LOCK_EX)
+        results = []
+        t = threading.Thread(
+            target=lambda: results.append(komparu.compare(str(a), str(b), lock_files=True)),
+        )
+        try:
+            t.start()
+            time.sleep(0.2)
+            assert t.is_alive()  # blocked on the writer's lock
+            os.pwrite(writer, b"new!", 0)
+        finally:
+            fcntl.flock(writer, fcntl.LOCK_UN)
+            os.close(writer)
+            t.join(5)
+        assert results == [True]
+
+    @pytest.mark.skipif(os.name != "posix", reason="flock() is POSIX only")
+    def test_lock_released_after(self, make_file):
+        import fcntl
+
+        a = make_file("a.bin", b"x")
+        komparu.compare(str(a), str(a), lock_files=True)
+        fd = os.open(a, os.O_RDONLY)
+        try:
+            fcntl.flock(fd, fcntl.LOCK_EX | fcntl.LOCK_NB)
+        finally:
+            os.close(fd)
+
+    def test_compare_into(self, make_file):
+        a = make_file("a.bin", b"abc")
+        b = make_file("b.bin", b"abd")
+        out = komparu.FileDiff()
+        assert komparu.compare_into(str(a), str(b), out, lock_files=True) is False
+        assert out.first_diff_offset == 2
+
+
+class TestSymlinkMode:
+    """compare(symlinks="compare-link") compares link targets, not content."""
+
+    def test_same_target(self, make_file, tmp_path):
+        make_file("data", b"x")
+        (tmp_path / "l1").symlink_to("data")
+        (tmp_path / "l2").symlink_to("data")
+        assert komparu.compare(str(tmp_path / "l1"), str(tmp_path / "l2"),
+                               symlinks="compare-link") is True
+
+    def test_different_target_same_content(self, make_file, tmp_path):
+        make_file("d1", b"x")
+        make_file("d2", b"x")
+        (tmp_path / "l1").symlink_to("d1")
+        (tmp_path / "l2").symlink_to("d2")
+        l1, l2 = str(tmp_path / "l1"), str(tmp_path / "l2")
+        assert komparu.compare(l1, l2) is True
+        assert komparu.compare(l1, l2, symlinks="compare-link") is False
+
+    def test_link_vs_file(self, make_file, tmp_path):
+        d = make_file("data", b"x")
+        (tmp_path / "l").symlink_to("data")
+        assert komparu.compare(str(tmp_path / "l"), str(d), symlinks="compare-link") is False
+
+    def test_plain_files_unaffected(self, make_file):
+        a = make_file("a", b"x")
+        b = make_file("b", b"x")
+        assert komparu.compare(str(a), str(b), symlinks="compare-link") is True
+
+    def test_skip_rejected(self, make_file):
+        a = make_file("a", b"x")
+        with pytest.raises(ValueError, match="symlinks"):
+            komparu.compare(str(a), str(a), symlinks="skip")
+
+
+class TestCancel:
+    """A CancelToken stops a running comparison from another thread."""
+
+    # Sparse, so no disk is used; still seconds to scan in full
+    SIZE = 8 << 30
+
+    def setup_method(self):
+        komparu.configure(skip_holes=False)
+
+    def teardown_method(self):
+        reset_config()
+
+    def _sparse_pair(self, tmp_path: Path) -> tuple[str, str]:
+        paths = []
+        for name in ("a.img", "b.img"):
+            p = tmp_path / name
+            with open(p, "wb") as f:
+                f.truncate(self.SIZE)
+            paths.append(str(p))
+        return paths[0], paths[1]
+
+    def test_cancel_from_thread(self, tmp_path):
+        a, b = self._sparse_pair(tmp_path)
+        token = komparu.CancelToken()
+        threading.Timer(0.1, token.cancel).start()
+        start = time.monotonic()
+        with pytest.raises(komparu.CancelledError):
+            komparu.compare(a, b, quick_check=False, cancel=token)
+        assert time.monotonic() - start < 2
+        assert token.cancelled
+
+    def test_deadline(self, tmp_path):
+        a, b = self._sparse_pair(tmp_path)
+        token = komparu.CancelToken(timeout=0.1)
+        with pytest.raises(komparu.ComparisonTimeoutError):
+            komparu.compare_into(a, b, komparu.FileDiff(), cancel=token)
+        assert token.cancelled
+
+    def test_already_cancelled(self, make_file):
+        a = make_file("a.txt", b"data")
+        token = komparu.CancelToken()
+        token.cancel()
+        with pytest.raises(komparu.CancelledError):
+            komparu.compare(str(a), str(a), cancel=token)
+        with pytest.raises(komparu.CancelledError):
+            token.raise_if_cancelled()
+
+    def test_unused_token(self, make_file):
+        a = make_file("a.txt", b"data")
+        b = make_file("b.txt", b"data")
+        token = komparu.CancelToken(timeout=60)
+        assert komparu.compare(str(a), str(b), cancel=token) is True
+        assert token.cancelled is False
+        token.raise_if_cancelled()
+
+    def test_invalid_timeout(self):
+        with pytest.raises(ValueError, match="timeout"):
+            komparu.CancelToken(timeout=0)
+
+
+class TestProgress:
+    """on_progress reports a running file comparison."""
+
+    def setup_method(self):
+        komparu.configure(skip_holes=False)
+
+    def teardown_method(self):
+        reset_config()
+
+    def test_reports_while_scanning(self, tmp_path):
+        size = 512 << 20  # sparse
+        paths = []
+        for name in ("a.img", "b.img"):
+            with open(tmp_path / name, "wb") as f:
+                f.truncate(size)
+            paths.append(str(tmp_path / name))
+        events = []
+        assert komparu.compare(*paths, on_progress=events.append, progress_interval=0.001)
+        assert events[-1].files_done == 1 and events[-1].files_total == 1
+        assert events[-1].bytes_done == events[-1].bytes_total == size
+        assert events[-1].path == paths[0]
+        assert any(0 < e.bytes_done < size for e in events)
+        for prev, cur in zip(events, events[1:]):
+            assert cur.bytes_done >= prev.bytes_done and cur.elapsed >= prev.elapsed
+
+    def test_difference_completes(self, make_file):
+        a = make_file("a.bin", b"x" * 100_000)
+        b = make_file("b.bin", b"y" * 100_000)
+        events = []
+        assert komparu.compare(str(a), str(b), on_progress=events.append) is False
+        assert events[-1].bytes_done == events[-1].bytes_total == 100_000
+
+    def test_rate_and_eta(self):
+        event = komparu.ProgressEvent(0, 1, 250, 1000, "a", 0.5)
+        assert event.rate == 500
+        assert event.eta == 1.5
+        assert komparu.ProgressEvent(0, 0, 0, 0, None, 0.0).eta is None
+
+    def test_invalid_interval(self, make_file):
+        a = make_file("a.txt", b"data")
+        with pytest.raises(ValueError, match="progress_interval"):
+            komparu.compare(str(a), str(a), on_progress=print, progress_interval=0)
+
+
+class TestSyncFile:
+    """sync_file() writes dst only when it differs from src."""
+
+    def test_equal_untouched(self, make_file):
+        src = make_file("src.bin", b"payload")
+        dst = make_file("dst.bin", b"payload")
+        os.utime(dst, (1_000_000, 1_000_000))
+        assert komparu.sync_file(str(src), str(dst)) is False
+        assert os.stat(dst).st_mtime == 1_000_000
+
+    def test_different_copied(self, make_file):
+        src = make_file("src.bin", b"new content")
+        dst = make_file("dst.bin", b"old")
+        assert komparu.sync_file(str(src), str(dst)) is True
+        assert dst.read_bytes() == b"new content"
+
+    def test_missing_dst_created(self, make_file, tmp_path):
+        src = make_file("src.bin", b"data")
+        dst = tmp_path / "out.bin"
+        assert komparu.sync_file(str(src), str(dst)) is True
+        assert dst.read_bytes() == b"data"
+
+    def test_preserves_src_mtime(self, make_file):
+        src = make_file("src.bin", b"v2")
+        dst = make_file("dst.bin", b"v1")
+        os.utime(src, (2_000_000, 2_000_000))
+        komparu.sync_file(str(src), str(dst))
+        assert os.stat(dst).st_mtime == 2_000_000
+
+    def test_no_temp_left_behind(self, make_file, tmp_path):
+        src = make_file("src.bin", b"abc")
+        komparu.sync_file(str(src), str(tmp_path / "dst.bin"))
+        assert sorted(p.name for p in tmp_path.iterdir()) == ["dst.bin", "src.bin"]
+
+    def test_missing_src(self, make_file, tmp_path):
+        dst = make_file("dst.bin", b"keep")
+        with pytest.raises(FileNotFoundError):
+            komparu.sync_file(str(tmp_path / "nope"), str(dst))
+        assert dst.read_bytes() == b"keep"
+        assert sorted(p.name for p in tmp_path.iterdir()) == ["dst.bin"]
+
+
+class TestCustomOpener:
+    """opener= routes file opens through a caller-supplied function."""
+
+    def test_opener_called_for_both(self, make_file):
+        a = make_file("a.bin", b"same")
+        b = make_file("b.bin", b"same")
+        opened = []
+
+        def opener(path):
+            opened.append(path)
+            return open(path, "rb")
+
+        assert komparu.compare(str(a), str(b), opener=opener) is True
+        assert opened == [str(a), str(b)]
+
+    def test_virtual_filesystem(self):
+        files = {"/v/a": b"payload", "/v/b": b"payload", "/v/c": b"paylo4d"}
+
+        def opener(path):
+            return io.BytesIO(files[path])
+
+        assert komparu.compare("/v/a", "/v/b", opener=opener) is True
+        assert komparu.compare("/v/a", "/v/c", opener=opener) is False
+
+    def test_size_precheck_skips_reading(self):
+        reads = []
+
+        class Tracked(io.BytesIO):
+            def read(self, n=-1):
+                reads.append(n)
+                return super().read(n)
+
+        data = {"a": b"short", "b": b"much longer"}
+        assert komparu.compare(
+            "a", "b", opener=lambda p: Tracked(data[p]),
+        ) is False
+        assert reads == []
+
+    def test_non_seekable_stream(self):
+        class Pipe:
+            def __init__(self, data):
+                self._buf = io.BytesIO(data)
+
+            def read(self, n=-1):
+                return self._buf.read(min(n, 3))
+
+        data = {"a": b"abcdefgh", "b": b"abcdefgh"}
+        assert komparu.compare("a", "b", opener=lambda p: Pipe(data[p])) is True
+
+    def test_streams_closed(self, make_file):
+        a = make_file("a.bin", b"x")
+        b = make_file("b.bin", b"y")
+        handles = []
+
+        def opener(path):
+            f = open(path, "rb")
+            handles.append(f)
+            return f
+
+        komparu.compare(str(a), str(b), opener=opener)
+        assert all(f.closed for f in handles)
+
+    def test_opener_error_propagates(self):
+        def opener(path):
+            raise PermissionError(path)
+
+        with pytest.raises(PermissionError):
+            komparu.compare("a", "b", opener=opener)
+
+    def test_rejects_transforms(self):
+        with pytest.raises(ValueError, match="opener"):
+            komparu.compare("a", "b", opener=io.BytesIO, header_skip=1)
+
+    def test_rejects_urls(self):
+        with pytest.raises(ValueError, match="local"):
+            komparu.compare("http://example.com/a", "b", opener=io.BytesIO)
+
+
+def _strip_comments(path, stream):
+    """Filter keeping only lines that do not start with '#'."""
+    lines = [ln for ln in stream.read().splitlines(True) if not ln.startswith(b"#")]
+    return io.BytesIO(b"".join(lines))
+
+
+class TestContentFilter:
+    """content_filter= compares the filtered output of each file."""
+
+    def test_filtered_equal(self, make_file):
+        a = make_file("a.cfg", b"# generated 2024\nkey=1\n")
+        b = make_file("b.cfg", b"# generated 2025, different length\nkey=1\n")
+        assert komparu.compare(str(a), str(b)) is False
+        assert komparu.compare(str(a), str(b), content_filter=_strip_comments) is True
+
+    def test_filtered_different(self, make_file):
+        a = make_file("a.cfg", b"key=1\n")
+        b = make_file("b.cfg", b"key=2\n")
+        assert komparu.compare(str(a), str(b), content_filter=_strip_comments) is False
+
+    def test_filter_receives_path(self, make_file):
+        a = make_file("a.cfg", b"x")
+        b = make_file("b.cfg", b"x")
+        seen = []
+
+        def flt(path, stream):
+            seen.append(path)
+            return stream
+
+        komparu.compare(str(a), str(b), content_filter=flt)
+        assert seen == [str(a), str(b)]
+
+    def test_with_opener(self):
+        files = {"a": b"# x\nv\n", "b": b"v\n"}
+        assert komparu.compare(
+            "a", "b", opener=lambda p: io.BytesIO(files[p]),
+            content_filter=_strip_comments,
+        ) is True
+
+    def test_filter_error_propagates(self, make_file):
+        a = make_file("a.cfg", b"x")
+
+        def flt(path, stream):
+            raise RuntimeError("filter crashed")
+
+        with pytest.raises(RuntimeError, match="crashed"):
+            komparu.compare(str(a), str(a), content_filter=flt)
+
+    def test_rejects_transforms(self):
+        with pytest.raises(ValueError, match="content_filter"):
+            komparu.compare("a", "b", content_filter=_strip_comments, decompress=True)
+
+
+class TestPathRewrite:
+    """path_rewrite= substitutes strings in both files before comparing."""
+
+    def test_build_roots_equal(self, make_file):
+        a = make_file("a.o", b"\x7fELF /home/ci/build-1/src/main.c\x00rest")
+        b = make_file("b.o", b"\x7fELF /tmp/b/src/main.c\x00rest")
+        assert komparu.compare(str(a), str(b)) is False
+        rewrites = [("/home/ci/build-1", "<root>"), ("/tmp/b", "<root>")]
+        assert komparu.compare(str(a), str(b), path_rewrite=rewrites) is True
+
+    def test_remaining_difference(self, make_file):
+        a = make_file("a.txt", b"/srv/a v1")
+        b = make_file("b.txt", b"/srv/b v2")
+        rewrites = [("/srv/a", "R"), ("/srv/b", "R")]
+        assert komparu.compare(str(a), str(b), path_rewrite=rewrites) is False
+
+    def test_match_across_chunk_boundary(self, make_file):
+        a = make_file("a.txt", b"x" * 13 + b"/opt/build-a/lib" * 50)
+        b = make_file("b.txt", b"x" * 13 + b"/b/lib" * 50)
+        rewrites = [(b"/opt/build-a", b"/b")]
+        assert komparu.compare(str(a), str(b), path_rewrite=rewrites, chunk_size=7) is True
+
+    def test_longest_match_wins(self, make_file):
+        a = make_file("a.txt", b"/usr/local/bin /usr/bin")
+        b = make_file("b.txt", b"L/bin U/bin")
+        rewrites = [("/usr", "U"), ("/usr/local", "L")]
+        assert komparu.compare(str(a), str(b), path_rewrite=rewrites) is True
+
+    def test_not_path_aware(self, make_file):
+        a = make_file("a.txt", b"/build-old")
+        b = make_file("b.txt", b"R-old")
+        assert komparu.compare(str(a), str(b), path_rewrite=[("/build", "R")]) is True
+
+    def test_after_content_filter(self, make_file):
+        a = make_file("a.cfg", b"# /x\nroot=/x\n")
+        b = make_file("b.cfg", b"root=/y\n")
+        assert komparu.compare(
+            str(a), str(b), content_filter=_strip_comments, path_rewrite=[("/x", "/y")],
+        ) is True
+
+    def test_empty_list_is_plain_compare(self, make_file):
+        a = make_file("a.txt", b"same")
+        b = make_file("b.txt", b"same")
+        assert komparu.compare(str(a), str(b), path_rewrite=[]) is True
+
+    def test_empty_from_rejected(self, make_file):
+        a = make_file("a.txt", b"x")
+        with pytest.raises(ValueError, match="must not be empty"):
+            komparu.compare(str(a), str(a), path_rewrite=[("", "x")])
+
+    def test_bad_entry_rejected(self, make_file):
+        a = make_file("a.txt", b"x")
+        with pytest.raises(TypeError, match="pairs"):
+            komparu.compare(str(a), str(a), path_rewrite=["/a"])
+
+    def test_rejects_transforms(self):
+        with pytest.raises(ValueError, match="path_rewrite"):
+            komparu.compare("a", "b", path_rewrite=[("a", "b")], decompress=True)
+
+
+class TestCompareInto:
+    """compare_into fills a caller-owned FileDiff."""
+
+    def test_equal(self, make_file):
+        a = make_file("a.bin", b"same content")
+        b = make_file("b.bin", b"same content")
+        out = komparu.FileDiff()
+        assert komparu.compare_into(str(a), str(b), out) is True
+        small = komparu.IOInfo("read", "below_threshold")
+        assert out == komparu.FileDiff(
+            equal=True, size_a=12, size_b=12, io_a=small, io_b=small,
+        )
+
+    def test_first_diff_offset(self, make_file):
+        content = os.urandom(200_000)
+        changed = content[:123_456] + bytes([content[123_456] ^ 1]) + content[123_457:]
+        a = make_file("a.bin", content)
+        b = make_file("b.bin", changed)
+        out = komparu.FileDiff()
+        assert komparu.compare_into(str(a), str(b), out, chunk_size=4096) is False
+        assert out.reason is DiffReason.CONTENT_MISMATCH
+        assert out.first_diff_offset == 123_456
+
+    def test_size_precheck(self, make_file):
+        a = make_file("a.txt", b"short")
+        b = make_file("b.txt", b"longer")
+        out = komparu.FileDiff()
+        assert komparu.compare_into(str(a), str(b), out) is False
+        assert out.reason is DiffReason.SIZE_MISMATCH
+        assert out.first_diff_offset is None
+        assert (out.size_a, out.size_b) == (5, 6)
+
+    def test_prefix_without_precheck(self, make_file):
+        a = make_file("a.txt", b"hello")
+        b = make_file("b.txt", b"hello world")
+        out = komparu.FileDiff()
+        komparu.compare_into(str(a), str(b), out, size_precheck=False)
+        assert out.reason is DiffReason.SIZE_MISMATCH
+        assert out.first_diff_offset == 5
+
+    def test_reuse_resets_fields(self, make_file):
+        a = make_file("a.txt", b"abc")
+        b = make_file("b.txt", b"abd")
+        c = make_file("c.txt", b"abc")
+        out = komparu.FileDiff()
+        komparu.compare_into(str(a), str(b), out)
+        assert out.first_diff_offset == 2
+        komparu.compare_into(str(a), str(c), out)
+        assert out.equal is True
+        assert out.reason is None
+        assert out.first_diff_offset is None
+
+    def test_decoded_size(self, make_file):
+        raw = b"payload bytes"
+        a = make_file("a.b64", base64.b64encode(raw))
+        b = make_file("b.bin", raw)
+        out = komparu.FileDiff()
+        assert komparu.compare_into(str(a), str(b), out, decode_a="base64") is True
+        assert out.size_a == len(raw)
+
+    def test_io_empty_file_fallback(self, make_file):
+        a = make_file("a.txt", b"")
+        b = make_file("b.txt", b"data")
+        out = komparu.FileDiff()
+        komparu.compare_into(str(a), str(b), out)
+        assert out.io_a == komparu.IOInfo("read", "empty_file")
+        assert out.io_b == komparu.IOInfo("read", "below_threshold")
+
+    def test_io_same_file_not_opened(self, make_file):
+        a = make_file("a.txt", b"data")
+        out = komparu.FileDiff()
+        assert komparu.compare_into(str(a), str(a), out) is True
+        assert out.io_a is None
+        assert out.io_b is None
+
+    def test_huge_pages_outcome(self, make_file):
+        content = os.urandom(4 * 1024 * 1024)
+        a = make_file("a.bin", content)
+        b = make_file("b.bin", content)
+        out = komparu.FileDiff()
+        assert komparu.compare_into(str(a), str(b), out, huge_pages=True) is True
+        assert out.io_a.path == "mmap"
+        assert out.io_a.huge_pages in ("hugetlbfs", "madvise", "refused")
+
+    def test_huge_pages_not_requested(self, make_file):
+        a = make_file("a.bin", b"data")
+        b = make_file("b.bin", b"data")
+        out = komparu.FileDiff()
+        komparu.compare_into(str(a), str(b), out)
+        assert out.io_a.huge_pages is None
+
+    def test_huge_pages_compare(self, make_file):
+        content = os.urandom(1024 * 1024)
+        a = make_file("a.bin", content)
+        b = make_file("b.bin", content[:-1] + b"\x00")
+        assert komparu.compare(str(a), str(a), huge_pages=True) is True
+        assert komparu.compare(str(a), str(b), huge_pages=True) is (content[-1] == 0)
+
+    def test_io_uring_path(self, make_file):
+        content = os.urandom(1024 * 1024 + 777)
+        a = make_file("a.bin", content)
+        b = make_file("b.bin", content[:900_000] + b"\xff" + content[900_001:])
+        out = komparu.FileDiff()
+        equal = komparu.compare_into(str(a), str(b), out, io_uring=True, io_uring_depth=3)
+        assert equal is (content[900_000] == 0xFF)
+        assert out.io_a in (
+            komparu.IOInfo("io_uring"), komparu.IOInfo("read", "uring_unavailable"),
+        )
+        if not equal:
+            assert out.first_diff_offset == 900_000
+
+    def test_io_uring_compare(self, make_file):
+        content = os.urandom(3 * 128 * 1024 + 5)
+        a = make_file("a.bin", content)
+        b = make_file("b.bin", content)
+        c = make_file("c.bin", content[:-1] + bytes([content[-1] ^ 1]))
+        for depth in (1, 2, 8):
+            assert komparu.compare(str(a), str(b), io_uring=True, io_uring_depth=depth) is True
+            assert komparu.compare(str(a), str(c), io_uring=True, io_uring_depth=depth) is False
+
+    def test_io_uring_empty_file(self, make_file):
+        a = make_file("a.txt", b"")
+        b = make_file("b.txt", b"")
+        out = komparu.FileDiff()
+        assert komparu.compare_into(str(a), str(b), out, io_uring=True) is True
+        assert out.io_a == komparu.IOInfo("read", "empty_file")
+
+    def test_io_uring_depth_validation(self, make_file):
+        a = make_file("a.txt", b"data")
+        with pytest.raises(ValueError, match="io_uring_depth"):
+            komparu.compare(str(a), str(a), io_uring=True, io_uring_depth=0)
+        with pytest.raises(ValueError, match="io_uring_depth"):
+            komparu.compare(str(a), str(a), io_uring=True, io_uring_depth=257)
+
+    def test_strategy_auto_threshold(self, make_file):
+        small = make_file("small.bin", b"x" * (64 * 1024 - 1))
+        large = make_file("large.bin", b"x" * (64 * 1024))
+        out = komparu.FileDiff()
+        komparu.compare_into(str(small), str(large), out, size_precheck=False)
+        assert out.io_a == komparu.IOInfo("read", "below_threshold")
+        assert out.io_b == komparu.IOInfo("mmap")
+
+    def test_strategy_mmap(self, make_file):
+        a = make_file("a.txt", b"data")
+        b = make_file("b.txt", b"")
+        out = komparu.FileDiff()
+        komparu.compare_into(str(a), str(b), out, strategy="mmap")
+        assert out.io_a == komparu.IOInfo("mmap")
+        assert out.io_b == komparu.IOInfo("read", "empty_file")
+
+    def test_strategy_buffered(self, make_file):
+        content = os.urandom(300_000)
+        a = make_file("a.bin", content)
+        b = make_file("b.bin", content[:-1] + bytes([content[-1] ^ 1]))
+        out = komparu.FileDiff()
+        assert komparu.compare_into(str(a), str(b), out, strategy="buffered") is False
+        assert out.io_a == komparu.IOInfo("read", "buffered")
+        assert out.first_diff_offset == len(content) - 1
+        assert komparu.compare(str(a), str(a), strategy="buffered") is True
+        assert komparu.compare(str(a), str(b), strategy="buffered") is False
+
+    def test_strategy_same_result(self, make_file):
+        content = os.urandom(200_000)
+        a = make_file("a.bin", content)
+        b = make_file("b.bin", content[:150_000] + b"\x00" + content[150_001:])
+        expected = content[150_000] == 0
+        for strategy in ("auto", "mmap", "buffered", "prefetch"):
+            assert komparu.compare(str(a), str(b), strategy=strategy) is expected
+
+    def test_strategy_prefetch(self, make_file):
+        content = os.urandom(5 * 65536 + 123)
+        a = make_file("a.bin", content)
+        b = make_file("b.bin", content[:-1] + bytes([content[-1] ^ 1]))
+        c = make_file("c.bin", content[:200_000] + bytes([content[200_000] ^ 1])
+                      + content[200_001:])
+        d = make_file("d.bin", content)
+        out = komparu.FileDiff()
+        assert komparu.compare_into(str(a), str(b), out, strategy="prefetch") is False
+        assert out.io_a == komparu.IOInfo("prefetch")
+        assert out.first_diff_offset == len(content) - 1
+        # quick_check seeks the readers to sample offsets before the scan
+        for chunk_size in (1000, 65536, 1 << 20):
+            assert komparu.compare(str(a), str(c), strategy="prefetch",
+                                   chunk_size=chunk_size) is False
+            assert komparu.compare(str(a), str(d), strategy="prefetch",
+                                   chunk_size=chunk_size) is True
+
+    def test_strategy_prefetch_empty_file(self, make_file):
+        a = make_file("a.txt", b"")
+        b = make_file("b.txt", b"")
+        out = komparu.FileDiff()
+        assert komparu.compare_into(str(a), str(b), out, strategy="prefetch") is True
+        assert out.io_a == komparu.IOInfo("read", "empty_file")
+
+    def test_strategy_validation(self, make_file):
+        a = make_file("a.txt", b"data")
+        with pytest.raises(ValueError, match="strategy"):
+            komparu.compare(str(a), str(a), strategy="direct")
+        with pytest.raises(ValueError, match="io_uring"):
+            komparu.compare_into(str(a), str(a), komparu.FileDiff(),
+                                 strategy="mmap", io_uring=True)
+
+
+class TestCompareFileBytes:
+    """compare_file_bytes checks a file against an expected buffer."""
+
+    def test_equal(self, make_file):
+        f = make_file("a.bin", b"expected content")
+        assert komparu.compare_file_bytes(str(f), b"expected content") == (True, None)
+
+    def test_first_diff_offset(self, make_file):
+        content = os.urandom(300_000)
+        want = content[:200_001] + bytes([content[200_001] ^ 1]) + content[200_002:]
+        f = make_file("a.bin", content)
+        assert komparu.compare_file_bytes(str(f), want, chunk_size=4096) == (False, 200_001)
+
+    def test_diff_at_first_byte(self, make_file):
+        f = make_file("a.txt", b"abc")
+        assert komparu.compare_file_bytes(str(f), b"xbc") == (False, 0)
+
+    def test_size_precheck(self, make_file):
+        f = make_file("a.txt", b"hello")
+        assert komparu.compare_file_bytes(str(f), b"hello world") == (False, None)
+
+    def test_prefix_without_precheck(self, make_file):
+        f = make_file("a.txt", b"hello world")
+        assert komparu.compare_file_bytes(str(f), b"hello", size_precheck=False) == (False, 5)
+
+    def test_empty(self, make_file):
+        f = make_file("a.txt", b"")
+        assert komparu.compare_file_bytes(str(f), b"") == (True, None)
+        assert komparu.compare_file_bytes(str(f), b"x", size_precheck=False) == (False, 0)
+
+    def test_accepts_buffers(self, make_file):
+        f = make_file("a.bin", b"\x00\x01\x02")
+        assert komparu.compare_file_bytes(str(f), bytearray(b"\x00\x01\x02")) == (True, None)
+        assert komparu.compare_file_bytes(str(f), memoryview(b"\x00\x01\x03")) == (False, 2)
+
+    def test_missing_file(self, tmp_path):
+        with pytest.raises(FileNotFoundError):
+            komparu.compare_file_bytes(str(tmp_path / "missing"), b"")
+
+
+class TestCompareHandles:
+    """compare_handles() compares open files from their current positions."""
+
+    def test_equal_descriptors(self, make_file):
+        a = make_file("a.bin", b"same content")
+        b = make_file("b.bin", b"same content")
+        fa, fb = os.open(a, os.O_RDONLY), os.open(b, os.O_RDONLY)
+        try:
+            assert komparu.compare_handles(fa, fb) == (True, None)
+        finally:
+            os.close(fa)
+            os.close(fb)
+
+    def test_from_current_offset(self, make_file):
+        a = make_file("a.bin", b"HDR:payload")
+        b = make_file("b.bin", b"payload")
+        fa, fb = os.open(a, os.O_RDONLY), os.open(b, os.O_RDONLY)
+        try:
+            os.lseek(fa, 4, os.SEEK_SET)
+            assert komparu.compare_handles(fa, fb) == (True, None)
+            assert os.lseek(fa, 0, os.SEEK_CUR) == 4
+            assert os.lseek(fb, 0, os.SEEK_CUR) == 0
+        finally:
+            os.close(fa)
+            os.close(fb)
+
+    def test_first_diff_relative_to_start(self, make_file):
+        a = make_file("a.bin", b"xxabcdef")
+        b = make_file("b.bin", b"abcXef")
+        with open(a, "rb") as fa, open(b, "rb") as fb:
+            fa.seek(2)
+            assert komparu.compare_handles(fa, fb) == (False, 3)
+
+    def test_buffered_reader_position(self, make_file):
+        a = make_file("a.bin", b"0123456789")
+        b = make_file("b.bin", b"3456789")
+        with open(a, "rb") as fa, open(b, "rb") as fb:
+            assert fa.read(3) == b"012"  # buffer now holds the whole file
+            assert komparu.compare_handles(fa, fb) == (True, None)
+            assert fa.read() == b"3456789"
+
+    def test_handles_left_open(self, make_file):
+        a = make_file("a.bin", b"data")
+        with open(a, "rb") as fa, open(a, "rb") as fb:
+            komparu.compare_handles(fa, fb)
+            assert not fa.closed
+            os.fstat(fa.fileno())
+
+    def test_size_mismatch(self, make_file):
+        a = make_file("a.bin", b"abc")
+        b = make_file("b.bin", b"abcdef")
+        with open(a, "rb") as fa, open(b, "rb") as fb:
+            assert komparu.compare_handles(fa, fb) == (False, None)
+            assert komparu.compare_handles(fa, fb, size_precheck=False) == (False, 3)
+
+    def test_offset_past_end_is_empty(self, make_file):
+        a = make_file("a.bin", b"abc")
+        b = make_file("b.bin", b"")
+        with open(a, "rb") as fa, open(b, "rb") as fb:
+            fa.seek(10)
+            assert komparu.compare_handles(fa, fb) == (True, None)
+
+    def test_unbuffered_file(self, make_file):
+        content = os.urandom(300_000)
+        a = make_file("a.bin", content)
+        b = make_file("b.bin", content)
+        with open(a, "rb", buffering=0) as fa, open(b, "rb", buffering=0) as fb:
+            assert komparu.compare_handles(fa, fb, chunk_size=4096) == (True, None)
+
+    def test_pipe_rejected(self, make_file):
+        a = make_file("a.bin", b"x")
+        r, w = os.pipe()
+        try:
+            with open(a, "rb") as fa, pytest.raises(OSError, match="not a regular file"):
+                komparu.compare_handles(fa, r)
+        finally:
+            os.close(r)
+            os.close(w)
+
+    def test_bad_descriptor(self, make_file):
+        a = make_file("a.bin", b"x")
+        with open(a, "rb") as fa, pytest.raises(OSError, match="fd"):
+            komparu.compare_handles(fa, 987654)
+
+    def test_text_stream_rejected(self, make_file):
+        a = make_file("a.txt", b"x")
+        with open(a, "rb") as fb, open(a) as ft, pytest.raises(TypeError, match="text"):
+            komparu.compare_handles(ft, fb)
+
+    def test_not_a_handle(self):
+        with pytest.raises(TypeError):
+            komparu.compare_handles("a.bin", 0)
+
+
+class TestCompareSampled:
+    """compare_sampled reads only every Nth block."""
+
+    def test_equal(self, make_file):
+        content = os.urandom(100_000)
+        a = make_file("a.bin", content)
+        b = make_file("b.bin", content)
+        assert komparu.compare_sampled(str(a), str(b), sample_every=4, block_size=1024) is True
+
+    def test_diff_in_sampled_block(self, make_file):
+        content = bytearray(os.urandom(100_000))
+        a = make_file("a.bin", bytes(content))
+        content[4 * 1024 + 10] ^= 1  # block 4
+        b = make_file("b.bin", bytes(content))
+        assert komparu.compare_sampled(str(a), str(b), sample_every=4, block_size=1024) is False
+
+    def test_diff_between_samples_missed(self, make_file):
+        content = bytearray(os.urandom(100_000))
+        a = make_file("a.bin", bytes(content))
+        content[1024 + 10] ^= 1  # block 1, not sampled
+        b = make_file("b.bin", bytes(content))
+        assert komparu.compare_sampled(str(a), str(b), sample_every=4, block_size=1024) is True
+        assert komparu.compare_sampled(str(a), str(b), sample_every=1, block_size=1024) is False
+
+    def test_last_block_always_sampled(self, make_file):
+        content = bytearray(os.urandom(10 * 1024 + 7))
+        a = make_file("a.bin", bytes(content))
+        content[-1] ^= 1
+        b = make_file("b.bin", bytes(content))
+        assert komparu.compare_sampled(str(a), str(b), sample_every=100, block_size=1024) is False
+
+    def test_size_mismatch(self, make_file):
+        a = make_file("a.bin", b"x" * 100)
+        b = make_file("b.bin", b"x" * 101)
+        assert komparu.compare_sampled(str(a), str(b), sample_every=1) is False
+
+    def test_empty(self, make_file):
+        a = make_file("a.bin", b"")
+        b = make_file("b.bin", b"")
+        assert komparu.compare_sampled(str(a), str(b), sample_every=8) is True
+
+    def test_invalid_stride(self, make_file):
+        a = make_file("a.bin", b"x")
+        with pytest.raises(ValueError, match="sample_every"):
+            komparu.compare_sampled(str(a), str(a), sample_every=0)
+        with pytest.raises(ValueError, match="block_size"):
+            komparu.compare_sampled(str(a), str(a), sample_every=1, block_size=0)
+
+
+class TestCompareHeadTail:
+    """compare_head_tail reads only both ends of each file."""
+
+    def test_identical(self, make_file):
+        data = os.urandom(10_000)
+        a = make_file("a.bin", data)
+        b = make_file("b.bin", data)
+        assert komparu.compare_head_tail(str(a), str(b), 100) is True
+
+    def test_middle_difference_missed(self, make_file):
+        a = make_file("a.bin", b"h" * 100 + b"A" * 1000 + b"t" * 100)
+        b = make_file("b.bin", b"h" * 100 + b"B" * 1000 + b"t" * 100)
+        assert komparu.compare_head_tail(str(a), str(b), 100) is True
+        assert komparu.compare(str(a), str(b)) is False
+
+    def test_head_difference(self, make_file):
+        a = make_file("a.bin", b"X" + b"x" * 999)
+        b = make_file("b.bin", b"Y" + b"x" * 999)
+        assert komparu.compare_head_tail(str(a), str(b), 10) is False
+
+    def test_tail_difference(self, make_file):
+        a = make_file("a.bin", b"x" * 999 + b"X")
+        b = make_file("b.bin", b"x" * 999 + b"Y")
+        assert komparu.compare_head_tail(str(a), str(b), 10, chunk_size=3) is False
+
+    def test_size_mismatch(self, make_file):
+        a = make_file("a.bin", b"abc")
+        b = make_file("b.bin", b"abcd")
+        assert komparu.compare_head_tail(str(a), str(b), 0) is False
+
+    def test_short_file_compared_whole(self, make_file):
+        a = make_file("a.bin", b"abcdefgh")
+        b = make_file("b.bin", b"abcdXfgh")
+        assert komparu.compare_head_tail(str(a), str(b), 4) is False
+        assert komparu.compare_head_tail(str(a), str(b), 3) is True
+
+    def test_zero_n_checks_size_only(self, make_file):
+        a = make_file("a.bin", b"aaaa")
+        b = make_file("b.bin", b"bbbb")
+        assert komparu.compare_head_tail(str(a), str(b), 0) is True
+
+    def test_invalid_n(self, make_file):
+        a = make_file("a.bin", b"x")
+        with pytest.raises(ValueError, match="n must be"):
+            komparu.compare_head_tail(str(a), str(a), -1)
+
+
+def _u32_length(header: bytes) -> int:
+    return 4 + int.from_bytes(header[:4], "big")
+
+
+class TestCompareRange:
+    """compare_range reads only the given byte range of each file."""
+
+    def test_equal_range(self, make_file):
+        a = make_file("a.bin", b"A" * 100 + b"same" * 500 + b"A" * 100)
+        b = make_file("b.bin", b"B" * 100 + b"same" * 500 + b"B" * 100)
+        for strategy in ("auto", "mmap", "buffered", "prefetch"):
+            assert komparu.compare_range(str(a), str(b), 100, 2000, strategy=strategy) is True
+            assert komparu.compare_range(str(a), str(b), 99, 2000, strategy=strategy) is False
+            assert komparu.compare_range(str(a), str(b), 100, 2001, strategy=strategy) is False
+
+    def test_difference_in_range(self, make_file):
+        data = bytearray(os.urandom(50_000))
+        a = make_file("a.bin", bytes(data))
+        data[30_000] ^= 1
+        b = make_file("b.bin", bytes(data))
+        assert komparu.compare_range(str(a), str(b), 20_000, 20_000, chunk_size=4096) is False
+        assert komparu.compare_range(str(a), str(b), 0, 30_000) is True
+        assert komparu.compare_range(str(a), str(b), 30_001) is True
+
+    def test_to_end(self, make_file):
+        a = make_file("a.bin", b"Xtail")
+        b = make_file("b.bin", b"Ytail")
+        c = make_file("c.bin", b"Ytail!")
+        assert komparu.compare_range(str(a), str(b), 1) is True
+        assert komparu.compare_range(str(a), str(c), 1) is False
+        assert komparu.compare_range(str(a), str(b), 5) is True
+
+    def test_empty_range(self, make_file):
+        a = make_file("a.bin", b"abc")
+        b = make_file("b.bin", b"xyz")
+        assert komparu.compare_range(str(a), str(b), 2, 0) is True
+
+    def test_past_end(self, make_file):
+        a = make_file("a.bin", b"x" * 100)
+        b = make_file("b.bin", b"x" * 50)
+        with pytest.raises(ValueError, match=r"range 40-60 extends past the end of .*b\.bin \(50 bytes\)"):
+            komparu.compare_range(str(a), str(b), 40, 20)
+        with pytest.raises(ValueError, match="extends past the end"):
+            komparu.compare_range(str(a), str(b), 101)
+
+    def test_negative(self, make_file):
+        a = make_file("a.bin", b"x")
+        with pytest.raises(ValueError, match="offset"):
+            komparu.compare_range(str(a), str(a), -1)
+        with pytest.raises(ValueError, match="length"):
+            komparu.compare_range(str(a), str(a), 0, -1)
+
+    def test_cancelled(self, make_file):
+        a = make_file("a.bin", b"x" * 1000)
+        b = make_file("b.bin", b"x" * 1000)
+        token = komparu.CancelToken()
+        token.cancel()
+        with pytest.raises(komparu.CancelledError):
+            komparu.compare_range(str(a), str(b), 10, 100, cancel=token)
+
+
+class TestCompareLengthPrefixed:
+    """compare_length_prefixed trims padding using a declared length."""
+
+    def test_padding_ignored(self, make_file):
+        body = b"record body"
+        rec = len(body).to_bytes(4, "big") + body
+        a = make_file("a.bin", rec + b"\x00" * 100)
+        b = make_file("b.bin", rec + b"\xff" * 7)
+        assert komparu.compare(str(a), str(b)) is False
+        assert komparu.compare_length_prefixed(
+            str(a), str(b), header_size=4, declared_length=_u32_length,
+        ) is True
+
+    def test_declared_lengths_differ(self, make_file):
+        a = make_file("a.bin", (5).to_bytes(4, "big") + b"hello")
+        b = make_file("b.bin", (6).to_bytes(4, "big") + b"hello!")
+        seen = []
+
+        def length(header: bytes) -> int:
+            seen.append(header)
+            return _u32_length(header)
+
+        assert komparu.compare_length_prefixed(
+            str(a), str(b), header_size=4, declared_length=length,
+        ) is False
+        assert len(seen) == 2
+
+    def test_body_differs(self, make_file):
+        a = make_file("a.bin", (5).to_bytes(4, "big") + b"hello\x00")
+        b = make_file("b.bin", (5).to_bytes(4, "big") + b"hellO\x00")
+        assert komparu.compare_length_prefixed(
+            str(a), str(b), header_size=4, declared_length=_u32_length,
+        ) is False
+
+    def test_truncated_body(self, make_file):
+        a = make_file("a.bin", (8).to_bytes(4, "big") + b"abcdefgh")
+        b = make_file("b.bin", (8).to_bytes(4, "big") + b"abcd")
+        assert komparu.compare_length_prefixed(
+            str(a), str(b), header_size=4, declared_length=_u32_length,
+        ) is False
+
+    def test_both_truncated(self, make_file):
+        a = make_file("a.bin", (8).to_bytes(4, "big") + b"abcd")
+        b = make_file("b.bin", (8).to_bytes(4, "big") + b"abcd")
+        assert komparu.compare_length_prefixed(
+            str(a), str(b), header_size=4, declared_length=_u32_length,
+        ) is False
+
+    def test_same_file_with_padding(self, make_file):
+        a = make_file("a.bin", (3).to_bytes(4, "big") + b"abc" + b"\x00" * 9)
+        assert komparu.compare_length_prefixed(
+            str(a), str(a), header_size=4, declared_length=_u32_length,
+        ) is True
+
+    def test_negative_length(self, make_file):
+        a = make_file("a.bin", b"data")
+        with pytest.raises(ValueError, match="declared_length"):
+            komparu.compare_length_prefixed(
+                str(a), str(a), header_size=4, declared_length=lambda h: -1,
+            )
+
+    def test_invalid_header_size(self, make_file):
+        a = make_file("a.bin", b"data")
+        with pytest.raises(ValueError, match="header_size"):
+            komparu.compare_length_prefixed(
+                str(a), str(a), header_size=0, declared_length=_u32_length,
+            )
+
+
+def _f64(*values: float) -> bytes:
+    return struct.pack(f"={len(values)}d", *values)
+
+
+class TestCompareNumeric:
+    """compare_numeric compares float arrays element-wise."""
+
+    def test_ulp_difference_within_tolerance(self, make_file):
+        x = 0.1 + 0.2
+        a = make_file("a.f64", _f64(1.0, x, 3.0))
+        b = make_file("b.f64", _f64(1.0, math.nextafter(x, 1.0), 3.0))
+        assert komparu.compare(str(a), str(b)) is False
+        assert komparu.compare_numeric(str(a), str(b), rel_tol=1e-12) is True
+
+    def test_exact_by_default(self, make_file):
+        a = make_file("a.f64", _f64(1.0))
+        b = make_file("b.f64", _f64(math.nextafter(1.0, 2.0)))
+        assert komparu.compare_numeric(str(a), str(b)) is False
+
+    def test_abs_tol(self, make_file):
+        a = make_file("a.f64", _f64(0.0, 5.0))
+        b = make_file("b.f64", _f64(1e-9, 5.0))
+        assert komparu.compare_numeric(str(a), str(b), rel_tol=1e-6) is False
+        assert komparu.compare_numeric(str(a), str(b), abs_tol=1e-8) is True
+
+    def test_float32(self, make_file):
+        a = make_file("a.f32", struct.pack("=2f", 1.5, 2.25))
+        b = make_file("b.f32", struct.pack("=2f", 1.5, 2.2500002))
+        assert komparu.compare_numeric(str(a), str(b), dtype="float32") is False
+        assert komparu.compare_numeric(
+            str(a), str(b), dtype="float32", rel_tol=1e-6,
+        ) is True
+
+    def test_nan(self, make_file):
+        a = make_file("a.f64", _f64(1.0, math.nan))
+        b = make_file("b.f64", _f64(1.0, math.nan))
+        assert komparu.compare_numeric(str(a), str(b), rel_tol=1e-9) is False
+        assert komparu.compare_numeric(str(a), str(b), nan_equal=True) is True
+
+    def test_infinity_not_close_to_finite(self, make_file):
+        a = make_file("a.f64", _f64(math.inf))
+        b = make_file("b.f64", _f64(1e308))
+        assert komparu.compare_numeric(str(a), str(b), rel_tol=1.0) is False
+
+    def test_length_differs(self, make_file):
+        a = make_file("a.f64", _f64(1.0, 2.0))
+        b = make_file("b.f64", _f64(1.0))
+        assert komparu.compare_numeric(str(a), str(b), abs_tol=1.0) is False
+
+    def test_many_chunks(self, make_file):
+        values_a = [i * 0.5 for i in range(20_000)]
+        values_b = list(values_a)
+        values_b[-1] += 1e-9
+        a = make_file("a.f64", _f64(*values_a))
+        b = make_file("b.f64", _f64(*values_b))
+        assert komparu.compare_numeric(
+            str(a), str(b), abs_tol=1e-6, chunk_size=1000,
+        ) is True
+        assert komparu.compare_numeric(str(a), str(b), chunk_size=1000) is False
+
+    def test_size_not_multiple(self, make_file):
+        a = make_file("a.f64", _f64(1.0) + b"\x00")
+        b = make_file("b.f64", _f64(1.0) + b"\x00")
+        with pytest.raises(ValueError, match="not a multiple of 8"):
+            komparu.compare_numeric(str(a), str(b))
+
+    def test_invalid_dtype(self, make_file):
+        a = make_file("a.bin", b"")
+        with pytest.raises(ValueError, match="dtype"):
+            komparu.compare_numeric(str(a), str(a), dtype="int8")
+
+class TestCountDifferingBytes:
+    """count_differing_bytes counts every differing position."""
+
+    def test_identical(self, make_file):
+        a = make_file("a.bin", b"same bytes")
+        b = make_file("b.bin", b"same bytes")
+        assert komparu.count_differing_bytes(str(a), str(b)) == (0, 10)
+
+    def test_scattered_differences(self, make_file):
+        content = bytearray(os.urandom(100_003))
+        a = make_file("a.bin", bytes(content))
+        flips = [0, 7, 8, 4095, 4096, 50_000, 50_001, 100_002]
+        for i in flips:
+            content[i] ^= 0x80
+        b = make_file("b.bin", bytes(content))
+        assert komparu.count_differing_bytes(str(a), str(b), chunk_size=4096) == (
+            len(flips), 100_003,
+        )
+
+    def test_matches_naive_count(self, make_file):
+        x = os.urandom(10_000)
+        y = bytes(v if i % 3 else v ^ 1 for i, v in enumerate(x))
+        a = make_file("a.bin", x)
+        b = make_file("b.bin", y)
+        expected = sum(p != q for p, q in zip(x, y))
+        assert komparu.count_differing_bytes(str(a), str(b)) == (expected, 10_000)
+
+    def test_trailing_bytes_differ(self, make_file):
+        a = make_file("a.bin", b"abcdef")
+        b = make_file("b.bin", b"abXdef" + b"z" * 10_000)
+        assert komparu.count_differing_bytes(str(a), str(b), chunk_size=64) == (
+            10_001, 10_006,
+        )
+        assert komparu.count_differing_bytes(str(b), str(a), chunk_size=64) == (
+            10_001, 10_006,
+        )
+
+    def test_empty(self, make_file):
+        a = make_file("a.bin", b"")
+        b = make_file("b.bin", b"xyz")
+        assert komparu.count_differing_bytes(str(a), str(a)) == (0, 0)
+        assert komparu.count_differing_bytes(str(a), str(b)) == (3, 3)
+
+    def test_missing(self, tmp_path, make_file):
+        a = make_file("a.bin", b"x")
+        with pytest.raises(FileNotFoundError):
+            komparu.count_differing_bytes(str(a), str(tmp_path / "nope"))
+
+
+def _naive_ranges(x: bytes, y: bytes) -> int:
+    n = max(len(x), len(y))
+    differs = [i >= len(x) or i >= len(y) or x[i] != y[i] for i in range(n)]
+    return sum(d and (i == 0 or not differs[i - 1]) for i, d in enumerate(differs))
+
+
+class TestDiffStats:
+    """diff_stats scans in full and reports bytes, ranges and similarity."""
+
+    def test_identical(self, make_file):
+        a = make_file("a.bin", b"same bytes")
+        stats = komparu.diff_stats(str(a), str(a))
+        assert stats == komparu.DiffStats(10, 10, 0, 0, None)
+        assert stats.equal is True
+        assert stats.similarity == 100.0
+
+    def test_ranges(self, make_file):
+        content = bytearray(os.urandom(20_000))
+        a = make_file("a.bin", bytes(content))
+        for i in [*range(100, 110), 4090, 4091, 4092, 4093, 4094, 4095, 4096, 4097, 9000]:
+            content[i] ^= 0xFF
+        b = make_file("b.bin", bytes(content))
+        stats = komparu.diff_stats(str(a), str(b), chunk_size=4096)
+        assert (stats.differing_bytes, stats.differing_ranges) == (19, 3)
+        assert stats.first_diff_offset == 100
+        assert stats.similarity == pytest.approx(100 * (20_000 - 19) / 20_000)
+        assert stats.equal is False
+
+    def test_matches_naive(self, make_file):
+        x = os.urandom(10_000)
+        y = bytes(v ^ 1 if (i // 7) % 3 == 0 or i % 11 == 0 else v for i, v in enumerate(x))
+        a = make_file("a.bin", x)
+        b = make_file("b.bin", y[:9_000])
+        for chunk in (1, 13, 4096, 65536):
+            stats = komparu.diff_stats(str(a), str(b), chunk_size=chunk)
+            assert stats.differing_bytes == komparu.count_differing_bytes(str(a), str(b))[0]
+            assert stats.differing_ranges == _naive_ranges(x, y[:9_000])
+
+    def test_trailing_bytes(self, make_file):
+        a = make_file("a.bin", b"abcdef")
+        b = make_file("b.bin", b"abcdeX" + b"z" * 10_000)
+        for p, q in ((a, b), (b, a)):
+            stats = komparu.diff_stats(str(p), str(q), chunk_size=64)
+            assert (stats.differing_bytes, stats.differing_ranges) == (10_001, 1)
+            assert stats.first_diff_offset == 5
+            assert stats.total == 10_006
+        c = make_file("c.bin", b"abcdef" + b"z")
+        stats = komparu.diff_stats(str(a), str(c))
+        assert (stats.differing_bytes, stats.differing_ranges, stats.first_diff_offset) == (1, 1, 6)
+
+    def test_empty_and_missing(self, tmp_path, make_file):
+        a = make_file("a.bin", b"")
+        assert komparu.diff_stats(str(a), str(a)).similarity == 100.0
+        with pytest.raises(FileNotFoundError):
+            komparu.diff_stats(str(a), str(tmp_path / "nope"))
+
+    def test_cancelled(self, make_file):
+        a = make_file("a.bin", b"x")
+        token = komparu.CancelToken()
+        token.cancel()
+        with pytest.raises(komparu.CancelledError):
+            komparu.diff_stats(str(a), str(a), cancel=token)
+
+
+class TestCommonPrefixLen:
+    """common_prefix_len counts shared leading bytes."""
+
+    def test_identical_returns_length(self, make_file):
+        a = make_file("a.bin", b"same bytes")
+        b = make_file("b.bin", b"same bytes")
+        assert komparu.common_prefix_len(str(a), str(b)) == 10
+
+    def test_diverging(self, make_file):
+        a = make_file("a.bin", b"x" * 70_000 + b"a")
+        b = make_file("b.bin", b"x" * 70_000 + b"b")
+        assert komparu.common_prefix_len(str(a), str(b), chunk_size=4096) == 70_000
+
+    def test_one_is_prefix(self, make_file):
+        a = make_file("a.bin", b"abc")
+        b = make_file("b.bin", b"abcdef")
+        assert komparu.common_prefix_len(str(a), str(b)) == 3
+        assert komparu.common_prefix_len(str(b), str(a)) == 3
+
+    def test_different_length_early_diff(self, make_file):
+        a = make_file("a.bin", b"abX")
+        b = make_file("b.bin", b"abcdef")
+        assert komparu.common_prefix_len(str(a), str(b)) == 2
+
+    def test_empty(self, make_file):
+        a = make_file("a.bin", b"")
+        b = make_file("b.bin", b"data")
+        assert komparu.common_prefix_len(str(a), str(b)) == 0
+        assert komparu.common_prefix_len(str(a), str(a)) == 0
+
+    def test_missing_file(self, make_file, tmp_path):
+        a = make_file("a.bin", b"x")
+        with pytest.raises(FileNotFoundError):
+            komparu.common_prefix_len(str(a), str(tmp_path / "missing"))
+
+
+class TestIsPrefix:
+    """is_prefix detects appended data and says which file is shorter."""
+
+    def test_a_is_prefix(self, make_file):
+        a = make_file("a.log", b"line1\nline2\n")
+        b = make_file("b.log", b"line1\nline2\nline3\n")
+        assert komparu.is_prefix(str(a), str(b)) == "a"
+        assert komparu.is_prefix(str(b), str(a)) == "b"
+
+    def test_equal(self, make_file):
+        a = make_file("a.log", b"same")
+        b = make_file("b.log", b"same")
+        assert komparu.is_prefix(str(a), str(b)) == "equal"
+
+    def test_rewritten_history(self, make_file):
+        a = make_file("a.log", b"line1\nlineX\n")
+        b = make_file("b.log", b"line1\nline2\nline3\n")
+        assert komparu.is_prefix(str(a), str(b)) is None
+
+    def test_same_length_difference(self, make_file):
+        a = make_file("a.log", b"abcd")
+        b = make_file("b.log", b"abce")
+        assert komparu.is_prefix(str(a), str(b)) is None
+
+    def test_empty_is_prefix(self, make_file):
+        a = make_file("a.log", b"")
+        b = make_file("b.log", b"data")
+        assert komparu.is_prefix(str(a), str(b)) == "a"
+
+    def test_large_append(self, make_file):
+        data = os.urandom(200_000)
+        a = make_file("a.bin", data)
+        b = make_file("b.bin", data + b"tail")
+        assert komparu.is_prefix(str(a), str(b), chunk_size=4096) == "a"
+
+    def test_missing_file(self, make_file, tmp_path):
+        a = make_file("a.log", b"x")
+        with pytest.raises(FileNotFoundError):
+            komparu.is_prefix(str(a), str(tmp_path / "missing"))
+
+
+class TestFirstDifference:
+    """first_difference reports the offset, bytes and context of a mismatch."""
+
+    def test_identical(self, make_file):
+        a = make_file("a.bin", b"same")
+        b = make_file("b.bin", b"same")
+        assert komparu.first_difference(str(a), str(b)) is None
+
+    def test_offset_and_bytes(self, make_file):
+        data = bytearray(os.urandom(300_000))
+        a = make_file("a.bin", bytes(data))
+        data[104_857] ^= 0xFF
+        b = make_file("b.bin", bytes(data))
+        m = komparu.first_difference(str(a), str(b), context=4, chunk_size=4096)
+        assert m.offset == 104_857
+        assert m.byte_a ^ m.byte_b == 0xFF
+        assert m.context_start == 104_853
+        assert len(m.context_a) == len(m.context_b) == 9
+        assert m.context_a[4] == m.byte_a
+
+    def test_context_clipped_at_start(self, make_file):
+        a = make_file("a.bin", b"xbcdef")
+        b = make_file("b.bin", b"ybcdef")
+        m = komparu.first_difference(str(a), str(b), context=3)
+        assert (m.offset, m.context_start) == (0, 0)
+        assert m.context_a == b"xbcd"
+        assert m.context_b == b"ybcd"
+
+    def test_prefix(self, make_file):
+        a = make_file("a.bin", b"abc")
+        b = make_file("b.bin", b"abcdef")
+        m = komparu.first_difference(str(a), str(b), context=2)
+        assert m.offset == 3
+        assert m.byte_a is None
+        assert m.byte_b == ord("d")
+        assert m.context_a == b"bc"
+        assert m.context_b == b"bcdef"
+
+    def test_zero_context(self, make_file):
+        a = make_file("a.bin", b"aXc")
+        b = make_file("b.bin", b"aYc")
+        m = komparu.first_difference(str(a), str(b), context=0)
+        assert (m.context_a, m.context_b) == (b"X", b"Y")
+
+    def test_negative_context(self, make_file):
+        a = make_file("a.bin", b"x")
+        with pytest.raises(ValueError, match="context"):
+            komparu.first_difference(str(a), str(a), context=-1)
+
+
+def _loop_device(image: Path) -> str:
+    return subprocess.check_output(
+        ["losetup", "-f", "--show", str(image)], text=True,
+    ).strip()
+
+
+class TestIncludeSlack:
+    """include_slack compares block devices over their full extent."""
+
+    def test_regular_files_unaffected(self, make_file):
+        a = make_file("a.bin", b"same")
+        b = make_file("b.bin", b"same")
+        c = make_file("c.bin", b"diff")
+        assert komparu.compare(str(a), str(b), include_slack=True) is True
+        assert komparu.compare(str(a), str(c), include_slack=True) is False
+
+    def test_compare_into_regular_sizes(self, make_file):
+        a = make_file("a.bin", b"abc")
+        b = make_file("b.bin", b"abcd")
+        out = komparu.FileDiff()
+        komparu.compare_into(str(a), str(b), out, include_slack=True)
+        assert (out.size_a, out.size_b) == (3, 4)
+
+    def test_character_device_rejected(self, make_file):
+        a = make_file("a.bin", b"")
+        with pytest.raises(FileNotFoundError, match="not a regular file"):
+            komparu.compare(str(a), os.devnull, include_slack=True)
+
+    @pytest.mark.skipif(
+        os.getuid() != 0 or shutil.which("losetup") is None,
+        reason="loop devices require root and losetup",
+    )
+    def test_block_devices_tail(self, make_file):
+        a_img = make_file("a.img", b"x" * 8192 + b"\0" * 4096)
+        b_img = make_file("b.img", b"x" * 8192 + b"\1" * 4096)
+        try:
+            a = _loop_device(a_img)
+        except subprocess.CalledProcessError:
+            pytest.skip("no free loop device")
+        try:
+            b = _loop_device(b_img)
+            try:
+                with pytest.raises(FileNotFoundError, match="not a regular file"):
+                    komparu.compare(a, b)
+                assert komparu.compare(a, a, include_slack=True) is True
+                out = komparu.FileDiff()
+                assert komparu.compare_into(a, b, out, include_slack=True) is False
+                assert out.size_a == out.size_b == 12288
+                assert out.first_diff_offset == 8192
+            finally:
+                subprocess.call(["losetup", "-d", b])
+        finally:
+            subprocess.call(["losetup", "-d", a])
+
+
+_SPARSE_SIZE = 32 * 1024 * 1024
+
+
+def _sparse(path: Path, extents: dict[int, bytes], size: int = _SPARSE_SIZE) -> Path:
+    """Write a file of *size* bytes holding data only at *extents*."""
+    with open(path, "wb") as f:
+        f.truncate(size)
+        for offset, data in extents.items():
+            f.seek(offset)
+            f.write(data)
+    if os.stat(path).st_blocks * 512 >= size:
+        pytest.skip("filesystem does not create sparse files")
+    return path
+
+
+class TestSparseFiles:
+    """Holes both sparse files share are skipped; content still decides."""
+
+    def teardown_method(self):
+        reset_config()
+
+    def test_shared_holes_not_read(self, tmp_path):
+        extents = {1 << 20: b"a" * 4096, 20 << 20: b"b" * 8192}
+        for side in ("a", "b"):
+            (tmp_path / side).mkdir()
+            _sparse(tmp_path / side / "disk.img", extents)
+        assert komparu.compare(str(tmp_path / "a/disk.img"), str(tmp_path / "b/disk.img")) is True
+        summary = komparu.compare_dir_summary(str(tmp_path / "a"), str(tmp_path / "b"))
+        assert summary.equal is True
+        assert 2 * 12288 <= summary.bytes_read < _SPARSE_SIZE
+
+    def test_skip_holes_off(self, tmp_path):
+        for side in ("a", "b"):
+            (tmp_path / side).mkdir()
+            _sparse(tmp_path / side / "disk.img", {5: b"x"})
+        komparu.configure(skip_holes=False)
+        summary = komparu.compare_dir_summary(str(tmp_path / "a"), str(tmp_path / "b"),
+                                              quick_check=False)
+        assert summary.equal is True
+        assert summary.bytes_read == 2 * _SPARSE_SIZE
+
+    def test_difference_in_data(self, tmp_path):
+        a = _sparse(tmp_path / "a.img", {1 << 20: b"a" * 4096, 30 << 20: b"tail"})
+        b = _sparse(tmp_path / "b.img", {1 << 20: b"a" * 4096, 30 << 20: b"tall"})
+        assert komparu.compare(str(a), str(b)) is False
+        assert komparu.compare(str(a), str(b), quick_check=False) is False
+
+    def test_data_in_other_sides_hole(self, tmp_path):
+        a = _sparse(tmp_path / "a.img", {1 << 20: b"a" * 4096})
+        b = _sparse(tmp_path / "b.img", {1 << 20: b"a" * 4096, 9 << 20: b"\1"})
+        assert komparu.compare(str(a), str(b)) is False
+        assert komparu.compare(str(b), str(a)) is False
+
+    def test_written_zeros_equal_hole(self, tmp_path):
+        a = _sparse(tmp_path / "a.img", {4 << 20: b"x" * 4096})
+        b = _sparse(tmp_path / "b.img", {4 << 20: b"x" * 4096, 8 << 20: b"\0" * 65536})
+        assert komparu.compare(str(a), str(b)) is True
+        assert komparu.compare(str(b), str(a)) is True
+
+    def test_sparse_against_dense(self, tmp_path):
+        a = _sparse(tmp_path / "a.img", {5: b"data"}, size=1 << 20)
+        dense = tmp_path / "dense.img"
+        dense.write_bytes(a.read_bytes())
+        assert komparu.compare(str(a), str(dense)) is True
+        dense.write_bytes(a.read_bytes()[:-1] + b"\1")
+        assert komparu.compare(str(a), str(dense)) is False
+
+
 class TestUnicodeFilePaths:
     """File comparison with Unicode characters in file names."""
 
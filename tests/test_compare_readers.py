@@ -0,0 +1,126 @@
+"""Tests for comparing already-open binary streams."""
+
+from __future__ import annotations
+
+import io
+import os
+
+import pytest
+
+import komparu
+
+
+class _Trickle(io.RawIOBase):
+    """Stream that returns at most 7 bytes per read and counts reads."""
+
+    def __init__(self, data: bytes) -> None:
+        self._buf = io.BytesIO(data)
+        self.reads = 0
+
+    def readable(self) -> bool:
+        return True
+
+    def read(self, n: int = -1) -> bytes:
+        self.reads += 1
+        return self._buf.read(min(n, 7) if n >= 0 else 7)
+
+
+class TestCompareReaders:
+    """compare_readers with and without declared sizes."""
+
+    def test_equal(self):
+        data = os.urandom(100_000)
+        assert komparu.compare_readers(io.BytesIO(data), io.BytesIO(data)) is True
+
+    def test_different(self):
+        a = io.BytesIO(b"hello world")
+        b = io.BytesIO(b"hello there")
+        assert komparu.compare_readers(a, b) is False
+
+    def test_prefix_differs(self):
+        a = io.BytesIO(b"abc")
+        b = io.BytesIO(b"abcd")
+        assert komparu.compare_readers(a, b) is False
+
+    def test_short_reads(self):
+        data = os.urandom(5000)
+        a = _Trickle(data)
+        assert komparu.compare_readers(a, io.BytesIO(data), chunk_size=1024) is True
+
+    def test_size_mismatch_consumes_nothing(self):
+        a = _Trickle(b"x" * 100)
+        b = _Trickle(b"x" * 100)
+        assert komparu.compare_readers(a, b, size_a=100, size_b=99) is False
+        assert a.reads == 0 and b.reads == 0
+
+    def test_equal_sizes_still_compare_content(self):
+        a = io.BytesIO(b"aaaa")
+        b = io.BytesIO(b"aaab")
+        assert komparu.compare_readers(a, b, size_a=4, size_b=4) is False
+
+    def test_one_size_only(self):
+        a = io.BytesIO(b"same")
+        b = io.BytesIO(b"same")
+        assert komparu.compare_readers(a, b, size_a=4) is True
+
+    def test_negative_size(self):
+        with pytest.raises(ValueError, match="size_b"):
+            komparu.compare_readers(io.BytesIO(), io.BytesIO(), size_b=-1)
+
+
+class TestBuffers:
+    """Bytes-like objects are compared in place of streams."""
+
+    def test_bytes_against_stream(self):
+        data = os.urandom(10_000)
+        assert komparu.compare_readers(data, io.BytesIO(data), chunk_size=1000) is True
+        assert komparu.compare_readers(io.BytesIO(data), data[:-1] + b"!") is False
+
+    def test_bytearray_and_memoryview(self):
+        data = bytearray(b"payload" * 100)
+        assert komparu.compare_readers(data, memoryview(bytes(data))) is True
+
+    def test_wide_memoryview_compared_as_bytes(self):
+        view = memoryview(bytearray(b"\1\0\2\0")).cast("H")
+        assert komparu.compare_readers(view, b"\1\0\2\0") is True
+
+    def test_length_is_declared_size(self):
+        stream = _Trickle(b"x" * 100)
+        assert komparu.compare_readers(b"x" * 99, stream, size_b=100) is False
+        assert stream.reads == 0
+
+    def test_empty(self):
+        assert komparu.compare_readers(b"", io.BytesIO()) is True
+
+
+class TestSizePrecheck:
+    """size_precheck measures streams that have no declared length."""
+
+    def test_seekable_mismatch_consumes_nothing(self):
+        a = io.BytesIO(b"abc")
+        b = io.BytesIO(b"abcd")
+        assert komparu.compare_readers(a, b, size_precheck=True) is False
+        assert a.tell() == 0 and b.tell() == 0
+
+    def test_measured_from_current_position(self):
+        a = io.BytesIO(b"skip-same")
+        a.seek(5)
+        assert komparu.compare_readers(a, b"same", size_precheck=True) is True
+
+    def test_regular_file(self, make_file):
+        path = make_file("a.bin", b"12345")
+        with open(path, "rb") as f:
+            assert komparu.compare_readers(f, b"1234", size_precheck=True) is False
+            assert f.tell() == 0
+
+    def test_unseekable_stream_still_compared(self):
+        a = _Trickle(b"same")
+        assert komparu.compare_readers(a, b"same", size_precheck=True) is True
+        assert a.reads > 0
+
+    def test_pipe(self):
+        r, w = os.pipe()
+        os.write(w, b"data")
+        os.close(w)
+        with open(r, "rb", buffering=0) as f:
+            assert komparu.compare_readers(f, b"data", size_precheck=True) is True
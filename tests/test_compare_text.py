@@ -0,0 +1,469 @@
+"""Tests for line-oriented text comparison."""
+
+from __future__ import annotations
+
+import csv
+
+import pytest
+
+import komparu
+from komparu import DecodeError
+
+GENERATED = [r"^// Generated at .*"]
+
+
+class TestCompareText:
+    """Plain line-by-line comparison."""
+
+    def test_identical(self, make_file):
+        a = make_file("a.txt", b"one\ntwo\n")
+        b = make_file("b.txt", b"one\ntwo\n")
+        assert komparu.compare_text(str(a), str(b)) is True
+
+    def test_different_line(self, make_file):
+        a = make_file("a.txt", b"one\ntwo\n")
+        b = make_file("b.txt", b"one\nTWO\n")
+        assert komparu.compare_text(str(a), str(b)) is False
+
+    def test_extra_line(self, make_file):
+        a = make_file("a.txt", b"one\n")
+        b = make_file("b.txt", b"one\ntwo\n")
+        assert komparu.compare_text(str(a), str(b)) is False
+        assert komparu.compare_text(str(b), str(a)) is False
+
+    def test_line_terminators_compared(self, make_file):
+        a = make_file("a.txt", b"one\r\ntwo\r\n")
+        b = make_file("b.txt", b"one\ntwo\n")
+        assert komparu.compare_text(str(a), str(b)) is False
+
+    def test_empty_files(self, make_file):
+        a = make_file("a.txt", b"")
+        b = make_file("b.txt", b"")
+        assert komparu.compare_text(str(a), str(b)) is True
+
+    def test_invalid_encoding(self, make_file):
+        a = make_file("a.txt", b"\xff\xfe bad\n")
+        b = make_file("b.txt", b"ok\n")
+        with pytest.raises(DecodeError):
+            komparu.compare_text(str(a), str(b))
+
+    def test_missing_file(self, make_file, tmp_path):
+        a = make_file("a.txt", b"x\n")
+        with pytest.raises(FileNotFoundError):
+            komparu.compare_text(str(a), str(tmp_path / "nope.txt"))
+
+
+class TestSideEncodings:
+    """encoding_a / encoding_b decode each file separately."""
+
+    TEXT = "naïve café\nЖ line two\n"
+
+    def test_utf8_vs_utf16le(self, make_file):
+        a = make_file("a.txt", self.TEXT.encode("utf-8"))
+        b = make_file("b.txt", self.TEXT.encode("utf-16-le"))
+        with pytest.raises(DecodeError):
+            komparu.compare_text(str(a), str(b))
+        assert komparu.compare_text(str(a), str(b), encoding_b="utf-16le") is True
+
+    def test_utf16be_vs_latin1(self, make_file):
+        text = "naïve café\n"
+        a = make_file("a.txt", text.encode("utf-16-be"))
+        b = make_file("b.txt", text.encode("latin-1"))
+        assert komparu.compare_text(
+            str(a), str(b), encoding_a="utf-16be", encoding_b="latin1",
+        ) is True
+
+    def test_encoding_is_default_for_both(self, make_file):
+        a = make_file("a.txt", "x é\n".encode("latin-1"))
+        b = make_file("b.txt", "x é\n".encode("utf-8"))
+        assert komparu.compare_text(str(a), str(b), encoding="latin1", encoding_b="utf-8") is True
+
+    def test_different_text(self, make_file):
+        a = make_file("a.txt", "one\n".encode("utf-8"))
+        b = make_file("b.txt", "two\n".encode("utf-16-le"))
+        assert komparu.compare_text(str(a), str(b), encoding_b="utf-16le") is False
+
+    def test_lines_position_in_characters(self, make_file):
+        a = make_file("a.txt", "ж ok\nжжX\n".encode("utf-8"))
+        b = make_file("b.txt", "ж ok\nжжY\n".encode("utf-16-le"))
+        pos = komparu.compare_text_lines(str(a), str(b), encoding_b="utf-16le")
+        assert (pos.line, pos.column) == (2, 3)
+
+    def test_unordered_and_tokens(self, make_file):
+        a = make_file("a.csv", "b,ж\na,1\n".encode("utf-8"))
+        b = make_file("b.csv", "a,1\nb,ж\n".encode("utf-16-be"))
+        assert komparu.compare_text_unordered(str(a), str(b), encoding_b="utf-16be").equal
+        c = make_file("c.csv", "b,ж\na,1\n".encode("utf-16-be"))
+        assert komparu.compare_tokens(str(a), str(c), csv_fields, encoding_b="utf-16be").equal
+
+    def test_decode_error_names_file(self, make_file):
+        a = make_file("a.txt", b"ok\n")
+        b = make_file("b.txt", b"\x00d\x00")  # odd length: truncated UTF-16
+        with pytest.raises(DecodeError, match="b.txt"):
+            komparu.compare_text(str(a), str(b), encoding_b="utf-16le")
+
+    def test_unknown_encoding(self, make_file):
+        a = make_file("a.txt", b"ok\n")
+        with pytest.raises(ValueError, match="unknown encoding"):
+            komparu.compare_text(str(a), str(a), encoding_a="no-such-codec")
+
+
+class TestIgnoreLinePatterns:
+    """ignore_line_patterns skips lines matching on both sides."""
+
+    def test_both_sides_match(self, make_file):
+        a = make_file("a.c", b"// Generated at 2024-01-01\nint x;\n")
+        b = make_file("b.c", b"// Generated at 2025-06-30\nint x;\n")
+        assert komparu.compare_text(str(a), str(b)) is False
+        assert komparu.compare_text(
+            str(a), str(b), ignore_line_patterns=GENERATED,
+        ) is True
+
+    def test_one_side_matches(self, make_file):
+        a = make_file("a.c", b"// Generated at 2024-01-01\nint x;\n")
+        b = make_file("b.c", b"// hand written\nint x;\n")
+        assert komparu.compare_text(
+            str(a), str(b), ignore_line_patterns=GENERATED,
+        ) is False
+
+    def test_other_lines_still_compared(self, make_file):
+        a = make_file("a.c", b"// Generated at 1\nint x;\n")
+        b = make_file("b.c", b"// Generated at 2\nint y;\n")
+        assert komparu.compare_text(
+            str(a), str(b), ignore_line_patterns=GENERATED,
+        ) is False
+
+    def test_multiple_patterns(self, make_file):
+        a = make_file("a.txt", b"version: 1.0\nbuilt: mon\nbody\n")
+        b = make_file("b.txt", b"version: 2.0\nbuilt: tue\nbody\n")
+        assert komparu.compare_text(
+            str(a), str(b), ignore_line_patterns=[r"^version:", r"^built:"],
+        ) is True
+
+    def test_pattern_does_not_see_terminator(self, make_file):
+        a = make_file("a.txt", b"stamp 1\r\n")
+        b = make_file("b.txt", b"stamp 2\n")
+        assert komparu.compare_text(
+            str(a), str(b), ignore_line_patterns=[r"^stamp \d$"],
+        ) is True
+
+    def test_invalid_regex(self, make_file):
+        a = make_file("a.txt", b"x\n")
+        with pytest.raises(ValueError, match="ignore_line_patterns"):
+            komparu.compare_text(str(a), str(a), ignore_line_patterns=["("])
+
+
+class TestStripPrologue:
+    """strip_prologue drops a leading header from each file on its own."""
+
+    def test_regex_different_lengths(self, make_file):
+        a = make_file("a.py", b"# Copyright 2023 A\n# MIT\nx = 1\n")
+        b = make_file("b.py", b"# Copyright 2025 B\n# Apache-2.0\n# see LICENSE\nx = 1\n")
+        assert komparu.compare_text(str(a), str(b)) is False
+        assert komparu.compare_text(str(a), str(b), strip_prologue=r"^#") is True
+
+    def test_regex_body_still_compared(self, make_file):
+        a = make_file("a.py", b"# A\nx = 1\n")
+        b = make_file("b.py", b"# B\nx = 2\n")
+        assert komparu.compare_text(str(a), str(b), strip_prologue=r"^#") is False
+
+    def test_regex_only_leading_lines(self, make_file):
+        a = make_file("a.py", b"# A\nx = 1\n# tail 1\n")
+        b = make_file("b.py", b"x = 1\n# tail 2\n")
+        assert komparu.compare_text(str(a), str(b), strip_prologue=r"^#") is False
+
+    def test_line_count(self, make_file):
+        a = make_file("a.c", b"/* v1 */\n/* gen */\nint x;\n")
+        b = make_file("b.c", b"/* v2 */\n/* tpl */\nint x;\n")
+        assert komparu.compare_text(str(a), str(b), strip_prologue=2) is True
+        assert komparu.compare_text(str(a), str(b), strip_prologue=1) is False
+
+    def test_whole_file_prologue(self, make_file):
+        a = make_file("a.txt", b"# only\n")
+        b = make_file("b.txt", b"")
+        assert komparu.compare_text(str(a), str(b), strip_prologue=r"^#") is True
+
+    def test_combined_with_ignore_patterns(self, make_file):
+        a = make_file("a.c", b"// (c) A\n// Generated at 1\nint x;\n")
+        b = make_file("b.c", b"/* (c) B */\n// Generated at 2\nint x;\n")
+        assert komparu.compare_text(
+            str(a), str(b), strip_prologue=1, ignore_line_patterns=GENERATED,
+        ) is True
+
+    def test_invalid(self, make_file):
+        a = make_file("a.txt", b"x\n")
+        with pytest.raises(ValueError, match="strip_prologue"):
+            komparu.compare_text(str(a), str(a), strip_prologue="(")
+        with pytest.raises(ValueError, match="non-negative"):
+            komparu.compare_text(str(a), str(a), strip_prologue=-1)
+        with pytest.raises(TypeError, match="strip_prologue"):
+            komparu.compare_text(str(a), str(a), strip_prologue=True)
+
+
+class TestIgnoreFinalNewline:
+    """ignore_final_newline forgives only a trailing newline on one side."""
+
+    def _cmp(self, make_file, a: bytes, b: bytes) -> bool:
+        fa, fb = make_file("a.txt", a), make_file("b.txt", b)
+        forward = komparu.compare_text(str(fa), str(fb), ignore_final_newline=True)
+        assert komparu.compare_text(str(fb), str(fa), ignore_final_newline=True) is forward
+        return forward
+
+    def test_off_by_default(self, make_file):
+        a = make_file("a.txt", b"one\ntwo\n")
+        b = make_file("b.txt", b"one\ntwo")
+        assert komparu.compare_text(str(a), str(b)) is False
+
+    def test_lf(self, make_file):
+        assert self._cmp(make_file, b"one\ntwo\n", b"one\ntwo") is True
+
+    def test_crlf(self, make_file):
+        assert self._cmp(make_file, b"one\r\ntwo\r\n", b"one\r\ntwo") is True
+        assert self._cmp(make_file, b"x\r", b"x\r\n") is True
+
+    def test_empty_versus_newline(self, make_file):
+        assert self._cmp(make_file, b"", b"\n") is True
+        assert self._cmp(make_file, b"x\n", b"x\n\n") is True
+
+    def test_only_one_newline(self, make_file):
+        assert self._cmp(make_file, b"x", b"x\n\n") is False
+        assert self._cmp(make_file, b"x\n", b"x\n\n\n") is False
+
+    def test_terminator_kind_still_compared(self, make_file):
+        assert self._cmp(make_file, b"x\r\n", b"x\n") is False
+
+    def test_other_differences_still_count(self, make_file):
+        assert self._cmp(make_file, b"one\ntwo\n", b"one\nTWO") is False
+        assert self._cmp(make_file, b"one\n", b"one") is True
+        assert self._cmp(make_file, b"one\nx", b"one\ny\n") is False
+
+    def test_with_ignore_patterns(self, make_file):
+        a = make_file("a.txt", b"# at 10:00\nbody\n")
+        b = make_file("b.txt", b"# at 11:00\nbody")
+        assert komparu.compare_text(
+            str(a), str(b), ignore_line_patterns=[r"^# at"], ignore_final_newline=True,
+        ) is True
+
+
+class TestCompareTextLines:
+    """compare_text_lines reports the first differing line and column."""
+
+    def test_equal(self, make_file):
+        a = make_file("a.py", b"x = 1\ny = 2\n")
+        b = make_file("b.py", b"x = 1\ny = 2\n")
+        assert komparu.compare_text_lines(str(a), str(b)) == komparu.TextPosition(True)
+
+    def test_line_and_column(self, make_file):
+        a = make_file("a.py", b"import os\nx = compute(1)\n")
+        b = make_file("b.py", b"import os\nx = compute(2)\n")
+        pos = komparu.compare_text_lines(str(a), str(b))
+        assert (pos.equal, pos.line, pos.column) == (False, 2, 13)
+
+    def test_first_char(self, make_file):
+        a = make_file("a", b"abc")
+        b = make_file("b", b"xbc")
+        pos = komparu.compare_text_lines(str(a), str(b))
+        assert (pos.line, pos.column) == (1, 1)
+
+    def test_longer_file(self, make_file):
+        a = make_file("a", b"one\ntwo\n")
+        b = make_file("b", b"one\ntwo\nthree\n")
+        pos = komparu.compare_text_lines(str(a), str(b))
+        assert (pos.line, pos.column) == (3, 1)
+
+    def test_missing_final_newline(self, make_file):
+        a = make_file("a", b"one\ntwo")
+        b = make_file("b", b"one\ntwo\n")
+        pos = komparu.compare_text_lines(str(b), str(a))
+        assert (pos.line, pos.column) == (2, 4)
+
+    def test_crlf_is_content(self, make_file):
+        a = make_file("a", b"one\r\ntwo\n")
+        b = make_file("b", b"one\ntwo\n")
+        pos = komparu.compare_text_lines(str(a), str(b))
+        assert (pos.line, pos.column) == (1, 4)
+
+    def test_column_counts_characters(self, make_file):
+        a = make_file("a", "привет мир\n".encode())
+        b = make_file("b", "привет миф\n".encode())
+        pos = komparu.compare_text_lines(str(a), str(b))
+        assert (pos.line, pos.column) == (1, 10)
+
+    def test_invalid_encoding(self, make_file):
+        a = make_file("a", b"\xff\xfe")
+        b = make_file("b", b"ok")
+        with pytest.raises(DecodeError):
+            komparu.compare_text_lines(str(a), str(b))
+
+
+CONFLICT = (
+    b"def f():\n"
+    b"<<<<<<< HEAD\n"
+    b"    return 1\n"
+    b"=======\n"
+    b"    return 2\n"
+    b">>>>>>> feature\n"
+)
+
+
+class TestConflictMarkers:
+    """detect_conflicts reports merge markers as a distinct outcome."""
+
+    def test_conflict_detected(self, make_file):
+        a = make_file("a.py", b"def f():\n    return 1\n")
+        b = make_file("b.py", CONFLICT)
+        pos = komparu.compare_text_lines(str(a), str(b), detect_conflicts=True)
+        assert pos.conflict is True
+        assert pos.equal is False
+        assert pos.conflicts_a == ()
+        assert pos.conflicts_b == (2, 4, 6)
+        assert pos.line is None
+
+    def test_identical_conflicted_files_not_equal(self, make_file):
+        a = make_file("a.py", CONFLICT)
+        b = make_file("b.py", CONFLICT)
+        pos = komparu.compare_text_lines(str(a), str(b), detect_conflicts=True)
+        assert (pos.equal, pos.conflicts_a) == (False, (2, 4, 6))
+
+    def test_diff3_base_marker(self, make_file):
+        text = b"<<<<<<< ours\nx\n||||||| base\ny\n=======\nz\n>>>>>>> theirs\n"
+        a = make_file("a", text)
+        b = make_file("b", b"x\n")
+        pos = komparu.compare_text_lines(str(a), str(b), detect_conflicts=True)
+        assert pos.conflicts_a == (1, 3, 5, 7)
+
+    def test_lone_separator_ignored(self, make_file):
+        text = b"Title\n=======\n\nbody\n"
+        a = make_file("a.rst", text)
+        b = make_file("b.rst", text)
+        pos = komparu.compare_text_lines(str(a), str(b), detect_conflicts=True)
+        assert pos.equal is True
+        assert pos.conflict is False
+
+    def test_unterminated_block_ignored(self, make_file):
+        a = make_file("a", b"<<<<<<< HEAD\nx\n=======\ny\n")
+        b = make_file("b", b"x\n")
+        pos = komparu.compare_text_lines(str(a), str(b), detect_conflicts=True)
+        assert pos.conflict is False
+        assert pos.line == 1
+
+    def test_off_by_default(self, make_file):
+        a = make_file("a.py", CONFLICT)
+        b = make_file("b.py", CONFLICT)
+        assert komparu.compare_text_lines(str(a), str(b)).equal is True
+
+
+class TestCompareTextUnordered:
+    """compare_text_unordered compares the multiset of lines."""
+
+    def test_reordered_equal(self, make_file):
+        a = make_file("a.txt", b"alice\nbob\ncarol\n")
+        b = make_file("b.txt", b"carol\nalice\nbob\n")
+        assert komparu.compare_text_unordered(str(a), str(b)) == komparu.LineSetDiff(True)
+
+    def test_only_left_and_right(self, make_file):
+        a = make_file("a.txt", b"alice\nbob\n")
+        b = make_file("b.txt", b"bob\ndave\n")
+        result = komparu.compare_text_unordered(str(a), str(b))
+        assert result.equal is False
+        assert result.only_left == ["alice"]
+        assert result.only_right == ["dave"]
+
+    def test_duplicates_are_counted(self, make_file):
+        a = make_file("a.txt", b"x\nx\ny\n")
+        b = make_file("b.txt", b"y\nx\n")
+        result = komparu.compare_text_unordered(str(a), str(b))
+        assert result.only_left == ["x"]
+        assert result.only_right == []
+
+    def test_missing_final_newline(self, make_file):
+        a = make_file("a.txt", b"one\ntwo\n")
+        b = make_file("b.txt", b"two\none")
+        assert komparu.compare_text_unordered(str(a), str(b)).equal is True
+
+    def test_crlf_equals_lf(self, make_file):
+        a = make_file("a.txt", b"one\r\ntwo\r\n")
+        b = make_file("b.txt", b"two\none\n")
+        assert komparu.compare_text_unordered(str(a), str(b)).equal is True
+
+    def test_empty_files(self, make_file):
+        a = make_file("a.txt", b"")
+        b = make_file("b.txt", b"")
+        assert komparu.compare_text_unordered(str(a), str(b)).equal is True
+
+    def test_many_lines(self, make_file):
+        lines = [f"entry-{i}".encode() for i in range(20_000)]
+        a = make_file("a.txt", b"\n".join(lines) + b"\n")
+        b = make_file("b.txt", b"\n".join(reversed(lines)) + b"\n")
+        assert komparu.compare_text_unordered(str(a), str(b)).equal is True
+
+    def test_invalid_encoding(self, make_file):
+        a = make_file("a.txt", b"\xff\n")
+        b = make_file("b.txt", b"x\n")
+        with pytest.raises(komparu.DecodeError):
+            komparu.compare_text_unordered(str(a), str(b))
+
+
+def csv_fields(stream):
+    """Fields with (row, column); spaces after a delimiter are dropped."""
+    for row, fields in enumerate(csv.reader(stream, skipinitialspace=True), 1):
+        for col, value in enumerate(fields, 1):
+            yield value, (row, col)
+
+
+class TestCompareTokens:
+    """compare_tokens compares the token streams of a tokenizer."""
+
+    def test_whitespace_outside_quotes_ignored(self, make_file):
+        a = make_file("a.csv", b'id,name\r\n1,"Ada  Lovelace"\r\n')
+        b = make_file("b.csv", b'id, name\n1,   "Ada  Lovelace"\n')
+        assert komparu.compare_tokens(str(a), str(b), csv_fields) == komparu.TokenDiff(True)
+
+    def test_quoted_content_compared_exactly(self, make_file):
+        a = make_file("a.csv", b'id,name\n1,"Ada  Lovelace"\n')
+        b = make_file("b.csv", b'id,name\n1,"Ada Lovelace"\n')
+        diff = komparu.compare_tokens(str(a), str(b), csv_fields)
+        assert diff == komparu.TokenDiff(
+            equal=False, index=3,
+            token_a="Ada  Lovelace", token_b="Ada Lovelace",
+            position_a=(2, 2), position_b=(2, 2),
+        )
+
+    def test_stream_ends_early(self, make_file):
+        a = make_file("a.csv", b"x,y\n")
+        b = make_file("b.csv", b"x,y,z\n")
+        diff = komparu.compare_tokens(str(a), str(b), csv_fields)
+        assert diff.index == 2
+        assert diff.token_a is None
+        assert diff.position_a is None
+        assert diff.token_b == "z"
+        assert diff.position_b == (1, 3)
+
+    def test_bare_tokens(self, make_file):
+        a = make_file("a.txt", b"alpha beta\ngamma")
+        b = make_file("b.txt", b"alpha\n\tbeta   delta")
+        diff = komparu.compare_tokens(str(a), str(b), lambda f: f.read().split())
+        assert diff.index == 2
+        assert (diff.token_a, diff.token_b) == ("gamma", "delta")
+        assert diff.position_a is None
+
+    def test_empty_files(self, make_file):
+        a = make_file("a.csv", b"")
+        b = make_file("b.csv", b"")
+        assert komparu.compare_tokens(str(a), str(b), csv_fields).equal is True
+
+    def test_invalid_encoding(self, make_file):
+        a = make_file("a.csv", b"\xff\n")
+        b = make_file("b.csv", b"x\n")
+        with pytest.raises(DecodeError, match="a.csv"):
+            komparu.compare_tokens(str(a), str(b), csv_fields)
+
+    def test_tokenizer_error_propagates(self, make_file):
+        a = make_file("a.csv", b"x\n")
+
+        def broken(stream):
+            raise RuntimeError("bad tokenizer")
+            yield
+
+        with pytest.raises(RuntimeError, match="bad tokenizer"):
+            komparu.compare_tokens(str(a), str(a), broken)
@@ -2,10 +2,12 @@
 
 from __future__ import annotations
 
+import logging
+
 import pytest
 
 import komparu
-from komparu._config import get_config, reset_config
+from komparu._config import get_config, get_logger, reset_config
 
 
 class TestConfigure:
@@ -24,6 +26,7 @@ class TestConfigure:
         assert cfg.follow_redirects is True
         assert cfg.verify_ssl is True
         assert cfg.size_precheck is True
+        assert cfg.skip_holes is True
         assert cfg.max_decompressed_size == 1 * 1024**3
         assert cfg.max_compression_ratio == 200
         assert cfg.max_archive_entries == 100_000
@@ -55,3 +58,85 @@ class TestConfigure:
         komparu.configure(chunk_size=999)
         reset_config()
         assert get_config().chunk_size == 65536
+
+
+class _ListHandler(logging.Handler):
+    def __init__(self) -> None:
+        super().__init__(logging.DEBUG)
+        self.messages: list[str] = []
+
+    def emit(self, record: logging.LogRecord) -> None:
+        self.messages.append(record.getMessage())
+
+
+class TestLogger:
+
+    def setup_method(self):
+        reset_config()
+        self.handler = _ListHandler()
+        self.logger = logging.getLogger("test.komparu.hooks")
+        self.logger.setLevel(logging.DEBUG)
+        self.logger.propagate = False
+        self.logger.addHandler(self.handler)
+
+    def teardown_method(self):
+        self.logger.removeHandler(self.handler)
+        reset_config()
+
+    def test_default_is_library_logger(self):
+        log = get_logger()
+        assert log.name == "komparu"
+        assert any(isinstance(h, logging.NullHandler) for h in log.handlers)
+
+    def test_configured_logger_used(self):
+        komparu.configure(logger=self.logger)
+        assert get_logger() is self.logger
+
+    def test_compare_events(self, make_file):
+        komparu.configure(logger=self.logger)
+        a = make_file("a.bin", b"same")
+        b = make_file("b.bin", b"same")
+        komparu.compare(str(a), str(b))
+        assert any("equal=True" in m for m in self.handler.messages)
+
+    def test_compare_into_reports_io_path(self, make_file):
+        komparu.configure(logger=self.logger)
+        a = make_file("a.bin", b"x" * 100)
+        b = make_file("b.bin", b"x" * 100)
+        komparu.compare_into(str(a), str(b), komparu.FileDiff())
+        assert any("io_a=" in m for m in self.handler.messages)
+
+    def test_compare_dir_events(self, tmp_path):
+        komparu.configure(logger=self.logger)
+        (tmp_path / "a").mkdir()
+        (tmp_path / "b").mkdir()
+        (tmp_path / "a" / "f").write_bytes(b"1")
+        (tmp_path / "b" / "f").write_bytes(b"2")
+        komparu.compare_dir(str(tmp_path / "a"), str(tmp_path / "b"))
+        assert any("1 differ" in m for m in self.handler.messages)
+
+    def test_lock_failure_logged(self, make_file):
+        from komparu import _helpers
+
+        class _NoLocks:
+            LOCK_SH = 1
+
+            @staticmethod
+            def flock(fd, op):
+                raise OSError(37, "No locks available")
+
+        komparu.configure(logger=self.logger)
+        a = make_file("a.bin", b"x")
+        saved = _helpers.fcntl
+        _helpers.fcntl = _NoLocks
+        try:
+            assert komparu.compare(str(a), str(a), lock_files=True) is True
+        finally:
+            _helpers.fcntl = saved
+        assert any("cannot lock" in m and "No locks available" in m
+                   for m in self.handler.messages)
+
+    def test_reset_restores_default(self):
+        komparu.configure(logger=self.logger)
+        reset_config()
+        assert get_logger().name == "komparu"
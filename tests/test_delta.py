@@ -0,0 +1,101 @@
+"""Tests for delta streams of differing chunks."""
+
+from __future__ import annotations
+
+import io
+import os
+import shutil
+import struct
+
+import pytest
+
+import komparu
+
+
+def _records(stream) -> list[tuple[int, bytes]]:
+    out = []
+    while True:
+        offset, length = struct.unpack(">QI", stream.read(12))
+        if length == 0:
+            out.append((offset, b""))
+            return out
+        out.append((offset, stream.read(length)))
+
+
+def _roundtrip(make_file, a: bytes, b: bytes, chunk_size: int) -> bytes:
+    pa = make_file("a.bin", a)
+    pb = make_file("b.bin", b)
+    patched = pa.with_name("patched.bin")
+    shutil.copyfile(pa, patched)
+    with komparu.delta_reader(str(pa), str(pb), chunk_size=chunk_size) as delta:
+        komparu.apply_delta(str(patched), delta)
+    return patched.read_bytes()
+
+
+class TestDeltaReader:
+    """delta_reader streams framed records of the chunks that differ."""
+
+    def test_identical_only_end_record(self, make_file):
+        a = make_file("a.bin", b"same content")
+        b = make_file("b.bin", b"same content")
+        with komparu.delta_reader(str(a), str(b), chunk_size=4) as delta:
+            assert _records(delta) == [(12, b"")]
+            assert delta.read() == b""
+
+    def test_changed_chunks(self, make_file):
+        a = make_file("a.bin", b"aaaabbbbccccdddd")
+        b = make_file("b.bin", b"aaaaBBBBccccDDDD")
+        with komparu.delta_reader(str(a), str(b), chunk_size=4) as delta:
+            assert _records(delta) == [(4, b"BBBB"), (12, b"DDDD"), (16, b"")]
+
+    def test_b_longer(self, make_file):
+        a = make_file("a.bin", b"abcd")
+        b = make_file("b.bin", b"abcdefghij")
+        with komparu.delta_reader(str(a), str(b), chunk_size=4) as delta:
+            assert _records(delta) == [(4, b"efgh"), (8, b"ij"), (10, b"")]
+
+    def test_b_shorter(self, make_file):
+        a = make_file("a.bin", b"abcdefgh")
+        b = make_file("b.bin", b"abcdef")
+        with komparu.delta_reader(str(a), str(b), chunk_size=4) as delta:
+            assert _records(delta) == [(4, b"ef"), (6, b"")]
+
+    def test_small_reads(self, make_file):
+        a = make_file("a.bin", b"x" * 100)
+        b = make_file("b.bin", b"x" * 50 + b"y" * 50)
+        with komparu.delta_reader(str(a), str(b), chunk_size=32) as delta:
+            raw = b"".join(iter(lambda: delta.read(5), b""))
+        assert _records(io.BytesIO(raw))[-1] == (100, b"")
+
+    def test_missing_file(self, make_file, tmp_path):
+        a = make_file("a.bin", b"x")
+        with pytest.raises(FileNotFoundError):
+            komparu.delta_reader(str(a), str(tmp_path / "missing"))
+
+    def test_invalid_chunk_size(self, make_file):
+        a = make_file("a.bin", b"x")
+        with pytest.raises(ValueError, match="chunk_size"):
+            komparu.delta_reader(str(a), str(a), chunk_size=0)
+
+
+class TestApplyDelta:
+    """apply_delta turns a copy of A into B."""
+
+    def test_roundtrip_random(self, make_file):
+        a = os.urandom(300_000)
+        b = bytearray(a)
+        b[1000:1010] = b"\x00" * 10
+        b[250_000] ^= 0xFF
+        b += os.urandom(1234)
+        assert _roundtrip(make_file, a, bytes(b), 4096) == bytes(b)
+
+    def test_roundtrip_truncate(self, make_file):
+        assert _roundtrip(make_file, b"0123456789", b"0123", 4) == b"0123"
+
+    def test_roundtrip_empty_b(self, make_file):
+        assert _roundtrip(make_file, b"data", b"", 4) == b""
+
+    def test_truncated_stream(self, make_file):
+        target = make_file("t.bin", b"abcd")
+        with pytest.raises(ValueError, match="truncated"):
+            komparu.apply_delta(str(target), io.BytesIO(struct.pack(">QI", 0, 4) + b"ab"))
@@ -0,0 +1,297 @@
+"""Tests for comparison over virtual filesystems."""
+
+from __future__ import annotations
+
+import io
+import os
+import tarfile
+import zipfile
+from pathlib import Path
+
+import pytest
+
+import komparu
+from komparu import DiffReason
+
+
+@pytest.fixture
+def make_dir(tmp_path: Path):
+    """Create a directory tree from a dict of {relative_path: content}."""
+
+    def _make(name: str, files: dict[str, bytes]) -> Path:
+        d = tmp_path / name
+        d.mkdir(parents=True, exist_ok=True)
+        for rel, content in files.items():
+            p = d / rel
+            p.parent.mkdir(parents=True, exist_ok=True)
+            p.write_bytes(content)
+        return d
+
+    return _make
+
+
+def _make_zip(path: Path, files: dict[str, bytes]) -> Path:
+    with zipfile.ZipFile(path, "w") as zf:
+        for name, content in files.items():
+            zf.writestr(name, content)
+    return path
+
+
+def _make_tar(path: Path, files: dict[str, bytes], mode: str = "w:gz", **attrs) -> Path:
+    with tarfile.open(path, mode) as tf:
+        for name, content in files.items():
+            info = tarfile.TarInfo(name)
+            info.size = len(content)
+            for key, value in attrs.items():
+                setattr(info, key, value)
+            tf.addfile(info, io.BytesIO(content))
+    return path
+
+
+class TestMemoryFS:
+    """MemoryFS trees compare against each other and against disk."""
+
+    def test_equal(self):
+        fs = {"a.txt": b"x", "sub/b.txt": b"yy"}
+        result = komparu.compare_fs(komparu.MemoryFS(fs), komparu.MemoryFS(dict(fs)))
+        assert result.equal is True
+        assert result.diff == {}
+
+    def test_differences(self):
+        a = komparu.MemoryFS({"same": b"1", "content": b"ab", "size": b"a", "left": b""})
+        b = komparu.MemoryFS({"same": b"1", "content": b"ac", "size": b"aa", "right": b""})
+        result = komparu.compare_fs(a, b)
+        assert result.equal is False
+        assert result.diff == {
+            "content": DiffReason.CONTENT_MISMATCH,
+            "size": DiffReason.SIZE_MISMATCH,
+        }
+        assert result.only_left == {"left"}
+        assert result.only_right == {"right"}
+
+    def test_against_directory(self, make_dir):
+        d = make_dir("d", {"a.txt": b"x", "sub/b.txt": b"changed"})
+        mem = komparu.MemoryFS({"a.txt": b"x", "sub/b.txt": b"CHANGED"})
+        result = komparu.compare_fs(str(d), mem)
+        assert result.diff == {"sub/b.txt": DiffReason.CONTENT_MISMATCH}
+        result = komparu.compare_fs(komparu.OSFS(str(d)), mem)
+        assert result.diff == {"sub/b.txt": DiffReason.CONTENT_MISMATCH}
+
+    def test_small_chunks(self):
+        data = bytes(range(256)) * 40
+        a = komparu.MemoryFS({"f": data})
+        b = komparu.MemoryFS({"f": data[:-1] + b"\0"})
+        assert komparu.compare_fs(a, b, chunk_size=7).diff == {"f": DiffReason.CONTENT_MISMATCH}
+
+    def test_filters(self):
+        a = komparu.MemoryFS({"keep.txt": b"1", "x.log": b"1", "deep/er/f": b"1"})
+        b = komparu.MemoryFS({"keep.txt": b"1", "x.log": b"2", "deep/er/f": b"2"})
+        assert komparu.compare_fs(a, b, ignore=["*.log"], max_depth=1).equal is True
+        assert komparu.compare_fs(a, b, exclude=["*.log", "deep/"]).equal is True
+        result = komparu.compare_fs(a, b, include=["*.log"])
+        assert result.diff == {"x.log": DiffReason.CONTENT_MISMATCH}
+
+
+class TestZipFS:
+    """A zip archive opened with zipfile is a tree like any other."""
+
+    def test_zip_against_directory(self, make_dir, tmp_path):
+        files = {"a.txt": b"alpha", "sub/b.bin": b"\0\1\2"}
+        archive = _make_zip(tmp_path / "t.zip", files)
+        d = make_dir("d", files)
+        assert komparu.compare_fs(komparu.ZipFS(str(archive)), str(d)).equal is True
+
+        (d / "sub" / "b.bin").write_bytes(b"\0\1\3")
+        (d / "extra").write_bytes(b"")
+        result = komparu.compare_fs(komparu.ZipFS(str(archive)), str(d))
+        assert result.diff == {"sub/b.bin": DiffReason.CONTENT_MISMATCH}
+        assert result.only_right == {"extra"}
+
+    def test_open_zipfile_and_directories(self, tmp_path):
+        path = tmp_path / "t.zip"
+        with zipfile.ZipFile(path, "w") as zf:
+            zf.writestr("dir/", b"")
+            zf.writestr("dir/f", b"x")
+        with zipfile.ZipFile(path) as zf:
+            fs = komparu.ZipFS(zf)
+            assert fs.files() == {"dir/f": 1}
+            assert komparu.compare_fs(fs, komparu.MemoryFS({"dir/f": b"x"})).equal is True
+
+    def test_unix_mode(self, tmp_path):
+        path = tmp_path / "t.zip"
+        with zipfile.ZipFile(path, "w") as zf:
+            info = zipfile.ZipInfo("run.sh")
+            info.create_system = 3
+            info.external_attr = 0o100755 << 16
+            zf.writestr(info, b"#!/bin/sh\n")
+        assert komparu.ZipFS(str(path)).stat("run.sh").mode == 0o755
+
+
+class TestTarFS:
+    """Tar archives, compressed or not, compare without extraction."""
+
+    def test_tar_gz_against_directory(self, make_dir, tmp_path):
+        files = {"a.txt": b"alpha", "sub/b.bin": b"\0\1\2"}
+        archive = _make_tar(tmp_path / "t.tar.gz", files)
+        d = make_dir("d", files)
+        fs = komparu.TarFS(str(archive))
+        assert komparu.compare_fs(fs, str(d)).equal is True
+        fs.close()
+        (d / "a.txt").write_bytes(b"ALPHA")
+        result = komparu.compare_fs(str(archive), str(d))
+        assert result.diff == {"a.txt": DiffReason.CONTENT_MISMATCH}
+
+    def test_order_mtime_and_owner_ignored(self, tmp_path):
+        a = _make_tar(tmp_path / "a.tar", {"x": b"1", "y": b"2"}, "w", mtime=1, uid=0)
+        b = _make_tar(tmp_path / "b.tar.xz", {"y": b"2", "x": b"1"}, "w:xz", mtime=2, uid=1000)
+        assert komparu.compare_fs(str(a), str(b)).equal is True
+        result = komparu.compare_fs(str(a), str(b), metadata=["mtime", "uid"])
+        assert result.diff == {"x": DiffReason.MTIME_MISMATCH, "y": DiffReason.MTIME_MISMATCH}
+        assert komparu.compare_fs(str(a), str(b), metadata=["uid"]).equal is False
+
+    def test_member_names(self, tmp_path):
+        path = _make_tar(tmp_path / "t.tar", {"./etc/conf": b"old", "/etc/conf": b"new"}, "w")
+        fs = komparu.TarFS(str(path))
+        assert fs.files() == {"etc/conf": 3}
+        assert komparu.compare_fs(fs, komparu.MemoryFS({"etc/conf": b"new"})).equal is True
+
+    def test_hard_link(self, tmp_path):
+        path = tmp_path / "t.tar"
+        with tarfile.open(path, "w") as tf:
+            info = tarfile.TarInfo("f")
+            info.size = 3
+            tf.addfile(info, io.BytesIO(b"abc"))
+            link = tarfile.TarInfo("g")
+            link.type = tarfile.LNKTYPE
+            link.linkname = "f"
+            tf.addfile(link)
+            folder = tarfile.TarInfo("dir")
+            folder.type = tarfile.DIRTYPE
+            tf.addfile(folder)
+        fs = komparu.TarFS(str(path))
+        assert fs.files() == {"f": 3, "g": 3}
+        assert komparu.compare_fs(fs, komparu.MemoryFS({"f": b"abc", "g": b"abc"})).equal is True
+
+    @pytest.mark.skipif(os.name != "posix", reason="needs POSIX symlinks")
+    def test_symlink_against_directory(self, make_dir, tmp_path):
+        d = make_dir("d", {"f": b"x"})
+        (d / "lnk").symlink_to("f")
+        archive = tmp_path / "d.tgz"
+        with tarfile.open(archive, "w:gz") as tf:
+            tf.add(d, arcname=".")
+        fs = komparu.TarFS(str(archive))
+        assert fs.files() == {"f": 1, "lnk": 1}
+        assert fs.open("lnk").read() == b"f"
+        fs.close()
+        assert komparu.compare_fs(str(d), str(archive)).equal is True
+        (d / "lnk").unlink()
+        (d / "lnk").symlink_to("g")
+        result = komparu.compare_fs(str(d), str(archive))
+        assert result.diff == {"lnk": DiffReason.CONTENT_MISMATCH}
+
+    def test_zip_against_tar(self, tmp_path):
+        files = {"a": b"1", "b/c": b"2"}
+        z = _make_zip(tmp_path / "t.zip", files)
+        t = _make_tar(tmp_path / "t.tgz", files)
+        assert komparu.compare_fs(str(z), str(t)).equal is True
+
+    def test_open_archive(self, tmp_path):
+        assert isinstance(komparu.open_archive(str(_make_zip(tmp_path / "z", {}))), komparu.ZipFS)
+        assert isinstance(komparu.open_archive(str(_make_tar(tmp_path / "t", {}))), komparu.TarFS)
+        plain = tmp_path / "plain.txt"
+        plain.write_bytes(b"not an archive")
+        with pytest.raises(ValueError, match="not a zip or tar archive"):
+            komparu.open_archive(str(plain))
+
+
+class TestResourceFS:
+    """Traversables (package data, zipped or not) are walked recursively."""
+
+    def test_path_traversable(self, make_dir):
+        d = make_dir("pkg", {"data/a.json": b"{}", "data/sub/b.txt": b"b"})
+        fs = komparu.ResourceFS(d / "data")
+        assert fs.files() == {"a.json": None, "sub/b.txt": None}
+        mem = komparu.MemoryFS({"a.json": b"{}", "sub/b.txt": b"B"})
+        assert komparu.compare_fs(fs, mem).diff == {"sub/b.txt": DiffReason.CONTENT_MISMATCH}
+
+    def test_zipped_package(self, make_dir, tmp_path):
+        archive = _make_zip(tmp_path / "pkg.zip", {"pkg/data/a.txt": b"1", "pkg/data/b/c": b"2"})
+        with zipfile.ZipFile(archive) as zf:
+            fs = komparu.ResourceFS(zipfile.Path(zf, "pkg/data/"))
+            d = make_dir("d", {"a.txt": b"1", "b/c": b"2"})
+            assert komparu.compare_fs(fs, str(d)).equal is True
+
+
+class TestOnDisk:
+    """Two on-disk trees take the native compare_dir path."""
+
+    def test_matches_compare_dir(self, make_dir):
+        a = make_dir("a", {"f": b"1", "g": b"2", "only": b""})
+        b = make_dir("b", {"f": b"1", "g": b"3"})
+        assert komparu.compare_fs(str(a), str(b)) == komparu.compare_dir(str(a), str(b))
+
+    @pytest.mark.skipif(os.name != "posix", reason="needs POSIX symlinks")
+    def test_unfollowed_symlinks_compare_by_target(self, make_dir):
+        a, b = make_dir("a", {"f": b"1"}), make_dir("b", {"f": b"1"})
+        (a / "lnk").symlink_to("f")
+        (b / "lnk").symlink_to("g")
+        mem = komparu.MemoryFS({"f": b"1", "lnk": b"f"})
+        assert komparu.compare_fs(komparu.OSFS(str(a), follow_symlinks=False), mem).equal is True
+        result = komparu.compare_fs(komparu.OSFS(str(a), follow_symlinks=False),
+                                    komparu.OSFS(str(b), follow_symlinks=False))
+        assert result.diff == {"lnk": DiffReason.LINK_TARGET_MISMATCH}
+
+    def test_custom_filesystem(self, make_dir):
+        class Upper:
+            """A user-defined FileSystem: two methods suffice."""
+
+            def files(self):
+                return {"f": None}
+
+            def open(self, path):
+                return io.BytesIO(b"ONE")
+
+        d = make_dir("d", {"f": b"ONE"})
+        assert isinstance(Upper(), komparu.FileSystem)
+        assert komparu.compare_fs(Upper(), str(d)).equal is True
+
+
+class TestMetadata:
+    """metadata= checks need stat() on both sides."""
+
+    def test_mode_zip_against_disk(self, make_dir, tmp_path):
+        path = tmp_path / "t.zip"
+        with zipfile.ZipFile(path, "w") as zf:
+            info = zipfile.ZipInfo("run.sh")
+            info.create_system = 3
+            info.external_attr = 0o100755 << 16
+            zf.writestr(info, b"x")
+        d = make_dir("d", {"run.sh": b"x"})
+        os.chmod(d / "run.sh", 0o644)
+        zfs = komparu.ZipFS(str(path))
+        result = komparu.compare_fs(zfs, str(d), metadata=["mode"])
+        assert result.diff == {"run.sh": DiffReason.MODE_MISMATCH}
+        os.chmod(d / "run.sh", 0o755)
+        assert komparu.compare_fs(zfs, str(d), metadata=["mode", "uid"]).equal is True
+
+    def test_needs_stat(self, make_dir):
+        d = make_dir("d", {"f": b"x"})
+        with pytest.raises(ValueError, match="stat"):
+            komparu.compare_fs(komparu.MemoryFS({"f": b"x"}), str(d), metadata=["mode"])
+        with pytest.raises(ValueError, match="xattr"):
+            komparu.compare_fs(komparu.MemoryFS({}), str(d), metadata=["xattr"])
+
+
+class TestValidation:
+    """Bad arguments are rejected up front."""
+
+    def test_not_a_filesystem(self):
+        with pytest.raises(TypeError, match="fs_b"):
+            komparu.compare_fs(komparu.MemoryFS({}), 42)
+
+    def test_cancelled(self):
+        token = komparu.CancelToken()
+        token.cancel()
+        fs = komparu.MemoryFS({"f": b"x"})
+        with pytest.raises(komparu.CancelledError):
+            komparu.compare_fs(fs, fs, cancel=token)
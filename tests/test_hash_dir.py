@@ -0,0 +1,468 @@
+"""Tests for parallel directory hashing."""
+
+from __future__ import annotations
+
+import hashlib
+import os
+import time
+from pathlib import Path
+
+import pytest
+
+import komparu
+
+
+@pytest.fixture
+def make_dir(tmp_path: Path):
+    """Create a directory tree from a dict of {relative_path: content}."""
+
+    def _make(name: str, files: dict[str, bytes]) -> Path:
+        d = tmp_path / name
+        d.mkdir(parents=True, exist_ok=True)
+        for rel, content in files.items():
+            p = d / rel
+            p.parent.mkdir(parents=True, exist_ok=True)
+            p.write_bytes(content)
+        return d
+
+    return _make
+
+
+def _sha256(data: bytes) -> str:
+    return hashlib.sha256(data).hexdigest()
+
+
+class TestHashDir:
+    def test_matches_hashlib(self, make_dir):
+        files = {
+            "empty.txt": b"",
+            "small.txt": b"abc",
+            "block.bin": b"x" * 64,
+            "padding.bin": b"y" * 55,
+            "padding2.bin": b"y" * 56,
+            "sub/big.bin": os.urandom(300_000),
+        }
+        d = make_dir("d", files)
+        result = komparu.hash_dir(str(d))
+        assert result == {rel: _sha256(c) for rel, c in files.items()}
+
+    def test_empty_dir(self, make_dir):
+        d = make_dir("d", {})
+        assert komparu.hash_dir(str(d)) == {}
+
+    def test_deterministic_across_workers(self, make_dir):
+        files = {f"f{i:04d}.bin": os.urandom(i * 37) for i in range(300)}
+        d = make_dir("d", files)
+        sequential = komparu.hash_dir(str(d), max_workers=1)
+        parallel = komparu.hash_dir(str(d), max_workers=8)
+        assert sequential == parallel
+        assert len(parallel) == 300
+
+    def test_small_chunk_size(self, make_dir):
+        content = os.urandom(10_000)
+        d = make_dir("d", {"a.bin": content})
+        assert komparu.hash_dir(str(d), chunk_size=7) == {"a.bin": _sha256(content)}
+
+    def test_nested_paths_relative(self, make_dir):
+        d = make_dir("d", {"a/b/c.txt": b"deep"})
+        assert list(komparu.hash_dir(str(d))) == ["a/b/c.txt"]
+
+    def test_not_a_directory(self, tmp_path: Path):
+        with pytest.raises(OSError):
+            komparu.hash_dir(str(tmp_path / "missing"))
+
+    @pytest.mark.skipif(os.getuid() == 0, reason="root ignores permissions")
+    def test_unreadable_file_raises(self, make_dir):
+        d = make_dir("d", {"ok.txt": b"ok", "secret.txt": b"secret"})
+        (d / "secret.txt").chmod(0)
+        try:
+            with pytest.raises(OSError, match="secret.txt"):
+                komparu.hash_dir(str(d), max_workers=4)
+        finally:
+            (d / "secret.txt").chmod(0o644)
+
+    def test_invalid_params(self, make_dir):
+        d = make_dir("d", {})
+        with pytest.raises(ValueError):
+            komparu.hash_dir("")
+        with pytest.raises(ValueError):
+            komparu.hash_dir(str(d), chunk_size=0)
+        with pytest.raises(ValueError):
+            komparu.hash_dir(str(d), max_workers=-1)
+
+
+class TestCompareDirHashes:
+    """compare_dir_hashes diffs two manifests without touching files."""
+
+    def test_equal(self):
+        m = {"a": _sha256(b"1"), "sub/b": _sha256(b"2")}
+        result = komparu.compare_dir_hashes(m, dict(m))
+        assert result.equal is True
+        assert result.diff == {}
+
+    def test_full_report(self):
+        a = {"same": _sha256(b"x"), "changed": _sha256(b"1"), "gone": _sha256(b"g")}
+        b = {"same": _sha256(b"x"), "changed": _sha256(b"2"), "new": _sha256(b"n")}
+        result = komparu.compare_dir_hashes(a, b)
+        assert result.equal is False
+        assert result.diff == {"changed": komparu.DiffReason.CONTENT_MISMATCH}
+        assert result.only_left == {"gone"}
+        assert result.only_right == {"new"}
+        assert result.errors == set()
+
+    def test_hex_case_insensitive(self):
+        d = _sha256(b"data")
+        assert komparu.compare_dir_hashes({"f": d}, {"f": d.upper()}).equal is True
+
+    def test_bytes_digests(self):
+        raw = hashlib.sha256(b"data").digest()
+        assert komparu.compare_dir_hashes({"f": raw}, {"f": raw.hex()}).equal is True
+
+    def test_empty_manifests(self):
+        assert komparu.compare_dir_hashes({}, {}).equal is True
+
+    def test_bad_digest_type(self):
+        with pytest.raises(TypeError, match="hashes_b"):
+            komparu.compare_dir_hashes({"f": "ab"}, {"f": 12})
+
+    def test_matches_compare_dir(self, make_dir):
+        a = make_dir("a", {"x": b"1", "y": b"2", "z": b"3"})
+        b = make_dir("b", {"x": b"1", "y": b"9", "w": b"4"})
+        from_hashes = komparu.compare_dir_hashes(
+            komparu.hash_dir(str(a)), komparu.hash_dir(str(b)),
+        )
+        direct = komparu.compare_dir(str(a), str(b))
+        assert from_hashes.diff == direct.diff
+        assert from_hashes.only_left == direct.only_left
+        assert from_hashes.only_right == direct.only_right
+
+    def test_windows_separators(self, make_dir):
+        d = make_dir("a", {"sub/deep/f": b"1", "sub/g": b"2"})
+        posix = komparu.hash_dir(str(d))
+        windows = {k.replace("/", "\\"): v for k, v in posix.items()}
+        assert komparu.compare_dir_hashes(windows, posix).equal is True
+        result = komparu.compare_dir_hashes({"sub\\new": _sha256(b"n")}, {})
+        assert result.only_left == {"sub/new"}
+
+    def test_separator_collision(self):
+        d = _sha256(b"1")
+        with pytest.raises(ValueError, match="hashes_a"):
+            komparu.compare_dir_hashes({"a/b": d, "a\\b": d}, {})
+
+
+class TestCompareThreeWay:
+    """compare_three_way classifies changes against a merge base."""
+
+    def test_directories(self, make_dir):
+        base = make_dir("base", {"same": b"s", "ours": b"1", "theirs": b"1",
+                                 "both": b"1", "clash": b"1"})
+        left = make_dir("left", {"same": b"s", "ours": b"2", "theirs": b"1",
+                                 "both": b"3", "clash": b"4"})
+        right = make_dir("right", {"same": b"s", "ours": b"1", "theirs": b"2",
+                                   "both": b"3", "clash": b"5"})
+        result = komparu.compare_three_way(str(base), str(left), str(right))
+        S = komparu.MergeStatus
+        assert result.files == {
+            "same": S.UNCHANGED,
+            "ours": S.CHANGED_LEFT,
+            "theirs": S.CHANGED_RIGHT,
+            "both": S.CHANGED_BOTH_SAME,
+            "clash": S.CONFLICT,
+        }
+        assert result.conflicts == ["clash"]
+        assert result.clean is False
+
+    def test_additions_and_deletions(self):
+        S = komparu.MergeStatus
+        base = {"del_left": "aa", "del_both": "bb", "del_vs_edit": "cc"}
+        left = {"del_vs_edit": "cc", "new_left": "dd", "new_both": "ee", "new_clash": "01"}
+        right = {"del_left": "aa", "del_vs_edit": "ff", "new_both": "EE", "new_clash": "02"}
+        result = komparu.compare_three_way(base, left, right)
+        assert result.files == {
+            "del_left": S.CHANGED_LEFT,
+            "del_both": S.CHANGED_BOTH_SAME,
+            "del_vs_edit": S.CHANGED_RIGHT,
+            "new_left": S.CHANGED_LEFT,
+            "new_both": S.CHANGED_BOTH_SAME,
+            "new_clash": S.CONFLICT,
+        }
+
+    def test_delete_versus_modify_conflicts(self):
+        result = komparu.compare_three_way({"f": "aa"}, {}, {"f": "bb"})
+        assert result.files == {"f": komparu.MergeStatus.CONFLICT}
+
+    def test_mixed_manifest_and_directory(self, make_dir):
+        base = make_dir("base", {"sub/f": b"one"})
+        manifest = komparu.hash_dir(str(base))
+        left = make_dir("left", {"sub/f": b"one"})
+        right = make_dir("right", {"sub/f": b"two"})
+        result = komparu.compare_three_way(
+            {k.replace("/", "\\"): v for k, v in manifest.items()}, str(left), str(right),
+        )
+        assert result.files == {"sub/f": komparu.MergeStatus.CHANGED_RIGHT}
+        assert result.clean is True
+
+    def test_bytes_digests(self):
+        raw = bytes.fromhex("ab" * 32)
+        result = komparu.compare_three_way({"f": raw}, {"f": "AB" * 32}, {"f": raw})
+        assert result.files == {"f": komparu.MergeStatus.UNCHANGED}
+
+    def test_bad_digest_type(self):
+        with pytest.raises(TypeError, match="left"):
+            komparu.compare_three_way({}, {"f": 1}, {})
+
+    def test_files(self, tmp_path):
+        S = komparu.MergeStatus
+        paths = {}
+        for name, content in (("base", b"v1"), ("same", b"v1"), ("v2", b"v2"),
+                              ("v2b", b"v2"), ("v3", b"v3!")):
+            paths[name] = str(tmp_path / f"{name}.txt")
+            (tmp_path / f"{name}.txt").write_bytes(content)
+        for left, right, status in (("same", "same", S.UNCHANGED), ("v2", "same", S.CHANGED_LEFT),
+                                    ("same", "v2", S.CHANGED_RIGHT), ("v2", "v2b", S.CHANGED_BOTH_SAME),
+                                    ("v2", "v3", S.CONFLICT)):
+            result = komparu.compare_three_way(paths["base"], paths[left], paths[right])
+            assert result.files == {"base.txt": status}
+
+    def test_files_and_directories_mixed(self, make_dir, tmp_path):
+        d = make_dir("d", {"f": b"x"})
+        with pytest.raises(ValueError, match="all be files"):
+            komparu.compare_three_way(str(d / "f"), str(d), str(d))
+        with pytest.raises(ValueError, match="all be files"):
+            komparu.compare_three_way({}, str(d / "f"), str(d / "f"))
+
+    def test_exclude_and_include(self, make_dir):
+        base = make_dir("base", {"a.txt": b"1", "b.log": b"1", "tmp/c.txt": b"1"})
+        left = make_dir("left", {"a.txt": b"2", "b.log": b"2", "tmp/c.txt": b"2"})
+        S = komparu.MergeStatus
+        result = komparu.compare_three_way(str(base), str(left), str(base), exclude=["tmp/"])
+        assert result.files == {"a.txt": S.CHANGED_LEFT, "b.log": S.CHANGED_LEFT}
+        result = komparu.compare_three_way(str(base), str(left), komparu.hash_dir(str(base)),
+                                           include=["*.txt"], exclude=["tmp/"])
+        assert result.files == {"a.txt": S.CHANGED_LEFT}
+
+    def test_cache(self, make_dir, tmp_path):
+        base = make_dir("base", {"f": b"1", "g": b"1", "h.log": b"1"})
+        left = make_dir("left", {"f": b"2", "g": b"1", "h.log": b"1"})
+        hour_ago = time.time() - 3600
+        for d in (base, left):
+            for name in ("f", "g", "h.log"):
+                os.utime(d / name, (hour_ago, hour_ago))
+        S = komparu.MergeStatus
+        with komparu.DigestCache(str(tmp_path / "cache")) as cache:
+            first = komparu.compare_three_way(str(base), str(left), str(base), cache=cache)
+            assert cache.misses == 6
+            again = komparu.compare_three_way(str(base), str(left), str(base),
+                                              cache=cache, exclude=["*.log"])
+            assert cache.misses == 6
+        assert first.files == {"f": S.CHANGED_LEFT, "g": S.UNCHANGED, "h.log": S.UNCHANGED}
+        assert again.files == {"f": S.CHANGED_LEFT, "g": S.UNCHANGED}
+
+    def test_cancel(self, make_dir, tmp_path):
+        base = make_dir("base", {"f": b"1"})
+        token = komparu.CancelToken()
+        assert komparu.compare_three_way(str(base), str(base), str(base), cancel=token).clean
+        token.cancel()
+        with pytest.raises(komparu.CancelledError):
+            komparu.compare_three_way(str(base), str(base), str(base), cancel=token)
+        with pytest.raises(komparu.CancelledError):
+            komparu.compare_three_way(str(base / "f"), str(base / "f"), str(base / "f"),
+                                      cancel=token)
+
+    def test_counts(self):
+        result = komparu.compare_three_way({"f": "aa", "g": "bb"}, {"f": "cc", "g": "bb"},
+                                           {"f": "dd", "g": "bb"})
+        assert result.counts[komparu.MergeStatus.CONFLICT] == 1
+        assert result.counts[komparu.MergeStatus.UNCHANGED] == 1
+        assert result.counts[komparu.MergeStatus.CHANGED_LEFT] == 0
+
+
+class TestCompareTrees:
+    """compare_trees audits N replicas by digest."""
+
+    def test_all_identical(self, make_dir):
+        files = {"a.txt": b"a", "sub/b.bin": os.urandom(5000)}
+        dirs = [str(make_dir(f"r{i}", files)) for i in range(4)]
+        report = komparu.compare_trees(dirs, max_workers=2)
+        assert report.equal is True
+        assert report.diverged == []
+        assert report.missing == {}
+        assert report.dirs == tuple(dirs)
+        assert report.files["sub/b.bin"] == [set(dirs)]
+
+    def test_one_replica_diverges(self, make_dir):
+        r0 = str(make_dir("r0", {"f": b"good", "g": b"x"}))
+        r1 = str(make_dir("r1", {"f": b"good", "g": b"x"}))
+        r2 = str(make_dir("r2", {"f": b"bad!", "g": b"x"}))
+        report = komparu.compare_trees([r0, r1, r2])
+        assert report.equal is False
+        assert report.diverged == ["f"]
+        assert report.files["f"] == [{r0, r1}, {r2}]
+        assert report.files["g"] == [{r0, r1, r2}]
+
+    def test_missing_from_replica(self, make_dir):
+        r0 = str(make_dir("r0", {"f": b"1", "extra": b"e"}))
+        r1 = str(make_dir("r1", {"f": b"1"}))
+        r2 = str(make_dir("r2", {"f": b"1", "extra": b"e"}))
+        report = komparu.compare_trees([r0, r1, r2])
+        assert report.diverged == ["extra"]
+        assert report.missing == {"extra": {r1}}
+        assert report.files["extra"] == [{r0, r2}]
+
+    def test_hashes_each_file_once_per_replica(self, make_dir):
+        files = {"f": b"data"}
+        dirs = [str(make_dir(f"r{i}", files)) for i in range(5)]
+        calls = []
+        original = komparu._api.hash_dir
+
+        def counting(directory, **kw):
+            calls.append(directory)
+            return original(directory, **kw)
+
+        komparu._api.hash_dir = counting
+        try:
+            assert komparu.compare_trees(dirs).equal is True
+        finally:
+            komparu._api.hash_dir = original
+        assert calls == dirs
+
+    def test_needs_two_dirs(self, make_dir):
+        d = str(make_dir("r0", {}))
+        with pytest.raises(ValueError, match="at least two"):
+            komparu.compare_trees([d])
+
+    def test_duplicate_dir(self, make_dir):
+        d = str(make_dir("r0", {}))
+        with pytest.raises(ValueError, match="once"):
+            komparu.compare_trees([d, d])
+
+
+class TestVerifyHash:
+    """verify_hash checks one file against an expected digest."""
+
+    def test_match(self, make_file):
+        data = os.urandom(300_000)
+        f = make_file("blob.bin", data)
+        assert komparu.verify_hash(str(f), _sha256(data), chunk_size=4096) is True
+
+    def test_uppercase_hex(self, make_file):
+        f = make_file("a.txt", b"abc")
+        assert komparu.verify_hash(str(f), _sha256(b"abc").upper()) is True
+
+    def test_mismatch(self, make_file):
+        f = make_file("a.txt", b"abc")
+        assert komparu.verify_hash(str(f), _sha256(b"abd")) is False
+
+    def test_empty_file(self, make_file):
+        f = make_file("empty", b"")
+        assert komparu.verify_hash(str(f), _sha256(b"")) is True
+
+    def test_unknown_algo(self, make_file):
+        f = make_file("a.txt", b"abc")
+        with pytest.raises(ValueError, match="algo"):
+            komparu.verify_hash(str(f), _sha256(b"abc"), algo="md5")
+
+    def test_malformed_hex(self, make_file):
+        f = make_file("a.txt", b"abc")
+        with pytest.raises(ValueError, match="hex string"):
+            komparu.verify_hash(str(f), "zz" * 32)
+
+    def test_wrong_length(self, make_file):
+        f = make_file("a.txt", b"abc")
+        with pytest.raises(ValueError, match="64 hex digits"):
+            komparu.verify_hash(str(f), _sha256(b"abc")[:-2])
+
+    def test_missing_file(self, tmp_path):
+        with pytest.raises(FileNotFoundError):
+            komparu.verify_hash(str(tmp_path / "nope"), _sha256(b""))
+
+
+def _weak(block: bytes) -> int:
+    a = sum(block) & 0xFFFF
+    b = sum((len(block) - i) * x for i, x in enumerate(block)) & 0xFFFF
+    return a | (b << 16)
+
+
+class TestCompareAndHash:
+    """compare_and_hash returns both digests alongside the verdict."""
+
+    def test_equal(self, make_file):
+        data = os.urandom(300_000)
+        a = make_file("a.bin", data)
+        b = make_file("b.bin", data)
+        assert komparu.compare_and_hash(str(a), str(b), chunk_size=4096) == (
+            True, _sha256(data), _sha256(data),
+        )
+
+    def test_different_hashes_whole_files(self, make_file):
+        data_a = b"x" + os.urandom(100_000)
+        data_b = b"y" + data_a[1:]
+        a = make_file("a.bin", data_a)
+        b = make_file("b.bin", data_b)
+        equal, hash_a, hash_b = komparu.compare_and_hash(str(a), str(b), chunk_size=1000)
+        assert equal is False
+        assert hash_a == _sha256(data_a)
+        assert hash_b == _sha256(data_b)
+
+    def test_different_lengths(self, make_file):
+        a = make_file("a.bin", b"abc" * 1000)
+        b = make_file("b.bin", b"abc" * 1000 + b"!")
+        for chunk_size in (1, 7, 3000, 65536):
+            equal, hash_a, hash_b = komparu.compare_and_hash(
+                str(a), str(b), chunk_size=chunk_size,
+            )
+            assert equal is False
+            assert (hash_a, hash_b) == (_sha256(b"abc" * 1000), _sha256(b"abc" * 1000 + b"!"))
+
+    def test_empty_files(self, make_file):
+        a = make_file("a", b"")
+        b = make_file("b", b"")
+        assert komparu.compare_and_hash(str(a), str(b)) == (True, _sha256(b""), _sha256(b""))
+
+    def test_empty_versus_data(self, make_file):
+        a = make_file("a", b"")
+        b = make_file("b", b"data")
+        assert komparu.compare_and_hash(str(a), str(b)) == (False, _sha256(b""), _sha256(b"data"))
+
+    def test_unknown_algo(self, make_file):
+        a = make_file("a", b"")
+        with pytest.raises(ValueError, match="algo"):
+            komparu.compare_and_hash(str(a), str(a), algo="md5")
+
+    def test_missing_file(self, make_file, tmp_path):
+        a = make_file("a", b"")
+        with pytest.raises(FileNotFoundError):
+            komparu.compare_and_hash(str(a), str(tmp_path / "nope"))
+
+
+class TestBlockChecksums:
+    """block_checksums returns the per-block delta-sync signature."""
+
+    def test_blocks(self, make_file):
+        data = os.urandom(10_000)
+        f = make_file("blob.bin", data)
+        sums = komparu.block_checksums(str(f), 4096)
+        assert [(s.offset, s.length) for s in sums] == [(0, 4096), (4096, 4096), (8192, 1808)]
+        for s in sums:
+            block = data[s.offset:s.offset + s.length]
+            assert s.strong == hashlib.sha256(block).digest()
+            assert s.weak == _weak(block)
+
+    def test_exact_multiple(self, make_file):
+        f = make_file("a.bin", b"x" * 8192)
+        sums = komparu.block_checksums(str(f), 4096)
+        assert [s.offset for s in sums] == [0, 4096]
+        assert (sums[0].weak, sums[0].strong) == (sums[1].weak, sums[1].strong)
+
+    def test_empty_file(self, make_file):
+        f = make_file("empty", b"")
+        assert komparu.block_checksums(str(f), 1024) == []
+
+    def test_invalid_block_size(self, make_file):
+        f = make_file("a.txt", b"abc")
+        with pytest.raises(ValueError, match="block_size"):
+            komparu.block_checksums(str(f), 0)
+
+    def test_missing_file(self, tmp_path):
+        with pytest.raises(FileNotFoundError):
+            komparu.block_checksums(str(tmp_path / "nope"), 1024)
@@ -0,0 +1,210 @@
+"""Tests for the HTML side-by-side diff."""
+
+from __future__ import annotations
+
+import io
+import re
+from html.parser import HTMLParser
+
+import pytest
+
+import komparu
+
+
+def _render(a, b, **kw) -> tuple[bool, str]:
+    out = io.StringIO()
+    equal = komparu.diff_html(str(a), str(b), out, **kw)
+    return equal, out.getvalue()
+
+
+def _summary(page: str) -> str:
+    return re.search(r'<p class="summary">(.*?)</p>', page).group(1)
+
+
+def _cells(page: str, cls: str) -> list[str]:
+    return re.findall(rf'<td class="{cls}">(.*?)</td>', page)
+
+
+class _Tags(HTMLParser):
+    def __init__(self) -> None:
+        super().__init__()
+        self.tags: list[str] = []
+
+    def handle_starttag(self, tag, attrs):
+        self.tags.append(tag)
+
+
+class TestTextDiff:
+    """Text files are diffed line by line, side by side."""
+
+    def test_equal(self, make_file):
+        a = make_file("a.txt", b"one\ntwo\n")
+        b = make_file("b.txt", b"one\ntwo\n")
+        equal, page = _render(a, b)
+        assert equal is True
+        assert _summary(page) == "Files are identical."
+        assert page.startswith("<!DOCTYPE html>")
+        assert page.rstrip().endswith("</html>")
+
+    def test_changed_line_highlighted(self, make_file):
+        a = make_file("a.txt", b"one\ntwo\nthree\n")
+        b = make_file("b.txt", b"one\nTWO\nthree\n")
+        equal, page = _render(a, b)
+        assert equal is False
+        assert _cells(page, "l chg") == ["two"]
+        assert _cells(page, "r chg") == ["TWO"]
+        assert _summary(page) == "1 line changed."
+
+    def test_added_and_removed(self, make_file):
+        a = make_file("a.txt", b"keep\ngone\n")
+        b = make_file("b.txt", b"keep\nnew\nnewer\n")
+        page = _render(a, b)[1]
+        assert "line changed" in _summary(page)
+        assert _cells(page, "r ins") == ["newer"]
+
+        a = make_file("a.txt", b"x\ny\nz\n")
+        b = make_file("b.txt", b"x\nz\n")
+        page = _render(a, b)[1]
+        assert _cells(page, "l del") == ["y"]
+        assert _summary(page) == "1 line removed."
+
+    def test_content_escaped(self, make_file):
+        a = make_file("a.txt", b"<script>alert(1)</script>\n")
+        b = make_file("b.txt", b"a & \"b\" <i>\n")
+        page = _render(a, b)[1]
+        assert "&lt;script&gt;alert(1)&lt;/script&gt;" in page
+        assert "a &amp; &quot;b&quot; &lt;i&gt;" in page
+        parser = _Tags()
+        parser.feed(page)
+        assert "script" not in parser.tags
+        assert "i" not in parser.tags
+
+    def test_path_escaped(self, tmp_path):
+        a = tmp_path / "<a>.txt"
+        b = tmp_path / "b&.txt"
+        a.write_bytes(b"1\n")
+        b.write_bytes(b"2\n")
+        page = _render(a, b)[1]
+        assert "<a>" not in page
+        assert "&lt;a&gt;.txt" in page
+        assert "b&amp;.txt" in page
+
+    def test_context_folds_unchanged(self, make_file):
+        body = b"".join(b"line %d\n" % i for i in range(1, 21))
+        a = make_file("a.txt", body)
+        b = make_file("b.txt", body.replace(b"line 10\n", b"line ten\n"))
+        page = _render(a, b, context=2)[1]
+        assert _cells(page, "l") == ["line 8", "line 9", "line 11", "line 12"]
+        assert "⋯ 7 unchanged lines" in page
+        assert "⋯ 8 unchanged lines" in page
+
+    def test_context_none_shows_all(self, make_file):
+        body = b"".join(b"%d\n" % i for i in range(30))
+        a = make_file("a.txt", body)
+        b = make_file("b.txt", body + b"extra\n")
+        page = _render(a, b, context=None)[1]
+        assert len([c for c in _cells(page, "l") if c]) == 30
+        assert "unchanged" not in page
+
+    def test_missing_final_newline_shown(self, make_file):
+        a = make_file("a.txt", b"end\n")
+        b = make_file("b.txt", b"end")
+        equal, page = _render(a, b)
+        assert equal is False
+        assert "no newline at end of file" in page
+
+    def test_carriage_return_visible(self, make_file):
+        a = make_file("a.txt", b"x\n")
+        b = make_file("b.txt", b"x\r\n")
+        assert "␍" in _render(a, b)[1]
+
+    def test_max_rows(self, make_file):
+        a = make_file("a.txt", b"".join(b"a%d\n" % i for i in range(50)))
+        b = make_file("b.txt", b"".join(b"b%d\n" % i for i in range(50)))
+        page = _render(a, b, max_rows=5)[1]
+        assert len(_cells(page, "l chg")) == 5
+        assert "output truncated" in page
+        assert _summary(page) == "50 lines changed."
+
+    def test_encoding(self, make_file):
+        a = make_file("a.txt", "é\n".encode("latin-1"))
+        b = make_file("b.txt", "è\n".encode("latin-1"))
+        page = _render(a, b, encoding="latin-1")[1]
+        assert _cells(page, "l chg") == ["é"]
+
+
+class TestHexDiff:
+    """Binary files get a hex view of the differing rows."""
+
+    def test_nul_byte_selects_hex(self, make_file):
+        a = make_file("a.bin", b"\0" + b"x" * 40)
+        b = make_file("b.bin", b"\0" + b"x" * 20 + b"y" + b"x" * 19)
+        equal, page = _render(a, b)
+        assert equal is False
+        assert _summary(page) == "Binary files: 1 byte of 41 differ."
+        assert '<td class="n">00000010</td>' in page
+        assert '<span class="d">79</span>' in page
+        assert '<td class="n">00000000</td>' not in page
+        assert "⋯ 16 identical bytes" in page
+
+    def test_undecodable_selects_hex(self, make_file):
+        a = make_file("a.txt", b"ok\xff\n")
+        b = make_file("b.txt", b"ok\xfe\n")
+        page = _render(a, b)[1]
+        assert _summary(page).startswith("Binary files:")
+        assert '<span class="d">ff</span>' in page
+
+    def test_length_difference(self, make_file):
+        a = make_file("a.bin", b"\0abc")
+        b = make_file("b.bin", b"\0abcde")
+        page = _render(a, b)[1]
+        assert _summary(page) == "Binary files: 2 bytes of 6 differ."
+
+    def test_ascii_column_escaped(self, make_file):
+        a = make_file("a.bin", b"\0<&>")
+        b = make_file("b.bin", b"\0<&?")
+        page = _render(a, b)[1]
+        assert "&lt;&amp;" in page
+        assert "<&" not in page
+
+    def test_equal(self, make_file):
+        a = make_file("a.bin", b"\0\1\2" * 1000)
+        b = make_file("b.bin", b"\0\1\2" * 1000)
+        equal, page = _render(a, b, chunk_size=100)
+        assert equal is True
+        assert _summary(page) == "Binary files are identical."
+
+    def test_small_chunk_keeps_offsets(self, make_file):
+        data = bytearray(b"\0" * 200)
+        b_data = bytearray(data)
+        b_data[150] = 1
+        a = make_file("a.bin", bytes(data))
+        b = make_file("b.bin", bytes(b_data))
+        page = _render(a, b, chunk_size=7)[1]
+        assert '<td class="n">00000090</td>' in page
+
+
+class TestValidation:
+    """Bad arguments are rejected before any output."""
+
+    def test_negative_context(self, make_file):
+        a = make_file("a.txt", b"")
+        with pytest.raises(ValueError, match="context"):
+            _render(a, a, context=-1)
+
+    def test_negative_max_rows(self, make_file):
+        a = make_file("a.txt", b"")
+        with pytest.raises(ValueError, match="max_rows"):
+            _render(a, a, max_rows=-1)
+
+    def test_unknown_encoding(self, make_file):
+        a = make_file("a.txt", b"")
+        with pytest.raises(ValueError, match="encoding"):
+            _render(a, a, encoding="no-such-codec")
+
+    def test_missing_file(self, make_file, tmp_path):
+        a = make_file("a.txt", b"")
+        out = io.StringIO()
+        with pytest.raises(FileNotFoundError):
+            komparu.diff_html(str(a), str(tmp_path / "nope"), out)
+        assert out.getvalue() == ""
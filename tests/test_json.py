@@ -0,0 +1,113 @@
+"""Tests for structural JSON comparison."""
+
+from __future__ import annotations
+
+import json
+
+import pytest
+
+import komparu
+from komparu import DecodeError
+
+
+def _pair(make_file, a, b):
+    fa = make_file("a.json", json.dumps(a).encode())
+    fb = make_file("b.json", json.dumps(b).encode())
+    return str(fa), str(fb)
+
+
+class TestCompareJson:
+    """Documents compare by value, not by bytes."""
+
+    def test_whitespace_and_key_order(self, make_file):
+        a = make_file("a.json", b'{"x": 1, "y": [1, 2]}')
+        b = make_file("b.json", b'{\n  "y": [1,2],\n  "x": 1\n}\n')
+        assert komparu.compare_json(str(a), str(b)) is True
+
+    def test_value_differs(self, make_file):
+        assert komparu.compare_json(*_pair(make_file, {"x": 1}, {"x": 2})) is False
+
+    def test_array_order_matters(self, make_file):
+        assert komparu.compare_json(*_pair(make_file, [1, 2], [2, 1])) is False
+
+    def test_number_spelling(self, make_file):
+        a = make_file("a.json", b"[1, 2.50, 100]")
+        b = make_file("b.json", b"[1.0, 2.5, 1e2]")
+        assert komparu.compare_json(str(a), str(b)) is True
+
+    def test_bool_is_not_number(self, make_file):
+        assert komparu.compare_json(*_pair(make_file, [True, 0], [1, False])) is False
+        assert komparu.compare_json(*_pair(make_file, {"a": True}, {"a": True})) is True
+
+    def test_extra_key(self, make_file):
+        assert komparu.compare_json(*_pair(make_file, {"a": 1}, {"a": 1, "b": None})) is False
+
+    def test_utf16_detected(self, make_file):
+        a = make_file("a.json", '{"k": "é"}'.encode("utf-16"))
+        b = make_file("b.json", '{"k": "é"}'.encode())
+        assert komparu.compare_json(str(a), str(b)) is True
+
+    def test_invalid_json(self, make_file):
+        a = make_file("a.json", b'{"a": ')
+        b = make_file("b.json", b"{}")
+        with pytest.raises(DecodeError, match="a.json"):
+            komparu.compare_json(str(a), str(b))
+
+    def test_invalid_utf8(self, make_file):
+        a = make_file("a.json", b'"\xff"')
+        with pytest.raises(DecodeError):
+            komparu.compare_json(str(a), str(a))
+
+
+class TestIgnorePaths:
+    """Matched locations are dropped from both documents."""
+
+    def test_member(self, make_file):
+        a, b = _pair(make_file,
+                     {"meta": {"timestamp": "10:00", "v": 1}, "data": 5},
+                     {"meta": {"timestamp": "11:30", "v": 1}, "data": 5})
+        assert komparu.compare_json(a, b) is False
+        assert komparu.compare_json(a, b, ignore_paths=["$.meta.timestamp"]) is True
+
+    def test_only_ignored_differ(self, make_file):
+        a, b = _pair(make_file, {"id": 1, "x": 1}, {"id": 2, "x": 2})
+        assert komparu.compare_json(a, b, ignore_paths=["$.id"]) is False
+
+    def test_wildcard_array(self, make_file):
+        a, b = _pair(make_file,
+                     {"items": [{"id": "a1", "n": 1}, {"id": "a2", "n": 2}]},
+                     {"items": [{"id": "b1", "n": 1}, {"id": "b2", "n": 2}]})
+        assert komparu.compare_json(a, b, ignore_paths=["$.items[*].id"]) is True
+
+    def test_missing_on_one_side(self, make_file):
+        a, b = _pair(make_file, {"x": 1, "request_id": "r-9"}, {"x": 1})
+        assert komparu.compare_json(a, b, ignore_paths=["$.request_id"]) is True
+
+    def test_bracket_and_index(self, make_file):
+        a, b = _pair(make_file,
+                     {"a.b": [0, "t1", 2]}, {"a.b": [0, "t2", 2]})
+        assert komparu.compare_json(a, b, ignore_paths=["$['a.b'][1]"]) is True
+        assert komparu.compare_json(a, b, ignore_paths=['$["a.b"][-2]']) is True
+        assert komparu.compare_json(a, b, ignore_paths=["$['a.b'][0]"]) is False
+
+    def test_recursive_descent(self, make_file):
+        a, b = _pair(make_file,
+                     {"etag": 1, "page": {"list": [{"etag": 2, "v": 1}]}},
+                     {"etag": 3, "page": {"list": [{"etag": 4, "v": 1}]}})
+        assert komparu.compare_json(a, b, ignore_paths=["$..etag"]) is True
+
+    def test_member_wildcard(self, make_file):
+        a, b = _pair(make_file,
+                     {"stats": {"cpu": 1, "mem": 2}, "k": 0},
+                     {"stats": {"cpu": 9}, "k": 0})
+        assert komparu.compare_json(a, b, ignore_paths=["$.stats.*"]) is True
+
+    def test_no_match_is_fine(self, make_file):
+        a, b = _pair(make_file, [1], [1])
+        assert komparu.compare_json(a, b, ignore_paths=["$.nope", "$[5]"]) is True
+
+    def test_invalid_paths(self, make_file):
+        a, b = _pair(make_file, {}, {})
+        for bad in ("meta.ts", "$", "$.a[", "$[x]"):
+            with pytest.raises(ValueError, match="JSON path"):
+                komparu.compare_json(a, b, ignore_paths=[bad])
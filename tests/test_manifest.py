@@ -0,0 +1,147 @@
+"""Tests for hash manifests built on one tree and verified against another."""
+
+from __future__ import annotations
+
+import hashlib
+import io
+import json
+
+import pytest
+
+import komparu
+from komparu import DiffReason, Manifest, ManifestEntry
+
+
+def _tree(root, files):
+    for rel, data in files.items():
+        path = root / rel
+        path.parent.mkdir(parents=True, exist_ok=True)
+        path.write_bytes(data)
+    return root
+
+
+def _save(manifest, path):
+    with open(path, "w", encoding="utf-8") as f:
+        komparu.write_manifest(manifest, f)
+    return str(path)
+
+
+class TestManifestDir:
+    """manifest_dir() records size and digest per file."""
+
+    def test_sha256_matches_hash_dir(self, tmp_path):
+        root = _tree(tmp_path / "t", {"a.txt": b"a", "sub/b.txt": b"bb"})
+        m = komparu.manifest_dir(str(root))
+        assert m.algorithm == "sha256"
+        assert m.files["sub/b.txt"].size == 2
+        assert {p: e.digest for p, e in m.files.items()} == komparu.hash_dir(str(root))
+
+    def test_hashlib_algorithm(self, tmp_path):
+        root = _tree(tmp_path / "t", {f"f{i}": bytes([i]) * 100 for i in range(5)})
+        m = komparu.manifest_dir(str(root), algorithm="blake2b", max_workers=3)
+        assert m.files["f3"].digest == hashlib.blake2b(b"\3" * 100).hexdigest()
+        assert m == komparu.manifest_dir(str(root), algorithm="blake2b", max_workers=1)
+
+    def test_registered_algorithm(self, tmp_path):
+        komparu.register_hash("md5-test", hashlib.md5)
+        root = _tree(tmp_path / "t", {"a": b"abc"})
+        m = komparu.manifest_dir(str(root), algorithm="md5-test")
+        assert m.files["a"].digest == hashlib.md5(b"abc").hexdigest()
+
+    def test_unknown_algorithm(self, tmp_path):
+        with pytest.raises(ValueError, match="unknown hash algorithm"):
+            komparu.manifest_dir(str(tmp_path), algorithm="crc-nope")
+
+    def test_register_rejects_bad_arguments(self):
+        with pytest.raises(ValueError):
+            komparu.register_hash("", hashlib.md5)
+        with pytest.raises(TypeError):
+            komparu.register_hash("x", "md5")
+
+    def test_not_a_directory(self, tmp_path):
+        with pytest.raises(NotADirectoryError):
+            komparu.manifest_dir(str(tmp_path / "missing"))
+
+
+class TestManifestFile:
+    """write_manifest() and load_manifest() round-trip."""
+
+    def test_round_trip(self, tmp_path):
+        root = _tree(tmp_path / "t", {"a.txt": b"a", "sub/b.txt": b"bb"})
+        m = komparu.manifest_dir(str(root))
+        assert komparu.load_manifest(_save(m, tmp_path / "m.json")) == m
+
+    def test_document_layout(self, tmp_path):
+        m = Manifest("sha256", {"z": ManifestEntry(1, "ab"), "a": ManifestEntry(2, "cd")})
+        out = io.StringIO()
+        komparu.write_manifest(m, out)
+        doc = json.loads(out.getvalue())
+        assert doc["format"] == "komparu-manifest"
+        assert doc["algorithm"] == "sha256"
+        assert doc["files"] == [
+            {"path": "a", "size": 2, "digest": "cd"},
+            {"path": "z", "size": 1, "digest": "ab"},
+        ]
+
+    def test_windows_separators_and_case(self, tmp_path):
+        path = tmp_path / "m.json"
+        path.write_text(json.dumps({
+            "format": "komparu-manifest", "version": 1, "algorithm": "sha256",
+            "files": [{"path": "sub\\b.txt", "size": 2, "digest": "ABCD"}],
+        }))
+        m = komparu.load_manifest(str(path))
+        assert m.files == {"sub/b.txt": ManifestEntry(2, "abcd")}
+
+    def test_rejects_other_documents(self, tmp_path):
+        path = tmp_path / "m.json"
+        path.write_text('{"format": "komparu-snapshot", "version": 1}')
+        with pytest.raises(ValueError, match="not a manifest"):
+            komparu.load_manifest(str(path))
+        path.write_text('{"format": "komparu-manifest", "version": 1, "files": [{}]}')
+        with pytest.raises(ValueError, match="malformed"):
+            komparu.load_manifest(str(path))
+        path.write_text("not json")
+        with pytest.raises(ValueError, match="not a manifest"):
+            komparu.load_manifest(str(path))
+
+
+class TestVerifyManifest:
+    """verify_manifest() checks a tree against a manifest."""
+
+    def test_equal(self, tmp_path):
+        files = {"a.txt": b"a", "sub/b.txt": b"bb"}
+        m = komparu.manifest_dir(str(_tree(tmp_path / "src", files)))
+        result = komparu.verify_manifest(str(_tree(tmp_path / "dst", files)), m)
+        assert result.equal is True
+
+    def test_reports_changes(self, tmp_path):
+        m = komparu.manifest_dir(str(_tree(tmp_path / "src", {
+            "same": b"x", "edited": b"abc", "grown": b"a", "gone": b"g",
+        })))
+        dst = _tree(tmp_path / "dst", {
+            "same": b"x", "edited": b"abd", "grown": b"aa", "new": b"n",
+        })
+        result = komparu.verify_manifest(str(dst), _save(m, tmp_path / "m.json"))
+        assert result.equal is False
+        assert result.diff == {
+            "edited": DiffReason.CONTENT_MISMATCH,
+            "grown": DiffReason.SIZE_MISMATCH,
+        }
+        assert result.only_left == {"gone"}
+        assert result.only_right == {"new"}
+
+    def test_uses_manifest_algorithm(self, tmp_path):
+        root = _tree(tmp_path / "t", {"a": b"data"})
+        m = komparu.manifest_dir(str(root), algorithm="sha512")
+        assert komparu.verify_manifest(str(root), m).equal is True
+        (root / "a").write_bytes(b"date")
+        assert komparu.verify_manifest(str(root), m).diff == {"a": DiffReason.CONTENT_MISMATCH}
+
+    def test_unavailable_algorithm(self, tmp_path):
+        m = Manifest("not-installed", {})
+        with pytest.raises(ValueError, match="not-installed"):
+            komparu.verify_manifest(str(tmp_path), m)
+
+    def test_bad_manifest_type(self, tmp_path):
+        with pytest.raises(TypeError):
+            komparu.verify_manifest(str(tmp_path), {"a": "00"})
@@ -2,6 +2,7 @@
 
 from __future__ import annotations
 
+import io
 import os
 from pathlib import Path
 
@@ -89,6 +90,77 @@ class TestParallelDirCompare:
         result = komparu.compare_dir(str(a), str(b), max_workers=1)
         assert result.equal is True
 
+    def test_results_independent_of_worker_count(self, make_dir):
+        files_a = {f"d{i % 7}/f{i}": b"x%d" % i for i in range(60)}
+        files_b = {k: (v + b"!" if i % 3 == 0 else v)
+                   for i, (k, v) in enumerate(files_a.items())}
+        a = make_dir("a", files_a)
+        b = make_dir("b", files_b)
+        results = [komparu.compare_dir(str(a), str(b), max_workers=n) for n in (1, 2, 8)]
+        assert results[0].diff == results[1].diff == results[2].diff
+        assert len(results[0].diff) == 20
+
+
+_UNREADABLE = "/proc/self/mem"  # regular file whose read() fails with EIO
+
+
+@pytest.mark.skipif(not os.path.exists(_UNREADABLE), reason="needs /proc/self/mem")
+class TestStopOnError:
+    """A read error is isolated to its file unless stop_on_error is set."""
+
+    def _trees(self, make_dir):
+        files = {f"f{i:02}": b"same %d" % i for i in range(30)}
+        a = make_dir("a", files)
+        b = make_dir("b", files | {"m": b""})
+        (a / "m").symlink_to(_UNREADABLE)
+        return a, b
+
+    def test_error_isolated_by_default(self, make_dir):
+        a, b = self._trees(make_dir)
+        result = komparu.compare_dir(str(a), str(b), max_workers=4)
+        assert result.diff == {"m": DiffReason.READ_ERROR}
+
+    def test_stop_on_error_parallel(self, make_dir):
+        a, b = self._trees(make_dir)
+        with pytest.raises(OSError, match="cannot read m"):
+            komparu.compare_dir(str(a), str(b), max_workers=4, stop_on_error=True)
+
+    def test_stop_on_error_sequential(self, make_dir):
+        a, b = self._trees(make_dir)
+        with pytest.raises(OSError, match="cannot read m"):
+            komparu.compare_dir(str(a), str(b), max_workers=1, stop_on_error=True)
+
+    def test_first_error_in_path_order(self, make_dir):
+        a, b = self._trees(make_dir)
+        (a / "f05").unlink()
+        (a / "f05").symlink_to(_UNREADABLE)
+        (b / "f05").write_bytes(b"")
+        with pytest.raises(OSError, match="cannot read f05"):
+            komparu.compare_dir(str(a), str(b), max_workers=1, stop_on_error=True)
+
+    def test_summary(self, make_dir):
+        a, b = self._trees(make_dir)
+        with pytest.raises(OSError, match="cannot read m"):
+            komparu.compare_dir_summary(str(a), str(b), stop_on_error=True)
+
+    def test_no_error_unaffected(self, make_dir):
+        files = {f"f{i}": b"x" for i in range(10)}
+        a = make_dir("a", files)
+        b = make_dir("b", files | {"f3": b"y"})
+        result = komparu.compare_dir(str(a), str(b), stop_on_error=True)
+        assert result.diff == {"f3": DiffReason.CONTENT_MISMATCH}
+
+    @pytest.mark.skipif(os.geteuid() == 0, reason="root ignores permissions")
+    def test_walk_error(self, make_dir):
+        a = make_dir("a", {"ok": b"1", "locked/inner": b"2"})
+        b = make_dir("b", {"ok": b"1"})
+        (a / "locked").chmod(0o000)
+        try:
+            with pytest.raises(OSError, match="cannot read locked"):
+                komparu.compare_dir(str(a), str(b), stop_on_error=True)
+        finally:
+            (a / "locked").chmod(0o755)
+
 
 # =========================================================================
 # compare_all
@@ -252,6 +324,86 @@ class TestCompareMany:
         assert len(result.groups) == 1
 
 
+class TestCompareBatch:
+    """compare_batch — explicit list of pairs."""
+
+    def test_results_in_input_order(self, tmp_path: Path):
+        pairs = []
+        for i in range(10):
+            a = tmp_path / f"a{i}"
+            b = tmp_path / f"b{i}"
+            a.write_bytes(b"x" * 1000)
+            b.write_bytes(b"x" * i + b"y" + b"x" * (999 - i) if i % 2 else b"x" * 1000)
+            pairs.append((str(a), str(b)))
+        results = komparu.compare_batch(pairs, max_workers=4)
+        assert [(r.path_a, r.path_b) for r in results] == pairs
+        assert [r.equal for r in results] == [i % 2 == 0 for i in range(10)]
+        assert [r.first_diff_offset for r in results] == [
+            None if i % 2 == 0 else i for i in range(10)
+        ]
+
+    def test_error_isolated(self, tmp_path: Path):
+        a = tmp_path / "a"
+        a.write_bytes(b"data")
+        pairs = [(str(a), str(tmp_path / "missing")), (str(a), str(a))]
+        bad, good = komparu.compare_batch(pairs)
+        assert bad.equal is False
+        assert isinstance(bad.error, FileNotFoundError)
+        assert good.equal is True
+        assert good.error is None
+
+    def test_directory_pair(self, tmp_path: Path):
+        a = tmp_path / "a"
+        a.write_bytes(b"data")
+        [r] = komparu.compare_batch([(str(a), str(tmp_path))])
+        assert r.equal is False
+        assert isinstance(r.error, IsADirectoryError)
+
+    def test_size_mismatch(self, tmp_path: Path):
+        a = tmp_path / "a"
+        b = tmp_path / "b"
+        a.write_bytes(b"abc")
+        b.write_bytes(b"abd!")
+        [r] = komparu.compare_batch([(str(a), str(b))])
+        assert r.equal is False and r.first_diff_offset is None
+        [r] = komparu.compare_batch([(str(a), str(b))], size_precheck=False)
+        assert r.first_diff_offset == 2
+        # a prefix that differs from the start is not taken for the shorter size
+        b.write_bytes(b"Xbcd")
+        [r] = komparu.compare_batch([(str(a), str(b))])
+        assert r.first_diff_offset is None
+        [r] = komparu.compare_batch([(str(a), str(b))], size_precheck=False)
+        assert r.first_diff_offset == 0
+
+    def test_sequential_matches_parallel(self, tmp_path: Path):
+        a = tmp_path / "a"
+        b = tmp_path / "b"
+        a.write_bytes(b"one")
+        b.write_bytes(b"two")
+        pairs = [(str(a), str(b)), (str(a), str(a))] * 3
+        assert komparu.compare_batch(pairs, max_workers=1) == komparu.compare_batch(pairs)
+
+    def test_empty(self):
+        assert komparu.compare_batch([]) == []
+
+    def test_opener(self):
+        files = {"a": b"same", "b": b"same", "c": b"sane", "d": b"sam"}
+
+        def opener(path):
+            if path == "gone":
+                raise FileNotFoundError(path)
+            return io.BytesIO(files[path])
+
+        pairs = [("a", "b"), ("a", "c"), ("a", "d"), ("a", "gone")]
+        same, other, short, gone = komparu.compare_batch(pairs, opener=opener)
+        assert (same.equal, same.first_diff_offset) == (True, None)
+        assert (other.equal, other.first_diff_offset) == (False, 2)
+        assert (short.equal, short.first_diff_offset) == (False, None)
+        assert isinstance(gone.error, FileNotFoundError)
+        [short] = komparu.compare_batch([("a", "d")], opener=opener, size_precheck=False)
+        assert short.first_diff_offset == 3
+
+
 # =========================================================================
 # compare_dir_urls
 # =========================================================================
@@ -282,6 +434,14 @@ class TestCompareDirUrls:
             DiffReason.SIZE_MISMATCH,
         )
 
+    def test_backslash_keys(self, make_dir, httpserver):
+        d = make_dir("local", {"sub/file.txt": b"data"})
+        httpserver.expect_request("/file.txt").respond_with_data(b"data")
+
+        url_map = {"sub\\file.txt": httpserver.url_for("/file.txt")}
+        result = komparu.compare_dir_urls(str(d), url_map)
+        assert result.equal is True
+
     def test_only_local(self, make_dir, httpserver):
         d = make_dir("local", {"a.txt": b"data", "extra.txt": b"only local"})
         httpserver.expect_request("/a.txt").respond_with_data(b"data")
@@ -0,0 +1,177 @@
+"""Tests for remote comparison through the komparu serve agent."""
+
+from __future__ import annotations
+
+import io
+import json
+import os
+import sys
+from pathlib import Path
+
+import pytest
+
+import komparu
+from komparu import DiffReason
+
+
+@pytest.fixture
+def make_dir(tmp_path: Path):
+    """Create a directory tree from a dict of {relative_path: content}."""
+
+    def _make(name: str, files: dict[str, bytes]) -> Path:
+        d = tmp_path / name
+        d.mkdir(parents=True, exist_ok=True)
+        for rel, content in files.items():
+            p = d / rel
+            p.parent.mkdir(parents=True, exist_ok=True)
+            p.write_bytes(content)
+        return d
+
+    return _make
+
+
+def _agent(root: Path) -> list[str]:
+    return [sys.executable, "-m", "komparu", "serve", str(root)]
+
+
+def _serve(root: Path, *requests: dict) -> list[dict]:
+    stdin = io.BytesIO(b"".join(json.dumps(r).encode() + b"\n" for r in requests))
+    stdout = io.BytesIO()
+    komparu.serve_tree(str(root), stdin=stdin, stdout=stdout)
+    return [json.loads(line) for line in stdout.getvalue().splitlines()]
+
+
+class TestCompareRemote:
+    """A local tree against one served by an agent process."""
+
+    def test_equal(self, make_dir):
+        files = {"a.txt": b"alpha", "sub/b.bin": b"\0" * 3000}
+        a = make_dir("a", files)
+        b = make_dir("b", files)
+        assert komparu.compare_remote(str(a), _agent(b)).equal is True
+
+    def test_matches_compare_dir(self, make_dir):
+        a = make_dir("a", {"same": b"1", "content": b"ab", "size": b"a",
+                           "left": b"", "d/e/deep": b"x"})
+        b = make_dir("b", {"same": b"1", "content": b"ac", "size": b"aa",
+                           "right": b"", "d/e/deep": b"y"})
+        with komparu.RemoteTree(_agent(b)) as remote:
+            assert remote.root == str(b)
+            for options in ({}, {"exclude": ["d/"]}, {"include": ["s*"]}):
+                assert (remote.compare(str(a), **options)
+                        == komparu.compare_dir(str(a), str(b), **options))
+
+    def test_link_out_of_served_tree(self, make_dir, tmp_path):
+        files = {"a.txt": b"alpha", "sub/b.bin": b"\0" * 3000}
+        a = make_dir("a", {**files, "lib/x.so": b"x"})
+        b = make_dir("b", files)
+        make_dir("shared", {"lib/x.so": b"x"})
+        os.symlink("../shared/lib", b / "lib")
+        result = komparu.compare_remote(str(a), _agent(b))
+        assert result.diff == {"lib/x.so": DiffReason.READ_ERROR}
+        assert (result.only_left, result.only_right) == (set(), set())
+
+    def test_remote_cache(self, make_dir, tmp_path):
+        a = make_dir("a", {"f": b"1"})
+        b = make_dir("b", {"f": b"2"})
+        agent = [*_agent(b), "--cache-dir", str(tmp_path / "cache")]
+        result = komparu.compare_remote(str(a), agent, cache=str(tmp_path / "local"))
+        assert result.diff == {"f": DiffReason.CONTENT_MISMATCH}
+
+    def test_diff_ranges(self, make_dir):
+        a = make_dir("a", {"f": b"a" * 10 + b"b" * 10 + b"c" * 10, "g": b"x" * 8})
+        b = make_dir("b", {"f": b"a" * 10 + b"B" * 10 + b"c" * 10, "g": b"x" * 12})
+        with komparu.RemoteTree(_agent(b)) as remote:
+            assert remote.diff_ranges(str(a / "f"), "f", block_size=4) == [(8, 20)]
+            assert remote.diff_ranges(str(a / "g"), "g", block_size=4) == [(8, 12)]
+            assert remote.diff_ranges(str(a / "f"), "f", block_size=4096) == [(0, 30)]
+            assert remote.diff_ranges(str(b / "f"), "f") == []
+
+    def test_cancelled(self, make_dir):
+        a = make_dir("a", {"f": b"1"})
+        token = komparu.CancelToken()
+        token.cancel()
+        with pytest.raises(komparu.CancelledError):
+            komparu.compare_remote(str(a), _agent(a), cancel=token)
+
+
+class TestRemoteErrors:
+    """Agent failures surface as SourceReadError."""
+
+    def test_refused_path(self, make_dir):
+        b = make_dir("b", {"f": b"1"})
+        with komparu.RemoteTree(_agent(b)) as remote:
+            with pytest.raises(komparu.SourceReadError, match="outside the served tree"):
+                remote.digests(["../b/f"])
+            # the agent keeps serving after a refused request
+            assert remote.files() == ({"f": 1}, set())
+
+    def test_agent_exits(self, make_dir, tmp_path):
+        with pytest.raises(komparu.SourceReadError, match="exited with status 2"):
+            komparu.RemoteTree(_agent(tmp_path / "missing"))
+
+    def test_cannot_start(self, tmp_path):
+        with pytest.raises(komparu.SourceReadError, match="cannot start"):
+            komparu.RemoteTree([str(tmp_path / "no-such-agent")])
+
+    def test_bad_remote(self):
+        with pytest.raises(ValueError, match="host:path"):
+            komparu.RemoteTree("just-a-path")
+
+
+class TestServeTree:
+    """The agent's replies to raw protocol requests."""
+
+    def test_requests(self, make_dir):
+        root = make_dir("t", {"a": b"abc", "skip.log": b""})
+        hello, listing, digests, blocks, bye = _serve(
+            root,
+            {"op": "hello", "version": 1},
+            {"op": "list", "exclude": ["*.log"]},
+            {"op": "digests", "paths": ["a"]},
+            {"op": "blocks", "path": "a", "block_size": 2},
+            {"op": "bye"},
+            {"op": "hello"},  # not answered: the agent has exited
+        )
+        assert hello == {"ok": True, "version": 1, "root": str(root)}
+        assert listing == {"ok": True, "files": {"a": 3}, "errors": []}
+        assert digests["digests"] == {"a": komparu.hash_dir(str(root))["a"]}
+        assert [b[:2] for b in blocks["blocks"]] == [[0, 2], [2, 1]]
+        assert bye == {"ok": True}
+
+    def test_bad_requests(self, make_dir):
+        root = make_dir("t", {"a": b"abc"})
+        replies = _serve(
+            root,
+            {"op": "rm"},
+            {"paths": []},
+            {"op": "digests", "paths": ["/etc/passwd"]},
+            {"op": "blocks", "path": "missing", "block_size": 2},
+        )
+        assert [r["ok"] for r in replies] == [False] * 4
+        assert "unknown op" in replies[0]["error"]
+        assert replies[1]["error"].startswith("bad request")
+        assert "outside the served tree" in replies[2]["error"]
+        assert not replies[3]["error"].startswith("bad request")
+
+    def test_symlink_out_of_tree_refused(self, make_dir, tmp_path):
+        root = make_dir("t", {"a": b"abc"})
+        (tmp_path / "secret").write_bytes(b"outside")
+        os.symlink(tmp_path / "secret", root / "leak")
+        os.symlink(tmp_path, root / "up")
+        os.symlink("a", root / "inner")
+        replies = _serve(
+            root,
+            {"op": "digests", "paths": ["leak"]},
+            {"op": "blocks", "path": "up/secret", "block_size": 2},
+            {"op": "digests", "paths": ["inner"]},
+        )
+        assert [r["ok"] for r in replies] == [True, False, True]
+        assert replies[0] == {"ok": True, "digests": {}, "refused": ["leak"]}
+        assert "outside the served tree" in replies[1]["error"]
+        assert replies[2]["refused"] == []
+        assert list(replies[2]["digests"]) == ["inner"]
+
+    def test_not_a_directory(self, tmp_path):
+        with pytest.raises(NotADirectoryError):
+            komparu.serve_tree(str(tmp_path / "missing"), stdin=io.BytesIO(), stdout=io.BytesIO())
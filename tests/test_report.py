@@ -0,0 +1,286 @@
+"""Tests for JSON and CI annotation reports."""
+
+from __future__ import annotations
+
+import io
+import json
+import xml.etree.ElementTree as ET
+
+import pytest
+
+import komparu
+from komparu import DiffReason, DirResult
+
+
+def _result() -> DirResult:
+    return DirResult(
+        equal=False,
+        diff={"src/b.c": DiffReason.CONTENT_MISMATCH, "a.txt": DiffReason.SIZE_MISMATCH},
+        only_left={"old.txt"},
+        only_right={"new.txt"},
+        errors={"locked"},
+        renamed=[("x", "y")],
+    )
+
+
+def _render(result: DirResult, fmt: str, **kw) -> str:
+    out = io.StringIO()
+    komparu.write_report(result, fmt, out, **kw)
+    return out.getvalue()
+
+
+class TestJsonReport:
+    """The json format dumps every field with sorted paths."""
+
+    def test_fields(self):
+        doc = json.loads(_render(_result(), "json"))
+        assert doc["equal"] is False
+        assert list(doc["diff"]) == ["a.txt", "src/b.c"]
+        assert doc["diff"]["src/b.c"] == "content_mismatch"
+        assert doc["only_left"] == ["old.txt"]
+        assert doc["only_right"] == ["new.txt"]
+        assert doc["errors"] == ["locked"]
+        assert doc["renamed"] == [["x", "y"]]
+        assert doc["expected_diffs"] == {}
+        assert doc["stale_known_diffs"] == []
+
+    def test_from_compare_dir(self, tmp_path):
+        a, b = tmp_path / "a", tmp_path / "b"
+        for d in (a, b):
+            d.mkdir()
+            (d / "f").write_bytes(b"1")
+        doc = json.loads(_render(komparu.compare_dir(str(a), str(b)), "json"))
+        assert doc["equal"] is True
+        assert doc["diff"] == {}
+
+    def test_root_prefix(self):
+        doc = json.loads(_render(_result(), "json", root="build\\out"))
+        assert "build/out/src/b.c" in doc["diff"]
+        assert doc["renamed"] == [["build/out/x", "build/out/y"]]
+
+
+class TestGithubReport:
+    """The github format emits workflow command annotations."""
+
+    def test_lines(self):
+        lines = _render(_result(), "github").splitlines()
+        assert lines == [
+            "::error file=a.txt::differs (size_mismatch)",
+            "::error file=src/b.c::differs (content_mismatch)",
+            "::error file=old.txt::only in A",
+            "::error file=new.txt::only in B",
+            "::warning file=locked::could not be read",
+        ]
+
+    def test_known_diffs_are_notices(self):
+        result = DirResult(
+            equal=True, diff={}, only_left=set(), only_right=set(),
+            expected_diffs={"flaky": DiffReason.CONTENT_MISMATCH},
+            stale_known_diffs={"fixed"},
+        )
+        lines = _render(result, "github").splitlines()
+        assert lines == [
+            "::notice file=flaky::known difference (content_mismatch)",
+            "::notice file=fixed::listed in known_diffs but now equal",
+        ]
+
+    def test_escaping(self):
+        result = DirResult(
+            equal=False, diff={"a,b:c%.txt": DiffReason.CONTENT_MISMATCH},
+            only_left=set(), only_right=set(),
+        )
+        assert _render(result, "github") == (
+            "::error file=a%2Cb%3Ac%25.txt::differs (content_mismatch)\n"
+        )
+
+    def test_equal_writes_nothing(self):
+        result = DirResult(equal=True, diff={}, only_left=set(), only_right=set())
+        assert _render(result, "github") == ""
+
+
+def _dir_report() -> komparu.DirReport:
+    entries = [
+        komparu.ReportEntry("a.txt", komparu.EntryStatus.DIFFERENT, DiffReason.SIZE_MISMATCH,
+                            size_a=1, size_b=2, first_diff_offset=1),
+        komparu.ReportEntry("b.txt", komparu.EntryStatus.EQUAL, size_a=3, size_b=3),
+        komparu.ReportEntry("new.txt", komparu.EntryStatus.ONLY_RIGHT, size_b=4),
+    ]
+    return komparu.DirReport("left", "right", False, entries)
+
+
+class TestDirReportFormats:
+    """write_report renders a DirReport as JSON, NDJSON, JUnit or SARIF."""
+
+    def test_json(self):
+        out = io.StringIO()
+        komparu.write_report(_dir_report(), "json", out)
+        doc = json.loads(out.getvalue())
+        assert (doc["equal"], doc["dir_a"], doc["dir_b"]) == (False, "left", "right")
+        assert doc["diff"] == {"a.txt": "size_mismatch"}
+        assert doc["only_right"] == ["new.txt"]
+        assert doc["counts"] == {"equal": 1, "different": 1, "only_left": 0,
+                                 "only_right": 1, "error": 0}
+        assert doc["entries"][0] == {"path": "a.txt", "status": "different",
+                                     "reason": "size_mismatch", "size_a": 1, "size_b": 2,
+                                     "first_diff_offset": 1, "metadata": []}
+
+    def test_ndjson(self):
+        out = io.StringIO()
+        komparu.write_report(_dir_report(), "ndjson", out)
+        lines = out.getvalue().splitlines()
+        assert len(lines) == 3
+        assert " " not in lines[0]
+        assert json.loads(lines[2]) == {"path": "new.txt", "status": "only_right",
+                                        "reason": None, "size_a": None, "size_b": 4,
+                                        "first_diff_offset": None, "metadata": []}
+
+    def test_empty_ndjson(self):
+        out = io.StringIO()
+        komparu.write_report(komparu.DirReport("a", "b", True, []), "ndjson", out)
+        assert out.getvalue() == ""
+
+    def test_junit(self):
+        out = io.StringIO()
+        report = komparu.DirReport("left", "right", False, _dir_report().entries + [
+            komparu.ReportEntry("locked", komparu.EntryStatus.ERROR, DiffReason.READ_ERROR),
+        ])
+        komparu.write_report(report, "junit", out)
+        assert out.getvalue().startswith('<?xml version="1.0" encoding="UTF-8"?>\n')
+        suites = ET.fromstring(out.getvalue())
+        suite = suites.find("testsuite")
+        assert suite.get("name") == "left vs right"
+        assert [suites.get(k) for k in ("tests", "failures", "errors")] == ["4", "2", "1"]
+        cases = {c.get("name"): c for c in suite.iter("testcase")}
+        assert list(cases) == ["a.txt", "b.txt", "new.txt", "locked"]
+        assert len(cases["b.txt"]) == 0
+        failure = cases["a.txt"].find("failure")
+        assert failure.get("type") == "size_mismatch"
+        assert failure.get("message") == "a.txt: differs (size_mismatch) at offset 1"
+        assert failure.text == "left/a.txt: size 1\nright/a.txt: size 2\n"
+        assert cases["new.txt"].find("failure").get("message") == "new.txt: only in B"
+        assert cases["locked"].find("error").get("type") == "read_error"
+
+    def test_junit_control_characters(self):
+        out = io.StringIO()
+        report = komparu.DirReport("left", "right", False, [
+            komparu.ReportEntry("bell\x07\udcff", komparu.EntryStatus.ONLY_LEFT, size_a=1),
+        ])
+        komparu.write_report(report, "junit", out)
+        (case,) = ET.fromstring(out.getvalue()).iter("testcase")
+        assert case.get("name") == "bell\\x07\\xff"
+        assert case.find("failure").text.startswith("left/bell\\x07\\xff: size 1\n")
+
+    def test_sarif(self):
+        out = io.StringIO()
+        komparu.write_report(_dir_report(), "sarif", out)
+        doc = json.loads(out.getvalue())
+        assert doc["version"] == "2.1.0"
+        (run,) = doc["runs"]
+        assert run["tool"]["driver"]["name"] == "komparu"
+        assert [r["id"] for r in run["tool"]["driver"]["rules"]] == ["only_right",
+                                                                     "size_mismatch"]
+        assert run["originalUriBaseIds"]["DIR_B"]["uri"].endswith("/right/")
+        first, only = run["results"]
+        assert first["ruleId"] == "size_mismatch"
+        assert first["level"] == "error"
+        assert first["message"]["text"] == "a.txt: differs (size_mismatch) at offset 1"
+        assert first["locations"][0]["physicalLocation"] == {
+            "artifactLocation": {"uri": "a.txt", "uriBaseId": "DIR_B"},
+            "region": {"byteOffset": 1, "byteLength": 1},
+        }
+        assert "region" not in only["locations"][0]["physicalLocation"]
+
+    def test_sarif_only_left_and_errors(self):
+        out = io.StringIO()
+        report = komparu.DirReport("a", "b", False, [
+            komparu.ReportEntry("gone dir/x", komparu.EntryStatus.ONLY_LEFT, size_a=1),
+            komparu.ReportEntry("locked", komparu.EntryStatus.ERROR, DiffReason.READ_ERROR),
+        ])
+        komparu.write_report(report, "sarif", out)
+        gone, locked = json.loads(out.getvalue())["runs"][0]["results"]
+        assert gone["locations"][0]["physicalLocation"]["artifactLocation"] == {
+            "uri": "gone%20dir/x", "uriBaseId": "DIR_A",
+        }
+        assert locked["level"] == "warning"
+
+    def test_sarif_equal_has_no_results(self):
+        out = io.StringIO()
+        report = komparu.DirReport("a", "b", True, [
+            komparu.ReportEntry("f", komparu.EntryStatus.EQUAL, size_a=1, size_b=1),
+        ])
+        komparu.write_report(report, "sarif", out)
+        assert json.loads(out.getvalue())["runs"][0]["results"] == []
+
+    def test_unknown_format(self):
+        with pytest.raises(ValueError, match="ndjson"):
+            komparu.write_report(_dir_report(), "xml", io.StringIO())
+
+    def test_root_prefix(self):
+        out = io.StringIO()
+        komparu.write_report(_dir_report(), "ndjson", out, root="out")
+        assert json.loads(out.getvalue().splitlines()[0])["path"] == "out/a.txt"
+
+    def test_github(self):
+        out = io.StringIO()
+        komparu.write_report(_dir_report(), "github", out)
+        assert out.getvalue().splitlines() == [
+            "::error file=a.txt::differs (size_mismatch)",
+            "::error file=new.txt::only in B",
+        ]
+
+    def test_dir_result_entries(self):
+        lines = _render(_result(), "ndjson").splitlines()
+        entries = {e["path"]: e["status"] for e in map(json.loads, lines)}
+        assert entries == {"a.txt": "different", "src/b.c": "different", "old.txt": "only_left",
+                           "new.txt": "only_right", "locked": "error"}
+        doc = json.loads(_render(_result(), "sarif"))
+        assert "originalUriBaseIds" not in doc["runs"][0]
+
+
+class TestThreeWayReport:
+    """write_three_way_report writes every path with its merge status."""
+
+    def _result(self) -> komparu.ThreeWayResult:
+        return komparu.compare_three_way({"a": "11", "b": "22"}, {"a": "11", "b": "33"},
+                                         {"a": "11", "b": "44"})
+
+    def test_json(self):
+        out = io.StringIO()
+        komparu.write_three_way_report(self._result(), "json", out)
+        doc = json.loads(out.getvalue())
+        assert doc["clean"] is False
+        assert doc["counts"] == {"unchanged": 1, "changed_left": 0, "changed_right": 0,
+                                 "changed_both_same": 0, "conflict": 1}
+        assert doc["entries"] == [{"path": "a", "status": "unchanged"},
+                                  {"path": "b", "status": "conflict"}]
+
+    def test_ndjson(self):
+        out = io.StringIO()
+        komparu.write_three_way_report(self._result(), "ndjson", out)
+        assert out.getvalue() == ('{"path":"a","status":"unchanged"}\n'
+                                  '{"path":"b","status":"conflict"}\n')
+
+    def test_unknown_format(self):
+        with pytest.raises(ValueError, match="known: json, ndjson"):
+            komparu.write_three_way_report(self._result(), "sarif", io.StringIO())
+
+
+class TestReportRegistry:
+    """Formats are looked up in an extensible registry."""
+
+    def test_unknown_format(self):
+        with pytest.raises(ValueError, match="unknown report format 'xml'"):
+            _render(_result(), "xml")
+
+    def test_register(self):
+        def count(result: DirResult, out) -> None:
+            out.write(f"{len(result.diff)} differ\n")
+
+        komparu.register_report_format("count", count)
+        assert _render(_result(), "count") == "2 differ\n"
+
+    def test_register_validation(self):
+        with pytest.raises(ValueError, match="name"):
+            komparu.register_report_format("", lambda r, o: None)
+        with pytest.raises(TypeError, match="callable"):
+            komparu.register_report_format("x", "nope")
@@ -0,0 +1,165 @@
+"""Tests for directory snapshots and change detection since a snapshot."""
+
+from __future__ import annotations
+
+import json
+import os
+import time
+
+import pytest
+
+import komparu
+from komparu import DiffReason
+
+_HOUR_AGO = time.time() - 3600
+
+
+def _tree(root, files):
+    for rel, data in files.items():
+        path = root / rel
+        path.parent.mkdir(parents=True, exist_ok=True)
+        path.write_bytes(data)
+        os.utime(path, (_HOUR_AGO, _HOUR_AGO))
+    return root
+
+
+class TestSnapshotDir:
+    """snapshot_dir() hashes the tree and writes a manifest."""
+
+    def test_returns_digests(self, tmp_path):
+        root = _tree(tmp_path / "t", {"a.txt": b"a", "sub/b.txt": b"b"})
+        digests = komparu.snapshot_dir(str(root), str(tmp_path / "snap.json"))
+        assert digests == komparu.hash_dir(str(root))
+
+    def test_manifest_contents(self, tmp_path):
+        root = _tree(tmp_path / "t", {"sub/b.txt": b"bb"})
+        manifest = tmp_path / "snap.json"
+        komparu.snapshot_dir(str(root), str(manifest))
+        doc = json.loads(manifest.read_text())
+        entry = doc["files"]["sub/b.txt"]
+        assert entry["size"] == 2
+        assert entry["mtime_ns"] == os.stat(root / "sub/b.txt").st_mtime_ns
+        assert len(entry["sha256"]) == 64
+
+    def test_replaces_previous(self, tmp_path):
+        root = _tree(tmp_path / "t", {"a.txt": b"a"})
+        manifest = tmp_path / "snap.json"
+        komparu.snapshot_dir(str(root), str(manifest))
+        (root / "a.txt").unlink()
+        komparu.snapshot_dir(str(root), str(manifest))
+        assert json.loads(manifest.read_text())["files"] == {}
+        assert sorted(os.listdir(tmp_path)) == ["snap.json", "t"]  # no temp file left
+
+    def test_not_a_directory(self, tmp_path):
+        with pytest.raises(NotADirectoryError):
+            komparu.snapshot_dir(str(tmp_path / "missing"), str(tmp_path / "snap.json"))
+
+    @pytest.mark.skipif(os.name != "posix", reason="needs POSIX symlinks")
+    def test_symlink_cycle(self, tmp_path):
+        root = _tree(tmp_path / "t", {"sub/a.txt": b"a"})
+        os.symlink("..", root / "sub/up")
+        digests = komparu.snapshot_dir(str(root), str(tmp_path / "snap.json"))
+        assert list(digests) == ["sub/a.txt"]
+
+
+class TestDiffSinceSnapshot:
+    """diff_since_snapshot() reports added, removed and modified files."""
+
+    def _snap(self, tmp_path, files):
+        root = _tree(tmp_path / "t", files)
+        manifest = tmp_path / "snap.json"
+        komparu.snapshot_dir(str(root), str(manifest))
+        return root, manifest
+
+    def test_unchanged(self, tmp_path):
+        root, manifest = self._snap(tmp_path, {"a.txt": b"a", "sub/b.txt": b"b"})
+        result = komparu.diff_since_snapshot(str(root), str(manifest))
+        assert result.equal is True
+
+    def test_added_removed_modified(self, tmp_path):
+        root, manifest = self._snap(tmp_path, {"keep": b"k", "gone": b"g", "edit": b"v1", "grow": b"x"})
+        (root / "gone").unlink()
+        (root / "new").write_bytes(b"n")
+        (root / "edit").write_bytes(b"v2")
+        (root / "grow").write_bytes(b"xyz")
+        result = komparu.diff_since_snapshot(str(root), str(manifest))
+        assert result.equal is False
+        assert result.only_left == {"gone"}
+        assert result.only_right == {"new"}
+        assert result.diff == {
+            "edit": DiffReason.CONTENT_MISMATCH,
+            "grow": DiffReason.SIZE_MISMATCH,
+        }
+
+    def test_touched_not_reported(self, tmp_path):
+        root, manifest = self._snap(tmp_path, {"a.txt": b"same"})
+        os.utime(root / "a.txt")
+        assert komparu.diff_since_snapshot(str(root), str(manifest)).equal is True
+
+    def test_unchanged_stat_not_rehashed(self, tmp_path):
+        root, manifest = self._snap(tmp_path, {"a.txt": b"aaaa"})
+        # Same size, restored mtime: trusted without reading
+        st = os.stat(root / "a.txt")
+        (root / "a.txt").write_bytes(b"bbbb")
+        os.utime(root / "a.txt", ns=(st.st_atime_ns, st.st_mtime_ns))
+        assert komparu.diff_since_snapshot(str(root), str(manifest)).equal is True
+
+    def test_recent_mtime_rehashed(self, tmp_path):
+        root = tmp_path / "t"
+        root.mkdir()
+        (root / "a.txt").write_bytes(b"aaaa")
+        manifest = tmp_path / "snap.json"
+        komparu.snapshot_dir(str(root), str(manifest))
+        st = os.stat(root / "a.txt")
+        (root / "a.txt").write_bytes(b"bbbb")
+        os.utime(root / "a.txt", ns=(st.st_atime_ns, st.st_mtime_ns))
+        result = komparu.diff_since_snapshot(str(root), str(manifest))
+        assert result.diff == {"a.txt": DiffReason.CONTENT_MISMATCH}
+
+    def test_update_rewrites_manifest(self, tmp_path):
+        root, manifest = self._snap(tmp_path, {"a.txt": b"a"})
+        (root / "b.txt").write_bytes(b"b")
+        first = komparu.diff_since_snapshot(str(root), str(manifest), update=True)
+        assert first.only_right == {"b.txt"}
+        assert komparu.diff_since_snapshot(str(root), str(manifest)).equal is True
+        doc = json.loads(manifest.read_text())
+        assert set(doc["files"]) == {"a.txt", "b.txt"}
+
+    def test_without_update_manifest_kept(self, tmp_path):
+        root, manifest = self._snap(tmp_path, {"a.txt": b"a"})
+        before = manifest.read_bytes()
+        (root / "b.txt").write_bytes(b"b")
+        komparu.diff_since_snapshot(str(root), str(manifest))
+        assert manifest.read_bytes() == before
+
+    def test_missing_manifest(self, tmp_path):
+        root = _tree(tmp_path / "t", {"a.txt": b"a"})
+        with pytest.raises(FileNotFoundError):
+            komparu.diff_since_snapshot(str(root), str(tmp_path / "none.json"))
+
+    def test_foreign_manifest(self, tmp_path):
+        root = _tree(tmp_path / "t", {"a.txt": b"a"})
+        manifest = tmp_path / "hashes.json"
+        manifest.write_text(json.dumps(komparu.hash_dir(str(root))))
+        with pytest.raises(ValueError, match="not a snapshot manifest"):
+            komparu.diff_since_snapshot(str(root), str(manifest))
+
+    @pytest.mark.skipif(os.name != "posix" or os.geteuid() == 0,
+                        reason="needs POSIX permissions as non-root")
+    def test_unreadable_dir_not_removed(self, tmp_path):
+        root, manifest = self._snap(tmp_path, {"locked/a.txt": b"a", "b.txt": b"b"})
+        os.chmod(root / "locked", 0)
+        try:
+            result = komparu.diff_since_snapshot(str(root), str(manifest))
+        finally:
+            os.chmod(root / "locked", 0o755)
+        assert result.errors == {"locked"}
+        assert result.only_left == set()
+
+    @pytest.mark.skipif(os.name != "posix", reason="needs POSIX symlinks")
+    def test_symlink_loop_is_error(self, tmp_path):
+        root, manifest = self._snap(tmp_path, {"a.txt": b"a"})
+        os.symlink("loop", root / "loop")
+        result = komparu.diff_since_snapshot(str(root), str(manifest))
+        assert result.errors == {"loop"}
+        assert result.only_right == set()
@@ -0,0 +1,70 @@
+"""Tests for tune_read, the read strategy benchmark."""
+
+from __future__ import annotations
+
+import os
+
+import pytest
+
+import komparu
+
+
+@pytest.fixture
+def sample(tmp_path):
+    path = tmp_path / "sample.bin"
+    path.write_bytes(os.urandom(300_000))
+    return str(path)
+
+
+class TestTuneRead:
+    """Every strategy and chunk size is timed on the sample."""
+
+    def test_trials(self, sample):
+        result = komparu.tune_read(sample, chunk_sizes=[4096, 65536],
+                                   strategies=["mmap", "buffered", "prefetch"], rounds=1)
+        assert result.size == 300_000
+        assert [(t.strategy, t.chunk_size) for t in result.trials] == [
+            ("mmap", 4096), ("mmap", 65536), ("buffered", 4096), ("buffered", 65536),
+            ("prefetch", 4096), ("prefetch", 65536),
+        ]
+        assert all(t.seconds > 0 and t.throughput > 0 for t in result.trials)
+        assert result.best in result.trials
+        assert result.best.seconds == min(t.seconds for t in result.trials)
+        assert result.unavailable == {}
+
+    def test_options_select_the_trial(self, sample):
+        trial = komparu.TuneTrial("prefetch", 4096, 1.0, 1.0)
+        assert trial.options == {"chunk_size": 4096, "strategy": "prefetch"}
+        assert komparu.compare(sample, sample, **trial.options) is True
+        trial = komparu.TuneTrial("io_uring", 65536, 1.0, 1.0)
+        assert trial.options == {"chunk_size": 65536, "io_uring": True}
+
+    def test_io_uring(self, sample):
+        result = komparu.tune_read(sample, chunk_sizes=[65536], strategies=["io_uring"],
+                                   rounds=1)
+        if result.trials:
+            assert result.trials[0].strategy == "io_uring"
+        else:
+            assert result.unavailable == {"io_uring": "uring_unavailable"}
+
+    def test_cancelled(self, sample):
+        token = komparu.CancelToken()
+        token.cancel()
+        with pytest.raises(komparu.CancelledError):
+            komparu.tune_read(sample, cancel=token)
+
+    def test_validation(self, sample, tmp_path):
+        with pytest.raises(ValueError, match="strategy"):
+            komparu.tune_read(sample, strategies=["auto"])
+        with pytest.raises(ValueError, match="chunk_sizes"):
+            komparu.tune_read(sample, chunk_sizes=[])
+        with pytest.raises(ValueError, match="chunk_size"):
+            komparu.tune_read(sample, chunk_sizes=[0])
+        with pytest.raises(ValueError, match="rounds"):
+            komparu.tune_read(sample, rounds=0)
+        empty = tmp_path / "empty"
+        empty.write_bytes(b"")
+        with pytest.raises(ValueError, match="empty"):
+            komparu.tune_read(str(empty))
+        with pytest.raises(FileNotFoundError):
+            komparu.tune_read(str(tmp_path / "missing"))
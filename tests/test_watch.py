@@ -0,0 +1,197 @@
+"""Tests for Watcher: continuous comparison of two changing trees."""
+
+from __future__ import annotations
+
+import shutil
+import sys
+import threading
+from pathlib import Path
+
+import pytest
+
+import komparu
+from komparu import DiffReason
+
+linux_only = pytest.mark.skipif(not sys.platform.startswith("linux"), reason="inotify is Linux-only")
+
+
+@pytest.fixture
+def make_dir(tmp_path: Path):
+    """Create a directory tree from a dict of {relative_path: content}."""
+
+    def _make(name: str, files: dict[str, bytes]) -> Path:
+        d = tmp_path / name
+        d.mkdir(parents=True, exist_ok=True)
+        for rel, content in files.items():
+            p = d / rel
+            p.parent.mkdir(parents=True, exist_ok=True)
+            p.write_bytes(content)
+        return d
+
+    return _make
+
+
+def _watch(a: Path, b: Path, backend: str, **kwargs) -> komparu.Watcher:
+    return komparu.Watcher(str(a), str(b), backend=backend, interval=0.05, **kwargs)
+
+
+def _next(watcher: komparu.Watcher) -> komparu.WatchEvent:
+    event = watcher.poll(5.0)
+    assert event is not None, "no event within 5 s"
+    return event
+
+
+class TestWatcher:
+    """Events as the trees change, seen through the poll backend."""
+
+    def test_initial_result(self, make_dir):
+        a = make_dir("a", {"f": b"1", "g": b"2"})
+        b = make_dir("b", {"f": b"1", "g": b"3"})
+        with _watch(a, b, "poll") as w:
+            assert w.backend == "poll"
+            assert w.result.equal is False
+            assert w.result.diff == {"g": DiffReason.CONTENT_MISMATCH}
+
+    def test_diverge_and_converge(self, make_dir):
+        a = make_dir("a", {"f": b"same", "sub/g": b"x"})
+        b = make_dir("b", {"f": b"same", "sub/g": b"x"})
+        with _watch(a, b, "poll") as w:
+            assert w.result.equal is True
+            (b / "sub" / "g").write_bytes(b"y")
+            event = _next(w)
+            assert event.kind == "diverged"
+            assert event.result.diff == {"sub/g": DiffReason.CONTENT_MISMATCH}
+            assert "sub/g" in event.changed
+            (a / "sub" / "g").write_bytes(b"y")
+            event = _next(w)
+            assert event.kind == "converged"
+            assert event.result.equal is True
+            assert w.result.equal is True
+
+    def test_changed(self, make_dir):
+        a = make_dir("a", {"f": b"1"})
+        b = make_dir("b", {"f": b"2"})
+        with _watch(a, b, "poll") as w:
+            (a / "new").write_bytes(b"")
+            event = _next(w)
+            assert event.kind == "changed"
+            assert event.result.only_left == {"new"}
+            assert event.result.diff == {"f": DiffReason.CONTENT_MISMATCH}
+
+    def test_directories(self, make_dir):
+        a = make_dir("a", {"keep": b"k"})
+        b = make_dir("b", {"keep": b"k"})
+        with _watch(a, b, "poll") as w:
+            (a / "d" / "e").mkdir(parents=True)
+            (a / "d" / "e" / "f").write_bytes(b"abc")
+            event = _next(w)
+            assert event.kind == "diverged"
+            assert event.result.only_left == {"d/e/f"}
+            shutil.copytree(a / "d", b / "d")
+            assert _next(w).kind == "converged"
+            shutil.rmtree(b / "d")
+            assert _next(w).result.only_left == {"d/e/f"}
+            shutil.rmtree(a / "d")
+            assert _next(w).kind == "converged"
+
+    def test_size_mismatch_and_removal(self, make_dir):
+        a = make_dir("a", {"f": b"1"})
+        b = make_dir("b", {"f": b"1"})
+        with _watch(a, b, "poll") as w:
+            (b / "f").write_bytes(b"12")
+            assert _next(w).result.diff == {"f": DiffReason.SIZE_MISMATCH}
+            (b / "f").unlink()
+            event = _next(w)
+            assert event.kind == "changed"
+            assert event.result.only_left == {"f"}
+            assert event.result.diff == {}
+
+    def test_exclude(self, make_dir):
+        a = make_dir("a", {"f": b"1", "x.log": b"1"})
+        b = make_dir("b", {"f": b"1", "x.log": b"2"})
+        with _watch(a, b, "poll", exclude=["*.log"]) as w:
+            assert w.result.equal is True
+            (b / "y.log").write_bytes(b"")
+            assert w.poll(0.5) is None
+            (b / "f").write_bytes(b"2")
+            assert _next(w).result.diff == {"f": DiffReason.CONTENT_MISMATCH}
+
+    def test_iterate_until_closed(self, make_dir):
+        a = make_dir("a", {"f": b"1"})
+        b = make_dir("b", {"f": b"1"})
+        w = _watch(a, b, "poll")
+        threading.Timer(0.2, (b / "f").write_bytes, [b"2"]).start()
+        kinds = []
+        for event in w:
+            kinds.append(event.kind)
+            w.close()
+        assert kinds == ["diverged"]
+
+    def test_no_event_without_change(self, make_dir):
+        a = make_dir("a", {"f": b"1"})
+        b = make_dir("b", {"f": b"1"})
+        with _watch(a, b, "poll") as w:
+            (a / "f").write_bytes(b"1")  # rewritten, still equal
+            assert w.poll(0.5) is None
+        assert w.poll(0.1) is None
+
+
+@linux_only
+class TestInotify:
+    """The inotify backend watches every directory of both trees."""
+
+    def test_auto_picks_inotify(self, make_dir):
+        a = make_dir("a", {})
+        with komparu.Watcher(str(a), str(a)) as w:
+            assert w.backend == "inotify"
+
+    def test_diverge_and_converge(self, make_dir):
+        a = make_dir("a", {"sub/g": b"x"})
+        b = make_dir("b", {"sub/g": b"x"})
+        with _watch(a, b, "inotify") as w:
+            (b / "sub" / "g").write_bytes(b"y")
+            event = _next(w)
+            assert event.kind == "diverged"
+            assert event.changed == {"sub/g"}
+            (a / "sub" / "g").write_bytes(b"y")
+            assert _next(w).kind == "converged"
+
+    def test_new_and_moved_directories(self, make_dir, tmp_path):
+        a = make_dir("a", {"keep": b"k"})
+        b = make_dir("b", {"keep": b"k"})
+        with _watch(a, b, "inotify") as w:
+            (a / "d" / "e").mkdir(parents=True)
+            (a / "d" / "e" / "f").write_bytes(b"abc")
+            assert _next(w).result.only_left == {"d/e/f"}
+            # a directory created later is watched too
+            (a / "d" / "e" / "g").write_bytes(b"")
+            assert _next(w).result.only_left == {"d/e/f", "d/e/g"}
+            shutil.copytree(a / "d", tmp_path / "staging")
+            (tmp_path / "staging").rename(b / "d")
+            assert _next(w).kind == "converged"
+            (b / "d").rename(tmp_path / "gone")
+            event = _next(w)
+            assert event.result.only_left == {"d/e/f", "d/e/g"}
+            (tmp_path / "gone" / "e" / "f").write_bytes(b"moved away")
+            assert w.poll(0.5) is None
+
+    def test_exclude(self, make_dir):
+        a = make_dir("a", {"f": b"1"})
+        b = make_dir("b", {"f": b"1"})
+        with _watch(a, b, "inotify", exclude=["build/"]) as w:
+            (b / "build").mkdir()
+            (b / "build" / "out.o").write_bytes(b"")
+            assert w.poll(0.5) is None
+
+
+class TestValidation:
+    """Bad arguments are rejected before anything is watched."""
+
+    def test_bad_arguments(self, make_dir, tmp_path):
+        a = make_dir("a", {})
+        with pytest.raises(ValueError, match="backend"):
+            komparu.Watcher(str(a), str(a), backend="fsevents")
+        with pytest.raises(ValueError, match="interval"):
+            komparu.Watcher(str(a), str(a), interval=0)
+        with pytest.raises(NotADirectoryError):
+            komparu.Watcher(str(a), str(tmp_path / "missing"))